@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ack records who acknowledged an alert. Acknowledged alerts skip repeat
+// notifications until they resolve or the acknowledgment expires.
+type Ack struct {
+	Fingerprint string    `json:"fingerprint"`
+	By          string    `json:"by"`
+	At          time.Time `json:"at"`
+	Comment     string    `json:"comment,omitempty"`
+	ExpiresAt   time.Time `json:"expiresAt,omitempty"`
+}
+
+// newAck returns an acknowledgment made at now, expiring after the
+// configured TTL.
+func newAck(fingerprint, by, comment string, now time.Time) Ack {
+	ack := Ack{Fingerprint: fingerprint, By: by, At: now, Comment: comment}
+	if ttl := getRuntime().Config.Acks.TTL; ttl > 0 {
+		ack.ExpiresAt = now.Add(ttl)
+	}
+	return ack
+}
+
+// Active reports whether the acknowledgment still applies at now.
+func (a Ack) Active(now time.Time) bool {
+	return a.ExpiresAt.IsZero() || now.Before(a.ExpiresAt)
+}
+
+// AckStore holds acknowledgments keyed by alert fingerprint. With a path,
+// every change is written to disk so acknowledgments survive restarts.
+type AckStore struct {
+	mu   sync.Mutex
+	path string
+	acks map[string]Ack
+}
+
+var acks = NewAckStore("")
+
+func NewAckStore(path string) *AckStore {
+	return &AckStore{path: path, acks: map[string]Ack{}}
+}
+
+// LoadAckStore opens the store persisted at path, starting empty when the
+// file does not exist yet.
+func LoadAckStore(path string) (*AckStore, error) {
+	s := NewAckStore(path)
+	if err := loadState(path, &s.acks); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Ack records ack, replacing any earlier acknowledgment of the alert.
+func (s *AckStore) Ack(ack Ack) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acks[ack.Fingerprint] = ack
+	return s.save()
+}
+
+// Get returns the active acknowledgment for the alert with key.
+func (s *AckStore) Get(key string, now time.Time) (Ack, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ack, ok := s.acks[key]
+	if !ok || !ack.Active(now) {
+		return Ack{}, false
+	}
+	return ack, true
+}
+
+// Clear forgets the acknowledgments for keys.
+func (s *AckStore) Clear(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for _, key := range keys {
+		if _, ok := s.acks[key]; ok {
+			delete(s.acks, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// List returns the active acknowledgments, oldest first.
+func (s *AckStore) List(now time.Time) []Ack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Ack, 0, len(s.acks))
+	for _, ack := range s.acks {
+		if ack.Active(now) {
+			list = append(list, ack)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].At.Before(list[j].At) })
+	return list
+}
+
+// save writes the store to disk. The caller must hold s.mu.
+func (s *AckStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return saveState(s.path, s.acks)
+}
+
+// loadState decodes the JSON state file at path into v, leaving v untouched
+// when the file does not exist.
+func loadState(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse state file %s: %v", path, err)
+	}
+	return nil
+}
+
+// saveState atomically replaces the JSON state file at path with v.
+func saveState(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error finalizing state file: %v", err)
+	}
+	return nil
+}
+
+// syncState is saveState for state that must survive a crash of the host:
+// the file and its directory entry are flushed to disk before it returns.
+func syncState(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error finalizing state file: %v", err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes the entries of dir, such as a rename into it, to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing state directory: %v", err)
+	}
+	return nil
+}
+
+// allAcknowledged reports whether payload is firing and every firing alert
+// in it has been acknowledged, making the notification a reminder that can
+// be skipped.
+func allAcknowledged(payload *AlertManagerPayload, now time.Time) bool {
+	firing := 0
+	for _, alert := range payload.Alerts {
+		if alert.Status == "resolved" {
+			continue
+		}
+		firing++
+		if _, ok := acks.Get(alertKey(alert), now); !ok {
+			return false
+		}
+	}
+	return firing > 0
+}
+
+// clearResolvedAcks forgets the acknowledgments of resolved alerts in
+// payload, so the alert is announced again if it fires later.
+func clearResolvedAcks(reqID string, payload *AlertManagerPayload) {
+	var keys []string
+	for _, alert := range payload.Alerts {
+		if alert.Status == "resolved" {
+			keys = append(keys, alertKey(alert))
+		}
+	}
+	if err := acks.Clear(keys...); err != nil {
+		logger.Error("[%s] Error clearing acknowledgments: %v", reqID, err)
+	}
+}
+
+// ackHandler lists acknowledgments on GET, records one on POST and removes
+// one on DELETE with a fingerprint query parameter.
+func ackHandler(w http.ResponseWriter, r *http.Request) {
+	now := clock.Now()
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(acks.List(now))
+	case http.MethodPost:
+		var ack Ack
+		if err := json.NewDecoder(r.Body).Decode(&ack); err != nil {
+			http.Error(w, "Invalid acknowledgment: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ack.Fingerprint == "" || ack.By == "" {
+			http.Error(w, "fingerprint and by are required", http.StatusBadRequest)
+			return
+		}
+		ack = newAck(ack.Fingerprint, ack.By, ack.Comment, now)
+		if err := acks.Ack(ack); err != nil {
+			logger.Error("Error saving acknowledgment: %v", err)
+			http.Error(w, "Error saving acknowledgment", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Alert %s acknowledged by %s", ack.Fingerprint, ack.By)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ack)
+	case http.MethodDelete:
+		fingerprint := r.URL.Query().Get("fingerprint")
+		if fingerprint == "" {
+			http.Error(w, "fingerprint is required", http.StatusBadRequest)
+			return
+		}
+		if err := acks.Clear(fingerprint); err != nil {
+			logger.Error("Error removing acknowledgment: %v", err)
+			http.Error(w, "Error removing acknowledgment", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
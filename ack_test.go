@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAckHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	path := filepath.Join(t.TempDir(), "acks.json")
+	defer func() { acks = NewAckStore("") }()
+	acks = NewAckStore(path)
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{Acks: AckConfig{TTL: time.Hour}}})
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+		expectedAcks   int
+	}{
+		{"ack", http.MethodPost, "/api/v1/ack", `{"fingerprint":"abc","by":"alice","comment":"looking"}`, http.StatusOK, 1},
+		{"missing by", http.MethodPost, "/api/v1/ack", `{"fingerprint":"def"}`, http.StatusBadRequest, 1},
+		{"invalid body", http.MethodPost, "/api/v1/ack", `{`, http.StatusBadRequest, 1},
+		{"list", http.MethodGet, "/api/v1/ack", "", http.StatusOK, 1},
+		{"delete without fingerprint", http.MethodDelete, "/api/v1/ack", "", http.StatusBadRequest, 1},
+		{"delete", http.MethodDelete, "/api/v1/ack?fingerprint=abc", "", http.StatusNoContent, 0},
+		{"invalid method", http.MethodPut, "/api/v1/ack", "", http.StatusMethodNotAllowed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			ackHandler(rr, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body)
+			}
+			if got := len(acks.List(time.Now())); got != tt.expectedAcks {
+				t.Errorf("Expected %d acknowledgment(s), got %d", tt.expectedAcks, got)
+			}
+			if tt.name == "list" {
+				var list []Ack
+				if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || len(list) != 1 || list[0].By != "alice" {
+					t.Errorf("Unexpected list %+v (%v)", list, err)
+				}
+			}
+		})
+	}
+
+	if err := acks.Ack(Ack{Fingerprint: "ghi", By: "bob", At: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadAckStore(path)
+	if err != nil {
+		t.Fatalf("LoadAckStore() error = %v", err)
+	}
+	if ack, ok := loaded.Get("ghi", time.Now()); !ok || ack.By != "bob" {
+		t.Errorf("Expected the acknowledgment to be persisted, got %+v", ack)
+	}
+}
+
+func TestAcknowledgedReminders(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { acks = NewAckStore("") }()
+	acks = NewAckStore("")
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{})
+
+	now := time.Now()
+	acks.Ack(Ack{Fingerprint: "1", By: "alice", At: now})
+	acks.Ack(Ack{Fingerprint: "3", By: "carol", At: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+
+	provider := NewMockProvider(false)
+	post := func(alerts Alerts) {
+		body, err := json.Marshal(AlertManagerPayload{Status: "firing", Alerts: alerts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handleWebhookWithProvider(rr, req, provider)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body)
+		}
+	}
+
+	acked := Alert{Status: "firing", Fingerprint: "1", Labels: KV{"alertname": "DiskFull"}, StartsAt: now}
+	post(Alerts{acked})
+	if got := len(provider.GetSentMessages()); got != 0 {
+		t.Fatalf("Expected the reminder for an acknowledged alert to be skipped, got %d message(s)", got)
+	}
+
+	post(Alerts{{Status: "firing", Fingerprint: "3", Labels: KV{"alertname": "Expired"}, StartsAt: now}})
+	if got := len(provider.GetSentMessages()); got != 1 {
+		t.Fatalf("Expected an expired acknowledgment to be ignored, got %d message(s)", got)
+	}
+
+	post(Alerts{acked, {Status: "firing", Fingerprint: "2", Labels: KV{"alertname": "DiskFull"}, StartsAt: now}})
+	messages := provider.GetSentMessages()
+	if len(messages) != 2 {
+		t.Fatalf("Expected a new alert in the group to be sent, got %d message(s)", len(messages))
+	}
+	body, _ := json.Marshal(messages[1].message)
+	if !strings.Contains(string(body), "Acked by alice at "+now.Format("15:04")) {
+		t.Errorf("Expected the card to show the acknowledgment, got %s", body)
+	}
+
+	acked.Status = "resolved"
+	post(Alerts{acked})
+	if _, ok := acks.Get("1", now); ok {
+		t.Error("Expected the acknowledgment to be cleared once the alert resolved")
+	}
+}
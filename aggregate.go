@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSummaryAlertsPerName caps the instances listed under one alert name in
+// the summary card.
+const maxSummaryAlertsPerName = 10
+
+// AlertAggregator tracks every currently firing alert across all alert
+// groups, so a single summary of everything firing can be posted on demand.
+type AlertAggregator struct {
+	mu     sync.Mutex
+	alerts map[string]aggregatedAlert
+	// updated is when the last notification was recorded.
+	updated time.Time
+}
+
+type aggregatedAlert struct {
+	Alert
+	Receiver  string    `json:"receiver"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+var aggregator = NewAlertAggregator()
+
+func NewAlertAggregator() *AlertAggregator {
+	return &AlertAggregator{alerts: map[string]aggregatedAlert{}}
+}
+
+// alertKey identifies an alert across notifications by its fingerprint, or
+// by its labels when AlertManager did not send one.
+func alertKey(alert Alert) string {
+	if alert.Fingerprint != "" {
+		return alert.Fingerprint
+	}
+	return alert.Labels.SortedPairs().String()
+}
+
+// Update records the alerts in payload: firing alerts are added or
+// refreshed and resolved alerts are removed.
+func (a *AlertAggregator) Update(payload *AlertManagerPayload) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := clock.Now()
+	a.updated = now
+	for _, alert := range payload.Alerts {
+		key := alertKey(alert)
+		if alert.Status == "resolved" {
+			delete(a.alerts, key)
+			continue
+		}
+		a.alerts[key] = aggregatedAlert{Alert: alert, Receiver: payload.Receiver, UpdatedAt: now}
+	}
+}
+
+// Updated returns when the last notification was recorded, or the zero
+// time before the first.
+func (a *AlertAggregator) Updated() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.updated
+}
+
+// Get returns the firing alert with key, as computed by alertKey.
+func (a *AlertAggregator) Get(key string) (Alert, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	alert, ok := a.alerts[key]
+	return alert.Alert, ok
+}
+
+// Firing returns the alerts still firing at now, sorted by alert name and
+// start time. Alerts not refreshed within staleAfter are dropped, since their
+// resolved notification may never arrive.
+func (a *AlertAggregator) Firing(now time.Time, staleAfter time.Duration) []aggregatedAlert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	firing := make([]aggregatedAlert, 0, len(a.alerts))
+	for key, alert := range a.alerts {
+		expired := !alert.EndsAt.IsZero() && alert.EndsAt.Before(now)
+		stale := staleAfter > 0 && now.Sub(alert.UpdatedAt) > staleAfter
+		if expired || stale {
+			delete(a.alerts, key)
+			continue
+		}
+		firing = append(firing, alert)
+	}
+
+	sort.Slice(firing, func(i, j int) bool {
+		ni, nj := firing[i].Labels["alertname"], firing[j].Labels["alertname"]
+		if ni != nj {
+			return ni < nj
+		}
+		return firing[i].StartsAt.Before(firing[j].StartsAt)
+	})
+	return firing
+}
+
+// buildSummaryMessage renders one card listing every firing alert, with a
+// section per alert name.
+func buildSummaryMessage(alerts []aggregatedAlert, now time.Time) *GoogleChatMessage {
+	var names []string
+	byName := map[string][]aggregatedAlert{}
+	for _, alert := range alerts {
+		name := alert.Labels["alertname"]
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], alert)
+	}
+
+	card := Card{
+		Header: &CardHeader{
+			Title:    "Currently firing alerts",
+			Subtitle: fmt.Sprintf("%d alert(s), %d alert name(s)", len(alerts), len(names)),
+		},
+		Sections: []CardSection{},
+	}
+
+	if len(alerts) == 0 {
+		card.Sections = append(card.Sections, CardSection{
+			Widgets: []Widget{{TextParagraph: &TextParagraph{Text: "Nothing is firing."}}},
+		})
+	}
+
+	for _, name := range names {
+		group := byName[name]
+		var lines []string
+		for i, alert := range group {
+			if i == maxSummaryAlertsPerName {
+				lines = append(lines, fmt.Sprintf("<i>... and %d more</i>", len(group)-i))
+				break
+			}
+			line := "• " + alert.Labels.Remove([]string{"alertname"}).SortedPairs().String()
+			if !alert.StartsAt.IsZero() {
+				line += fmt.Sprintf(" (for %s)", formatDuration(now.Sub(alert.StartsAt)))
+			}
+			lines = append(lines, line)
+		}
+		card.Sections = append(card.Sections, CardSection{
+			Header:  fmt.Sprintf("%s (%d)", name, len(group)),
+			Widgets: []Widget{{TextParagraph: &TextParagraph{Text: strings.Join(lines, "<br>")}}},
+		})
+	}
+
+	return &GoogleChatMessage{
+		Text:  fmt.Sprintf("Summary: %d alert(s) firing", len(alerts)),
+		Cards: []Card{card},
+	}
+}
+
+// formatDuration renders d rounded to the minute, e.g. "2h5m" or "<1m".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "<1m"
+	}
+	return strings.TrimSuffix(d.String(), "0s")
+}
+
+// postSummary sends the summary card through the default route. Nothing
+// is sent when no alerts are firing, unless force is set.
+func postSummary(provider Provider, reqID string, force bool) (int, error) {
+	rt := getRuntime()
+	now := clock.Now()
+	alerts := aggregator.Firing(now, rt.Config.Summary.StaleAfter)
+	if len(alerts) == 0 && !force {
+		logger.Info("[%s] No alerts firing, skipping summary", reqID)
+		return 0, nil
+	}
+
+	route := rt.DefaultRoute
+	if route == nil {
+		route = &Route{Name: defaultRouteName}
+	}
+	return len(alerts), route.Send(context.Background(), provider, buildSummaryMessage(alerts, now), reqID)
+}
+
+// firingAlertsHandler lists the aggregated firing alerts as JSON.
+func firingAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	alerts := aggregator.Firing(clock.Now(), getRuntime().Config.Summary.StaleAfter)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// summaryHandler posts the summary card on demand.
+func summaryHandler(provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		reqID := newRequestID("summary")
+		count, err := postSummary(provider, reqID, r.URL.Query().Get("force") == "true")
+		if err != nil {
+			logger.Error("[%s] Error sending summary: %v", reqID, err)
+			http.Error(w, "Error sending to Google Chat", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Summary of %d firing alert(s) sent", count)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertAggregator(t *testing.T) {
+	a := NewAlertAggregator()
+	now := time.Now()
+
+	a.Update(&AlertManagerPayload{Receiver: "team-a", Alerts: Alerts{
+		{Status: "firing", Fingerprint: "1", Labels: KV{"alertname": "HighCPU", "instance": "web-01"}, StartsAt: now.Add(-2 * time.Hour)},
+		{Status: "firing", Fingerprint: "2", Labels: KV{"alertname": "HighCPU", "instance": "web-02"}, StartsAt: now.Add(-time.Hour)},
+	}})
+	a.Update(&AlertManagerPayload{Receiver: "team-b", Alerts: Alerts{
+		{Status: "firing", Labels: KV{"alertname": "DiskFull", "instance": "db-01"}, StartsAt: now},
+		{Status: "firing", Fingerprint: "4", Labels: KV{"alertname": "Expired"}, EndsAt: now.Add(-time.Minute)},
+	}})
+	a.Update(&AlertManagerPayload{Alerts: Alerts{
+		{Status: "resolved", Fingerprint: "2", Labels: KV{"alertname": "HighCPU", "instance": "web-02"}},
+	}})
+
+	firing := a.Firing(now, time.Hour)
+	if len(firing) != 2 {
+		t.Fatalf("Expected 2 firing alerts, got %d", len(firing))
+	}
+	if firing[0].Labels["alertname"] != "DiskFull" || firing[1].Labels["instance"] != "web-01" {
+		t.Errorf("Unexpected order: %v, %v", firing[0].Labels, firing[1].Labels)
+	}
+	if firing[1].Receiver != "team-a" {
+		t.Errorf("Expected receiver team-a, got %s", firing[1].Receiver)
+	}
+
+	if got := a.Firing(now.Add(2*time.Hour), time.Hour); len(got) != 0 {
+		t.Errorf("Expected stale alerts to be dropped, got %d", len(got))
+	}
+
+	message := buildSummaryMessage(firing, now)
+	card := message.Cards[0]
+	if len(card.Sections) != 2 || card.Sections[1].Header != "HighCPU (1)" {
+		t.Fatalf("Unexpected sections: %+v", card.Sections)
+	}
+	if text := card.Sections[1].Widgets[0].TextParagraph.Text; !strings.Contains(text, "instance=web-01 (for 2h0m)") {
+		t.Errorf("Unexpected alert line: %s", text)
+	}
+}
+
+func TestSummaryHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { aggregator = NewAlertAggregator() }()
+	aggregator = NewAlertAggregator()
+
+	provider := NewMockProvider(false)
+	handler := summaryHandler(provider)
+
+	post := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, url, nil))
+		return rr
+	}
+
+	if rr := post("/api/summary"); rr.Code != http.StatusOK || len(provider.GetSentMessages()) != 0 {
+		t.Fatalf("Expected no summary while nothing is firing, got %d and %d messages", rr.Code, len(provider.GetSentMessages()))
+	}
+	if rr := post("/api/summary?force=true"); rr.Code != http.StatusOK || len(provider.GetSentMessages()) != 1 {
+		t.Fatalf("Expected forced summary to be sent, got %d and %d messages", rr.Code, len(provider.GetSentMessages()))
+	}
+
+	aggregator.Update(&AlertManagerPayload{Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "HighCPU"}}}})
+	if rr := post("/api/summary"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "1 firing alert") {
+		t.Fatalf("Unexpected response %d: %s", rr.Code, rr.Body)
+	}
+	if got := provider.GetSentMessages()[1].message.Text; got != "Summary: 1 alert(s) firing" {
+		t.Errorf("Unexpected summary text %q", got)
+	}
+
+	rr := httptest.NewRecorder()
+	firingAlertsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"alertname":"HighCPU"`) {
+		t.Errorf("Unexpected /api/alerts response %d: %s", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxAllClearRules caps the noisiest rules listed on the all-clear card.
+const maxAllClearRules = 5
+
+// AllClearSchedule is a compiled [all_clear] block: when the summary of
+// the past period is posted and to which route.
+type AllClearSchedule struct {
+	cron   *CronSchedule
+	period time.Duration
+	route  string
+}
+
+// NewAllClearSchedule compiles cfg, returning nil when no schedule is
+// configured.
+func NewAllClearSchedule(cfg AllClearConfig) (*AllClearSchedule, error) {
+	if cfg.Schedule == "" {
+		return nil, nil
+	}
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+	cron, err := ParseCron(cfg.Schedule, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &AllClearSchedule{cron: cron, period: cfg.Period, route: cfg.Route}, nil
+}
+
+// buildAllClearMessage renders the card summarizing the history entries
+// recorded in [from, to) and the alerts still firing at to.
+func buildAllClearMessage(entries []HistoryEntry, firing []aggregatedAlert, from, to time.Time) *GoogleChatMessage {
+	report := buildReport(entries, from, to)
+	fired := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Status == "firing" {
+			fired[entry.Key] = true
+		}
+	}
+
+	title := "All clear"
+	if len(firing) > 0 {
+		title = "Alert summary"
+	}
+	period := fmt.Sprintf("%s - %s", from.Format("Jan 2 15:04"), to.Format("Jan 2 15:04"))
+	stats := []string{
+		fmt.Sprintf("<b>Alerts fired:</b> %d", len(fired)),
+		fmt.Sprintf("<b>Resolved:</b> %d", report.Resolved),
+		fmt.Sprintf("<b>Still firing:</b> %d", len(firing)),
+	}
+	if report.MTTR > 0 {
+		stats = append(stats, fmt.Sprintf("<b>Mean time to resolve:</b> %s", formatDuration(report.MTTR)))
+	}
+
+	card := Card{
+		Header:   &CardHeader{Title: title, Subtitle: period},
+		Sections: []CardSection{{Widgets: []Widget{{TextParagraph: &TextParagraph{Text: strings.Join(stats, "<br>")}}}}},
+	}
+
+	if len(report.TopRules) > 0 {
+		var lines []string
+		for i, rule := range report.TopRules {
+			if i == maxAllClearRules {
+				break
+			}
+			lines = append(lines, fmt.Sprintf("• %s: %d notification(s), %d alert(s)", rule.Alertname, rule.Notifications, rule.Alerts))
+		}
+		card.Sections = append(card.Sections, CardSection{
+			Header:  "Noisiest rules",
+			Widgets: []Widget{{TextParagraph: &TextParagraph{Text: strings.Join(lines, "<br>")}}},
+		})
+	}
+
+	if len(firing) > 0 {
+		var lines []string
+		for i, alert := range firing {
+			if i == maxSummaryAlertsPerName {
+				lines = append(lines, fmt.Sprintf("<i>... and %d more</i>", len(firing)-i))
+				break
+			}
+			line := "• " + alert.Labels["alertname"]
+			if !alert.StartsAt.IsZero() {
+				line += fmt.Sprintf(" (for %s)", formatDuration(to.Sub(alert.StartsAt)))
+			}
+			lines = append(lines, line)
+		}
+		card.Sections = append(card.Sections, CardSection{
+			Header:  "Still firing",
+			Widgets: []Widget{{TextParagraph: &TextParagraph{Text: strings.Join(lines, "<br>")}}},
+		})
+	}
+
+	text := fmt.Sprintf("All clear: %d alert(s) fired and %d resolved", len(fired), report.Resolved)
+	if len(firing) > 0 {
+		text = fmt.Sprintf("Alert summary: %d alert(s) fired, %d resolved, %d still firing", len(fired), report.Resolved, len(firing))
+	}
+	return &GoogleChatMessage{Text: text, Cards: []Card{card}}
+}
+
+// postAllClear sends the summary of the period ending at to through the
+// configured route, or the default route. It also runs when no schedule is
+// configured, if the job is triggered through the admin API.
+func postAllClear(provider Provider, to time.Time, reqID string) error {
+	rt := getRuntime()
+	s := rt.AllClear
+	if s == nil {
+		s = &AllClearSchedule{period: rt.Config.AllClear.Period, route: rt.Config.AllClear.Route}
+	}
+	from := to.Add(-s.period)
+	message := buildAllClearMessage(history.Between(from, to), aggregator.Firing(to, rt.Config.Summary.StaleAfter), from, to)
+
+	route := rt.DefaultRoute
+	for _, r := range rt.Routes {
+		if r.Name == s.route {
+			route = r
+		}
+	}
+	if route == nil {
+		route = &Route{Name: defaultRouteName}
+	}
+	logger.Info("[%s] Posting all-clear summary to route %s", reqID, route.Name)
+	return route.Send(context.Background(), provider, message, reqID)
+}
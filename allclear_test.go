@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildAllClearMessage(t *testing.T) {
+	to := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	from := to.Add(-24 * time.Hour)
+	entry := func(name, instance, status string, endsAt time.Duration) HistoryEntry {
+		e := HistoryEntry{At: from.Add(time.Hour), Key: name + instance, Alertname: name, Status: status, StartsAt: from}
+		if status == "resolved" {
+			e.EndsAt = from.Add(endsAt)
+		}
+		return e
+	}
+	entries := []HistoryEntry{
+		entry("DiskFull", "a", "firing", 0),
+		entry("DiskFull", "a", "resolved", time.Hour),
+		entry("DiskFull", "b", "firing", 0),
+		entry("HighLatency", "c", "firing", 0),
+	}
+
+	tests := []struct {
+		name      string
+		firing    []aggregatedAlert
+		wantTitle string
+		want      []string
+	}{
+		{
+			name:      "all clear",
+			wantTitle: "All clear",
+			want:      []string{"<b>Alerts fired:</b> 3", "<b>Resolved:</b> 1", "<b>Still firing:</b> 0", "• DiskFull: 3 notification(s), 2 alert(s)"},
+		},
+		{
+			name:      "still firing",
+			firing:    []aggregatedAlert{{Alert: Alert{Labels: KV{"alertname": "HighLatency"}, StartsAt: to.Add(-2 * time.Hour)}}},
+			wantTitle: "Alert summary",
+			want:      []string{"<b>Still firing:</b> 1", "Still firing", "• HighLatency (for 2h0m)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := buildAllClearMessage(entries, tt.firing, from, to)
+			card := message.Cards[0]
+			if card.Header.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", card.Header.Title, tt.wantTitle)
+			}
+			var text strings.Builder
+			for _, section := range card.Sections {
+				text.WriteString(section.Header + "\n")
+				for _, w := range section.Widgets {
+					text.WriteString(w.TextParagraph.Text + "\n")
+				}
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(text.String(), want) {
+					t.Errorf("card does not contain %q:\n%s", want, text.String())
+				}
+			}
+		})
+	}
+}
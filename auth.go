@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// withBasicAuth requires the configured HTTP basic auth credentials. It is a
+// no-op when no username is configured. A password file is re-read on every
+// request so rotated secrets apply without a restart.
+func withBasicAuth(cfg BasicAuthConfig, next http.Handler) http.Handler {
+	if cfg.Username == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, err := cfg.authorized(r)
+		if err != nil {
+			logger.Error("Failed to read admin password file: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="alertmanager-to-gchat"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether r carries the configured basic auth
+// credentials.
+func (cfg BasicAuthConfig) authorized(r *http.Request) (bool, error) {
+	password, err := secretValue(cfg.Password, cfg.PasswordFile)
+	if err != nil {
+		return false, err
+	}
+
+	user, pass, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(cfg.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1, nil
+}
+
+// authorized reports whether r carries one of the configured credentials:
+// the bearer token, the basic auth username and password or the header
+// secret.
+func (cfg InboundAuthConfig) authorized(r *http.Request) (bool, error) {
+	if cfg.BearerToken != "" || cfg.BearerTokenFile != "" {
+		token, err := secretValue(cfg.BearerToken, cfg.BearerTokenFile)
+		if err != nil {
+			return false, err
+		}
+		if got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return true, nil
+		}
+	}
+	if h := cfg.Header; h.Name != "" {
+		secret, err := secretValue(h.Value, h.ValueFile)
+		if err != nil {
+			return false, err
+		}
+		if got := r.Header.Get(h.Name); got != "" &&
+			subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1 {
+			return true, nil
+		}
+	}
+	if cfg.BasicAuth.Username != "" {
+		return cfg.BasicAuth.authorized(r)
+	}
+	return false, nil
+}
+
+// withSourceAuth requires the credentials of the named inbound source.
+func withSourceAuth(source SourceConfig, next http.Handler) http.Handler {
+	return withInboundAuth("Source "+source.Name, source.Auth, next)
+}
+
+// withWebhookAuth requires the [server.webhook_auth] credentials on the
+// default webhook endpoints. It is a no-op when none are configured.
+func withWebhookAuth(auth InboundAuthConfig, next http.Handler) http.Handler {
+	if !auth.enabled() {
+		return next
+	}
+	return withInboundAuth("Webhook", auth, next)
+}
+
+type sourceKey struct{}
+
+// withSource records that the request was posted to source's endpoint, so
+// processPayload applies its receiver and route restrictions.
+func withSource(ctx context.Context, source SourceConfig) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+func sourceFrom(ctx context.Context) (SourceConfig, bool) {
+	source, ok := ctx.Value(sourceKey{}).(SourceConfig)
+	return source, ok
+}
+
+// withInboundAuth requires one of the credentials of auth, naming the
+// endpoint as name in logs. Secret files are re-read on every request so
+// rotated secrets apply without a restart.
+func withInboundAuth(name string, auth InboundAuthConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, err := auth.authorized(r)
+		if err != nil {
+			logger.Error("%s: failed to read credentials: %v", name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			logger.Error("%s: rejected unauthenticated request from %s", name, r.RemoteAddr)
+			if auth.BasicAuth.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="alertmanager-to-gchat"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// secretValue returns the contents of file, if set, or value.
+func secretValue(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithSourceAuth(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		auth         InboundAuthConfig
+		setup        func(*http.Request)
+		expectedCode int
+	}{
+		{
+			name:         "bearer token accepted",
+			auth:         InboundAuthConfig{BearerToken: "team-a"},
+			setup:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer team-a") },
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "other source's token rejected",
+			auth:         InboundAuthConfig{BearerToken: "team-a"},
+			setup:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer team-b") },
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "missing credentials rejected",
+			auth:         InboundAuthConfig{BearerToken: "team-a"},
+			setup:        func(r *http.Request) {},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "bearer token file",
+			auth:         InboundAuthConfig{BearerTokenFile: tokenFile},
+			setup:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer file-token") },
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "basic auth accepted alongside token",
+			auth:         InboundAuthConfig{BearerToken: "team-a", BasicAuth: BasicAuthConfig{Username: "am", Password: "secret"}},
+			setup:        func(r *http.Request) { r.SetBasicAuth("am", "secret") },
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "wrong basic auth password",
+			auth:         InboundAuthConfig{BasicAuth: BasicAuthConfig{Username: "am", Password: "secret"}},
+			setup:        func(r *http.Request) { r.SetBasicAuth("am", "guess") },
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "header secret accepted",
+			auth:         InboundAuthConfig{Header: HeaderAuthConfig{Name: "X-Webhook-Secret", Value: "s3cret"}},
+			setup:        func(r *http.Request) { r.Header.Set("X-Webhook-Secret", "s3cret") },
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "header secret from file",
+			auth:         InboundAuthConfig{Header: HeaderAuthConfig{Name: "X-Webhook-Secret", ValueFile: tokenFile}},
+			setup:        func(r *http.Request) { r.Header.Set("X-Webhook-Secret", "file-token") },
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "wrong header secret rejected",
+			auth:         InboundAuthConfig{Header: HeaderAuthConfig{Name: "X-Webhook-Secret", Value: "s3cret"}},
+			setup:        func(r *http.Request) { r.Header.Set("X-Webhook-Secret", "guess") },
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "unreadable token file",
+			auth:         InboundAuthConfig{BearerTokenFile: filepath.Join(t.TempDir(), "missing")},
+			setup:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer x") },
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := withSourceAuth(SourceConfig{Name: "team-a", Auth: tt.auth}, ok)
+			req := httptest.NewRequest(http.MethodPost, "/webhook/team-a", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestSourceBinding(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	payments, platform := NewMockProvider(false), NewMockProvider(false)
+	currentRuntime.Store(&Runtime{Routes: []*Route{
+		{Name: "platform", Provider: platform},
+		{Name: "payments", Provider: payments},
+	}})
+	public, _ := newServeMuxes(Config{Sources: []SourceConfig{{
+		Name:      "payments",
+		Auth:      InboundAuthConfig{BearerToken: "secret"},
+		Routes:    []string{"payments"},
+		Receivers: []string{"payments-chat"},
+	}}}, NewMockProvider(false))
+
+	tests := []struct {
+		receiver string
+		want     int
+	}{
+		{receiver: "payments-chat", want: http.StatusOK},
+		{receiver: "platform-chat", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		body := `{"receiver":"` + tt.receiver + `","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"DiskFull"},"startsAt":"2024-05-15T09:00:00Z"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		public.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("POST for receiver %s = %d, want %d", tt.receiver, w.Code, tt.want)
+		}
+	}
+
+	// The first matching route is platform, but the source may only post
+	// to payments.
+	if got := len(payments.GetSentMessages()); got != 1 {
+		t.Errorf("payments route sent %d messages, want 1", got)
+	}
+	if got := len(platform.GetSentMessages()); got != 0 {
+		t.Errorf("platform route sent %d messages, want 0", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxBatchSize caps the number of payloads accepted by one batch request.
+const maxBatchSize = 100
+
+// BatchResult reports the outcome of one payload in a batch request. Status
+// and Message match what /webhook would have answered for the payload alone.
+type BatchResult struct {
+	Index     int    `json:"index"`
+	RequestID string `json:"requestId"`
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+}
+
+// BatchResponse is the body returned by the batch endpoint.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+	Failed  int           `json:"failed"`
+}
+
+// batchWebhookHandler accepts a JSON array of AlertManager payloads and runs
+// each through the normal pipeline in order. It answers 200 when every
+// payload was processed or ignored as a duplicate and 207 otherwise, with
+// per-payload results in the body.
+func batchWebhookHandler(provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := newRequestID("batch")
+		logger.Info("[%s] Received batch webhook request from %s", reqID, r.RemoteAddr)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+			dropAlerts(dropBadContentType, 1)
+			http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("[%s] Error reading request body: %v", reqID, err)
+			status, msg := bodyReadError(err)
+			http.Error(w, msg, status)
+			return
+		}
+		defer r.Body.Close()
+
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			logger.Error("[%s] Invalid batch body: %v", reqID, err)
+			http.Error(w, "Request body must be a JSON array of payloads", http.StatusBadRequest)
+			return
+		}
+		if len(items) == 0 {
+			http.Error(w, "Empty batch", http.StatusBadRequest)
+			return
+		}
+		if len(items) > maxBatchSize {
+			http.Error(w, fmt.Sprintf("Batch exceeds %d payloads", maxBatchSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		redactor := getRuntime().Redactor
+		resp := BatchResponse{Results: make([]BatchResult, 0, len(items))}
+		for i, item := range items {
+			itemID := fmt.Sprintf("%s-%d", reqID, i)
+			if recorder != nil {
+				if err := recorder.Record(itemID, []byte(redactor.RedactText(string(item)))); err != nil {
+					logger.Error("[%s] Error recording webhook body: %v", itemID, err)
+				}
+			}
+
+			// Suffix a caller supplied Idempotency-Key so retrying the
+			// whole batch skips the payloads that already went through.
+			key := idempotencyKey(r, item)
+			if r.Header.Get("Idempotency-Key") != "" {
+				key = fmt.Sprintf("%s/%d", key, i)
+			}
+			duplicate, err := processOnce(r.Context(), key, item, itemID, provider)
+			status, msg := processResult(itemID, duplicate, err)
+			if status != http.StatusOK {
+				resp.Failed++
+			}
+			resp.Results = append(resp.Results, BatchResult{Index: i, RequestID: itemID, Status: status, Message: msg})
+		}
+
+		status := http.StatusOK
+		if resp.Failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		logger.Info("[%s] Processed batch of %d payload(s), %d failed", reqID, len(items), resp.Failed)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
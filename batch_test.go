@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchWebhookHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{Idempotency: IdempotencyConfig{Window: time.Minute}}})
+
+	valid, err := json.Marshal(AlertManagerPayload{
+		Status: "firing",
+		Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "Batched"}, StartsAt: time.Now()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := `{"alerts":[]}`
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		key            string
+		expectedStatus int
+		expectedSent   int
+		expectedCodes  []int
+	}{
+		{
+			name:           "all valid",
+			method:         http.MethodPost,
+			body:           fmt.Sprintf("[%s]", valid),
+			expectedStatus: http.StatusOK,
+			expectedSent:   1,
+			expectedCodes:  []int{http.StatusOK},
+		},
+		{
+			name:           "partial failure",
+			method:         http.MethodPost,
+			body:           fmt.Sprintf("[%s,%s]", valid, invalid),
+			key:            "batch-1",
+			expectedStatus: http.StatusMultiStatus,
+			expectedSent:   1,
+			expectedCodes:  []int{http.StatusOK, http.StatusBadRequest},
+		},
+		{
+			name:           "retried batch skips delivered payloads",
+			method:         http.MethodPost,
+			body:           fmt.Sprintf("[%s,%s]", valid, invalid),
+			key:            "batch-1",
+			expectedStatus: http.StatusMultiStatus,
+			expectedSent:   0,
+			expectedCodes:  []int{http.StatusOK, http.StatusBadRequest},
+		},
+		{
+			name:           "not an array",
+			method:         http.MethodPost,
+			body:           string(valid),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty batch",
+			method:         http.MethodPost,
+			body:           "[]",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too large",
+			method:         http.MethodPost,
+			body:           "[" + strings.Repeat("{},", maxBatchSize) + "{}]",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "invalid method",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewMockProvider(false)
+			req := httptest.NewRequest(tt.method, "/webhook/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			rr := httptest.NewRecorder()
+			batchWebhookHandler(provider)(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body)
+			}
+			if got := len(provider.GetSentMessages()); got != tt.expectedSent {
+				t.Errorf("Expected %d message(s) sent, got %d", tt.expectedSent, got)
+			}
+			if tt.expectedCodes == nil {
+				return
+			}
+
+			var resp BatchResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(resp.Results) != len(tt.expectedCodes) {
+				t.Fatalf("Expected %d results, got %+v", len(tt.expectedCodes), resp.Results)
+			}
+			for i, code := range tt.expectedCodes {
+				if resp.Results[i].Index != i || resp.Results[i].Status != code {
+					t.Errorf("Result %d: expected status %d, got %+v", i, code, resp.Results[i])
+				}
+			}
+		})
+	}
+}
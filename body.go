@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// defaultMaxBodyBytes is the default [server] max_body_bytes.
+const defaultMaxBodyBytes = 10 << 20
+
+// withMaxBody fails reads of request bodies beyond limit bytes, so a
+// single request cannot make the bridge buffer an unbounded body. It is a
+// no-op when limit is zero.
+func withMaxBody(limit int64, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyReadError returns the status and message answering a request whose
+// body could not be read: 413 when it was over the size limit.
+func bodyReadError(err error) (int, string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		dropAlerts(dropTooLarge, 1)
+		return http.StatusRequestEntityTooLarge, "Request body too large"
+	}
+	return http.StatusInternalServerError, "Error reading request body"
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithMaxBody(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	handler := withMaxBody(16, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			status, msg := bodyReadError(err)
+			http.Error(w, msg, status)
+		}
+	}))
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "within the limit", body: `{"alerts":[]}`, expectedCode: http.StatusOK},
+		{name: "over the limit", body: `{"alerts":[` + strings.Repeat(`{},`, 100) + `{}]}`, expectedCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body)))
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned without sending while a destination's circuit
+// breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// circuitBreaker stops sending to a destination once failures attempts in a
+// row have failed, so requests fail fast instead of waiting on a Chat
+// outage. After cooldown one probe is let through: its success closes the
+// breaker and its failure keeps it open for another cooldown. Client errors
+// other than 429 mean Chat is answering and do not count as failures.
+type circuitBreaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu sync.Mutex
+	// states holds destinations with failures; a destination that succeeds
+	// is forgotten, so only failing destinations are kept.
+	states map[string]*breakerState
+}
+
+type breakerState struct {
+	failures int
+	// openUntil is when the next probe may be sent, zero while closed.
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(failures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{failures: failures, cooldown: cooldown, states: map[string]*breakerState{}}
+}
+
+func (b *circuitBreaker) state(destination string) *breakerState {
+	s, ok := b.states[destination]
+	if !ok {
+		s = &breakerState{}
+		b.states[destination] = s
+	}
+	return s
+}
+
+// check returns errCircuitOpen when a send to the destination of opts may
+// not go ahead at now, without claiming the probe.
+func (b *circuitBreaker) check(opts SendOptions, now time.Time) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.checkLocked(b.states[opts.destination()], opts, now)
+}
+
+func (b *circuitBreaker) checkLocked(s *breakerState, opts SendOptions, now time.Time) error {
+	if s != nil && !s.openUntil.IsZero() && (s.probing || now.Before(s.openUntil)) {
+		return fmt.Errorf("%w for %s", errCircuitOpen, opts.destination())
+	}
+	return nil
+}
+
+// allow is check for a send about to be made. Once the cooldown has passed,
+// the first caller is let through as the probe and must record its outcome.
+func (b *circuitBreaker) allow(opts SendOptions, now time.Time) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.states[opts.destination()]
+	if err := b.checkLocked(s, opts, now); err != nil {
+		return err
+	}
+	if s != nil && !s.openUntil.IsZero() {
+		s.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker of the destination of opts with the outcome of
+// a send that finished at now.
+func (b *circuitBreaker) record(opts SendOptions, now time.Time, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil || !retryable(err) {
+		if s, ok := b.states[opts.destination()]; ok && !s.openUntil.IsZero() {
+			logger.Info("[%s] Circuit breaker for %s closed", opts.ReqID, opts.destination())
+			destinationHealth.SetCircuitOpen(opts, false)
+		}
+		delete(b.states, opts.destination())
+		return
+	}
+	s := b.state(opts.destination())
+	s.probing = false
+	s.failures++
+	if s.failures < b.failures {
+		return
+	}
+	if s.openUntil.IsZero() {
+		logger.Error("[%s] Circuit breaker for %s opened after %d failed attempts, failing sends for %s: %v", opts.ReqID, opts.destination(), s.failures, b.cooldown, err)
+		destinationHealth.SetCircuitOpen(opts, true)
+	}
+	s.openUntil = now.Add(b.cooldown)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// CardV2 is a card in the cardsV2 message format. Unlike legacy cards it
+// supports colored buttons and collapsible sections.
+type CardV2 struct {
+	CardID string     `json:"cardId"`
+	Card   CardV2Body `json:"card"`
+}
+
+type CardV2Body struct {
+	Header   *CardHeader     `json:"header,omitempty"`
+	Sections []CardV2Section `json:"sections"`
+}
+
+type CardV2Section struct {
+	Header                    string     `json:"header,omitempty"`
+	Collapsible               bool       `json:"collapsible,omitempty"`
+	UncollapsibleWidgetsCount int        `json:"uncollapsibleWidgetsCount,omitempty"`
+	Widgets                   []WidgetV2 `json:"widgets"`
+}
+
+type WidgetV2 struct {
+	TextParagraph *TextParagraph `json:"textParagraph,omitempty"`
+	DecoratedText *DecoratedText `json:"decoratedText,omitempty"`
+	ButtonList    *ButtonList    `json:"buttonList,omitempty"`
+	Columns       *Columns       `json:"columns,omitempty"`
+	ChipList      *ChipList      `json:"chipList,omitempty"`
+}
+
+// ChipList is a row of chips which wraps on narrow screens.
+type ChipList struct {
+	Chips []Chip `json:"chips"`
+}
+
+type Chip struct {
+	Label   string         `json:"label"`
+	OnClick *OnClickAction `json:"onClick,omitempty"`
+}
+
+// Icon is one of Chat's built-in icons, named by KnownIcon, or a Material
+// Symbols icon.
+type Icon struct {
+	KnownIcon    string        `json:"knownIcon,omitempty"`
+	MaterialIcon *MaterialIcon `json:"materialIcon,omitempty"`
+}
+
+type MaterialIcon struct {
+	Name string `json:"name"`
+}
+
+// Columns shows up to two columns side by side. On narrow screens the
+// second column wraps below the first.
+type Columns struct {
+	ColumnItems []Column `json:"columnItems"`
+}
+
+type Column struct {
+	HorizontalSizeStyle string     `json:"horizontalSizeStyle,omitempty"`
+	HorizontalAlignment string     `json:"horizontalAlignment,omitempty"`
+	VerticalAlignment   string     `json:"verticalAlignment,omitempty"`
+	Widgets             []WidgetV2 `json:"widgets"`
+}
+
+// LabelTable is a list of labels shown as a two-column table of names and
+// values.
+type LabelTable struct {
+	Title string
+	Rows  Pairs
+}
+
+// widgets renders the table as a title followed by one columns widget per
+// label, so each name stays next to its value when the columns wrap.
+func (t *LabelTable) widgets() []WidgetV2 {
+	widgets := []WidgetV2{{TextParagraph: &TextParagraph{Text: "<b>" + t.Title + "</b>"}}}
+	for _, row := range t.Rows {
+		widgets = append(widgets, WidgetV2{Columns: &Columns{ColumnItems: []Column{
+			{
+				HorizontalSizeStyle: "FILL_MINIMUM_SPACE",
+				VerticalAlignment:   "TOP",
+				Widgets:             []WidgetV2{{TextParagraph: &TextParagraph{Text: `<font color="#5F6368">` + html.EscapeString(row.Name) + "</font>"}}},
+			},
+			{
+				HorizontalSizeStyle: "FILL_AVAILABLE_SPACE",
+				VerticalAlignment:   "TOP",
+				Widgets:             []WidgetV2{{TextParagraph: &TextParagraph{Text: html.EscapeString(row.Value)}}},
+			},
+		}}})
+	}
+	return widgets
+}
+
+type DecoratedText struct {
+	StartIcon   *Icon  `json:"startIcon,omitempty"`
+	TopLabel    string `json:"topLabel,omitempty"`
+	Text        string `json:"text"`
+	WrapText    bool   `json:"wrapText,omitempty"`
+	BottomLabel string `json:"bottomLabel,omitempty"`
+}
+
+// startIcon returns the icon shown before a key value in cardsV2: the
+// alert status, or a clock for times and durations.
+func startIcon(kv *KeyValue) *Icon {
+	switch kv.TopLabel {
+	case "Status":
+		name := "info"
+		switch kv.Content {
+		case "firing":
+			name = "notifications_active"
+		case "resolved":
+			name = "check_circle"
+		}
+		return &Icon{MaterialIcon: &MaterialIcon{Name: name}}
+	case "Started", "Duration", "Firing Duration":
+		return &Icon{KnownIcon: "CLOCK"}
+	}
+	return nil
+}
+
+type ButtonList struct {
+	Buttons []ButtonV2 `json:"buttons"`
+}
+
+type ButtonV2 struct {
+	Text    string         `json:"text"`
+	Color   *Color         `json:"color,omitempty"`
+	OnClick *OnClickAction `json:"onClick"`
+}
+
+// Color is a google.type.Color with components between 0 and 1.
+type Color struct {
+	Red   float64 `json:"red"`
+	Green float64 `json:"green"`
+	Blue  float64 `json:"blue"`
+}
+
+// defaultColors are the accent colors used for severities not listed in
+// [layout] colors.
+var defaultColors = map[string]string{
+	"critical": "#D93025",
+	"error":    "#D93025",
+	"warning":  "#F9AB00",
+	"info":     "#1A73E8",
+	"resolved": "#188038",
+}
+
+// parseHexColor parses "#RRGGBB".
+func parseHexColor(s string) (*Color, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return nil, fmt.Errorf("invalid color %q, expected #RRGGBB", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q, expected #RRGGBB", s)
+	}
+	return &Color{
+		Red:   float64(v>>16&0xff) / 255,
+		Green: float64(v>>8&0xff) / 255,
+		Blue:  float64(v&0xff) / 255,
+	}, nil
+}
+
+// accentColor returns the hex color for the payload: the "resolved" color
+// once resolved, otherwise the color of its severity label. It returns ""
+// when no color applies.
+func accentColor(payload *AlertManagerPayload, colors map[string]string) string {
+	key := payload.Status
+	if key != "resolved" {
+		key = payload.CommonLabels["severity"]
+		if key == "" && len(payload.Alerts) > 0 {
+			key = payload.Alerts[0].Labels["severity"]
+		}
+	}
+	key = strings.ToLower(key)
+	if c, ok := colors[key]; ok {
+		return c
+	}
+	return defaultColors[key]
+}
+
+// toCardV2 converts a legacy card. The accent color, if any, is applied to
+// the status line and to every button, since cardsV2 headers cannot be
+// colored.
+func toCardV2(id string, card Card, accent string) CardV2 {
+	color, _ := parseHexColor(accent)
+
+	v2 := CardV2{CardID: id, Card: CardV2Body{Header: card.Header, Sections: []CardV2Section{}}}
+	for _, section := range card.Sections {
+		s := CardV2Section{
+			Header:      section.Header,
+			Collapsible: section.Collapsible,
+			Widgets:     []WidgetV2{},
+		}
+		for i, w := range section.Widgets {
+			// Tables expand to several widgets, so the uncollapsible
+			// count is taken in cardsV2 widgets.
+			if section.Collapsible && i == section.UncollapsibleWidgetsCount {
+				s.UncollapsibleWidgetsCount = len(s.Widgets)
+			}
+			switch {
+			case w.Table != nil:
+				s.Widgets = append(s.Widgets, w.Table.widgets()...)
+			case w.Chips != nil:
+				s.Widgets = append(s.Widgets, WidgetV2{ChipList: w.Chips})
+			case w.TextParagraph != nil:
+				s.Widgets = append(s.Widgets, WidgetV2{TextParagraph: w.TextParagraph})
+			case w.KeyValue != nil:
+				text := w.KeyValue.Content
+				if w.KeyValue.TopLabel == "Status" && color != nil {
+					text = fmt.Sprintf(`<font color="%s"><b>%s</b></font>`, accent, strings.ToUpper(text))
+				}
+				s.Widgets = append(s.Widgets, WidgetV2{DecoratedText: &DecoratedText{
+					StartIcon:   startIcon(w.KeyValue),
+					TopLabel:    w.KeyValue.TopLabel,
+					Text:        text,
+					WrapText:    w.KeyValue.ContentMultiline,
+					BottomLabel: w.KeyValue.BottomLabel,
+				}})
+			case len(w.Buttons) > 0:
+				list := &ButtonList{}
+				for _, b := range w.Buttons {
+					if b.TextButton == nil {
+						continue
+					}
+					list.Buttons = append(list.Buttons, ButtonV2{Text: b.TextButton.Text, Color: color, OnClick: b.TextButton.OnClick})
+				}
+				s.Widgets = append(s.Widgets, WidgetV2{ButtonList: list})
+			}
+		}
+		v2.Card.Sections = append(v2.Card.Sections, s)
+	}
+	return v2
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// celEnv declares the variables available to route and filter expressions.
+// They mirror the webhook JSON field names.
+var celEnv = func() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("version", cel.StringType),
+		cel.Variable("groupKey", cel.StringType),
+		cel.Variable("truncatedAlerts", cel.IntType),
+		cel.Variable("receiver", cel.StringType),
+		cel.Variable("status", cel.StringType),
+		cel.Variable("alerts", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		cel.Variable("groupLabels", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("commonLabels", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("commonAnnotations", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("externalURL", cel.StringType),
+		ext.Strings(),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}()
+
+// Expression is a compiled boolean CEL expression.
+type Expression struct {
+	Source  string
+	program cel.Program
+}
+
+// CompileExpression parses and type-checks src, which must evaluate to a
+// bool.
+func CompileExpression(src string) (*Expression, error) {
+	ast, issues := celEnv.Compile(src)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression must return bool, not %s", ast.OutputType())
+	}
+	program, err := celEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{Source: src, program: program}, nil
+}
+
+// Eval evaluates the expression against variables built by celActivation.
+func (e *Expression) Eval(vars map[string]interface{}) (bool, error) {
+	out, _, err := e.program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, not bool", out.Type())
+	}
+	return b, nil
+}
+
+// celActivation exposes payload to expressions.
+func celActivation(payload *AlertManagerPayload) map[string]interface{} {
+	alerts := make([]map[string]interface{}, 0, len(payload.Alerts))
+	for _, a := range payload.Alerts {
+		alerts = append(alerts, map[string]interface{}{
+			"status":       a.Status,
+			"labels":       nonNilKV(a.Labels),
+			"annotations":  nonNilKV(a.Annotations),
+			"startsAt":     a.StartsAt,
+			"endsAt":       a.EndsAt,
+			"generatorURL": a.GeneratorURL,
+			"fingerprint":  a.Fingerprint,
+		})
+	}
+
+	return map[string]interface{}{
+		"version":           payload.Version,
+		"groupKey":          payload.GroupKey,
+		"truncatedAlerts":   payload.TruncatedAlerts,
+		"receiver":          payload.Receiver,
+		"status":            payload.Status,
+		"alerts":            alerts,
+		"groupLabels":       nonNilKV(payload.GroupLabels),
+		"commonLabels":      nonNilKV(payload.CommonLabels),
+		"commonAnnotations": nonNilKV(payload.CommonAnnotations),
+		"externalURL":       payload.ExternalURL,
+	}
+}
+
+func nonNilKV(kv KV) map[string]string {
+	if kv == nil {
+		return map[string]string{}
+	}
+	return kv
+}
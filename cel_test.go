@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpressionEval(t *testing.T) {
+	payload := &AlertManagerPayload{
+		Status:       "firing",
+		CommonLabels: KV{"severity": "critical"},
+		Alerts: Alerts{
+			{Status: "firing", Labels: KV{"alertname": "HighCPU", "namespace": "prod-web"}},
+			{Status: "firing", Labels: KV{"alertname": "HighMemory"}},
+		},
+	}
+	vars := celActivation(payload)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`alerts.exists(a, a.labels["namespace"].startsWith("prod-"))`, true},
+		{`alerts.all(a, "namespace" in a.labels)`, false},
+		{`size(alerts) == 2 && status == "firing"`, true},
+		{`commonLabels.severity in ["critical", "page"]`, true},
+		{`has(commonLabels.team)`, false},
+		{`alerts.filter(a, a.labels.alertname.matches("^High")).size() > 1`, true},
+		{`alerts[0].labels.alertname.lowerAscii() == "highcpu"`, true},
+		{`alerts[0].startsAt < timestamp("2000-01-01T00:00:00Z")`, true},
+	}
+
+	for _, tt := range tests {
+		expr, err := CompileExpression(tt.expr)
+		if err != nil {
+			t.Errorf("CompileExpression(%q) error = %v", tt.expr, err)
+			continue
+		}
+		got, err := expr.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{`alerts.exists(a`, `status`, `unknown == 1`} {
+		if _, err := CompileExpression(src); err == nil {
+			t.Errorf("CompileExpression(%q) expected error", src)
+		}
+	}
+
+	expr, err := CompileExpression(`alerts[1].labels["namespace"] == "x"`)
+	if err != nil {
+		t.Fatalf("CompileExpression() error = %v", err)
+	}
+	if _, err := expr.Eval(vars); err == nil {
+		t.Error("Expected error for missing map key")
+	}
+}
+
+func TestExpressionRoutesAndFilters(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	rt, err := NewRuntime(Config{
+		Routes: []RouteConfig{
+			{Name: "prod", Expr: `alerts.exists(a, a.labels["namespace"].startsWith("prod-"))`},
+		},
+		Filters: []FilterConfig{
+			{Expr: `commonLabels["env"] == "test"`},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+
+	prod := &AlertManagerPayload{Alerts: Alerts{{Labels: KV{"namespace": "prod-api"}}}}
+	if got := rt.Route(prod).Name; got != "prod" {
+		t.Errorf("Route() = %s, want prod", got)
+	}
+	staging := &AlertManagerPayload{Alerts: Alerts{{Labels: KV{"namespace": "staging"}}}}
+	if got := rt.Route(staging).Name; got != defaultRouteName {
+		t.Errorf("Route() = %s, want %s", got, defaultRouteName)
+	}
+
+	if !filtered("req-1", &AlertManagerPayload{CommonLabels: KV{"env": "test"}}, rt.Filters) {
+		t.Error("Expected env=test payload to be filtered")
+	}
+	// A filter that fails to evaluate must not drop the payload.
+	if filtered("req-2", &AlertManagerPayload{}, rt.Filters) {
+		t.Error("Expected payload without env label to pass the filter")
+	}
+
+	if _, err := NewRuntime(Config{Routes: []RouteConfig{{Name: "bad", Expr: "alerts.exists("}}}); err == nil {
+		t.Error("Expected error for invalid route expr")
+	}
+	if _, err := NewRuntime(Config{Filters: []FilterConfig{{}}}); err == nil {
+		t.Error("Expected error for filter without expr")
+	}
+}
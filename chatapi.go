@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	chatAPIScope   = "https://www.googleapis.com/auth/chat.bot"
+	chatAPIBaseURL = "https://chat.googleapis.com"
+
+	// spaceCacheTTL is how long resolved space names are trusted. A name
+	// missing from the cache triggers a fresh spaces.list at most once per
+	// spaceRelistInterval, so new spaces are picked up quickly.
+	spaceCacheTTL       = time.Hour
+	spaceRelistInterval = time.Minute
+)
+
+// ChatAPI is a Google Chat API client authenticated as a service account.
+// It resolves spaces by display name, so destinations can be configured by
+// name instead of by webhook URL.
+type ChatAPI struct {
+	client  *http.Client
+	baseURL string
+	// credentials loads the credentials afresh, for checks that must not
+	// be answered from the client's cached token. It is nil for test
+	// clients.
+	credentials func() (*google.Credentials, error)
+	// source describes where the credentials came from.
+	source string
+
+	health struct {
+		sync.Mutex
+		status CredentialHealth
+	}
+
+	mu       sync.Mutex
+	spaces   map[string]string
+	listedAt time.Time
+}
+
+// NewChatAPI returns nil when no Chat API credentials are configured.
+// Scopes are requested in addition to chatAPIScope.
+//
+// The credentials file may hold a service account key or a Workload
+// Identity Federation configuration, which exchanges a token from another
+// identity provider instead of storing a key. With default_credentials,
+// Application Default Credentials are used: GOOGLE_APPLICATION_CREDENTIALS,
+// or the metadata server on GCE, Cloud Run and GKE with Workload Identity.
+func NewChatAPI(cfg GoogleChatConfig, scopes ...string) (*ChatAPI, error) {
+	if !cfg.chatAPIEnabled() {
+		return nil, nil
+	}
+	scopes = append([]string{chatAPIScope}, scopes...)
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, sharedHTTPClient)
+
+	creds, source, err := loadChatCredentials(ctx, cfg, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatAPI{
+		client:  oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, creds.TokenSource)),
+		baseURL: chatAPIBaseURL,
+		credentials: func() (*google.Credentials, error) {
+			creds, _, err := loadChatCredentials(ctx, cfg, scopes)
+			return creds, err
+		},
+		source: source,
+	}, nil
+}
+
+// loadChatCredentials reads the credentials cfg names, and describes where
+// they came from.
+func loadChatCredentials(ctx context.Context, cfg GoogleChatConfig, scopes []string) (*google.Credentials, string, error) {
+	if cfg.CredentialsFile == "" {
+		creds, err := google.FindDefaultCredentials(ctx, scopes...)
+		if err != nil {
+			return nil, "", fmt.Errorf("no default credentials found: %v", err)
+		}
+		return creds, "default credentials", nil
+	}
+
+	data, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read credentials file: %v", err)
+	}
+	creds, err := google.CredentialsFromJSON(ctx, data, scopes...)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid credentials file: %v", err)
+	}
+	var file struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(data, &file)
+	return creds, strings.ReplaceAll(file.Type, "_", " ") + " credentials file", nil
+}
+
+// CredentialHealth is the outcome of the last Chat API credential check.
+type CredentialHealth struct {
+	Source    string    `json:"source"`
+	Valid     bool      `json:"valid"`
+	CheckedAt time.Time `json:"checkedAt,omitzero"`
+	// Expiry is when the current access token expires. It is refreshed
+	// shortly before.
+	Expiry time.Time `json:"expiry,omitzero"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// CheckCredentials makes sure the credentials still yield an access token.
+// It reloads them and fetches a new token rather than trusting the one the
+// client holds, so a revoked key or a deleted credentials file shows up
+// before that token expires. The outcome is recorded for the health
+// endpoint, and in chatCredentialsValid while c belongs to the active
+// Runtime.
+func (c *ChatAPI) CheckCredentials(now time.Time) error {
+	if c.credentials == nil {
+		return nil
+	}
+	var token *oauth2.Token
+	creds, err := c.credentials()
+	if err == nil {
+		token, err = creds.TokenSource.Token()
+	}
+
+	c.health.Lock()
+	defer c.health.Unlock()
+	c.health.status = CredentialHealth{Source: c.source, Valid: err == nil, CheckedAt: now}
+	active := getRuntime().Chat == c
+	if err != nil {
+		c.health.status.Error = errorText(err)
+		if active {
+			chatCredentialsValid.Set(0)
+		}
+		return fmt.Errorf("Chat API credentials are not valid: %v", err)
+	}
+	c.health.status.Expiry = token.Expiry
+	if active {
+		chatCredentialsValid.Set(1)
+	}
+	return nil
+}
+
+// checkChatCredentials runs the chat_credentials job in the background for
+// rt, which has just become active, so /health and chatCredentialsValid
+// reflect its credentials without waiting for the next scheduled check.
+func checkChatCredentials(rt *Runtime) {
+	if rt.Chat == nil {
+		return
+	}
+	go scheduler.Trigger(rt.Jobs, jobChatCredentials, clock.Now())
+}
+
+// CredentialHealth returns the outcome of the last credential check.
+func (c *ChatAPI) CredentialHealth() CredentialHealth {
+	c.health.Lock()
+	defer c.health.Unlock()
+	status := c.health.status
+	status.Source = c.source
+	return status
+}
+
+// ResolveSpace returns the resource name ("spaces/AAAA...") of the space
+// with the given display name. Resource names are returned unchanged.
+func (c *ChatAPI) ResolveSpace(ctx context.Context, name string) (string, error) {
+	if strings.HasPrefix(name, "spaces/") {
+		return name, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := clock.Since(c.listedAt)
+	if space, ok := c.spaces[name]; ok && age < spaceCacheTTL {
+		return space, nil
+	}
+	if c.spaces == nil || age >= spaceRelistInterval {
+		spaces, err := c.listSpaces(ctx)
+		if err != nil {
+			return "", err
+		}
+		c.spaces, c.listedAt = spaces, clock.Now()
+	}
+	if space, ok := c.spaces[name]; ok {
+		return space, nil
+	}
+	return "", fmt.Errorf("no Google Chat space named %q is visible to the service account", name)
+}
+
+// listSpaces maps the display name of every space the app is a member of to
+// its resource name.
+func (c *ChatAPI) listSpaces(ctx context.Context) (map[string]string, error) {
+	spaces := map[string]string{}
+	pageToken := ""
+	for {
+		q := url.Values{"pageSize": {"1000"}}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/v1/spaces?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error listing spaces: %v", err)
+		}
+
+		var page struct {
+			Spaces []struct {
+				Name        string `json:"name"`
+				DisplayName string `json:"displayName"`
+			} `json:"spaces"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("error listing spaces: %v", &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)})
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid spaces.list response: %v", err)
+		}
+
+		for _, s := range page.Spaces {
+			if s.DisplayName != "" {
+				spaces[s.DisplayName] = s.Name
+			}
+		}
+		if page.NextPageToken == "" {
+			return spaces, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// call sends a JSON request to the Chat API and decodes the response into
+// out when it is not nil.
+func (c *ChatAPI) call(ctx context.Context, method, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ChatAPIProvider posts messages to a space through the Chat API.
+type ChatAPIProvider struct {
+	API   *ChatAPI
+	Space string
+}
+
+func (p *ChatAPIProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) (err error) {
+	start := clock.Now()
+	defer func() {
+		status := statusSuccess
+		if err != nil {
+			status = statusError
+			providerErrors.WithLabelValues("chat_api").Inc()
+		}
+		observeDuration(ctx, providerRequestDuration.WithLabelValues("chat_api", status), clock.Since(start).Seconds())
+	}()
+
+	space, err := p.API.ResolveSpace(ctx, p.Space)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error marshaling Google Chat message: %v", err)
+	}
+
+	messagesURL := p.API.baseURL + "/v1/" + space + "/messages"
+	if message.ThreadKey != "" {
+		if messagesURL, err = withThreadKey(messagesURL, message.ThreadKey); err != nil {
+			return fmt.Errorf("error adding thread key: %v", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, messagesURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req, span := startClientSpan(ctx, "chat_api.send", req)
+	defer func() { endSpan(span, err) }()
+	resp, err := p.API.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	logger.Debug("[%s] Posted to %s via the Chat API", opts.ReqID, space)
+
+	var created struct {
+		Name   string `json:"name"`
+		Thread struct {
+			Name string `json:"name"`
+		} `json:"thread"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err == nil && created.Name != "" {
+		ref := ChatMessageRef{Name: created.Name, Thread: created.Thread.Name, PostedAt: clock.Now()}
+		postedMessages.Remember(ref, message.GroupKey, message.AlertKeys)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestChatAPIProvider(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { postedMessages = newPostedMessageIndex("", defaultMessageTTL) }()
+	var lists int
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/spaces":
+			lists++
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Query().Get("pageToken") == "" {
+				w.Write([]byte(`{"spaces":[{"name":"spaces/AAA","displayName":"Ops"}],"nextPageToken":"p2"}`))
+				return
+			}
+			w.Write([]byte(`{"spaces":[{"name":"spaces/BBB","displayName":"Payments On-Call"}]}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/messages"):
+			var msg GoogleChatMessage
+			if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+				t.Errorf("invalid message body: %v", err)
+			}
+			posted = append(posted, r.URL.Path+"?"+r.URL.RawQuery)
+			fmt.Fprintf(w, `{"name":%q,"thread":{"name":%q}}`, strings.TrimPrefix(r.URL.Path, "/v1/")+"/M1", strings.TrimPrefix(r.URL.Path, "/v1/")+"/T1")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	api := &ChatAPI{client: server.Client(), baseURL: server.URL}
+
+	tests := []struct {
+		space   string
+		thread  string
+		want    string
+		wantErr bool
+	}{
+		{space: "Payments On-Call", want: "/v1/spaces/BBB/messages?"},
+		{space: "Ops", thread: "abc", want: "/v1/spaces/AAA/messages?messageReplyOption=REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD&threadKey=abc"},
+		{space: "spaces/CCC", want: "/v1/spaces/CCC/messages?"},
+		{space: "Unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.space, func(t *testing.T) {
+			posted = nil
+			postedMessages = newPostedMessageIndex("", defaultMessageTTL)
+			p := &ChatAPIProvider{API: api, Space: tt.space}
+			err := p.Send(context.Background(), &GoogleChatMessage{Text: "hello", ThreadKey: tt.thread, AlertKeys: []string{"fp-1"}, GroupKey: "{}:{alertname=\"DiskFull\"}"}, SendOptions{ReqID: "test"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(posted) != 1 || posted[0] != tt.want {
+				t.Errorf("posted to %v, want %s", posted, tt.want)
+			}
+			name := strings.TrimPrefix(strings.Split(tt.want, "?")[0], "/v1/") + "/M1"
+			if keys := postedMessages.Lookup(name); len(keys) != 1 || keys[0] != "fp-1" {
+				t.Errorf("Expected %s to be remembered with its alerts, got %v", name, keys)
+			}
+			if ref := postedMessages.Group("{}:{alertname=\"DiskFull\"}"); ref == nil || ref.Name != name || ref.Thread != strings.TrimSuffix(name, "M1")+"T1" {
+				t.Errorf("Expected %s to be remembered for its group, got %+v", name, ref)
+			}
+		})
+	}
+
+	// Both pages are listed once; the unknown name was looked up within
+	// the relist interval and did not trigger another listing.
+	if lists != 2 {
+		t.Errorf("spaces.list called %d times, want 2", lists)
+	}
+}
+
+func TestChatAPIWorkloadIdentityFederation(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	fail := false
+	var subjectToken string
+	var exchanges int
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		subjectToken = r.Form.Get("subject_token")
+		exchanges++
+		if fail {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"ya29.federated","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer sts.Close()
+
+	dir := t.TempDir()
+	oidcToken := filepath.Join(dir, "token")
+	os.WriteFile(oidcToken, []byte("eyJhbGciOiJSUzI1NiJ9.oidc"), 0o600)
+	credentials := filepath.Join(dir, "wif.json")
+	os.WriteFile(credentials, []byte(`{
+		"type": "external_account",
+		"audience": "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/k8s",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url": "`+sts.URL+`",
+		"credential_source": {"file": "`+oidcToken+`"}
+	}`), 0o600)
+
+	tests := []struct {
+		name string
+		cfg  GoogleChatConfig
+		env  string
+	}{
+		{name: "credentials file", cfg: GoogleChatConfig{CredentialsFile: credentials}},
+		{name: "default credentials", cfg: GoogleChatConfig{DefaultCredentials: true}, env: credentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", tt.env)
+			fail = false
+			exchanges = 0
+			api, err := NewChatAPI(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewChatAPI() error = %v", err)
+			}
+			if exchanges != 0 {
+				t.Errorf("NewChatAPI() exchanged %d token(s), want none before the first check", exchanges)
+			}
+			currentRuntime.Store(&Runtime{Chat: api})
+			chatCredentialsValid.Set(0)
+			for range 2 {
+				if err := api.CheckCredentials(time.Now()); err != nil {
+					t.Fatalf("CheckCredentials() error = %v", err)
+				}
+			}
+			if exchanges != 2 {
+				t.Errorf("two checks exchanged %d token(s), want a fresh token for each", exchanges)
+			}
+			var m dto.Metric
+			chatCredentialsValid.Write(&m)
+			if v := m.GetGauge().GetValue(); v != 1 {
+				t.Errorf("chat_credentials_valid = %v, want 1 for the active runtime", v)
+			}
+			health := api.CredentialHealth()
+			if !health.Valid || health.Expiry.Before(time.Now().Add(50*time.Minute)) || subjectToken != "eyJhbGciOiJSUzI1NiJ9.oidc" {
+				t.Errorf("Unexpected credential health %+v after exchanging %q", health, subjectToken)
+			}
+		})
+	}
+
+	fail = true
+	api, err := NewChatAPI(GoogleChatConfig{CredentialsFile: credentials})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.CheckCredentials(time.Now()); err == nil {
+		t.Fatal("CheckCredentials() error = nil, want the rejected token exchange")
+	}
+	var m dto.Metric
+	chatCredentialsValid.Write(&m)
+	if v := m.GetGauge().GetValue(); v != 1 {
+		t.Errorf("chat_credentials_valid = %v, want it left alone by a runtime that is not active", v)
+	}
+	if health := api.CredentialHealth(); health.Valid || health.Error == "" || health.Source != "external account credentials file" {
+		t.Errorf("Unexpected credential health %+v", health)
+	}
+}
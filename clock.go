@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time and drives the periodic loops. Timestamps, request
+// IDs, windows such as idempotency and repeat intervals, and the scheduler
+// all read the package clock, so tests can replace it with a fake clock.
+// Timeouts and retry backoff always use real time.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C until stopped, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+var clock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                  { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// IDGenerator creates the IDs of requests and scheduled runs, such as
+// "req-1715763600000000000-1". They appear in logs, the X-Request-Id header
+// and the delivery log.
+type IDGenerator interface {
+	NewID(prefix string) string
+}
+
+var requestIDs IDGenerator = &clockIDs{}
+
+// clockIDs appends the clock's time in nanoseconds and a sequence number to
+// the prefix, so IDs created at the same time, or under a frozen clock,
+// differ.
+type clockIDs struct {
+	seq atomic.Uint64
+}
+
+func (g *clockIDs) NewID(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, clock.Now().UnixNano(), g.seq.Add(1))
+}
+
+func newRequestID(prefix string) string {
+	return requestIDs.NewID(prefix)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeClock is a Clock that only moves when advanced. Its tickers fire
+// from Advance, dropping ticks like time.Ticker when nobody is receiving.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// useFakeClock replaces the package clock until the test ends.
+func useFakeClock(t *testing.T, now time.Time) *FakeClock {
+	c := NewFakeClock(now)
+	clock = c
+	t.Cleanup(func() { clock = systemClock{} })
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, period: d, next: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the tickers that come due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		for !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// waitForTickers waits until n tickers were created, so a loop started in
+// a goroutine is ready for Advance.
+func (c *FakeClock) waitForTickers(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		created := len(c.tickers)
+		c.mu.Unlock()
+		if created >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d ticker(s)", n)
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	period time.Duration
+	next   time.Time
+	c      chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, other := range t.clock.tickers {
+		if other == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// sequenceIDs numbers IDs per prefix, starting at 1.
+type sequenceIDs struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func (s *sequenceIDs) NewID(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == nil {
+		s.next = map[string]int{}
+	}
+	s.next[prefix]++
+	return fmt.Sprintf("%s-%d", prefix, s.next[prefix])
+}
+
+func TestRunSchedulerWithFakeClock(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	fake := useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 30, 0, time.UTC))
+	defer func(s *Scheduler) { scheduler = s }(scheduler)
+	scheduler = NewScheduler()
+	defer currentRuntime.Store(nil)
+
+	runs := make(chan time.Time, 10)
+	currentRuntime.Store(&Runtime{Jobs: []Job{{
+		Name:     "test",
+		Schedule: everySchedule(5 * time.Minute),
+		Run: func(due time.Time) error {
+			runs <- due
+			return nil
+		},
+	}}})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runScheduler(time.Minute, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	fake.waitForTickers(t, 1)
+
+	// The first tick only records the schedule; the job comes due at 09:05.
+	for range 5 {
+		fake.Advance(time.Minute)
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case due := <-runs:
+		if want := time.Date(2024, 5, 15, 9, 5, 0, 0, time.UTC); !due.Equal(want) {
+			t.Errorf("job ran for %v, want %v", due, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+	select {
+	case due := <-runs:
+		t.Errorf("job ran again for %v", due)
+	default:
+	}
+}
+
+func TestIdempotencyWindowWithFakeClock(t *testing.T) {
+	fake := useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+	cache := &idempotencyCache{entries: map[string]*idempotencyEntry{}}
+
+	calls := 0
+	fn := func() error {
+		calls++
+		return nil
+	}
+	steps := []struct {
+		advance       time.Duration
+		wantDuplicate bool
+	}{
+		{advance: 0, wantDuplicate: false},
+		{advance: 59 * time.Second, wantDuplicate: true},
+		{advance: 2 * time.Second, wantDuplicate: false},
+	}
+	for i, step := range steps {
+		fake.Advance(step.advance)
+		duplicate, err := cache.Do("key", time.Minute, fn)
+		if err != nil || duplicate != step.wantDuplicate {
+			t.Errorf("step %d: Do() = %v, %v, want duplicate %v", i, duplicate, err, step.wantDuplicate)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("fn ran %d times, want 2", calls)
+	}
+}
+
+func TestClockIDsUnique(t *testing.T) {
+	useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+	ids := &clockIDs{}
+
+	const workers, perWorker = 8, 100
+	results := make(chan string, workers*perWorker)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				results <- ids.NewID("req")
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	seen := map[string]bool{}
+	for id := range results {
+		if seen[id] {
+			t.Fatalf("NewID() returned %q twice under a frozen clock", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != workers*perWorker {
+		t.Errorf("got %d IDs, want %d", len(seen), workers*perWorker)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func(g IDGenerator) { requestIDs = g }(requestIDs)
+	requestIDs = &sequenceIDs{}
+
+	for _, want := range []string{"req-1", "req-2"} {
+		req := httptest.NewRequest(http.MethodGet, "/webhook", strings.NewReader(""))
+		w := httptest.NewRecorder()
+		handleWebhookWithProvider(w, req, NewMockProvider(false))
+		if got := w.Header().Get("X-Request-Id"); got != want {
+			t.Errorf("X-Request-Id = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Coalescer merges the notifications that carry the same alerts within a
+// short window, such as those sent by each member of an AlertManager HA
+// pair. The first notification of an alert owns its delivery and waits out
+// the window; later ones within it drop the alert and are counted as
+// further sources.
+type Coalescer struct {
+	mu sync.Mutex
+	// seen maps receiver, status and alert key to the notifications
+	// carrying the alert, while its owner waits.
+	seen map[string]*coalescedAlert
+}
+
+type coalescedAlert struct {
+	sources int
+}
+
+var coalescer = NewCoalescer()
+
+func NewCoalescer() *Coalescer {
+	return &Coalescer{seen: map[string]*coalescedAlert{}}
+}
+
+func coalesceKey(payload *AlertManagerPayload, alert Alert) string {
+	return payload.Receiver + "\x00" + alert.Status + "\x00" + alertKey(alert)
+}
+
+// Coalesce removes the alerts of payload already carried by a notification
+// waiting out the window, then waits window for other notifications of the
+// alerts left. It sets payload.Sources to the most notifications that
+// carried any of them. Waiting ends early when ctx is done.
+func (c *Coalescer) Coalesce(ctx context.Context, reqID string, payload *AlertManagerPayload, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	kept := make(Alerts, 0, len(payload.Alerts))
+	var owned []string
+	for _, alert := range payload.Alerts {
+		key := coalesceKey(payload, alert)
+		if seen, ok := c.seen[key]; ok {
+			seen.sources++
+			continue
+		}
+		c.seen[key] = &coalescedAlert{sources: 1}
+		owned = append(owned, key)
+		kept = append(kept, alert)
+	}
+	c.mu.Unlock()
+
+	if coalesced := len(payload.Alerts) - len(kept); coalesced > 0 {
+		logger.Info("[%s] Coalesced %d alert(s) already received from another source", reqID, coalesced)
+		alertsCoalesced.Add(float64(coalesced))
+		dropAlerts(dropCoalesced, coalesced)
+	}
+	payload.Alerts = kept
+	if len(owned) == 0 {
+		return
+	}
+
+	ticker := clock.NewTicker(window)
+	select {
+	case <-ticker.C():
+	case <-ctx.Done():
+	}
+	ticker.Stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range owned {
+		payload.Sources = max(payload.Sources, c.seen[key].sources)
+		delete(c.seen, key)
+	}
+}
+
+// addSourcesNote ends each card of message with how many notifications
+// carried its alerts.
+func addSourcesNote(message *GoogleChatMessage, sources int) {
+	text := fmt.Sprintf("<i>Seen from %d sources</i>", sources)
+	for i := range message.Cards {
+		message.Cards[i].Sections = append(message.Cards[i].Sections, CardSection{
+			Widgets: []Widget{{TextParagraph: &TextParagraph{Text: text}}},
+		})
+	}
+	for i := range message.CardsV2 {
+		message.CardsV2[i].Card.Sections = append(message.CardsV2[i].Card.Sections, CardV2Section{
+			Widgets: []WidgetV2{{TextParagraph: &TextParagraph{Text: text}}},
+		})
+	}
+}
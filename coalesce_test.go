@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCoalesceHAPair(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	fake := useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+	defer func() { coalescer = NewCoalescer() }()
+	coalescer = NewCoalescer()
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{Coalesce: CoalesceConfig{Window: 5 * time.Second}}})
+
+	body, err := os.ReadFile("test_webhook/sample_alert.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample alert: %v", err)
+	}
+	provider := NewMockProvider(false)
+
+	done := make(chan error)
+	go func() { done <- processPayload(context.Background(), body, "req-1", provider) }()
+	fake.waitForTickers(t, 1)
+
+	// The HA peer's notification is acknowledged without sending anything,
+	// and its alerts counted as dropped.
+	var before, after dto.Metric
+	alertsDropped.WithLabelValues(dropCoalesced).Write(&before)
+	if err := processPayload(context.Background(), body, "req-2", provider); err != nil {
+		t.Fatalf("processPayload() error = %v", err)
+	}
+	alertsDropped.WithLabelValues(dropCoalesced).Write(&after)
+	if got := after.GetCounter().GetValue() - before.GetCounter().GetValue(); got != 2 {
+		t.Errorf("Expected 2 alerts dropped as %s, got %v", dropCoalesced, got)
+	}
+	if sent := len(provider.GetSentMessages()); sent != 0 {
+		t.Fatalf("sent %d messages before the window ended", sent)
+	}
+
+	fake.Advance(5 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("processPayload() error = %v", err)
+	}
+	sent := provider.GetSentMessages()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	sections := sent[0].message.Cards[0].Sections
+	if note := sections[len(sections)-1].Widgets[0].TextParagraph; note == nil || note.Text != "<i>Seen from 2 sources</i>" {
+		t.Errorf("last section = %+v, want the sources note", sections[len(sections)-1])
+	}
+
+	// Once the window has passed, the alert is sent again.
+	go func() { done <- processPayload(context.Background(), body, "req-3", provider) }()
+	fake.waitForTickers(t, 1)
+	fake.Advance(5 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("processPayload() error = %v", err)
+	}
+	if sent := provider.GetSentMessages(); len(sent) != 2 || len(sent[1].message.Cards[0].Sections) != len(sections)-1 {
+		t.Errorf("expected a second message without the sources note, got %d message(s)", len(sent))
+	}
+}
+
+func TestCoalesceAfterNormalizing(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	fake := useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+	defer func() { coalescer = NewCoalescer() }()
+	coalescer = NewCoalescer()
+	defer currentRuntime.Store(nil)
+	normalizer, err := NewNormalizer(NormalizeConfig{DropLabels: []string{"replica"}})
+	if err != nil {
+		t.Fatalf("NewNormalizer() error = %v", err)
+	}
+	currentRuntime.Store(&Runtime{Config: Config{Coalesce: CoalesceConfig{Window: 5 * time.Second}}, Normalizer: normalizer})
+
+	// Each replica labels its copy of the alert, so their fingerprints
+	// differ until the replica label is dropped.
+	replica := func(name, fingerprint string) []byte {
+		return []byte(`{"version":"4","status":"firing","receiver":"ops","groupKey":"{}:{}","alerts":[{"status":"firing","labels":{"alertname":"DiskFull","replica":"` + name + `"},"fingerprint":"` + fingerprint + `","startsAt":"2024-05-15T09:00:00Z"}]}`)
+	}
+	provider := NewMockProvider(false)
+
+	done := make(chan error)
+	go func() {
+		done <- processPayload(context.Background(), replica("a", "1111111111111111"), "req-1", provider)
+	}()
+	fake.waitForTickers(t, 1)
+	// Were the copy not coalesced, it would wait out its own window.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := processPayload(ctx, replica("b", "2222222222222222"), "req-2", provider); err != nil {
+		t.Fatalf("processPayload() error = %v", err)
+	}
+	fake.Advance(5 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("processPayload() error = %v", err)
+	}
+	if sent := len(provider.GetSentMessages()); sent != 1 {
+		t.Errorf("sent %d messages, want the replicas' copies coalesced into 1", sent)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// compactState applies the state retention settings and removes files left
+// behind by crashes, recording the size of each store.
+func compactState(now time.Time) {
+	cfg := getRuntime().Config.State
+	maxAge := cfg.HistoryMaxAge
+	if maxAge <= 0 {
+		maxAge = historyRetention
+	}
+	size, err := history.Compact(now, maxAge, cfg.HistoryMaxBytes)
+	observeCompaction("history", size, err)
+	size, err = outbox.Compact()
+	observeCompaction("outbox", size, err)
+	size, err = postedMessages.Compact(now)
+	observeCompaction("messages", size, err)
+	size, err = routePauses.Compact(now)
+	observeCompaction("pauses", size, err)
+	if updates := getRuntime().Config.Updates; updates.Enabled {
+		size, err = notifiedGroups.Compact(now, updates.MaxAge)
+		observeCompaction("groups", size, err)
+	}
+}
+
+func observeCompaction(store string, size int64, err error) {
+	if err != nil {
+		logger.Error("Error compacting %s state: %v", store, err)
+		stateCompactions.WithLabelValues(store, statusError).Inc()
+		return
+	}
+	stateCompactions.WithLabelValues(store, statusSuccess).Inc()
+	stateBytes.WithLabelValues(store).Set(float64(size))
+}
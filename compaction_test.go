@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryCompact(t *testing.T) {
+	now := time.Now()
+	payload := &AlertManagerPayload{Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "DiskFull", "instance": "web-1"}}}}
+
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		maxBytes  int64
+		wantKept  int
+		wantLines int
+	}{
+		{name: "nothing to drop", maxAge: historyRetention, wantKept: 4, wantLines: 4},
+		{name: "by age", maxAge: 36 * time.Hour, wantKept: 2, wantLines: 2},
+		{name: "by size", maxAge: historyRetention, maxBytes: 600, wantKept: 2, wantLines: 2},
+		{name: "size smaller than one entry", maxAge: historyRetention, maxBytes: 10, wantKept: 0, wantLines: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history.jsonl")
+			h, err := LoadHistory(path, now, historyRetention)
+			if err != nil {
+				t.Fatalf("LoadHistory() error = %v", err)
+			}
+			for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, 24 * time.Hour, time.Hour} {
+				if err := h.Record("req", "ops", payload, now.Add(-age)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			size, err := h.Compact(now, tt.maxAge, tt.maxBytes)
+			if err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+			if len(h.entries) != tt.wantKept {
+				t.Errorf("Compact() kept %d entries, want %d", len(h.entries), tt.wantKept)
+			}
+			if tt.maxBytes > 0 && size > tt.maxBytes {
+				t.Errorf("Compact() size = %d, want at most %d", size, tt.maxBytes)
+			}
+			if got := countLines(t, path); got != tt.wantLines {
+				t.Errorf("history file has %d lines, want %d", got, tt.wantLines)
+			}
+			if n := len(h.entries); n > 0 && !h.entries[n-1].At.Equal(now.Add(-time.Hour)) {
+				t.Errorf("Compact() kept %v last, want the newest entries", h.entries[n-1].At)
+			}
+		})
+	}
+}
+
+func TestOutboxCompact(t *testing.T) {
+	dir := t.TempDir()
+	o, err := LoadOutbox(dir)
+	if err != nil {
+		t.Fatalf("LoadOutbox() error = %v", err)
+	}
+	if err := o.Enqueue("req", "default", &AlertManagerPayload{}, &GoogleChatMessage{Text: "hello"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	leftover := filepath.Join(dir, "00000000000000000002.json.tmp")
+	if err := os.WriteFile(leftover, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := o.Compact()
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if size == 0 {
+		t.Error("Compact() size = 0, want the size of the queued message")
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("leftover temporary file was not removed: %v", err)
+	}
+	if o.Len() != 1 {
+		t.Errorf("Len() = %d, want the queued message kept", o.Len())
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		n++
+	}
+	return n
+}
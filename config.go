@@ -1,74 +1,1790 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
-	Server     ServerConfig     `toml:"server"`
-	GoogleChat GoogleChatConfig `toml:"google_chat"`
-	Logging    LoggingConfig    `toml:"logging"`
+	Server      ServerConfig       `toml:"server"`
+	GoogleChat  GoogleChatConfig   `toml:"google_chat"`
+	Logging     LoggingConfig      `toml:"logging"`
+	Recording   RecordingConfig    `toml:"recording"`
+	Templates   TemplatesConfig    `toml:"templates"`
+	CORS        CORSConfig         `toml:"cors"`
+	Silences    []SilenceConfig    `toml:"silence"`
+	Redact      []RedactConfig     `toml:"redact"`
+	Normalize   NormalizeConfig    `toml:"normalize"`
+	Delivery    DeliveryConfig     `toml:"delivery"`
+	DNS         DNSConfig          `toml:"dns"`
+	Egress      EgressConfig       `toml:"egress"`
+	Deadlines   DeadlinesConfig    `toml:"deadlines"`
+	Tracing     TracingConfig      `toml:"tracing"`
+	OTLP        OTLPConfig         `toml:"otlp"`
+	Routes      []RouteConfig      `toml:"routes"`
+	Sources     []SourceConfig     `toml:"sources"`
+	Notify      NotifyConfig       `toml:"notify"`
+	Filters     []FilterConfig     `toml:"filter"`
+	Transform   TransformConfig    `toml:"transform"`
+	Idempotency IdempotencyConfig  `toml:"idempotency"`
+	Coalesce    CoalesceConfig     `toml:"coalesce"`
+	Summary     SummaryConfig      `toml:"summary"`
+	QuietHours  QuietHoursConfig   `toml:"quiet_hours"`
+	Storm       StormConfig        `toml:"storm"`
+	Outbox      OutboxConfig       `toml:"outbox"`
+	Pause       PauseConfig        `toml:"pause"`
+	Acks        AckConfig          `toml:"acks"`
+	State       StateConfig        `toml:"state"`
+	Email       EmailConfig        `toml:"email"`
+	Report      ReportConfig       `toml:"report"`
+	AllClear    AllClearConfig     `toml:"all_clear"`
+	SLO         SLOConfig          `toml:"slo"`
+	Escalation  EscalationConfig   `toml:"escalation"`
+	Heartbeat   HeartbeatConfig    `toml:"heartbeat"`
+	Scheduler   SchedulerConfig    `toml:"scheduler"`
+	Kubernetes  KubernetesConfig   `toml:"kubernetes"`
+	Reactions   ReactionsConfig    `toml:"reactions"`
+	Incidents   IncidentConfig     `toml:"incidents"`
+	OnCall      OnCallConfig       `toml:"oncall"`
+	Enrichments []EnrichmentConfig `toml:"enrichments"`
+	Reload      ReloadConfig       `toml:"reload"`
+	Layout      LayoutConfig       `toml:"layout"`
+	Updates     UpdatesConfig      `toml:"updates"`
 }
 
 type ServerConfig struct {
 	ListenAddr string `toml:"listen_addr" env:"LISTEN_ADDR"`
+	// AdminListenAddr moves /metrics, /debug and /api/ endpoints to a
+	// separate listener, leaving only /webhook and /health public.
+	AdminListenAddr string          `toml:"admin_listen_addr" env:"ADMIN_LISTEN_ADDR"`
+	AdminAuth       BasicAuthConfig `toml:"admin_auth"`
+	// URLPrefix serves every route under a path such as "/a2g/", for
+	// deployments behind a shared ingress path.
+	URLPrefix string `toml:"url_prefix" env:"URL_PREFIX"`
+	// Pings configures how /webhook answers verification requests.
+	Pings PingConfig `toml:"pings"`
+	// WebhookAuth, when it holds a credential, is required on /webhook,
+	// /webhook/batch and the route webhooks.
+	WebhookAuth InboundAuthConfig `toml:"webhook_auth"`
+	// WebhookSignature, when it has a secret, requires an HMAC-SHA256
+	// signature of the body on the same endpoints as WebhookAuth.
+	WebhookSignature SignatureConfig `toml:"webhook_signature"`
+	// RequestTimeout bounds the handling of each request. Requests taking
+	// longer are answered with 503 and their processing is cancelled.
+	RequestTimeout time.Duration `toml:"request_timeout"`
+	// H2C accepts HTTP/2 without TLS alongside HTTP/1.1, for clients such
+	// as service mesh sidecars that use it with prior knowledge.
+	H2C bool `toml:"h2c"`
+	// MaxConcurrentStreams limits the requests in flight on one HTTP/2
+	// connection; zero uses Go's default.
+	MaxConcurrentStreams int `toml:"max_concurrent_streams"`
+	// MaxHeaderBytes limits the size of request headers; zero uses Go's
+	// default of 1 MB.
+	MaxHeaderBytes int `toml:"max_header_bytes"`
+	// MaxBodyBytes limits the size of request bodies on the webhook and
+	// notify endpoints, which are read whole before parsing; zero means no
+	// limit.
+	MaxBodyBytes int64 `toml:"max_body_bytes"`
+	// IdleTimeout closes keep-alive connections idle for longer.
+	IdleTimeout time.Duration `toml:"idle_timeout"`
+	// PublicDetails also serves the details page on the public listener
+	// when AdminListenAddr moves admin routes off it, so the Details
+	// buttons on cards work for Chat users.
+	PublicDetails bool `toml:"public_details"`
+	// TrustedProxies lists the addresses or CIDRs of proxies, such as the
+	// ingress controller, whose Forwarded and X-Forwarded-For headers are
+	// believed when working out the client address.
+	TrustedProxies []string `toml:"trusted_proxies"`
+}
+
+// PingConfig lets a webhook endpoint answer the verification requests some
+// upstreams send while being set up, instead of rejecting them with a 400
+// or 405.
+type PingConfig struct {
+	// AllowGet answers GET and HEAD requests with 200.
+	AllowGet bool `toml:"allow_get"`
+	// AllowEmpty answers POSTs with an empty body or "{}" with 200.
+	AllowEmpty bool `toml:"allow_empty"`
+	// SNSConfirm confirms Amazon SNS subscriptions.
+	SNSConfirm bool `toml:"sns_confirm"`
+}
+
+// pathPrefix returns URLPrefix with a leading slash and without a trailing
+// one, or "" when no prefix is configured.
+func (s ServerConfig) pathPrefix() string {
+	prefix := strings.Trim(s.URLPrefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// publicDetails reports whether the details page is served on the public
+// listener.
+func (s ServerConfig) publicDetails() bool {
+	return s.AdminListenAddr == "" || s.PublicDetails
+}
+
+// detailsURL returns the base URL for Details buttons, or "" when cards get
+// none because the details page is not served on the public listener.
+func (c *Config) detailsURL() string {
+	if !c.Server.publicDetails() {
+		return ""
+	}
+	return c.GoogleChat.DetailsURL
+}
+
+// SourceConfig is an additional webhook endpoint for one inbound source,
+// such as a team's AlertManager, that only accepts that source's
+// credentials.
+type SourceConfig struct {
+	Name string `toml:"name"`
+	// Path defaults to /webhook/<name>.
+	Path  string            `toml:"path"`
+	Auth  InboundAuthConfig `toml:"auth"`
+	Pings PingConfig        `toml:"pings"`
+	// Format is the payload format the source sends, or "auto" (the
+	// default) to detect it.
+	Format string `toml:"format"`
+	// Routes and Receivers bind the source to what it may post for:
+	// alerts are only routed to Routes, and payloads for other receivers
+	// are refused. At least one of them is required.
+	Routes    []string `toml:"routes"`
+	Receivers []string `toml:"receivers"`
+}
+
+func (s SourceConfig) webhookPath() string {
+	if s.Path != "" {
+		return "/" + strings.TrimPrefix(s.Path, "/")
+	}
+	return "/webhook/" + s.Name
+}
+
+// NotifyConfig enables POST /api/v1/notify for requests presenting one of
+// the Auth credentials.
+type NotifyConfig struct {
+	Auth InboundAuthConfig `toml:"auth"`
+}
+
+func (n NotifyConfig) enabled() bool {
+	return n.Auth.enabled()
+}
+
+// InboundAuthConfig lists the credentials accepted on an inbound endpoint.
+// A request is authorized when it presents any one of them.
+type InboundAuthConfig struct {
+	BearerToken     string           `toml:"bearer_token"`
+	BearerTokenFile string           `toml:"bearer_token_file"`
+	BasicAuth       BasicAuthConfig  `toml:"basic_auth"`
+	Header          HeaderAuthConfig `toml:"header"`
+}
+
+// SignatureConfig verifies an HMAC-SHA256 signature of the request body,
+// sent hex encoded in Header with an optional "sha256=" prefix.
+type SignatureConfig struct {
+	Header     string `toml:"header"`
+	Secret     string `toml:"secret" env:"WEBHOOK_SIGNATURE_SECRET"`
+	SecretFile string `toml:"secret_file"`
+}
+
+func (s SignatureConfig) enabled() bool {
+	return s.Secret != "" || s.SecretFile != ""
+}
+
+// HeaderAuthConfig is a shared secret sent in a custom header, such as one
+// set in AlertManager's http_config http_headers.
+type HeaderAuthConfig struct {
+	Name      string `toml:"name"`
+	Value     string `toml:"value"`
+	ValueFile string `toml:"value_file"`
+}
+
+// enabled reports whether any credential is configured.
+func (a InboundAuthConfig) enabled() bool {
+	return a.BearerToken != "" || a.BearerTokenFile != "" || a.BasicAuth.Username != "" || a.Header.Name != ""
+}
+
+// Validate requires at least one credential.
+func (a InboundAuthConfig) Validate() error {
+	if a.BearerToken != "" && a.BearerTokenFile != "" {
+		return fmt.Errorf("bearer_token and bearer_token_file are mutually exclusive")
+	}
+	if b := a.BasicAuth; b.Username != "" && b.Password == "" && b.PasswordFile == "" {
+		return fmt.Errorf("basic_auth requires a password or password_file")
+	}
+	if h := a.Header; h.Name != "" && (h.Value == "") == (h.ValueFile == "") {
+		return fmt.Errorf("header requires one of value or value_file")
+	}
+	if h := a.Header; h.Name == "" && (h.Value != "" || h.ValueFile != "") {
+		return fmt.Errorf("header requires a name")
+	}
+	if !a.enabled() {
+		return fmt.Errorf("a bearer token, basic_auth credentials or a header secret are required")
+	}
+	return nil
+}
+
+// BasicAuthConfig holds HTTP basic auth credentials. Auth is disabled when
+// Username is empty.
+type BasicAuthConfig struct {
+	Username     string `toml:"username"`
+	Password     string `toml:"password"`
+	PasswordFile string `toml:"password_file"`
 }
 
 type GoogleChatConfig struct {
 	WebhookURL string `toml:"webhook_url" env:"GOOGLE_CHAT_WEBHOOK_URL"`
+	// LinkAnnotationPrefix turns annotations such as link_runbook into
+	// buttons on the alert section. An empty prefix disables link buttons.
+	LinkAnnotationPrefix string `toml:"link_annotation_prefix"`
+	// ThreadByGroupKey replies in one thread per AlertManager alert group.
+	ThreadByGroupKey bool `toml:"thread_by_group_key"`
+	// ThreadByLabels replies in one thread per combination of the values
+	// of these labels instead, e.g. ["alertname", "cluster"], so alert
+	// groups that AlertManager splits still share a thread.
+	ThreadByLabels []string `toml:"thread_by_labels"`
+	// DetailsURL is the public base URL of the bridge. When set, and the
+	// details page is served on the public listener, each card gets a
+	// Details button linking to its notification's page.
+	DetailsURL string `toml:"details_url"`
+	// CredentialsFile is a service account key, or a Workload Identity
+	// Federation configuration, for the Chat API. With it, Space (and
+	// route spaces) can name a destination by its display name instead of
+	// a webhook URL. DefaultCredentials uses Application Default
+	// Credentials, such as the metadata server, instead of a file.
+	CredentialsFile    string `toml:"credentials_file"`
+	DefaultCredentials bool   `toml:"default_credentials"`
+	Space              string `toml:"space"`
+	OutboundConfig
+}
+
+// chatAPIEnabled reports whether Chat API credentials are configured.
+func (c GoogleChatConfig) chatAPIEnabled() bool {
+	return c.CredentialsFile != "" || c.DefaultCredentials
+}
+
+// OutboundConfig adds headers and credentials to requests sent to a
+// destination, for webhooks fronted by an internal gateway. A "Host" header
+// overrides the request host.
+type OutboundConfig struct {
+	Headers         map[string]string `toml:"headers"`
+	BearerToken     string            `toml:"bearer_token"`
+	BearerTokenFile string            `toml:"bearer_token_file"`
+	TLS             TLSClientConfig   `toml:"tls"`
+}
+
+// TLSClientConfig configures client certificates for gateways that require
+// mutual TLS, and the CA used to verify them.
+type TLSClientConfig struct {
+	CertFile   string `toml:"cert_file"`
+	KeyFile    string `toml:"key_file"`
+	CAFile     string `toml:"ca_file"`
+	ServerName string `toml:"server_name"`
+}
+
+func (t TLSClientConfig) enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.CAFile != "" || t.ServerName != ""
+}
+
+func (t TLSClientConfig) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// DeadlinesConfig splits the time a webhook request may take between
+// phases. Zero leaves a phase bounded only by the incoming request.
+type DeadlinesConfig struct {
+	// Enrichment bounds the enrichment pipeline, including the on-call
+	// lookup. A step that misses it is handled by its on_failure policy.
+	Enrichment time.Duration `toml:"enrichment"`
+	// Send bounds delivery, including waiting for a worker or rate limit
+	// token and retries.
+	Send time.Duration `toml:"send"`
+}
+
+// TracingConfig exports OpenTelemetry traces over OTLP/HTTP. Changes
+// require a restart.
+type TracingConfig struct {
+	Enabled bool `toml:"enabled" env:"TRACING_ENABLED"`
+	// Endpoint is the collector URL, e.g. "http://otel-collector:4318".
+	// When empty, OTEL_EXPORTER_OTLP_ENDPOINT or localhost is used.
+	Endpoint    string  `toml:"endpoint"`
+	ServiceName string  `toml:"service_name"`
+	SampleRatio float64 `toml:"sample_ratio"`
+}
+
+// OTLPConfig pushes the bridge's metrics every Interval and its log lines
+// to an OpenTelemetry collector over OTLP/HTTP. Endpoint is the collector's
+// base URL, e.g. "http://otel-collector:4318"; when empty,
+// OTEL_EXPORTER_OTLP_ENDPOINT or localhost is used. Headers are added to
+// every export, e.g. for authentication.
+type OTLPConfig struct {
+	Metrics  bool              `toml:"metrics" env:"OTLP_METRICS"`
+	Logs     bool              `toml:"logs" env:"OTLP_LOGS"`
+	Endpoint string            `toml:"endpoint"`
+	Interval time.Duration     `toml:"interval"`
+	Headers  map[string]string `toml:"headers"`
+	// Compression is "gzip" or "none"; empty leaves it to
+	// OTEL_EXPORTER_OTLP_COMPRESSION.
+	Compression string          `toml:"compression"`
+	TLS         TLSClientConfig `toml:"tls"`
+}
+
+const (
+	otlpGzip = "gzip"
+	otlpNone = "none"
+)
+
+// DNSConfig tunes name resolution for outbound requests.
+type DNSConfig struct {
+	// CacheTTL caches lookups for the given time. Expired entries are
+	// still used for an hour when a fresh lookup fails. Zero disables the
+	// cache.
+	CacheTTL time.Duration `toml:"cache_ttl"`
+	// Prefer is "ipv4", "ipv6" or empty to use the resolver's order.
+	Prefer string `toml:"prefer"`
+	// FallbackDelay is how long to wait for the preferred address family
+	// before also trying the other one. Negative disables the fallback
+	// race; zero uses 300ms.
+	FallbackDelay time.Duration `toml:"fallback_delay"`
+}
+
+// EgressConfig pins the address family and local address of outbound
+// connections, for egress firewalls that allow chat.googleapis.com per
+// source IP.
+type EgressConfig struct {
+	// Family is "ipv4" or "ipv6" to only connect over that family, or
+	// empty for both.
+	Family string `toml:"family"`
+	// SourceAddress is the local IP outbound connections are made from.
+	SourceAddress string `toml:"source_address"`
+	// Interface makes outbound connections from the first address of the
+	// named network interface in the family of the destination.
+	Interface string `toml:"interface"`
+}
+
+func (e EgressConfig) enabled() bool {
+	return e.Family != "" || e.SourceAddress != "" || e.Interface != ""
+}
+
+// Validate checks the family and that the source address is an IP of that
+// family.
+func (e EgressConfig) Validate() error {
+	if e.Family != "" && e.Family != "ipv4" && e.Family != "ipv6" {
+		return fmt.Errorf("family must be ipv4 or ipv6, not %q", e.Family)
+	}
+	if e.SourceAddress != "" && e.Interface != "" {
+		return fmt.Errorf("source_address and interface are mutually exclusive")
+	}
+	if e.SourceAddress != "" {
+		ip := net.ParseIP(e.SourceAddress)
+		if ip == nil {
+			return fmt.Errorf("source_address %q is not an IP address", e.SourceAddress)
+		}
+		if e.Family != "" && (ip.To4() != nil) != (e.Family == "ipv4") {
+			return fmt.Errorf("source_address %s is not an %s address", e.SourceAddress, e.Family)
+		}
+	}
+	if e.Interface != "" {
+		if _, err := net.InterfaceByName(e.Interface); err != nil {
+			return fmt.Errorf("interface %s: %v", e.Interface, err)
+		}
+	}
+	return nil
 }
 
 type LoggingConfig struct {
 	Level string `toml:"level" env:"LOG_LEVEL"`
+	// RepeatWindow collapses delivery errors repeated within it into one
+	// summary line; zero logs every repeat.
+	RepeatWindow time.Duration `toml:"repeat_window"`
+}
+
+type RecordingConfig struct {
+	Enabled bool   `toml:"enabled" env:"RECORDING_ENABLED"`
+	Dir     string `toml:"dir" env:"RECORDING_DIR"`
+}
+
+// TemplatesConfig holds Go text/templates rendered against the AlertManager
+// notification data model. Empty templates keep the built-in rendering.
+// Files and Snippets define named templates shared by the message
+// templates and the ticket templates of every route.
+// Jsonnet replaces the whole message with the output of a Jsonnet file,
+// evaluated by JsonnetCommand (default "jsonnet").
+// Limits bound every rendering of these and the route templates.
+type TemplatesConfig struct {
+	Files []string `toml:"files"`
+	// Snippets maps template names to their text, for short shared
+	// templates that do not need a file.
+	Snippets       map[string]string    `toml:"snippets"`
+	Title          string               `toml:"title"`
+	Text           string               `toml:"text"`
+	Jsonnet        string               `toml:"jsonnet"`
+	JsonnetCommand string               `toml:"jsonnet_command"`
+	Limits         TemplateLimitsConfig `toml:"limits"`
+}
+
+// TemplateLimitsConfig bounds each rendering of a user template, so a slow
+// or runaway template on one route cannot stall deliveries on the others.
+// Timeout bounds Go templates and JsonnetTimeout the Jsonnet evaluation,
+// which starts a process and needs longer. A zero Timeout, JsonnetTimeout
+// or MaxOutput disables that limit. DenyFunctions lists template functions
+// that fail when called, e.g. "groupMessage".
+type TemplateLimitsConfig struct {
+	Timeout        time.Duration `toml:"timeout"`
+	JsonnetTimeout time.Duration `toml:"jsonnet_timeout"`
+	MaxOutput      int           `toml:"max_output"`
+	DenyFunctions  []string      `toml:"deny_functions"`
+}
+
+// TemplateLimitsOverrides holds the per-route template limits. Unset
+// fields inherit the [templates.limits] values.
+type TemplateLimitsOverrides struct {
+	Timeout        *time.Duration `toml:"timeout"`
+	JsonnetTimeout *time.Duration `toml:"jsonnet_timeout"`
+	MaxOutput      *int           `toml:"max_output"`
+	DenyFunctions  []string       `toml:"deny_functions"`
+}
+
+// Merge returns l with every field set in o replaced.
+func (l TemplateLimitsConfig) Merge(o TemplateLimitsOverrides) TemplateLimitsConfig {
+	if o.Timeout != nil {
+		l.Timeout = *o.Timeout
+	}
+	if o.JsonnetTimeout != nil {
+		l.JsonnetTimeout = *o.JsonnetTimeout
+	}
+	if o.MaxOutput != nil {
+		l.MaxOutput = *o.MaxOutput
+	}
+	if o.DenyFunctions != nil {
+		l.DenyFunctions = o.DenyFunctions
+	}
+	return l
+}
+
+func (l TemplateLimitsConfig) Validate() error {
+	if l.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if l.JsonnetTimeout < 0 {
+		return fmt.Errorf("jsonnet_timeout must not be negative")
+	}
+	if l.MaxOutput < 0 {
+		return fmt.Errorf("max_output must not be negative")
+	}
+	for _, name := range l.DenyFunctions {
+		if _, ok := templateFuncs[name]; !ok {
+			return fmt.Errorf("deny_functions: unknown template function %q", name)
+		}
+	}
+	return nil
+}
+
+// TransformConfig points at a Starlark script whose transform(payload)
+// function is called on every payload between parsing and rendering.
+type TransformConfig struct {
+	Script  string        `toml:"script"`
+	Timeout time.Duration `toml:"timeout"`
+}
+
+// IdempotencyConfig skips webhook requests repeated within Window, keyed by
+// the Idempotency-Key header or a hash of the body. Zero disables it.
+type IdempotencyConfig struct {
+	Window time.Duration `toml:"window"`
+}
+
+// CoalesceConfig merges notifications carrying the same alerts within
+// Window, as sent by AlertManager HA pairs, into one delivery. Each
+// notification waits out the window before it is sent. Zero disables it.
+type CoalesceConfig struct {
+	Window time.Duration `toml:"window"`
+}
+
+// SummaryConfig controls the summary card listing every firing alert.
+// Interval posts it on a schedule; zero only posts it on request. Alerts not
+// seen again within StaleAfter are left out.
+type SummaryConfig struct {
+	Interval   time.Duration `toml:"interval"`
+	StaleAfter time.Duration `toml:"stale_after"`
+}
+
+// UpdatesConfig sends a short update, listing only the alerts that started
+// firing or resolved, when an alert group that was already notified
+// changes, instead of the whole card again. A group is forgotten once it
+// resolves or MaxAge after its last notification.
+type UpdatesConfig struct {
+	Enabled bool          `toml:"enabled"`
+	MaxAge  time.Duration `toml:"max_age"`
+}
+
+// QuietHoursConfig holds alerts arriving between Start and End, such as
+// "22:00" and "07:00" in Timezone, and posts them as one summary card when
+// the window ends. Matchers limit which alerts are held, so that e.g.
+// critical alerts still page immediately; without any, all are held.
+type QuietHoursConfig struct {
+	Start    string   `toml:"start"`
+	End      string   `toml:"end"`
+	Timezone string   `toml:"timezone"`
+	Matchers []string `toml:"matchers"`
+}
+
+// StormConfig detects alert storms per route: when the alerts received in
+// the last Window reach Factor times the rate seen over the Baseline before
+// it, and at least MinAlerts, the route's alerts are held and posted as one
+// summary when the rate drops again.
+type StormConfig struct {
+	Enabled   bool          `toml:"enabled"`
+	Factor    float64       `toml:"factor"`
+	Window    time.Duration `toml:"window"`
+	Baseline  time.Duration `toml:"baseline"`
+	MinAlerts int           `toml:"min_alerts"`
+}
+
+// OutboxConfig moves delivery out of the webhook request. When enabled,
+// the handler stores each message in the outbox and acknowledges
+// AlertManager; a dispatcher sends the messages in order per destination,
+// retrying failures with backoff up to MaxBackoff and dropping messages
+// still undelivered after MaxAge. Once MaxMessages are waiting, new
+// notifications are refused so AlertManager retries them. The outbox is
+// kept in the state directory when one is configured.
+type OutboxConfig struct {
+	Enabled     bool          `toml:"enabled"`
+	MaxAge      time.Duration `toml:"max_age"`
+	MaxBackoff  time.Duration `toml:"max_backoff"`
+	MaxMessages int           `toml:"max_messages"`
+}
+
+// PauseConfig sets what happens to the notifications of routes paused
+// through the admin API: Mode "drop" discards them and "buffer" holds them
+// in the outbox until the route is resumed. Once MaxMessages are held,
+// further notifications of paused routes are dropped; zero means no limit.
+type PauseConfig struct {
+	Mode        string `toml:"mode"`
+	MaxMessages int    `toml:"max_messages"`
+}
+
+const (
+	pauseDrop   = "drop"
+	pauseBuffer = "buffer"
+
+	// defaultPauseMaxMessages is the default [pause] max_messages.
+	defaultPauseMaxMessages = 1000
+)
+
+// AckConfig controls alert acknowledgments. TTL forgets acknowledgments
+// of alerts that never resolve; zero keeps them until the alert resolves.
+type AckConfig struct {
+	TTL time.Duration `toml:"ttl"`
+}
+
+// ReactionsConfig acts on emoji reactions to alert messages posted through
+// the Chat API: Ack acknowledges the alerts in the message and Silence
+// silences them for SilenceDuration. Reaction events are delivered by a
+// Pub/Sub push subscription, which must pass Token as a query parameter
+// when one is set.
+type ReactionsConfig struct {
+	Enabled         bool          `toml:"enabled"`
+	Token           string        `toml:"token"`
+	TokenFile       string        `toml:"token_file"`
+	Ack             string        `toml:"ack"`
+	Silence         string        `toml:"silence"`
+	SilenceDuration time.Duration `toml:"silence_duration"`
+}
+
+// IncidentConfig opens a dedicated Chat space for alert groups whose labels
+// match all of Matchers, invites Members (Chat user IDs or emails) and posts
+// the group's notifications there, with a link in the usual space. It
+// requires Chat API credentials.
+type IncidentConfig struct {
+	Enabled    bool     `toml:"enabled"`
+	Matchers   []string `toml:"matchers"`
+	Members    []string `toml:"members"`
+	NamePrefix string   `toml:"name_prefix"`
+}
+
+// StateConfig keeps state such as acknowledgments as files in Dir, so it
+// survives restarts. Without a Dir, state is only kept in memory.
+type StateConfig struct {
+	Dir string `toml:"dir" env:"STATE_DIR"`
+	// HistoryMaxAge is how long delivered notifications are kept for
+	// reports and statistics.
+	HistoryMaxAge time.Duration `toml:"history_max_age"`
+	// HistoryMaxBytes, when set, caps the history file by dropping its
+	// oldest entries.
+	HistoryMaxBytes int64 `toml:"history_max_bytes"`
+	// CompactInterval is how often state files are compacted.
+	CompactInterval time.Duration `toml:"compact_interval"`
+	// MessageTTL is how long the first message posted through the Chat API
+	// for an alert or alert group is remembered for templates.
+	MessageTTL time.Duration `toml:"message_ttl"`
+}
+
+// EmailConfig is the SMTP server used to send email, as "host:port" in
+// Smarthost. Username and Password, when set, authenticate with PLAIN.
+type EmailConfig struct {
+	Smarthost    string `toml:"smarthost"`
+	From         string `toml:"from"`
+	Username     string `toml:"username"`
+	Password     string `toml:"password"`
+	PasswordFile string `toml:"password_file"`
+}
+
+// ReportConfig emails an HTML report of the notifications delivered over
+// the past day or week to To. Schedule is "daily" or "weekly"; reports are
+// sent At a "15:04" time of day in Timezone, on Weekday for weekly reports.
+type ReportConfig struct {
+	Schedule string   `toml:"schedule"`
+	At       string   `toml:"at"`
+	Weekday  string   `toml:"weekday"`
+	Timezone string   `toml:"timezone"`
+	To       []string `toml:"to"`
+	Subject  string   `toml:"subject"`
+}
+
+// AllClearConfig posts a card to Route (the default route when empty)
+// summarizing the alerts fired, resolved and still firing over the past
+// Period. Schedule is a cron expression such as "0 9 * * 1-5", evaluated
+// in Timezone.
+type AllClearConfig struct {
+	Schedule string        `toml:"schedule"`
+	Timezone string        `toml:"timezone"`
+	Route    string        `toml:"route"`
+	Period   time.Duration `toml:"period"`
+}
+
+// SLOConfig sets the target time from a firing alert starting to its first
+// notification. FooterAfter, when set, adds the delay to cards sent at
+// least that long after their alerts started.
+type SLOConfig struct {
+	NotifyTarget time.Duration `toml:"notify_target"`
+	FooterAfter  time.Duration `toml:"footer_after"`
+}
+
+// HeartbeatConfig posts a warning to Route (the default route when empty)
+// when no notification has arrived for MaxSilence, which usually means
+// Alertmanager or its webhook configuration is broken. Zero disables it.
+type HeartbeatConfig struct {
+	MaxSilence time.Duration `toml:"max_silence"`
+	Route      string        `toml:"route"`
+}
+
+// SchedulerConfig overrides when scheduled jobs run. Jobs maps job names
+// to a cron expression, evaluated in Timezone, or "@every <duration>".
+type SchedulerConfig struct {
+	Timezone string            `toml:"timezone"`
+	Jobs     map[string]string `toml:"jobs"`
+}
+
+// location returns the time zone cron expressions are evaluated in.
+func (c SchedulerConfig) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %v", err)
+	}
+	return loc, nil
+}
+
+// KubernetesConfig enables operator mode, where ChatRoute resources add
+// routes for the alerts of their namespace without editing this file.
+// APIServer defaults to the cluster the bridge runs in. Namespaces limits
+// the namespaces watched, which otherwise needs cluster-wide read access.
+// A ChatRoute only matches alerts whose NamespaceLabel is its namespace,
+// and may only send to webhook URLs on AllowedHosts.
+type KubernetesConfig struct {
+	Enabled        bool     `toml:"enabled"`
+	APIServer      string   `toml:"api_server"`
+	TokenFile      string   `toml:"token_file"`
+	CAFile         string   `toml:"ca_file"`
+	Namespaces     []string `toml:"namespaces"`
+	NamespaceLabel string   `toml:"namespace_label"`
+	AllowedHosts   []string `toml:"allowed_hosts"`
+	// AllowedSpaces lists the space patterns a ChatRoute's space may
+	// match, with "{namespace}" standing for the ChatRoute's namespace.
+	// Without any, ChatRoutes can only use webhooks.
+	AllowedSpaces []string      `toml:"allowed_spaces"`
+	Resync        time.Duration `toml:"resync"`
+}
+
+// EscalationConfig lists where to report notifications the outbox gives
+// up on: a PagerDuty incident, a JSON webhook such as an SMS gateway, and
+// email through [email]. Any combination may be set.
+type EscalationConfig struct {
+	PagerDuty EscalationPagerDutyConfig `toml:"pagerduty"`
+	Webhook   EscalationWebhookConfig   `toml:"webhook"`
+	EmailTo   []string                  `toml:"email_to"`
+	// RemindAfter escalates outbox messages that are still undelivered
+	// this long after they were accepted, and again each further
+	// RemindAfter they wait. 0 only escalates dropped messages.
+	RemindAfter time.Duration `toml:"remind_after"`
+}
+
+type EscalationPagerDutyConfig struct {
+	RoutingKey     string `toml:"routing_key"`
+	RoutingKeyFile string `toml:"routing_key_file"`
+	// URL is the Events API v2 endpoint.
+	URL      string `toml:"url"`
+	Severity string `toml:"severity"`
+}
+
+type EscalationWebhookConfig struct {
+	URL     string `toml:"url"`
+	URLFile string `toml:"url_file"`
+}
+
+func (e EscalationConfig) Validate(email EmailConfig) error {
+	if e.PagerDuty.RoutingKey != "" && e.PagerDuty.RoutingKeyFile != "" {
+		return fmt.Errorf("pagerduty routing_key and routing_key_file are mutually exclusive")
+	}
+	switch e.PagerDuty.Severity {
+	case "", "critical", "error", "warning", "info":
+	default:
+		return fmt.Errorf("pagerduty severity must be critical, error, warning or info")
+	}
+	if e.Webhook.URL != "" && e.Webhook.URLFile != "" {
+		return fmt.Errorf("webhook url and url_file are mutually exclusive")
+	}
+	if e.Webhook.URL != "" && !strings.HasPrefix(e.Webhook.URL, "https://") && !strings.HasPrefix(e.Webhook.URL, "http://") {
+		return fmt.Errorf("webhook url must be an http or https URL")
+	}
+	if len(e.EmailTo) > 0 && (email.Smarthost == "" || email.From == "") {
+		return fmt.Errorf("email_to requires smarthost and from in [email]")
+	}
+	if e.RemindAfter < 0 {
+		return fmt.Errorf("remind_after must not be negative")
+	}
+	return nil
+}
+
+// OnCallConfig mentions whoever is on call on firing alerts with one of
+// Severities. The on-call person comes from a static rota file or a
+// PagerDuty schedule, and ChatUsers maps their identity (e.g. email) to a
+// Chat user ID such as "users/123456789".
+type OnCallConfig struct {
+	Severities []string              `toml:"severities"`
+	RotaFile   string                `toml:"rota_file"`
+	PagerDuty  PagerDutyOnCallConfig `toml:"pagerduty"`
+	ChatUsers  map[string]string     `toml:"chat_users"`
+}
+
+type PagerDutyOnCallConfig struct {
+	ScheduleID string `toml:"schedule_id"`
+	Token      string `toml:"token"`
+	TokenFile  string `toml:"token_file"`
+	URL        string `toml:"url"`
+}
+
+// EnrichmentConfig is one step of the enrichment pipeline, which adds
+// optional context to alerts before the message is rendered.
+type EnrichmentConfig struct {
+	Name string `toml:"name"`
+	// Type is "prometheus" (the current value of a query), "link" (a URL
+	// rendered from each alert) or "grafana_snapshot".
+	Type string `toml:"type"`
+	// Timeout bounds this step on its own; the pipeline as a whole is
+	// bounded by deadlines.enrichment.
+	Timeout time.Duration `toml:"timeout"`
+	// OnFailure is "skip" (the default) to send the message without this
+	// step, or "annotate" to also name it in the enrichment_unavailable
+	// common annotation.
+	OnFailure string `toml:"on_failure"`
+	// Annotation is the annotation the step sets, defaulting to
+	// current_value, link_logs or link_snapshot by type.
+	Annotation string `toml:"annotation"`
+	// URL is the Prometheus or Grafana base URL, or the link template.
+	URL   string `toml:"url"`
+	Query string `toml:"query"`
+	// DashboardUID is a template rendered against the notification.
+	DashboardUID string        `toml:"dashboard_uid"`
+	Token        string        `toml:"token"`
+	TokenFile    string        `toml:"token_file"`
+	Expires      time.Duration `toml:"expires"`
+}
+
+func (e EnrichmentConfig) annotation() string {
+	if e.Annotation != "" {
+		return e.Annotation
+	}
+	switch e.Type {
+	case enrichPrometheus:
+		return "current_value"
+	case enrichLink:
+		return "link_logs"
+	default:
+		return "link_snapshot"
+	}
+}
+
+// CORSConfig controls the CORS headers sent on /api/ endpoints. CORS is
+// disabled when AllowedOrigins is empty.
+type CORSConfig struct {
+	AllowedOrigins []string `toml:"allowed_origins"`
+	AllowedMethods []string `toml:"allowed_methods"`
+	AllowedHeaders []string `toml:"allowed_headers"`
+	MaxAge         int      `toml:"max_age"`
+}
+
+// SilenceConfig mutes alerts at the bridge. Matchers use AlertManager
+// syntax (e.g. `severity="warning"`, `instance=~"web-.*"`); all must match.
+type SilenceConfig struct {
+	Matchers  []string  `toml:"matchers"`
+	ExpiresAt time.Time `toml:"expires_at"`
+	Comment   string    `toml:"comment"`
+}
+
+// FilterConfig drops payloads for which Expr, a CEL expression over the
+// payload, evaluates to true.
+type FilterConfig struct {
+	Expr    string `toml:"expr"`
+	Comment string `toml:"comment"`
+}
+
+// RedactConfig masks matches of Pattern in label and annotation values.
+// Keys limits the rule to specific label/annotation names.
+type RedactConfig struct {
+	Pattern    string   `toml:"pattern"`
+	Keys       []string `toml:"keys"`
+	KeepPrefix int      `toml:"keep_prefix"`
+	KeepSuffix int      `toml:"keep_suffix"`
+	Mask       string   `toml:"mask"`
+}
+
+// NormalizeConfig removes labels matching DropLabels patterns, such as
+// "replica" or "__*", and renames labels by RenameLabels before alerts are
+// routed, deduplicated or rendered.
+type NormalizeConfig struct {
+	DropLabels   []string          `toml:"drop_labels"`
+	RenameLabels map[string]string `toml:"rename_labels"`
+	// MaxLabels and MaxAnnotations cap the entries kept per label map, and
+	// MaxValueLength the bytes kept per value, so that rules with huge
+	// label sets cannot make a request use unbounded memory. Zero means no
+	// limit.
+	MaxLabels      int `toml:"max_labels"`
+	MaxAnnotations int `toml:"max_annotations"`
+	MaxValueLength int `toml:"max_value_length"`
+}
+
+// DeliveryConfig controls how messages are sent to a destination. Zero
+// values for Workers and RateLimit mean unlimited; RateLimit defaults to
+// the one message per second Chat accepts per space. After BreakerFailures
+// failed attempts in a row, sends fail fast for BreakerCooldown; zero
+// disables the circuit breaker.
+type DeliveryConfig struct {
+	Workers         int           `toml:"workers"`
+	RateLimit       float64       `toml:"rate_limit"`
+	Burst           int           `toml:"burst"`
+	MaxRetries      int           `toml:"max_retries"`
+	RetryBackoff    time.Duration `toml:"retry_backoff"`
+	Timeout         time.Duration `toml:"timeout"`
+	BreakerFailures int           `toml:"breaker_failures"`
+	BreakerCooldown time.Duration `toml:"breaker_cooldown"`
+}
+
+// DeliveryOverrides holds the per-route delivery settings. Unset fields
+// inherit the global [delivery] values.
+type DeliveryOverrides struct {
+	Workers         *int           `toml:"workers"`
+	RateLimit       *float64       `toml:"rate_limit"`
+	Burst           *int           `toml:"burst"`
+	MaxRetries      *int           `toml:"max_retries"`
+	RetryBackoff    *time.Duration `toml:"retry_backoff"`
+	Timeout         *time.Duration `toml:"timeout"`
+	BreakerFailures *int           `toml:"breaker_failures"`
+	BreakerCooldown *time.Duration `toml:"breaker_cooldown"`
+}
+
+// Merge returns d with every field set in o replaced.
+func (d DeliveryConfig) Merge(o DeliveryOverrides) DeliveryConfig {
+	if o.Workers != nil {
+		d.Workers = *o.Workers
+	}
+	if o.RateLimit != nil {
+		d.RateLimit = *o.RateLimit
+	}
+	if o.Burst != nil {
+		d.Burst = *o.Burst
+	}
+	if o.MaxRetries != nil {
+		d.MaxRetries = *o.MaxRetries
+	}
+	if o.RetryBackoff != nil {
+		d.RetryBackoff = *o.RetryBackoff
+	}
+	if o.Timeout != nil {
+		d.Timeout = *o.Timeout
+	}
+	if o.BreakerFailures != nil {
+		d.BreakerFailures = *o.BreakerFailures
+	}
+	if o.BreakerCooldown != nil {
+		d.BreakerCooldown = *o.BreakerCooldown
+	}
+	return d
+}
+
+func (d DeliveryConfig) Validate() error {
+	if d.Workers < 0 {
+		return fmt.Errorf("workers must not be negative")
+	}
+	if d.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must not be negative")
+	}
+	if d.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	if d.Timeout < 0 || d.RetryBackoff < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	if d.BreakerFailures < 0 {
+		return fmt.Errorf("breaker_failures must not be negative")
+	}
+	if d.BreakerFailures > 0 && d.BreakerCooldown <= 0 {
+		return fmt.Errorf("breaker_cooldown must be positive")
+	}
+	return nil
+}
+
+// RouteConfig sends alerts whose common labels match all Matchers, and for
+// which Expr (a CEL expression over the payload) is true, to WebhookURL (or
+// the default webhook when empty). Routes are evaluated in order and the
+// first match wins.
+type RouteConfig struct {
+	Name       string   `toml:"name"`
+	Matchers   []string `toml:"matchers"`
+	Expr       string   `toml:"expr"`
+	WebhookURL string   `toml:"webhook_url"`
+	Space      string   `toml:"space"`
+	// ServeWebhook serves the route at /webhook/<name>. Alerts posted there
+	// use the route without matching, so each AlertManager receiver can
+	// post to its own space.
+	ServeWebhook bool `toml:"serve_webhook"`
+	// Receivers restricts the route to notifications for these AlertManager
+	// receivers, so AlertManager's routing tree can pick the Chat space.
+	// With no matchers or expr, the route takes every alert of the
+	// receivers.
+	Receivers []string `toml:"receivers"`
+	// Continue keeps matching the following routes after this one matched,
+	// like continue in AlertManager routes, so an alert can notify several
+	// spaces.
+	Continue bool `toml:"continue"`
+	// WebhookMap names a file mapping values of WebhookMapLabel (default
+	// "team") to webhook URLs. The route only matches alerts whose label
+	// value is in the file.
+	WebhookMap      string `toml:"webhook_map"`
+	WebhookMapLabel string `toml:"webhook_map_label"`
+	// AllowedHosts lists the host patterns a templated WebhookURL may
+	// render, e.g. "chat.googleapis.com". It is required for templates.
+	AllowedHosts []string          `toml:"allowed_hosts"`
+	Delivery     DeliveryOverrides `toml:"delivery"`
+	// TemplateLimits overrides [templates.limits] for the templates
+	// rendered on the route.
+	TemplateLimits TemplateLimitsOverrides `toml:"template_limits"`
+	// Jira files an issue for each alert group the route matches.
+	Jira *JiraConfig `toml:"jira"`
+	// GitHub files an issue for each alert the route matches.
+	GitHub *GitHubConfig `toml:"github"`
+	// GrafanaOnCall forwards each notification the route sends to a
+	// Grafana OnCall integration.
+	GrafanaOnCall *GrafanaOnCallConfig `toml:"grafana_oncall"`
+	// DisableChat skips the Chat notification, for routes that only file
+	// tickets.
+	DisableChat bool `toml:"disable_chat"`
+	// LabelColumns, when set, replaces [layout] label_columns for the
+	// route. An empty list renders labels as a bullet list.
+	LabelColumns []string `toml:"label_columns"`
+	// ChipLabels, when set, replaces [layout] chip_labels for the route.
+	ChipLabels []string `toml:"chip_labels"`
+	// RepeatInterval is the minimum interval between notifications of the
+	// same firing alert, by severity label, whatever AlertManager's own
+	// repeat_interval. The "*" key applies to other severities.
+	RepeatInterval map[string]time.Duration `toml:"repeat_interval"`
+	OutboundConfig
+}
+
+// JiraConfig opens a Jira issue per firing alert group. Summary,
+// Description, Labels and ResolveComment are Go templates rendered against
+// the notification, like message templates. When the group resolves, the
+// issue gets ResolveComment and, if set, the ResolveTransition (e.g. "Done").
+// Token is an API token used with User, or a personal access token sent as
+// a bearer token when User is empty.
+type JiraConfig struct {
+	URL               string   `toml:"url"`
+	Project           string   `toml:"project"`
+	IssueType         string   `toml:"issue_type"`
+	User              string   `toml:"user"`
+	Token             string   `toml:"token"`
+	TokenFile         string   `toml:"token_file"`
+	Summary           string   `toml:"summary"`
+	Description       string   `toml:"description"`
+	Labels            []string `toml:"labels"`
+	ResolveComment    string   `toml:"resolve_comment"`
+	ResolveTransition string   `toml:"resolve_transition"`
+}
+
+// GitHubConfig files a GitHub issue in Repo ("owner/name") for each firing
+// alert, with the alert fingerprint appended to the title. Title and Body
+// are Go templates rendered against the alert. Resolved alerts get a
+// comment and, with CloseOnResolve, their issue is closed.
+type GitHubConfig struct {
+	Repo           string   `toml:"repo"`
+	APIURL         string   `toml:"api_url"`
+	Token          string   `toml:"token"`
+	TokenFile      string   `toml:"token_file"`
+	Labels         []string `toml:"labels"`
+	Title          string   `toml:"title"`
+	Body           string   `toml:"body"`
+	CloseOnResolve bool     `toml:"close_on_resolve"`
+}
+
+func (g GitHubConfig) Validate() error {
+	if owner, name, ok := strings.Cut(g.Repo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("github repo must be owner/name, not %q", g.Repo)
+	}
+	if g.APIURL != "" && !strings.HasPrefix(g.APIURL, "https://") {
+		return fmt.Errorf("github api_url must use HTTPS")
+	}
+	if g.Token != "" && g.TokenFile != "" {
+		return fmt.Errorf("github token and token_file are mutually exclusive")
+	}
+	return nil
+}
+
+// GrafanaOnCallConfig is the URL of a Grafana OnCall AlertManager
+// integration. The URL holds the integration's token, so it can be read
+// from URLFile instead.
+type GrafanaOnCallConfig struct {
+	URL     string `toml:"url"`
+	URLFile string `toml:"url_file"`
+}
+
+func (g GrafanaOnCallConfig) Validate() error {
+	if g.URL != "" && g.URLFile != "" {
+		return fmt.Errorf("grafana_oncall url and url_file are mutually exclusive")
+	}
+	if g.URL == "" && g.URLFile == "" {
+		return fmt.Errorf("grafana_oncall url or url_file is required")
+	}
+	if g.URL != "" && !strings.HasPrefix(g.URL, "https://") {
+		return fmt.Errorf("grafana_oncall url must use HTTPS")
+	}
+	return nil
+}
+
+func (j JiraConfig) Validate() error {
+	if !strings.HasPrefix(j.URL, "https://") {
+		return fmt.Errorf("jira url must use HTTPS")
+	}
+	if j.Project == "" {
+		return fmt.Errorf("jira project is required")
+	}
+	if j.Token != "" && j.TokenFile != "" {
+		return fmt.Errorf("jira token and token_file are mutually exclusive")
+	}
+	return nil
+}
+
+// ReloadConfig enables reloading the configuration automatically when the
+// file, or a file it references, changes on disk.
+type ReloadConfig struct {
+	Watch    bool          `toml:"watch" env:"CONFIG_WATCH"`
+	Debounce time.Duration `toml:"debounce"`
+	// Confirm keeps a changed configuration pending, however it was
+	// reloaded, until it is applied through the admin API.
+	Confirm bool `toml:"confirm"`
+}
+
+// LayoutConfig orders the card sections and the widgets inside them.
+// Entries left out are not rendered; unset lists use the default layout.
+type LayoutConfig struct {
+	Sections       []string `toml:"sections"`
+	SummaryWidgets []string `toml:"summary_widgets"`
+	AlertWidgets   []string `toml:"alert_widgets"`
+	// CardsV2 emits cardsV2 payloads, which support accent colors and
+	// collapsible sections.
+	CardsV2 bool `toml:"cards_v2"`
+	// Colors maps severity label values, and "resolved", to accent colors
+	// such as "#D93025".
+	Colors map[string]string `toml:"colors"`
+	// LabelColumns renders these labels as a two-column table of names and
+	// values instead of a bullet list. "*" stands for the remaining labels
+	// in name order. Tables need cardsV2, so messages using them are sent
+	// as cardsV2.
+	LabelColumns []string `toml:"label_columns"`
+	// ChipLabels shows the values of these labels as chips in the summary,
+	// such as "severity: critical". Chips need cardsV2, so messages using
+	// them are sent as cardsV2.
+	ChipLabels []string `toml:"chip_labels"`
 }
 
 func LoadConfig(path string) (Config, error) {
 	var config Config
 
 	config.Server.ListenAddr = ":7000"
+	config.Server.IdleTimeout = 60 * time.Second
+	config.Server.WebhookSignature.Header = "X-Signature-256"
 	config.Logging.Level = "info"
+	config.Recording.Dir = "recordings"
+	config.GoogleChat.LinkAnnotationPrefix = "link_"
+	config.Delivery.RateLimit = defaultRateLimit
+	config.Delivery.Burst = 1
+	config.Delivery.RetryBackoff = time.Second
+	config.Delivery.Timeout = defaultTimeout
+	config.Delivery.BreakerCooldown = 30 * time.Second
+	config.Reload.Debounce = time.Second
+	config.Transform.Timeout = time.Second
+	config.Templates.Limits.Timeout = 2 * time.Second
+	config.Templates.Limits.JsonnetTimeout = jsonnetTimeout
+	config.Templates.Limits.MaxOutput = 64 << 10
+	config.Summary.StaleAfter = 12 * time.Hour
+	config.Updates.MaxAge = 24 * time.Hour
+	config.Server.MaxBodyBytes = defaultMaxBodyBytes
+	config.Normalize.MaxLabels = 128
+	config.Normalize.MaxAnnotations = 64
+	config.Normalize.MaxValueLength = 8 << 10
+	config.Acks.TTL = 24 * time.Hour
+	config.Pause.Mode = pauseDrop
+	config.Pause.MaxMessages = defaultPauseMaxMessages
+	config.Storm.Factor = 5
+	config.Storm.Window = 5 * time.Minute
+	config.Storm.Baseline = time.Hour
+	config.Storm.MinAlerts = 50
+	config.Outbox.MaxAge = time.Hour
+	config.Outbox.MaxBackoff = 5 * time.Minute
+	config.State.HistoryMaxAge = historyRetention
+	config.State.CompactInterval = time.Hour
+	config.State.MessageTTL = defaultMessageTTL
+	config.Report.At = "08:00"
+	config.AllClear.Period = 24 * time.Hour
+	config.SLO.NotifyTarget = 2 * time.Minute
+	config.Escalation.PagerDuty.URL = defaultPagerDutyEventsURL
+	config.Kubernetes.TokenFile = inClusterTokenFile
+	config.Kubernetes.CAFile = inClusterCAFile
+	config.Kubernetes.NamespaceLabel = "namespace"
+	config.Kubernetes.AllowedHosts = []string{"chat.googleapis.com"}
+	config.Kubernetes.Resync = 10 * time.Minute
+	config.Incidents.NamePrefix = "Incident: "
+	config.Reactions.Ack = "👀"
+	config.Reactions.Silence = "✅"
+	config.Reactions.SilenceDuration = 4 * time.Hour
+	config.OnCall.Severities = []string{"critical"}
+	config.Tracing.ServiceName = "alertmanager-to-gchat"
+	config.OTLP.Interval = time.Minute
+	config.Logging.RepeatWindow = 5 * time.Minute
+	config.Tracing.SampleRatio = 1
 
-	if _, err := os.Stat(path); err == nil {
-		if _, err := toml.DecodeFile(path, &config); err != nil {
-			return config, fmt.Errorf("failed to decode config file: %v", err)
+	if *configDir != "" {
+		if err := decodeConfigDir(path, *configDir, &config); err != nil {
+			return config, err
+		}
+	} else if _, err := os.Stat(path); err == nil {
+		if err := decodeConfig(path, &config); err != nil {
+			return config, err
 		}
 	}
 
 	if v := os.Getenv("LISTEN_ADDR"); v != "" {
 		config.Server.ListenAddr = v
 	}
+	if v := os.Getenv("ADMIN_LISTEN_ADDR"); v != "" {
+		config.Server.AdminListenAddr = v
+	}
+	if v := os.Getenv("URL_PREFIX"); v != "" {
+		config.Server.URLPrefix = v
+	}
 	if v := os.Getenv("GOOGLE_CHAT_WEBHOOK_URL"); v != "" {
 		config.GoogleChat.WebhookURL = v
 	}
+	if v := os.Getenv("WEBHOOK_SIGNATURE_SECRET"); v != "" {
+		config.Server.WebhookSignature.Secret = v
+	}
 	if v := os.Getenv("LOG_LEVEL"); v != "" {
 		config.Logging.Level = strings.ToLower(v)
 	}
+	if v := os.Getenv("RECORDING_ENABLED"); v != "" {
+		config.Recording.Enabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("CONFIG_WATCH"); v != "" {
+		config.Reload.Watch = v == "true" || v == "1"
+	}
+	if v := os.Getenv("RECORDING_DIR"); v != "" {
+		config.Recording.Dir = v
+	}
+	if v := os.Getenv("STATE_DIR"); v != "" {
+		config.State.Dir = v
+	}
+	if v := os.Getenv("TRACING_ENABLED"); v != "" {
+		config.Tracing.Enabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("OTLP_METRICS"); v != "" {
+		config.OTLP.Metrics = v == "true" || v == "1"
+	}
+	if v := os.Getenv("OTLP_LOGS"); v != "" {
+		config.OTLP.Logs = v == "true" || v == "1"
+	}
 
 	return config, nil
 }
 
+// configDirFiles returns the main config file (if present) followed by the
+// *.toml files in dir in lexical order.
+func configDirFiles(path, dir string) ([]string, error) {
+	var files []string
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	mainAbs, _ := filepath.Abs(path)
+	for _, m := range matches {
+		if abs, _ := filepath.Abs(m); abs == mainAbs {
+			continue
+		}
+		files = append(files, m)
+	}
+	return files, nil
+}
+
+// decodeConfigDir merges the main config file with every file in dir and
+// decodes the result into config. Tables are merged recursively, arrays
+// (including [[routes]] and [[silence]]) are concatenated and scalar values
+// from later files win.
+func decodeConfigDir(path, dir string, config *Config) error {
+	files, err := configDirFiles(path, dir)
+	if err != nil {
+		return fmt.Errorf("failed to list config directory: %v", err)
+	}
+
+	merged := map[string]interface{}{}
+	decrypter := &configDecrypter{}
+	for _, file := range files {
+		doc, err := decodeConfigFile(file, decrypter)
+		if err != nil {
+			return err
+		}
+		mergeTOML(merged, doc)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(merged); err != nil {
+		return fmt.Errorf("failed to merge config files: %v", err)
+	}
+	if _, err := toml.Decode(buf.String(), config); err != nil {
+		return fmt.Errorf("failed to decode merged config: %v", err)
+	}
+	return nil
+}
+
+// decodeConfig decodes the config file at path into config. Files holding
+// age encrypted data are decrypted through decodeConfigFile; others are
+// decoded as they are.
+func decodeConfig(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	if !hasAgeData(data) {
+		if _, err := toml.Decode(string(data), config); err != nil {
+			return fmt.Errorf("failed to decode config file: %v", err)
+		}
+		return nil
+	}
+
+	doc, err := decodeConfigFile(path, &configDecrypter{})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+		return fmt.Errorf("failed to decode decrypted config: %v", err)
+	}
+	if _, err := toml.Decode(buf.String(), config); err != nil {
+		return fmt.Errorf("failed to decode decrypted config: %v", err)
+	}
+	return nil
+}
+
+func mergeTOML(dst, src map[string]interface{}) {
+	for k, v := range src {
+		existing, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		switch sv := v.(type) {
+		case map[string]interface{}:
+			if dv, ok := existing.(map[string]interface{}); ok {
+				mergeTOML(dv, sv)
+				continue
+			}
+		case []map[string]interface{}:
+			if dv, ok := existing.([]map[string]interface{}); ok {
+				dst[k] = append(dv, sv...)
+				continue
+			}
+		case []interface{}:
+			if dv, ok := existing.([]interface{}); ok {
+				dst[k] = append(dv, sv...)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
 func (c *Config) Validate() error {
-	if c.GoogleChat.WebhookURL == "" {
-		return fmt.Errorf("Google Chat webhook URL is required")
+	if c.GoogleChat.Space != "" {
+		if c.GoogleChat.WebhookURL != "" {
+			return fmt.Errorf("Google Chat webhook URL and space are mutually exclusive")
+		}
+	} else {
+		if c.GoogleChat.WebhookURL == "" {
+			return fmt.Errorf("Google Chat webhook URL is required")
+		}
+
+		if _, err := url.Parse(c.GoogleChat.WebhookURL); err != nil {
+			return fmt.Errorf("invalid webhook URL format: %v", err)
+		}
+
+		if !strings.HasPrefix(c.GoogleChat.WebhookURL, "https://") {
+			return fmt.Errorf("Google Chat webhook URL must use HTTPS")
+		}
+	}
+
+	if c.GoogleChat.CredentialsFile != "" && c.GoogleChat.DefaultCredentials {
+		return fmt.Errorf("credentials_file and default_credentials are mutually exclusive")
 	}
 
-	if _, err := url.Parse(c.GoogleChat.WebhookURL); err != nil {
-		return fmt.Errorf("invalid webhook URL format: %v", err)
+	if c.GoogleChat.ThreadByGroupKey && len(c.GoogleChat.ThreadByLabels) > 0 {
+		return fmt.Errorf("thread_by_group_key and thread_by_labels are mutually exclusive")
 	}
 
-	if !strings.HasPrefix(c.GoogleChat.WebhookURL, "https://") {
-		return fmt.Errorf("Google Chat webhook URL must use HTTPS")
+	if c.GoogleChat.Space != "" && !c.GoogleChat.chatAPIEnabled() {
+		return fmt.Errorf("Google Chat space requires credentials_file or default_credentials")
+	}
+
+	if c.GoogleChat.BearerToken != "" && c.GoogleChat.BearerTokenFile != "" {
+		return fmt.Errorf("bearer_token and bearer_token_file are mutually exclusive")
+	}
+
+	if err := c.GoogleChat.TLS.Validate(); err != nil {
+		return err
+	}
+
+	if u := c.GoogleChat.DetailsURL; u != "" && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		return fmt.Errorf("details_url must be an http or https URL")
+	}
+	if c.GoogleChat.DetailsURL != "" && c.detailsURL() == "" {
+		return fmt.Errorf("details_url needs the details page on the public listener: set server.public_details, since admin_listen_addr serves it elsewhere")
 	}
 
 	if c.Server.ListenAddr == "" {
 		return fmt.Errorf("server listen address is required")
 	}
 
+	if c.Server.AdminListenAddr != "" && c.Server.AdminListenAddr == c.Server.ListenAddr {
+		return fmt.Errorf("admin listen address must differ from the server listen address")
+	}
+
+	if auth := c.Server.AdminAuth; auth.Username != "" && auth.Password == "" && auth.PasswordFile == "" {
+		return fmt.Errorf("admin auth requires a password or password_file")
+	}
+
+	if err := c.Delivery.Validate(); err != nil {
+		return fmt.Errorf("invalid delivery settings: %v", err)
+	}
+	if err := c.Templates.Limits.Validate(); err != nil {
+		return fmt.Errorf("invalid template limits: %v", err)
+	}
+
+	routeNames := map[string]bool{}
+	for i, r := range c.Routes {
+		if r.Name == "" {
+			return fmt.Errorf("route %d must have a name", i)
+		}
+		if routeNames[r.Name] {
+			return fmt.Errorf("duplicate route name: %s", r.Name)
+		}
+		routeNames[r.Name] = true
+		if r.ServeWebhook && (r.Name == "batch" || strings.Contains(r.Name, "/")) {
+			return fmt.Errorf("route %s: serve_webhook requires a name other than batch and without slashes", r.Name)
+		}
+		if slices.Contains(r.Receivers, "") {
+			return fmt.Errorf("route %s: receivers must not be empty", r.Name)
+		}
+
+		if r.WebhookURL != "" && !strings.HasPrefix(r.WebhookURL, "https://") {
+			return fmt.Errorf("route %s: webhook URL must use HTTPS", r.Name)
+		}
+		if isWebhookTemplate(r.WebhookURL) {
+			if len(r.AllowedHosts) == 0 {
+				return fmt.Errorf("route %s: a templated webhook_url requires allowed_hosts", r.Name)
+			}
+			for _, pattern := range r.AllowedHosts {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("route %s: invalid allowed_hosts pattern %q", r.Name, pattern)
+				}
+			}
+		}
+		if r.Space != "" && r.WebhookURL != "" {
+			return fmt.Errorf("route %s: webhook_url and space are mutually exclusive", r.Name)
+		}
+		if r.WebhookMap != "" && (r.Space != "" || r.WebhookURL != "") {
+			return fmt.Errorf("route %s: webhook_map cannot be combined with webhook_url or space", r.Name)
+		}
+		if r.Space != "" && !c.GoogleChat.chatAPIEnabled() {
+			return fmt.Errorf("route %s: space requires credentials_file or default_credentials in [google_chat]", r.Name)
+		}
+		if r.BearerToken != "" && r.BearerTokenFile != "" {
+			return fmt.Errorf("route %s: bearer_token and bearer_token_file are mutually exclusive", r.Name)
+		}
+		if err := validateLabelList("label_columns", r.LabelColumns); err != nil {
+			return fmt.Errorf("route %s: %v", r.Name, err)
+		}
+		if err := validateLabelList("chip_labels", r.ChipLabels); err != nil {
+			return fmt.Errorf("route %s: %v", r.Name, err)
+		}
+		if err := r.TLS.Validate(); err != nil {
+			return fmt.Errorf("route %s: %v", r.Name, err)
+		}
+		if r.Jira != nil {
+			if err := r.Jira.Validate(); err != nil {
+				return fmt.Errorf("route %s: %v", r.Name, err)
+			}
+		}
+		if r.GitHub != nil {
+			if err := r.GitHub.Validate(); err != nil {
+				return fmt.Errorf("route %s: %v", r.Name, err)
+			}
+		}
+		if r.GrafanaOnCall != nil {
+			if err := r.GrafanaOnCall.Validate(); err != nil {
+				return fmt.Errorf("route %s: %v", r.Name, err)
+			}
+		}
+		for severity, d := range r.RepeatInterval {
+			if d < 0 {
+				return fmt.Errorf("route %s: repeat_interval for %s must not be negative", r.Name, severity)
+			}
+		}
+		if err := c.Delivery.Merge(r.Delivery).Validate(); err != nil {
+			return fmt.Errorf("route %s: invalid delivery settings: %v", r.Name, err)
+		}
+		if err := c.Templates.Limits.Merge(r.TemplateLimits).Validate(); err != nil {
+			return fmt.Errorf("route %s: invalid template limits: %v", r.Name, err)
+		}
+	}
+
+	sourcePaths := map[string]bool{}
+	for _, r := range routes(nil) {
+		sourcePaths[r.path] = true
+	}
+	for _, r := range c.Routes {
+		if r.ServeWebhook {
+			sourcePaths[routeWebhookPath+r.Name] = true
+		}
+	}
+	for i, src := range c.Sources {
+		if src.Name == "" || strings.Contains(src.Name, "/") {
+			return fmt.Errorf("source %d must have a name without slashes", i)
+		}
+		if sourcePaths[src.webhookPath()] {
+			return fmt.Errorf("source %s: path %s is already in use", src.Name, src.webhookPath())
+		}
+		sourcePaths[src.webhookPath()] = true
+		if err := src.Auth.Validate(); err != nil {
+			return fmt.Errorf("source %s: %v", src.Name, err)
+		}
+		if _, ok := lookupPayloadFormat(src.Format); src.Format != "" && src.Format != formatAuto && !ok {
+			return fmt.Errorf("source %s: unknown format %q", src.Name, src.Format)
+		}
+		if len(src.Routes) == 0 && len(src.Receivers) == 0 {
+			return fmt.Errorf("source %s must be bound to routes or receivers", src.Name)
+		}
+		if slices.Contains(src.Routes, "") || slices.Contains(src.Receivers, "") {
+			return fmt.Errorf("source %s: routes and receivers must not be empty", src.Name)
+		}
+	}
+	if len(c.Sources) > 0 && !c.Server.WebhookAuth.enabled() {
+		return fmt.Errorf("sources require [server.webhook_auth], otherwise /webhook accepts the alerts their credentials protect")
+	}
+	if c.Notify.enabled() {
+		if err := c.Notify.Auth.Validate(); err != nil {
+			return fmt.Errorf("notify: %v", err)
+		}
+	}
+	if c.Server.WebhookAuth.enabled() {
+		if err := c.Server.WebhookAuth.Validate(); err != nil {
+			return fmt.Errorf("server webhook_auth: %v", err)
+		}
+	}
+	if s := c.Server.WebhookSignature; s.enabled() && s.Header == "" {
+		return fmt.Errorf("server webhook_signature requires a header")
+	}
+
+	if c.Server.RequestTimeout < 0 || c.Server.RequestTimeout >= serverWriteTimeout {
+		return fmt.Errorf("server request_timeout must be between 0 and %s", serverWriteTimeout)
+	}
+
+	if c.Server.MaxConcurrentStreams < 0 || c.Server.MaxHeaderBytes < 0 || c.Server.MaxBodyBytes < 0 || c.Server.IdleTimeout < 0 {
+		return fmt.Errorf("server max_concurrent_streams, max_header_bytes, max_body_bytes and idle_timeout must not be negative")
+	}
+
+	if _, err := parseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("server trusted_proxies: %v", err)
+	}
+
+	if c.Deadlines.Enrichment < 0 || c.Deadlines.Send < 0 {
+		return fmt.Errorf("deadlines must not be negative")
+	}
+
+	enrichments := map[string]bool{"oncall": true}
+	for i, e := range c.Enrichments {
+		if e.Name == "" || enrichments[e.Name] {
+			return fmt.Errorf("enrichment %d must have a unique name other than oncall", i)
+		}
+		enrichments[e.Name] = true
+		if e.OnFailure != "" && e.OnFailure != enrichSkip && e.OnFailure != enrichAnnotate {
+			return fmt.Errorf("enrichment %s: on_failure must be skip or annotate", e.Name)
+		}
+		if e.Timeout < 0 || e.Expires < 0 {
+			return fmt.Errorf("enrichment %s: timeout and expires must not be negative", e.Name)
+		}
+		if e.URL == "" {
+			return fmt.Errorf("enrichment %s: url is required", e.Name)
+		}
+		if e.Type == enrichPrometheus && e.Query == "" {
+			return fmt.Errorf("enrichment %s: query is required", e.Name)
+		}
+		if e.Type == enrichGrafanaSnapshot && e.DashboardUID == "" {
+			return fmt.Errorf("enrichment %s: dashboard_uid is required", e.Name)
+		}
+		if _, err := newEnricher(e); err != nil {
+			return fmt.Errorf("enrichment %s: %v", e.Name, err)
+		}
+	}
+
+	if c.OTLP.Metrics && c.OTLP.Interval <= 0 {
+		return fmt.Errorf("otlp interval must be positive")
+	}
+	if c.OTLP.Endpoint != "" {
+		if u, err := url.Parse(c.OTLP.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("otlp endpoint must be an http or https URL")
+		}
+	}
+	switch c.OTLP.Compression {
+	case "", otlpGzip, otlpNone:
+	default:
+		return fmt.Errorf("otlp compression must be %q or %q", otlpGzip, otlpNone)
+	}
+	if err := c.OTLP.TLS.Validate(); err != nil {
+		return fmt.Errorf("otlp %v", err)
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample_ratio must be between 0 and 1")
+	}
+
+	if c.DNS.CacheTTL < 0 {
+		return fmt.Errorf("dns cache_ttl must not be negative")
+	}
+	if c.DNS.Prefer != "" && c.DNS.Prefer != "ipv4" && c.DNS.Prefer != "ipv6" {
+		return fmt.Errorf("dns prefer must be ipv4 or ipv6, not %q", c.DNS.Prefer)
+	}
+	if err := c.Egress.Validate(); err != nil {
+		return fmt.Errorf("invalid egress settings: %v", err)
+	}
+
+	if c.Transform.Script != "" && c.Transform.Timeout <= 0 {
+		return fmt.Errorf("transform timeout must be positive")
+	}
+
+	if c.Summary.Interval < 0 || c.Summary.StaleAfter < 0 {
+		return fmt.Errorf("summary durations must not be negative")
+	}
+
+	if c.Updates.Enabled && c.Updates.MaxAge <= 0 {
+		return fmt.Errorf("updates max_age must be positive")
+	}
+
+	if c.Storm.Enabled {
+		if c.Storm.Factor <= 1 {
+			return fmt.Errorf("storm factor must be greater than 1")
+		}
+		if c.Storm.Window < time.Minute || c.Storm.Baseline < c.Storm.Window {
+			return fmt.Errorf("storm window must be at least 1m and baseline at least the window")
+		}
+		if c.Storm.MinAlerts < 1 {
+			return fmt.Errorf("storm min_alerts must be positive")
+		}
+	}
+
+	if c.Outbox.MaxAge < 0 {
+		return fmt.Errorf("outbox max_age must not be negative")
+	}
+	if c.Outbox.MaxMessages < 0 {
+		return fmt.Errorf("outbox max_messages must not be negative")
+	}
+	if c.Outbox.Enabled && c.Outbox.MaxBackoff <= 0 {
+		return fmt.Errorf("outbox max_backoff must be positive")
+	}
+	if c.Outbox.Enabled && c.State.Dir == "" {
+		return fmt.Errorf("the outbox requires a [state] dir, so acknowledged messages survive a crash")
+	}
+	switch c.Pause.Mode {
+	case "", pauseDrop:
+	case pauseBuffer:
+		if !c.Outbox.Enabled {
+			return fmt.Errorf("pause mode buffer requires the outbox to be enabled")
+		}
+	default:
+		return fmt.Errorf("pause mode must be drop or buffer, got %q", c.Pause.Mode)
+	}
+	if c.Pause.MaxMessages < 0 {
+		return fmt.Errorf("pause max_messages must not be negative")
+	}
+
+	if c.Acks.TTL < 0 {
+		return fmt.Errorf("acks ttl must not be negative")
+	}
+
+	if c.State.HistoryMaxAge <= 0 || c.State.CompactInterval <= 0 || c.State.HistoryMaxBytes < 0 {
+		return fmt.Errorf("state history_max_age and compact_interval must be positive and history_max_bytes must not be negative")
+	}
+	if c.State.MessageTTL <= 0 {
+		return fmt.Errorf("state message_ttl must be positive")
+	}
+
+	if c.Report.Schedule != "" {
+		if _, err := NewReportSchedule(c.Report); err != nil {
+			return fmt.Errorf("invalid report: %v", err)
+		}
+		if c.Report.Schedule == "weekly" && c.State.HistoryMaxAge < 7*24*time.Hour {
+			return fmt.Errorf("state history_max_age must be at least 168h for weekly reports")
+		}
+	}
+	if c.AllClear.Schedule != "" {
+		if _, err := NewAllClearSchedule(c.AllClear); err != nil {
+			return fmt.Errorf("invalid all_clear: %v", err)
+		}
+		if c.AllClear.Period <= 0 || c.AllClear.Period > c.State.HistoryMaxAge {
+			return fmt.Errorf("all_clear period must be positive and at most state history_max_age")
+		}
+		if c.AllClear.Route != "" && !routeNames[c.AllClear.Route] {
+			return fmt.Errorf("all_clear route %s does not exist", c.AllClear.Route)
+		}
+	}
+	if err := c.Escalation.Validate(c.Email); err != nil {
+		return fmt.Errorf("invalid escalation: %v", err)
+	}
+	if c.Kubernetes.Enabled {
+		if c.Kubernetes.NamespaceLabel == "" || len(c.Kubernetes.AllowedHosts) == 0 {
+			return fmt.Errorf("kubernetes requires namespace_label and allowed_hosts")
+		}
+		if c.Kubernetes.Resync < time.Second {
+			return fmt.Errorf("kubernetes resync must be at least 1s")
+		}
+		for _, pattern := range c.Kubernetes.AllowedSpaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("kubernetes: invalid allowed_spaces pattern %q", pattern)
+			}
+		}
+	}
+	if c.Heartbeat.MaxSilence < 0 {
+		return fmt.Errorf("heartbeat max_silence must not be negative")
+	}
+	if c.Heartbeat.Route != "" && !routeNames[c.Heartbeat.Route] {
+		return fmt.Errorf("heartbeat route %s does not exist", c.Heartbeat.Route)
+	}
+	loc, err := c.Scheduler.location()
+	if err != nil {
+		return fmt.Errorf("invalid scheduler: %v", err)
+	}
+	for name, expr := range c.Scheduler.Jobs {
+		if !slices.Contains(jobNames, name) {
+			return fmt.Errorf("invalid scheduler: unknown job %s, must be one of %s", name, strings.Join(jobNames, ", "))
+		}
+		if _, err := parseJobSchedule(expr, loc); err != nil {
+			return fmt.Errorf("invalid scheduler: job %s: %v", name, err)
+		}
+	}
+	if c.SLO.NotifyTarget <= 0 || c.SLO.FooterAfter < 0 {
+		return fmt.Errorf("slo notify_target must be positive and footer_after must not be negative")
+	}
+	if c.Report.Schedule != "" || len(c.Report.To) > 0 {
+		if len(c.Report.To) == 0 {
+			return fmt.Errorf("report requires at least one recipient in to")
+		}
+		if c.Email.Smarthost == "" || c.Email.From == "" {
+			return fmt.Errorf("report requires smarthost and from in [email]")
+		}
+	}
+	if c.Email.Smarthost != "" {
+		if _, _, err := net.SplitHostPort(c.Email.Smarthost); err != nil {
+			return fmt.Errorf("email smarthost must be host:port: %v", err)
+		}
+		if c.Email.Password != "" && c.Email.PasswordFile != "" {
+			return fmt.Errorf("email password and password_file are mutually exclusive")
+		}
+	}
+
+	if c.Incidents.Enabled {
+		if len(c.Incidents.Matchers) == 0 {
+			return fmt.Errorf("incidents must have at least one matcher")
+		}
+		if !c.GoogleChat.chatAPIEnabled() {
+			return fmt.Errorf("incidents require credentials_file or default_credentials in [google_chat]")
+		}
+	}
+
+	if c.Reactions.Enabled {
+		if c.Reactions.Token != "" && c.Reactions.TokenFile != "" {
+			return fmt.Errorf("reactions: token and token_file are mutually exclusive")
+		}
+		if c.Reactions.Token == "" && c.Reactions.TokenFile == "" {
+			return fmt.Errorf("reactions require a token or token_file")
+		}
+		if c.Reactions.SilenceDuration <= 0 {
+			return fmt.Errorf("reactions silence_duration must be positive")
+		}
+	}
+
+	if c.Idempotency.Window < 0 {
+		return fmt.Errorf("idempotency window must not be negative")
+	}
+	if c.Coalesce.Window < 0 {
+		return fmt.Errorf("coalesce window must not be negative")
+	}
+
+	if err := c.Layout.Validate(); err != nil {
+		return fmt.Errorf("invalid layout: %v", err)
+	}
+
+	if c.Recording.Enabled && c.Recording.Dir == "" {
+		return fmt.Errorf("recording directory is required when recording is enabled")
+	}
+
 	validLogLevels := map[string]bool{
 		LogLevelDebug: true,
 		LogLevelInfo:  true,
@@ -78,6 +1794,9 @@ func (c *Config) Validate() error {
 	if !validLogLevels[strings.ToLower(c.Logging.Level)] {
 		return fmt.Errorf("invalid log level: %s", c.Logging.Level)
 	}
+	if c.Logging.RepeatWindow < 0 {
+		return fmt.Errorf("logging repeat_window must not be negative")
+	}
 
 	return nil
 }
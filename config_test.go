@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(confd, 0o755); err != nil {
+		t.Fatalf("Failed to create conf.d: %v", err)
+	}
+
+	files := map[string]string{
+		filepath.Join(dir, "config.toml"): `
+[google_chat]
+webhook_url = "https://chat.example.com/default"
+
+[delivery]
+max_retries = 1
+
+[[routes]]
+name = "base"
+matchers = ['team="base"']
+`,
+		filepath.Join(confd, "20-db.toml"): `
+[[routes]]
+name = "db"
+matchers = ['team="db"']
+
+[delivery]
+timeout = "5s"
+`,
+		filepath.Join(confd, "10-web.toml"): `
+[[routes]]
+name = "web"
+matchers = ['team="web"']
+
+[[silence]]
+matchers = ['alertname="Noisy"']
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	old := *configDir
+	*configDir = confd
+	defer func() { *configDir = old }()
+
+	cfg, err := LoadConfig(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	var names []string
+	for _, r := range cfg.Routes {
+		names = append(names, r.Name)
+	}
+	if len(names) != 3 || names[0] != "base" || names[1] != "web" || names[2] != "db" {
+		t.Errorf("Expected routes merged in file order [base web db], got %v", names)
+	}
+	if len(cfg.Silences) != 1 {
+		t.Errorf("Expected 1 silence, got %d", len(cfg.Silences))
+	}
+	if cfg.Delivery.MaxRetries != 1 || cfg.Delivery.Timeout != 5*time.Second {
+		t.Errorf("Expected delivery tables to be merged, got %+v", cfg.Delivery)
+	}
+	if cfg.Delivery.Burst != 1 {
+		t.Errorf("Expected defaults to be kept, got burst %d", cfg.Delivery.Burst)
+	}
+	if cfg.GoogleChat.WebhookURL != "https://chat.example.com/default" {
+		t.Errorf("Unexpected webhook URL %s", cfg.GoogleChat.WebhookURL)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	base, err := LoadConfig(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	base.GoogleChat.WebhookURL = "https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t"
+
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{name: "defaults", modify: func(c *Config) {}},
+		{
+			name:    "outbox without state dir",
+			modify:  func(c *Config) { c.Outbox.Enabled = true },
+			wantErr: "requires a [state] dir",
+		},
+		{
+			name:   "outbox with state dir",
+			modify: func(c *Config) { c.Outbox.Enabled, c.State.Dir = true, t.TempDir() },
+		},
+		{
+			name:    "unknown otlp compression",
+			modify:  func(c *Config) { c.OTLP.Compression = "zstd" },
+			wantErr: "otlp compression",
+		},
+		{
+			name: "details page on admin listener",
+			modify: func(c *Config) {
+				c.GoogleChat.DetailsURL, c.Server.AdminListenAddr = "https://a2g.example.com", ":9000"
+			},
+			wantErr: "server.public_details",
+		},
+		{
+			name: "public details page",
+			modify: func(c *Config) {
+				c.GoogleChat.DetailsURL, c.Server.AdminListenAddr, c.Server.PublicDetails = "https://a2g.example.com", ":9000", true
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
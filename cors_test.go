@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithCORS(t *testing.T) {
+	cfg := CORSConfig{
+		AllowedOrigins: []string{"https://dashboard.example.com"},
+		MaxAge:         600,
+	}
+	handler := withCORS(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		preflight      bool
+		expectedStatus int
+		expectedOrigin string
+	}{
+		{
+			name:           "allowed origin",
+			method:         http.MethodGet,
+			origin:         "https://dashboard.example.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "https://dashboard.example.com",
+		},
+		{
+			name:           "disallowed origin",
+			method:         http.MethodGet,
+			origin:         "https://evil.example.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "",
+		},
+		{
+			name:           "preflight",
+			method:         http.MethodOptions,
+			origin:         "https://dashboard.example.com",
+			preflight:      true,
+			expectedStatus: http.StatusNoContent,
+			expectedOrigin: "https://dashboard.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/openapi.json", nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+			if tt.preflight && w.Header().Get("Access-Control-Max-Age") != "600" {
+				t.Error("Expected Access-Control-Max-Age on preflight response")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxCoverageLabelSets bounds the label sets posted to the coverage API.
+const maxCoverageLabelSets = 10000
+
+// RoutingCoverage reports which routes a list of alert label sets would be
+// sent to, so routing gaps show up before alerts land in the wrong space.
+type RoutingCoverage struct {
+	// Alerts lists each distinct label set, unmatched ones first.
+	Alerts []AlertCoverage `json:"alerts"`
+	// Routes lists every route with the number of label sets it matches,
+	// including routes nothing matches.
+	Routes []RouteCoverage `json:"routes"`
+	// Unmatched counts the label sets matching no route, which only the
+	// default route receives.
+	Unmatched int `json:"unmatched"`
+}
+
+type AlertCoverage struct {
+	Labels   KV     `json:"labels"`
+	Receiver string `json:"receiver,omitempty"`
+	// Count is how often the label set was seen: notifications in the
+	// history, or repeats in the request.
+	Count   int      `json:"count"`
+	Routes  []string `json:"routes"`
+	Matched bool     `json:"matched"`
+}
+
+type RouteCoverage struct {
+	Route  string `json:"route"`
+	Alerts int    `json:"alerts"`
+}
+
+// coverageSet is a label set to route, with the receiver of its
+// notification when known. It is posted either as a plain label set or as
+// an object with "labels" and "receiver"; label values are strings, so an
+// object under "labels" cannot be a label.
+type coverageSet struct {
+	Labels   KV     `json:"labels"`
+	Receiver string `json:"receiver,omitempty"`
+}
+
+func (s *coverageSet) UnmarshalJSON(data []byte) error {
+	var set struct {
+		Labels   KV     `json:"labels"`
+		Receiver string `json:"receiver"`
+	}
+	if err := json.Unmarshal(data, &set); err == nil && set.Labels != nil {
+		*s = coverageSet(set)
+		return nil
+	}
+	*s = coverageSet{}
+	return json.Unmarshal(data, &s.Labels)
+}
+
+// routingCoverage routes each distinct label set and receiver in sets
+// through rt.
+func routingCoverage(rt *Runtime, sets []coverageSet) RoutingCoverage {
+	index := map[string]int{}
+	report := RoutingCoverage{Alerts: []AlertCoverage{}}
+	for _, set := range sets {
+		key := labelFingerprint(set.Labels) + "\x00" + set.Receiver
+		if i, ok := index[key]; ok {
+			report.Alerts[i].Count++
+			continue
+		}
+		index[key] = len(report.Alerts)
+		report.Alerts = append(report.Alerts, AlertCoverage{Labels: set.Labels, Receiver: set.Receiver, Count: 1})
+	}
+
+	matches := map[string]int{}
+	for i := range report.Alerts {
+		alert := &report.Alerts[i]
+		payload := labelsPayload(alert.Labels)
+		payload.Receiver = alert.Receiver
+		for _, route := range rt.MatchingRoutes(payload) {
+			alert.Routes = append(alert.Routes, route.Name)
+			matches[route.Name]++
+			if route.Name != defaultRouteName {
+				alert.Matched = true
+			}
+		}
+		if !alert.Matched {
+			report.Unmatched++
+		}
+	}
+	sort.SliceStable(report.Alerts, func(i, j int) bool {
+		a, b := report.Alerts[i], report.Alerts[j]
+		if a.Matched != b.Matched {
+			return !a.Matched
+		}
+		return a.Count > b.Count
+	})
+
+	for _, route := range rt.routes() {
+		report.Routes = append(report.Routes, RouteCoverage{Route: route.Name, Alerts: matches[route.Name]})
+	}
+	report.Routes = append(report.Routes, RouteCoverage{Route: defaultRouteName, Alerts: matches[defaultRouteName]})
+	return report
+}
+
+// routingCoverageHandler serves /api/v1/routing/coverage. GET checks the
+// label sets and receivers of the alerts notified within since (default
+// 24h), and POST the label sets in the body.
+func routingCoverageHandler(w http.ResponseWriter, r *http.Request) {
+	var sets []coverageSet
+	switch r.Method {
+	case http.MethodGet:
+		since := 24 * time.Hour
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = time.ParseDuration(v); err != nil || since <= 0 {
+				http.Error(w, "Invalid since, must be a positive duration", http.StatusBadRequest)
+				return
+			}
+		}
+		now := clock.Now()
+		for _, entry := range history.Between(now.Add(-since), now) {
+			sets = append(sets, coverageSet{Labels: entry.Labels, Receiver: entry.Receiver})
+		}
+	case http.MethodPost:
+		var body struct {
+			Labels []coverageSet `json:"labels"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&body); err != nil || len(body.Labels) == 0 {
+			http.Error(w, "Body must be a JSON object with a list of label sets", http.StatusBadRequest)
+			return
+		}
+		if len(body.Labels) > maxCoverageLabelSets {
+			http.Error(w, "Too many label sets", http.StatusRequestEntityTooLarge)
+			return
+		}
+		sets = body.Labels
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(routingCoverage(getRuntime(), sets))
+}
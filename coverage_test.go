@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoutingCoverageHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	rt, err := NewRuntime(Config{Routes: []RouteConfig{
+		{Name: "audit", Matchers: []string{`severity="critical"`}, Continue: true},
+		{Name: "db", Matchers: []string{`team="db"`}},
+		{Name: "legacy", Matchers: []string{`team="mainframe"`}},
+		{Name: "pager", Receivers: []string{"pager"}},
+	}})
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+	currentRuntime.Store(rt)
+
+	now := time.Now()
+	defer func() { history = NewHistory("") }()
+	history = NewHistory("")
+	for _, labels := range []KV{
+		{"alertname": "DiskFull", "team": "db", "severity": "critical"},
+		{"alertname": "DiskFull", "team": "db", "severity": "critical"},
+		{"alertname": "HighCPU", "team": "web"},
+	} {
+		history.Record("req", "", labelsPayload(labels), now.Add(-time.Hour))
+	}
+	paged := labelsPayload(KV{"alertname": "HighCPU", "team": "web"})
+	paged.Receiver = "pager"
+	history.Record("req", "", paged, now.Add(-time.Hour))
+	history.Record("req", "", labelsPayload(KV{"alertname": "Old", "team": "web"}), now.Add(-48*time.Hour))
+
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		body          string
+		wantCode      int
+		wantAlerts    string
+		wantRoutes    string
+		wantUnmatched int
+	}{
+		{
+			name:          "history",
+			method:        http.MethodGet,
+			target:        "/api/v1/routing/coverage",
+			wantCode:      http.StatusOK,
+			wantAlerts:    "HighCPU:default x1,DiskFull:audit+db x2,HighCPU:pager x1",
+			wantRoutes:    "audit=1,db=1,legacy=0,pager=1,default=1",
+			wantUnmatched: 1,
+		},
+		{
+			name:          "label sets",
+			method:        http.MethodPost,
+			target:        "/api/v1/routing/coverage",
+			body:          `{"labels":[{"alertname":"Backup","team":"db"},{"alertname":"Batch","team":"mainframe","severity":"critical"},{"receiver":"pager","labels":{"alertname":"Nightly","team":"web"}},{"alertname":"Relabel","receiver":"pager","team":"web"}]}`,
+			wantCode:      http.StatusOK,
+			wantAlerts:    "Relabel:default x1,Backup:db x1,Batch:audit+legacy x1,Nightly:pager x1",
+			wantRoutes:    "audit=1,db=1,legacy=1,pager=1,default=1",
+			wantUnmatched: 1,
+		},
+		{name: "bad since", method: http.MethodGet, target: "/api/v1/routing/coverage?since=-1h", wantCode: http.StatusBadRequest},
+		{name: "empty body", method: http.MethodPost, target: "/api/v1/routing/coverage", body: `{"labels":[]}`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routingCoverageHandler(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var report RoutingCoverage
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			var alerts, routes []string
+			for _, a := range report.Alerts {
+				alerts = append(alerts, a.Labels["alertname"]+":"+strings.Join(a.Routes, "+")+" x"+strconv.Itoa(a.Count))
+			}
+			for _, r := range report.Routes {
+				routes = append(routes, r.Route+"="+strconv.Itoa(r.Alerts))
+			}
+			if got := strings.Join(alerts, ","); got != tt.wantAlerts {
+				t.Errorf("alerts = %s, want %s", got, tt.wantAlerts)
+			}
+			if got := strings.Join(routes, ","); got != tt.wantRoutes {
+				t.Errorf("routes = %s, want %s", got, tt.wantRoutes)
+			}
+			if report.Unmatched != tt.wantUnmatched {
+				t.Errorf("unmatched = %d, want %d", report.Unmatched, tt.wantUnmatched)
+			}
+		})
+	}
+}
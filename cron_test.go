@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleLast(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		loc  *time.Location
+		now  string
+		want string
+	}{
+		{"0 9 * * *", time.UTC, "2024-05-15T09:30:00Z", "2024-05-15T09:00:00Z"},
+		{"0 9 * * *", time.UTC, "2024-05-15T08:59:00Z", "2024-05-14T09:00:00Z"},
+		{"*/15 * * * *", time.UTC, "2024-05-15T09:44:59Z", "2024-05-15T09:30:00Z"},
+		{"0 9 * * mon-fri", time.UTC, "2024-05-19T12:00:00Z", "2024-05-17T09:00:00Z"},
+		{"30 8,17 * * *", time.UTC, "2024-05-15T12:00:00Z", "2024-05-15T08:30:00Z"},
+		{"0 0 1 jan *", time.UTC, "2024-05-15T12:00:00Z", "2024-01-01T00:00:00Z"},
+		{"0 0 29 2 *", time.UTC, "2025-05-15T12:00:00Z", "2024-02-29T00:00:00Z"},
+		// Either day field matches when both are restricted.
+		{"0 0 13 * 5", time.UTC, "2024-05-15T12:00:00Z", "2024-05-13T00:00:00Z"},
+		{"0 0 * * 7", time.UTC, "2024-05-15T12:00:00Z", "2024-05-12T00:00:00Z"},
+		{"@weekly", time.UTC, "2024-05-15T12:00:00Z", "2024-05-12T00:00:00Z"},
+		{"@daily", berlin, "2024-05-15T12:00:00Z", "2024-05-14T22:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCron(tt.expr, tt.loc)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+			now, _ := time.Parse(time.RFC3339, tt.now)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if got := s.Last(now); !got.Equal(want) {
+				t.Errorf("Last(%s) = %v, want %v", tt.now, got, want)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "0 9 * *", "60 * * * *", "0 9 * * someday", "0 9 5-1 * *", "*/0 * * * *", "0 0 31 2 *"} {
+		if _, err := ParseCron(expr, time.UTC); err == nil {
+			t.Errorf("ParseCron(%q) error = nil, want an error", expr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		now  string
+		want string
+	}{
+		{"0 9 * * *", "2024-05-15T08:59:00Z", "2024-05-15T09:00:00Z"},
+		{"0 9 * * *", "2024-05-15T09:00:00Z", "2024-05-16T09:00:00Z"},
+		{"*/15 * * * *", "2024-05-15T09:44:59Z", "2024-05-15T09:45:00Z"},
+		{"0 9 * * mon-fri", "2024-05-17T12:00:00Z", "2024-05-20T09:00:00Z"},
+		{"0 0 1 jan *", "2024-05-15T12:00:00Z", "2025-01-01T00:00:00Z"},
+		{"0 0 29 2 *", "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCron(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+			now, _ := time.Parse(time.RFC3339, tt.now)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if got := s.Next(now); !got.Equal(want) {
+				t.Errorf("Next(%s) = %v, want %v", tt.now, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ctlOutputSimple = "simple"
+	ctlOutputJSON   = "json"
+
+	// ctlTimeFormat is how the ctl subcommand prints times, like amtool.
+	ctlTimeFormat = "2006-01-02 15:04:05 MST"
+)
+
+// ctlClient calls the admin API of a running bridge for the ctl subcommand.
+type ctlClient struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// do sends a request with body, when not nil, encoded as JSON, and decodes
+// the JSON response into v. A response other than 2xx is an error carrying
+// the status and body.
+func (c *ctlClient) do(method, path string, body, v interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.baseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, v)
+}
+
+// runCtl implements the ctl subcommand, a small amtool-style client for the
+// admin API of a running bridge. It returns the exit code: 0 on success, 1
+// when a request fails and 2 on a usage error.
+func runCtl(args []string, stdout io.Writer) int {
+	defaultURL := os.Getenv("ALERTMANAGER_TO_GCHAT_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:7000"
+	}
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	baseURL := fs.String("url", defaultURL, "Base URL of the bridge's admin API (env ALERTMANAGER_TO_GCHAT_URL)")
+	username := fs.String("username", os.Getenv("ALERTMANAGER_TO_GCHAT_USERNAME"), "Admin basic auth username (env ALERTMANAGER_TO_GCHAT_USERNAME)")
+	passwordFile := fs.String("password-file", "", "File holding the admin password, instead of env ALERTMANAGER_TO_GCHAT_PASSWORD")
+	output := fs.String("output", ctlOutputSimple, "Output format: simple or json")
+	timeout := fs.Duration("timeout", 30*time.Second, "Timeout of each request")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ctl [flags] <command>\n\nCommands:\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  routes test <label=value>...   Show the route an alert with these labels takes\n")
+		fmt.Fprintf(fs.Output(), "  alerts list                    List firing alerts\n")
+		fmt.Fprintf(fs.Output(), "  history query [flags]          List delivered alerts\n")
+		fmt.Fprintf(fs.Output(), "  dlq list [--limit n]           List failed deliveries\n")
+		fmt.Fprintf(fs.Output(), "  dlq replay <id>... | --all     Resend failed deliveries\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != ctlOutputSimple && *output != ctlOutputJSON {
+		fmt.Fprintf(os.Stderr, "Invalid output %q, must be simple or json\n", *output)
+		return 2
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return 2
+	}
+	password, err := secretValue(os.Getenv("ALERTMANAGER_TO_GCHAT_PASSWORD"), *passwordFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading password file: %v\n", err)
+		return 1
+	}
+
+	c := &ctl{
+		client: &ctlClient{baseURL: *baseURL, username: *username, password: password, client: &http.Client{Timeout: *timeout}},
+		out:    stdout,
+		json:   *output == ctlOutputJSON,
+	}
+	command, rest := fs.Arg(0)+" "+fs.Arg(1), fs.Args()[2:]
+	switch command {
+	case "routes test":
+		return c.routesTest(rest)
+	case "alerts list":
+		return c.alertsList(rest)
+	case "history query":
+		return c.historyQuery(rest)
+	case "dlq list":
+		return c.dlqList(rest)
+	case "dlq replay":
+		return c.dlqReplay(rest)
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n", command)
+	fs.Usage()
+	return 2
+}
+
+// ctl runs one ctl command and prints its result.
+type ctl struct {
+	client *ctlClient
+	out    io.Writer
+	json   bool
+}
+
+// print writes v as indented JSON, or calls simple to write it as text.
+func (c *ctl) print(v interface{}, simple func(w *tabwriter.Writer)) int {
+	if c.json {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return 0
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	simple(w)
+	w.Flush()
+	return 0
+}
+
+func (c *ctl) fail(err error) int {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return 1
+}
+
+func (c *ctl) routesTest(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s ctl routes test <label=value>...\n", os.Args[0])
+		return 2
+	}
+	labels := KV{}
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			fmt.Fprintf(os.Stderr, "Invalid label %q, must be name=value\n", arg)
+			return 2
+		}
+		labels[name] = strings.Trim(value, `"`)
+	}
+
+	var result RouteTest
+	if err := c.client.do(http.MethodPost, "/api/v1/routes/test", map[string]KV{"labels": labels}, &result); err != nil {
+		return c.fail(err)
+	}
+	return c.print(result, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, result.Destination)
+	})
+}
+
+func (c *ctl) alertsList(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s ctl alerts list\n", os.Args[0])
+		return 2
+	}
+	var alerts []aggregatedAlert
+	if err := c.client.do(http.MethodGet, "/api/alerts", nil, &alerts); err != nil {
+		return c.fail(err)
+	}
+	return c.print(alerts, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "Alertname\tStarts At\tReceiver\tSummary")
+		for _, alert := range alerts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", alert.Labels["alertname"], alert.StartsAt.Local().Format(ctlTimeFormat), alert.Receiver, alert.Annotations["summary"])
+		}
+	})
+}
+
+func (c *ctl) historyQuery(args []string) int {
+	fs := flag.NewFlagSet("history query", flag.ContinueOnError)
+	since := fs.String("since", "", "Length of the period to query, e.g. 6h (default 24h)")
+	from := fs.String("from", "", "Start of the period, RFC 3339, instead of --since")
+	to := fs.String("to", "", "End of the period, RFC 3339 (default now)")
+	alertname := fs.String("alertname", "", "Only list alerts with this name")
+	status := fs.String("status", "", "Only list firing or resolved alerts")
+	route := fs.String("route", "", "Only list alerts delivered through this route")
+	limit := fs.Int("limit", 0, "Number of entries to list (default 100)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ctl history query [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	query := url.Values{}
+	for name, value := range map[string]string{"since": *since, "from": *from, "to": *to, "alertname": *alertname, "status": *status, "route": *route} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if *limit > 0 {
+		query.Set("limit", strconv.Itoa(*limit))
+	}
+	var entries []HistoryEntry
+	if err := c.client.do(http.MethodGet, "/api/v1/history?"+query.Encode(), nil, &entries); err != nil {
+		return c.fail(err)
+	}
+	return c.print(entries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "At\tStatus\tAlertname\tRoute\tLabels")
+		for _, entry := range entries {
+			labels := KV{}
+			for name, value := range entry.Labels {
+				if name != "alertname" {
+					labels[name] = value
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.At.Local().Format(ctlTimeFormat), entry.Status, entry.Alertname, entry.Route, labels.SortedPairs())
+		}
+	})
+}
+
+// failedDeliveries lists up to limit failed deliveries, newest first.
+func (c *ctl) failedDeliveries(limit int) ([]DeliverySummary, error) {
+	var failed []DeliverySummary
+	err := c.client.do(http.MethodGet, fmt.Sprintf("/api/v1/deliveries/?status=%s&limit=%d", deliveryFailed, limit), nil, &failed)
+	return failed, err
+}
+
+func (c *ctl) dlqList(args []string) int {
+	fs := flag.NewFlagSet("dlq list", flag.ContinueOnError)
+	limit := fs.Int("limit", 50, "Number of failed deliveries to list")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	failed, err := c.failedDeliveries(*limit)
+	if err != nil {
+		return c.fail(err)
+	}
+	return c.print(failed, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tRoute\tAttempts\tLast Try\tLast Error")
+		for _, d := range failed {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", d.ID, d.Route, d.Attempts, d.LastTry.Local().Format(ctlTimeFormat), d.LastError)
+		}
+	})
+}
+
+func (c *ctl) dlqReplay(args []string) int {
+	fs := flag.NewFlagSet("dlq replay", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Replay every failed delivery")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ctl dlq replay <id>... | --all\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	ids := fs.Args()
+	if *all == (len(ids) > 0) {
+		fs.Usage()
+		return 2
+	}
+	if *all {
+		failed, err := c.failedDeliveries(maxDeliveryRecords)
+		if err != nil {
+			return c.fail(err)
+		}
+		// Replay the oldest first, so messages arrive in their original order.
+		for i := len(failed) - 1; i >= 0; i-- {
+			ids = append(ids, failed[i].ID)
+		}
+	}
+
+	code := 0
+	replayed := []DeliveryRecord{}
+	for _, id := range ids {
+		var record DeliveryRecord
+		if err := c.client.do(http.MethodPost, "/api/v1/deliveries/"+url.PathEscape(id)+"/replay", nil, &record); err != nil {
+			fmt.Fprintf(os.Stderr, "Error replaying %s: %v\n", id, err)
+			code = 1
+			continue
+		}
+		replayed = append(replayed, record)
+	}
+	c.print(replayed, func(w *tabwriter.Writer) {
+		for _, record := range replayed {
+			fmt.Fprintf(w, "Replayed %s\n", record.ID)
+		}
+	})
+	return code
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCtl(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	matchers, err := ParseMatchers([]string{`team="db"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewMockProvider(false)
+	currentRuntime.Store(&Runtime{
+		Routes:       []*Route{{Name: "db", Matchers: matchers}},
+		DefaultRoute: &Route{Name: defaultRouteName},
+		Provider:     provider,
+	})
+	defer currentRuntime.Store(nil)
+
+	savedDeliveries := deliveries
+	defer func() { deliveries = savedDeliveries }()
+	deliveries = NewDeliveryLog(10)
+	deliveries.Record(SendOptions{ReqID: "req-1", Route: "db", Attempt: 1}, &GoogleChatMessage{Text: "disk full"}, time.Now(), errors.New("connection refused"))
+	deliveries.Record(SendOptions{ReqID: "req-2", Route: "db", Attempt: 1}, &GoogleChatMessage{Text: "disk ok"}, time.Now(), nil)
+
+	defer func() { history = NewHistory("") }()
+	history = NewHistory("")
+	history.Record("req-2", "db", &AlertManagerPayload{Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "DiskFull", "team": "db"}}}}, time.Now())
+	history.Record("req-3", "default", &AlertManagerPayload{Alerts: Alerts{{Status: "resolved", Labels: KV{"alertname": "Other"}}}}, time.Now())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/alerts", firingAlertsHandler)
+	mux.HandleFunc("/api/v1/routes/test", routeTestHandler)
+	mux.HandleFunc("/api/v1/history", historyHandler)
+	mux.HandleFunc("/api/v1/deliveries/", deliveriesHandler)
+	server := httptest.NewServer(withBasicAuth(BasicAuthConfig{Username: "admin", Password: "secret"}, mux))
+	defer server.Close()
+	t.Setenv("ALERTMANAGER_TO_GCHAT_URL", server.URL)
+	t.Setenv("ALERTMANAGER_TO_GCHAT_USERNAME", "admin")
+	t.Setenv("ALERTMANAGER_TO_GCHAT_PASSWORD", "secret")
+
+	tests := []struct {
+		args     []string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{args: []string{"routes", "test", "team=db"}, want: []string{"db\n"}},
+		{args: []string{"routes", "test", "team=web"}, want: []string{"default\n"}},
+		{args: []string{"-output", "json", "routes", "test", "team=db"}, want: []string{`"route": "db"`}},
+		{args: []string{"routes", "test", "team"}, wantCode: 2},
+		{args: []string{"alerts", "list"}, want: []string{"Alertname"}},
+		{args: []string{"history", "query", "-alertname", "DiskFull"}, want: []string{"DiskFull", "team=db"}, notWant: []string{"Other"}},
+		{args: []string{"history", "query", "-since", "bogus"}, wantCode: 1},
+		{args: []string{"dlq", "list"}, want: []string{"req-1", "connection refused"}, notWant: []string{"req-2"}},
+		{args: []string{"dlq", "replay"}, wantCode: 2},
+		{args: []string{"dlq", "replay", "req-2"}, wantCode: 1},
+		{args: []string{"dlq", "replay", "--all"}, want: []string{"Replayed req-1"}},
+		{args: []string{"dlq", "list"}, notWant: []string{"req-1"}},
+		{args: []string{"-username", "nobody", "dlq", "list"}, wantCode: 1},
+		{args: []string{"silences", "list"}, wantCode: 2},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if code := runCtl(tt.args, &out); code != tt.wantCode {
+			t.Errorf("runCtl(%v) = %d, want %d", tt.args, code, tt.wantCode)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("runCtl(%v) output = %q, want %q", tt.args, out.String(), want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(out.String(), notWant) {
+				t.Errorf("runCtl(%v) output = %q, want no %q", tt.args, out.String(), notWant)
+			}
+		}
+	}
+
+	sent := provider.GetSentMessages()
+	if len(sent) != 1 || sent[0].message.Text != "disk full" {
+		t.Errorf("sent %+v, want the failed message replayed once", sent)
+	}
+	if record, _ := deliveries.Get("req-1"); record.Status != deliveryDelivered || len(record.Attempts) != 2 {
+		t.Errorf("replayed delivery = %+v, want delivered on a second attempt", record)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDeliveryRecords is how many recent deliveries are kept for
+	// diagnosis; the oldest are forgotten first.
+	maxDeliveryRecords = 500
+	// maxDeliveryBody bounds the response body kept for each attempt.
+	maxDeliveryBody = 4096
+
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+// urlQuery matches the query string of URLs in error messages, which holds
+// webhook credentials.
+var urlQuery = regexp.MustCompile(`(https?://[^\s"?]*)\?[^\s"]*`)
+
+// DeliveryAttempt is one try at delivering a message.
+type DeliveryAttempt struct {
+	Attempt     int       `json:"attempt"`
+	Route       string    `json:"route"`
+	Destination string    `json:"destination"`
+	At          time.Time `json:"at"`
+	DurationMs  int64     `json:"durationMs"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Response    string    `json:"response,omitempty"`
+}
+
+// DeliveryRecord is the message sent for a webhook request and every
+// attempt at delivering it, including outbox retries. A notification that
+// continues to several routes is sent to each of their destinations; the
+// record has failed while the last attempt on any of them did.
+type DeliveryRecord struct {
+	ID      string             `json:"id"`
+	Status  string             `json:"status"`
+	Message *GoogleChatMessage `json:"message"`
+	// Destinations is the status of each destination, by name.
+	Destinations map[string]string `json:"destinations"`
+	Attempts     []DeliveryAttempt `json:"attempts"`
+	// messages is the message last sent to each destination, for replay.
+	messages map[string]*GoogleChatMessage
+}
+
+// failedAttempt returns the last attempt on a destination whose delivery
+// has failed.
+func (r *DeliveryRecord) failedAttempt() (DeliveryAttempt, bool) {
+	for i := len(r.Attempts) - 1; i >= 0; i-- {
+		if r.Destinations[r.Attempts[i].Destination] == deliveryFailed {
+			return r.Attempts[i], true
+		}
+	}
+	return DeliveryAttempt{}, false
+}
+
+// DeliverySummary is a DeliveryRecord without its message and timeline.
+type DeliverySummary struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	Route     string    `json:"route"`
+	Attempts  int       `json:"attempts"`
+	LastTry   time.Time `json:"lastTry"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// DeliveryLog keeps the most recent deliveries in memory, keyed by request
+// ID, so a failed send can be diagnosed without debug logging.
+type DeliveryLog struct {
+	mu      sync.Mutex
+	limit   int
+	records map[string]*DeliveryRecord
+	order   []string
+}
+
+var deliveries = NewDeliveryLog(maxDeliveryRecords)
+
+func NewDeliveryLog(limit int) *DeliveryLog {
+	return &DeliveryLog{limit: limit, records: map[string]*DeliveryRecord{}}
+}
+
+// Record adds the outcome of an attempt, started at start, at delivering
+// message for opts.ReqID.
+func (l *DeliveryLog) Record(opts SendOptions, message *GoogleChatMessage, start time.Time, err error) {
+	attempt := DeliveryAttempt{
+		Attempt:     opts.Attempt,
+		Route:       opts.Route,
+		Destination: opts.destination(),
+		At:          start,
+		DurationMs:  clock.Since(start).Milliseconds(),
+	}
+	status := deliveryDelivered
+	if err != nil {
+		status = deliveryFailed
+		attempt.Error = errorText(err)
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) {
+			attempt.StatusCode = statusErr.StatusCode
+			attempt.Response = statusErr.Body
+			if len(attempt.Response) > maxDeliveryBody {
+				attempt.Response = attempt.Response[:maxDeliveryBody]
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record, ok := l.records[opts.ReqID]
+	if !ok {
+		if len(l.order) >= l.limit {
+			delete(l.records, l.order[0])
+			l.order = l.order[1:]
+		}
+		record = &DeliveryRecord{ID: opts.ReqID, Destinations: map[string]string{}, messages: map[string]*GoogleChatMessage{}}
+		l.records[opts.ReqID] = record
+		l.order = append(l.order, opts.ReqID)
+	}
+	record.Destinations[attempt.Destination] = status
+	record.messages[attempt.Destination] = message
+	record.Message = message
+	record.Attempts = append(record.Attempts, attempt)
+	record.Status = deliveryDelivered
+	if _, failed := record.failedAttempt(); failed {
+		record.Status = deliveryFailed
+	}
+}
+
+// errorText returns the message of err with the query string of URLs, which
+// holds webhook credentials, removed.
+func errorText(err error) string {
+	return urlQuery.ReplaceAllString(err.Error(), "$1?...")
+}
+
+// Get returns a copy of the delivery for id.
+func (l *DeliveryLog) Get(id string) (DeliveryRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record, ok := l.records[id]
+	if !ok {
+		return DeliveryRecord{}, false
+	}
+	r := *record
+	r.Destinations = maps.Clone(record.Destinations)
+	r.messages = maps.Clone(record.messages)
+	r.Attempts = append([]DeliveryAttempt(nil), record.Attempts...)
+	return r, true
+}
+
+// Recent returns up to limit deliveries with status, or any status when
+// status is empty, newest first.
+func (l *DeliveryLog) Recent(status string, limit int) []DeliverySummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	summaries := []DeliverySummary{}
+	for i := len(l.order) - 1; i >= 0 && len(summaries) < limit; i-- {
+		record := l.records[l.order[i]]
+		if status != "" && record.Status != status {
+			continue
+		}
+		last := record.Attempts[len(record.Attempts)-1]
+		if failed, ok := record.failedAttempt(); ok {
+			last = failed
+		}
+		summaries = append(summaries, DeliverySummary{
+			ID:        record.ID,
+			Status:    record.Status,
+			Route:     last.Route,
+			Attempts:  len(record.Attempts),
+			LastTry:   last.At,
+			LastError: last.Error,
+		})
+	}
+	return summaries
+}
+
+// deliveriesHandler serves GET /api/v1/deliveries/{id} with the stored
+// details of one delivery, and GET /api/v1/deliveries/ with the most
+// recent deliveries, optionally filtered by ?status=. POST
+// /api/v1/deliveries/{id}/replay resends a failed delivery.
+func deliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/deliveries/")
+	if id, ok := strings.CutSuffix(id, "/replay"); ok {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		replayDelivery(w, r, id)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if id == "" {
+		status := r.URL.Query().Get("status")
+		if status != "" && status != deliveryDelivered && status != deliveryFailed {
+			http.Error(w, "status must be delivered or failed", http.StatusBadRequest)
+			return
+		}
+		limit := 50
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxDeliveryRecords {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries.Recent(status, limit))
+		return
+	}
+
+	record, ok := deliveries.Get(id)
+	if !ok {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// replayDelivery resends the message of the failed delivery id through the
+// route of its last failed attempt, or the default route when that route is
+// gone. The outcome is added to the delivery's attempts.
+func replayDelivery(w http.ResponseWriter, r *http.Request, id string) {
+	record, ok := deliveries.Get(id)
+	if !ok {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if record.Status != deliveryFailed {
+		http.Error(w, "Delivery did not fail", http.StatusConflict)
+		return
+	}
+
+	rt := getRuntime()
+	last, _ := record.failedAttempt()
+	route := rt.DefaultRoute
+	if route == nil {
+		route = &Route{Name: defaultRouteName}
+	}
+	for _, candidate := range rt.routes() {
+		if candidate.Name == last.Route {
+			route = candidate
+			break
+		}
+	}
+	if route.WebhookMap != nil || route.WebhookTemplate != nil {
+		http.Error(w, fmt.Sprintf("Route %s picks its webhook per alert and cannot be replayed", route.Name), http.StatusConflict)
+		return
+	}
+
+	logger.Info("[%s] Replaying failed delivery through route %s on request from %s", id, route.Name, r.RemoteAddr)
+	if err := route.Send(r.Context(), reloadableProvider{}, record.messages[last.Destination], id); err != nil {
+		logger.Error("[%s] Error replaying delivery: %v", id, err)
+		http.Error(w, fmt.Sprintf("Replay failed: %s", errorText(err)), http.StatusBadGateway)
+		return
+	}
+	record, _ = deliveries.Get(id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
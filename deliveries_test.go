@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliveryLogRecord(t *testing.T) {
+	l := NewDeliveryLog(10)
+	message := &GoogleChatMessage{Text: "disk full"}
+	start := time.Now()
+
+	rejected := fmt.Errorf("posting to https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t: %w",
+		&HTTPStatusError{StatusCode: http.StatusBadRequest, Body: strings.Repeat("x", maxDeliveryBody+10)})
+	l.Record(SendOptions{ReqID: "req-1", Route: "ops", Attempt: 1}, message, start, rejected)
+	l.Record(SendOptions{ReqID: "req-1", Route: "ops", Attempt: 2}, message, start, nil)
+
+	record, ok := l.Get("req-1")
+	if !ok {
+		t.Fatal("Get() found no delivery")
+	}
+	if record.Status != deliveryDelivered || record.Message != message || len(record.Attempts) != 2 {
+		t.Fatalf("Get() = %+v, want a delivered message with 2 attempts", record)
+	}
+	first := record.Attempts[0]
+	if first.StatusCode != http.StatusBadRequest || len(first.Response) != maxDeliveryBody {
+		t.Errorf("attempt 1 status = %d, response length = %d", first.StatusCode, len(first.Response))
+	}
+	if strings.Contains(first.Error, "token") || !strings.Contains(first.Error, "/v1/spaces/AAA/messages?...") {
+		t.Errorf("attempt 1 error = %q, want the query string stripped", first.Error)
+	}
+	if second := record.Attempts[1]; second.Attempt != 2 || second.Error != "" || second.StatusCode != 0 {
+		t.Errorf("attempt 2 = %+v, want a success", second)
+	}
+}
+
+func TestDeliveryLogMultipleRoutes(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	saved := deliveries
+	defer func() { deliveries = saved }()
+	deliveries = NewDeliveryLog(10)
+	provider := NewMockProvider(false)
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Routes: []*Route{{Name: "db", Provider: provider}, {Name: "audit"}}})
+
+	// The db route fails, then the audit route the notification continues
+	// to succeeds.
+	deliveries.Record(SendOptions{ReqID: "req-1", Route: "db", Attempt: 1}, &GoogleChatMessage{Text: "db"}, time.Now(), errors.New("connection refused"))
+	deliveries.Record(SendOptions{ReqID: "req-1", Route: "audit", Attempt: 1}, &GoogleChatMessage{Text: "audit"}, time.Now(), nil)
+
+	record, _ := deliveries.Get("req-1")
+	if record.Status != deliveryFailed || record.Destinations["db"] != deliveryFailed || record.Destinations["audit"] != deliveryDelivered {
+		t.Fatalf("Get() = %+v, want failed with db failed and audit delivered", record)
+	}
+	if recent := deliveries.Recent(deliveryFailed, 10); len(recent) != 1 || recent[0].Route != "db" || recent[0].LastError != "connection refused" {
+		t.Errorf("Recent(failed) = %+v, want req-1 failed on db", recent)
+	}
+
+	w := httptest.NewRecorder()
+	deliveriesHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/deliveries/req-1/replay", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay status = %d: %s", w.Code, w.Body.String())
+	}
+	if sent := provider.GetSentMessages(); len(sent) != 1 || sent[0].message.Text != "db" {
+		t.Errorf("sent %+v, want the db message replayed through db", sent)
+	}
+	if record, _ := deliveries.Get("req-1"); record.Status != deliveryDelivered {
+		t.Errorf("replayed delivery = %+v, want delivered", record)
+	}
+}
+
+func TestDeliveryLogRecent(t *testing.T) {
+	l := NewDeliveryLog(3)
+	for i := 1; i <= 4; i++ {
+		var err error
+		if i%2 == 0 {
+			err = errors.New("connection refused")
+		}
+		l.Record(SendOptions{ReqID: fmt.Sprintf("req-%d", i), Attempt: 1}, &GoogleChatMessage{}, time.Now(), err)
+	}
+
+	if _, ok := l.Get("req-1"); ok {
+		t.Error("Get() found the oldest delivery, want it evicted")
+	}
+	tests := []struct {
+		status string
+		limit  int
+		want   []string
+	}{
+		{status: "", limit: 10, want: []string{"req-4", "req-3", "req-2"}},
+		{status: "", limit: 1, want: []string{"req-4"}},
+		{status: deliveryFailed, limit: 10, want: []string{"req-4", "req-2"}},
+		{status: deliveryDelivered, limit: 10, want: []string{"req-3"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, s := range l.Recent(tt.status, tt.limit) {
+			got = append(got, s.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Recent(%q, %d) = %v, want %v", tt.status, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveriesHandler(t *testing.T) {
+	saved := deliveries
+	defer func() { deliveries = saved }()
+	deliveries = NewDeliveryLog(10)
+	deliveries.Record(SendOptions{ReqID: "req-1", Route: "ops", Attempt: 1}, &GoogleChatMessage{Text: "hi"}, time.Now(), nil)
+
+	tests := []struct {
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{method: http.MethodGet, path: "/api/v1/deliveries/req-1", wantCode: http.StatusOK, wantBody: `"id":"req-1"`},
+		{method: http.MethodGet, path: "/api/v1/deliveries/missing", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/api/v1/deliveries/?status=delivered", wantCode: http.StatusOK, wantBody: `"route":"ops"`},
+		{method: http.MethodGet, path: "/api/v1/deliveries/?status=pending", wantCode: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/api/v1/deliveries/?limit=0", wantCode: http.StatusBadRequest},
+		{method: http.MethodDelete, path: "/api/v1/deliveries/req-1", wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		deliveriesHandler(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, w.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s %s body = %s, want %s", tt.method, tt.path, w.Body.String(), tt.wantBody)
+		}
+		if w.Code == http.StatusOK && !json.Valid(w.Body.Bytes()) {
+			t.Errorf("%s %s body is not JSON", tt.method, tt.path)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DeliveryPolicy applies concurrency limits, rate limiting, a circuit
+// breaker and retries to sends for one route. Rate limits and the breaker
+// apply to each destination of the route separately. Their state is shared
+// by all requests using the route until the next configuration reload.
+type DeliveryPolicy struct {
+	cfg     DeliveryConfig
+	workers chan struct{}
+	limiter *rateLimiter
+	breaker *circuitBreaker
+}
+
+func NewDeliveryPolicy(cfg DeliveryConfig) *DeliveryPolicy {
+	p := &DeliveryPolicy{cfg: cfg}
+	if cfg.Workers > 0 {
+		p.workers = make(chan struct{}, cfg.Workers)
+	}
+	if cfg.RateLimit > 0 {
+		p.limiter = newRateLimiter(cfg.RateLimit, cfg.Burst)
+	}
+	if cfg.BreakerFailures > 0 {
+		p.breaker = newCircuitBreaker(cfg.BreakerFailures, cfg.BreakerCooldown)
+	}
+	return p
+}
+
+// Send delivers message through provider, waiting for a free worker slot and
+// a rate limit token, and retrying transient failures with exponential
+// backoff. It stops waiting and retrying once ctx is done or the circuit
+// breaker opens.
+func (p *DeliveryPolicy) Send(ctx context.Context, provider Provider, message *GoogleChatMessage, opts SendOptions) error {
+	if p == nil {
+		opts.Attempt = 1
+		return sendWithFallback(ctx, provider, message, opts)
+	}
+
+	if err := p.breaker.check(opts, clock.Now()); err != nil {
+		return err
+	}
+	if p.workers != nil {
+		select {
+		case p.workers <- struct{}{}:
+			defer func() { <-p.workers }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(float64(p.cfg.RetryBackoff) * math.Pow(2, float64(attempt-1)))
+			logger.InfoRepeated("Retrying delivery to "+opts.destination()+": "+errorText(err),
+				"[%s] Retrying delivery in %s (attempt %d/%d): %v", opts.ReqID, backoff, attempt, p.cfg.MaxRetries, err)
+			if serr := sleep(ctx, backoff); serr != nil {
+				return fmt.Errorf("%v (gave up retrying: %v)", err, serr)
+			}
+		}
+
+		if werr := p.throttle(ctx, opts); werr != nil {
+			return werr
+		}
+		if berr := p.breaker.allow(opts, clock.Now()); berr != nil {
+			return berr
+		}
+
+		opts.Attempt = attempt + 1
+		err = sendWithFallback(ctx, provider, message, opts)
+		p.breaker.record(opts, clock.Now(), err)
+		if err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Attempt makes a single delivery of message, waiting for a free worker
+// slot and a rate limit token. Retries are left to the caller.
+func (p *DeliveryPolicy) Attempt(ctx context.Context, provider Provider, message *GoogleChatMessage, opts SendOptions) error {
+	if p == nil {
+		return sendWithFallback(ctx, provider, message, opts)
+	}
+
+	if err := p.breaker.check(opts, clock.Now()); err != nil {
+		return err
+	}
+	if p.workers != nil {
+		select {
+		case p.workers <- struct{}{}:
+			defer func() { <-p.workers }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := p.throttle(ctx, opts); err != nil {
+		return err
+	}
+	if err := p.breaker.allow(opts, clock.Now()); err != nil {
+		return err
+	}
+	err := sendWithFallback(ctx, provider, message, opts)
+	p.breaker.record(opts, clock.Now(), err)
+	return err
+}
+
+// throttle waits for a rate limit token of the destination of opts,
+// counting the sends that had to wait for one.
+func (p *DeliveryPolicy) throttle(ctx context.Context, opts SendOptions) error {
+	if p.limiter == nil {
+		return nil
+	}
+	wait := p.limiter.reserve(opts.destination())
+	if wait > 0 {
+		sendsThrottled.WithLabelValues(opts.Route).Inc()
+	}
+	if err := sleep(ctx, wait); err != nil {
+		// The message is not sent, so its token goes to the next one.
+		p.limiter.release(opts.destination())
+		return fmt.Errorf("%w: %w", errRateLimited, err)
+	}
+	return nil
+}
+
+// errRateLimited wraps the error of a send that gave up waiting for the
+// destination's rate limit.
+var errRateLimited = errors.New("rate limited")
+
+// rateLimited reports whether a send failed because of rate limiting, by
+// the bridge or by Chat.
+func rateLimited(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.Is(err, errRateLimited)
+}
+
+// retryable reports whether a send error may succeed when retried: 429 and
+// server errors, timeouts, network failures and sends refused by an open
+// circuit breaker. Other errors, such as client errors, invalid URLs,
+// render errors and cancellation, are permanent.
+func retryable(err error) bool {
+	if errors.Is(err, errCircuitOpen) {
+		return true
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// defaultRateLimit is the default [delivery] rate_limit, in messages per
+// second per destination.
+const defaultRateLimit = 1
+
+// rateLimiter keeps a token bucket per destination, since Chat limits the
+// messages each space accepts. Buckets that have refilled are forgotten, so
+// only destinations sent to recently are kept.
+type rateLimiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: map[string]*tokenBucket{}}
+}
+
+// reserve takes a token of destination's bucket and returns how long the
+// caller must wait before using it. The token is taken under l.mu, so a
+// concurrent reserve cannot forget the bucket in between and hand out a
+// full one.
+func (l *rateLimiter) reserve(destination string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := clock.Now()
+	for d, b := range l.buckets {
+		if d != destination && b.full(now) {
+			delete(l.buckets, d)
+		}
+	}
+	b, ok := l.buckets[destination]
+	if !ok {
+		b = newTokenBucket(l.rate, l.burst)
+		l.buckets[destination] = b
+	}
+	return b.reserve()
+}
+
+// release returns a token reserved for destination but not used.
+func (l *rateLimiter) release(destination string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[destination]; ok {
+		b.release()
+	}
+}
+
+// tokenBucket is a blocking token bucket rate limiter.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait before
+// using it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := clock.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// release returns a reserved token, up to the burst.
+func (b *tokenBucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// full reports whether the bucket has refilled by now, so that a new bucket
+// would behave the same.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// sleep waits for d, returning early with the context error when ctx is
+// done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// flakyProvider fails with the given errors before succeeding.
+type flakyProvider struct {
+	mu     sync.Mutex
+	errs   []error
+	calls  int
+	active int
+	peak   int
+
+	lastAttempt int
+}
+
+func (f *flakyProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error {
+	f.mu.Lock()
+	f.calls++
+	f.lastAttempt = opts.Attempt
+	f.active++
+	if f.active > f.peak {
+		f.peak = f.active
+	}
+	var err error
+	if len(f.errs) > 0 {
+		err, f.errs = f.errs[0], f.errs[1:]
+	}
+	f.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	f.mu.Lock()
+	f.active--
+	f.mu.Unlock()
+	return err
+}
+
+func TestDeliveryPolicyRetries(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "retries server errors",
+			errs:      []error{&HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, fmt.Errorf("error sending request: %w", syscall.ECONNRESET)},
+			wantCalls: 3,
+		},
+		{
+			name:      "retries timeouts",
+			errs:      []error{fmt.Errorf("error sending request: %w", context.DeadlineExceeded)},
+			wantCalls: 2,
+		},
+		{
+			name:      "does not retry other errors",
+			errs:      []error{fmt.Errorf("error creating request: %w", errors.New("unsupported protocol scheme"))},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "does not retry cancellation",
+			errs:      []error{fmt.Errorf("error sending request: %w", context.Canceled)},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "does not retry client errors",
+			errs:      []error{&HTTPStatusError{StatusCode: http.StatusBadRequest}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "gives up after max retries",
+			errs:      []error{&HTTPStatusError{StatusCode: 429}, &HTTPStatusError{StatusCode: 429}, &HTTPStatusError{StatusCode: 429}},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &flakyProvider{errs: tt.errs}
+			policy := NewDeliveryPolicy(DeliveryConfig{MaxRetries: 2, RetryBackoff: time.Millisecond})
+
+			err := policy.Send(context.Background(), provider, &GoogleChatMessage{}, SendOptions{ReqID: "req-1"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, provider.calls)
+			}
+			if provider.lastAttempt != tt.wantCalls {
+				t.Errorf("Expected the last attempt to be %d, got %d", tt.wantCalls, provider.lastAttempt)
+			}
+		})
+	}
+}
+
+func TestDeliveryPolicyWorkers(t *testing.T) {
+	provider := &flakyProvider{}
+	policy := NewDeliveryPolicy(DeliveryConfig{Workers: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			policy.Send(context.Background(), provider, &GoogleChatMessage{}, SendOptions{ReqID: "req"})
+		}()
+	}
+	wg.Wait()
+
+	if provider.peak > 2 {
+		t.Errorf("Expected at most 2 concurrent sends, got %d", provider.peak)
+	}
+}
+
+func TestDeliveryPolicySendDeadline(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	provider := &flakyProvider{errs: []error{&HTTPStatusError{StatusCode: http.StatusServiceUnavailable}}}
+	policy := NewDeliveryPolicy(DeliveryConfig{MaxRetries: 3, RetryBackoff: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := policy.Send(ctx, provider, &GoogleChatMessage{}, SendOptions{ReqID: "req-1"})
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to end delivery, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Send to give up at the deadline, took %s", elapsed)
+	}
+	if provider.calls != 1 {
+		t.Errorf("Expected no retry after the deadline, got %d calls", provider.calls)
+	}
+
+	// A full worker pool is not waited on past the deadline either.
+	policy = NewDeliveryPolicy(DeliveryConfig{Workers: 1})
+	policy.workers <- struct{}{}
+	if err := policy.Send(ctx, provider, &GoogleChatMessage{}, SendOptions{ReqID: "req-2"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded waiting for a worker, got %v", err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(10, 2)
+
+	if d := bucket.reserve(); d != 0 {
+		t.Errorf("Expected first token immediately, waited %s", d)
+	}
+	if d := bucket.reserve(); d != 0 {
+		t.Errorf("Expected burst token immediately, waited %s", d)
+	}
+	if d := bucket.reserve(); d <= 0 || d > 100*time.Millisecond {
+		t.Errorf("Expected ~100ms wait once burst is exhausted, got %s", d)
+	}
+}
+
+func TestDeliveryPolicyThrottleReleasesCancelledTokens(t *testing.T) {
+	useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+	policy := NewDeliveryPolicy(DeliveryConfig{RateLimit: 1, Burst: 1})
+	opts := SendOptions{ReqID: "req", Route: "release-test", Destination: "spaces/A"}
+
+	if err := policy.throttle(context.Background(), opts); err != nil {
+		t.Fatalf("throttle() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := policy.throttle(ctx, opts); !errors.Is(err, errRateLimited) {
+		t.Fatalf("throttle() error = %v, want it rate limited", err)
+	}
+	// The cancelled send's token was returned, so the next send waits one
+	// token's time rather than two.
+	if wait := policy.limiter.reserve(opts.Destination); wait != time.Second {
+		t.Errorf("reserve() = %s, want 1s", wait)
+	}
+}
+
+func TestDeliveryPolicyThrottled(t *testing.T) {
+	provider := &flakyProvider{}
+	policy := NewDeliveryPolicy(DeliveryConfig{RateLimit: 10, Burst: 2})
+
+	for i := 0; i < 3; i++ {
+		if err := policy.Attempt(context.Background(), provider, &GoogleChatMessage{}, SendOptions{ReqID: "req", Route: "throttle-test"}); err != nil {
+			t.Fatalf("Attempt() error = %v", err)
+		}
+	}
+	var m dto.Metric
+	if err := sendsThrottled.WithLabelValues("throttle-test").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("Expected only the send after the burst to be throttled, got %v", got)
+	}
+}
+
+func TestDeliveryPolicyCircuitBreaker(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	fake := useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+	defer func() { destinationHealth = NewDestinationHealthLog() }()
+	destinationHealth = NewDestinationHealthLog()
+
+	unavailable := &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}
+	provider := &flakyProvider{errs: []error{unavailable, unavailable, unavailable}}
+	policy := NewDeliveryPolicy(DeliveryConfig{BreakerFailures: 2, BreakerCooldown: time.Minute})
+	opts := SendOptions{ReqID: "req", Route: "breaker-test"}
+
+	steps := []struct {
+		advance   time.Duration
+		wantOpen  bool // the send failed fast
+		wantCalls int
+		wantState bool // the circuit is open afterwards
+	}{
+		{wantCalls: 1},
+		{wantCalls: 2, wantState: true},
+		{wantOpen: true, wantCalls: 2, wantState: true},
+		{advance: time.Minute, wantCalls: 3, wantState: true}, // the probe fails
+		{wantOpen: true, wantCalls: 3, wantState: true},
+		{advance: time.Minute, wantCalls: 4}, // the probe succeeds
+		{wantCalls: 5},
+	}
+	for i, step := range steps {
+		fake.Advance(step.advance)
+		err := policy.Attempt(context.Background(), provider, &GoogleChatMessage{}, opts)
+		if errors.Is(err, errCircuitOpen) != step.wantOpen {
+			t.Errorf("step %d: Attempt() error = %v, want circuit open %v", i, err, step.wantOpen)
+		}
+		if provider.calls != step.wantCalls {
+			t.Errorf("step %d: provider called %d times, want %d", i, provider.calls, step.wantCalls)
+		}
+		if got := destinationHealth.Snapshot()[0].CircuitOpen; got != step.wantState {
+			t.Errorf("step %d: health circuit open = %v, want %v", i, got, step.wantState)
+		}
+	}
+}
+
+func TestRouteSelection(t *testing.T) {
+	cfg := Config{
+		Routes: []RouteConfig{
+			{Name: "db", Matchers: []string{`team="db"`}, WebhookURL: "https://chat.example.com/db"},
+			{Name: "critical", Matchers: []string{`severity="critical"`}},
+		},
+	}
+	rt, err := NewRuntime(cfg)
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+
+	tests := []struct {
+		labels KV
+		want   string
+	}{
+		{KV{"team": "db", "severity": "critical"}, "db"},
+		{KV{"team": "web", "severity": "critical"}, "critical"},
+		{KV{"team": "web"}, defaultRouteName},
+	}
+
+	for _, tt := range tests {
+		payload := &AlertManagerPayload{CommonLabels: tt.labels}
+		if got := rt.Route(payload).Name; got != tt.want {
+			t.Errorf("Route(%v) = %s, want %s", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestRouteReceivers(t *testing.T) {
+	rt, err := NewRuntime(Config{Routes: []RouteConfig{
+		{Name: "db-critical", Receivers: []string{"db"}, Matchers: []string{`severity="critical"`}},
+		{Name: "db", Receivers: []string{"db", "db-oncall"}},
+		{Name: "web", Matchers: []string{`team="web"`}},
+	}})
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+
+	tests := []struct {
+		receiver string
+		labels   KV
+		want     string
+	}{
+		{receiver: "db", labels: KV{"severity": "critical"}, want: "db-critical"},
+		{receiver: "db", labels: KV{"severity": "warning"}, want: "db"},
+		{receiver: "db-oncall", labels: KV{"severity": "critical"}, want: "db"},
+		{receiver: "web", labels: KV{"team": "web"}, want: "web"},
+		{receiver: "web", labels: KV{"severity": "critical"}, want: defaultRouteName},
+	}
+	for _, tt := range tests {
+		payload := &AlertManagerPayload{Receiver: tt.receiver, CommonLabels: tt.labels}
+		if got := rt.Route(payload).Name; got != tt.want {
+			t.Errorf("Route(%s, %v) = %s, want %s", tt.receiver, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestRouteContinue(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	rt, err := NewRuntime(Config{Routes: []RouteConfig{
+		{Name: "audit", Matchers: []string{`severity=~"critical|warning"`}, Continue: true},
+		{Name: "db", Matchers: []string{`team="db"`}},
+		{Name: "critical", Matchers: []string{`severity="critical"`}},
+	}})
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+	providers := map[string]*MockProvider{}
+	for _, r := range rt.Routes {
+		providers[r.Name] = NewMockProvider(false)
+		r.Provider = providers[r.Name]
+	}
+	currentRuntime.Store(rt)
+
+	tests := []struct {
+		labels KV
+		want   []string
+	}{
+		{KV{"team": "db", "severity": "critical"}, []string{"audit", "db"}},
+		{KV{"team": "web", "severity": "warning"}, []string{"audit"}},
+		{KV{"team": "web", "severity": "info"}, []string{defaultRouteName}},
+		{KV{"team": "web", "severity": "critical"}, []string{"audit", "critical"}},
+		{KV{"team": "db", "severity": "info"}, []string{"db"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range rt.MatchingRoutes(&AlertManagerPayload{CommonLabels: tt.labels}) {
+			got = append(got, r.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("MatchingRoutes(%v) = %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+
+	body := `{"status":"firing","commonLabels":{"team":"db","severity":"critical"},"alerts":[{"status":"firing","labels":{"alertname":"DiskFull","team":"db","severity":"critical"},"startsAt":"2024-05-15T09:00:00Z"}]}`
+	if err := processPayload(context.Background(), []byte(body), "req", NewMockProvider(false)); err != nil {
+		t.Fatalf("processPayload() error = %v", err)
+	}
+	for name, want := range map[string]int{"audit": 1, "db": 1, "critical": 0} {
+		if got := len(providers[name].GetSentMessages()); got != want {
+			t.Errorf("route %s sent %d messages, want %d", name, got, want)
+		}
+	}
+
+	// A retry after db failed only notifies db again.
+	flaky := &flakyProvider{errs: []error{&HTTPStatusError{StatusCode: http.StatusNotFound, Body: "Space not found"}}}
+	rt.Routes[1].Provider = flaky
+	if _, err := processOnce(context.Background(), "retry", []byte(body), "req-1", NewMockProvider(false)); err == nil {
+		t.Fatal("processOnce() error = nil, want the db delivery error")
+	}
+	escalating.Wait()
+	if _, err := processOnce(context.Background(), "retry", []byte(body), "req-2", NewMockProvider(false)); err != nil {
+		t.Fatalf("retried processOnce() error = %v", err)
+	}
+	if got := len(providers["audit"].GetSentMessages()); got != 2 {
+		t.Errorf("route audit sent %d messages, want 2", got)
+	}
+	if flaky.calls != 2 {
+		t.Errorf("route db was tried %d times, want 2", flaky.calls)
+	}
+	if delivered := deliveredRoutes.Delivered("retry"); delivered != nil {
+		t.Errorf("delivered routes after the retry = %v, want them forgotten", delivered)
+	}
+}
+
+func TestDeliveryPolicyThrottledPerDestination(t *testing.T) {
+	provider := &flakyProvider{}
+	policy := NewDeliveryPolicy(DeliveryConfig{RateLimit: 10, Burst: 1})
+
+	for _, destination := range []string{"spaces/A", "spaces/B", "spaces/A"} {
+		if err := policy.Attempt(context.Background(), provider, &GoogleChatMessage{}, SendOptions{ReqID: "req", Route: "destination-test", Destination: destination}); err != nil {
+			t.Fatalf("Attempt() error = %v", err)
+		}
+	}
+	var m dto.Metric
+	if err := sendsThrottled.WithLabelValues("destination-test").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("Expected only the second send to spaces/A to be throttled, got %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// detailsLink returns the URL of the details page of the notification for
+// reqID, under the bridge's admin URL base.
+func detailsLink(base, reqID string) string {
+	return strings.TrimRight(base, "/") + "/details/" + url.PathEscape(reqID)
+}
+
+// addDetailsButton adds a Details button opening link at the end of each
+// card in message. Messages without cards, such as jsonnet text-only
+// messages, are left as they are.
+func addDetailsButton(message *GoogleChatMessage, link string) {
+	onClick := &OnClickAction{OpenLink: &OpenLink{URL: link}}
+	for i := range message.Cards {
+		message.Cards[i].Sections = append(message.Cards[i].Sections, CardSection{
+			Widgets: []Widget{{Buttons: []Button{{TextButton: &TextButton{Text: "Details", OnClick: onClick}}}}},
+		})
+	}
+	for i := range message.CardsV2 {
+		message.CardsV2[i].Card.Sections = append(message.CardsV2[i].Card.Sections, CardV2Section{
+			Widgets: []WidgetV2{{ButtonList: &ButtonList{Buttons: []ButtonV2{{Text: "Details", OnClick: onClick}}}}},
+		})
+	}
+}
+
+// notificationDetails is what the details page shows for one notification.
+type notificationDetails struct {
+	ID       string
+	Route    string
+	At       time.Time
+	Alerts   []HistoryEntry
+	Delivery *DeliveryRecord
+}
+
+var detailsTemplate = template.Must(template.New("details").Funcs(template.FuncMap{
+	"pairs": func(kv KV) [][2]string {
+		keys := make([]string, 0, len(kv))
+		for k := range kv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([][2]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = [2]string{k, kv[k]}
+		}
+		return pairs
+	},
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{ .ID }}</title></head>
+<body style="font-family: Arial, sans-serif; color: #202124;">
+<h2>Notification {{ .ID }}</h2>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr><td>Route</td><td><b>{{ .Route }}</b></td></tr>
+<tr><td>Delivered</td><td><b>{{ time .At }}</b></td></tr>
+<tr><td>Alerts</td><td><b>{{ len .Alerts }}</b></td></tr>
+</table>
+{{- range $i, $a := .Alerts }}
+<h3>{{ $a.Alertname }} ({{ $a.Status }})</h3>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+<tr><td>Started</td><td>{{ time $a.StartsAt }}</td></tr>
+<tr><td>Ended</td><td>{{ time $a.EndsAt }}</td></tr>
+{{- if $a.GeneratorURL }}
+<tr><td>Source</td><td><a href="{{ $a.GeneratorURL }}">{{ $a.GeneratorURL }}</a></td></tr>
+{{- end }}
+<tr><th align="left" colspan="2">Labels</th></tr>
+{{- range pairs $a.Labels }}
+<tr><td>{{ index . 0 }}</td><td>{{ index . 1 }}</td></tr>
+{{- end }}
+{{- if $a.Annotations }}
+<tr><th align="left" colspan="2">Annotations</th></tr>
+{{- range pairs $a.Annotations }}
+<tr><td>{{ index . 0 }}</td><td style="white-space: pre-wrap;">{{ index . 1 }}</td></tr>
+{{- end }}
+{{- end }}
+</table>
+{{- end }}
+{{- with .Delivery }}
+<h3>Delivery attempts</h3>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+<tr><th>Attempt</th><th align="left">Route</th><th align="left">At</th><th>Time (ms)</th><th>Status code</th><th align="left">Error</th></tr>
+{{- range .Attempts }}
+<tr><td align="right">{{ .Attempt }}</td><td>{{ .Route }}</td><td>{{ time .At }}</td><td align="right">{{ .DurationMs }}</td><td align="right">{{ if .StatusCode }}{{ .StatusCode }}{{ end }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
+
+// detailsHandler serves GET /details/{id}: the full labels, annotations
+// and delivery metadata of a delivered notification, read from the history.
+// Delivery attempts are shown while the delivery log still holds them.
+func detailsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/details/")
+	entries := history.ByRequest(id)
+	if id == "" || len(entries) == 0 {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+
+	details := notificationDetails{ID: id, Route: entries[0].Route, At: entries[0].At, Alerts: entries}
+	if record, ok := deliveries.Get(id); ok {
+		details.Delivery = &record
+	}
+	var buf bytes.Buffer
+	if err := detailsTemplate.Execute(&buf, details); err != nil {
+		logger.Error("Error rendering details of %s: %v", id, err)
+		http.Error(w, "Error rendering details", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddDetailsButton(t *testing.T) {
+	link := detailsLink("https://a2g.example.com/admin/", "batch-1 0")
+	if link != "https://a2g.example.com/admin/details/batch-1%200" {
+		t.Fatalf("detailsLink() = %s", link)
+	}
+
+	payload := &AlertManagerPayload{Status: "firing", Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "DiskFull"}}}}
+	tests := []struct {
+		name   string
+		layout LayoutConfig
+	}{
+		{name: "cards", layout: LayoutConfig{}},
+		{name: "cardsV2", layout: LayoutConfig{CardsV2: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := renderMessage(payload, tt.layout, nil)
+			addDetailsButton(message, link)
+
+			var got string
+			if tt.layout.CardsV2 {
+				sections := message.CardsV2[0].Card.Sections
+				got = sections[len(sections)-1].Widgets[0].ButtonList.Buttons[0].OnClick.OpenLink.URL
+			} else {
+				sections := message.Cards[0].Sections
+				got = sections[len(sections)-1].Widgets[0].Buttons[0].TextButton.OnClick.OpenLink.URL
+			}
+			if got != link {
+				t.Errorf("last section links to %q, want %q", got, link)
+			}
+		})
+	}
+}
+
+func TestDetailsHandler(t *testing.T) {
+	defer func() { history = NewHistory("") }()
+	history = NewHistory("")
+	savedDeliveries := deliveries
+	defer func() { deliveries = savedDeliveries }()
+	deliveries = NewDeliveryLog(10)
+
+	payload := &AlertManagerPayload{Alerts: Alerts{{
+		Status:       "firing",
+		Labels:       KV{"alertname": "DiskFull", "instance": "web-1"},
+		Annotations:  KV{"description": "<b>95%</b> used"},
+		GeneratorURL: "https://prometheus.example.com/graph",
+	}}}
+	history.Record("req-1", "ops", payload, time.Now())
+	history.Record("req-2", "ops", payload, time.Now())
+	deliveries.Record(SendOptions{ReqID: "req-1", Route: "ops", Attempt: 1}, &GoogleChatMessage{}, time.Now(), &HTTPStatusError{StatusCode: http.StatusServiceUnavailable})
+
+	tests := []struct {
+		path     string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{path: "/details/req-1", wantCode: http.StatusOK, want: []string{"DiskFull (firing)", "web-1", "&lt;b&gt;95%&lt;/b&gt; used", `href="https://prometheus.example.com/graph"`, "Delivery attempts", "503"}},
+		{path: "/details/req-2", wantCode: http.StatusOK, want: []string{"Notification req-2"}, notWant: []string{"Delivery attempts"}},
+		{path: "/details/missing", wantCode: http.StatusNotFound},
+		{path: "/details/", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		detailsHandler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("GET %s status = %d, want %d", tt.path, w.Code, tt.wantCode)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("GET %s body does not contain %s", tt.path, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(w.Body.String(), notWant) {
+				t.Errorf("GET %s body contains %s", tt.path, notWant)
+			}
+		}
+	}
+}
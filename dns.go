@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// dialer is the base dialer of the shared transport.
+var dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+// resolver caches outbound name lookups according to [dns], so a cluster
+// DNS hiccup during an alert storm does not fail deliveries with "no such
+// host".
+var resolver = &dnsCache{entries: map[string]dnsEntry{}, lookup: net.DefaultResolver.LookupHost}
+
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+	lookup  func(ctx context.Context, host string) ([]string, error)
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// dnsStaleFor is how long an expired entry is kept to answer for failed
+// lookups. Entries expired for longer are removed, so hosts no longer
+// dialled do not stay in the cache.
+const dnsStaleFor = time.Hour
+
+// resolve returns the addresses of host, from the cache while the entry is
+// fresh. When a lookup fails, an expired entry is used rather than failing
+// the request.
+func (c *dnsCache) resolve(ctx context.Context, host string, ttl time.Duration) ([]string, error) {
+	c.mu.Lock()
+	now := clock.Now()
+	for h, e := range c.entries {
+		if now.Sub(e.expires) > dnsStaleFor {
+			delete(c.entries, h)
+		}
+	}
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		if ok {
+			logger.Error("DNS lookup for %s failed, using cached addresses: %v", host, err)
+			dnsStaleAnswers.Inc()
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	if ttl > 0 {
+		c.mu.Lock()
+		c.entries[host] = dnsEntry{addrs: addrs, expires: clock.Now().Add(ttl)}
+		c.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+// DialContext dials addr for the shared transport. Without [dns] or [egress]
+// settings it behaves like the default dialer. Otherwise host names are
+// resolved through the cache, limited to the egress family, and dialled in
+// the preferred address family first, falling back to the other family
+// after the fallback delay.
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	cfg := getRuntime().Config
+	d := *dialer
+	d.FallbackDelay = cfg.DNS.FallbackDelay
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || (!cfg.Egress.enabled() && (net.ParseIP(host) != nil || (cfg.DNS.CacheTTL == 0 && cfg.DNS.Prefer == ""))) {
+		return d.DialContext(ctx, network, addr)
+	}
+
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		if addrs, err = c.resolve(ctx, host, cfg.DNS.CacheTTL); err != nil {
+			return nil, err
+		}
+	}
+	if family := cfg.Egress.Family; family != "" {
+		if addrs, _ = splitByFamily(addrs, family); len(addrs) == 0 || isIPv4(addrs[0]) != (family == "ipv4") {
+			return nil, fmt.Errorf("no %s address for %s", family, host)
+		}
+	}
+	primary, fallback := splitByFamily(addrs, cfg.DNS.Prefer)
+	return dialParallel(ctx, &d, network, port, primary, fallback)
+}
+
+func isIPv4(addr string) bool {
+	return net.ParseIP(addr).To4() != nil
+}
+
+// egressDialer returns d dialling from the [egress] local address in the
+// family of the address a, or d itself when none is configured.
+func egressDialer(d *net.Dialer, a string) (*net.Dialer, error) {
+	cfg := getRuntime().Config.Egress
+	var local net.IP
+	switch {
+	case cfg.SourceAddress != "":
+		local = net.ParseIP(cfg.SourceAddress)
+		if (local.To4() != nil) != isIPv4(a) {
+			return nil, fmt.Errorf("source address %s cannot reach %s", cfg.SourceAddress, a)
+		}
+	case cfg.Interface != "":
+		iface, err := net.InterfaceByName(cfg.Interface)
+		if err != nil {
+			return nil, err
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, ia := range ifaceAddrs {
+			if ipnet, ok := ia.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() && (ipnet.IP.To4() != nil) == isIPv4(a) {
+				local = ipnet.IP
+				break
+			}
+		}
+		if local == nil {
+			return nil, fmt.Errorf("interface %s has no address to reach %s", cfg.Interface, a)
+		}
+	default:
+		return d, nil
+	}
+	dd := *d
+	dd.LocalAddr = &net.TCPAddr{IP: local}
+	return &dd, nil
+}
+
+// splitByFamily orders addrs into the preferred family and the rest. With
+// no preference the family of the first address wins, as in RFC 6555.
+func splitByFamily(addrs []string, prefer string) (primary, fallback []string) {
+	wantV4 := prefer == "ipv4"
+	if prefer == "" && len(addrs) > 0 {
+		wantV4 = isIPv4(addrs[0])
+	}
+	for _, a := range addrs {
+		if isIPv4(a) == wantV4 {
+			primary = append(primary, a)
+		} else {
+			fallback = append(fallback, a)
+		}
+	}
+	if len(primary) == 0 {
+		return fallback, nil
+	}
+	return primary, fallback
+}
+
+// dialSerial tries each address in turn, from the [egress] local address.
+func dialSerial(ctx context.Context, d *net.Dialer, network, port string, addrs []string) (net.Conn, error) {
+	err := fmt.Errorf("no addresses to dial")
+	for _, a := range addrs {
+		var ad *net.Dialer
+		if ad, err = egressDialer(d, a); err != nil {
+			continue
+		}
+		var conn net.Conn
+		if conn, err = ad.DialContext(ctx, network, net.JoinHostPort(a, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// dialParallel dials the primary addresses and, if they have not connected
+// within the fallback delay, races the fallback addresses against them.
+// A negative fallback delay disables the race.
+func dialParallel(ctx context.Context, d *net.Dialer, network, port string, primary, fallback []string) (net.Conn, error) {
+	if len(fallback) == 0 || d.FallbackDelay < 0 {
+		return dialSerial(ctx, d, network, port, append(primary, fallback...))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan result)
+	dial := func(addrs []string, primary bool) {
+		conn, err := dialSerial(ctx, d, network, port, addrs)
+		select {
+		case results <- result{conn, err, primary}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	delay := d.FallbackDelay
+	if delay == 0 {
+		delay = 300 * time.Millisecond
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	go dial(primary, true)
+	var firstErr error
+	pending, fallbackStarted := 1, false
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go dial(fallback, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go dial(fallback, false)
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
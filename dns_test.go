@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDNSCacheResolve(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	lookups := 0
+	fail := false
+	c := &dnsCache{entries: map[string]dnsEntry{}, lookup: func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if fail {
+			return nil, errors.New("no such host")
+		}
+		return []string{"10.0.0.1"}, nil
+	}}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.resolve(ctx, "chat.googleapis.com", time.Minute); err != nil {
+			t.Fatalf("resolve() error = %v", err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected 1 lookup while cached, got %d", lookups)
+	}
+
+	// Expire the entry: a failed lookup falls back to the stale addresses.
+	c.entries["chat.googleapis.com"] = dnsEntry{addrs: []string{"10.0.0.1"}, expires: time.Now().Add(-time.Second)}
+	fail = true
+	addrs, err := c.resolve(ctx, "chat.googleapis.com", time.Minute)
+	if err != nil || !reflect.DeepEqual(addrs, []string{"10.0.0.1"}) {
+		t.Errorf("Expected stale addresses, got %v, %v", addrs, err)
+	}
+
+	if _, err := c.resolve(ctx, "unknown.example.com", time.Minute); err == nil {
+		t.Error("Expected an error for an uncached host")
+	}
+
+	// Entries expired for longer than dnsStaleFor are removed.
+	c.entries["old.example.com"] = dnsEntry{addrs: []string{"10.0.0.2"}, expires: time.Now().Add(-dnsStaleFor - time.Minute)}
+	if _, err := c.resolve(ctx, "old.example.com", time.Minute); err == nil {
+		t.Error("Expected an error for a host expired beyond the stale window")
+	}
+	if _, ok := c.entries["old.example.com"]; ok {
+		t.Error("Expected the long expired entry to be removed")
+	}
+}
+
+func TestSplitByFamily(t *testing.T) {
+	addrs := []string{"2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2"}
+	tests := []struct {
+		name         string
+		addrs        []string
+		prefer       string
+		wantPrimary  []string
+		wantFallback []string
+	}{
+		{name: "resolver order", addrs: addrs, wantPrimary: []string{"2001:db8::1", "2001:db8::2"}, wantFallback: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "prefer ipv4", addrs: addrs, prefer: "ipv4", wantPrimary: []string{"10.0.0.1", "10.0.0.2"}, wantFallback: []string{"2001:db8::1", "2001:db8::2"}},
+		{name: "prefer ipv6", addrs: addrs, prefer: "ipv6", wantPrimary: []string{"2001:db8::1", "2001:db8::2"}, wantFallback: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "preferred family missing", addrs: []string{"10.0.0.1"}, prefer: "ipv6", wantPrimary: []string{"10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, fallback := splitByFamily(tt.addrs, tt.prefer)
+			if !reflect.DeepEqual(primary, tt.wantPrimary) || !reflect.DeepEqual(fallback, tt.wantFallback) {
+				t.Errorf("splitByFamily() = %v, %v, want %v, %v", primary, fallback, tt.wantPrimary, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestDNSCacheDialFallback(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{DNS: DNSConfig{CacheTTL: time.Minute, Prefer: "ipv6", FallbackDelay: 10 * time.Millisecond}}})
+
+	// The preferred IPv6 address refuses connections, so the dial falls
+	// back to IPv4.
+	c := &dnsCache{entries: map[string]dnsEntry{}, lookup: func(ctx context.Context, host string) ([]string, error) {
+		return []string{"::1", "127.0.0.1"}, nil
+	}}
+	conn, err := c.DialContext(context.Background(), "tcp", net.JoinHostPort("chat.test", port))
+	if err != nil {
+		t.Fatalf("DialContext() error = %v", err)
+	}
+	defer conn.Close()
+	if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+		t.Errorf("Expected a connection to 127.0.0.1, got %s", conn.RemoteAddr())
+	}
+}
+
+func TestDNSCacheDialEgress(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	c := &dnsCache{entries: map[string]dnsEntry{}, lookup: func(ctx context.Context, host string) ([]string, error) {
+		return []string{"::1", "127.0.0.1"}, nil
+	}}
+	tests := []struct {
+		name    string
+		egress  EgressConfig
+		host    string
+		wantErr bool
+	}{
+		{name: "ipv4 only", egress: EgressConfig{Family: "ipv4"}, host: "chat.test"},
+		{name: "source address", egress: EgressConfig{SourceAddress: "127.0.0.1"}, host: "chat.test"},
+		{name: "source address with ip literal", egress: EgressConfig{SourceAddress: "127.0.0.1"}, host: "127.0.0.1"},
+		{name: "no address in family", egress: EgressConfig{Family: "ipv6"}, host: "127.0.0.1", wantErr: true},
+		{name: "source address of another family", egress: EgressConfig{SourceAddress: "::1"}, host: "127.0.0.1", wantErr: true},
+	}
+
+	defer currentRuntime.Store(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentRuntime.Store(&Runtime{Config: Config{Egress: tt.egress}})
+			conn, err := c.DialContext(context.Background(), "tcp", net.JoinHostPort(tt.host, port))
+			if tt.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Fatal("DialContext() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DialContext() error = %v", err)
+			}
+			defer conn.Close()
+			if host, _, _ := net.SplitHostPort(conn.LocalAddr().String()); host != "127.0.0.1" {
+				t.Errorf("Expected a connection from 127.0.0.1, got %s", conn.LocalAddr())
+			}
+		})
+	}
+}
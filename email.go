@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendEmail sends an HTML email through the configured SMTP smarthost.
+// The connection is upgraded with STARTTLS when the server offers it, and
+// credentials are only sent over TLS or to localhost.
+func sendEmail(cfg EmailConfig, to []string, subject, html string) error {
+	host, _, err := net.SplitHostPort(cfg.Smarthost)
+	if err != nil {
+		return fmt.Errorf("invalid smarthost: %v", err)
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		password, err := secretValue(cfg.Password, cfg.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("error reading SMTP password: %v", err)
+		}
+		auth = smtp.PlainAuth("", cfg.Username, password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", clock.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(html, "\r\n", "\n"), "\n", "\r\n"))
+
+	if err := smtp.SendMail(cfg.Smarthost, auth, cfg.From, to, msg.Bytes()); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return nil
+}
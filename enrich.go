@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	enrichPrometheus      = "prometheus"
+	enrichLink            = "link"
+	enrichGrafanaSnapshot = "grafana_snapshot"
+
+	enrichSkip     = "skip"
+	enrichAnnotate = "annotate"
+
+	// unavailableAnnotation lists the enrichments that failed with
+	// on_failure = "annotate", so templates can say context is missing.
+	unavailableAnnotation = "enrichment_unavailable"
+)
+
+// Enricher looks up optional context for a notification. Enrichers must not
+// modify payload; they return what to add instead.
+type Enricher interface {
+	Enrich(ctx context.Context, payload *AlertManagerPayload) (*Enrichment, error)
+}
+
+// Enrichment is the context an Enricher found.
+type Enrichment struct {
+	// Annotations are added to every alert.
+	Annotations KV
+	// AlertAnnotations are added to the alert at the same index.
+	AlertAnnotations []KV
+	// Mention is prepended to the message text.
+	Mention string
+}
+
+type enrichmentStep struct {
+	name     string
+	enricher Enricher
+	timeout  time.Duration
+	annotate bool
+}
+
+// Enrichments is the pipeline of enrichers run before a message is
+// rendered. Each step has its own timeout and failure policy, so a slow or
+// broken lookup never holds up or fails the notification.
+type Enrichments []enrichmentStep
+
+type enrichmentResult struct {
+	enrichment *Enrichment
+	err        error
+}
+
+// NewEnrichments builds the configured steps, followed by the on-call
+// lookup when one is configured.
+func NewEnrichments(configs []EnrichmentConfig, onCall *OnCallResolver) (Enrichments, error) {
+	var steps Enrichments
+	for _, cfg := range configs {
+		enricher, err := newEnricher(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("enrichment %s: %v", cfg.Name, err)
+		}
+		steps = append(steps, enrichmentStep{name: cfg.Name, enricher: enricher, timeout: cfg.Timeout, annotate: cfg.OnFailure == enrichAnnotate})
+	}
+	if onCall != nil {
+		steps = append(steps, enrichmentStep{name: "oncall", enricher: onCall})
+	}
+	return steps, nil
+}
+
+func newEnricher(cfg EnrichmentConfig) (Enricher, error) {
+	switch cfg.Type {
+	case enrichPrometheus:
+		query, err := parseEnrichmentTemplate("query", cfg.Query)
+		if err != nil {
+			return nil, err
+		}
+		return &prometheusEnricher{url: strings.TrimSuffix(cfg.URL, "/"), query: query, annotation: cfg.annotation()}, nil
+	case enrichLink:
+		link, err := parseEnrichmentTemplate("url", cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &linkEnricher{url: link, annotation: cfg.annotation()}, nil
+	case enrichGrafanaSnapshot:
+		uid, err := parseEnrichmentTemplate("dashboard_uid", cfg.DashboardUID)
+		if err != nil {
+			return nil, err
+		}
+		token := cfg.Token
+		if cfg.TokenFile != "" {
+			data, err := os.ReadFile(cfg.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Grafana token file: %v", err)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+		return &grafanaSnapshotEnricher{url: strings.TrimSuffix(cfg.URL, "/"), token: token, dashboardUID: uid, expires: cfg.Expires, annotation: cfg.annotation()}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", cfg.Type)
+	}
+}
+
+func parseEnrichmentTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// Apply runs every step concurrently and adds what they found to payload,
+// returning the mention to prepend to the message, if any. A step that
+// fails or misses its timeout is logged and either skipped or named in the
+// enrichment_unavailable annotation. Apply returns by the earliest of each
+// step's timeout and ctx being done, even if an enricher ignores ctx.
+func (e Enrichments) Apply(ctx context.Context, reqID string, payload *AlertManagerPayload) string {
+	if len(e) == 0 {
+		return ""
+	}
+
+	// Enrichers work on a snapshot, so one that outlives its timeout never
+	// races with the annotations added below.
+	snapshot := *payload
+	snapshot.Alerts = append(Alerts(nil), payload.Alerts...)
+
+	results := make([]chan enrichmentResult, len(e))
+	for i, step := range e {
+		results[i] = make(chan enrichmentResult, 1)
+		stepCtx, cancel := withDeadline(ctx, step.timeout)
+		go func(step enrichmentStep, result chan<- enrichmentResult) {
+			defer cancel()
+			enrichment, err := step.enricher.Enrich(stepCtx, &snapshot)
+			result <- enrichmentResult{enrichment, err}
+		}(step, results[i])
+	}
+
+	var mentions, unavailable []string
+	for i, step := range e {
+		result := waitEnrichment(ctx, step.timeout, results[i])
+		if result.err != nil {
+			logger.Error("[%s] Enrichment %s unavailable: %v", reqID, step.name, result.err)
+			enrichmentFailures.WithLabelValues(step.name).Inc()
+			if step.annotate {
+				unavailable = append(unavailable, step.name)
+			}
+			continue
+		}
+		if result.enrichment == nil {
+			continue
+		}
+		if result.enrichment.Mention != "" {
+			mentions = append(mentions, result.enrichment.Mention)
+		}
+		for j := range payload.Alerts {
+			annotations := result.enrichment.Annotations
+			if j < len(result.enrichment.AlertAnnotations) {
+				annotations = mergeKV(annotations, result.enrichment.AlertAnnotations[j])
+			}
+			payload.Alerts[j].Annotations = mergeKV(payload.Alerts[j].Annotations, annotations)
+		}
+	}
+
+	if len(unavailable) > 0 {
+		payload.CommonAnnotations = mergeKV(payload.CommonAnnotations, KV{unavailableAnnotation: strings.Join(unavailable, ", ")})
+	}
+	return strings.Join(mentions, " ")
+}
+
+// waitEnrichment waits for a step's result until its timeout or ctx ends.
+func waitEnrichment(ctx context.Context, timeout time.Duration, result <-chan enrichmentResult) enrichmentResult {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case r := <-result:
+		return r
+	case <-expired:
+		return enrichmentResult{err: fmt.Errorf("timed out after %s", timeout)}
+	case <-ctx.Done():
+		return enrichmentResult{err: ctx.Err()}
+	}
+}
+
+// mergeKV returns a copy of base with the keys of extra it does not
+// already have. Existing annotations always win over enrichments.
+func mergeKV(base, extra KV) KV {
+	if len(extra) == 0 {
+		return base
+	}
+	merged := make(KV, len(base)+len(extra))
+	for k, v := range extra {
+		merged[k] = v
+	}
+	for k, v := range base {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Enrich adds the on-call mention, so the lookup shares the pipeline's
+// timeouts and failure handling.
+func (r *OnCallResolver) Enrich(ctx context.Context, payload *AlertManagerPayload) (*Enrichment, error) {
+	mention, err := r.Mention(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Enrichment{Mention: mention}, nil
+}
+
+// prometheusEnricher annotates each firing alert with the current value of
+// a PromQL query rendered from the alert.
+type prometheusEnricher struct {
+	url        string
+	query      *template.Template
+	annotation string
+}
+
+func (p *prometheusEnricher) Enrich(ctx context.Context, payload *AlertManagerPayload) (*Enrichment, error) {
+	enrichment := &Enrichment{AlertAnnotations: make([]KV, len(payload.Alerts))}
+	for i, alert := range payload.Alerts {
+		if alert.Status != "firing" {
+			continue
+		}
+		var query bytes.Buffer
+		if err := p.query.Execute(&query, alert); err != nil {
+			return nil, fmt.Errorf("error rendering query: %v", err)
+		}
+		value, err := p.value(ctx, strings.TrimSpace(query.String()))
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			enrichment.AlertAnnotations[i] = KV{p.annotation: value}
+		}
+	}
+	return enrichment, nil
+}
+
+// value returns the first sample of an instant query, or "" if the query
+// returned nothing.
+func (p *prometheusEnricher) value(ctx context.Context, query string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/api/v1/query?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Prometheus query failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Prometheus query failed with status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			ResultType string            `json:"resultType"`
+			Result     []json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid Prometheus response: %v", err)
+	}
+	if len(body.Data.Result) == 0 {
+		return "", nil
+	}
+	var sample []any
+	if body.Data.ResultType == "vector" {
+		var series struct {
+			Value []any `json:"value"`
+		}
+		if err := json.Unmarshal(body.Data.Result[0], &series); err != nil {
+			return "", fmt.Errorf("invalid Prometheus response: %v", err)
+		}
+		sample = series.Value
+	} else if err := json.Unmarshal(body.Data.Result[0], &sample); err != nil {
+		return "", fmt.Errorf("unsupported Prometheus result type %q", body.Data.ResultType)
+	}
+	if len(sample) != 2 {
+		return "", fmt.Errorf("invalid Prometheus sample")
+	}
+	raw, _ := sample[1].(string)
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return strconv.FormatFloat(f, 'g', 4, 64), nil
+	}
+	return raw, nil
+}
+
+// linkEnricher annotates each alert with a URL rendered from the alert,
+// such as a logs query for its labels and time range.
+type linkEnricher struct {
+	url        *template.Template
+	annotation string
+}
+
+func (l *linkEnricher) Enrich(ctx context.Context, payload *AlertManagerPayload) (*Enrichment, error) {
+	enrichment := &Enrichment{AlertAnnotations: make([]KV, len(payload.Alerts))}
+	for i, alert := range payload.Alerts {
+		var link bytes.Buffer
+		if err := l.url.Execute(&link, alert); err != nil {
+			return nil, fmt.Errorf("error rendering url: %v", err)
+		}
+		if s := strings.TrimSpace(link.String()); s != "" {
+			enrichment.AlertAnnotations[i] = KV{l.annotation: s}
+		}
+	}
+	return enrichment, nil
+}
+
+// grafanaSnapshotEnricher takes a snapshot of a Grafana dashboard when the
+// notification is sent, so the link still shows what was happening after
+// the dashboard's time range has moved on.
+type grafanaSnapshotEnricher struct {
+	url          string
+	token        string
+	dashboardUID *template.Template
+	expires      time.Duration
+	annotation   string
+}
+
+func (g *grafanaSnapshotEnricher) Enrich(ctx context.Context, payload *AlertManagerPayload) (*Enrichment, error) {
+	var uid bytes.Buffer
+	if err := g.dashboardUID.Execute(&uid, payload); err != nil {
+		return nil, fmt.Errorf("error rendering dashboard_uid: %v", err)
+	}
+	if strings.TrimSpace(uid.String()) == "" {
+		return nil, nil
+	}
+
+	var dashboard struct {
+		Dashboard map[string]any `json:"dashboard"`
+	}
+	if err := g.do(ctx, http.MethodGet, "/api/dashboards/uid/"+url.PathEscape(strings.TrimSpace(uid.String())), nil, &dashboard); err != nil {
+		return nil, err
+	}
+
+	request := map[string]any{"dashboard": dashboard.Dashboard}
+	if g.expires > 0 {
+		request["expires"] = int(g.expires.Seconds())
+	}
+	var snapshot struct {
+		URL string `json:"url"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/api/snapshots", request, &snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.URL == "" {
+		return nil, fmt.Errorf("Grafana returned a snapshot without a URL")
+	}
+	return &Enrichment{Annotations: KV{g.annotation: snapshot.URL}}, nil
+}
+
+func (g *grafanaSnapshotEnricher) do(ctx context.Context, method, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.url+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Grafana request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Grafana %s %s failed with status %d", method, path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid Grafana response: %v", err)
+	}
+	return nil
+}
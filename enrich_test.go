@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeEnricher returns a fixed enrichment after delay, ignoring ctx.
+type fakeEnricher struct {
+	enrichment *Enrichment
+	err        error
+	delay      time.Duration
+}
+
+func (f fakeEnricher) Enrich(ctx context.Context, payload *AlertManagerPayload) (*Enrichment, error) {
+	time.Sleep(f.delay)
+	return f.enrichment, f.err
+}
+
+func TestEnrichmentsApply(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	tests := []struct {
+		name            string
+		steps           Enrichments
+		wantAnnotations []KV
+		wantCommon      KV
+		wantMention     string
+	}{
+		{
+			name: "annotations are merged",
+			steps: Enrichments{{name: "value", enricher: fakeEnricher{enrichment: &Enrichment{
+				Annotations:      KV{"link_snapshot": "https://grafana/s/1", "summary": "overwritten"},
+				AlertAnnotations: []KV{{"current_value": "42"}},
+			}}}},
+			wantAnnotations: []KV{
+				{"summary": "disk full", "link_snapshot": "https://grafana/s/1", "current_value": "42"},
+				{"summary": "cpu high", "link_snapshot": "https://grafana/s/1"},
+			},
+		},
+		{
+			name:            "failure is skipped",
+			steps:           Enrichments{{name: "value", enricher: fakeEnricher{err: errors.New("connection refused")}}},
+			wantAnnotations: []KV{{"summary": "disk full"}, {"summary": "cpu high"}},
+		},
+		{
+			name: "failures are annotated",
+			steps: Enrichments{
+				{name: "value", enricher: fakeEnricher{err: errors.New("connection refused")}, annotate: true},
+				{name: "snapshot", enricher: fakeEnricher{delay: time.Second}, timeout: 10 * time.Millisecond, annotate: true},
+				{name: "logs", enricher: fakeEnricher{err: errors.New("bad template")}},
+			},
+			wantAnnotations: []KV{{"summary": "disk full"}, {"summary": "cpu high"}},
+			wantCommon:      KV{"team": "ops", unavailableAnnotation: "value, snapshot"},
+		},
+		{
+			name: "mention",
+			steps: Enrichments{
+				{name: "oncall", enricher: fakeEnricher{enrichment: &Enrichment{Mention: "<users/1>"}}},
+				{name: "empty", enricher: fakeEnricher{}},
+			},
+			wantAnnotations: []KV{{"summary": "disk full"}, {"summary": "cpu high"}},
+			wantMention:     "<users/1>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &AlertManagerPayload{
+				CommonAnnotations: KV{"team": "ops"},
+				Alerts: Alerts{
+					{Status: "firing", Annotations: KV{"summary": "disk full"}},
+					{Status: "firing", Annotations: KV{"summary": "cpu high"}},
+				},
+			}
+			mention := tt.steps.Apply(context.Background(), "test", payload)
+			if mention != tt.wantMention {
+				t.Errorf("Apply() mention = %q, want %q", mention, tt.wantMention)
+			}
+			for i, want := range tt.wantAnnotations {
+				if got := payload.Alerts[i].Annotations; !maps.Equal(got, want) {
+					t.Errorf("alert %d annotations = %v, want %v", i, got, want)
+				}
+			}
+			wantCommon := tt.wantCommon
+			if wantCommon == nil {
+				wantCommon = KV{"team": "ops"}
+			}
+			if !maps.Equal(payload.CommonAnnotations, wantCommon) {
+				t.Errorf("common annotations = %v, want %v", payload.CommonAnnotations, wantCommon)
+			}
+		})
+	}
+}
+
+func TestEnrichmentsApplyDeadline(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	steps := Enrichments{{name: "slow", enricher: fakeEnricher{delay: time.Second}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	steps.Apply(ctx, "test", &AlertManagerPayload{Alerts: Alerts{{Status: "firing"}}})
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Apply() took %s, want it to stop at the deadline", elapsed)
+	}
+}
+
+func TestEnrichers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/query" && r.URL.Query().Get("query") == `up{instance="web-1"}`:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.123456"]}]}}`))
+		case r.URL.Path == "/api/v1/query":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		case r.URL.Path == "/api/dashboards/uid/node" && r.Header.Get("Authorization") == "Bearer secret":
+			w.Write([]byte(`{"dashboard":{"title":"Node"}}`))
+		case r.URL.Path == "/api/snapshots" && r.Method == http.MethodPost:
+			var body struct {
+				Dashboard map[string]any `json:"dashboard"`
+				Expires   int            `json:"expires"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Dashboard["title"] != "Node" || body.Expires != 3600 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"url":"https://grafana/dashboard/snapshot/abc"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	payload := &AlertManagerPayload{
+		CommonAnnotations: KV{"dashboard_uid": "node"},
+		Alerts: Alerts{
+			{Status: "firing", Labels: KV{"instance": "web-1", "app": "web"}},
+			{Status: "firing", Labels: KV{"instance": "web-2", "app": "api"}},
+			{Status: "resolved", Labels: KV{"instance": "web-1", "app": "web"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		config  EnrichmentConfig
+		want    *Enrichment
+		wantErr bool
+	}{
+		{
+			name:   "prometheus",
+			config: EnrichmentConfig{Type: enrichPrometheus, URL: server.URL, Query: `up{instance="{{ .Labels.instance }}"}`},
+			want:   &Enrichment{AlertAnnotations: []KV{{"current_value": "0.1235"}, nil, nil}},
+		},
+		{
+			name:   "link",
+			config: EnrichmentConfig{Type: enrichLink, URL: "https://logs.example.com/?app={{ .Labels.app | urlquery }}"},
+			want:   &Enrichment{AlertAnnotations: []KV{{"link_logs": "https://logs.example.com/?app=web"}, {"link_logs": "https://logs.example.com/?app=api"}, {"link_logs": "https://logs.example.com/?app=web"}}},
+		},
+		{
+			name:   "grafana snapshot",
+			config: EnrichmentConfig{Type: enrichGrafanaSnapshot, URL: server.URL, DashboardUID: "{{ .CommonAnnotations.dashboard_uid }}", Token: "secret", Expires: time.Hour},
+			want:   &Enrichment{Annotations: KV{"link_snapshot": "https://grafana/dashboard/snapshot/abc"}},
+		},
+		{
+			name:    "grafana error",
+			config:  EnrichmentConfig{Type: enrichGrafanaSnapshot, URL: server.URL, DashboardUID: "missing"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enricher, err := newEnricher(tt.config)
+			if err != nil {
+				t.Fatalf("newEnricher() error = %v", err)
+			}
+			got, err := enricher.Enrich(context.Background(), payload)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Enrich() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Enrich() error = %v", err)
+			}
+			if !maps.Equal(got.Annotations, tt.want.Annotations) || len(got.AlertAnnotations) != len(tt.want.AlertAnnotations) {
+				t.Fatalf("Enrich() = %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want.AlertAnnotations {
+				if !maps.Equal(got.AlertAnnotations[i], tt.want.AlertAnnotations[i]) {
+					t.Errorf("alert %d = %v, want %v", i, got.AlertAnnotations[i], tt.want.AlertAnnotations[i])
+				}
+			}
+		})
+	}
+}
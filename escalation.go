@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// escalationTimeout bounds each escalation request.
+	escalationTimeout = 30 * time.Second
+)
+
+// DeliveryFailure describes a notification that could not be delivered,
+// whether the outbox gave up on it or a direct delivery failed. It is all
+// that is sent to escalation targets, so it names the alerts without their
+// labels or annotations.
+type DeliveryFailure struct {
+	RequestID   string   `json:"requestId"`
+	Route       string   `json:"route"`
+	Destination string   `json:"destination"`
+	Status      string   `json:"status"`
+	Alerts      []string `json:"alerts"`
+	// Attempts is the number of outbox delivery attempts, or 0 for a
+	// direct delivery.
+	Attempts int `json:"attempts,omitempty"`
+	// Pending is set for an outbox message that is still being retried.
+	Pending bool `json:"pending,omitempty"`
+	// Since is when a pending message was accepted.
+	Since time.Time `json:"since,omitzero"`
+	Error string    `json:"error"`
+	At    time.Time `json:"at"`
+}
+
+// escalating tracks the escalations in progress, so shutdown can wait for
+// them.
+var escalating sync.WaitGroup
+
+// newDeliveryFailure describes entry, dropped after err.
+func newDeliveryFailure(entry *OutboxEntry, route string, err error, now time.Time) DeliveryFailure {
+	f := newDirectDeliveryFailure(entry.ReqID, route, entry.Destination, entry.Payload, err, now)
+	f.Attempts = entry.Attempts
+	return f
+}
+
+// newDirectDeliveryFailure describes payload, which could not be delivered
+// through route to destination after err.
+func newDirectDeliveryFailure(reqID, route, destination string, payload *AlertManagerPayload, err error, now time.Time) DeliveryFailure {
+	f := DeliveryFailure{
+		RequestID:   reqID,
+		Route:       route,
+		Destination: destination,
+		Status:      payload.Status,
+		Error:       errorText(err),
+		At:          now,
+	}
+	seen := map[string]bool{}
+	for _, alert := range payload.Alerts {
+		if name := alert.Labels["alertname"]; name != "" && !seen[name] {
+			seen[name] = true
+			f.Alerts = append(f.Alerts, name)
+		}
+	}
+	return f
+}
+
+// Summary is a one-line description of the failure.
+func (f DeliveryFailure) Summary() string {
+	alerts := strings.Join(f.Alerts, ", ")
+	if alerts == "" {
+		alerts = "a notification"
+	}
+	if f.Pending {
+		return fmt.Sprintf("Still trying to deliver %s (%s) to Google Chat via route %s after %d attempt(s) over %s: %s",
+			alerts, f.Status, f.Route, f.Attempts, formatDuration(f.At.Sub(f.Since)), f.Error)
+	}
+	if f.Attempts == 0 {
+		return fmt.Sprintf("Could not deliver %s (%s) to Google Chat via route %s: %s",
+			alerts, f.Status, f.Route, f.Error)
+	}
+	return fmt.Sprintf("Could not deliver %s (%s) to Google Chat via route %s after %d attempt(s): %s",
+		alerts, f.Status, f.Route, f.Attempts, f.Error)
+}
+
+// escalate tells every configured escalation target about f in the
+// background, so slow targets hold up neither the outbox nor the webhook.
+func escalate(cfg EscalationConfig, email EmailConfig, f DeliveryFailure) {
+	escalating.Add(1)
+	go func() {
+		defer escalating.Done()
+		escalateNow(cfg, email, f)
+	}()
+}
+
+// escalateNow tells every configured escalation target about f. Failures
+// are logged and counted; there is nowhere further to escalate them.
+func escalateNow(cfg EscalationConfig, email EmailConfig, f DeliveryFailure) {
+	type target struct {
+		name string
+		send func(context.Context) error
+	}
+	var targets []target
+	if cfg.PagerDuty.RoutingKey != "" || cfg.PagerDuty.RoutingKeyFile != "" {
+		targets = append(targets, target{"pagerduty", func(ctx context.Context) error { return escalatePagerDuty(ctx, cfg.PagerDuty, f) }})
+	}
+	if cfg.Webhook.URL != "" || cfg.Webhook.URLFile != "" {
+		targets = append(targets, target{"webhook", func(ctx context.Context) error { return escalateWebhook(ctx, cfg.Webhook, f) }})
+	}
+	if len(cfg.EmailTo) > 0 {
+		targets = append(targets, target{"email", func(context.Context) error {
+			body := "<p>" + html.EscapeString(f.Summary()) + "</p>" +
+				"<p>Request ID: " + html.EscapeString(f.RequestID) + "</p>"
+			return sendEmail(email, cfg.EmailTo, "Alert not delivered to Google Chat", body)
+		}})
+	}
+
+	for _, t := range targets {
+		ctx, cancel := context.WithTimeout(context.Background(), escalationTimeout)
+		err := t.send(ctx)
+		cancel()
+		if err != nil {
+			logger.Error("[%s] Escalating the delivery failure to %s failed: %v", f.RequestID, t.name, err)
+			escalations.WithLabelValues(t.name, statusError).Inc()
+			continue
+		}
+		logger.Info("[%s] Escalated the delivery failure to %s", f.RequestID, t.name)
+		escalations.WithLabelValues(t.name, statusSuccess).Inc()
+	}
+}
+
+// remindEscalations escalates the outbox messages that have been failing
+// for [escalation] remind_after, and again each further remind_after while
+// they are retried.
+func remindEscalations(now time.Time) {
+	rt := getRuntime()
+	after := rt.Config.Escalation.RemindAfter
+	if after <= 0 {
+		return
+	}
+	for _, entry := range outbox.Overdue(now, after) {
+		payload := *entry.Payload
+		payload.Route = entry.Route
+		f := newDeliveryFailure(&entry, rt.Route(&payload).Name, errors.New(entry.LastError), now)
+		f.Pending = true
+		f.Since = entry.CreatedAt
+		escalate(rt.Config.Escalation, rt.Config.Email, f)
+	}
+}
+
+// escalatePagerDuty triggers a PagerDuty incident through the Events API.
+// Escalations for the same request share a dedup key.
+func escalatePagerDuty(ctx context.Context, cfg EscalationPagerDutyConfig, f DeliveryFailure) error {
+	key, err := secretValue(cfg.RoutingKey, cfg.RoutingKeyFile)
+	if err != nil {
+		return fmt.Errorf("error reading PagerDuty routing key: %v", err)
+	}
+	eventsURL := cfg.URL
+	if eventsURL == "" {
+		eventsURL = defaultPagerDutyEventsURL
+	}
+	severity := cfg.Severity
+	if severity == "" {
+		severity = "critical"
+	}
+	return postEscalation(ctx, eventsURL, map[string]any{
+		"routing_key":  key,
+		"event_action": "trigger",
+		"dedup_key":    "alertmanager-to-gchat/" + f.RequestID,
+		"payload": map[string]any{
+			"summary":        f.Summary(),
+			"source":         "alertmanager-to-gchat",
+			"severity":       severity,
+			"timestamp":      f.At.UTC().Format(time.RFC3339),
+			"custom_details": f,
+		},
+	})
+}
+
+// escalateWebhook posts f as JSON, e.g. to an SMS gateway.
+func escalateWebhook(ctx context.Context, cfg EscalationWebhookConfig, f DeliveryFailure) error {
+	url, err := secretValue(cfg.URL, cfg.URLFile)
+	if err != nil {
+		return fmt.Errorf("error reading escalation webhook URL: %v", err)
+	}
+	return postEscalation(ctx, url, f)
+}
+
+func postEscalation(ctx context.Context, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", errorText(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting: %v", errorText(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
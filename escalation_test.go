@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboxDropEscalates(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { outbox = NewOutbox("") }()
+	defer currentRuntime.Store(nil)
+
+	var mu sync.Mutex
+	received := map[string]map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received[r.URL.Path] = body
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	provider := &flakyProvider{errs: []error{&HTTPStatusError{StatusCode: http.StatusBadRequest, Body: "Invalid JSON payload received"}}}
+	currentRuntime.Store(&Runtime{
+		Config: Config{
+			Outbox: OutboxConfig{Enabled: true, MaxAge: time.Hour, MaxBackoff: time.Minute},
+			Escalation: EscalationConfig{
+				PagerDuty: EscalationPagerDutyConfig{RoutingKey: "R0UT1NG", URL: server.URL + "/pagerduty"},
+				Webhook:   EscalationWebhookConfig{URL: server.URL + "/sms"},
+			},
+		},
+		DefaultRoute: &Route{Name: defaultRouteName, Provider: provider},
+	})
+
+	outbox = NewOutbox("")
+	outbox.Enqueue("req-1", defaultRouteName, outboxPayload("DiskFull"), &GoogleChatMessage{Text: "disk full"}, time.Now())
+	var wg sync.WaitGroup
+	dispatchOutbox(nil, time.Now(), &wg)
+	wg.Wait()
+	escalating.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	pd, sms := received["/pagerduty"], received["/sms"]
+	if pd == nil || sms == nil {
+		t.Fatalf("Expected PagerDuty and webhook escalations, got %v", received)
+	}
+	if pd["routing_key"] != "R0UT1NG" || pd["event_action"] != "trigger" || pd["dedup_key"] != "alertmanager-to-gchat/req-1" {
+		t.Errorf("Unexpected PagerDuty event %v", pd)
+	}
+	want := "Could not deliver DiskFull (firing) to Google Chat via route default after 1 attempt(s): received non-success status code 400: Invalid JSON payload received"
+	if summary := pd["payload"].(map[string]any)["summary"]; summary != want {
+		t.Errorf("PagerDuty summary = %q, want %q", summary, want)
+	}
+	if sms["requestId"] != "req-1" || sms["route"] != defaultRouteName || sms["attempts"] != float64(1) {
+		t.Errorf("Unexpected webhook body %v", sms)
+	}
+}
+
+func TestDirectDeliveryFailureEscalates(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+
+	var mu sync.Mutex
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	provider := &flakyProvider{errs: []error{&HTTPStatusError{StatusCode: http.StatusNotFound, Body: "Space not found"}}}
+	currentRuntime.Store(&Runtime{
+		Config:       Config{Escalation: EscalationConfig{Webhook: EscalationWebhookConfig{URL: server.URL}}},
+		DefaultRoute: &Route{Name: defaultRouteName, Provider: provider},
+	})
+
+	body, err := os.ReadFile("test_webhook/sample_alert.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample alert: %v", err)
+	}
+	if err := processPayload(context.Background(), body, "req-2", provider); err == nil {
+		t.Fatal("processPayload() error = nil, want the delivery error")
+	}
+	escalating.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received["requestId"] != "req-2" || received["route"] != defaultRouteName || received["attempts"] != nil {
+		t.Errorf("Unexpected webhook body %v", received)
+	}
+}
+
+func TestRemindEscalations(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { outbox = NewOutbox("") }()
+	defer currentRuntime.Store(nil)
+
+	var mu sync.Mutex
+	var received []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		received = append(received, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	currentRuntime.Store(&Runtime{
+		Config: Config{
+			Outbox:     OutboxConfig{Enabled: true},
+			Escalation: EscalationConfig{Webhook: EscalationWebhookConfig{URL: server.URL}, RemindAfter: 30 * time.Minute},
+		},
+		DefaultRoute: &Route{Name: defaultRouteName},
+	})
+
+	start := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	outbox = NewOutbox("")
+	outbox.Enqueue("req-1", defaultRouteName, outboxPayload("DiskFull"), &GoogleChatMessage{Text: "disk full"}, start)
+	outbox.Enqueue("req-2", "other", outboxPayload("HighLatency"), &GoogleChatMessage{Text: "latency"}, start)
+	// req-2 has not been attempted yet.
+	for _, entry := range outbox.take(start) {
+		if entry.ReqID == "req-1" {
+			entry.Attempts = 3
+		}
+		outbox.finish(entry, false, start.Add(time.Minute), errors.New("timeout"))
+	}
+
+	tests := []struct {
+		at   time.Duration
+		want int
+	}{
+		{at: 20 * time.Minute, want: 0},
+		{at: 30 * time.Minute, want: 1},
+		{at: 45 * time.Minute, want: 1},
+		{at: 60 * time.Minute, want: 2},
+	}
+	for _, tt := range tests {
+		remindEscalations(start.Add(tt.at))
+		escalating.Wait()
+		mu.Lock()
+		got := len(received)
+		mu.Unlock()
+		if got != tt.want {
+			t.Errorf("after %s: %d reminder(s), want %d", tt.at, got, tt.want)
+		}
+	}
+
+	first := received[0]
+	want := "Still trying to deliver DiskFull (firing) to Google Chat via route default after 3 attempt(s) over 30m: timeout"
+	if first["requestId"] != "req-1" || first["pending"] != true || first["error"] != "timeout" {
+		t.Errorf("Unexpected reminder %v", first)
+	}
+	f := DeliveryFailure{RequestID: "req-1", Route: defaultRouteName, Status: "firing", Alerts: []string{"DiskFull"}, Attempts: 3, Pending: true, Since: start, Error: "timeout", At: start.Add(30 * time.Minute)}
+	if got := f.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
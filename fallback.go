@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// sendWithFallback sends message through provider. When Chat rejects a
+// message with cards as a bad request, e.g. because a template produced an
+// invalid card, the alert is sent again as plain text so it is not lost.
+// Each call is recorded as one attempt in the delivery log and the health of
+// its destination.
+func sendWithFallback(ctx context.Context, provider Provider, message *GoogleChatMessage, opts SendOptions) (err error) {
+	start := clock.Now()
+	defer func() {
+		deliveries.Record(opts, message, start, err)
+		destinationHealth.Record(opts, clock.Now(), err)
+	}()
+
+	err = provider.Send(ctx, message, opts)
+	if !cardRejected(err, message) {
+		return err
+	}
+	logger.ErrorRepeated("Google Chat rejected the card for "+opts.destination()+": "+errorText(err),
+		"[%s] Google Chat rejected the card, sending the alert as text: %v", opts.ReqID, err)
+	cardFallbacks.WithLabelValues(opts.Route).Inc()
+	if ferr := provider.Send(ctx, plainTextMessage(message), opts); ferr != nil {
+		return fmt.Errorf("%v (text fallback failed: %w)", err, ferr)
+	}
+	return nil
+}
+
+// cardRejected reports whether err is Chat refusing a message with cards.
+func cardRejected(err error, message *GoogleChatMessage) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusBadRequest &&
+		(len(message.Cards) > 0 || len(message.CardsV2) > 0)
+}
+
+// plainTextMessage renders the cards of message as text, for a message
+// Chat accepts whatever is wrong with the cards.
+func plainTextMessage(message *GoogleChatMessage) *GoogleChatMessage {
+	var lines []string
+	if message.Text != "" {
+		lines = append(lines, message.Text)
+	}
+	for _, card := range message.Cards {
+		lines = append(lines, "")
+		lines = appendHeaderText(lines, card.Header)
+		for _, section := range card.Sections {
+			if section.Header != "" {
+				lines = append(lines, "*"+htmlToText(section.Header)+"*")
+			}
+			for _, w := range section.Widgets {
+				lines = appendWidgetText(lines, w)
+			}
+		}
+	}
+	for _, card := range message.CardsV2 {
+		lines = append(lines, "")
+		lines = appendHeaderText(lines, card.Card.Header)
+		for _, section := range card.Card.Sections {
+			if section.Header != "" {
+				lines = append(lines, "*"+htmlToText(section.Header)+"*")
+			}
+			for _, w := range section.Widgets {
+				lines = appendWidgetV2Text(lines, w)
+			}
+		}
+	}
+	return &GoogleChatMessage{
+		Text:      strings.TrimSpace(strings.Join(lines, "\n")),
+		ThreadKey: message.ThreadKey,
+		AlertKeys: message.AlertKeys,
+		GroupKey:  message.GroupKey,
+	}
+}
+
+func appendHeaderText(lines []string, header *CardHeader) []string {
+	if header == nil {
+		return lines
+	}
+	lines = append(lines, "*"+header.Title+"*")
+	if header.Subtitle != "" {
+		lines = append(lines, header.Subtitle)
+	}
+	return lines
+}
+
+func appendWidgetText(lines []string, w Widget) []string {
+	switch {
+	case w.TextParagraph != nil:
+		lines = append(lines, htmlToText(w.TextParagraph.Text))
+	case w.KeyValue != nil:
+		lines = append(lines, labeledText(w.KeyValue.TopLabel, w.KeyValue.Content, w.KeyValue.BottomLabel))
+	case w.Table != nil:
+		lines = append(lines, "*"+w.Table.Title+"*")
+		for _, row := range w.Table.Rows {
+			lines = append(lines, row.Name+": "+row.Value)
+		}
+	}
+	for _, b := range w.Buttons {
+		if b.TextButton != nil && b.TextButton.OnClick != nil && b.TextButton.OnClick.OpenLink != nil {
+			lines = append(lines, "<"+b.TextButton.OnClick.OpenLink.URL+"|"+b.TextButton.Text+">")
+		}
+	}
+	return lines
+}
+
+func appendWidgetV2Text(lines []string, w WidgetV2) []string {
+	switch {
+	case w.TextParagraph != nil:
+		lines = append(lines, htmlToText(w.TextParagraph.Text))
+	case w.DecoratedText != nil:
+		lines = append(lines, labeledText(w.DecoratedText.TopLabel, w.DecoratedText.Text, w.DecoratedText.BottomLabel))
+	case w.Columns != nil:
+		// Columns hold a name and its value side by side.
+		var cells []string
+		for _, column := range w.Columns.ColumnItems {
+			var text []string
+			for _, cw := range column.Widgets {
+				text = appendWidgetV2Text(text, cw)
+			}
+			cells = append(cells, strings.Join(text, " "))
+		}
+		lines = append(lines, strings.Join(cells, ": "))
+	case w.ChipList != nil:
+		var labels []string
+		for _, c := range w.ChipList.Chips {
+			labels = append(labels, c.Label)
+		}
+		lines = append(lines, strings.Join(labels, ", "))
+	case w.ButtonList != nil:
+		for _, b := range w.ButtonList.Buttons {
+			if b.OnClick != nil && b.OnClick.OpenLink != nil {
+				lines = append(lines, "<"+b.OnClick.OpenLink.URL+"|"+b.Text+">")
+			}
+		}
+	}
+	return lines
+}
+
+// labeledText renders a key-value widget as "label: content (bottom)".
+func labeledText(top, content, bottom string) string {
+	text := htmlToText(content)
+	if top != "" {
+		text = htmlToText(top) + ": " + text
+	}
+	if bottom != "" {
+		text += " (" + htmlToText(bottom) + ")"
+	}
+	return text
+}
+
+var (
+	anchorTag = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	htmlTag   = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	htmlMarks = strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "<b>", "*", "</b>", "*", "<i>", "_", "</i>", "_")
+)
+
+// htmlToText converts the HTML subset allowed in card text to Chat's text
+// formatting: bold and italics become *bold* and _italics_, links become
+// <url|text> and other tags are removed.
+func htmlToText(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range anchorTag.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(stripHTML(s[last:m[0]]))
+		fmt.Fprintf(&b, "<%s|%s>", html.UnescapeString(s[m[2]:m[3]]), stripHTML(s[m[4]:m[5]]))
+		last = m[1]
+	}
+	b.WriteString(stripHTML(s[last:]))
+	return b.String()
+}
+
+func stripHTML(s string) string {
+	return html.UnescapeString(htmlTag.ReplaceAllString(htmlMarks.Replace(s), ""))
+}
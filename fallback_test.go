@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// cardRejectingProvider rejects messages with cards like Chat does for an
+// invalid card.
+type cardRejectingProvider struct {
+	*MockProvider
+}
+
+func (p *cardRejectingProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error {
+	if len(message.Cards) > 0 || len(message.CardsV2) > 0 {
+		return &HTTPStatusError{StatusCode: http.StatusBadRequest, Body: "Invalid JSON payload received"}
+	}
+	return p.MockProvider.Send(ctx, message, opts)
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"<b>Bold</b><br><i>italic</i>", "*Bold*\n_italic_"},
+		{`<font color="#D93025">red</font> &amp; more`, "red & more"},
+		{`see <a href="https://example.com/?a=1&amp;b=2">the <b>runbook</b></a>`, "see <https://example.com/?a=1&b=2|the *runbook*>"},
+	}
+	for _, tt := range tests {
+		if got := htmlToText(tt.in); got != tt.want {
+			t.Errorf("htmlToText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSendWithFallback(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	payload := &AlertManagerPayload{
+		Status: "firing",
+		Alerts: Alerts{{
+			Status:      "firing",
+			Labels:      KV{"alertname": "DiskFull", "instance": "db-1"},
+			Annotations: KV{"summary": "Disk is 95% full"},
+		}},
+	}
+
+	tests := []struct {
+		name   string
+		layout LayoutConfig
+	}{
+		{"legacy cards", LayoutConfig{}},
+		{"cardsV2 with a label table", LayoutConfig{CardsV2: true, LabelColumns: []string{"*"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := renderMessage(payload, tt.layout, nil)
+			message.ThreadKey = "thread-1"
+
+			provider := &cardRejectingProvider{MockProvider: NewMockProvider(false)}
+			if err := sendWithFallback(context.Background(), provider, message, SendOptions{ReqID: "req-1", Route: "ops"}); err != nil {
+				t.Fatalf("Expected the text fallback to be sent, got %v", err)
+			}
+
+			sent := provider.GetSentMessages()
+			if len(sent) != 1 {
+				t.Fatalf("Expected one message, got %d", len(sent))
+			}
+			fallback := sent[0].message
+			if len(fallback.Cards) != 0 || len(fallback.CardsV2) != 0 || fallback.ThreadKey != "thread-1" {
+				t.Errorf("Expected a text-only message in the same thread, got %+v", fallback)
+			}
+			for _, want := range []string{"DiskFull", "Disk is 95% full", "instance", "db-1"} {
+				if !strings.Contains(fallback.Text, want) {
+					t.Errorf("Expected the text to contain %q, got:\n%s", want, fallback.Text)
+				}
+			}
+			if strings.Contains(fallback.Text, "<b>") || strings.Contains(fallback.Text, "<font") {
+				t.Errorf("Expected no HTML in the text, got:\n%s", fallback.Text)
+			}
+		})
+	}
+
+	t.Run("other errors are returned", func(t *testing.T) {
+		provider := &flakyProvider{errs: []error{&HTTPStatusError{StatusCode: http.StatusBadRequest}}}
+		err := sendWithFallback(context.Background(), provider, &GoogleChatMessage{Text: "text only"}, SendOptions{})
+		if err == nil || provider.calls != 1 {
+			t.Errorf("Expected a text message rejection to fail without a retry, got %v after %d call(s)", err, provider.calls)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+// Filter drops payloads matching its expression.
+type Filter struct {
+	Expr    *Expression
+	Comment string
+}
+
+// NewFilters compiles the [[filter]] blocks from the configuration.
+func NewFilters(cfgs []FilterConfig) ([]*Filter, error) {
+	filters := make([]*Filter, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		if cfg.Expr == "" {
+			return nil, fmt.Errorf("filter %d must have an expr", i)
+		}
+		expr, err := CompileExpression(cfg.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %v", i, err)
+		}
+		filters = append(filters, &Filter{Expr: expr, Comment: cfg.Comment})
+	}
+	return filters, nil
+}
+
+// filtered reports whether any filter drops the payload. Filters that fail
+// to evaluate are logged and do not drop anything.
+func filtered(reqID string, payload *AlertManagerPayload, filters []*Filter) bool {
+	if len(filters) == 0 {
+		return false
+	}
+
+	vars := celActivation(payload)
+	for _, f := range filters {
+		drop, err := f.Expr.Eval(vars)
+		if err != nil {
+			logger.Error("[%s] Error evaluating filter %q: %v", reqID, f.Expr.Source, err)
+			continue
+		}
+		if drop {
+			logger.Info("[%s] Payload dropped by filter (%s)", reqID, f.Comment)
+			payloadsFiltered.Inc()
+			dropAlerts(dropFiltered, len(payload.Alerts))
+			return true
+		}
+	}
+	return false
+}
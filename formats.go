@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PayloadFormat is a webhook payload format accepted on /webhook. Payloads
+// are converted to the AlertManager format before processing, so every
+// upstream can use the same URL.
+type PayloadFormat struct {
+	Name string
+	// Detect reports whether a request with the decoded body doc is in
+	// this format.
+	Detect func(r *http.Request, doc map[string]interface{}) bool
+	// Convert turns the body into an AlertManager payload. A nil Convert
+	// passes the body through unchanged.
+	Convert func(body []byte) (*AlertManagerPayload, error)
+}
+
+const (
+	formatAuto         = "auto"
+	formatAlertManager = "alertmanager"
+	formatGrafana      = "grafana"
+	formatGeneric      = "generic"
+)
+
+// payloadFormats are tried in order; the first format detected wins.
+// Grafana comes first because its payloads also look like AlertManager's.
+var payloadFormats = []PayloadFormat{
+	{Name: formatGrafana, Detect: detectGrafana, Convert: convertGrafana},
+	{Name: formatAlertManager, Detect: detectAlertManager},
+	{Name: formatGeneric, Detect: detectGeneric, Convert: convertGeneric},
+}
+
+func lookupPayloadFormat(name string) (PayloadFormat, bool) {
+	for _, f := range payloadFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return PayloadFormat{}, false
+}
+
+// normalizePayload detects the format of body, or uses format when it is
+// not "auto", and returns the body as an AlertManager payload along with
+// the format's name. Bodies that match no format are returned unchanged
+// for validation to report on.
+func normalizePayload(r *http.Request, body []byte, format string) ([]byte, string, error) {
+	var pf PayloadFormat
+	if format != "" && format != formatAuto {
+		f, ok := lookupPayloadFormat(format)
+		if !ok {
+			return nil, "", fmt.Errorf("unknown payload format %q", format)
+		}
+		pf = f
+	} else {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return body, formatAlertManager, nil
+		}
+		for _, f := range payloadFormats {
+			if f.Detect(r, doc) {
+				pf = f
+				break
+			}
+		}
+		if pf.Name == "" {
+			return body, formatAlertManager, nil
+		}
+	}
+
+	if pf.Convert == nil {
+		return body, pf.Name, nil
+	}
+	payload, err := pf.Convert(body)
+	if err != nil {
+		return nil, pf.Name, fmt.Errorf("invalid %s payload: %v", pf.Name, err)
+	}
+	converted, err := json.Marshal(payload)
+	if err != nil {
+		return nil, pf.Name, err
+	}
+	return converted, pf.Name, nil
+}
+
+func detectAlertManager(r *http.Request, doc map[string]interface{}) bool {
+	_, ok := doc["alerts"].([]interface{})
+	return ok
+}
+
+// detectGrafana recognizes Grafana alerting's webhook contact point by its
+// user agent or the fields it adds to the AlertManager format.
+func detectGrafana(r *http.Request, doc map[string]interface{}) bool {
+	if !detectAlertManager(r, doc) {
+		return false
+	}
+	if strings.HasPrefix(r.UserAgent(), "Grafana") {
+		return true
+	}
+	_, hasOrg := doc["orgId"]
+	_, hasState := doc["state"]
+	return hasOrg && hasState
+}
+
+type grafanaPayload struct {
+	AlertManagerPayload
+	Alerts []grafanaAlert `json:"alerts"`
+}
+
+type grafanaAlert struct {
+	Alert
+	SilenceURL   string `json:"silenceURL"`
+	DashboardURL string `json:"dashboardURL"`
+	PanelURL     string `json:"panelURL"`
+}
+
+// convertGrafana keeps the AlertManager fields of a Grafana payload and
+// turns its dashboard, panel and silence URLs into link annotations, which
+// become buttons on the alert.
+func convertGrafana(body []byte) (*AlertManagerPayload, error) {
+	var g grafanaPayload
+	if err := json.Unmarshal(body, &g); err != nil {
+		return nil, err
+	}
+	payload := g.AlertManagerPayload
+	payload.Version = defaultPayloadVersion
+	prefix := getRuntime().Config.GoogleChat.LinkAnnotationPrefix
+
+	payload.Alerts = make(Alerts, 0, len(g.Alerts))
+	for _, ga := range g.Alerts {
+		alert := ga.Alert
+		if prefix != "" {
+			for name, url := range map[string]string{"dashboard": ga.DashboardURL, "panel": ga.PanelURL, "silence": ga.SilenceURL} {
+				if url == "" {
+					continue
+				}
+				if alert.Annotations == nil {
+					alert.Annotations = KV{}
+				}
+				if _, ok := alert.Annotations[prefix+name]; !ok {
+					alert.Annotations[prefix+name] = url
+				}
+			}
+		}
+		payload.Alerts = append(payload.Alerts, alert)
+	}
+	return &payload, nil
+}
+
+// Fields read from generic payloads, in order of preference.
+var (
+	genericTitleFields    = []string{"title", "alertname", "name"}
+	genericMessageFields  = []string{"message", "text", "description", "summary"}
+	genericStatusFields   = []string{"status", "state"}
+	genericSeverityFields = []string{"severity", "priority"}
+	genericLabelFields    = []string{"labels", "tags"}
+	genericURLFields      = []string{"url", "link"}
+	genericIDFields       = []string{"fingerprint", "id"}
+)
+
+// detectGeneric accepts any JSON object with a title or message, such as
+// one posted by a script or a monitoring tool's generic webhook.
+func detectGeneric(r *http.Request, doc map[string]interface{}) bool {
+	return genericString(doc, genericTitleFields) != "" || genericString(doc, genericMessageFields) != ""
+}
+
+// convertGeneric turns a generic payload into a single alert.
+func convertGeneric(body []byte) (*AlertManagerPayload, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if !detectGeneric(nil, doc) {
+		return nil, fmt.Errorf("a title or message is required")
+	}
+
+	labels := KV{}
+	for _, field := range genericLabelFields {
+		if m, ok := doc[field].(map[string]interface{}); ok {
+			for k, v := range m {
+				labels[k] = fmt.Sprint(v)
+			}
+			break
+		}
+	}
+	title := genericString(doc, genericTitleFields)
+	if title == "" {
+		title = "GenericAlert"
+	}
+	labels["alertname"] = title
+	if severity := genericString(doc, genericSeverityFields); severity != "" {
+		labels["severity"] = strings.ToLower(severity)
+	}
+
+	annotations := KV{}
+	if message := genericString(doc, genericMessageFields); message != "" {
+		annotations["summary"] = message
+	}
+
+	status := "firing"
+	switch strings.ToLower(genericString(doc, genericStatusFields)) {
+	case "resolved", "ok", "closed", "recovered":
+		status = "resolved"
+	}
+
+	now := clock.Now().UTC()
+	alert := Alert{
+		Status:       status,
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     now,
+		GeneratorURL: genericString(doc, genericURLFields),
+		Fingerprint:  genericString(doc, genericIDFields),
+	}
+	if status == "resolved" {
+		alert.EndsAt = now
+	}
+	return &AlertManagerPayload{
+		Version:           defaultPayloadVersion,
+		Receiver:          formatGeneric,
+		Status:            status,
+		Alerts:            Alerts{alert},
+		GroupLabels:       KV{"alertname": title},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+	}, nil
+}
+
+// genericString returns the first of fields set to a scalar in doc.
+func genericString(doc map[string]interface{}, fields []string) string {
+	for _, field := range fields {
+		switch v := doc[field].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case json.Number, float64, bool:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePayload(t *testing.T) {
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{GoogleChat: GoogleChatConfig{LinkAnnotationPrefix: "link_"}}})
+
+	alertmanager := `{"version":"4","status":"firing","receiver":"ops","alerts":[{"status":"firing","labels":{"alertname":"A"}}]}`
+	grafana := `{"receiver":"ops","status":"firing","orgId":1,"state":"alerting","title":"[FIRING:1] A","version":"1",
+		"alerts":[{"status":"firing","labels":{"alertname":"A"},"annotations":{"summary":"s"},"dashboardURL":"https://grafana/d/1","silenceURL":"https://grafana/silence"}]}`
+
+	tests := []struct {
+		name      string
+		userAgent string
+		body      string
+		format    string
+		want      string
+		wantErr   bool
+		check     func(t *testing.T, p AlertManagerPayload)
+	}{
+		{name: "alertmanager passes through", body: alertmanager, want: formatAlertManager},
+		{
+			name: "grafana by fields",
+			body: grafana,
+			want: formatGrafana,
+			check: func(t *testing.T, p AlertManagerPayload) {
+				if p.Version != "4" || p.Receiver != "ops" || len(p.Alerts) != 1 {
+					t.Fatalf("Unexpected payload %+v", p)
+				}
+				a := p.Alerts[0].Annotations
+				if a["link_dashboard"] != "https://grafana/d/1" || a["link_silence"] != "https://grafana/silence" || a["summary"] != "s" {
+					t.Errorf("Unexpected annotations %v", a)
+				}
+				if _, ok := a["link_panel"]; ok {
+					t.Errorf("Expected no link for an empty panel URL")
+				}
+			},
+		},
+		{name: "grafana by user agent", userAgent: "Grafana/11.0.0", body: alertmanager, want: formatGrafana},
+		{
+			name: "generic",
+			body: `{"title":"Backup failed","message":"Nightly backup of db-1 failed","severity":"CRITICAL","tags":{"host":"db-1"},"url":"https://ci/1"}`,
+			want: formatGeneric,
+			check: func(t *testing.T, p AlertManagerPayload) {
+				if p.Status != "firing" || len(p.Alerts) != 1 {
+					t.Fatalf("Unexpected payload %+v", p)
+				}
+				a := p.Alerts[0]
+				if a.Labels["alertname"] != "Backup failed" || a.Labels["severity"] != "critical" || a.Labels["host"] != "db-1" {
+					t.Errorf("Unexpected labels %v", a.Labels)
+				}
+				if a.Annotations["summary"] != "Nightly backup of db-1 failed" || a.GeneratorURL != "https://ci/1" {
+					t.Errorf("Unexpected alert %+v", a)
+				}
+			},
+		},
+		{
+			name: "generic resolved",
+			body: `{"name":"Backup failed","state":"OK","id":42}`,
+			want: formatGeneric,
+			check: func(t *testing.T, p AlertManagerPayload) {
+				if p.Status != "resolved" || p.Alerts[0].Fingerprint != "42" || p.Alerts[0].EndsAt.IsZero() {
+					t.Errorf("Unexpected payload %+v", p)
+				}
+			},
+		},
+		{name: "unknown shape is left for validation", body: `{"foo":"bar"}`, want: formatAlertManager},
+		{name: "forced format", body: `{"text":"hello"}`, format: formatGeneric, want: formatGeneric},
+		{name: "forced format mismatch", body: `{"foo":"bar"}`, format: formatGeneric, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			if tt.userAgent != "" {
+				r.Header.Set("User-Agent", tt.userAgent)
+			}
+			body, format, err := normalizePayload(r, []byte(tt.body), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizePayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if format != tt.want {
+				t.Errorf("Expected format %s, got %s", tt.want, format)
+			}
+			if format == formatAlertManager && string(body) != tt.body {
+				t.Errorf("Expected the body unchanged, got %s", body)
+			}
+			if err := validateAlertPayload(body); err != nil && format != formatAlertManager {
+				t.Errorf("Expected a valid AlertManager payload, got %v", err)
+			}
+			if tt.check != nil {
+				var p AlertManagerPayload
+				if err := json.Unmarshal(body, &p); err != nil {
+					t.Fatal(err)
+				}
+				tt.check(t, p)
+			}
+		})
+	}
+}
+
+func TestWebhookGenericPayload(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	provider := NewMockProvider(false)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"title":"Backup failed","message":"Nightly backup failed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleWebhookWithProvider(rec, req, provider)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	sent := provider.GetSentMessages()
+	if len(sent) != 1 || !strings.Contains(sent[0].message.Text, "Backup failed") {
+		t.Fatalf("Expected the generic alert to be sent, got %+v", sent)
+	}
+}
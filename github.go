@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultGitHubAPIURL = "https://api.github.com"
+	defaultGitHubTitle  = `{{ .Labels.alertname }}{{ with .Annotations.summary }}: {{ . }}{{ end }}`
+	defaultGitHubBody   = `{{ with .Annotations.description }}{{ . }}
+
+{{ end }}| Label | Value |
+| --- | --- |
+{{ range .Labels.SortedPairs }}| {{ .Name }} | {{ .Value }} |
+{{ end }}{{ with .GeneratorURL }}
+[Source]({{ . }}){{ end }}`
+)
+
+// GitHubProvider files a GitHub issue for each firing alert, for alerts that
+// should be fixed eventually rather than acted on in Chat. The alert's
+// fingerprint is added to the issue title, so an alert that keeps firing
+// reuses its open issue, even after a restart.
+type GitHubProvider struct {
+	cfg     GitHubConfig
+	route   string
+	title   *template.Template
+	body    *template.Template
+	sandbox *TemplateSandbox
+}
+
+func NewGitHubProvider(cfg GitHubConfig, route string, snippets *template.Template, sandbox *TemplateSandbox) (*GitHubProvider, error) {
+	if cfg.APIURL == "" {
+		cfg.APIURL = defaultGitHubAPIURL
+	}
+	title, body := cfg.Title, cfg.Body
+	if title == "" {
+		title = defaultGitHubTitle
+	}
+	if body == "" {
+		body = defaultGitHubBody
+	}
+
+	p := &GitHubProvider{cfg: cfg, route: route, sandbox: sandbox}
+	var err error
+	if p.title, err = parseTicketTemplate(snippets, "title", title); err != nil {
+		return nil, fmt.Errorf("invalid github title template: %v", err)
+	}
+	if p.body, err = parseTicketTemplate(snippets, "body", body); err != nil {
+		return nil, fmt.Errorf("invalid github body template: %v", err)
+	}
+	return p, nil
+}
+
+// alertFingerprint returns AlertManager's fingerprint for the alert, or a
+// hash of its labels when it was not sent.
+func alertFingerprint(alert Alert) string {
+	if alert.Fingerprint != "" {
+		return alert.Fingerprint
+	}
+	sum := sha256.Sum256([]byte(alert.Labels.SortedPairs().String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Ticket opens an issue for each firing alert without one, and comments on,
+// and optionally closes, the issues of resolved alerts.
+func (p *GitHubProvider) Ticket(ctx context.Context, payload *AlertManagerPayload, reqID string) error {
+	for _, alert := range payload.Alerts {
+		fingerprint := alertFingerprint(alert)
+		key := "github/" + p.route + "/" + fingerprint
+		issue, ok := tickets.Get(key)
+		if !ok {
+			number, err := p.findIssue(ctx, fingerprint)
+			if err != nil {
+				return err
+			}
+			if number > 0 {
+				issue, ok = strconv.Itoa(number), true
+			}
+		}
+
+		if alert.Status == "resolved" {
+			if !ok {
+				continue
+			}
+			if err := p.resolve(ctx, issue, alert); err != nil {
+				return err
+			}
+			logger.Info("[%s] Resolved GitHub issue %s#%s", reqID, p.cfg.Repo, issue)
+			if err := tickets.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+		if ok {
+			if err := tickets.Set(key, issue); err != nil {
+				return err
+			}
+			continue
+		}
+
+		number, err := p.create(ctx, alert, fingerprint)
+		if err != nil {
+			return err
+		}
+		logger.Info("[%s] Created GitHub issue %s#%d", reqID, p.cfg.Repo, number)
+		if err := tickets.Set(key, strconv.Itoa(number)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findIssue searches the repository for an open issue with the fingerprint
+// in its title, returning 0 when there is none.
+func (p *GitHubProvider) findIssue(ctx context.Context, fingerprint string) (int, error) {
+	q := fmt.Sprintf(`repo:%s is:issue is:open in:title "%s"`, p.cfg.Repo, fingerprint)
+	var result struct {
+		Items []struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
+		} `json:"items"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/search/issues?q="+url.QueryEscape(q), nil, &result); err != nil {
+		return 0, fmt.Errorf("error searching GitHub issues: %v", err)
+	}
+	for _, item := range result.Items {
+		if strings.Contains(item.Title, "["+fingerprint+"]") {
+			return item.Number, nil
+		}
+	}
+	return 0, nil
+}
+
+// Preview renders the issue title and body for each alert in payload
+// without calling GitHub.
+func (p *GitHubProvider) Preview(payload *AlertManagerPayload) (map[string]string, error) {
+	fields := map[string]string{"provider": "github"}
+	for i, alert := range payload.Alerts {
+		title, body, err := p.render(alert, alertFingerprint(alert))
+		if err != nil {
+			return nil, fmt.Errorf("alert %d: %v", i+1, err)
+		}
+		fields[fmt.Sprintf("alert %d title", i+1)] = title
+		fields[fmt.Sprintf("alert %d body", i+1)] = body
+	}
+	return fields, nil
+}
+
+// render renders the title and body of the issue for alert.
+func (p *GitHubProvider) render(alert Alert, fingerprint string) (title, body string, err error) {
+	if title, err = renderTicketTemplate(p.sandbox, p.title, &alert); err != nil {
+		return "", "", fmt.Errorf("error rendering title: %v", err)
+	}
+	if body, err = renderTicketTemplate(p.sandbox, p.body, &alert); err != nil {
+		return "", "", fmt.Errorf("error rendering body: %v", err)
+	}
+	return fmt.Sprintf("%s [%s]", title, fingerprint), body, nil
+}
+
+func (p *GitHubProvider) create(ctx context.Context, alert Alert, fingerprint string) (int, error) {
+	title, body, err := p.render(alert, fingerprint)
+	if err != nil {
+		return 0, err
+	}
+
+	labels := p.cfg.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	var created struct {
+		Number int `json:"number"`
+	}
+	err = p.call(ctx, http.MethodPost, "/repos/"+p.cfg.Repo+"/issues", map[string]interface{}{
+		"title":  title,
+		"body":   body,
+		"labels": labels,
+	}, &created)
+	if err != nil {
+		return 0, fmt.Errorf("error creating GitHub issue: %v", err)
+	}
+	return created.Number, nil
+}
+
+func (p *GitHubProvider) resolve(ctx context.Context, issue string, alert Alert) error {
+	comment := "Alert resolved."
+	if !alert.EndsAt.IsZero() {
+		comment = fmt.Sprintf("Alert resolved at %s.", alert.EndsAt.UTC().Format(time.RFC3339))
+	}
+	if err := p.call(ctx, http.MethodPost, "/repos/"+p.cfg.Repo+"/issues/"+issue+"/comments", map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("error commenting on GitHub issue #%s: %v", issue, err)
+	}
+	if !p.cfg.CloseOnResolve {
+		return nil
+	}
+	if err := p.call(ctx, http.MethodPatch, "/repos/"+p.cfg.Repo+"/issues/"+issue, map[string]string{"state": "closed", "state_reason": "completed"}, nil); err != nil {
+		return fmt.Errorf("error closing GitHub issue #%s: %v", issue, err)
+	}
+	return nil
+}
+
+// call sends a JSON request to the GitHub REST API.
+func (p *GitHubProvider) call(ctx context.Context, method, path string, in, out interface{}) (err error) {
+	start := clock.Now()
+	defer func() {
+		status := statusSuccess
+		if err != nil {
+			status = statusError
+			providerErrors.WithLabelValues("github").Inc()
+		}
+		observeDuration(ctx, providerRequestDuration.WithLabelValues("github", status), clock.Since(start).Seconds())
+	}()
+
+	token, err := secretValue(p.cfg.Token, p.cfg.TokenFile)
+	if err != nil {
+		return fmt.Errorf("error reading GitHub token: %v", err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.cfg.APIURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	req, span := startClientSpan(ctx, "github."+strings.ToLower(method), req)
+	defer func() { endSpan(span, err) }()
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
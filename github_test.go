@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitHubProvider(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { tickets = NewTicketStore("") }()
+	tickets = NewTicketStore("")
+
+	var calls []string
+	var created map[string]interface{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer ghp_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /search/issues":
+			if created == nil {
+				fmt.Fprint(w, `{"items":[]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"items":[{"number":7,"title":%q}]}`, created["title"])
+		case "POST /repos/acme/infra/issues":
+			json.NewDecoder(r.Body).Decode(&created)
+			fmt.Fprint(w, `{"number":7}`)
+		case "POST /repos/acme/infra/issues/7/comments", "PATCH /repos/acme/infra/issues/7":
+			fmt.Fprint(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { sharedHTTPClient = client }(sharedHTTPClient)
+	sharedHTTPClient = server.Client()
+
+	cfg := Config{Routes: []RouteConfig{{
+		Name:        "eventually",
+		Matchers:    []string{`severity="info"`},
+		DisableChat: true,
+		GitHub: &GitHubConfig{
+			Repo:           "acme/infra",
+			APIURL:         server.URL,
+			Token:          "ghp_test",
+			Labels:         []string{"alert"},
+			CloseOnResolve: true,
+		},
+	}}}
+	if err := cfg.Routes[0].GitHub.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	rt, err := NewRuntime(cfg)
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(rt)
+
+	provider := NewMockProvider(false)
+	post := func(status string) {
+		alert := Alert{
+			Status:      status,
+			Fingerprint: "a1b2c3",
+			Labels:      KV{"alertname": "CertExpiring", "severity": "info"},
+			Annotations: KV{"summary": "Certificate expires in 20 days"},
+			StartsAt:    time.Now(),
+		}
+		body, err := json.Marshal(AlertManagerPayload{Status: status, CommonLabels: alert.Labels, Alerts: Alerts{alert}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handleWebhookWithProvider(rr, req, provider)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body)
+		}
+	}
+
+	post("firing")
+	post("firing")
+	tickets = NewTicketStore("")
+	post("firing")
+	post("resolved")
+
+	if created["title"] != "CertExpiring: Certificate expires in 20 days [a1b2c3]" {
+		t.Errorf("Unexpected title %v", created["title"])
+	}
+	if body, _ := created["body"].(string); !strings.Contains(body, "| severity | info |") {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if got := len(provider.GetSentMessages()); got != 0 {
+		t.Errorf("Expected no Chat messages with chat disabled, got %d", got)
+	}
+
+	want := []string{
+		"GET /search/issues",
+		"POST /repos/acme/infra/issues",
+		"GET /search/issues",
+		"POST /repos/acme/infra/issues/7/comments",
+		"PATCH /repos/acme/infra/issues/7",
+	}
+	if strings.Join(calls, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Unexpected GitHub calls %v, want %v", calls, want)
+	}
+
+	for _, repo := range []string{"acme", "acme/", "/infra", "acme/infra/x"} {
+		if err := (GitHubConfig{Repo: repo}).Validate(); err == nil {
+			t.Errorf("Expected error for repo %q", repo)
+		}
+	}
+}
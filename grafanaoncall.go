@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// GrafanaOnCallProvider forwards each notification a route sends to a
+// Grafana OnCall (IRM) AlertManager integration, so escalation in OnCall
+// sees the same routed, filtered and enriched alerts as the Chat space.
+// OnCall groups and resolves alerts itself, by groupKey and status.
+type GrafanaOnCallProvider struct {
+	cfg GrafanaOnCallConfig
+}
+
+func NewGrafanaOnCallProvider(cfg GrafanaOnCallConfig) *GrafanaOnCallProvider {
+	return &GrafanaOnCallProvider{cfg: cfg}
+}
+
+// Ticket posts payload to the integration URL in the AlertManager webhook
+// format.
+func (p *GrafanaOnCallProvider) Ticket(ctx context.Context, payload *AlertManagerPayload, reqID string) (err error) {
+	start := clock.Now()
+	defer func() {
+		status := statusSuccess
+		if err != nil {
+			status = statusError
+			providerErrors.WithLabelValues("grafana_oncall").Inc()
+		}
+		observeDuration(ctx, providerRequestDuration.WithLabelValues("grafana_oncall", status), clock.Since(start).Seconds())
+	}()
+
+	integrationURL, err := secretValue(p.cfg.URL, p.cfg.URLFile)
+	if err != nil {
+		return fmt.Errorf("error reading Grafana OnCall integration URL: %v", err)
+	}
+	forwarded := *payload
+	if forwarded.Version == "" {
+		forwarded.Version = latestPayloadVersion
+	}
+	data, err := json.Marshal(forwarded)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, integrationURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid Grafana OnCall integration URL: %v", errorText(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	req, span := startClientSpan(ctx, "grafana_oncall.post", req)
+	defer func() { endSpan(span, err) }()
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error forwarding to Grafana OnCall: %v", errorText(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error forwarding to Grafana OnCall: %w", &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+	logger.Info("[%s] Forwarded %d alert(s) to Grafana OnCall", reqID, len(payload.Alerts))
+	return nil
+}
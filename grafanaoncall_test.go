@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrafanaOnCallProvider(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	var received []AlertManagerPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/integrations/v1/alertmanager/abc/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var payload AlertManagerPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, payload)
+	}))
+	defer server.Close()
+
+	urlFile := filepath.Join(t.TempDir(), "oncall-url")
+	if err := os.WriteFile(urlFile, []byte(server.URL+"/integrations/v1/alertmanager/abc/\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		cfg        GrafanaOnCallConfig
+		wantStatus int
+	}{
+		{name: "url", cfg: GrafanaOnCallConfig{URL: server.URL + "/integrations/v1/alertmanager/abc/"}},
+		{name: "url file", cfg: GrafanaOnCallConfig{URLFile: urlFile}},
+		{name: "unknown integration", cfg: GrafanaOnCallConfig{URL: server.URL + "/integrations/v1/alertmanager/missing/"}, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			payload := &AlertManagerPayload{
+				GroupKey: "{}:{alertname=\"DiskFull\"}",
+				Status:   "firing",
+				Alerts:   Alerts{{Status: "firing", Labels: KV{"alertname": "DiskFull"}}},
+			}
+			err := NewGrafanaOnCallProvider(tt.cfg).Ticket(context.Background(), payload, "req-1")
+			if tt.wantStatus != 0 {
+				var statusErr *HTTPStatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+					t.Fatalf("Ticket() error = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Ticket() error = %v", err)
+			}
+			if len(received) != 1 {
+				t.Fatalf("OnCall received %d payloads, want 1", len(received))
+			}
+			got := received[0]
+			if got.Version != latestPayloadVersion || got.GroupKey != payload.GroupKey || got.Alerts[0].Labels["alertname"] != "DiskFull" {
+				t.Errorf("OnCall received %+v", got)
+			}
+			if payload.Version != "" {
+				t.Errorf("Ticket() set the version on the caller's payload")
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxHealthError bounds the last error kept for each destination.
+const maxHealthError = 512
+
+// Destinations not delivered to for destinationHealthTTL are forgotten, and
+// at most maxHealthDestinations are kept, so templated and mapped webhooks
+// cannot grow the log and the destination gauges without bound.
+const (
+	destinationHealthTTL  = 24 * time.Hour
+	maxHealthDestinations = 1000
+)
+
+// DestinationHealth is the delivery state of one destination, so a
+// dashboard can show which space is failing.
+type DestinationHealth struct {
+	Destination         string     `json:"destination"`
+	Route               string     `json:"route"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	// CircuitOpen is set while the route's circuit breaker fails sends to
+	// the destination.
+	CircuitOpen bool `json:"circuitOpen,omitempty"`
+
+	lastSeen time.Time
+}
+
+// DestinationHealthLog tracks the outcome of deliveries per destination and
+// mirrors it in the destination gauges.
+type DestinationHealthLog struct {
+	mu           sync.Mutex
+	destinations map[string]*DestinationHealth
+}
+
+var destinationHealth = NewDestinationHealthLog()
+
+func NewDestinationHealthLog() *DestinationHealthLog {
+	return &DestinationHealthLog{destinations: map[string]*DestinationHealth{}}
+}
+
+// SetCircuitOpen records whether the circuit breaker of the destination of
+// opts is open.
+func (l *DestinationHealthLog) SetCircuitOpen(opts SendOptions, open bool) {
+	name := opts.destination()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	d := l.destination(opts, clock.Now())
+	d.CircuitOpen = open
+	value := 0.0
+	if open {
+		value = 1
+	}
+	destinationCircuitOpen.WithLabelValues(d.Route, name).Set(value)
+}
+
+// Record updates the destination of opts with an attempt that finished at
+// at with err.
+func (l *DestinationHealthLog) Record(opts SendOptions, at time.Time, err error) {
+	name := opts.destination()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	d := l.destination(opts, at)
+	if err == nil {
+		d.LastSuccess = &at
+		d.ConsecutiveFailures = 0
+		destinationLastSuccess.WithLabelValues(d.Route, name).Set(float64(at.Unix()))
+		// A breaker replaced by a reload never closes; any success means
+		// the destination is not cut off.
+		if d.CircuitOpen {
+			d.CircuitOpen = false
+			destinationCircuitOpen.WithLabelValues(d.Route, name).Set(0)
+		}
+	} else {
+		d.LastFailure = &at
+		d.ConsecutiveFailures++
+		d.LastError = errorText(err)
+		if len(d.LastError) > maxHealthError {
+			d.LastError = d.LastError[:maxHealthError]
+		}
+	}
+	destinationFailures.WithLabelValues(d.Route, name).Set(float64(d.ConsecutiveFailures))
+}
+
+// destination returns the entry for the destination of opts, seen at now,
+// adding it if needed. l.mu must be held.
+func (l *DestinationHealthLog) destination(opts SendOptions, now time.Time) *DestinationHealth {
+	name := opts.destination()
+	d, ok := l.destinations[name]
+	if !ok {
+		l.evict(now)
+		d = &DestinationHealth{Destination: name, Route: opts.Route}
+		l.destinations[name] = d
+	}
+	if now.After(d.lastSeen) {
+		d.lastSeen = now
+	}
+	return d
+}
+
+// evict forgets destinations idle for destinationHealthTTL, unless their
+// circuit is open, and, when the log is still full, the least recently seen
+// one, along with their gauges. l.mu must be held.
+func (l *DestinationHealthLog) evict(now time.Time) {
+	var oldest *DestinationHealth
+	for _, d := range l.destinations {
+		if !d.CircuitOpen && now.Sub(d.lastSeen) >= destinationHealthTTL {
+			l.forget(d)
+			continue
+		}
+		if oldest == nil || d.lastSeen.Before(oldest.lastSeen) {
+			oldest = d
+		}
+	}
+	if len(l.destinations) >= maxHealthDestinations {
+		l.forget(oldest)
+	}
+}
+
+func (l *DestinationHealthLog) forget(d *DestinationHealth) {
+	delete(l.destinations, d.Destination)
+	destinationFailures.DeleteLabelValues(d.Route, d.Destination)
+	destinationLastSuccess.DeleteLabelValues(d.Route, d.Destination)
+	destinationCircuitOpen.DeleteLabelValues(d.Route, d.Destination)
+}
+
+// Snapshot returns every destination delivered to, sorted by name.
+func (l *DestinationHealthLog) Snapshot() []DestinationHealth {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]DestinationHealth, 0, len(l.destinations))
+	for _, d := range l.destinations {
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Destination < list[j].Destination })
+	return list
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDestinationHealthLog(t *testing.T) {
+	l := NewDestinationHealthLog()
+	start := time.Unix(1700000000, 0)
+	failure := errors.New("posting to https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t: " + strings.Repeat("x", maxHealthError))
+
+	steps := []struct {
+		opts         SendOptions
+		err          error
+		wantFailures int
+	}{
+		{opts: SendOptions{Route: "ops", Destination: "ops/web"}, wantFailures: 0},
+		{opts: SendOptions{Route: "ops", Destination: "ops/web"}, err: failure, wantFailures: 1},
+		{opts: SendOptions{Route: "ops", Destination: "ops/web"}, err: failure, wantFailures: 2},
+		{opts: SendOptions{Route: "ops", Destination: "ops/db"}, wantFailures: 0},
+		{opts: SendOptions{Route: "default"}, err: failure, wantFailures: 1},
+	}
+	for i, step := range steps {
+		l.Record(step.opts, start.Add(time.Duration(i)*time.Minute), step.err)
+
+		destination := step.opts.Destination
+		if destination == "" {
+			destination = step.opts.Route
+		}
+		var m dto.Metric
+		if err := destinationFailures.WithLabelValues(step.opts.Route, destination).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		if got := int(m.GetGauge().GetValue()); got != step.wantFailures {
+			t.Errorf("step %d: consecutive failures gauge = %d, want %d", i, got, step.wantFailures)
+		}
+	}
+
+	got := l.Snapshot()
+	var names []string
+	for _, d := range got {
+		names = append(names, d.Destination)
+	}
+	if strings.Join(names, ",") != "default,ops/db,ops/web" {
+		t.Fatalf("Snapshot() destinations = %v, want sorted by name", names)
+	}
+	web := got[2]
+	if web.ConsecutiveFailures != 2 || !web.LastSuccess.Equal(start) || !web.LastFailure.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("ops/web = %+v", web)
+	}
+	if len(web.LastError) != maxHealthError || strings.Contains(web.LastError, "token") {
+		t.Errorf("ops/web last error = %q, want it bounded and without the query string", web.LastError)
+	}
+	if db := got[1]; db.LastFailure != nil || db.LastError != "" {
+		t.Errorf("ops/db = %+v, want no failure", db)
+	}
+
+	var m dto.Metric
+	if err := destinationLastSuccess.WithLabelValues("ops", "ops/web").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := int64(m.GetGauge().GetValue()); got != start.Unix() {
+		t.Errorf("last success gauge = %d, want %d", got, start.Unix())
+	}
+}
+
+func TestDestinationHealthLogEviction(t *testing.T) {
+	l := NewDestinationHealthLog()
+	start := time.Unix(1700000000, 0)
+	failure := errors.New("unavailable")
+
+	l.Record(SendOptions{Route: "ops", Destination: "ops/idle"}, start, failure)
+	l.SetCircuitOpen(SendOptions{Route: "ops", Destination: "ops/open"}, true)
+	l.Record(SendOptions{Route: "ops", Destination: "ops/open"}, start, failure)
+	l.Record(SendOptions{Route: "ops", Destination: "ops/new"}, start.Add(destinationHealthTTL), nil)
+
+	var names []string
+	for _, d := range l.Snapshot() {
+		names = append(names, d.Destination)
+	}
+	if strings.Join(names, ",") != "ops/new,ops/open" {
+		t.Errorf("Snapshot() destinations = %v, want the idle destination evicted", names)
+	}
+	var m dto.Metric
+	if err := destinationFailures.WithLabelValues("ops", "ops/idle").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.GetGauge().GetValue() != 0 {
+		t.Error("Expected the gauge of the evicted destination to be deleted")
+	}
+
+	for i := 0; len(l.destinations) < maxHealthDestinations; i++ {
+		l.Record(SendOptions{Route: "ops", Destination: fmt.Sprintf("ops/%d", i)}, start.Add(destinationHealthTTL+time.Duration(i+1)*time.Second), nil)
+	}
+	l.Record(SendOptions{Route: "ops", Destination: "ops/last"}, start.Add(2*destinationHealthTTL-time.Second), nil)
+	if len(l.destinations) != maxHealthDestinations {
+		t.Errorf("Expected at most %d destinations, got %d", maxHealthDestinations, len(l.destinations))
+	}
+	if _, ok := l.destinations["ops/new"]; ok {
+		t.Error("Expected the least recently seen destination to be evicted")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Heartbeat tracks when the last notification arrived, so a silent
+// Alertmanager is noticed rather than mistaken for a quiet one.
+type Heartbeat struct {
+	mu   sync.Mutex
+	last time.Time
+	// warned is set once the current silence has been reported.
+	warned bool
+}
+
+var heartbeat = NewHeartbeat(clock.Now())
+
+// NewHeartbeat returns a Heartbeat that counts silence from start.
+func NewHeartbeat(start time.Time) *Heartbeat {
+	return &Heartbeat{last: start}
+}
+
+// Seen records a notification arriving at now.
+func (h *Heartbeat) Seen(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = now
+	h.warned = false
+}
+
+// Silent returns how long nothing has arrived at now, and whether that is
+// a silence of at least maxSilence not yet reported. Each silence is
+// reported once.
+func (h *Heartbeat) Silent(now time.Time, maxSilence time.Duration) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	silence := now.Sub(h.last)
+	if h.warned || silence < maxSilence {
+		return silence, false
+	}
+	h.warned = true
+	return silence, true
+}
+
+// checkHeartbeat posts a warning through the heartbeat route, or the
+// default route, when no notification has arrived for max_silence.
+func checkHeartbeat(provider Provider, now time.Time) error {
+	rt := getRuntime()
+	cfg := rt.Config.Heartbeat
+	if cfg.MaxSilence <= 0 {
+		return nil
+	}
+	silence, warn := heartbeat.Silent(now, cfg.MaxSilence)
+	if !warn {
+		return nil
+	}
+
+	route := rt.DefaultRoute
+	for _, r := range rt.Routes {
+		if r.Name == cfg.Route {
+			route = r
+		}
+	}
+	if route == nil {
+		route = &Route{Name: defaultRouteName}
+	}
+	reqID := newRequestID("heartbeat")
+	logger.Error("[%s] No notifications received for %s", reqID, formatDuration(silence))
+	message := &GoogleChatMessage{
+		Text: fmt.Sprintf("No notifications received from Alertmanager for %s. Check that Alertmanager is running and its webhook points here.", formatDuration(silence)),
+	}
+	return route.Send(context.Background(), provider, message, reqID)
+}
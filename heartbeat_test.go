@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckHeartbeat(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	defer func() { heartbeat = NewHeartbeat(time.Now()) }()
+
+	provider := NewMockProvider(false)
+	currentRuntime.Store(&Runtime{
+		Config:       Config{Heartbeat: HeartbeatConfig{MaxSilence: time.Hour}},
+		DefaultRoute: &Route{Name: defaultRouteName},
+	})
+	start := time.Now()
+	heartbeat = NewHeartbeat(start)
+
+	for _, now := range []time.Time{start.Add(30 * time.Minute), start.Add(time.Hour), start.Add(2 * time.Hour)} {
+		if err := checkHeartbeat(provider, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(provider.GetSentMessages()); got != 1 {
+		t.Fatalf("sent %d warnings, want 1 per silence", got)
+	}
+
+	heartbeat.Seen(start.Add(3 * time.Hour))
+	checkHeartbeat(provider, start.Add(4*time.Hour))
+	if got := len(provider.GetSentMessages()); got != 2 {
+		t.Errorf("sent %d warnings, want another after the next silence", got)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// historyRetention is how long delivered notifications are kept, enough for
+// a weekly report with some slack.
+const historyRetention = 35 * 24 * time.Hour
+
+// maxHistoryQuery bounds the entries returned by the history API.
+const maxHistoryQuery = 1000
+
+// HistoryEntry records one alert in a delivered notification.
+type HistoryEntry struct {
+	At        time.Time `json:"at"`
+	ReqID     string    `json:"reqId,omitempty"`
+	Key       string    `json:"key"`
+	Alertname string    `json:"alertname"`
+	Labels    KV        `json:"labels"`
+	Status    string    `json:"status"`
+	Route     string    `json:"route"`
+	// Receiver is the AlertManager receiver of the notification, which
+	// routes with receivers are restricted to.
+	Receiver string    `json:"receiver,omitempty"`
+	StartsAt time.Time `json:"startsAt,omitempty"`
+	EndsAt   time.Time `json:"endsAt,omitempty"`
+	// Annotations and GeneratorURL are kept for the details page.
+	Annotations  KV     `json:"annotations,omitempty"`
+	GeneratorURL string `json:"generatorURL,omitempty"`
+}
+
+// History keeps the alerts of every delivered notification for reports.
+// With a path, entries are appended to a JSON lines file so the history
+// survives restarts.
+type History struct {
+	mu      sync.Mutex
+	path    string
+	entries []HistoryEntry
+	maxAge  time.Duration
+	// stale counts the lines in the file for entries no longer kept, which
+	// the next compaction removes.
+	stale int
+}
+
+var history = NewHistory("")
+
+func NewHistory(path string) *History {
+	return &History{path: path, maxAge: historyRetention}
+}
+
+// LoadHistory opens the history persisted at path, dropping entries older
+// than maxAge and rewriting the file without them.
+func LoadHistory(path string, now time.Time, maxAge time.Duration) (*History, error) {
+	h := NewHistory(path)
+	h.maxAge = maxAge
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash can leave a partial last line behind.
+			continue
+		}
+		if now.Sub(entry.At) <= h.maxAge {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+
+	if err := h.rewrite(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Record adds the alerts of the notification for reqID, delivered via route
+// at now.
+func (h *History) Record(reqID, route string, payload *AlertManagerPayload, now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	added := make([]HistoryEntry, 0, len(payload.Alerts))
+	for _, alert := range payload.Alerts {
+		added = append(added, HistoryEntry{
+			At:           now,
+			ReqID:        reqID,
+			Key:          alertKey(alert),
+			Alertname:    alert.Labels["alertname"],
+			Labels:       alert.Labels,
+			Status:       alert.Status,
+			Route:        route,
+			Receiver:     payload.Receiver,
+			StartsAt:     alert.StartsAt,
+			EndsAt:       alert.EndsAt,
+			Annotations:  alert.Annotations,
+			GeneratorURL: alert.GeneratorURL,
+		})
+	}
+	for len(h.entries) > 0 && now.Sub(h.entries[0].At) > h.maxAge {
+		h.entries = h.entries[1:]
+		h.stale++
+		stateEntriesDropped.WithLabelValues("history", "age").Inc()
+	}
+	h.entries = append(h.entries, added...)
+	return h.append(added)
+}
+
+// Between returns the entries recorded in [from, to), oldest first.
+func (h *History) Between(from, to time.Time) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var entries []HistoryEntry
+	for _, entry := range h.entries {
+		if !entry.At.Before(from) && entry.At.Before(to) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ByRequest returns the entries recorded for the notification of reqID.
+func (h *History) ByRequest(reqID string) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var entries []HistoryEntry
+	for _, entry := range h.entries {
+		if entry.ReqID == reqID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Compact drops entries older than maxAge and, when maxBytes is set, the
+// oldest entries until the rest fit in maxBytes. The file is rewritten when
+// it holds entries no longer kept. Compact returns the size of the entries
+// kept.
+func (h *History) Compact(now time.Time, maxAge time.Duration, maxBytes int64) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxAge = maxAge
+
+	aged := 0
+	for aged < len(h.entries) && now.Sub(h.entries[aged].At) > maxAge {
+		aged++
+	}
+	var size int64
+	sizes := make([]int64, len(h.entries))
+	for i := aged; i < len(h.entries); i++ {
+		data, err := json.Marshal(h.entries[i])
+		if err != nil {
+			return 0, err
+		}
+		sizes[i] = int64(len(data)) + 1
+		size += sizes[i]
+	}
+	dropped := aged
+	for maxBytes > 0 && size > maxBytes && dropped < len(h.entries) {
+		size -= sizes[dropped]
+		dropped++
+	}
+
+	stateEntriesDropped.WithLabelValues("history", "age").Add(float64(aged))
+	stateEntriesDropped.WithLabelValues("history", "size").Add(float64(dropped - aged))
+	h.entries = append([]HistoryEntry(nil), h.entries[dropped:]...)
+	h.stale += dropped
+	if h.path == "" || h.stale == 0 {
+		return size, nil
+	}
+	if err := h.rewrite(); err != nil {
+		return size, err
+	}
+	h.stale = 0
+	return size, nil
+}
+
+// append writes entries to the end of the history file. The caller must
+// hold h.mu.
+func (h *History) append(entries []HistoryEntry) error {
+	if h.path == "" || len(entries) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing history file: %v", err)
+	}
+	return f.Close()
+}
+
+// rewrite atomically replaces the history file with the entries in memory.
+// The caller must hold h.mu.
+func (h *History) rewrite() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing history file: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range h.entries {
+		enc.Encode(entry)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("error writing history file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing history file: %v", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error finalizing history file: %v", err)
+	}
+	return nil
+}
+
+// historyHandler serves GET /api/v1/history with the delivered alerts of a
+// period, newest first. The period is ?from= and ?to= (RFC 3339), or the
+// past ?since= (default 24h); ?alertname=, ?status= and ?route= filter the
+// entries.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := clock.Now()
+	since := 24 * time.Hour
+	var err error
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid to, must be RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("since"); v != "" {
+		if since, err = time.ParseDuration(v); err != nil || since <= 0 {
+			http.Error(w, "Invalid since, must be a positive duration", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-since)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid from, must be RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryQuery {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	entries := history.Between(from, to)
+	matched := []HistoryEntry{}
+	for i := len(entries) - 1; i >= 0 && len(matched) < limit; i-- {
+		entry := entries[i]
+		if (q.Get("alertname") != "" && entry.Alertname != q.Get("alertname")) ||
+			(q.Get("status") != "" && entry.Status != q.Get("status")) ||
+			(q.Get("route") != "" && entry.Route != q.Get("route")) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matched)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyCache remembers recently processed webhook requests so that
+// AlertManager retrying a slow but successful send does not post twice.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	done    chan struct{}
+	err     error
+	expires time.Time
+}
+
+var idempotency = &idempotencyCache{entries: map[string]*idempotencyEntry{}}
+
+// idempotencyKey returns the Idempotency-Key header, or a hash of the body
+// when the sender did not set one. The body includes AlertManager's groupKey,
+// so identical retries of one notification share a key.
+func idempotencyKey(r *http.Request, body []byte) string {
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		return key
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Do runs fn unless a call with the same key succeeded within window, and
+// reports whether the call was a duplicate. A duplicate arriving while the
+// first call is still running waits for it; if the first call fails, fn
+// runs again.
+func (c *idempotencyCache) Do(key string, window time.Duration, fn func() error) (bool, error) {
+	for {
+		c.mu.Lock()
+		c.evict(clock.Now())
+		e, ok := c.entries[key]
+		if !ok {
+			e = &idempotencyEntry{done: make(chan struct{})}
+			c.entries[key] = e
+			c.mu.Unlock()
+
+			err := fn()
+
+			c.mu.Lock()
+			e.err = err
+			if err != nil {
+				delete(c.entries, key)
+			} else {
+				e.expires = clock.Now().Add(window)
+			}
+			close(e.done)
+			c.mu.Unlock()
+			return false, err
+		}
+		c.mu.Unlock()
+
+		<-e.done
+		if e.err == nil {
+			return true, nil
+		}
+	}
+}
+
+// evict drops completed entries whose window has passed. c.mu must be held.
+func (c *idempotencyCache) evict(now time.Time) {
+	for key, e := range c.entries {
+		select {
+		case <-e.done:
+			if now.After(e.expires) {
+				delete(c.entries, key)
+			}
+		default:
+		}
+	}
+}
+
+// routeProgressTTL is how long the routes a partly failed notification was
+// delivered on are remembered, well beyond AlertManager's retries.
+const routeProgressTTL = time.Hour
+
+// routeProgress remembers, for notifications that failed on some of their
+// routes, the routes they were delivered on, so that AlertManager's retry
+// only notifies the routes that failed.
+type routeProgress struct {
+	mu      sync.Mutex
+	entries map[string]*routeProgressEntry
+}
+
+type routeProgressEntry struct {
+	routes  map[string]bool
+	expires time.Time
+}
+
+var deliveredRoutes = &routeProgress{entries: map[string]*routeProgressEntry{}}
+
+// Delivered returns the routes the notification with key was delivered on
+// by earlier attempts.
+func (p *routeProgress) Delivered(key string) map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.entries[key]
+	if !ok || clock.Now().After(e.expires) {
+		return nil
+	}
+	return maps.Clone(e.routes)
+}
+
+// Record adds routes to those the notification with key was delivered on.
+func (p *routeProgress) Record(key string, routes []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := clock.Now()
+	for k, e := range p.entries {
+		if now.After(e.expires) {
+			delete(p.entries, k)
+		}
+	}
+	e, ok := p.entries[key]
+	if !ok {
+		e = &routeProgressEntry{routes: map[string]bool{}}
+		p.entries[key] = e
+	}
+	for _, route := range routes {
+		e.routes[route] = true
+	}
+	e.expires = now.Add(routeProgressTTL)
+}
+
+// Forget drops what was recorded for key, once it has been delivered on
+// all its routes.
+func (p *routeProgress) Forget(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.entries, key)
+}
+
+type requestKeyKey struct{}
+
+// withRequestKey tags ctx with the idempotency key of the request, which
+// AlertManager's retries of a notification share.
+func withRequestKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, requestKeyKey{}, key)
+}
+
+func requestKey(ctx context.Context) string {
+	key, _ := ctx.Value(requestKeyKey{}).(string)
+	return key
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCacheDo(t *testing.T) {
+	c := &idempotencyCache{entries: map[string]*idempotencyEntry{}}
+
+	var calls int32
+	ok := func() error { atomic.AddInt32(&calls, 1); return nil }
+	fail := func() error { atomic.AddInt32(&calls, 1); return errors.New("boom") }
+
+	if dup, err := c.Do("a", time.Minute, fail); dup || err == nil {
+		t.Fatalf("Do() = %v, %v; want first call to run and fail", dup, err)
+	}
+	if dup, err := c.Do("a", time.Minute, ok); dup || err != nil {
+		t.Fatalf("Do() = %v, %v; want retry after failure to run", dup, err)
+	}
+	if dup, err := c.Do("a", time.Minute, ok); !dup || err != nil {
+		t.Fatalf("Do() = %v, %v; want duplicate", dup, err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+
+	if _, err := c.Do("b", time.Millisecond, ok); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if dup, _ := c.Do("b", time.Millisecond, ok); dup {
+		t.Error("Expected key to expire after the window")
+	}
+
+	// Concurrent duplicates wait for the in-flight call instead of running.
+	calls = 0
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	var duplicates int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dup, _ := c.Do("c", time.Minute, func() error {
+				<-release
+				return ok()
+			})
+			if dup {
+				atomic.AddInt32(&duplicates, 1)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 || duplicates != 4 {
+		t.Errorf("Expected 1 call and 4 duplicates, got %d calls and %d duplicates", calls, duplicates)
+	}
+}
+
+func TestWebhookIdempotency(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{Idempotency: IdempotencyConfig{Window: time.Minute}}})
+
+	body, err := json.Marshal(AlertManagerPayload{
+		Status: "firing",
+		Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "Idempotent"}, StartsAt: time.Now()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewMockProvider(false)
+	post := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handleWebhookWithProvider(rr, req, provider)
+		return rr
+	}
+
+	for _, key := range []string{"", "", "retry-1", "retry-1"} {
+		if rr := post(key); rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body)
+		}
+	}
+	if got := len(provider.GetSentMessages()); got != 2 {
+		t.Errorf("Expected 2 messages sent (one per key), got %d", got)
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigImporter converts the configuration of another AlertManager
+// notification bridge, or AlertManager itself, into a configuration for
+// this one.
+type ConfigImporter struct {
+	Name string
+	// Detect reports whether data, read from file, is in this format.
+	Detect func(file string, data []byte) bool
+	// Import converts data. Relative paths in it are resolved against dir.
+	Import func(data []byte, dir string) (*ImportedConfig, error)
+}
+
+const (
+	importAlertManager = "alertmanager"
+	importCalert       = "calert"
+	importMSTeams      = "prometheus-msteams"
+)
+
+// configImporters are tried in order; the first format detected wins.
+var configImporters = []ConfigImporter{
+	{Name: importCalert, Detect: detectCalert, Import: importCalertConfig},
+	{Name: importMSTeams, Detect: detectMSTeams, Import: importMSTeamsConfig},
+	{Name: importAlertManager, Detect: detectAlertManagerConfig, Import: importAlertManagerConfig},
+}
+
+// placeholderWebhookURL is written where no Google Chat webhook is known.
+const placeholderWebhookURL = "https://chat.googleapis.com/v1/spaces/SPACE/messages?key=KEY&token=TOKEN"
+
+// ImportedConfig is the part of a configuration an importer can fill in.
+// Notes are written as comments for whatever could not be converted.
+type ImportedConfig struct {
+	Notes            []string
+	WebhookURL       string
+	ThreadByGroupKey bool
+	Text             string
+	Snippets         map[string]string
+	Routes           []ImportedRoute
+}
+
+type ImportedRoute struct {
+	Name       string
+	Matchers   []string
+	Expr       string
+	WebhookURL string
+	Notes      []string
+}
+
+// runImport implements the import subcommand.
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	from := fs.String("from", formatAuto, "Format of the file: auto, "+importAlertManager+", "+importCalert+" or "+importMSTeams)
+	output := fs.String("output", "", "Write the configuration to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [--from format] [--output file] <file>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	file := fs.Arg(0)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+		return 1
+	}
+	importer, err := lookupImporter(*from, file, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	imported, err := importer.Import(data, filepath.Dir(file))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing %s config %s: %v\n", importer.Name, file, err)
+		return 1
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# Imported from %s config %s.\n", importer.Name, filepath.Base(file))
+	fmt.Fprintf(&out, "# Review the notes below, then check the templates with lint-templates.\n")
+	if err := imported.WriteTOML(&out); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing configuration: %v\n", err)
+		return 1
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+	} else {
+		err = os.WriteFile(*output, out.Bytes(), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing configuration: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// lookupImporter returns the importer called name, or the first one that
+// detects data when name is "auto".
+func lookupImporter(name, file string, data []byte) (ConfigImporter, error) {
+	for _, imp := range configImporters {
+		if name == imp.Name || (name == formatAuto && imp.Detect(file, data)) {
+			return imp, nil
+		}
+	}
+	if name == formatAuto {
+		return ConfigImporter{}, fmt.Errorf("cannot tell the format of %s, use --from", file)
+	}
+	return ConfigImporter{}, fmt.Errorf("unknown import format %q", name)
+}
+
+// WriteTOML writes c as a configuration file, with its notes as comments.
+func (c *ImportedConfig) WriteTOML(w io.Writer) error {
+	var b strings.Builder
+	writeNotes(&b, c.Notes)
+
+	webhookURL := c.WebhookURL
+	if webhookURL == "" {
+		webhookURL = placeholderWebhookURL
+	}
+	b.WriteString("\n[google_chat]\n")
+	fmt.Fprintf(&b, "webhook_url = %s\n", tomlString(webhookURL))
+	if c.ThreadByGroupKey {
+		b.WriteString("thread_by_group_key = true\n")
+	}
+
+	if c.Text != "" || len(c.Snippets) > 0 {
+		b.WriteString("\n[templates]\n")
+		if c.Text != "" {
+			fmt.Fprintf(&b, "text = %s\n", tomlString(c.Text))
+		}
+		if len(c.Snippets) > 0 {
+			b.WriteString("\n[templates.snippets]\n")
+			names := make([]string, 0, len(c.Snippets))
+			for name := range c.Snippets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(&b, "%s = %s\n", tomlString(name), tomlString(c.Snippets[name]))
+			}
+		}
+	}
+
+	for _, r := range c.Routes {
+		b.WriteString("\n")
+		writeNotes(&b, r.Notes)
+		b.WriteString("[[routes]]\n")
+		fmt.Fprintf(&b, "name = %s\n", tomlString(r.Name))
+		if len(r.Matchers) > 0 {
+			quoted := make([]string, len(r.Matchers))
+			for i, m := range r.Matchers {
+				quoted[i] = tomlString(m)
+			}
+			fmt.Fprintf(&b, "matchers = [%s]\n", strings.Join(quoted, ", "))
+		}
+		if r.Expr != "" {
+			fmt.Fprintf(&b, "expr = %s\n", tomlString(r.Expr))
+		}
+		if r.WebhookURL != "" {
+			fmt.Fprintf(&b, "webhook_url = %s\n", tomlString(r.WebhookURL))
+		}
+	}
+
+	// The output is decoded again so a quoting bug cannot produce a file
+	// that fails to load.
+	var cfg Config
+	if _, err := toml.Decode(b.String(), &cfg); err != nil {
+		return fmt.Errorf("generated invalid TOML: %v", err)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeNotes(b *strings.Builder, notes []string) {
+	for _, note := range notes {
+		for _, line := range strings.Split(note, "\n") {
+			fmt.Fprintf(b, "# %s\n", line)
+		}
+	}
+}
+
+// tomlString quotes s as a TOML string. Literal strings are preferred so
+// matchers and templates stay readable.
+func tomlString(s string) string {
+	literal := !strings.ContainsFunc(s, func(r rune) bool { return r < ' ' && r != '\t' && r != '\n' })
+	switch {
+	case literal && !strings.ContainsAny(s, "'\n"):
+		return "'" + s + "'"
+	case literal && !strings.Contains(s, "'''") && !strings.HasSuffix(s, "'"):
+		return "'''\n" + s + "'''"
+	}
+	// JSON string escapes are all valid in TOML basic strings.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// checkImportedTemplate returns a note when text, taken from file, does not
+// parse with the functions available here.
+func checkImportedTemplate(file, text string) string {
+	if _, err := template.New(file).Funcs(templateFuncs).Parse(text); err != nil {
+		return fmt.Sprintf("The template from %s does not parse here and must be edited: %v", file, err)
+	}
+	return ""
+}
+
+// uniqueRouteName returns name, or name with a numeric suffix if it is
+// already in routes.
+func uniqueRouteName(routes []ImportedRoute, name string) string {
+	taken := map[string]bool{}
+	for _, r := range routes {
+		taken[r.Name] = true
+	}
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	return unique
+}
+
+// isChatWebhook reports whether u is a Google Chat incoming webhook.
+func isChatWebhook(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && parsed.Scheme == "https" && parsed.Host == "chat.googleapis.com"
+}
+
+// calert (https://github.com/mr-karan/calert) posts to Google Chat. Each
+// provider is selected by the name of the AlertManager receiver.
+type calertConfig struct {
+	Providers map[string]calertProvider `toml:"providers"`
+}
+
+type calertProvider struct {
+	Type            string `toml:"type"`
+	Endpoint        string `toml:"endpoint"`
+	Template        string `toml:"template"`
+	ThreadedReplies bool   `toml:"threaded_replies"`
+}
+
+func detectCalert(file string, data []byte) bool {
+	var cfg calertConfig
+	_, err := toml.Decode(string(data), &cfg)
+	return err == nil && len(cfg.Providers) > 0
+}
+
+func importCalertConfig(data []byte, dir string) (*ImportedConfig, error) {
+	var cfg calertConfig
+	if _, err := toml.Decode(string(data), &cfg); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	imported := &ImportedConfig{Snippets: map[string]string{}}
+	// Providers sharing a template file share its snippet.
+	snippets := map[string]string{}
+	var text string
+	for _, name := range names {
+		p := cfg.Providers[name]
+		if p.Type != "" && p.Type != "google_chat" {
+			imported.Notes = append(imported.Notes, fmt.Sprintf("Provider %s of type %s was skipped.", name, p.Type))
+			continue
+		}
+		route := ImportedRoute{
+			Name:       uniqueRouteName(imported.Routes, name),
+			Expr:       fmt.Sprintf("receiver == %q", name),
+			WebhookURL: p.Endpoint,
+		}
+		if imported.WebhookURL == "" {
+			// calert rejects alerts from unknown receivers; here they
+			// go to the default webhook instead.
+			imported.WebhookURL = p.Endpoint
+			imported.Notes = append(imported.Notes, fmt.Sprintf("Alerts from receivers without a route below are sent to the webhook of provider %s.", name))
+		}
+		imported.ThreadByGroupKey = imported.ThreadByGroupKey || p.ThreadedReplies
+
+		if snippet, ok := snippets[p.Template]; p.Template != "" && !ok {
+			snippet = "calert." + name
+			file := p.Template
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				imported.Notes = append(imported.Notes, fmt.Sprintf("The template %s could not be read: %v", p.Template, err))
+			} else {
+				snippets[p.Template] = snippet
+				imported.Snippets[snippet] = string(data)
+				if note := checkImportedTemplate(p.Template, string(data)); note != "" {
+					imported.Notes = append(imported.Notes, note)
+				}
+				if text == "" {
+					// calert renders its template once per alert.
+					text = fmt.Sprintf(`{{ range .Alerts }}{{ template %q . }}{{ end }}`, snippet)
+				}
+			}
+		}
+		imported.Routes = append(imported.Routes, route)
+	}
+
+	imported.Text = text
+	if len(imported.Snippets) > 1 {
+		imported.Notes = append(imported.Notes, "Message templates apply to every route, so only the first provider's template is used. The others are kept as snippets.")
+	}
+	if len(imported.Routes) == 0 {
+		return nil, fmt.Errorf("no google_chat providers found")
+	}
+	return imported, nil
+}
+
+// prometheus-msteams (https://github.com/prometheus-msteams/prometheus-msteams)
+// posts to Microsoft Teams, selecting the connector by request path.
+type msTeamsConfig struct {
+	Connectors       []map[string]string `yaml:"connectors"`
+	CustomConnectors []struct {
+		RequestPath  string `yaml:"request_path"`
+		TemplateFile string `yaml:"template_file"`
+		WebhookURL   string `yaml:"webhook_url"`
+	} `yaml:"connectors_with_custom_templates"`
+}
+
+func detectMSTeams(file string, data []byte) bool {
+	var cfg msTeamsConfig
+	return yaml.Unmarshal(data, &cfg) == nil && (len(cfg.Connectors) > 0 || len(cfg.CustomConnectors) > 0)
+}
+
+func importMSTeamsConfig(data []byte, dir string) (*ImportedConfig, error) {
+	var cfg msTeamsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	imported := &ImportedConfig{Notes: []string{
+		"Teams webhooks cannot be reused: set the Google Chat webhook of every route.",
+		"prometheus-msteams selects the connector by request path. Point every AlertManager",
+		"receiver at /webhook instead; each route below matches the receiver named after its connector.",
+	}}
+	add := func(name, teamsURL, templateFile string) {
+		name = strings.Trim(name, "/")
+		route := ImportedRoute{
+			Name:  uniqueRouteName(imported.Routes, name),
+			Expr:  fmt.Sprintf("receiver == %q", name),
+			Notes: []string{"Teams webhook: " + teamsURL},
+		}
+		if templateFile != "" {
+			route.Notes = append(route.Notes, fmt.Sprintf("The Teams card template %s cannot be converted; see Card Layout and Message Templates.", templateFile))
+		}
+		imported.Routes = append(imported.Routes, route)
+	}
+	for _, connector := range cfg.Connectors {
+		names := make([]string, 0, len(connector))
+		for name := range connector {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name, connector[name], "")
+		}
+	}
+	for _, c := range cfg.CustomConnectors {
+		add(c.RequestPath, c.WebhookURL, c.TemplateFile)
+	}
+	if len(imported.Routes) == 0 {
+		return nil, fmt.Errorf("no connectors found")
+	}
+	return imported, nil
+}
+
+// alertManagerConfig is the part of alertmanager.yml describing where
+// notifications go.
+type alertManagerConfig struct {
+	Route     *alertManagerRoute `yaml:"route"`
+	Receivers []struct {
+		Name           string `yaml:"name"`
+		WebhookConfigs []struct {
+			URL string `yaml:"url"`
+		} `yaml:"webhook_configs"`
+	} `yaml:"receivers"`
+}
+
+type alertManagerRoute struct {
+	Receiver string               `yaml:"receiver"`
+	Match    map[string]string    `yaml:"match"`
+	MatchRE  map[string]string    `yaml:"match_re"`
+	Matchers []string             `yaml:"matchers"`
+	Continue bool                 `yaml:"continue"`
+	Routes   []*alertManagerRoute `yaml:"routes"`
+}
+
+func detectAlertManagerConfig(file string, data []byte) bool {
+	var cfg alertManagerConfig
+	return yaml.Unmarshal(data, &cfg) == nil && cfg.Route != nil && len(cfg.Receivers) > 0
+}
+
+// importAlertManagerConfig turns the routing tree into routes. AlertManager
+// tries child routes before their parent, so the tree is flattened depth
+// first with each route after its children, and each route gets the
+// matchers of all its ancestors.
+func importAlertManagerConfig(data []byte, dir string) (*ImportedConfig, error) {
+	var cfg alertManagerConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Route == nil {
+		return nil, fmt.Errorf("no route found")
+	}
+	webhooks := map[string][]string{}
+	for _, r := range cfg.Receivers {
+		for _, wc := range r.WebhookConfigs {
+			webhooks[r.Name] = append(webhooks[r.Name], wc.URL)
+		}
+	}
+
+	imported := &ImportedConfig{}
+	routeFor := func(receiver string, matchers []string, notes []string) ImportedRoute {
+		route := ImportedRoute{Name: uniqueRouteName(imported.Routes, receiver), Matchers: matchers, Notes: notes}
+		urls := webhooks[receiver]
+		switch {
+		case len(urls) == 0:
+			route.Notes = append(route.Notes, fmt.Sprintf("Receiver %s has no webhook; remove this route unless its alerts should go to Chat.", receiver))
+		case isChatWebhook(urls[0]):
+			route.WebhookURL = urls[0]
+		default:
+			route.Notes = append(route.Notes, fmt.Sprintf("Receiver %s posted to %s; set the Google Chat webhook of this route.", receiver, urls[0]))
+		}
+		if len(urls) > 1 {
+			route.Notes = append(route.Notes, fmt.Sprintf("Receiver %s has %d webhooks; only the first is used.", receiver, len(urls)))
+		}
+		return route
+	}
+
+	var walk func(r *alertManagerRoute, receiver string, inherited []string)
+	walk = func(r *alertManagerRoute, receiver string, inherited []string) {
+		if r.Receiver != "" {
+			receiver = r.Receiver
+		}
+		matchers, notes := alertManagerMatchers(r)
+		matchers = append(inherited[:len(inherited):len(inherited)], matchers...)
+		for _, child := range r.Routes {
+			walk(child, receiver, matchers)
+		}
+		if r == cfg.Route {
+			return
+		}
+		if r.Continue {
+			notes = append(notes, "continue is not supported: alerts only go to the first matching route.")
+		}
+		imported.Routes = append(imported.Routes, routeFor(receiver, matchers, notes))
+	}
+	walk(cfg.Route, "", nil)
+
+	// The root route catches everything, like the default webhook.
+	if urls := webhooks[cfg.Route.Receiver]; len(urls) > 0 && isChatWebhook(urls[0]) {
+		imported.WebhookURL = urls[0]
+	} else {
+		imported.Notes = append(imported.Notes, fmt.Sprintf("The default receiver %s has no Google Chat webhook; set the one in [google_chat].", cfg.Route.Receiver))
+	}
+	return imported, nil
+}
+
+// alertManagerMatchers converts the matchers of r, including the
+// deprecated match and match_re maps. Matchers that cannot be parsed here
+// are returned as notes.
+func alertManagerMatchers(r *alertManagerRoute) ([]string, []string) {
+	var matchers, notes []string
+	for _, p := range KV(r.Match).SortedPairs() {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", p.Name, p.Value))
+	}
+	for _, p := range KV(r.MatchRE).SortedPairs() {
+		matchers = append(matchers, fmt.Sprintf("%s=~%q", p.Name, p.Value))
+	}
+	for _, m := range r.Matchers {
+		parsed, err := ParseMatcher(m)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("Matcher %s could not be converted: %v", m, err))
+			continue
+		}
+		matchers = append(matchers, fmt.Sprintf("%s%s%q", parsed.Name, parsed.Type, parsed.Value))
+	}
+	return matchers, notes
+}
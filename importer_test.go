@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+// importConfig runs the importer for format on data and decodes the
+// configuration it writes.
+func importConfig(t *testing.T, format, data, dir string) (Config, string) {
+	t.Helper()
+	importer, err := lookupImporter(format, "config", []byte(data))
+	if err != nil {
+		t.Fatalf("lookupImporter() error = %v", err)
+	}
+	imported, err := importer.Import([]byte(data), dir)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	var out bytes.Buffer
+	if err := imported.WriteTOML(&out); err != nil {
+		t.Fatalf("WriteTOML() error = %v", err)
+	}
+	var cfg Config
+	if _, err := toml.Decode(out.String(), &cfg); err != nil {
+		t.Fatalf("generated config does not decode: %v\n%s", err, out.String())
+	}
+	for _, r := range cfg.Routes {
+		if _, err := ParseMatchers(r.Matchers); err != nil {
+			t.Errorf("route %s: %v", r.Name, err)
+		}
+		if r.Expr != "" {
+			if _, err := CompileExpression(r.Expr); err != nil {
+				t.Errorf("route %s: %v", r.Name, err)
+			}
+		}
+	}
+	return cfg, out.String()
+}
+
+func TestImportAlertManager(t *testing.T) {
+	const amConfig = `
+route:
+  receiver: default
+  routes:
+    - receiver: db
+      matchers: ['team = db']
+      routes:
+        - receiver: db-critical
+          match:
+            severity: critical
+          continue: true
+    - receiver: web
+      match_re:
+        service: "web|api"
+receivers:
+  - name: default
+    webhook_configs:
+      - url: https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t
+  - name: db
+    webhook_configs:
+      - url: http://calert:6000/dispatch
+  - name: db-critical
+    webhook_configs:
+      - url: https://chat.googleapis.com/v1/spaces/CCC/messages?key=k&token=t
+  - name: web
+    webhook_configs:
+      - url: https://chat.googleapis.com/v1/spaces/BBB/messages?key=k&token=t
+`
+	cfg, out := importConfig(t, formatAuto, amConfig, "")
+
+	if got := cfg.GoogleChat.WebhookURL; got != "https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t" {
+		t.Errorf("webhook_url = %q", got)
+	}
+	want := []RouteConfig{
+		{Name: "db-critical", Matchers: []string{`team="db"`, `severity="critical"`}, WebhookURL: "https://chat.googleapis.com/v1/spaces/CCC/messages?key=k&token=t"},
+		{Name: "db", Matchers: []string{`team="db"`}},
+		{Name: "web", Matchers: []string{`service=~"web|api"`}, WebhookURL: "https://chat.googleapis.com/v1/spaces/BBB/messages?key=k&token=t"},
+	}
+	if len(cfg.Routes) != len(want) {
+		t.Fatalf("got %d routes, want %d:\n%s", len(cfg.Routes), len(want), out)
+	}
+	for i, w := range want {
+		r := cfg.Routes[i]
+		if r.Name != w.Name || !reflect.DeepEqual(r.Matchers, w.Matchers) || r.WebhookURL != w.WebhookURL {
+			t.Errorf("route %d = %s %v %s, want %s %v %s", i, r.Name, r.Matchers, r.WebhookURL, w.Name, w.Matchers, w.WebhookURL)
+		}
+	}
+	for _, note := range []string{"# continue is not supported", "# Receiver db posted to http://calert:6000/dispatch"} {
+		if !strings.Contains(out, note) {
+			t.Errorf("output does not contain %q:\n%s", note, out)
+		}
+	}
+}
+
+func TestImportCalert(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "message.tmpl"), []byte("*{{ .Labels.alertname }}*\n{{ .Annotations.summary }}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const calertConfig = `
+[app]
+address = "0.0.0.0:6000"
+
+[providers.prod]
+type = "google_chat"
+endpoint = "https://chat.googleapis.com/v1/spaces/PROD/messages?key=k&token=t"
+template = "message.tmpl"
+threaded_replies = true
+
+[providers.staging]
+type = "google_chat"
+endpoint = "https://chat.googleapis.com/v1/spaces/STAGING/messages?key=k&token=t"
+template = "message.tmpl"
+`
+	cfg, out := importConfig(t, formatAuto, calertConfig, dir)
+
+	if !cfg.GoogleChat.ThreadByGroupKey {
+		t.Error("thread_by_group_key not set for threaded_replies")
+	}
+	if len(cfg.Routes) != 2 || cfg.Routes[0].Expr != `receiver == "prod"` || cfg.Routes[1].WebhookURL != "https://chat.googleapis.com/v1/spaces/STAGING/messages?key=k&token=t" {
+		t.Errorf("routes = %+v", cfg.Routes)
+	}
+	if len(cfg.Templates.Snippets) != 1 {
+		t.Errorf("snippets = %v, want one shared template", cfg.Templates.Snippets)
+	}
+
+	templates, err := NewMessageTemplates(cfg.Templates)
+	if err != nil {
+		t.Fatalf("NewMessageTemplates() error = %v\n%s", err, out)
+	}
+	text, err := templates.Text(&AlertManagerPayload{Alerts: Alerts{
+		{Labels: KV{"alertname": "DiskFull"}, Annotations: KV{"summary": "Disk is full"}},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("Text() error = %v", err)
+	}
+	if want := "*DiskFull*\nDisk is full"; text != want {
+		t.Errorf("Text() = %q, want %q", text, want)
+	}
+}
+
+func TestImportMSTeams(t *testing.T) {
+	const msTeamsConfig = `
+connectors:
+  - alert1: "https://outlook.office.com/webhook/xxx"
+connectors_with_custom_templates:
+  - request_path: /alert2
+    template_file: ./card.tmpl
+    webhook_url: "https://outlook.office.com/webhook/yyy"
+`
+	cfg, out := importConfig(t, importMSTeams, msTeamsConfig, "")
+
+	if cfg.GoogleChat.WebhookURL != placeholderWebhookURL {
+		t.Errorf("webhook_url = %q, want the placeholder", cfg.GoogleChat.WebhookURL)
+	}
+	if len(cfg.Routes) != 2 || cfg.Routes[1].Name != "alert2" || cfg.Routes[1].Expr != `receiver == "alert2"` {
+		t.Errorf("routes = %+v", cfg.Routes)
+	}
+	if !strings.Contains(out, "# The Teams card template ./card.tmpl cannot be converted") {
+		t.Errorf("output does not mention the template:\n%s", out)
+	}
+}
+
+func TestTOMLString(t *testing.T) {
+	tests := []string{
+		`team="db"`,
+		"it's",
+		"line one\nline two\n",
+		"ends with a quote'\nx'",
+		"tab\tand \x01 control",
+	}
+	for _, s := range tests {
+		var doc struct{ V string }
+		if _, err := toml.Decode("v = "+tomlString(s), &doc); err != nil {
+			t.Errorf("tomlString(%q) = %s: %v", s, tomlString(s), err)
+			continue
+		}
+		if doc.V != s {
+			t.Errorf("tomlString(%q) decodes to %q", s, doc.V)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// incidentScopes are requested in addition to chatAPIScope when incident
+// spaces are enabled. Both need administrator approval for the Chat app.
+var incidentScopes = []string{
+	"https://www.googleapis.com/auth/chat.app.spaces.create",
+	"https://www.googleapis.com/auth/chat.app.memberships",
+}
+
+// IncidentPolicy opens a dedicated Chat space for alert groups matching
+// its matchers, invites the configured members and posts every
+// notification for the group there until it resolves.
+type IncidentPolicy struct {
+	Matchers   Matchers
+	Members    []string
+	NamePrefix string
+	chat       *ChatAPI
+}
+
+// NewIncidentPolicy returns nil when incident spaces are disabled.
+func NewIncidentPolicy(cfg IncidentConfig, chat *ChatAPI) (*IncidentPolicy, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if chat == nil {
+		return nil, fmt.Errorf("incident spaces require Chat API credentials")
+	}
+	matchers, err := ParseMatchers(cfg.Matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0, len(cfg.Members))
+	for _, m := range cfg.Members {
+		if !strings.HasPrefix(m, "users/") {
+			m = "users/" + m
+		}
+		members = append(members, m)
+	}
+	return &IncidentPolicy{Matchers: matchers, Members: members, NamePrefix: cfg.NamePrefix, chat: chat}, nil
+}
+
+// Matches reports whether payload should get an incident space.
+func (p *IncidentPolicy) Matches(payload *AlertManagerPayload) bool {
+	return p != nil && p.Matchers.Matches(routingLabels(payload))
+}
+
+// incidentSpace is a space opened for one alert group.
+type incidentSpace struct {
+	Name     string    `json:"name"`
+	URI      string    `json:"uri"`
+	OpenedAt time.Time `json:"openedAt"`
+}
+
+// IncidentStore maps alert group keys to their incident space. With a path,
+// every change is written to disk so follow-up notifications reach the same
+// space after a restart.
+type IncidentStore struct {
+	mu     sync.Mutex
+	path   string
+	spaces map[string]incidentSpace
+}
+
+var incidents = NewIncidentStore("")
+
+func NewIncidentStore(path string) *IncidentStore {
+	return &IncidentStore{path: path, spaces: map[string]incidentSpace{}}
+}
+
+// LoadIncidentStore opens the store persisted at path.
+func LoadIncidentStore(path string) (*IncidentStore, error) {
+	s := NewIncidentStore(path)
+	if err := loadState(path, &s.spaces); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *IncidentStore) Get(groupKey string) (incidentSpace, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	space, ok := s.spaces[groupKey]
+	return space, ok
+}
+
+func (s *IncidentStore) Set(groupKey string, space incidentSpace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spaces[groupKey] = space
+	return s.save()
+}
+
+func (s *IncidentStore) Delete(groupKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.spaces[groupKey]; !ok {
+		return nil
+	}
+	delete(s.spaces, groupKey)
+	return s.save()
+}
+
+// save writes the store to disk. The caller must hold s.mu.
+func (s *IncidentStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return saveState(s.path, s.spaces)
+}
+
+// postToIncident posts message to the alert group's incident space, opening
+// the space first for a new firing group. It returns the space and whether
+// it was just opened, so the main message can link to it. Groups already
+// resolved before a space was opened are left alone.
+func postToIncident(ctx context.Context, p *IncidentPolicy, payload *AlertManagerPayload, message *GoogleChatMessage, reqID string) (incidentSpace, bool, error) {
+	space, ok := incidents.Get(payload.GroupKey)
+	opened := false
+	if !ok {
+		if payload.Status == "resolved" {
+			return incidentSpace{}, false, nil
+		}
+		var err error
+		if space, err = p.open(ctx, payload, reqID); err != nil {
+			return incidentSpace{}, false, err
+		}
+		if err := incidents.Set(payload.GroupKey, space); err != nil {
+			logger.Error("[%s] Error saving incident space: %v", reqID, err)
+		}
+		opened = true
+	}
+
+	provider := &ChatAPIProvider{API: p.chat, Space: space.Name}
+	if err := provider.Send(ctx, message, SendOptions{ReqID: reqID, Route: "incident", Attempt: 1}); err != nil {
+		return space, opened, err
+	}
+	if payload.Status == "resolved" {
+		if err := incidents.Delete(payload.GroupKey); err != nil {
+			logger.Error("[%s] Error saving incident spaces: %v", reqID, err)
+		}
+	}
+	return space, opened, nil
+}
+
+// open creates the incident space and invites the members. Failing to
+// invite a member does not fail the incident.
+func (p *IncidentPolicy) open(ctx context.Context, payload *AlertManagerPayload, reqID string) (incidentSpace, error) {
+	displayName := fmt.Sprintf("%s%s %s", p.NamePrefix, getAlertName(payload), clock.Now().Format("2006-01-02 15:04"))
+	if len(displayName) > 128 {
+		displayName = displayName[:128]
+	}
+
+	var created struct {
+		Name     string `json:"name"`
+		SpaceURI string `json:"spaceUri"`
+	}
+	err := p.chat.call(ctx, http.MethodPost, "/v1/spaces", map[string]interface{}{
+		"spaceType":   "SPACE",
+		"displayName": displayName,
+	}, &created)
+	if err != nil {
+		return incidentSpace{}, fmt.Errorf("error creating incident space: %v", err)
+	}
+	logger.Info("[%s] Opened incident space %s (%s)", reqID, created.Name, displayName)
+	incidentsOpened.Inc()
+
+	for _, member := range p.Members {
+		err := p.chat.call(ctx, http.MethodPost, "/v1/"+created.Name+"/members", map[string]interface{}{
+			"member": map[string]string{"name": member, "type": "HUMAN"},
+		}, nil)
+		if err != nil {
+			logger.Error("[%s] Error inviting %s to %s: %v", reqID, member, created.Name, err)
+		}
+	}
+
+	uri := created.SpaceURI
+	if uri == "" {
+		uri = "https://chat.google.com/room/" + strings.TrimPrefix(created.Name, "spaces/")
+	}
+	return incidentSpace{Name: created.Name, URI: uri, OpenedAt: clock.Now()}, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncidentSpaces(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { incidents = NewIncidentStore("") }()
+	incidents = NewIncidentStore("")
+
+	var mu sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/spaces":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if !strings.HasPrefix(body["displayName"], "Incident: DBDown ") {
+				t.Errorf("Unexpected space name %q", body["displayName"])
+			}
+			fmt.Fprint(w, `{"name":"spaces/INC1","spaceUri":"https://chat.google.com/room/INC1"}`)
+		case "/v1/spaces/INC1/members":
+			var body struct {
+				Member struct{ Name string } `json:"member"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Member.Name != "users/alice@example.com" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer server.Close()
+
+	chat := &ChatAPI{client: server.Client(), baseURL: server.URL}
+	policy, err := NewIncidentPolicy(IncidentConfig{
+		Enabled:    true,
+		Matchers:   []string{`severity="critical"`},
+		Members:    []string{"alice@example.com", "users/404"},
+		NamePrefix: "Incident: ",
+	}, chat)
+	if err != nil {
+		t.Fatalf("NewIncidentPolicy() error = %v", err)
+	}
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Incidents: policy})
+
+	provider := NewMockProvider(false)
+	post := func(status string, labels KV) {
+		body, err := json.Marshal(AlertManagerPayload{
+			Status:       status,
+			GroupKey:     "{}:{alertname=\"DBDown\"}",
+			CommonLabels: labels,
+			Alerts:       Alerts{{Status: status, Labels: labels, StartsAt: time.Now()}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handleWebhookWithProvider(rr, req, provider)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body)
+		}
+	}
+
+	critical := KV{"alertname": "DBDown", "severity": "critical"}
+	post("firing", KV{"alertname": "DBSlow", "severity": "warning"})
+	post("firing", critical)
+	post("firing", critical)
+	post("resolved", critical)
+
+	want := []string{
+		"POST /v1/spaces",
+		"POST /v1/spaces/INC1/members",
+		"POST /v1/spaces/INC1/members",
+		"POST /v1/spaces/INC1/messages",
+		"POST /v1/spaces/INC1/messages",
+		"POST /v1/spaces/INC1/messages",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected Chat API calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	messages := provider.GetSentMessages()
+	if len(messages) != 4 {
+		t.Fatalf("Expected every notification in the main space too, got %d", len(messages))
+	}
+	if !strings.HasSuffix(messages[1].message.Text, "\nIncident space: https://chat.google.com/room/INC1") {
+		t.Errorf("Expected a link to the incident space, got %q", messages[1].message.Text)
+	}
+	if strings.Contains(messages[2].message.Text, "Incident space") {
+		t.Errorf("Expected only the first notification to link the space, got %q", messages[2].message.Text)
+	}
+	if _, ok := incidents.Get("{}:{alertname=\"DBDown\"}"); ok {
+		t.Error("Expected the incident space to be forgotten once the group resolved")
+	}
+}
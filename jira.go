@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultJiraSummary     = `{{ .CommonLabels.alertname }}{{ with .CommonAnnotations.summary }}: {{ . }}{{ end }}`
+	defaultJiraDescription = `{{ range .Alerts }}* {{ .Labels.SortedPairs }}{{ with .Annotations.description }} - {{ . }}{{ end }}
+{{ end }}{{ .ExternalURL }}`
+	defaultJiraResolveComment = `All alerts resolved.`
+)
+
+// JiraProvider opens a Jira issue when an alert group starts firing, and
+// comments on and optionally transitions it when the group resolves.
+type JiraProvider struct {
+	cfg            JiraConfig
+	route          string
+	summary        *template.Template
+	description    *template.Template
+	resolveComment *template.Template
+	labels         []*template.Template
+	sandbox        *TemplateSandbox
+}
+
+func NewJiraProvider(cfg JiraConfig, route string, snippets *template.Template, sandbox *TemplateSandbox) (*JiraProvider, error) {
+	if cfg.IssueType == "" {
+		cfg.IssueType = "Task"
+	}
+	p := &JiraProvider{cfg: cfg, route: route, sandbox: sandbox}
+	var err error
+	fields := []struct {
+		dst      **template.Template
+		name     string
+		text     string
+		fallback string
+	}{
+		{&p.summary, "summary", cfg.Summary, defaultJiraSummary},
+		{&p.description, "description", cfg.Description, defaultJiraDescription},
+		{&p.resolveComment, "resolve_comment", cfg.ResolveComment, defaultJiraResolveComment},
+	}
+	for _, f := range fields {
+		text := f.text
+		if text == "" {
+			text = f.fallback
+		}
+		if *f.dst, err = parseTicketTemplate(snippets, f.name, text); err != nil {
+			return nil, fmt.Errorf("invalid jira %s template: %v", f.name, err)
+		}
+	}
+	for _, label := range cfg.Labels {
+		tmpl, err := parseTicketTemplate(snippets, "label", label)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jira label template: %v", err)
+		}
+		p.labels = append(p.labels, tmpl)
+	}
+	return p, nil
+}
+
+func (p *JiraProvider) Ticket(ctx context.Context, payload *AlertManagerPayload, reqID string) error {
+	key := ticketKey("jira", p.route, payload)
+	issue, ok := tickets.Get(key)
+
+	if payload.Status == "resolved" {
+		if !ok {
+			return nil
+		}
+		if err := p.resolve(ctx, issue, payload); err != nil {
+			return err
+		}
+		logger.Info("[%s] Resolved Jira issue %s", reqID, issue)
+		return tickets.Delete(key)
+	}
+	if ok {
+		return nil
+	}
+
+	issue, err := p.create(ctx, payload)
+	if err != nil {
+		return err
+	}
+	logger.Info("[%s] Created Jira issue %s", reqID, issue)
+	return tickets.Set(key, issue)
+}
+
+// Preview renders the fields of the issue for payload without calling Jira.
+func (p *JiraProvider) Preview(payload *AlertManagerPayload) (map[string]string, error) {
+	summary, description, labels, err := p.render(payload)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := renderTicketTemplate(p.sandbox, p.resolveComment, payload)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering resolve comment: %v", err)
+	}
+	return map[string]string{
+		"provider":        "jira",
+		"summary":         summary,
+		"description":     description,
+		"labels":          strings.Join(labels, " "),
+		"resolve_comment": comment,
+	}, nil
+}
+
+// render renders the summary, description and labels of a new issue.
+func (p *JiraProvider) render(payload *AlertManagerPayload) (summary, description string, labels []string, err error) {
+	if summary, err = renderTicketTemplate(p.sandbox, p.summary, payload); err != nil {
+		return "", "", nil, fmt.Errorf("error rendering summary: %v", err)
+	}
+	if description, err = renderTicketTemplate(p.sandbox, p.description, payload); err != nil {
+		return "", "", nil, fmt.Errorf("error rendering description: %v", err)
+	}
+	labels = []string{}
+	for _, tmpl := range p.labels {
+		label, err := renderTicketTemplate(p.sandbox, tmpl, payload)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("error rendering label: %v", err)
+		}
+		// Jira labels cannot contain spaces.
+		if label = strings.ReplaceAll(label, " ", "_"); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return summary, description, labels, nil
+}
+
+// create files a new issue and returns its key, such as "OPS-123".
+func (p *JiraProvider) create(ctx context.Context, payload *AlertManagerPayload) (string, error) {
+	summary, description, labels, err := p.render(payload)
+	if err != nil {
+		return "", err
+	}
+
+	var created struct {
+		Key string `json:"key"`
+	}
+	err = p.call(ctx, http.MethodPost, "/rest/api/2/issue", map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": p.cfg.Project},
+			"issuetype":   map[string]string{"name": p.cfg.IssueType},
+			"summary":     summary,
+			"description": description,
+			"labels":      labels,
+		},
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("error creating Jira issue: %v", err)
+	}
+	return created.Key, nil
+}
+
+// resolve comments on the issue and applies the resolve transition, if one
+// is configured.
+func (p *JiraProvider) resolve(ctx context.Context, issue string, payload *AlertManagerPayload) error {
+	comment, err := renderTicketTemplate(p.sandbox, p.resolveComment, payload)
+	if err != nil {
+		return fmt.Errorf("error rendering resolve comment: %v", err)
+	}
+	if comment != "" {
+		if err := p.call(ctx, http.MethodPost, "/rest/api/2/issue/"+issue+"/comment", map[string]string{"body": comment}, nil); err != nil {
+			return fmt.Errorf("error commenting on Jira issue %s: %v", issue, err)
+		}
+	}
+	if p.cfg.ResolveTransition == "" {
+		return nil
+	}
+
+	var available struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/rest/api/2/issue/"+issue+"/transitions", nil, &available); err != nil {
+		return fmt.Errorf("error listing transitions of Jira issue %s: %v", issue, err)
+	}
+	for _, t := range available.Transitions {
+		if strings.EqualFold(t.Name, p.cfg.ResolveTransition) {
+			err := p.call(ctx, http.MethodPost, "/rest/api/2/issue/"+issue+"/transitions", map[string]interface{}{
+				"transition": map[string]string{"id": t.ID},
+			}, nil)
+			if err != nil {
+				return fmt.Errorf("error transitioning Jira issue %s: %v", issue, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("Jira issue %s has no transition named %q", issue, p.cfg.ResolveTransition)
+}
+
+// call sends a JSON request to the Jira REST API, authenticating with basic
+// auth when a user is configured and with the token as a bearer token
+// otherwise.
+func (p *JiraProvider) call(ctx context.Context, method, path string, in, out interface{}) (err error) {
+	start := clock.Now()
+	defer func() {
+		status := statusSuccess
+		if err != nil {
+			status = statusError
+			providerErrors.WithLabelValues("jira").Inc()
+		}
+		observeDuration(ctx, providerRequestDuration.WithLabelValues("jira", status), clock.Since(start).Seconds())
+	}()
+
+	token, err := secretValue(p.cfg.Token, p.cfg.TokenFile)
+	if err != nil {
+		return fmt.Errorf("error reading Jira token: %v", err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.cfg.URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.cfg.User != "" {
+		req.SetBasicAuth(p.cfg.User, token)
+	} else if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	req, span := startClientSpan(ctx, "jira."+strings.ToLower(method), req)
+	defer func() { endSpan(span, err) }()
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
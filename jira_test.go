@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJiraProvider(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { tickets = NewTicketStore("") }()
+	tickets = NewTicketStore("")
+
+	var calls []string
+	var created map[string]interface{}
+	var comment string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/api/2/issue":
+			var body struct {
+				Fields map[string]interface{} `json:"fields"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			created = body.Fields
+			fmt.Fprint(w, `{"key":"OPS-1"}`)
+		case "POST /rest/api/2/issue/OPS-1/comment":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			comment = body["body"]
+			w.WriteHeader(http.StatusCreated)
+		case "GET /rest/api/2/issue/OPS-1/transitions":
+			fmt.Fprint(w, `{"transitions":[{"id":"11","name":"In Progress"},{"id":"31","name":"Done"}]}`)
+		case "POST /rest/api/2/issue/OPS-1/transitions":
+			var body struct {
+				Transition struct{ ID string } `json:"transition"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Transition.ID != "31" {
+				t.Errorf("Expected transition 31, got %s", body.Transition.ID)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { sharedHTTPClient = client }(sharedHTTPClient)
+	sharedHTTPClient = server.Client()
+
+	p, err := NewJiraProvider(JiraConfig{
+		URL:               server.URL,
+		Project:           "OPS",
+		User:              "bot@example.com",
+		Token:             "s3cret",
+		Labels:            []string{"alertmanager", "{{ .CommonLabels.severity }}", "{{ .CommonLabels.missing }}"},
+		ResolveComment:    "Resolved {{ len .Alerts }} alert(s)",
+		ResolveTransition: "done",
+	}, "ops", nil, nil)
+	if err != nil {
+		t.Fatalf("NewJiraProvider() error = %v", err)
+	}
+
+	firing := &AlertManagerPayload{
+		Status:            "firing",
+		GroupKey:          "g1",
+		CommonLabels:      KV{"alertname": "DiskFull", "severity": "page"},
+		CommonAnnotations: KV{"summary": "Disk is full"},
+		Alerts:            Alerts{{Status: "firing", Labels: KV{"alertname": "DiskFull", "instance": "db-01"}, Annotations: KV{"description": "95% used"}}},
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Ticket(context.Background(), firing, "req-1"); err != nil {
+			t.Fatalf("Ticket() error = %v", err)
+		}
+	}
+	if created["summary"] != "DiskFull: Disk is full" {
+		t.Errorf("Unexpected summary %v", created["summary"])
+	}
+	if desc, _ := created["description"].(string); !strings.Contains(desc, "* alertname=DiskFull, instance=db-01 - 95% used") {
+		t.Errorf("Unexpected description %q", desc)
+	}
+	if labels := fmt.Sprint(created["labels"]); labels != "[alertmanager page]" {
+		t.Errorf("Unexpected labels %s", labels)
+	}
+	if issue, _ := tickets.Get("jira/ops/g1"); issue != "OPS-1" {
+		t.Errorf("Expected OPS-1 to be remembered, got %q", issue)
+	}
+
+	resolved := *firing
+	resolved.Status = "resolved"
+	if err := p.Ticket(context.Background(), &resolved, "req-2"); err != nil {
+		t.Fatalf("Ticket() error = %v", err)
+	}
+	if comment != "Resolved 1 alert(s)" {
+		t.Errorf("Unexpected comment %q", comment)
+	}
+	if _, ok := tickets.Get("jira/ops/g1"); ok {
+		t.Error("Expected the issue to be forgotten once resolved")
+	}
+
+	want := []string{
+		"POST /rest/api/2/issue",
+		"POST /rest/api/2/issue/OPS-1/comment",
+		"GET /rest/api/2/issue/OPS-1/transitions",
+		"POST /rest/api/2/issue/OPS-1/transitions",
+	}
+	if strings.Join(calls, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Unexpected Jira calls %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// jsonnetTimeout is the default jsonnet_timeout.
+	jsonnetTimeout = 5 * time.Second
+	// jsonnetWaitDelay bounds how long a killed evaluation may hold its
+	// output open, e.g. through a child process.
+	jsonnetWaitDelay = time.Second
+)
+
+// JsonnetRenderer builds the Google Chat message from a Jsonnet file. The
+// payload is passed as the `payload` external variable, so the file reads it
+// with std.extVar("payload").
+type JsonnetRenderer struct {
+	command string
+	file    string
+}
+
+// NewJsonnetRenderer returns nil when no Jsonnet file is configured.
+func NewJsonnetRenderer(cfg TemplatesConfig) (*JsonnetRenderer, error) {
+	if cfg.Jsonnet == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(cfg.Jsonnet); err != nil {
+		return nil, err
+	}
+
+	command := cfg.JsonnetCommand
+	if command == "" {
+		command = "jsonnet"
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, err
+	}
+	return &JsonnetRenderer{command: command, file: cfg.Jsonnet}, nil
+}
+
+// Render evaluates the Jsonnet file against payload. The jsonnet_timeout
+// and max_output limits of sandbox, when not nil, bound the evaluation,
+// which is killed once it runs past its timeout or writes too much.
+func (j *JsonnetRenderer) Render(payload *AlertManagerPayload, sandbox *TemplateSandbox) (*GoogleChatMessage, error) {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdout := &sandboxWriter{}
+	if sandbox == nil {
+		ctx, cancel = context.WithTimeout(ctx, jsonnetTimeout)
+		defer cancel()
+	} else {
+		if timeout := sandbox.limits.JsonnetTimeout; timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		stdout.max = sandbox.limits.MaxOutput
+	}
+	// Output past max_output fails the write; stop the process rather than
+	// let it run on.
+	stdout.full = cancel
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, j.command, "--ext-code-file", "payload=/dev/stdin", j.file)
+	cmd.WaitDelay = jsonnetWaitDelay
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		switch {
+		case stdout.overflow:
+			sandbox.exceeded(limitOutput)
+			return nil, fmt.Errorf("%s %s: %w of %d bytes", j.command, j.file, errTemplateOutput, stdout.max)
+		case ctx.Err() != nil && sandbox != nil:
+			sandbox.exceeded(limitTimeout)
+		}
+		return nil, fmt.Errorf("%s %s: %v: %s", j.command, j.file, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var message GoogleChatMessage
+	if err := json.Unmarshal(stdout.buf.Bytes(), &message); err != nil {
+		return nil, fmt.Errorf("invalid jsonnet output: %v", err)
+	}
+	if message.Text == "" && len(message.Cards) == 0 && len(message.CardsV2) == 0 {
+		return nil, fmt.Errorf("jsonnet output has neither text nor cards")
+	}
+	return &message, nil
+}
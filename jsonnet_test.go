@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeJsonnet writes a stand-in for the jsonnet binary that checks its
+// arguments and prints output, so the test does not need jsonnet installed.
+func fakeJsonnet(t *testing.T, dir, output string) string {
+	t.Helper()
+	script := "#!/bin/sh\n" +
+		"[ \"$1\" = --ext-code-file ] && [ \"$2\" = payload=/dev/stdin ] || exit 2\n" +
+		"grep -q HighCPU || exit 3\n" +
+		"echo '" + output + "'\n"
+	path := filepath.Join(dir, "jsonnet")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJsonnetRenderer(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "card.jsonnet")
+	if err := os.WriteFile(file, []byte(`{ text: std.extVar("payload").status }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := NewJsonnetRenderer(TemplatesConfig{}); r != nil || err != nil {
+		t.Errorf("NewJsonnetRenderer() without file = %v, %v; want nil, nil", r, err)
+	}
+	if _, err := NewJsonnetRenderer(TemplatesConfig{Jsonnet: filepath.Join(dir, "missing.jsonnet")}); err == nil {
+		t.Error("Expected error for missing jsonnet file")
+	}
+
+	payload := &AlertManagerPayload{
+		Status: "firing",
+		Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "HighCPU"}}},
+	}
+
+	r, err := NewJsonnetRenderer(TemplatesConfig{
+		Jsonnet:        file,
+		JsonnetCommand: fakeJsonnet(t, dir, `{"text":"firing","cards":[{"header":{"title":"HighCPU"}}]}`),
+	})
+	if err != nil {
+		t.Fatalf("NewJsonnetRenderer() error = %v", err)
+	}
+	message, err := r.Render(payload, nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if message.Text != "firing" || len(message.Cards) != 1 || message.Cards[0].Header.Title != "HighCPU" {
+		t.Errorf("Unexpected message: %+v", message)
+	}
+
+	r.command = fakeJsonnet(t, dir, `{}`)
+	if _, err := r.Render(payload, nil); err == nil {
+		t.Error("Expected error for empty jsonnet output")
+	}
+}
+
+func TestJsonnetRendererLimits(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	dir := t.TempDir()
+	script := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	payload := &AlertManagerPayload{Status: "firing"}
+
+	tests := []struct {
+		name    string
+		command string
+		limits  TemplateLimitsConfig
+		wantErr string
+	}{
+		{
+			name:    "template timeout does not apply",
+			command: script("slow", `sleep 0.2; echo '{"text":"firing"}'`),
+			limits:  TemplateLimitsConfig{Timeout: time.Millisecond, JsonnetTimeout: 5 * time.Second},
+		},
+		{
+			name:    "jsonnet timeout",
+			command: script("hang", "sleep 10"),
+			limits:  TemplateLimitsConfig{JsonnetTimeout: 100 * time.Millisecond},
+			wantErr: "signal: killed",
+		},
+		{
+			name:    "endless output is stopped",
+			command: script("endless", "yes"),
+			limits:  TemplateLimitsConfig{MaxOutput: 1024},
+			wantErr: "exceeds max_output of 1024 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &JsonnetRenderer{command: tt.command, file: "card.jsonnet"}
+			start := time.Now()
+			_, err := r.Render(payload, NewTemplateSandbox("ops", tt.limits))
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Render() took %s, want the evaluation stopped", elapsed)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Render() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Render() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
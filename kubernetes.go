@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	chatRouteAPI = "/apis/alertmanager-to-gchat.io/v1alpha1"
+
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// ChatRoute is a namespaced Kubernetes resource adding a route for the
+// alerts of its namespace.
+type ChatRoute struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec ChatRouteSpec `json:"spec"`
+}
+
+// ChatRouteSpec narrows the namespace's alerts further with Matchers and
+// sends them to a Chat space by name, or to a webhook URL kept in a Secret
+// of the same namespace.
+type ChatRouteSpec struct {
+	Matchers         []string      `json:"matchers"`
+	Space            string        `json:"space"`
+	WebhookSecretRef *SecretKeyRef `json:"webhookSecretRef"`
+}
+
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// ChatRouteStatus is what the admin API reports for a ChatRoute.
+type ChatRouteStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Route is the route name used in logs and metrics.
+	Route string `json:"route"`
+	// Error says why the resource is not routed to, when it is invalid.
+	Error string `json:"error,omitempty"`
+}
+
+// kubernetesRoutes holds the routes built from ChatRoute resources, which
+// are tried before the configured routes.
+var kubernetesRoutes atomic.Pointer[[]*Route]
+
+// KubeClient is a minimal Kubernetes API client authenticated with a
+// service account token.
+type KubeClient struct {
+	baseURL   string
+	tokenFile string
+	client    *http.Client
+}
+
+// NewKubeClient returns a client for the configured API server, by default
+// the one the pod runs in.
+func NewKubeClient(cfg KubernetesConfig) (*KubeClient, error) {
+	server := cfg.APIServer
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a Kubernetes pod; set api_server")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+
+	transport := &http.Transport{DialContext: resolver.DialContext, IdleConnTimeout: 90 * time.Second}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &KubeClient{
+		baseURL:   strings.TrimSuffix(server, "/"),
+		tokenFile: cfg.TokenFile,
+		client:    &http.Client{Transport: transport},
+	}, nil
+}
+
+// get requests path from the API server. The token is read on every
+// request, since projected service account tokens are rotated.
+func (k *KubeClient) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if k.tokenFile != "" {
+		token, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHealthError))
+		resp.Body.Close()
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return resp, nil
+}
+
+func (k *KubeClient) getJSON(ctx context.Context, path string, v any) error {
+	resp, err := k.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// SecretValue returns one key of a Secret.
+func (k *KubeClient) SecretValue(ctx context.Context, namespace string, ref SecretKeyRef) (string, error) {
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	if err := k.getJSON(ctx, "/api/v1/namespaces/"+url.PathEscape(namespace)+"/secrets/"+url.PathEscape(ref.Name), &secret); err != nil {
+		return "", fmt.Errorf("error reading secret %s: %v", ref.Name, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+type chatRouteState struct {
+	route  *Route
+	status ChatRouteStatus
+}
+
+// ChatRouteController watches ChatRoute resources and keeps
+// kubernetesRoutes in step with them.
+type ChatRouteController struct {
+	client *KubeClient
+	cfg    KubernetesConfig
+
+	mu sync.Mutex
+	// routes maps namespace/name to the state of each resource.
+	routes map[string]chatRouteState
+}
+
+// chatRoutes is nil unless operator mode is enabled.
+var chatRoutes *ChatRouteController
+
+func NewChatRouteController(cfg KubernetesConfig) (*ChatRouteController, error) {
+	client, err := NewKubeClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatRouteController{client: client, cfg: cfg, routes: map[string]chatRouteState{}}, nil
+}
+
+// Run watches the configured namespaces, or all of them, until stop is
+// closed.
+func (c *ChatRouteController) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	namespaces := c.cfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	var wg sync.WaitGroup
+	for _, namespace := range namespaces {
+		wg.Add(1)
+		go func(namespace string) {
+			defer wg.Done()
+			c.watchNamespace(ctx, namespace)
+		}(namespace)
+	}
+	wg.Wait()
+}
+
+// watchNamespace lists the ChatRoutes of namespace ("" for all) and
+// watches for changes, listing again after every resync period or
+// error, until ctx is done.
+func (c *ChatRouteController) watchNamespace(ctx context.Context, namespace string) {
+	backoff := time.Second
+	for {
+		version, err := c.list(ctx, namespace)
+		if err == nil {
+			backoff = time.Second
+			err = c.watch(ctx, namespace, version)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		logger.ErrorRepeated("chatroutes/"+namespace, "Error watching ChatRoute resources: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func chatRoutePath(namespace string) string {
+	if namespace == "" {
+		return chatRouteAPI + "/chatroutes"
+	}
+	return chatRouteAPI + "/namespaces/" + url.PathEscape(namespace) + "/chatroutes"
+}
+
+// list replaces the routes of namespace ("" for all) with the listed
+// resources and returns the list's resource version to watch from.
+func (c *ChatRouteController) list(ctx context.Context, namespace string) (string, error) {
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []ChatRoute `json:"items"`
+	}
+	if err := c.client.getJSON(ctx, chatRoutePath(namespace), &list); err != nil {
+		return "", fmt.Errorf("error listing ChatRoutes: %v", err)
+	}
+
+	states := map[string]chatRouteState{}
+	for _, cr := range list.Items {
+		states[cr.Metadata.Namespace+"/"+cr.Metadata.Name] = c.compile(ctx, cr)
+	}
+	c.mu.Lock()
+	for key := range c.routes {
+		if namespace == "" || strings.HasPrefix(key, namespace+"/") {
+			delete(c.routes, key)
+		}
+	}
+	for key, state := range states {
+		c.routes[key] = state
+	}
+	c.publish()
+	c.mu.Unlock()
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies changes to the ChatRoutes of namespace from version on.
+// It returns nil when the API server ends the watch after the resync
+// period, or when the version has expired, so the caller lists again.
+func (c *ChatRouteController) watch(ctx context.Context, namespace, version string) error {
+	q := url.Values{
+		"watch":           {"true"},
+		"resourceVersion": {version},
+		"timeoutSeconds":  {fmt.Sprint(int(c.cfg.Resync.Seconds()))},
+	}
+	resp, err := c.client.get(ctx, chatRoutePath(namespace)+"?"+q.Encode())
+	if err != nil {
+		return fmt.Errorf("error watching ChatRoutes: %v", err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error reading ChatRoute watch: %v", err)
+		}
+
+		if event.Type == "ERROR" {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return nil
+			}
+			return fmt.Errorf("ChatRoute watch failed: %s", status.Message)
+		}
+		var cr ChatRoute
+		if err := json.Unmarshal(event.Object, &cr); err != nil {
+			return fmt.Errorf("invalid ChatRoute in watch: %v", err)
+		}
+		key := cr.Metadata.Namespace + "/" + cr.Metadata.Name
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			state := c.compile(ctx, cr)
+			c.mu.Lock()
+			c.routes[key] = state
+			c.publish()
+			c.mu.Unlock()
+		case "DELETED":
+			logger.Info("ChatRoute %s deleted", key)
+			c.mu.Lock()
+			delete(c.routes, key)
+			c.publish()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// compile builds the route for cr. An invalid resource is kept with its
+// error, and routes nothing.
+func (c *ChatRouteController) compile(ctx context.Context, cr ChatRoute) chatRouteState {
+	name := cr.Metadata.Namespace + "/" + cr.Metadata.Name
+	state := chatRouteState{status: ChatRouteStatus{Namespace: cr.Metadata.Namespace, Name: cr.Metadata.Name, Route: name}}
+	route, err := c.newRoute(ctx, name, cr)
+	if err != nil {
+		logger.Error("ChatRoute %s is invalid: %v", name, err)
+		state.status.Error = err.Error()
+		return state
+	}
+	logger.Debug("ChatRoute %s routes alerts from namespace %s", name, cr.Metadata.Namespace)
+	state.route = route
+	return state
+}
+
+func (c *ChatRouteController) newRoute(ctx context.Context, name string, cr ChatRoute) (*Route, error) {
+	matchers, err := ParseMatchers(cr.Spec.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	// The namespace matcher comes first and cannot be overridden, so a
+	// ChatRoute only ever receives its own namespace's alerts.
+	matchers = append(Matchers{{Name: c.cfg.NamespaceLabel, Type: MatchEqual, Value: cr.Metadata.Namespace}}, matchers...)
+
+	rt := getRuntime()
+	route := &Route{
+		Name:     name,
+		Matchers: matchers,
+		Additive: true,
+		Sandbox:  NewTemplateSandbox(name, rt.Config.Templates.Limits),
+	}
+	switch {
+	case cr.Spec.Space != "" && cr.Spec.WebhookSecretRef != nil:
+		return nil, fmt.Errorf("space and webhookSecretRef are mutually exclusive")
+	case cr.Spec.Space != "":
+		if !c.allowedSpace(cr.Spec.Space, cr.Metadata.Namespace) {
+			return nil, fmt.Errorf("space %q is not on allowed_spaces for namespace %s", cr.Spec.Space, cr.Metadata.Namespace)
+		}
+		if rt.Chat == nil {
+			return nil, fmt.Errorf("space requires Chat API credentials in [google_chat]")
+		}
+		route.Provider = chatSpaceProvider{space: cr.Spec.Space}
+	case cr.Spec.WebhookSecretRef != nil:
+		webhookURL, err := c.client.SecretValue(ctx, cr.Metadata.Namespace, *cr.Spec.WebhookSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(webhookURL)
+		if err != nil || u.Scheme != "https" || !c.allowed(u.Hostname()) {
+			return nil, fmt.Errorf("webhook URL in secret %s must be an https URL on one of %s", cr.Spec.WebhookSecretRef.Name, strings.Join(c.cfg.AllowedHosts, ", "))
+		}
+		if route.Provider, err = NewGoogleChatProvider(webhookURL, rt.Config.Delivery.Timeout, OutboundConfig{}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("either space or webhookSecretRef is required")
+	}
+	return route, nil
+}
+
+// allowed reports whether host matches one of the allowed host patterns.
+func (c *ChatRouteController) allowed(host string) bool {
+	for _, pattern := range c.cfg.AllowedHosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedSpace reports whether a ChatRoute in namespace may post to space,
+// by display or resource name. "{namespace}" in a pattern stands for the
+// ChatRoute's namespace.
+func (c *ChatRouteController) allowedSpace(space, namespace string) bool {
+	for _, pattern := range c.cfg.AllowedSpaces {
+		pattern = strings.ReplaceAll(pattern, "{namespace}", namespace)
+		if ok, _ := path.Match(pattern, space); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// chatSpaceProvider posts to a space through the Chat API client of the
+// active Runtime, so ChatRoutes follow credential changes on reload.
+type chatSpaceProvider struct {
+	space string
+}
+
+func (p chatSpaceProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error {
+	chat := getRuntime().Chat
+	if chat == nil {
+		return fmt.Errorf("space %q requires Chat API credentials in [google_chat]", p.space)
+	}
+	return (&ChatAPIProvider{API: chat, Space: p.space}).Send(ctx, message, opts)
+}
+
+// publish replaces kubernetesRoutes with the valid routes, in name order.
+// The caller holds c.mu.
+func (c *ChatRouteController) publish() {
+	routes := make([]*Route, 0, len(c.routes))
+	invalid := 0
+	for _, state := range c.routes {
+		if state.route == nil {
+			invalid++
+			continue
+		}
+		routes = append(routes, state.route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Name < routes[j].Name })
+	kubernetesRoutes.Store(&routes)
+	chatRouteResources.WithLabelValues("active").Set(float64(len(routes)))
+	chatRouteResources.WithLabelValues("invalid").Set(float64(invalid))
+}
+
+// Status returns the state of every ChatRoute, sorted by route name.
+func (c *ChatRouteController) Status() []ChatRouteStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]ChatRouteStatus, 0, len(c.routes))
+	for _, state := range c.routes {
+		list = append(list, state.status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Route < list[j].Route })
+	return list
+}
+
+// chatRoutesHandler lists the ChatRoute resources and why any are invalid.
+func chatRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if chatRoutes == nil {
+		http.Error(w, "Kubernetes mode is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chatRoutes.Status())
+}
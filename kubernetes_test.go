@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChatRouteController(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	defer kubernetesRoutes.Store(nil)
+	policy := NewDeliveryPolicy(DeliveryConfig{})
+	currentRuntime.Store(&Runtime{
+		Chat:            &ChatAPI{},
+		DefaultRoute:    &Route{Name: defaultRouteName},
+		Routes:          []*Route{{Name: "payments-oncall", Matchers: Matchers{{Name: "team", Type: MatchEqual, Value: "payments"}}}},
+		ChatRoutePolicy: policy,
+	})
+
+	chatRoute := func(namespace, name string, spec ChatRouteSpec) ChatRoute {
+		var cr ChatRoute
+		cr.Metadata.Namespace, cr.Metadata.Name, cr.Spec = namespace, name, spec
+		return cr
+	}
+	secrets := map[string]string{
+		"/api/v1/namespaces/payments/secrets/chat": "https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t",
+		"/api/v1/namespaces/web/secrets/chat":      "https://attacker.example.com/collect",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if url, ok := secrets[r.URL.Path]; ok {
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string][]byte{"url": []byte(url)}})
+			return
+		}
+		if r.URL.Path != chatRouteAPI+"/chatroutes" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("watch") != "true" {
+			json.NewEncoder(w).Encode(map[string]any{
+				"metadata": map[string]string{"resourceVersion": "41"},
+				"items": []ChatRoute{
+					chatRoute("payments", "alerts", ChatRouteSpec{Matchers: []string{`severity="critical"`}, WebhookSecretRef: &SecretKeyRef{Name: "chat", Key: "url"}}),
+					chatRoute("web", "alerts", ChatRouteSpec{WebhookSecretRef: &SecretKeyRef{Name: "chat", Key: "url"}}),
+					chatRoute("web", "space", ChatRouteSpec{Space: "Payments On-Call"}),
+					chatRoute("payments", "space", ChatRouteSpec{Matchers: []string{`severity="info"`}, Space: "payments-alerts"}),
+				},
+			})
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") != "41" {
+			t.Errorf("watch from %q, want the list's version", r.URL.Query().Get("resourceVersion"))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.Encode(map[string]any{"type": "ADDED", "object": chatRoute("search", "alerts", ChatRouteSpec{})})
+		encoder.Encode(map[string]any{"type": "DELETED", "object": chatRoute("web", "alerts", ChatRouteSpec{})})
+	}))
+	defer server.Close()
+
+	token := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(token, []byte("sa-token\n"), 0o600)
+	c, err := NewChatRouteController(KubernetesConfig{
+		APIServer:      server.URL,
+		TokenFile:      token,
+		NamespaceLabel: "namespace",
+		AllowedHosts:   []string{"chat.googleapis.com"},
+		AllowedSpaces:  []string{"{namespace}-*"},
+		Resync:         time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	version, err := c.list(ctx, "")
+	if err != nil {
+		t.Fatalf("list() error = %v", err)
+	}
+	if status := c.Status(); len(status) != 4 || status[1].Error != "" || status[2].Error == "" || status[3].Error == "" {
+		t.Errorf("Expected the webhook outside allowed_hosts and the space outside allowed_spaces to be rejected, got %+v", status)
+	}
+	if err := c.watch(ctx, "", version); err != nil {
+		t.Fatalf("watch() error = %v", err)
+	}
+
+	status := c.Status()
+	if len(status) != 4 || status[0].Route != "payments/alerts" || status[0].Error != "" || status[1].Route != "payments/space" ||
+		status[2].Route != "search/alerts" || status[2].Error != "either space or webhookSecretRef is required" ||
+		status[3].Route != "web/space" || status[3].Error != `space "Payments On-Call" is not on allowed_spaces for namespace web` {
+		t.Errorf("Unexpected ChatRoute status %+v", status)
+	}
+
+	tests := []struct {
+		name   string
+		labels KV
+		want   []string
+	}{
+		{name: "own namespace", labels: KV{"namespace": "payments", "severity": "critical"}, want: []string{"payments/alerts", defaultRouteName}},
+		{name: "configured routes still match", labels: KV{"namespace": "payments", "severity": "critical", "team": "payments"}, want: []string{"payments/alerts", "payments-oncall"}},
+		{name: "matchers still apply", labels: KV{"namespace": "payments", "severity": "warning"}, want: []string{defaultRouteName}},
+		{name: "other namespace", labels: KV{"namespace": "billing", "severity": "critical"}, want: []string{defaultRouteName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, route := range getRuntime().MatchingRoutes(&AlertManagerPayload{CommonLabels: tt.labels}) {
+				got = append(got, route.Name)
+				if route.Additive && route.Policy != policy {
+					t.Errorf("route %s delivers with %p, want the active runtime's policy", route.Name, route.Policy)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("MatchingRoutes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
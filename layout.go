@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Card section names accepted in [layout] sections.
+const (
+	SectionSummary      = "summary"
+	SectionAlerts       = "alerts"
+	SectionExternalLink = "external_link"
+)
+
+// Widget names accepted in [layout] summary_widgets and alert_widgets.
+const (
+	WidgetStatus            = "status"
+	WidgetLabelChips        = "label_chips"
+	WidgetTruncated         = "truncated"
+	WidgetDurations         = "durations"
+	WidgetCommonLabels      = "common_labels"
+	WidgetCommonAnnotations = "common_annotations"
+
+	WidgetDescription = "description"
+	WidgetLabels      = "labels"
+	WidgetStarted     = "started"
+	WidgetDuration    = "duration"
+	WidgetAck         = "ack"
+	WidgetButtons     = "buttons"
+)
+
+var defaultLayout = LayoutConfig{
+	Sections:       []string{SectionSummary, SectionAlerts, SectionExternalLink},
+	SummaryWidgets: []string{WidgetStatus, WidgetLabelChips, WidgetTruncated, WidgetDurations, WidgetCommonLabels, WidgetCommonAnnotations},
+	AlertWidgets:   []string{WidgetDescription, WidgetLabels, WidgetStarted, WidgetDuration, WidgetAck, WidgetButtons},
+}
+
+// withDefaults fills every unset list with the default layout.
+func (l LayoutConfig) withDefaults() LayoutConfig {
+	if l.Sections == nil {
+		l.Sections = defaultLayout.Sections
+	}
+	if l.SummaryWidgets == nil {
+		l.SummaryWidgets = defaultLayout.SummaryWidgets
+	}
+	if l.AlertWidgets == nil {
+		l.AlertWidgets = defaultLayout.AlertWidgets
+	}
+	return l
+}
+
+// Validate rejects unknown and duplicate section or widget names.
+func (l LayoutConfig) Validate() error {
+	if err := validateLayoutList("sections", l.Sections, defaultLayout.Sections); err != nil {
+		return err
+	}
+	if err := validateLayoutList("summary_widgets", l.SummaryWidgets, defaultLayout.SummaryWidgets); err != nil {
+		return err
+	}
+	if err := validateLayoutList("alert_widgets", l.AlertWidgets, defaultLayout.AlertWidgets); err != nil {
+		return err
+	}
+	for severity, c := range l.Colors {
+		if _, err := parseHexColor(c); err != nil {
+			return fmt.Errorf("colors.%s: %v", severity, err)
+		}
+	}
+	if err := validateLabelList("label_columns", l.LabelColumns); err != nil {
+		return err
+	}
+	return validateLabelList("chip_labels", l.ChipLabels)
+}
+
+// usesCardsV2 reports whether messages are sent as cardsV2, either because
+// cards_v2 is set or because the layout uses widgets only cardsV2 has.
+func (l LayoutConfig) usesCardsV2() bool {
+	return l.CardsV2 || len(l.LabelColumns) > 0 || len(l.ChipLabels) > 0
+}
+
+// validateLabelList rejects empty and duplicate label names in field.
+func validateLabelList(field string, labels []string) error {
+	seen := map[string]bool{}
+	for _, l := range labels {
+		if l == "" {
+			return fmt.Errorf("empty %s entry", field)
+		}
+		if seen[l] {
+			return fmt.Errorf("duplicate %s entry %q", field, l)
+		}
+		seen[l] = true
+	}
+	return nil
+}
+
+// labelRows returns the labels to show in a label table, in the order of
+// columns, with "*" expanding to the labels not listed.
+func labelRows(labels KV, columns []string) Pairs {
+	listed := map[string]bool{}
+	for _, c := range columns {
+		listed[c] = true
+	}
+	var rows Pairs
+	for _, c := range columns {
+		if c == "*" {
+			for _, p := range labels.SortedPairs() {
+				if !listed[p.Name] {
+					rows = append(rows, p)
+				}
+			}
+			continue
+		}
+		if v, ok := labels[c]; ok {
+			rows = append(rows, Pair{Name: c, Value: v})
+		}
+	}
+	return rows
+}
+
+// labelsWidget renders labels under title, as a table when columns are
+// configured and as a bullet list otherwise. The table keeps the list as
+// the legacy card fallback.
+func labelsWidget(title string, labels KV, columns []string) Widget {
+	w := Widget{KeyValue: &KeyValue{TopLabel: title, Content: formatMapAsList(labels), ContentMultiline: true}}
+	if len(columns) > 0 {
+		w.Table = &LabelTable{Title: title, Rows: labelRows(labels, columns)}
+	}
+	return w
+}
+
+// labelChips renders the listed labels present in labels as chips. With an
+// AlertManager URL each chip links to the alerts carrying that label value.
+func labelChips(labels KV, names []string, externalURL string) *ChipList {
+	var chips []Chip
+	for _, name := range names {
+		value, ok := labels[name]
+		if !ok {
+			continue
+		}
+		chip := Chip{Label: name + ": " + value}
+		if externalURL != "" {
+			filter := url.QueryEscape(fmt.Sprintf("{%s=%q}", name, value))
+			chip.OnClick = &OnClickAction{OpenLink: &OpenLink{URL: strings.TrimSuffix(externalURL, "/") + "/#/alerts?filter=" + filter}}
+		}
+		chips = append(chips, chip)
+	}
+	if len(chips) == 0 {
+		return nil
+	}
+	return &ChipList{Chips: chips}
+}
+
+func validateLayoutList(field string, names, allowed []string) error {
+	valid := map[string]bool{}
+	for _, a := range allowed {
+		valid[a] = true
+	}
+
+	seen := map[string]bool{}
+	for _, n := range names {
+		if !valid[n] {
+			return fmt.Errorf("unknown %s entry %q (allowed: %v)", field, n, allowed)
+		}
+		if seen[n] {
+			return fmt.Errorf("duplicate %s entry %q", field, n)
+		}
+		seen[n] = true
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConvertWithCustomLayout(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+
+	currentRuntime.Store(&Runtime{Config: Config{Layout: LayoutConfig{
+		Sections:     []string{SectionAlerts, SectionSummary},
+		AlertWidgets: []string{WidgetLabels},
+	}}})
+
+	payload := &AlertManagerPayload{
+		Status: "firing",
+		Alerts: Alerts{
+			{
+				Status:       "firing",
+				Labels:       KV{"alertname": "HighCPU"},
+				Annotations:  KV{"description": "CPU is high"},
+				GeneratorURL: "http://prometheus/graph",
+			},
+		},
+		ExternalURL: "http://alertmanager",
+	}
+
+	msg := convertToGoogleChatFormat(payload)
+	sections := msg.Cards[0].Sections
+	if len(sections) != 2 {
+		t.Fatalf("Expected 2 sections, got %d", len(sections))
+	}
+	if sections[0].Header != "Alert #1" || sections[1].Header != "Summary" {
+		t.Errorf("Unexpected section order: %q, %q", sections[0].Header, sections[1].Header)
+	}
+	if len(sections[0].Widgets) != 1 || sections[0].Widgets[0].KeyValue == nil || sections[0].Widgets[0].KeyValue.TopLabel != "Labels" {
+		t.Errorf("Expected only the labels widget in the alert section, got %+v", sections[0].Widgets)
+	}
+	if len(sections[1].Widgets) != 1 {
+		t.Errorf("Expected default summary widgets, got %d", len(sections[1].Widgets))
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  LayoutConfig
+		wantErr bool
+	}{
+		{name: "default", layout: LayoutConfig{}},
+		{name: "drop sections", layout: LayoutConfig{Sections: []string{SectionAlerts}}},
+		{name: "unknown section", layout: LayoutConfig{Sections: []string{"footer"}}, wantErr: true},
+		{name: "duplicate widget", layout: LayoutConfig{AlertWidgets: []string{WidgetLabels, WidgetLabels}}, wantErr: true},
+		{name: "summary widget in alert", layout: LayoutConfig{AlertWidgets: []string{WidgetStatus}}, wantErr: true},
+		{name: "colors", layout: LayoutConfig{Colors: map[string]string{"critical": "#FF0000"}}},
+		{name: "bad color", layout: LayoutConfig{Colors: map[string]string{"critical": "red"}}, wantErr: true},
+		{name: "label columns", layout: LayoutConfig{LabelColumns: []string{"instance", "*"}}},
+		{name: "duplicate label column", layout: LayoutConfig{LabelColumns: []string{"instance", "instance"}}, wantErr: true},
+		{name: "chip labels", layout: LayoutConfig{ChipLabels: []string{"severity", "team"}}},
+		{name: "empty chip label", layout: LayoutConfig{ChipLabels: []string{""}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.layout.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConvertCardsV2(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+
+	currentRuntime.Store(&Runtime{Config: Config{Layout: LayoutConfig{
+		CardsV2: true,
+		Colors:  map[string]string{"warning": "#FF8000"},
+	}}})
+
+	payload := &AlertManagerPayload{
+		Status:       "firing",
+		CommonLabels: KV{"alertname": "HighCPU", "severity": "warning"},
+		Alerts: Alerts{
+			{
+				Status:       "firing",
+				Labels:       KV{"alertname": "HighCPU", "severity": "warning"},
+				Annotations:  KV{"description": "CPU is high"},
+				GeneratorURL: "http://prometheus/graph",
+			},
+		},
+	}
+
+	msg := convertToGoogleChatFormat(payload)
+	if len(msg.Cards) != 0 || len(msg.CardsV2) != 1 {
+		t.Fatalf("Expected one cardsV2 card and no legacy cards, got %d and %d", len(msg.CardsV2), len(msg.Cards))
+	}
+	sections := msg.CardsV2[0].Card.Sections
+
+	summary := sections[0]
+	if !summary.Collapsible || summary.UncollapsibleWidgetsCount != 1 {
+		t.Errorf("Expected summary collapsible after the status, got %v/%d", summary.Collapsible, summary.UncollapsibleWidgetsCount)
+	}
+	if status := summary.Widgets[0].DecoratedText; status == nil || !strings.Contains(status.Text, `<font color="#FF8000">`) {
+		t.Errorf("Expected accent colored status, got %+v", summary.Widgets[0])
+	}
+
+	alert := sections[1]
+	if !alert.Collapsible || alert.UncollapsibleWidgetsCount != 1 {
+		t.Errorf("Expected alert collapsible after the description, got %v/%d", alert.Collapsible, alert.UncollapsibleWidgetsCount)
+	}
+	buttons := alert.Widgets[len(alert.Widgets)-1].ButtonList
+	if buttons == nil || buttons.Buttons[0].Color == nil || buttons.Buttons[0].Color.Red != 1 {
+		t.Errorf("Expected accent colored buttons, got %+v", alert.Widgets[len(alert.Widgets)-1])
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), `"cards"`) || !strings.Contains(string(body), `"uncollapsibleWidgetsCount":1`) {
+		t.Errorf("Unexpected JSON: %s", body)
+	}
+}
+
+func TestLabelColumns(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{})
+
+	payload := &AlertManagerPayload{
+		Status: "firing",
+		Alerts: Alerts{{
+			Status:      "firing",
+			Labels:      KV{"alertname": "HighCPU", "instance": "web-1", "job": "node", "severity": "warning"},
+			Annotations: KV{"description": "CPU is high"},
+		}},
+	}
+	route := &Route{Name: "ops", LabelColumns: []string{"severity", "*"}}
+	msg := renderMessage(payload, route.Layout(LayoutConfig{AlertWidgets: []string{WidgetDescription, WidgetLabels}}), nil)
+	if len(msg.Cards) != 0 || len(msg.CardsV2) != 1 {
+		t.Fatalf("Expected label columns to send cardsV2, got %d legacy and %d cardsV2 cards", len(msg.Cards), len(msg.CardsV2))
+	}
+
+	alert := msg.CardsV2[0].Card.Sections[1]
+	if !alert.Collapsible || alert.UncollapsibleWidgetsCount != 1 {
+		t.Errorf("Expected the table collapsed after the description, got %v/%d", alert.Collapsible, alert.UncollapsibleWidgetsCount)
+	}
+	var rows []string
+	for _, w := range alert.Widgets[2:] {
+		if w.Columns == nil || len(w.Columns.ColumnItems) != 2 {
+			t.Fatalf("Expected a two-column row, got %+v", w)
+		}
+		name := w.Columns.ColumnItems[0].Widgets[0].TextParagraph.Text
+		value := w.Columns.ColumnItems[1].Widgets[0].TextParagraph.Text
+		rows = append(rows, name[strings.Index(name, ">")+1:strings.LastIndex(name, "<")]+"="+value)
+	}
+	if got := strings.Join(rows, ","); got != "severity=warning,alertname=HighCPU,instance=web-1,job=node" {
+		t.Errorf("Unexpected rows %s", got)
+	}
+
+	route.LabelColumns = []string{}
+	msg = renderMessage(payload, route.Layout(LayoutConfig{LabelColumns: []string{"*"}}), nil)
+	if len(msg.Cards) != 1 {
+		t.Errorf("Expected an empty route list to turn the table off")
+	}
+}
+
+func TestLabelChips(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{})
+
+	payload := &AlertManagerPayload{
+		Status:       "firing",
+		CommonLabels: KV{"alertname": "HighCPU", "severity": "critical", "team": "db"},
+		ExternalURL:  "http://alertmanager/",
+		Alerts: Alerts{{
+			Status:      "firing",
+			Labels:      KV{"alertname": "HighCPU", "severity": "critical", "team": "db"},
+			Annotations: KV{"description": "CPU is high"},
+		}},
+	}
+	msg := renderMessage(payload, LayoutConfig{ChipLabels: []string{"team", "cluster", "severity"}}.withDefaults(), nil)
+	if len(msg.Cards) != 0 || len(msg.CardsV2) != 1 {
+		t.Fatalf("Expected chip labels to send cardsV2, got %d legacy and %d cardsV2 cards", len(msg.Cards), len(msg.CardsV2))
+	}
+
+	summary := msg.CardsV2[0].Card.Sections[0]
+	status := summary.Widgets[0].DecoratedText
+	if status == nil || status.StartIcon == nil || status.StartIcon.MaterialIcon == nil || status.StartIcon.MaterialIcon.Name != "notifications_active" {
+		t.Errorf("Expected a firing icon on the status, got %+v", summary.Widgets[0])
+	}
+	chips := summary.Widgets[1].ChipList
+	if chips == nil || len(chips.Chips) != 2 {
+		t.Fatalf("Expected two chips after the status, got %+v", summary.Widgets[1])
+	}
+	if chips.Chips[0].Label != "team: db" || chips.Chips[1].Label != "severity: critical" {
+		t.Errorf("Unexpected chips %q, %q", chips.Chips[0].Label, chips.Chips[1].Label)
+	}
+	if got, want := chips.Chips[0].OnClick.OpenLink.URL, "http://alertmanager/#/alerts?filter=%7Bteam%3D%22db%22%7D"; got != want {
+		t.Errorf("Chip link = %s, want %s", got, want)
+	}
+
+	started := msg.CardsV2[0].Card.Sections[1].Widgets
+	for _, w := range started {
+		if w.DecoratedText != nil && w.DecoratedText.TopLabel == "Started" && (w.DecoratedText.StartIcon == nil || w.DecoratedText.StartIcon.KnownIcon != "CLOCK") {
+			t.Errorf("Expected a clock icon on the start time, got %+v", w.DecoratedText.StartIcon)
+		}
+	}
+
+	if text := plainTextMessage(msg).Text; !strings.Contains(text, "team: db, severity: critical") {
+		t.Errorf("Expected chips in the plain text fallback, got %q", text)
+	}
+}
+
+func TestAccentColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload *AlertManagerPayload
+		want    string
+	}{
+		{name: "common severity", payload: &AlertManagerPayload{Status: "firing", CommonLabels: KV{"severity": "critical"}}, want: "#D93025"},
+		{name: "first alert severity", payload: &AlertManagerPayload{Status: "firing", Alerts: Alerts{{Labels: KV{"severity": "Info"}}}}, want: "#1A73E8"},
+		{name: "resolved", payload: &AlertManagerPayload{Status: "resolved", CommonLabels: KV{"severity": "critical"}}, want: "#188038"},
+		{name: "unknown", payload: &AlertManagerPayload{Status: "firing", CommonLabels: KV{"severity": "page"}}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accentColor(tt.payload, nil); got != tt.want {
+				t.Errorf("accentColor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
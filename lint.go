@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// lintFixtures are representative payloads bundled with the binary, so
+// lint-templates can run without any recordings.
+//
+//go:embed fixtures/*.json
+var lintFixtures embed.FS
+
+// LintFixture is a payload that templates are rendered against.
+type LintFixture struct {
+	Name    string
+	Payload *AlertManagerPayload
+}
+
+// LintOutput is everything rendered for one fixture and route. It is what
+// golden files hold.
+type LintOutput struct {
+	Message *GoogleChatMessage  `json:"message,omitempty"`
+	Tickets []map[string]string `json:"tickets,omitempty"`
+}
+
+// runLintTemplates implements the lint-templates subcommand: the configured
+// templates are rendered for every route against the bundled fixtures and
+// any payload files given, and the resulting messages are checked against
+// the Chat message schema and, optionally, golden files.
+func runLintTemplates(args []string) int {
+	fs := flag.NewFlagSet("lint-templates", flag.ContinueOnError)
+	golden := fs.String("golden", "", "Compare rendered output with the golden files in this directory")
+	update := fs.Bool("update", false, "Write the golden files instead of comparing them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [--config file] lint-templates [--golden dir [--update]] [file|dir]...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *update && *golden == "" {
+		fmt.Fprintln(fs.Output(), "--update requires --golden")
+		return 2
+	}
+
+	fixtures, err := loadLintFixtures(fs.Args())
+	if err != nil {
+		logger.Error("Error loading fixtures: %v", err)
+		return 1
+	}
+	if *update {
+		if err := os.MkdirAll(*golden, 0o755); err != nil {
+			logger.Error("Error creating golden directory: %v", err)
+			return 1
+		}
+	}
+
+	if failed := lintTemplates(os.Stdout, getRuntime(), fixtures, *golden, *update); failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadLintFixtures returns the bundled fixtures followed by the payloads in
+// paths, which are listed like replay recordings.
+func loadLintFixtures(paths []string) ([]LintFixture, error) {
+	entries, err := lintFixtures.ReadDir("fixtures")
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []LintFixture
+	for _, e := range entries {
+		body, err := lintFixtures.ReadFile(path.Join("fixtures", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fixture, err := parseLintFixture(e.Name(), body)
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	files, err := recordedFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fixture, err := parseLintFixture(filepath.Base(file), body)
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+func parseLintFixture(file string, body []byte) (LintFixture, error) {
+	if err := validateAlertPayload(body); err != nil {
+		return LintFixture{}, fmt.Errorf("%s: %v", file, err)
+	}
+	var payload AlertManagerPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return LintFixture{}, fmt.Errorf("%s: %v", file, err)
+	}
+	return LintFixture{Name: strings.TrimSuffix(file, ".json"), Payload: &payload}, nil
+}
+
+// lintTemplates renders every fixture for every route of rt, reporting one
+// line per combination to out, and returns how many failed. When golden is
+// set the output is compared with, or with update written to,
+// "<golden>/<fixture>.<route>.json".
+func lintTemplates(out io.Writer, rt *Runtime, fixtures []LintFixture, golden string, update bool) int {
+	routes := rt.Routes[:len(rt.Routes):len(rt.Routes)]
+	if rt.DefaultRoute != nil {
+		routes = append(routes, rt.DefaultRoute)
+	}
+	failed := 0
+	for _, fixture := range fixtures {
+		for _, route := range routes {
+			name := fixture.Name + "." + route.Name
+			output, problems := lintRoute(rt, route, fixture.Payload)
+			if golden != "" && len(problems) == 0 {
+				problems = checkGolden(filepath.Join(golden, name+".json"), output, update)
+			}
+			if len(problems) == 0 {
+				fmt.Fprintf(out, "ok   %s\n", name)
+				continue
+			}
+			failed++
+			fmt.Fprintf(out, "FAIL %s\n", name)
+			for _, p := range problems {
+				fmt.Fprintf(out, "     %s\n", p)
+			}
+		}
+	}
+	fmt.Fprintf(out, "%d fixture(s), %d route(s), %d failed\n", len(fixtures), len(routes), failed)
+	return failed
+}
+
+// lintRoute renders payload for route and returns what was rendered along
+// with every template error and schema violation found.
+func lintRoute(rt *Runtime, route *Route, payload *AlertManagerPayload) (*LintOutput, []string) {
+	output := &LintOutput{}
+	var problems []string
+
+	if !route.DisableChat {
+		// renderMessage falls back to the built-in card when a template
+		// fails, so template errors are collected here first.
+		templateErrors := 0
+		if rt.Jsonnet != nil {
+			if _, err := rt.Jsonnet.Render(payload, route.Sandbox); err != nil {
+				problems = append(problems, "jsonnet: "+err.Error())
+				templateErrors++
+			}
+		} else if rt.Templates != nil {
+			if _, err := rt.Templates.Title(payload, route.Sandbox); err != nil {
+				problems = append(problems, "title template: "+err.Error())
+				templateErrors++
+			}
+			if _, err := rt.Templates.Text(payload, route.Sandbox); err != nil {
+				problems = append(problems, "text template: "+err.Error())
+				templateErrors++
+			}
+		}
+
+		if templateErrors == 0 {
+			output.Message = renderMessage(payload, route.Layout(rt.Config.Layout), route.Sandbox)
+			var schemaErrs SchemaErrors
+			if err := validateChatMessage(output.Message); errors.As(err, &schemaErrs) {
+				for _, e := range schemaErrs {
+					problems = append(problems, "message: "+e)
+				}
+			} else if err != nil {
+				problems = append(problems, "message: "+err.Error())
+			}
+		}
+	}
+
+	for _, t := range route.Tickets {
+		previewer, ok := t.(ticketPreviewer)
+		if !ok {
+			continue
+		}
+		fields, err := previewer.Preview(payload)
+		if err != nil {
+			problems = append(problems, "ticket: "+err.Error())
+			continue
+		}
+		output.Tickets = append(output.Tickets, fields)
+	}
+	return output, problems
+}
+
+// checkGolden compares output with the golden file at file, or writes it
+// there when update is set.
+func checkGolden(file string, output *LintOutput, update bool) []string {
+	// HTML is left unescaped so card markup reads naturally in diffs.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(output); err != nil {
+		return []string{err.Error()}
+	}
+	got := buf.Bytes()
+
+	if update {
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			return []string{err.Error()}
+		}
+		return nil
+	}
+
+	want, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{fmt.Sprintf("golden file %s does not exist, run with --update to create it", file)}
+	} else if err != nil {
+		return []string{err.Error()}
+	}
+	if bytes.Equal(got, want) {
+		return nil
+	}
+
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; ; i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return []string{
+				fmt.Sprintf("differs from %s at line %d:", file, i+1),
+				"  want: " + strings.TrimSpace(w),
+				"  got:  " + strings.TrimSpace(g),
+			}
+		}
+	}
+}
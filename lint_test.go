@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintTemplates(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	fixtures, err := loadLintFixtures(nil)
+	if err != nil {
+		t.Fatalf("loadLintFixtures() error = %v", err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no bundled fixtures")
+	}
+
+	jira, err := NewJiraProvider(JiraConfig{Project: "OPS", Labels: []string{"{{ .CommonLabels.severity }}"}}, "ops", nil, nil)
+	if err != nil {
+		t.Fatalf("NewJiraProvider() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		templates  TemplatesConfig
+		layout     LayoutConfig
+		wantFailed bool
+		wantOutput string
+	}{
+		{name: "built-in card"},
+		{name: "cardsV2 with label table", layout: LayoutConfig{CardsV2: true, LabelColumns: []string{"severity", "*"}}},
+		{name: "valid templates", templates: TemplatesConfig{Title: "{{ .Status }}", Text: "{{ len .Alerts }} alert(s)"}},
+		{
+			name:       "failing text template",
+			templates:  TemplatesConfig{Text: "{{ .Missing.Field }}"},
+			wantFailed: true,
+			wantOutput: "text template:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates, err := NewMessageTemplates(tt.templates)
+			if err != nil {
+				t.Fatalf("NewMessageTemplates() error = %v", err)
+			}
+			rt := &Runtime{
+				Config:       Config{Layout: tt.layout},
+				Templates:    templates,
+				Routes:       []*Route{{Name: "ops", Tickets: []TicketProvider{jira}}},
+				DefaultRoute: &Route{Name: defaultRouteName},
+			}
+			currentRuntime.Store(rt)
+			defer currentRuntime.Store(nil)
+
+			var out bytes.Buffer
+			failed := lintTemplates(&out, rt, fixtures, "", false)
+			if (failed > 0) != tt.wantFailed {
+				t.Fatalf("lintTemplates() failed = %d, want failures %v\n%s", failed, tt.wantFailed, out.String())
+			}
+			if tt.wantOutput != "" && !strings.Contains(out.String(), tt.wantOutput) {
+				t.Errorf("output does not contain %q:\n%s", tt.wantOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestValidateChatMessage(t *testing.T) {
+	link := &OnClickAction{OpenLink: &OpenLink{URL: "https://example.com"}}
+	column := Column{Widgets: []WidgetV2{{TextParagraph: &TextParagraph{Text: "x"}}}}
+
+	tests := []struct {
+		name    string
+		message *GoogleChatMessage
+		wantErr string
+	}{
+		{name: "text", message: &GoogleChatMessage{Text: "hello"}},
+		{
+			name: "card",
+			message: &GoogleChatMessage{Cards: []Card{{
+				Header:   &CardHeader{Title: "Alert"},
+				Sections: []CardSection{{Widgets: []Widget{{Buttons: []Button{{TextButton: &TextButton{Text: "Open", OnClick: link}}}}}}},
+			}}},
+		},
+		{name: "empty message", message: &GoogleChatMessage{}, wantErr: "payload: must have at least 1 entr(ies)"},
+		{
+			name:    "card without sections",
+			message: &GoogleChatMessage{Cards: []Card{{Header: &CardHeader{Title: "Alert"}}}},
+			wantErr: "cards[0].sections: expected array, got null",
+		},
+		{
+			name:    "empty header title",
+			message: &GoogleChatMessage{Cards: []Card{{Header: &CardHeader{}, Sections: []CardSection{{Widgets: []Widget{{TextParagraph: &TextParagraph{Text: "x"}}}}}}}},
+			wantErr: "cards[0].header.title: must be at least 1 characters",
+		},
+		{
+			name: "too many columns",
+			message: &GoogleChatMessage{CardsV2: []CardV2{{CardID: "alert", Card: CardV2Body{Sections: []CardV2Section{{
+				Widgets: []WidgetV2{{Columns: &Columns{ColumnItems: []Column{column, column, column}}}},
+			}}}}}},
+			wantErr: "cardsV2[0].card.sections[0].widgets[0].columns.columnItems: must contain at most 2 item(s)",
+		},
+		{
+			name: "button without link",
+			message: &GoogleChatMessage{CardsV2: []CardV2{{CardID: "alert", Card: CardV2Body{Sections: []CardV2Section{{
+				Widgets: []WidgetV2{{ButtonList: &ButtonList{Buttons: []ButtonV2{{Text: "Open"}}}}},
+			}}}}}},
+			wantErr: "cardsV2[0].card.sections[0].widgets[0].buttonList.buttons[0].onClick: expected object, got null",
+		},
+		{name: "text too long", message: &GoogleChatMessage{Text: strings.Repeat("x", 4097)}, wantErr: "text: must be at most 4096 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateChatMessage(tt.message)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateChatMessage() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateChatMessage() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckGolden(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "firing.default.json")
+	output := &LintOutput{Message: &GoogleChatMessage{Text: "<b>firing</b>"}}
+
+	if problems := checkGolden(file, output, false); len(problems) != 1 || !strings.Contains(problems[0], "does not exist") {
+		t.Fatalf("checkGolden() before update = %v, want a missing file", problems)
+	}
+	if problems := checkGolden(file, output, true); len(problems) != 0 {
+		t.Fatalf("checkGolden(update) = %v", problems)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"text": "<b>firing</b>"`) {
+		t.Errorf("golden file = %s, want unescaped indented JSON", data)
+	}
+	if problems := checkGolden(file, output, false); len(problems) != 0 {
+		t.Fatalf("checkGolden() after update = %v", problems)
+	}
+
+	output.Message.Text = "<b>resolved</b>"
+	problems := checkGolden(file, output, false)
+	if len(problems) == 0 || !strings.Contains(problems[0], "at line 3") {
+		t.Fatalf("checkGolden() after change = %v, want a difference at line 3", problems)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "time"
+
+// logRepeat counts the repeats of a message within the repeat window.
+type logRepeat struct {
+	count int
+}
+
+// ErrorRepeated logs like Error, but once a message with key has been
+// logged, further ones within the repeat window are only counted. When the
+// window ends, one line reports how often the message repeated. key names
+// the message without what changes between repeats, such as request IDs.
+func (l *Logger) ErrorRepeated(key, format string, v ...interface{}) {
+	l.repeated(LogLevelError, l.Error, key, format, v...)
+}
+
+// InfoRepeated is ErrorRepeated at info level.
+func (l *Logger) InfoRepeated(key, format string, v ...interface{}) {
+	l.repeated(LogLevelInfo, l.Info, key, format, v...)
+}
+
+func (l *Logger) repeated(level string, log func(string, ...interface{}), key, format string, v ...interface{}) {
+	if l.repeatWindow <= 0 {
+		log(format, v...)
+		return
+	}
+
+	l.repeatMu.Lock()
+	if r, ok := l.repeats[level+"\x00"+key]; ok {
+		r.count++
+		l.repeatMu.Unlock()
+		logRepeatsSuppressed.WithLabelValues(level).Inc()
+		return
+	}
+	if l.repeats == nil {
+		l.repeats = map[string]*logRepeat{}
+	}
+	r := &logRepeat{}
+	l.repeats[level+"\x00"+key] = r
+	window := l.repeatWindow
+	l.repeatMu.Unlock()
+
+	log(format, v...)
+	time.AfterFunc(window, func() {
+		l.repeatMu.Lock()
+		delete(l.repeats, level+"\x00"+key)
+		count := r.count
+		l.repeatMu.Unlock()
+		if count > 0 {
+			log("Previous message repeated %d times in %s: %s", count, formatDuration(window), key)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLoggerRepeated(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	l := NewLogger(LogLevelInfo, out)
+	l.repeatWindow = 50 * time.Millisecond
+
+	var before dto.Metric
+	if err := logRepeatsSuppressed.WithLabelValues(LogLevelError).Write(&before); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		l.ErrorRepeated("send failed: 503", "[req-%d] send failed: 503", i)
+	}
+	l.ErrorRepeated("send failed: 404", "[req-5] send failed: 404")
+	time.Sleep(150 * time.Millisecond)
+	l.ErrorRepeated("send failed: 503", "[req-6] send failed: 503")
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		_, msg, _ := strings.Cut(line, "[ERROR] ")
+		lines = append(lines, msg)
+	}
+	want := []string{
+		"[req-1] send failed: 503",
+		"[req-5] send failed: 404",
+		"Previous message repeated 3 times in <1m: send failed: 503",
+		"[req-6] send failed: 503",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("log = %q, want %q", lines, want)
+	}
+
+	var after dto.Metric
+	if err := logRepeatsSuppressed.WithLabelValues(LogLevelError).Write(&after); err != nil {
+		t.Fatal(err)
+	}
+	if got := after.GetCounter().GetValue() - before.GetCounter().GetValue(); got != 3 {
+		t.Errorf("suppressed counter increased by %v, want 3", got)
+	}
+}
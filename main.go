@@ -2,23 +2,29 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
-
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
 	configPath     = flag.String("config", "config.toml", "Path to configuration file")
+	configDir      = flag.String("config.dir", "", "Directory of *.toml files merged into the configuration")
 	defaultTimeout = 10 * time.Second
 	config         Config
 )
@@ -32,6 +38,14 @@ const (
 type Logger struct {
 	*log.Logger
 	level string
+	// repeatWindow is how long repeats of a message logged with
+	// ErrorRepeated or InfoRepeated are collapsed; zero logs every one.
+	repeatWindow time.Duration
+	repeatMu     sync.Mutex
+	repeats      map[string]*logRepeat
+	// otlp, when set, also receives every line logged at the enabled
+	// levels.
+	otlp *otlpLogger
 }
 
 func NewLogger(level string, output *os.File) *Logger {
@@ -44,44 +58,82 @@ func NewLogger(level string, output *os.File) *Logger {
 func (l *Logger) Debug(format string, v ...interface{}) {
 	if l.level == LogLevelDebug {
 		l.Printf("[DEBUG] "+format, v...)
+		l.export(LogLevelDebug, format, v...)
 	}
 }
 
 func (l *Logger) Info(format string, v ...interface{}) {
 	if l.level == LogLevelDebug || l.level == LogLevelInfo {
 		l.Printf("[INFO] "+format, v...)
+		l.export(LogLevelInfo, format, v...)
 	}
 }
 
 func (l *Logger) Error(format string, v ...interface{}) {
 	l.Printf("[ERROR] "+format, v...)
+	l.export(LogLevelError, format, v...)
+}
+
+func (l *Logger) export(level, format string, v ...interface{}) {
+	if l.otlp != nil {
+		l.otlp.AddLog(level, fmt.Sprintf(format, v...), clock.Now())
+	}
 }
 
 var logger *Logger
 
 type AlertManagerPayload struct {
-	Receiver          string            `json:"receiver"`
-	Status            string            `json:"status"`
-	Alerts            []Alert           `json:"alerts"`
-	GroupLabels       map[string]string `json:"groupLabels"`
-	CommonLabels      map[string]string `json:"commonLabels"`
-	CommonAnnotations map[string]string `json:"commonAnnotations"`
-	ExternalURL       string            `json:"externalURL"`
+	Version           string `json:"version,omitempty"`
+	GroupKey          string `json:"groupKey,omitempty"`
+	TruncatedAlerts   int    `json:"truncatedAlerts,omitempty"`
+	Receiver          string `json:"receiver"`
+	Status            string `json:"status"`
+	Alerts            Alerts `json:"alerts"`
+	GroupLabels       KV     `json:"groupLabels"`
+	CommonLabels      KV     `json:"commonLabels"`
+	CommonAnnotations KV     `json:"commonAnnotations"`
+	ExternalURL       string `json:"externalURL"`
+	// Route, when set, names the route the payload is sent to instead of
+	// the first one matching it.
+	Route string `json:"-"`
+	// Sources, when above one, is how many notifications carried the
+	// alerts within the coalescing window.
+	Sources int `json:"-"`
+	// AllowedRoutes, when set, limits routing to the named routes, those
+	// the source that posted the payload may target.
+	AllowedRoutes []string `json:"-"`
+	// Update, on group update messages, is how the group changed since it
+	// was last notified.
+	Update *GroupDelta `json:"update,omitempty"`
 }
 
 type Alert struct {
-	Status       string            `json:"status"`
-	Labels       map[string]string `json:"labels"`
-	Annotations  map[string]string `json:"annotations"`
-	StartsAt     time.Time         `json:"startsAt"`
-	EndsAt       time.Time         `json:"endsAt"`
-	GeneratorURL string            `json:"generatorURL"`
-	Fingerprint  string            `json:"fingerprint"`
+	Status       string    `json:"status"`
+	Labels       KV        `json:"labels"`
+	Annotations  KV        `json:"annotations"`
+	StartsAt     time.Time `json:"startsAt"`
+	EndsAt       time.Time `json:"endsAt"`
+	GeneratorURL string    `json:"generatorURL"`
+	Fingerprint  string    `json:"fingerprint"`
 }
 
 type GoogleChatMessage struct {
 	Text  string `json:"text,omitempty"`
 	Cards []Card `json:"cards,omitempty"`
+	// CardsV2 replaces Cards when [layout] cards_v2 is set.
+	CardsV2 []CardV2 `json:"cardsV2,omitempty"`
+	// ThreadKey posts the message into the thread with this key. It is sent
+	// as a webhook URL parameter rather than in the body.
+	ThreadKey string `json:"-"`
+	// AlertKeys identifies the alerts in the message, so reactions to it can
+	// be traced back to them.
+	AlertKeys []string `json:"-"`
+	// GroupKey is the alert group the message was rendered for, so the
+	// message created for it can be looked up later.
+	GroupKey string `json:"-"`
+	// Uncounted marks the messages of a notification's further routes, whose
+	// alerts are already counted as sent or dropped for its first route.
+	Uncounted bool `json:"-"`
 }
 
 type Card struct {
@@ -97,12 +149,20 @@ type CardHeader struct {
 type CardSection struct {
 	Header  string   `json:"header,omitempty"`
 	Widgets []Widget `json:"widgets"`
+	// Collapsible sections show only their first UncollapsibleWidgetsCount
+	// widgets until expanded. Legacy cards ignore both fields.
+	Collapsible               bool `json:"-"`
+	UncollapsibleWidgetsCount int  `json:"-"`
 }
 
 type Widget struct {
 	TextParagraph *TextParagraph `json:"textParagraph,omitempty"`
 	KeyValue      *KeyValue      `json:"keyValue,omitempty"`
 	Buttons       []Button       `json:"buttons,omitempty"`
+	// Table is rendered in place of KeyValue in cardsV2 messages.
+	Table *LabelTable `json:"-"`
+	// Chips are only rendered in cardsV2 messages.
+	Chips *ChipList `json:"-"`
 }
 
 type TextParagraph struct {
@@ -137,6 +197,15 @@ type OpenLink struct {
 func main() {
 	flag.Parse()
 
+	// import writes a new configuration, so it runs before one is loaded.
+	// ctl talks to a running bridge and needs no configuration.
+	switch flag.Arg(0) {
+	case "import":
+		os.Exit(runImport(flag.Args()[1:]))
+	case "ctl":
+		os.Exit(runCtl(flag.Args()[1:], os.Stdout))
+	}
+
 	cfg, err := LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -145,28 +214,107 @@ func main() {
 
 	setupLogger()
 
+	if err := registerMetrics(metricsRegisterer); err != nil {
+		logger.Error("Failed to register metrics: %v", err)
+		os.Exit(1)
+	}
+
+	rt, err := NewRuntime(config)
+	if err != nil {
+		logger.Error("Failed to initialize: %v", err)
+		os.Exit(1)
+	}
+	currentRuntime.Store(rt)
+
+	switch flag.Arg(0) {
+	case "replay":
+		os.Exit(runReplay(flag.Args()[1:]))
+	case "lint-templates":
+		os.Exit(runLintTemplates(flag.Args()[1:]))
+	}
+
 	if err := config.Validate(); err != nil {
 		logger.Error("Configuration validation failed: %v", err)
 		os.Exit(1)
 	}
 
-	provider := &GoogleChatProvider{WebhookURL: config.GoogleChat.WebhookURL}
+	if config.Recording.Enabled {
+		recorder, err = NewRecorder(config.Recording.Dir)
+		if err != nil {
+			logger.Error("Failed to initialize recorder: %v", err)
+			os.Exit(1)
+		}
+		logger.Info("Recording webhook payloads to %s", config.Recording.Dir)
+	}
 
-	server := &http.Server{
-		Addr:         config.Server.ListenAddr,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	if config.State.Dir != "" {
+		acks, err = LoadAckStore(filepath.Join(config.State.Dir, "acks.json"))
+		if err != nil {
+			logger.Error("Failed to load acknowledgments: %v", err)
+			os.Exit(1)
+		}
+		incidents, err = LoadIncidentStore(filepath.Join(config.State.Dir, "incidents.json"))
+		if err != nil {
+			logger.Error("Failed to load incident spaces: %v", err)
+			os.Exit(1)
+		}
+		tickets, err = LoadTicketStore(filepath.Join(config.State.Dir, "tickets.json"))
+		if err != nil {
+			logger.Error("Failed to load tickets: %v", err)
+			os.Exit(1)
+		}
+		postedMessages, err = loadPostedMessageIndex(filepath.Join(config.State.Dir, "messages.json"), config.State.MessageTTL)
+		if err != nil {
+			logger.Error("Failed to load posted messages: %v", err)
+			os.Exit(1)
+		}
+		notifiedGroups, err = LoadGroupStore(filepath.Join(config.State.Dir, "groups.json"))
+		if err != nil {
+			logger.Error("Failed to load notified alert groups: %v", err)
+			os.Exit(1)
+		}
+		routePauses, err = LoadPauseStore(filepath.Join(config.State.Dir, "pauses.json"))
+		if err != nil {
+			logger.Error("Failed to load paused routes: %v", err)
+			os.Exit(1)
+		}
+		history, err = LoadHistory(filepath.Join(config.State.Dir, "history.jsonl"), clock.Now(), config.State.HistoryMaxAge)
+		if err != nil {
+			logger.Error("Failed to load delivery history: %v", err)
+			os.Exit(1)
+		}
+		outbox, err = LoadOutbox(filepath.Join(config.State.Dir, "outbox"))
+		if err != nil {
+			logger.Error("Failed to load outbox: %v", err)
+			os.Exit(1)
+		}
+		if n := outbox.Len(); n > 0 {
+			logger.Info("Resuming delivery of %d queued message(s)", n)
+		}
+		logger.Info("Keeping state in %s", config.State.Dir)
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
-		handleWebhookWithProvider(w, r, provider)
-	})
-	mux.HandleFunc("/health", healthCheckHandler)
-	mux.Handle("/metrics", promhttp.Handler())
+	shutdownTracing, err := setupTracing(config.Tracing)
+	if err != nil {
+		logger.Error("Failed to initialize tracing: %v", err)
+		os.Exit(1)
+	}
+	if config.Tracing.Enabled {
+		logger.Info("Exporting traces to %s", tracingEndpoint(config.Tracing))
+	}
+	shutdownOTLP, err := setupOTLP(config.OTLP, config.Tracing.ServiceName, metricsGatherer)
+	if err != nil {
+		logger.Error("Failed to initialize OTLP export: %v", err)
+		os.Exit(1)
+	}
+	if config.OTLP.Metrics || config.OTLP.Logs {
+		logger.Info("Exporting %s to %s", otlpSignals(config.OTLP), otlpEndpoint(config.OTLP))
+	}
+
+	provider := reloadableProvider{}
 
-	server.Handler = mux
+	publicMux, adminMux := newServeMuxes(config, provider)
+	server := newHTTPServer(config.Server, config.Server.ListenAddr, publicMux, serverWriteTimeout)
 
 	go func() {
 		logger.Info("Starting AlertManager to Google Chat webhook server on %s", config.Server.ListenAddr)
@@ -175,11 +323,76 @@ func main() {
 		}
 	}()
 
+	var adminServer *http.Server
+	if adminMux != nil {
+		adminServer = newHTTPServer(config.Server, config.Server.AdminListenAddr, adminMux, 60*time.Second)
+		go func() {
+			logger.Info("Starting admin server on %s", config.Server.AdminListenAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Admin server error: %v", err)
+			}
+		}()
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			logger.Info("Received SIGHUP, reloading configuration from %s", *configPath)
+			reload, err := reloadConfig(*configPath)
+			if err != nil {
+				logger.Error("Configuration reload failed, keeping previous configuration: %v", err)
+				continue
+			}
+			if reload.Applied {
+				logger.Info("Configuration reloaded")
+			}
+		}
+	}()
+
+	checkChatCredentials(getRuntime())
+	stop := make(chan struct{})
+	for _, job := range getRuntime().Jobs {
+		if job.Schedule != nil {
+			logger.Info("Job %s scheduled %s", job.Name, job.Schedule)
+		}
+	}
+	// background tracks the loops that run jobs and deliveries, so
+	// shutdown can let them finish.
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		runScheduler(time.Second, stop)
+	}()
+	if config.Kubernetes.Enabled {
+		controller, err := NewChatRouteController(config.Kubernetes)
+		if err != nil {
+			logger.Error("Failed to start Kubernetes mode: %v", err)
+			os.Exit(1)
+		}
+		chatRoutes = controller
+		go chatRoutes.Run(stop)
+		logger.Info("Watching ChatRoute resources")
+	}
+	go func() {
+		defer background.Done()
+		runOutboxDispatcher(provider, time.Second, stop)
+	}()
+	if config.Reload.Watch {
+		if err := watchConfig(*configPath, config.Reload.Debounce, stop); err != nil {
+			logger.Error("Failed to watch configuration: %v", err)
+		} else {
+			logger.Info("Watching %s for changes", *configPath)
+		}
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	logger.Info("Shutting down server...")
+	close(stop)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -187,10 +400,169 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Server forced to shutdown: %v", err)
 	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logger.Error("Admin server forced to shutdown: %v", err)
+		}
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		background.Wait()
+		escalating.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		logger.Error("Timed out waiting for running jobs and deliveries to finish")
+	}
+	if err := postedMessages.Save(); err != nil {
+		logger.Error("Error saving posted messages: %v", err)
+	}
+	if err := notifiedGroups.Save(); err != nil {
+		logger.Error("Error saving alert group state: %v", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Failed to flush traces: %v", err)
+	}
+	if err := shutdownOTLP(ctx); err != nil {
+		logger.Printf("[ERROR] Failed to flush OTLP metrics and logs: %v", err)
+	}
 
 	logger.Info("Server exited")
 }
 
+// route is a single HTTP endpoint served by the bridge. Every route must be
+// documented in api/openapi.json. Admin routes move to the admin listener
+// when one is configured.
+type route struct {
+	path    string
+	handler http.Handler
+	admin   bool
+}
+
+func routes(provider Provider) []route {
+	return []route{
+		{path: "/webhook", handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleWebhookWithProvider(w, r, provider)
+		})},
+		{path: "/webhook/batch", handler: batchWebhookHandler(provider)},
+		{path: routeWebhookPath, handler: routeWebhookHandler(provider)},
+		{path: "/api/v1/notify", handler: notifyHandler(provider)},
+		{path: "/chat/events", handler: http.HandlerFunc(chatEventsHandler)},
+		{path: "/health", handler: http.HandlerFunc(healthCheckHandler)},
+		{path: "/metrics", handler: metricsHandler(), admin: true},
+		{path: "/api/openapi.json", handler: http.HandlerFunc(openAPIHandler), admin: true},
+		{path: "/api/alerts", handler: http.HandlerFunc(firingAlertsHandler), admin: true},
+		{path: "/api/summary", handler: summaryHandler(provider), admin: true},
+		{path: "/api/v1/ack", handler: http.HandlerFunc(ackHandler), admin: true},
+		{path: "/api/v1/report", handler: http.HandlerFunc(reportHandler), admin: true},
+		{path: "/api/v1/stats/noisiest", handler: noisiestHandler(provider), admin: true},
+		{path: "/api/v1/wallboard", handler: http.HandlerFunc(wallboardHandler), admin: true},
+		{path: "/api/v1/deliveries/", handler: http.HandlerFunc(deliveriesHandler), admin: true},
+		{path: "/api/v1/history", handler: http.HandlerFunc(historyHandler), admin: true},
+		{path: "/api/v1/routes/test", handler: http.HandlerFunc(routeTestHandler), admin: true},
+		{path: "/api/v1/routing/coverage", handler: http.HandlerFunc(routingCoverageHandler), admin: true},
+		{path: "/api/v1/jobs/", handler: http.HandlerFunc(jobsHandler), admin: true},
+		{path: "/api/v1/pauses/", handler: http.HandlerFunc(pausesHandler), admin: true},
+		{path: "/api/v1/config/reload", handler: configReloadHandler(*configPath), admin: true},
+		{path: "/api/v1/config/pending", handler: http.HandlerFunc(pendingConfigHandler), admin: true},
+		{path: "/api/v1/chatroutes", handler: http.HandlerFunc(chatRoutesHandler), admin: true},
+		{path: "/details/", handler: http.HandlerFunc(detailsHandler), admin: true},
+		{path: "/api/v1/monitoring/rules", handler: http.HandlerFunc(monitoringRulesHandler), admin: true},
+		{path: "/api/v1/monitoring/dashboard", handler: http.HandlerFunc(monitoringDashboardHandler), admin: true},
+		{path: "/debug/pprof/", handler: http.HandlerFunc(pprof.Index), admin: true},
+		{path: "/debug/pprof/cmdline", handler: http.HandlerFunc(pprof.Cmdline), admin: true},
+		{path: "/debug/pprof/profile", handler: http.HandlerFunc(pprof.Profile), admin: true},
+		{path: "/debug/pprof/symbol", handler: http.HandlerFunc(pprof.Symbol), admin: true},
+		{path: "/debug/pprof/trace", handler: http.HandlerFunc(pprof.Trace), admin: true},
+	}
+}
+
+// newServeMuxes builds the public mux and, when an admin listen address is
+// configured, a separate admin mux carrying the admin routes. Admin routes
+// require basic auth when credentials are configured.
+// Both muxes serve their routes under the configured URL prefix. Each
+// inbound source gets its own webhook endpoint requiring its credentials.
+func newServeMuxes(cfg Config, provider Provider) (*http.ServeMux, *http.ServeMux) {
+	public := http.NewServeMux()
+	var admin *http.ServeMux
+	if cfg.Server.AdminListenAddr != "" {
+		admin = http.NewServeMux()
+	}
+
+	prefix := cfg.Server.pathPrefix()
+	for _, rt := range routes(provider) {
+		path := prefix + rt.path
+		handler := rt.handler
+		if prefix != "" {
+			// Handlers such as pprof dispatch on the unprefixed path.
+			handler = http.StripPrefix(prefix, handler)
+		}
+		if strings.HasPrefix(rt.path, "/api/") {
+			handler = withCORS(cfg.CORS, handler)
+		}
+		pprofRoute := strings.HasPrefix(rt.path, "/debug/pprof/")
+		if !pprofRoute {
+			// Profiles run for as long as the client asks.
+			handler = withRequestTimeout(cfg.Server.RequestTimeout, handler)
+		}
+		// Body limits wrap the signature check, which reads the body too.
+		maxBody := cfg.Server.MaxBodyBytes
+		switch rt.path {
+		case "/webhook":
+			handler = withTracing("webhook", withWebhookAuth(cfg.Server.WebhookAuth, withMaxBody(maxBody, withSignature(cfg.Server.WebhookSignature, withPings(cfg.Server.Pings, handler)))))
+		case "/webhook/batch":
+			handler = withTracing("webhook batch", withWebhookAuth(cfg.Server.WebhookAuth, withMaxBody(maxBody, withSignature(cfg.Server.WebhookSignature, handler))))
+		case routeWebhookPath:
+			handler = withTracing("webhook route", withWebhookAuth(cfg.Server.WebhookAuth, withMaxBody(maxBody, withSignature(cfg.Server.WebhookSignature, withPings(cfg.Server.Pings, handler)))))
+		case "/api/v1/notify":
+			handler = withTracing("notify", withMaxBody(maxBody, handler))
+		}
+		if !rt.admin {
+			public.Handle(path, handler)
+			continue
+		}
+
+		handler = withBasicAuth(cfg.Server.AdminAuth, handler)
+		if admin != nil {
+			admin.Handle(path, handler)
+		}
+		if (admin == nil && !pprofRoute) || (rt.path == "/details/" && cfg.Server.PublicDetails) {
+			public.Handle(path, handler)
+		}
+	}
+
+	for _, src := range cfg.Sources {
+		public.Handle(prefix+src.webhookPath(), withTracing("webhook "+src.Name, withSourceAuth(src, withMaxBody(cfg.Server.MaxBodyBytes, withPings(src.Pings, withRequestTimeout(cfg.Server.RequestTimeout, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleWebhook(w, r.WithContext(withSource(r.Context(), src)), provider, src.Format)
+		})))))))
+	}
+
+	return public, admin
+}
+
+// newHTTPServer returns a server for addr with the connection settings of
+// cfg.
+func newHTTPServer(cfg ServerConfig, addr string, handler http.Handler, writeTimeout time.Duration) *http.Server {
+	server := &http.Server{
+		Addr:           addr,
+		Handler:        withTrustedProxies(cfg.TrustedProxies, handler),
+		ReadTimeout:    30 * time.Second,
+		WriteTimeout:   writeTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+		HTTP2:          &http.HTTP2Config{MaxConcurrentStreams: cfg.MaxConcurrentStreams},
+	}
+	if cfg.H2C {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return server
+}
+
 func setupLogger() {
 	output := os.Stdout
 
@@ -200,6 +572,7 @@ func setupLogger() {
 	}
 
 	logger = NewLogger(level, output)
+	logger.repeatWindow = config.Logging.RepeatWindow
 	logger.Info("Logger initialized with level: %s", level)
 }
 
@@ -208,17 +581,32 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 
 	response := map[string]interface{}{
-		"status":    "healthy",
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-		"version":   "1.0.0",
+		"status":       "healthy",
+		"timestamp":    clock.Now().UTC().Format(time.RFC3339),
+		"version":      "1.0.0",
+		"destinations": destinationHealth.Snapshot(),
+	}
+	if chat := getRuntime().Chat; chat != nil {
+		credentials := chat.CredentialHealth()
+		response["chatCredentials"] = credentials
+		if !credentials.Valid {
+			response["status"] = "degraded"
+		}
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
 func handleWebhookWithProvider(w http.ResponseWriter, r *http.Request, provider Provider) {
-	reqID := fmt.Sprintf("req-%d", time.Now().UnixNano())
+	handleWebhook(w, r, provider, formatAuto)
+}
+
+// handleWebhook processes a webhook request whose body is in format, or in
+// any known format when format is "auto".
+func handleWebhook(w http.ResponseWriter, r *http.Request, provider Provider, format string) {
+	reqID := newRequestID("req")
 	logger.Info("[%s] Received webhook request from %s", reqID, r.RemoteAddr)
+	w.Header().Set("X-Request-Id", reqID)
 
 	if r.Method != http.MethodPost {
 		logger.Error("[%s] Method not allowed: %s", reqID, r.Method)
@@ -229,6 +617,7 @@ func handleWebhookWithProvider(w http.ResponseWriter, r *http.Request, provider
 	// Validation of content type
 	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
 		logger.Error("[%s] Invalid content type: %s", reqID, r.Header.Get("Content-Type"))
+		dropAlerts(dropBadContentType, 1)
 		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
 		return
 	}
@@ -236,32 +625,169 @@ func handleWebhookWithProvider(w http.ResponseWriter, r *http.Request, provider
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error("[%s] Error reading request body: %v", reqID, err)
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		status, msg := bodyReadError(err)
+		http.Error(w, msg, status)
 		return
 	}
 	defer r.Body.Close()
 
 	if len(body) == 0 {
 		logger.Error("[%s] Empty request body", reqID)
+		dropAlerts(dropParseError, 1)
 		http.Error(w, "Empty request body", http.StatusBadRequest)
 		return
 	}
 
-	logger.Debug("[%s] Received webhook body: %s", reqID, string(body))
+	redactor := getRuntime().Redactor
+	logger.Debug("[%s] Received webhook body: %s", reqID, redactor.RedactText(string(body)))
 
-	var alertPayload AlertManagerPayload
-	if err := json.Unmarshal(body, &alertPayload); err != nil {
-		logger.Error("[%s] Error parsing AlertManager payload: %v", reqID, err)
-		http.Error(w, "Error parsing AlertManager payload", http.StatusBadRequest)
+	if recorder != nil {
+		if err := recorder.Record(reqID, []byte(redactor.RedactText(string(body)))); err != nil {
+			logger.Error("[%s] Error recording webhook body: %v", reqID, err)
+		}
+	}
+
+	key := idempotencyKey(r, body)
+	body, format, err = normalizePayload(r, body, format)
+	if err != nil {
+		logger.Error("[%s] %v", reqID, err)
+		dropAlerts(dropParseError, 1)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	webhookFormats.WithLabelValues(format).Inc()
+	if format != formatAlertManager {
+		logger.Info("[%s] Converted %s payload", reqID, format)
+	}
 
-	// Validate payload
-	if err := validateAlertPayload(&alertPayload); err != nil {
-		logger.Error("[%s] Invalid alert payload: %v", reqID, err)
-		http.Error(w, "Invalid alert payload", http.StatusBadRequest)
+	duplicate, err := processOnce(r.Context(), key, body, reqID, provider)
+	status, msg := processResult(reqID, duplicate, err)
+	if status != http.StatusOK {
+		http.Error(w, msg, status)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, msg)
+}
+
+// processResult logs the outcome of processOnce and returns the HTTP status
+// and message reported to the client.
+func processResult(reqID string, duplicate bool, err error) (int, string) {
+	if duplicate {
+		logger.Info("[%s] Duplicate notification ignored", reqID)
+		webhooksDeduplicated.Inc()
+		return http.StatusOK, "Duplicate notification ignored"
+	}
+	if err != nil {
+		var perr *pipelineError
+		if errors.As(err, &perr) {
+			logger.ErrorRepeated(perr.msg+": "+errorText(perr.err), "[%s] %s: %v", reqID, perr.msg, perr.err)
+			msg := perr.msg
+			var schemaErrs SchemaErrors
+			if errors.As(perr.err, &schemaErrs) {
+				msg += ": " + schemaErrs.Error()
+			}
+			return perr.status, msg
+		}
+		logger.Error("[%s] Error processing alert: %v", reqID, err)
+		return http.StatusInternalServerError, "Error processing alert"
+	}
+
+	logger.Info("[%s] Alert processed successfully", reqID)
+	return http.StatusOK, "Alert processed successfully"
+}
+
+// processOnce runs processPayload, skipping payloads already processed
+// under the same idempotency key within the configured window.
+func processOnce(ctx context.Context, key string, body []byte, reqID string, provider Provider) (bool, error) {
+	ctx = withRequestKey(ctx, key)
+	window := getRuntime().Config.Idempotency.Window
+	if window <= 0 {
+		return false, processPayload(ctx, body, reqID, provider)
+	}
+	return idempotency.Do(key, window, func() error {
+		return processPayload(ctx, body, reqID, provider)
+	})
+}
+
+// withDeadline bounds ctx by timeout, when positive.
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// pipelineError carries the HTTP status and client-facing message for a
+// failure in processPayload.
+type pipelineError struct {
+	status int
+	msg    string
+	err    error
+}
+
+func (e *pipelineError) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.err)
+}
+
+func (e *pipelineError) Unwrap() error {
+	return e.err
+}
+
+// processPayload parses, validates, converts and delivers a raw AlertManager
+// webhook body. It is shared by the HTTP handler and the replay command.
+// Enrichment lookups and delivery get their own deadlines, derived from ctx,
+// so a slow lookup cannot use up the time left for delivery.
+func processPayload(ctx context.Context, body []byte, reqID string, provider Provider) (err error) {
+	start := clock.Now()
+	routeName := ""
+	sent := false
+	defer func() {
+		status := statusDropped
+		switch {
+		case err != nil:
+			status = statusError
+		case sent:
+			status = statusSuccess
+		}
+		alertProcessingDuration.WithLabelValues(phaseTotal, routeName, status).Observe(clock.Since(start).Seconds())
+	}()
+
+	var alertPayload AlertManagerPayload
+	declared := declaredPayloadVersion(body)
+	version, known := resolvePayloadVersion(declared)
+	if known {
+		payloadVersionsReceived.WithLabelValues(version).Inc()
+	} else {
+		logger.Info("[%s] Warning: unknown payload version %q, reading it as version %s", reqID, declared, version)
+		payloadVersionsReceived.WithLabelValues(unknownPayloadVersion).Inc()
+	}
+	err = validateAlertPayload(body)
+	if err != nil {
+		reason := dropValidationFailed
+		if errors.Is(err, errInvalidJSON) {
+			reason = dropParseError
+		}
+		dropAlerts(reason, 1)
+		err = &pipelineError{http.StatusBadRequest, "Invalid alert payload", err}
+	} else if uerr := payloadVersions[version].parse(body, &alertPayload); uerr != nil {
+		dropAlerts(dropParseError, 1)
+		err = &pipelineError{http.StatusBadRequest, "Error parsing AlertManager payload", uerr}
+	}
+	observePhase(phaseParse, "", start, err)
+	if err != nil {
+		return err
+	}
+	alertPayload.Route = forcedRoute(ctx)
+	alertsReceived.WithLabelValues(alertPayload.Status).Add(float64(len(alertPayload.Alerts)))
+	if src, ok := sourceFrom(ctx); ok {
+		if len(src.Receivers) > 0 && !slices.Contains(src.Receivers, alertPayload.Receiver) {
+			dropAlerts(dropForbidden, len(alertPayload.Alerts))
+			return &pipelineError{http.StatusForbidden, "Receiver not allowed for this source", fmt.Errorf("source %s may not post for receiver %q", src.Name, alertPayload.Receiver)}
+		}
+		alertPayload.AllowedRoutes = src.Routes
+	}
+	heartbeat.Seen(clock.Now())
 
 	logger.Info("[%s] Received %d alerts with status: %s, alertname: %s",
 		reqID,
@@ -269,156 +795,449 @@ func handleWebhookWithProvider(w http.ResponseWriter, r *http.Request, provider
 		alertPayload.Status,
 		getAlertName(&alertPayload))
 
-	alertsReceived.WithLabelValues(alertPayload.Status).Inc()
+	// Labels that differ between HA replicas are dropped before coalescing,
+	// so their copies of an alert are recognised as the same one.
+	rt := getRuntime()
+	rt.Normalizer.Apply(reqID, &alertPayload)
+	coalescer.Coalesce(ctx, reqID, &alertPayload, rt.Config.Coalesce.Window)
+	if len(alertPayload.Alerts) == 0 {
+		logger.Info("[%s] All alerts already received from another source, nothing to send", reqID)
+		return nil
+	}
 
-	chatMessage := convertToGoogleChatFormat(&alertPayload)
+	// Notifications for a group are sent, or queued, in the order they
+	// arrived, however long earlier ones take to deliver.
+	release, lerr := groupOrder.Acquire(ctx, groupOrderKey(&alertPayload))
+	if lerr != nil {
+		return &pipelineError{http.StatusServiceUnavailable, "Timed out behind earlier notifications for the alert group", lerr}
+	}
+	defer release()
 
-	logger.Info("[%s] Sending alert to Google Chat", reqID)
-	if err := provider.Send(chatMessage, reqID); err != nil {
-		logger.Error("[%s] Error sending to Google Chat: %v", reqID, err)
-		http.Error(w, "Error sending to Google Chat", http.StatusInternalServerError)
-		return
+	convertStart := clock.Now()
+	received := len(alertPayload.Alerts)
+	if err := rt.Transform.Apply(reqID, &alertPayload); err != nil {
+		logger.Error("[%s] Transform failed, continuing with the original payload: %v", reqID, err)
+	}
+	dropAlerts(dropTransformed, received-len(alertPayload.Alerts))
+	aggregator.Update(&alertPayload)
+	if len(alertPayload.Alerts) == 0 {
+		logger.Info("[%s] All alerts dropped by transform, nothing to send", reqID)
+		return nil
 	}
 
-	logger.Info("[%s] Alert processed successfully", reqID)
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Alert processed successfully")
-}
+	silences := append(rt.Silences[:len(rt.Silences):len(rt.Silences)], requestedSilences.Active(clock.Now())...)
+	unsilenced := filterSilenced(reqID, alertPayload.Alerts, silences)
+	dropAlerts(dropSilenced, len(alertPayload.Alerts)-len(unsilenced))
+	alertPayload.Alerts = unsilenced
+	if len(alertPayload.Alerts) == 0 {
+		logger.Info("[%s] All alerts silenced, nothing to send", reqID)
+		return nil
+	}
 
-func validateAlertPayload(payload *AlertManagerPayload) error {
-	if payload.Status == "" {
-		return fmt.Errorf("status is required")
+	if filtered(reqID, &alertPayload, rt.Filters) {
+		return nil
 	}
 
-	if len(payload.Alerts) == 0 {
-		return fmt.Errorf("at least one alert is required")
+	if allAcknowledged(&alertPayload, clock.Now()) {
+		logger.Info("[%s] All firing alerts acknowledged, skipping reminder", reqID)
+		dropAlerts(dropAcknowledged, len(alertPayload.Alerts))
+		return nil
+	}
+
+	rt.Redactor.RedactPayload(&alertPayload)
+
+	loud := holdQuietAlerts(reqID, &alertPayload, rt.QuietHours, clock.Now())
+	dropAlerts(dropHeld, len(alertPayload.Alerts)-len(loud))
+	alertPayload.Alerts = loud
+	if len(alertPayload.Alerts) == 0 {
+		logger.Info("[%s] All alerts held for quiet hours, nothing to send", reqID)
+		return nil
+	}
+
+	routes := rt.MatchingRoutes(&alertPayload)
+	if len(routes) == 0 {
+		dropAlerts(dropForbidden, len(alertPayload.Alerts))
+		return &pipelineError{http.StatusForbidden, "No route allowed for this source", fmt.Errorf("alerts match none of routes %v", alertPayload.AllowedRoutes)}
+	}
+	routeName = routes[0].Name
+	// When some routes fail, AlertManager retries the whole notification;
+	// the routes it was already delivered on are skipped.
+	key := requestKey(ctx)
+	var delivered map[string]bool
+	if key != "" && len(routes) > 1 {
+		delivered = deliveredRoutes.Delivered(key)
+	}
+	var succeeded []string
+	// Each alert is counted as sent or dropped once, for the first route
+	// notified, however many routes it continues to.
+	counted := false
+	for i, route := range routes {
+		if delivered[route.Name] {
+			logger.Info("[%s] Already notified route %s in an earlier attempt, skipping it", reqID, route.Name)
+			continue
+		}
+		payload := alertPayload
+		if len(routes) > 1 {
+			// Queued messages are delivered through the route they were
+			// rendered for.
+			payload.Route = route.Name
+		}
+		routeSent, rerr := notifyRoute(ctx, rt, route, payload, i == 0, !counted, reqID, provider, start, convertStart)
+		counted = true
+		sent = sent || routeSent
+		if rerr != nil && err == nil {
+			err = rerr
+		}
+		if rerr == nil {
+			succeeded = append(succeeded, route.Name)
+		}
 	}
+	if key != "" && len(routes) > 1 {
+		if err != nil {
+			deliveredRoutes.Record(key, succeeded)
+		} else if delivered != nil {
+			deliveredRoutes.Forget(key)
+		}
+	}
+	return err
+}
 
-	for i, alert := range payload.Alerts {
-		if alert.Status == "" {
-			return fmt.Errorf("alert %d status is required", i)
+// notifyRoute renders the notification of alertPayload for route and sends
+// or queues it, reporting whether it did. Incidents are only posted for the
+// first route notified, and its alerts only counted as sent or dropped when
+// count is set.
+func notifyRoute(ctx context.Context, rt *Runtime, route *Route, alertPayload AlertManagerPayload, first, count bool, reqID string, provider Provider, start, convertStart time.Time) (bool, error) {
+	drop := func(reason string, n int) {
+		if count {
+			dropAlerts(reason, n)
+		}
+	}
+	due := squelch.Filter(reqID, route, alertPayload.Alerts, clock.Now())
+	drop(dropSquelched, len(alertPayload.Alerts)-len(due))
+	alertPayload.Alerts = due
+	if len(alertPayload.Alerts) == 0 {
+		logger.Info("[%s] All alerts notified too recently on route %s, nothing to send", reqID, route.Name)
+		return false, nil
+	}
+	if holdStormAlerts(ctx, reqID, &alertPayload, route, provider) {
+		logger.Info("[%s] Route %s is in an alert storm, holding %d alert(s) for the summary", reqID, route.Name, len(alertPayload.Alerts))
+		drop(dropHeld, len(alertPayload.Alerts))
+		return false, nil
+	}
+	enrichCtx, cancel := withDeadline(ctx, rt.Config.Deadlines.Enrichment)
+	mention := rt.Enrichments.Apply(enrichCtx, reqID, &alertPayload)
+	cancel()
+	updates := rt.Config.Updates.Enabled && !route.DisableChat
+	var delta *GroupDelta
+	undoGroup := func() {}
+	if updates {
+		delta, undoGroup = notifiedGroups.Advance(route.Name, &alertPayload, rt.Config.Updates.MaxAge, clock.Now())
+	}
+	var chatMessage *GoogleChatMessage
+	if delta != nil {
+		logger.Info("[%s] Alert group changed on route %s (%s), sending an update", reqID, route.Name, delta)
+		chatMessage = renderUpdateMessage(&alertPayload, delta, route.Layout(rt.Config.Layout), route.Sandbox)
+		groupUpdates.WithLabelValues(route.Name).Inc()
+	} else {
+		chatMessage = renderMessage(&alertPayload, route.Layout(rt.Config.Layout), route.Sandbox)
+	}
+	if mention != "" {
+		chatMessage.Text = mention + " " + chatMessage.Text
+	}
+	if base := rt.Config.detailsURL(); base != "" {
+		addDetailsButton(chatMessage, detailsLink(base, reqID))
+	}
+	for _, alert := range alertPayload.Alerts {
+		chatMessage.AlertKeys = append(chatMessage.AlertKeys, alertKey(alert))
+	}
+	if after := rt.Config.SLO.FooterAfter; after > 0 {
+		if delay := notifyLatency.Delay(alertPayload.Alerts, clock.Now()); delay >= after {
+			addNotifyDelayFooter(chatMessage, delay)
+		}
+	}
+	if alertPayload.Sources > 1 {
+		addSourcesNote(chatMessage, alertPayload.Sources)
+	}
+	chatMessage.GroupKey = alertPayload.GroupKey
+	chatMessage.ThreadKey = threadKey(rt.Config.GoogleChat, &alertPayload)
+	chatMessage.Uncounted = !count
+	observePhase(phaseConvert, route.Name, convertStart, nil)
+
+	logger.Info("[%s] Sending alert to Google Chat via route %s", reqID, route.Name)
+	sendStart := clock.Now()
+	sendCtx, cancel := withDeadline(ctx, rt.Config.Deadlines.Send)
+	defer cancel()
+	if first && rt.Incidents.Matches(&alertPayload) {
+		space, opened, ierr := postToIncident(sendCtx, rt.Incidents, &alertPayload, chatMessage, reqID)
+		if ierr != nil {
+			logger.Error("[%s] Error posting to incident space: %v", reqID, ierr)
+		} else if opened {
+			chatMessage.Text += "\nIncident space: " + space.URI
+		}
+	}
+	var err error
+	queued := false
+	paused := routePauses.Paused(route.Name, clock.Now())
+	failure, failureStatus := "Error sending to Google Chat", http.StatusInternalServerError
+	switch {
+	case route.DisableChat:
+		logger.Info("[%s] Chat is disabled for route %s, only filing tickets", reqID, route.Name)
+		drop(dropChatDisabled, len(alertPayload.Alerts))
+	case paused && rt.Config.Pause.Mode != pauseBuffer:
+		logger.Info("[%s] Route %s is paused, dropping the notification", reqID, route.Name)
+		drop(dropPaused, len(alertPayload.Alerts))
+	case rt.Config.Outbox.Enabled:
+		// The dispatcher delivers the message; once it is stored,
+		// AlertManager no longer needs to retry.
+		// Messages held for paused routes have their own limit, so a long
+		// pause cannot fill the outbox for the other routes.
+		waiting, held := outbox.Counts(clock.Now())
+		if max := rt.Config.Pause.MaxMessages; paused && max > 0 && held >= max {
+			logger.Info("[%s] Route %s is paused and %d message(s) are already held, dropping the notification", reqID, route.Name, held)
+			drop(dropPaused, len(alertPayload.Alerts))
+		} else if max := rt.Config.Outbox.MaxMessages; !paused && max > 0 && waiting >= max {
+			drop(dropQueueFull, len(alertPayload.Alerts))
+			err, failure, failureStatus = errOutboxFull, "Outbox is full", http.StatusServiceUnavailable
+		} else if err = outbox.Enqueue(reqID, outboxDestination(route), &alertPayload, chatMessage, start); err != nil {
+			failure = "Error queuing alert for delivery"
+		} else {
+			if paused {
+				logger.Info("[%s] Route %s is paused, holding the alert in the outbox", reqID, route.Name)
+			} else {
+				logger.Info("[%s] Queued alert for delivery via route %s", reqID, route.Name)
+			}
+			queued = true
+		}
+	default:
+		err = route.Send(sendCtx, provider, chatMessage, reqID)
+		if err == nil && count {
+			sentAlerts(alertPayload.Status, len(alertPayload.Alerts))
 		}
-		if len(alert.Labels) == 0 {
-			return fmt.Errorf("alert %d must have at least one label", i)
+		if rateLimited(err) {
+			drop(dropRateLimited, len(alertPayload.Alerts))
 		}
+		if err != nil {
+			escalate(rt.Config.Escalation, rt.Config.Email, newDirectDeliveryFailure(reqID, route.Name, outboxDestination(route), &alertPayload, err, clock.Now()))
+		}
+	}
+	route.Ticket(sendCtx, &alertPayload, reqID)
+	observePhase(phaseSend, route.Name, sendStart, err)
+	if err != nil {
+		undoGroup()
+		return false, &pipelineError{failureStatus, failure, err}
+	}
+	if paused && !queued && !route.DisableChat {
+		undoGroup()
+		return false, nil
 	}
 
-	return nil
+	squelch.Notified(route, alertPayload.Alerts, clock.Now())
+	if !queued && !route.DisableChat {
+		notifyLatency.Delivered(route.Name, alertPayload.Alerts, start, clock.Now(), rt.Config.SLO.NotifyTarget)
+	}
+	if !queued {
+		clearResolvedAcks(reqID, &alertPayload)
+		if herr := history.Record(reqID, route.Name, &alertPayload, clock.Now()); herr != nil {
+			logger.Error("[%s] Error recording delivery history: %v", reqID, herr)
+		}
+	}
+	return true, nil
 }
 
 func convertToGoogleChatFormat(alertPayload *AlertManagerPayload) *GoogleChatMessage {
+	return renderMessage(alertPayload, getRuntime().Config.Layout, nil)
+}
+
+// renderMessage converts the payload to a Chat message using layout. User
+// templates are rendered within the limits of sandbox.
+func renderMessage(alertPayload *AlertManagerPayload, layout LayoutConfig, sandbox *TemplateSandbox) *GoogleChatMessage {
+	if jsonnet := getRuntime().Jsonnet; jsonnet != nil {
+		message, err := jsonnet.Render(alertPayload, sandbox)
+		if err == nil {
+			return message
+		}
+		logger.Error("Error rendering jsonnet template, using built-in card: %v", err)
+	}
+
 	message := &GoogleChatMessage{}
 
 	statusText := strings.ToUpper(alertPayload.Status)
 	alertName := getAlertName(alertPayload)
 	message.Text = fmt.Sprintf("%s Alert: %s (%d alerts)", statusText, alertName, len(alertPayload.Alerts))
+	title := fmt.Sprintf("%s Alert: %s", statusText, alertName)
+	message.Text, title = renderTextTemplates(alertPayload, sandbox, message.Text, title)
 
 	card := Card{
 		Header: &CardHeader{
-			Title:    fmt.Sprintf("%s Alert: %s", statusText, alertName),
+			Title:    title,
 			Subtitle: fmt.Sprintf("%d alert(s)", len(alertPayload.Alerts)),
 		},
 		Sections: []CardSection{},
 	}
 
-	summarySection := createSummarySection(alertPayload)
-	card.Sections = append(card.Sections, summarySection)
-
-	for i, alert := range alertPayload.Alerts {
-		alertSection := createAlertSection(i+1, alert)
-		card.Sections = append(card.Sections, alertSection)
+	layout = layout.withDefaults()
+	for _, section := range layout.Sections {
+		switch section {
+		case SectionSummary:
+			card.Sections = append(card.Sections, createSummarySection(alertPayload, layout))
+		case SectionAlerts:
+			for i, alert := range alertPayload.Alerts {
+				alertSection := createAlertSection(i+1, alert, getRuntime().Config.GoogleChat.LinkAnnotationPrefix, layout)
+				card.Sections = append(card.Sections, alertSection)
+			}
+		case SectionExternalLink:
+			if alertPayload.ExternalURL != "" {
+				card.Sections = append(card.Sections, createExternalURLSection(alertPayload.ExternalURL))
+			}
+		}
 	}
 
-	if alertPayload.ExternalURL != "" {
-		externalSection := createExternalURLSection(alertPayload.ExternalURL)
-		card.Sections = append(card.Sections, externalSection)
+	if layout.usesCardsV2() {
+		message.CardsV2 = append(message.CardsV2, toCardV2("alert", card, accentColor(alertPayload, layout.Colors)))
+	} else {
+		message.Cards = append(message.Cards, card)
 	}
-
-	message.Cards = append(message.Cards, card)
 	return message
 }
 
-func createSummarySection(alertPayload *AlertManagerPayload) CardSection {
+// renderTextTemplates renders the text and title templates for
+// alertPayload within the limits of sandbox, keeping text and title where
+// a template is not configured or fails.
+func renderTextTemplates(alertPayload *AlertManagerPayload, sandbox *TemplateSandbox, text, title string) (string, string) {
+	templates := getRuntime().Templates
+	if templates == nil {
+		return text, title
+	}
+	if t, err := templates.Text(alertPayload, sandbox); err != nil {
+		logger.Error("Error rendering text template: %v", err)
+	} else if t != "" {
+		text = t
+	}
+	if t, err := templates.Title(alertPayload, sandbox); err != nil {
+		logger.Error("Error rendering title template: %v", err)
+	} else if t != "" {
+		title = t
+	}
+	return text, title
+}
+
+func createSummarySection(alertPayload *AlertManagerPayload, layout LayoutConfig) CardSection {
 	summarySection := CardSection{
-		Header: "Summary",
-		Widgets: []Widget{
-			{
+		Header:  "Summary",
+		Widgets: []Widget{},
+	}
+
+	for _, widget := range layout.SummaryWidgets {
+		switch widget {
+		case WidgetStatus:
+			summarySection.Widgets = append(summarySection.Widgets, Widget{
 				KeyValue: &KeyValue{
 					TopLabel: "Status",
 					Content:  alertPayload.Status,
 					Icon:     getStatusIcon(alertPayload.Status),
 				},
-			},
-		},
-	}
-
-	if len(alertPayload.CommonLabels) > 0 {
-		labelsContent := formatMapAsList(alertPayload.CommonLabels)
-		summarySection.Widgets = append(summarySection.Widgets, Widget{
-			KeyValue: &KeyValue{
-				TopLabel:         "Common Labels",
-				Content:          labelsContent,
-				ContentMultiline: true,
-			},
-		})
-	}
-
-	if len(alertPayload.CommonAnnotations) > 0 {
-		annotationsContent := formatMapAsList(alertPayload.CommonAnnotations)
-		summarySection.Widgets = append(summarySection.Widgets, Widget{
-			KeyValue: &KeyValue{
-				TopLabel:         "Common Annotations",
-				Content:          annotationsContent,
-				ContentMultiline: true,
-			},
-		})
+			})
+		case WidgetLabelChips:
+			if chips := labelChips(alertPayload.CommonLabels, layout.ChipLabels, alertPayload.ExternalURL); chips != nil {
+				summarySection.Widgets = append(summarySection.Widgets, Widget{Chips: chips})
+			}
+		case WidgetTruncated:
+			if alertPayload.TruncatedAlerts > 0 {
+				summarySection.Widgets = append(summarySection.Widgets, Widget{
+					TextParagraph: &TextParagraph{
+						Text: fmt.Sprintf("<i>%d alert(s) truncated upstream</i>", alertPayload.TruncatedAlerts),
+					},
+				})
+			}
+		case WidgetDurations:
+			if content := firingDurationRange(alertPayload.Alerts); content != "" {
+				summarySection.Widgets = append(summarySection.Widgets, Widget{
+					KeyValue: &KeyValue{
+						TopLabel: "Firing Duration",
+						Content:  content,
+					},
+				})
+			}
+		case WidgetCommonLabels:
+			if len(alertPayload.CommonLabels) > 0 {
+				collapseFrom(&summarySection)
+				summarySection.Widgets = append(summarySection.Widgets, labelsWidget("Common Labels", alertPayload.CommonLabels, layout.LabelColumns))
+			}
+		case WidgetCommonAnnotations:
+			if len(alertPayload.CommonAnnotations) > 0 {
+				collapseFrom(&summarySection)
+				annotationsContent := formatMapAsList(alertPayload.CommonAnnotations)
+				summarySection.Widgets = append(summarySection.Widgets, Widget{
+					KeyValue: &KeyValue{
+						TopLabel:         "Common Annotations",
+						Content:          annotationsContent,
+						ContentMultiline: true,
+					},
+				})
+			}
+		}
 	}
 
 	return summarySection
 }
 
-func createAlertSection(alertIndex int, alert Alert) CardSection {
+func createAlertSection(alertIndex int, alert Alert, linkPrefix string, layout LayoutConfig) CardSection {
 	alertSection := CardSection{
 		Header:  fmt.Sprintf("Alert #%d", alertIndex),
 		Widgets: []Widget{},
 	}
 
-	if description, ok := alert.Annotations["description"]; ok {
-		alertSection.Widgets = append(alertSection.Widgets, Widget{
-			TextParagraph: &TextParagraph{
-				Text: description,
-			},
-		})
-	} else if summary, ok := alert.Annotations["summary"]; ok {
-		alertSection.Widgets = append(alertSection.Widgets, Widget{
-			TextParagraph: &TextParagraph{
-				Text: summary,
-			},
-		})
-	}
-
-	if len(alert.Labels) > 0 {
-		labelsContent := formatMapAsList(alert.Labels)
-		alertSection.Widgets = append(alertSection.Widgets, Widget{
-			KeyValue: &KeyValue{
-				TopLabel:         "Labels",
-				Content:          labelsContent,
-				ContentMultiline: true,
-			},
-		})
-	}
-
-	alertSection.Widgets = append(alertSection.Widgets, Widget{
-		KeyValue: &KeyValue{
-			TopLabel: "Started",
-			Content:  alert.StartsAt.Format(time.RFC3339),
-		},
-	})
-
-	if alert.GeneratorURL != "" {
-		alertSection.Widgets = append(alertSection.Widgets, Widget{
-			Buttons: []Button{
-				{
+	for _, widget := range layout.AlertWidgets {
+		switch widget {
+		case WidgetDescription:
+			if description, ok := alert.Annotations["description"]; ok {
+				alertSection.Widgets = append(alertSection.Widgets, Widget{
+					TextParagraph: &TextParagraph{
+						Text: description,
+					},
+				})
+			} else if summary, ok := alert.Annotations["summary"]; ok {
+				alertSection.Widgets = append(alertSection.Widgets, Widget{
+					TextParagraph: &TextParagraph{
+						Text: summary,
+					},
+				})
+			}
+		case WidgetLabels:
+			if len(alert.Labels) > 0 {
+				collapseFrom(&alertSection)
+				alertSection.Widgets = append(alertSection.Widgets, labelsWidget("Labels", alert.Labels, layout.LabelColumns))
+			}
+		case WidgetStarted:
+			alertSection.Widgets = append(alertSection.Widgets, Widget{
+				KeyValue: &KeyValue{
+					TopLabel: "Started",
+					Content:  alert.StartsAt.Format(time.RFC3339),
+				},
+			})
+		case WidgetDuration:
+			if d, ok := alert.FiringDuration(); ok {
+				alertSection.Widgets = append(alertSection.Widgets, Widget{
+					KeyValue: &KeyValue{
+						TopLabel: "Duration",
+						Content:  "was firing for " + formatDuration(d),
+					},
+				})
+			}
+		case WidgetAck:
+			if ack, ok := acks.Get(alertKey(alert), clock.Now()); ok {
+				alertSection.Widgets = append(alertSection.Widgets, Widget{
+					KeyValue: &KeyValue{
+						TopLabel:    "Acknowledged",
+						Content:     fmt.Sprintf("Acked by %s at %s", ack.By, ack.At.Format("15:04")),
+						BottomLabel: ack.Comment,
+					},
+				})
+			}
+		case WidgetButtons:
+			var buttons []Button
+			if alert.GeneratorURL != "" {
+				buttons = append(buttons, Button{
 					TextButton: &TextButton{
 						Text: "View in Prometheus",
 						OnClick: &OnClickAction{
@@ -427,12 +1246,96 @@ func createAlertSection(alertIndex int, alert Alert) CardSection {
 							},
 						},
 					},
+				})
+			}
+			buttons = append(buttons, annotationLinkButtons(alert.Annotations, linkPrefix)...)
+
+			if len(buttons) > 0 {
+				alertSection.Widgets = append(alertSection.Widgets, Widget{
+					Buttons: buttons,
+				})
+			}
+		}
+	}
+
+	return alertSection
+}
+
+// collapseFrom makes the section collapsible from its next widget on. Label
+// and annotation lists are long, so they stay hidden until expanded.
+func collapseFrom(section *CardSection) {
+	if !section.Collapsible {
+		section.Collapsible = true
+		section.UncollapsibleWidgetsCount = len(section.Widgets)
+	}
+}
+
+// firingDurationRange describes how long the resolved alerts were firing:
+// a single duration, or the shortest and longest. It returns "" when no
+// alert has resolved.
+func firingDurationRange(alerts Alerts) string {
+	var min, max time.Duration
+	n := 0
+	for _, a := range alerts {
+		d, ok := a.FiringDuration()
+		if !ok {
+			continue
+		}
+		if n == 0 || d < min {
+			min = d
+		}
+		if n == 0 || d > max {
+			max = d
+		}
+		n++
+	}
+
+	switch {
+	case n == 0:
+		return ""
+	case formatDuration(min) == formatDuration(max):
+		return formatDuration(max)
+	default:
+		return fmt.Sprintf("%s to %s", formatDuration(min), formatDuration(max))
+	}
+}
+
+// annotationLinkButtons turns annotations named with the link prefix (e.g.
+// link_runbook_wiki) into buttons labelled after the rest of the name
+// ("Runbook Wiki"). Values that are not http(s) URLs are ignored.
+func annotationLinkButtons(annotations KV, prefix string) []Button {
+	if prefix == "" {
+		return nil
+	}
+
+	var buttons []Button
+	for _, pair := range annotations.SortedPairs() {
+		if !strings.HasPrefix(pair.Name, prefix) || len(pair.Name) == len(prefix) {
+			continue
+		}
+		if !strings.HasPrefix(pair.Value, "https://") && !strings.HasPrefix(pair.Value, "http://") {
+			continue
+		}
+
+		words := strings.FieldsFunc(strings.TrimPrefix(pair.Name, prefix), func(r rune) bool {
+			return r == '_' || r == '-'
+		})
+		for i, w := range words {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+
+		buttons = append(buttons, Button{
+			TextButton: &TextButton{
+				Text: strings.Join(words, " "),
+				OnClick: &OnClickAction{
+					OpenLink: &OpenLink{
+						URL: pair.Value,
+					},
 				},
 			},
 		})
 	}
-
-	return alertSection
+	return buttons
 }
 
 func createExternalURLSection(externalURL string) CardSection {
@@ -456,14 +1359,56 @@ func createExternalURLSection(externalURL string) CardSection {
 	}
 }
 
+// formatMapAsList lists data one entry per line, in the order of
+// KV.SortedPairs so the same labels always render the same way.
 func formatMapAsList(data map[string]string) string {
 	var content strings.Builder
-	for k, v := range data {
-		content.WriteString(fmt.Sprintf("• %s: %s\n", k, v))
+	for _, p := range KV(data).SortedPairs() {
+		content.WriteString(fmt.Sprintf("• %s: %s\n", p.Name, p.Value))
 	}
 	return content.String()
 }
 
+// threadKey returns the Google Chat thread key for payload's notification
+// from its group key or the values of thread_by_labels, or "" when
+// notifications are not threaded.
+func threadKey(cfg GoogleChatConfig, payload *AlertManagerPayload) string {
+	switch {
+	case len(cfg.ThreadByLabels) > 0:
+		return labelsThreadKey(routingLabels(payload), cfg.ThreadByLabels)
+	case cfg.ThreadByGroupKey:
+		return groupThreadKey(payload.GroupKey)
+	}
+	return ""
+}
+
+// labelsThreadKey derives a thread key from the values of names in labels,
+// or returns "" when labels has none of them.
+func labelsThreadKey(labels KV, names []string) string {
+	var b strings.Builder
+	found := false
+	for _, name := range names {
+		value, ok := labels[name]
+		found = found || ok
+		b.WriteString(name + "=" + value + "\x00")
+	}
+	if !found {
+		return ""
+	}
+	return groupThreadKey(b.String())
+}
+
+// groupThreadKey derives a Google Chat thread key from an AlertManager
+// group key, so every notification for an alert group lands in one thread.
+// Group keys contain braces and quotes, so they are hashed.
+func groupThreadKey(groupKey string) string {
+	if groupKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(groupKey))
+	return hex.EncodeToString(sum[:16])
+}
+
 func getAlertName(alertPayload *AlertManagerPayload) string {
 	if alertName, ok := alertPayload.CommonLabels["alertname"]; ok {
 		return alertName
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -304,7 +306,12 @@ func TestValidateAlertPayload(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateAlertPayload(&tt.payload)
+			body, err := json.Marshal(tt.payload)
+			if err != nil {
+				t.Fatalf("Failed to marshal test payload: %v", err)
+			}
+
+			err = validateAlertPayload(body)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("validateAlertPayload() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -312,6 +319,397 @@ func TestValidateAlertPayload(t *testing.T) {
 	}
 }
 
+func TestValidateAlertPayloadFieldErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "missing alert labels",
+			body:    `{"status":"firing","alerts":[{"status":"firing"}]}`,
+			wantErr: "alerts[0].labels: is required",
+		},
+		{
+			name:    "invalid alert status",
+			body:    `{"status":"firing","alerts":[{"status":"pending","labels":{"a":"b"}}]}`,
+			wantErr: "alerts[0].status: value pending is not one of [firing resolved]",
+		},
+		{
+			name:    "non-string label value",
+			body:    `{"status":"firing","alerts":[{"status":"firing","labels":{"count":3}}]}`,
+			wantErr: "alerts[0].labels.count: expected string, got integer",
+		},
+		{
+			name:    "invalid timestamp",
+			body:    `{"status":"firing","alerts":[{"status":"firing","labels":{"a":"b"},"startsAt":"yesterday"}]}`,
+			wantErr: `alerts[0].startsAt: invalid date-time "yesterday"`,
+		},
+		{
+			name:    "unknown version",
+			body:    `{"version":"99","status":"firing","alerts":[]}`,
+			wantErr: `unknown payload version "99" read as version 4: alerts: must contain at least 1 item(s)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAlertPayload([]byte(tt.body))
+			if err == nil {
+				t.Fatal("Expected validation error")
+			}
+			if !contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %q", tt.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestAnnotationLinkButtons(t *testing.T) {
+	annotations := KV{
+		"link_runbook_wiki": "https://wiki.example.com/runbooks/cpu",
+		"link_ticket":       "https://jira.example.com/browse/OPS-1",
+		"link_bogus":        "not a url",
+		"link_":             "https://example.com",
+		"description":       "https://example.com/ignored",
+	}
+
+	buttons := annotationLinkButtons(annotations, "link_")
+	if len(buttons) != 2 {
+		t.Fatalf("Expected 2 buttons, got %d", len(buttons))
+	}
+	if buttons[0].TextButton.Text != "Runbook Wiki" || buttons[1].TextButton.Text != "Ticket" {
+		t.Errorf("Unexpected button labels %q, %q", buttons[0].TextButton.Text, buttons[1].TextButton.Text)
+	}
+	if buttons[1].TextButton.OnClick.OpenLink.URL != "https://jira.example.com/browse/OPS-1" {
+		t.Errorf("Unexpected button URL %s", buttons[1].TextButton.OnClick.OpenLink.URL)
+	}
+
+	if len(annotationLinkButtons(annotations, "")) != 0 {
+		t.Error("Expected no buttons when the prefix is disabled")
+	}
+}
+
 func contains(s, substr string) bool {
 	return bytes.Contains([]byte(s), []byte(substr))
 }
+
+func TestNewServeMuxes(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          Config
+		path         string
+		onAdmin      bool
+		auth         bool
+		expectedCode int
+	}{
+		{
+			name:         "metrics on public mux without admin listener",
+			path:         "/metrics",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "metrics moved to admin listener",
+			cfg:          Config{Server: ServerConfig{AdminListenAddr: ":9000"}},
+			path:         "/metrics",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "metrics served by admin listener",
+			cfg:          Config{Server: ServerConfig{AdminListenAddr: ":9000"}},
+			path:         "/metrics",
+			onAdmin:      true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "admin auth required",
+			cfg: Config{Server: ServerConfig{
+				AdminListenAddr: ":9000",
+				AdminAuth:       BasicAuthConfig{Username: "admin", Password: "secret"},
+			}},
+			path:         "/metrics",
+			onAdmin:      true,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "admin auth accepted",
+			cfg: Config{Server: ServerConfig{
+				AdminListenAddr: ":9000",
+				AdminAuth:       BasicAuthConfig{Username: "admin", Password: "secret"},
+			}},
+			path:         "/metrics",
+			onAdmin:      true,
+			auth:         true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "details page moved to admin listener",
+			cfg: Config{Server: ServerConfig{
+				AdminListenAddr: ":9000",
+				AdminAuth:       BasicAuthConfig{Username: "admin", Password: "secret"},
+			}},
+			path:         "/details/req-1",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name: "public details page",
+			cfg: Config{Server: ServerConfig{
+				AdminListenAddr: ":9000",
+				AdminAuth:       BasicAuthConfig{Username: "admin", Password: "secret"},
+				PublicDetails:   true,
+			}},
+			path:         "/details/req-1",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "health stays public",
+			cfg:          Config{Server: ServerConfig{AdminListenAddr: ":9000"}},
+			path:         "/health",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "health under url prefix",
+			cfg:          Config{Server: ServerConfig{URLPrefix: "/a2g/"}},
+			path:         "/a2g/health",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unprefixed path not served",
+			cfg:          Config{Server: ServerConfig{URLPrefix: "a2g"}},
+			path:         "/health",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "source endpoint requires its credentials",
+			cfg:          Config{Sources: []SourceConfig{{Name: "team-a", Auth: InboundAuthConfig{BearerToken: "secret"}}}},
+			path:         "/webhook/team-a",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "webhook auth required",
+			cfg:          Config{Server: ServerConfig{WebhookAuth: InboundAuthConfig{BearerToken: "secret"}}},
+			path:         "/webhook",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "webhook auth covers batches",
+			cfg:          Config{Server: ServerConfig{WebhookAuth: InboundAuthConfig{BearerToken: "secret"}}},
+			path:         "/webhook/batch",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "webhook auth leaves health public",
+			cfg:          Config{Server: ServerConfig{WebhookAuth: InboundAuthConfig{BearerToken: "secret"}}},
+			path:         "/health",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "pprof profile under url prefix",
+			cfg:          Config{Server: ServerConfig{AdminListenAddr: ":9000", URLPrefix: "/a2g"}},
+			path:         "/a2g/debug/pprof/goroutine?debug=1",
+			onAdmin:      true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "pprof cmdline",
+			cfg:          Config{Server: ServerConfig{AdminListenAddr: ":9000"}},
+			path:         "/debug/pprof/cmdline",
+			onAdmin:      true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "admin routes under url prefix",
+			cfg:          Config{Server: ServerConfig{AdminListenAddr: ":9000", URLPrefix: "/a2g"}},
+			path:         "/a2g/metrics",
+			onAdmin:      true,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			public, admin := newServeMuxes(tt.cfg, NewMockProvider(false))
+			mux := public
+			if tt.onAdmin {
+				mux = admin
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth {
+				req.SetBasicAuth("admin", "secret")
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestRouteWebhook(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	db := NewMockProvider(false)
+	currentRuntime.Store(&Runtime{Routes: []*Route{
+		{Name: "db", ServeWebhook: true, Provider: db, Matchers: Matchers{{Name: "team", Type: MatchEqual, Value: "db"}}},
+		{Name: "internal", Provider: NewMockProvider(false)},
+	}})
+	fallback := NewMockProvider(false)
+	public, _ := newServeMuxes(Config{}, fallback)
+
+	body := `{"status":"firing","alerts":[{"status":"firing","labels":{"alertname":"DiskFull","team":"web"},"startsAt":"2024-05-15T09:00:00Z"}]}`
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/webhook/db", want: http.StatusOK},
+		{path: "/webhook/internal", want: http.StatusNotFound},
+		{path: "/webhook/unknown", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		public.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("POST %s = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+
+	// The alert does not match the db route, but was posted to it.
+	if got := len(db.GetSentMessages()); got != 1 {
+		t.Errorf("db route sent %d messages, want 1", got)
+	}
+	if got := len(fallback.GetSentMessages()); got != 0 {
+		t.Errorf("default provider sent %d messages, want 0", got)
+	}
+}
+
+func TestNewHTTPServerH2C(t *testing.T) {
+	tests := []struct {
+		name      string
+		h2c       bool
+		wantProto int
+	}{
+		{"h2c enabled", true, 2},
+		{"h2c disabled", false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			})
+			server := newHTTPServer(ServerConfig{H2C: tt.h2c, MaxConcurrentStreams: 10}, "", handler, time.Second)
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go server.Serve(ln)
+			defer server.Close()
+
+			// With h2c, the client speaks HTTP/2 with prior knowledge, as
+			// an Envoy sidecar does.
+			var protocols http.Protocols
+			protocols.SetHTTP1(!tt.h2c)
+			protocols.SetUnencryptedHTTP2(tt.h2c)
+			client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+			resp, err := client.Get("http://" + ln.Addr().String() + "/")
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.ProtoMajor != tt.wantProto {
+				t.Errorf("Expected HTTP/%d, got %s", tt.wantProto, resp.Proto)
+			}
+		})
+	}
+}
+
+func TestTruncatedAlertsWidget(t *testing.T) {
+	payload := &AlertManagerPayload{
+		Status:          "firing",
+		GroupKey:        `{}:{alertname="HighCPU"}`,
+		TruncatedAlerts: 7,
+		Alerts:          Alerts{{Status: "firing", Labels: KV{"alertname": "HighCPU"}}},
+	}
+
+	summary := convertToGoogleChatFormat(payload).Cards[0].Sections[0]
+	found := false
+	for _, w := range summary.Widgets {
+		if w.TextParagraph != nil && strings.Contains(w.TextParagraph.Text, "7 alert(s) truncated upstream") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected truncated alerts notice in the summary section")
+	}
+
+	payload.TruncatedAlerts = 0
+	for _, w := range convertToGoogleChatFormat(payload).Cards[0].Sections[0].Widgets {
+		if w.TextParagraph != nil {
+			t.Errorf("Unexpected paragraph without truncation: %s", w.TextParagraph.Text)
+		}
+	}
+}
+
+func TestResolvedDurationWidgets(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	payload := &AlertManagerPayload{
+		Status: "resolved",
+		Alerts: Alerts{
+			{Status: "resolved", Labels: KV{"alertname": "HighCPU"}, StartsAt: start, EndsAt: start.Add(83 * time.Minute)},
+			{Status: "resolved", Labels: KV{"alertname": "HighCPU"}, StartsAt: start, EndsAt: start.Add(5 * time.Minute)},
+			{Status: "firing", Labels: KV{"alertname": "HighCPU"}, StartsAt: start},
+		},
+	}
+
+	widgetContent := func(section CardSection, label string) string {
+		for _, w := range section.Widgets {
+			if w.KeyValue != nil && w.KeyValue.TopLabel == label {
+				return w.KeyValue.Content
+			}
+		}
+		return ""
+	}
+
+	sections := convertToGoogleChatFormat(payload).Cards[0].Sections
+	if got := widgetContent(sections[0], "Firing Duration"); got != "5m to 1h23m" {
+		t.Errorf("summary duration = %q, want %q", got, "5m to 1h23m")
+	}
+	if got := widgetContent(sections[1], "Duration"); got != "was firing for 1h23m" {
+		t.Errorf("alert duration = %q, want %q", got, "was firing for 1h23m")
+	}
+	if got := widgetContent(sections[3], "Duration"); got != "" {
+		t.Errorf("unexpected duration for firing alert: %q", got)
+	}
+}
+
+func TestFiringDurationRange(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	resolved := func(d time.Duration) Alert {
+		return Alert{Status: "resolved", StartsAt: start, EndsAt: start.Add(d)}
+	}
+
+	tests := []struct {
+		name   string
+		alerts Alerts
+		want   string
+	}{
+		{name: "none resolved", alerts: Alerts{{Status: "firing", StartsAt: start}}, want: ""},
+		{name: "single", alerts: Alerts{resolved(2 * time.Hour)}, want: "2h0m"},
+		{name: "same rounded", alerts: Alerts{resolved(10 * time.Minute), resolved(10*time.Minute + time.Second)}, want: "10m"},
+		{name: "range", alerts: Alerts{resolved(20 * time.Second), resolved(90 * time.Minute)}, want: "<1m to 1h30m"},
+		{name: "missing end", alerts: Alerts{{Status: "resolved", StartsAt: start}}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firingDurationRange(tt.alerts); got != tt.want {
+				t.Errorf("firingDurationRange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MatchType is the comparison operator of a label Matcher.
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher matches a single label using AlertManager matcher semantics.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+// ParseMatcher parses an AlertManager-style matcher such as
+// `severity="critical"` or `instance=~"web-.*"`.
+func ParseMatcher(s string) (*Matcher, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexAny(s, "=!")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid matcher %q", s)
+	}
+
+	name := strings.TrimSpace(s[:idx])
+	rest := s[idx:]
+
+	var mt MatchType
+	switch {
+	case strings.HasPrefix(rest, "=~"):
+		mt = MatchRegexp
+	case strings.HasPrefix(rest, "!~"):
+		mt = MatchNotRegexp
+	case strings.HasPrefix(rest, "!="):
+		mt = MatchNotEqual
+	case strings.HasPrefix(rest, "="):
+		mt = MatchEqual
+	default:
+		return nil, fmt.Errorf("invalid matcher %q", s)
+	}
+
+	value := strings.TrimSpace(rest[len(mt):])
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+
+	return NewMatcher(name, mt, value)
+}
+
+// NewMatcher builds a matcher, compiling the value for regexp match types.
+func NewMatcher(name string, mt MatchType, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Type: mt, Value: value}
+	if mt == MatchRegexp || mt == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp in matcher for %s: %v", name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether the label set satisfies the matcher. A missing
+// label is treated as the empty string.
+func (m *Matcher) Matches(labels KV) bool {
+	v := labels[m.Name]
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// Matchers is a conjunction of label matchers.
+type Matchers []*Matcher
+
+// ParseMatchers parses every matcher in the list.
+func ParseMatchers(ss []string) (Matchers, error) {
+	ms := make(Matchers, 0, len(ss))
+	for _, s := range ss {
+		m, err := ParseMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// Matches reports whether all matchers match the label set.
+func (ms Matchers) Matches(labels KV) bool {
+	for _, m := range ms {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
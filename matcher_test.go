@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestParseMatcher(t *testing.T) {
+	labels := KV{"alertname": "HighCPU", "instance": "web-01", "severity": "warning"}
+
+	tests := []struct {
+		input   string
+		matches bool
+		wantErr bool
+	}{
+		{input: `alertname="HighCPU"`, matches: true},
+		{input: `alertname=HighCPU`, matches: true},
+		{input: `severity!="critical"`, matches: true},
+		{input: `instance=~"web-.*"`, matches: true},
+		{input: `instance=~"web"`, matches: false},
+		{input: `instance!~"db-.*"`, matches: true},
+		{input: `team=""`, matches: true},
+		{input: `team="platform"`, matches: false},
+		{input: `=value`, wantErr: true},
+		{input: `instance=~"("`, wantErr: true},
+		{input: `nooperator`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := ParseMatcher(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := m.Matches(labels); got != tt.matches {
+				t.Errorf("Matches() = %v, want %v", got, tt.matches)
+			}
+		})
+	}
+}
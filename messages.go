@@ -0,0 +1,218 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultMessageTTL is how long a message posted through the Chat API is
+// remembered, both as the first message for its alerts and alert group and
+// for reactions to it.
+const defaultMessageTTL = 7 * 24 * time.Hour
+
+// ChatMessageRef names a message created through the Chat API.
+type ChatMessageRef struct {
+	// Name is the message's resource name, "spaces/AAAA/messages/BBBB".
+	Name string `json:"name"`
+	// Thread is the resource name of the message's thread.
+	Thread   string    `json:"thread,omitempty"`
+	PostedAt time.Time `json:"postedAt"`
+}
+
+// postedMessageIndex remembers the messages posted through the Chat API:
+// which alerts each carried, so reactions to it can be traced back to them,
+// and which message was posted first for each alert and alert group, so
+// later messages can refer back to it. With a path, changes are written to
+// disk in the background so the index survives restarts.
+type postedMessageIndex struct {
+	mu       sync.Mutex
+	path     string
+	ttl      time.Duration
+	messages map[string]postedMessage
+	// first maps "group/<group key>" and "alert/<alert key>" to the name
+	// of the first message posted for them.
+	first  map[string]string
+	dirty  bool
+	saving bool
+	// saveMu orders writes of the state file.
+	saveMu sync.Mutex
+}
+
+// postedMessage is a posted message, persisted by its resource name.
+type postedMessage struct {
+	Thread    string    `json:"thread,omitempty"`
+	GroupKey  string    `json:"groupKey,omitempty"`
+	AlertKeys []string  `json:"alertKeys,omitempty"`
+	PostedAt  time.Time `json:"postedAt"`
+}
+
+// keys returns the group and alert keys the message may be first for.
+func (m postedMessage) keys() []string {
+	keys := make([]string, 0, len(m.AlertKeys)+1)
+	if m.GroupKey != "" {
+		keys = append(keys, "group/"+m.GroupKey)
+	}
+	for _, key := range m.AlertKeys {
+		keys = append(keys, "alert/"+key)
+	}
+	return keys
+}
+
+var postedMessages = newPostedMessageIndex("", defaultMessageTTL)
+
+func newPostedMessageIndex(path string, ttl time.Duration) *postedMessageIndex {
+	return &postedMessageIndex{path: path, ttl: ttl, messages: map[string]postedMessage{}, first: map[string]string{}}
+}
+
+// loadPostedMessageIndex opens the index persisted at path.
+func loadPostedMessageIndex(path string, ttl time.Duration) (*postedMessageIndex, error) {
+	p := newPostedMessageIndex(path, ttl)
+	if err := loadState(path, &p.messages); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(p.messages))
+	for name := range p.messages {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return p.messages[names[i]].PostedAt.Before(p.messages[names[j]].PostedAt)
+	})
+	for _, name := range names {
+		p.index(name, p.messages[name])
+	}
+	return p, nil
+}
+
+// index records the message with resource name name as the first for its
+// keys that have none yet. The caller must hold p.mu.
+func (p *postedMessageIndex) index(name string, m postedMessage) {
+	for _, key := range m.keys() {
+		if _, ok := p.first[key]; !ok {
+			p.first[key] = name
+		}
+	}
+}
+
+// Remember records the message ref, posted for the alert group with
+// groupKey and carrying alertKeys. It becomes the first message for the
+// group and each alert that has none remembered yet.
+func (p *postedMessageIndex) Remember(ref ChatMessageRef, groupKey string, alertKeys []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune(ref.PostedAt)
+	m := postedMessage{Thread: ref.Thread, GroupKey: groupKey, AlertKeys: alertKeys, PostedAt: ref.PostedAt}
+	p.messages[ref.Name] = m
+	p.index(ref.Name, m)
+	p.dirty = true
+	if p.path != "" && !p.saving {
+		p.saving = true
+		go p.flush()
+	}
+}
+
+// prune forgets the messages posted more than the TTL before now. The
+// caller must hold p.mu.
+func (p *postedMessageIndex) prune(now time.Time) {
+	for name, m := range p.messages {
+		if now.Sub(m.PostedAt) <= p.ttl {
+			continue
+		}
+		delete(p.messages, name)
+		for _, key := range m.keys() {
+			if p.first[key] == name {
+				delete(p.first, key)
+			}
+		}
+		p.dirty = true
+	}
+}
+
+// Lookup returns the alerts carried by the message with resource name name.
+func (p *postedMessageIndex) Lookup(name string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.messages[name]
+	if !ok || clock.Since(m.PostedAt) > p.ttl {
+		return nil
+	}
+	return m.AlertKeys
+}
+
+// Group returns the first message posted for the alert group with
+// groupKey, or nil.
+func (p *postedMessageIndex) Group(groupKey string) *ChatMessageRef {
+	return p.get("group/" + groupKey)
+}
+
+// Alert returns the first message posted for alert, or nil.
+func (p *postedMessageIndex) Alert(alert Alert) *ChatMessageRef {
+	return p.get("alert/" + alertKey(alert))
+}
+
+func (p *postedMessageIndex) get(key string) *ChatMessageRef {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name, ok := p.first[key]
+	if !ok {
+		return nil
+	}
+	m := p.messages[name]
+	if clock.Since(m.PostedAt) > p.ttl {
+		return nil
+	}
+	return &ChatMessageRef{Name: name, Thread: m.Thread, PostedAt: m.PostedAt}
+}
+
+// flush saves the index until no changes are left, so messages posted
+// while a save is in progress are written together by the next one.
+func (p *postedMessageIndex) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.dirty {
+		p.mu.Unlock()
+		err := p.Save()
+		p.mu.Lock()
+		if err != nil {
+			logger.Error("Error saving posted messages: %v", err)
+			p.dirty = true
+			break
+		}
+	}
+	p.saving = false
+}
+
+// Save writes the index to disk now.
+func (p *postedMessageIndex) Save() error {
+	if p.path == "" {
+		return nil
+	}
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+	p.mu.Lock()
+	messages := maps.Clone(p.messages)
+	p.dirty = false
+	p.mu.Unlock()
+	return saveState(p.path, messages)
+}
+
+// Compact forgets the messages that have outlived the TTL at now, saves the
+// index and returns the size of its file.
+func (p *postedMessageIndex) Compact(now time.Time) (int64, error) {
+	p.mu.Lock()
+	p.prune(now)
+	p.mu.Unlock()
+	if p.path == "" {
+		return 0, nil
+	}
+	if err := p.Save(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
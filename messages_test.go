@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPostedMessageIndex(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	path := filepath.Join(t.TempDir(), "messages.json")
+	p, err := loadPostedMessageIndex(path, time.Hour)
+	if err != nil {
+		t.Fatalf("loadPostedMessageIndex() error = %v", err)
+	}
+
+	now := time.Now()
+	first := ChatMessageRef{Name: "spaces/A/messages/1", Thread: "spaces/A/threads/1", PostedAt: now.Add(-2 * time.Minute)}
+	p.Remember(first, "group-1", []string{"fp-1"})
+	second := ChatMessageRef{Name: "spaces/A/messages/2", PostedAt: now.Add(-time.Minute)}
+	p.Remember(second, "group-1", []string{"fp-1", "fp-2"})
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	p, err = loadPostedMessageIndex(path, time.Hour)
+	if err != nil {
+		t.Fatalf("loadPostedMessageIndex() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		got  *ChatMessageRef
+		want string
+	}{
+		{"group keeps the first message", p.Group("group-1"), first.Name},
+		{"alert keeps the first message", p.Alert(Alert{Fingerprint: "fp-1"}), first.Name},
+		{"new alert gets the later message", p.Alert(Alert{Fingerprint: "fp-2"}), second.Name},
+		{"unknown group", p.Group("group-2"), ""},
+	}
+	for _, tt := range tests {
+		name := ""
+		if tt.got != nil {
+			name = tt.got.Name
+		}
+		if name != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, name, tt.want)
+		}
+	}
+	if keys := p.Lookup(second.Name); len(keys) != 2 {
+		t.Errorf("Lookup() = %v, want the alerts of the message", keys)
+	}
+
+	size, err := p.Compact(now.Add(time.Hour - 90*time.Second))
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if size == 0 {
+		t.Error("Compact() size = 0, want the size of the saved file")
+	}
+	if ref := p.Group("group-1"); ref != nil {
+		t.Errorf("Group() = %+v, want the expired first message forgotten", ref)
+	}
+	if keys := p.Lookup(second.Name); len(keys) != 2 {
+		t.Errorf("Lookup() = %v, want the later message kept", keys)
+	}
+	p, err = loadPostedMessageIndex(path, time.Hour)
+	if err != nil {
+		t.Fatalf("loadPostedMessageIndex() error = %v", err)
+	}
+	if ref := p.Alert(Alert{Fingerprint: "fp-1"}); ref == nil || ref.Name != second.Name {
+		t.Errorf("Alert() after compaction = %+v, want %s", ref, second.Name)
+	}
+}
+
+func TestMessageTemplateLookups(t *testing.T) {
+	defer func() { postedMessages = newPostedMessageIndex("", defaultMessageTTL) }()
+	postedMessages = newPostedMessageIndex("", defaultMessageTTL)
+	postedMessages.Remember(ChatMessageRef{Name: "spaces/A/messages/1", PostedAt: time.Now()}, "group-1", []string{"fp-1"})
+
+	tmpl, err := NewMessageTemplates(TemplatesConfig{
+		Text: `{{ with groupMessage .GroupKey }}See {{ .Name }}{{ end }}{{ range .Alerts }}{{ with alertMessage . }} ({{ .Name }}){{ else }} (new){{ end }}{{ end }}`,
+	})
+	if err != nil {
+		t.Fatalf("NewMessageTemplates() error = %v", err)
+	}
+	text, err := tmpl.Text(&AlertManagerPayload{GroupKey: "group-1", Alerts: Alerts{{Fingerprint: "fp-1"}, {Fingerprint: "fp-2"}}}, nil)
+	if err != nil {
+		t.Fatalf("Text() error = %v", err)
+	}
+	if want := "See spaces/A/messages/1 (spaces/A/messages/1) (new)"; text != want {
+		t.Errorf("Text() = %q, want %q", text, want)
+	}
+}
@@ -1,12 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metricsRegisterer is where registerMetrics registers the bridge's
+// collectors at startup, and metricsGatherer is what /metrics and the OTLP
+// exporter read. Code embedding the bridge can point both at its own
+// registry before it starts.
+var (
+	metricsRegisterer prometheus.Registerer = prometheus.DefaultRegisterer
+	metricsGatherer   prometheus.Gatherer   = prometheus.DefaultGatherer
 )
 
 var (
-	alertsReceived = promauto.NewCounterVec(
+	alertsReceived = newCounterVec(
 		prometheus.CounterOpts{
 			Name: "alertmanager_gchat_alerts_received_total",
 			Help: "The total number of alerts received",
@@ -14,7 +31,7 @@ var (
 		[]string{"status"},
 	)
 
-	alertsSent = promauto.NewCounterVec(
+	alertsSent = newCounterVec(
 		prometheus.CounterOpts{
 			Name: "alertmanager_gchat_alerts_sent_total",
 			Help: "The total number of alerts sent to Google Chat",
@@ -22,16 +39,16 @@ var (
 		[]string{"status"},
 	)
 
-	alertProcessingDuration = promauto.NewHistogramVec(
+	alertProcessingDuration = newHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "alertmanager_gchat_processing_duration_seconds",
-			Help:    "Time spent processing alerts",
+			Help:    "Time spent processing alerts, by pipeline phase",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"status"},
+		[]string{"phase", "route", "status"},
 	)
 
-	providerRequestDuration = promauto.NewHistogramVec(
+	providerRequestDuration = newHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "alertmanager_gchat_provider_request_duration_seconds",
 			Help:    "Time spent making requests to provider",
@@ -40,11 +57,473 @@ var (
 		[]string{"provider", "status"},
 	)
 
-	providerErrors = promauto.NewCounterVec(
+	providerErrors = newCounterVec(
 		prometheus.CounterOpts{
 			Name: "alertmanager_gchat_provider_errors_total",
 			Help: "The total number of provider errors",
 		},
 		[]string{"provider"},
 	)
+
+	sendsThrottled = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_sends_throttled_total",
+			Help: "The total number of sends that waited for a rate_limit token, by route",
+		},
+		[]string{"route"},
+	)
+
+	alertsSilenced = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_alerts_silenced_total",
+			Help: "The total number of alerts muted by bridge silences",
+		},
+	)
+
+	alertsHeld = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_alerts_held_total",
+			Help: "The total number of alerts held for a quiet hours or alert storm summary",
+		},
+	)
+
+	alertStorms = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_alert_storms_total",
+			Help: "The total number of alert storms detected, by route",
+		},
+		[]string{"route"},
+	)
+
+	enrichmentFailures = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_enrichment_failures_total",
+			Help: "The total number of enrichment steps that failed or timed out, by step",
+		},
+		[]string{"enricher"},
+	)
+
+	labelsLimited = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_label_limits_applied_total",
+			Help: "The total number of labels and annotations dropped, and values shortened, by the [normalize] limits, by kind",
+		},
+		[]string{"kind"},
+	)
+
+	stateCompactions = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_state_compactions_total",
+			Help: "The total number of state compactions, by store and status",
+		},
+		[]string{"store", "status"},
+	)
+
+	stateBytes = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_state_bytes",
+			Help: "The size of the state kept on disk after the last compaction, by store",
+		},
+		[]string{"store"},
+	)
+
+	stateEntriesDropped = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_state_entries_dropped_total",
+			Help: "The total number of state entries dropped by retention, by store and reason",
+		},
+		[]string{"store", "reason"},
+	)
+
+	destinationLastSuccess = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_destination_last_success_timestamp_seconds",
+			Help: "Unix time of the last message delivered to each destination",
+		},
+		[]string{"route", "destination"},
+	)
+
+	destinationFailures = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_destination_consecutive_failures",
+			Help: "The number of delivery attempts to each destination that failed since its last success",
+		},
+		[]string{"route", "destination"},
+	)
+
+	destinationCircuitOpen = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_destination_circuit_open",
+			Help: "Whether the circuit breaker of each destination is open and failing sends (1) or not (0)",
+		},
+		[]string{"route", "destination"},
+	)
+
+	outboxSize = newGauge(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_outbox_messages",
+			Help: "The number of messages waiting in the outbox for delivery",
+		},
+	)
+
+	outboxOldestAge = newGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_outbox_oldest_message_age_seconds",
+			Help: "How long the oldest message waiting in the outbox has been waiting, or 0 when it is empty",
+		},
+		func() float64 { return outbox.OldestAge(clock.Now()).Seconds() },
+	)
+
+	routesPaused = newGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_routes_paused",
+			Help: "Number of routes paused through the admin API",
+		},
+		func() float64 { return float64(len(routePauses.List(clock.Now()))) },
+	)
+
+	outboxDropped = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_outbox_dropped_total",
+			Help: "The total number of outbox messages dropped after a permanent error or exceeding max_age",
+		},
+	)
+
+	incidentsOpened = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_incident_spaces_opened_total",
+			Help: "The total number of incident spaces created",
+		},
+	)
+
+	reactionsHandled = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_reactions_handled_total",
+			Help: "The total number of emoji reactions on alert messages acted on",
+		},
+		[]string{"action"},
+	)
+
+	cardFallbacks = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_card_fallbacks_total",
+			Help: "The total number of messages resent as plain text after Google Chat rejected their cards, by route",
+		},
+		[]string{"route"},
+	)
+
+	alertsSquelched = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_alerts_squelched_total",
+			Help: "The total number of repeated firing alerts left out of notifications by a route's repeat_interval, by route",
+		},
+		[]string{"route"},
+	)
+
+	alertsCoalesced = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_alerts_coalesced_total",
+			Help: "The total number of alerts left out of notifications because another notification within the coalescing window carried them",
+		},
+	)
+
+	timeToNotify = newHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "alertmanager_gchat_time_to_notify_seconds",
+			Help:    "Time from a firing alert starting to its first notification being delivered, by route",
+			Buckets: []float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		},
+		[]string{"route"},
+	)
+
+	receiptToNotify = newHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "alertmanager_gchat_receipt_to_notify_seconds",
+			Help:    "Time from receiving a webhook to delivering its notification, by route",
+			Buckets: []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900},
+		},
+		[]string{"route"},
+	)
+
+	notifySLOAlerts = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_notify_slo_alerts_total",
+			Help: "The total number of firing alerts first notified within (met) or after (missed) the time-to-notify target, by route",
+		},
+		[]string{"route", "result"},
+	)
+
+	escalations = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_escalations_total",
+			Help: "The total number of undeliverable notifications reported to an escalation target, by target and status",
+		},
+		[]string{"target", "status"},
+	)
+
+	chatCredentialsValid = newGauge(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_chat_credentials_valid",
+			Help: "Whether the last check of the Chat API credentials obtained an access token (1) or not (0)",
+		},
+	)
+
+	chatRouteResources = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_gchat_chatroutes",
+			Help: "The number of ChatRoute resources in operator mode, by status (active or invalid)",
+		},
+		[]string{"status"},
+	)
+
+	groupUpdates = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_group_updates_total",
+			Help: "The total number of alert group changes sent as an update instead of the whole card, by route",
+		},
+		[]string{"route"},
+	)
+
+	templateLimitsExceeded = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_template_limits_exceeded_total",
+			Help: "The total number of template renderings stopped by a template limit, by route and limit (timeout, output or function)",
+		},
+		[]string{"route", "limit"},
+	)
+
+	jobRuns = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_job_runs_total",
+			Help: "The total number of scheduled job runs, by job and status",
+		},
+		[]string{"job", "status"},
+	)
+
+	otlpLogsDropped = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_otlp_logs_dropped_total",
+			Help: "The total number of log records that could not be exported over OTLP",
+		},
+	)
+
+	alertsDropped = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_alerts_dropped_total",
+			Help: "The total number of alerts rejected, held or dropped before reaching Google Chat, by reason",
+		},
+		[]string{"reason"},
+	)
+
+	payloadsFiltered = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_payloads_filtered_total",
+			Help: "The total number of payloads dropped by bridge filters",
+		},
+	)
+
+	webhooksDeduplicated = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_webhooks_deduplicated_total",
+			Help: "The total number of repeated webhook requests skipped by idempotency checks",
+		},
+	)
+
+	webhookFormats = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_webhook_formats_total",
+			Help: "The total number of webhook payloads received, by detected format",
+		},
+		[]string{"format"},
+	)
+
+	payloadVersionsReceived = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_payload_versions_total",
+			Help: "The total number of webhook payloads by declared version, with versions the bridge does not know counted as unknown",
+		},
+		[]string{"version"},
+	)
+
+	webhookPings = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_webhook_pings_total",
+			Help: "The total number of verification requests answered instead of processed, by kind",
+		},
+		[]string{"kind"},
+	)
+
+	dnsStaleAnswers = newCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_dns_stale_answers_total",
+			Help: "The total number of outbound connections that used expired DNS cache entries after a failed lookup",
+		},
+	)
+
+	logRepeatsSuppressed = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_log_repeats_suppressed_total",
+			Help: "The total number of repeated log messages collapsed into a summary line, by level",
+		},
+		[]string{"level"},
+	)
+
+	configReloads = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_gchat_config_reloads_total",
+			Help: "The total number of configuration reloads by result: success, failure, or pending confirmation",
+		},
+		[]string{"result"},
+	)
 )
+
+// Pipeline phases observed in alertProcessingDuration. The total phase spans
+// the whole request, including notifications that end up not being sent.
+const (
+	phaseParse   = "parse"
+	phaseConvert = "convert"
+	phaseSend    = "send"
+	phaseTotal   = "total"
+
+	statusSuccess = "success"
+	statusError   = "error"
+	statusDropped = "dropped"
+)
+
+// Reasons an alert counts as dropped in alertsDropped.
+const (
+	dropBadContentType   = "bad_content_type"
+	dropParseError       = "parse_error"
+	dropTooLarge         = "too_large"
+	dropValidationFailed = "validation_failed"
+	dropCoalesced        = "coalesced"
+	dropFiltered         = "filtered"
+	dropTransformed      = "transformed"
+	dropSilenced         = "silenced"
+	dropAcknowledged     = "acknowledged"
+	dropHeld             = "held"
+	dropSquelched        = "squelched"
+	dropChatDisabled     = "chat_disabled"
+	dropRateLimited      = "rate_limited"
+	dropQueueFull        = "queue_full"
+	dropPaused           = "paused"
+	dropForbidden        = "forbidden"
+	dropDeliveryFailed   = "delivery_failed"
+)
+
+// intentionalDropReasons are the reasons an alert is left out on purpose,
+// by configuration or by a user, rather than lost.
+var intentionalDropReasons = []string{dropCoalesced, dropFiltered, dropTransformed, dropSilenced, dropAcknowledged, dropHeld, dropSquelched, dropChatDisabled}
+
+func init() {
+	// Export every reason from the start, so rates and sums over reasons
+	// work before the first drop.
+	for _, reason := range []string{dropBadContentType, dropParseError, dropTooLarge, dropValidationFailed, dropCoalesced, dropFiltered, dropTransformed, dropSilenced, dropAcknowledged, dropHeld, dropSquelched, dropChatDisabled, dropRateLimited, dropQueueFull, dropPaused, dropForbidden, dropDeliveryFailed} {
+		alertsDropped.WithLabelValues(reason)
+	}
+}
+
+// dropAlerts counts n alerts as dropped for reason. Requests rejected before
+// their alerts could be read count as one.
+func dropAlerts(reason string, n int) {
+	if n > 0 {
+		alertsDropped.WithLabelValues(reason).Add(float64(n))
+	}
+}
+
+// sentAlerts counts n alerts of a notification with status as sent to Chat.
+func sentAlerts(status string, n int) {
+	if n > 0 {
+		alertsSent.WithLabelValues(status).Add(float64(n))
+	}
+}
+
+// collectors holds every collector created with the constructors below, in
+// order, for registerMetrics, and metricDescs their name and variable labels,
+// for describeMetric.
+var (
+	metricDescsMu sync.Mutex
+	collectors    []prometheus.Collector
+	metricDescs   = map[prometheus.Collector]metricDesc{}
+)
+
+// described records c with its name and variable labels and returns it.
+func described[T prometheus.Collector](c T, namespace, subsystem, name string, labels []string) T {
+	metricDescsMu.Lock()
+	defer metricDescsMu.Unlock()
+	collectors = append(collectors, c)
+	metricDescs[c] = metricDesc{Name: prometheus.BuildFQName(namespace, subsystem, name), Labels: labels}
+	return c
+}
+
+func newCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	return described(prometheus.NewCounter(opts), opts.Namespace, opts.Subsystem, opts.Name, nil)
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	return described(prometheus.NewCounterVec(opts, labels), opts.Namespace, opts.Subsystem, opts.Name, labels)
+}
+
+func newGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	return described(prometheus.NewGauge(opts), opts.Namespace, opts.Subsystem, opts.Name, nil)
+}
+
+func newGaugeVec(opts prometheus.GaugeOpts, labels []string) *prometheus.GaugeVec {
+	return described(prometheus.NewGaugeVec(opts, labels), opts.Namespace, opts.Subsystem, opts.Name, labels)
+}
+
+func newGaugeFunc(opts prometheus.GaugeOpts, f func() float64) prometheus.GaugeFunc {
+	return described(prometheus.NewGaugeFunc(opts, f), opts.Namespace, opts.Subsystem, opts.Name, nil)
+}
+
+func newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	return described(prometheus.NewHistogramVec(opts, labels), opts.Namespace, opts.Subsystem, opts.Name, labels)
+}
+
+// registerMetrics registers the bridge's collectors with reg. Collectors
+// already registered with reg are skipped, so it can be called again; any
+// other collector with the same name is reported as an error instead of
+// panicking like promauto.
+func registerMetrics(reg prometheus.Registerer) error {
+	metricDescsMu.Lock()
+	defer metricDescsMu.Unlock()
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			var are prometheus.AlreadyRegisteredError
+			if errors.As(err, &are) && are.ExistingCollector == c {
+				continue
+			}
+			return fmt.Errorf("registering %s: %w", metricDescs[c].Name, err)
+		}
+	}
+	return nil
+}
+
+// observePhase records the time since start for one pipeline phase.
+func observePhase(phase, route string, start time.Time, err error) {
+	status := statusSuccess
+	if err != nil {
+		status = statusError
+	}
+	alertProcessingDuration.WithLabelValues(phase, route, status).Observe(clock.Since(start).Seconds())
+}
+
+// observeDuration records seconds on obs. When ctx belongs to a sampled
+// trace, the trace ID is attached as an exemplar so a latency spike on a
+// dashboard links to the trace of a slow request.
+func observeDuration(ctx context.Context, obs prometheus.Observer, seconds float64) {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() {
+		if eo, ok := obs.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(seconds, prometheus.Labels{"trace_id": sc.TraceID().String()})
+			return
+		}
+	}
+	obs.Observe(seconds)
+}
+
+// metricsHandler serves metricsGatherer. OpenMetrics is offered so scrapers
+// that ask for it receive exemplars.
+func metricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(metricsRegisterer,
+		promhttp.HandlerFor(metricsGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func histogramCount(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := alertProcessingDuration.WithLabelValues(labels...).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestProcessingDurationPhases(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	body, err := json.Marshal(AlertManagerPayload{
+		Status: "firing",
+		Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "TestAlert"}, StartsAt: time.Now()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   []byte
+		fails  bool
+		phases [][]string
+	}{
+		{
+			name: "sent",
+			body: body,
+			phases: [][]string{
+				{phaseParse, "", statusSuccess},
+				{phaseConvert, defaultRouteName, statusSuccess},
+				{phaseSend, defaultRouteName, statusSuccess},
+				{phaseTotal, defaultRouteName, statusSuccess},
+			},
+		},
+		{
+			name:  "send failure",
+			body:  body,
+			fails: true,
+			phases: [][]string{
+				{phaseSend, defaultRouteName, statusError},
+				{phaseTotal, defaultRouteName, statusError},
+			},
+		},
+		{
+			name: "parse failure",
+			body: []byte(`{"status":"firing"}`),
+			phases: [][]string{
+				{phaseParse, "", statusError},
+				{phaseTotal, "", statusError},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := make([]uint64, len(tt.phases))
+			for i, labels := range tt.phases {
+				before[i] = histogramCount(t, labels...)
+			}
+
+			processPayload(context.Background(), tt.body, "req-1", NewMockProvider(tt.fails))
+
+			for i, labels := range tt.phases {
+				if got := histogramCount(t, labels...) - before[i]; got != 1 {
+					t.Errorf("Expected 1 observation for %v, got %d", labels, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPayloadVersions(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	tests := []struct {
+		name      string
+		version   string
+		wantLabel string
+	}{
+		{name: "omitted", version: "", wantLabel: "4"},
+		{name: "v4", version: "4", wantLabel: "4"},
+		{name: "unknown", version: "5", wantLabel: unknownPayloadVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(AlertManagerPayload{
+				Version: tt.version,
+				Status:  "firing",
+				Alerts:  Alerts{{Status: "firing", Labels: KV{"alertname": "DiskFull"}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var before dto.Metric
+			payloadVersionsReceived.WithLabelValues(tt.wantLabel).Write(&before)
+
+			provider := NewMockProvider(false)
+			if err := processPayload(context.Background(), body, "req-1", provider); err != nil {
+				t.Fatalf("processPayload() error = %v", err)
+			}
+			if len(provider.GetSentMessages()) != 1 {
+				t.Errorf("Expected the notification to be sent, got %d message(s)", len(provider.GetSentMessages()))
+			}
+			var after dto.Metric
+			payloadVersionsReceived.WithLabelValues(tt.wantLabel).Write(&after)
+			if got := after.GetCounter().GetValue() - before.GetCounter().GetValue(); got != 1 {
+				t.Errorf("payload versions{version=%q} increased by %v, want 1", tt.wantLabel, got)
+			}
+		})
+	}
+}
+
+func TestProviderDurationExemplar(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer server.Close()
+
+	provider, err := NewGoogleChatProvider(server.URL, 0, OutboundConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	defer span.End()
+	traceID := span.SpanContext().TraceID().String()
+	if err := provider.Send(ctx, &GoogleChatMessage{Text: "hello"}, SendOptions{ReqID: "req-1"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("Expected outbound traceparent for trace %s, got %q", traceID, traceparent)
+	}
+
+	var m dto.Metric
+	if err := providerRequestDuration.WithLabelValues("google_chat", statusSuccess).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, b := range m.GetHistogram().GetBucket() {
+		for _, l := range b.GetExemplar().GetLabel() {
+			if l.GetName() == "trace_id" && l.GetValue() == traceID {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected an exemplar with trace_id %s", traceID)
+	}
+}
+
+type statusProvider int
+
+func (p statusProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error {
+	return &HTTPStatusError{StatusCode: int(p)}
+}
+
+func TestAlertsDroppedReasons(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	defer func() { outbox = NewOutbox("") }()
+
+	valid := `{"version":"4","status":"firing","receiver":"ops","groupKey":"{}:{}","alerts":[{"status":"firing","labels":{"alertname":"TestAlert"},"startsAt":"2024-01-01T00:00:00Z"}]}`
+	two := `{"version":"4","status":"firing","receiver":"ops","groupKey":"{}:{}","alerts":[{"status":"firing","labels":{"alertname":"TestAlert","team":"db"},"startsAt":"2024-01-01T00:00:00Z"},{"status":"firing","labels":{"alertname":"TestAlert","team":"web"},"startsAt":"2024-01-01T00:00:00Z"}]}`
+	silenced, err := NewSilences([]SilenceConfig{{Matchers: []string{`team="db"`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := NewOutbox("")
+	full.Enqueue("req-0", defaultRouteName, outboxPayload("Queued"), &GoogleChatMessage{}, time.Now())
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		provider    Provider
+		config      Config
+		silences    []*Silence
+		route       *Route
+		outbox      *Outbox
+		reason      string
+		count       float64
+		status      int
+	}{
+		{name: "bad content type", contentType: "text/plain", body: valid, reason: dropBadContentType, status: http.StatusBadRequest},
+		{name: "empty body", body: "", reason: dropParseError, status: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{"status":`, reason: dropParseError, status: http.StatusBadRequest},
+		{name: "schema violation", body: `{"status":"firing"}`, reason: dropValidationFailed, status: http.StatusBadRequest},
+		{name: "rate limited by Chat", body: valid, provider: statusProvider(http.StatusTooManyRequests), reason: dropRateLimited, status: http.StatusInternalServerError},
+		{name: "counted per alert", body: two, provider: statusProvider(http.StatusTooManyRequests), reason: dropRateLimited, count: 2, status: http.StatusInternalServerError},
+		{name: "silenced", body: two, silences: silenced, reason: dropSilenced, status: http.StatusOK},
+		{name: "chat disabled", body: two, route: &Route{Name: defaultRouteName, DisableChat: true}, reason: dropChatDisabled, count: 2, status: http.StatusOK},
+		{
+			name:   "outbox full",
+			body:   valid,
+			config: Config{Outbox: OutboxConfig{Enabled: true, MaxMessages: 1}},
+			outbox: full,
+			reason: dropQueueFull,
+			status: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentRuntime.Store(&Runtime{Config: tt.config, Silences: tt.silences, DefaultRoute: tt.route})
+			if tt.outbox != nil {
+				outbox = tt.outbox
+			}
+			provider := tt.provider
+			if provider == nil {
+				provider = NewMockProvider(false)
+			}
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+
+			var before dto.Metric
+			alertsDropped.WithLabelValues(tt.reason).Write(&before)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+			handleWebhookWithProvider(rec, req, provider)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			var after dto.Metric
+			alertsDropped.WithLabelValues(tt.reason).Write(&after)
+			count := tt.count
+			if count == 0 {
+				count = 1
+			}
+			if got := after.GetCounter().GetValue() - before.GetCounter().GetValue(); got != count {
+				t.Errorf("Expected %v drop(s) with reason %s, got %v", count, tt.reason, got)
+			}
+		})
+	}
+}
+
+func TestAlertsCountedOnce(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+
+	body := `{"version":"4","status":"firing","receiver":"ops","groupKey":"{}:{}","commonLabels":{"team":"db"},"alerts":[{"status":"firing","labels":{"alertname":"DiskFull","team":"db","host":"a"},"startsAt":"2024-01-01T00:00:00Z"},{"status":"firing","labels":{"alertname":"DiskFull","team":"db","host":"b"},"startsAt":"2024-01-01T00:00:00Z"}]}`
+	tests := []struct {
+		name    string
+		db      RouteConfig
+		sent    float64
+		dropped float64
+	}{
+		{name: "sent on both routes", db: RouteConfig{Name: "db", Matchers: []string{`team="db"`}}, sent: 2},
+		{name: "dropped on the second route", db: RouteConfig{Name: "db", Matchers: []string{`team="db"`}, DisableChat: true}, sent: 2},
+		{name: "dropped on the first route", db: RouteConfig{Name: "db", Matchers: []string{`team="db"`}, DisableChat: true, Continue: true}, dropped: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := []RouteConfig{{Name: "audit", Matchers: []string{`team="db"`}, Continue: true}, tt.db}
+			if tt.db.Continue {
+				routes = []RouteConfig{tt.db, {Name: "audit", Matchers: []string{`team="db"`}, DisableChat: true}}
+			}
+			rt, err := NewRuntime(Config{Routes: routes})
+			if err != nil {
+				t.Fatalf("NewRuntime() error = %v", err)
+			}
+			for _, r := range rt.Routes {
+				r.Provider = NewMockProvider(false)
+			}
+			currentRuntime.Store(rt)
+
+			counters := []prometheus.Counter{alertsReceived.WithLabelValues("firing"), alertsSent.WithLabelValues("firing"), alertsDropped.WithLabelValues(dropChatDisabled)}
+			values := func() []float64 {
+				var values []float64
+				for _, c := range counters {
+					var m dto.Metric
+					c.Write(&m)
+					values = append(values, m.GetCounter().GetValue())
+				}
+				return values
+			}
+			before := values()
+			if err := processPayload(context.Background(), []byte(body), "req", NewMockProvider(false)); err != nil {
+				t.Fatalf("processPayload() error = %v", err)
+			}
+			after := values()
+
+			if got := after[0] - before[0]; got != 2 {
+				t.Errorf("Expected 2 alerts received, got %v", got)
+			}
+			if got := after[1] - before[1]; got != tt.sent {
+				t.Errorf("Expected %v alerts sent, got %v", tt.sent, got)
+			}
+			if got := after[2] - before[2]; got != tt.dropped {
+				t.Errorf("Expected %v alerts dropped, got %v", tt.dropped, got)
+			}
+		})
+	}
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if err := registerMetrics(reg); err != nil {
+		t.Fatalf("registerMetrics() error = %v", err)
+	}
+	if err := registerMetrics(reg); err != nil {
+		t.Errorf("registerMetrics() again error = %v", err)
+	}
+
+	alertsDropped.WithLabelValues(dropFiltered)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range families {
+		if f.GetName() == "alertmanager_gchat_alerts_dropped_total" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected the custom registry to gather the bridge's metrics")
+	}
+
+	host := prometheus.NewRegistry()
+	host.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "alertmanager_gchat_alerts_sent_total", Help: "Host counter"}))
+	if err := registerMetrics(host); err == nil || !strings.Contains(err.Error(), "alertmanager_gchat_alerts_sent_total") {
+		t.Errorf("registerMetrics() error = %v, want a conflict on alertmanager_gchat_alerts_sent_total", err)
+	}
+}
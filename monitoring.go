@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// metricDesc is the name and variable labels of one of the bridge's
+// metrics. It is recorded when the collector is created, so generated rules
+// and dashboards always match what /metrics exposes.
+type metricDesc struct {
+	Name   string
+	Labels []string
+}
+
+// describeMetric returns the name and variable labels c was created with.
+func describeMetric(c prometheus.Collector) metricDesc {
+	metricDescsMu.Lock()
+	defer metricDescsMu.Unlock()
+	return metricDescs[c]
+}
+
+// selector returns the series selector for m with the given matchers,
+// skipping empty ones.
+func (m metricDesc) selector(suffix string, matchers ...string) string {
+	var ms []string
+	for _, matcher := range matchers {
+		if matcher != "" {
+			ms = append(ms, matcher)
+		}
+	}
+	if len(ms) == 0 {
+		return m.Name + suffix
+	}
+	return m.Name + suffix + "{" + strings.Join(ms, ",") + "}"
+}
+
+type ruleGroups struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string      `yaml:"name"`
+	Rules []alertRule `yaml:"rules"`
+}
+
+type alertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// monitoringRules returns alerting rules for the bridge itself. job, when
+// set, restricts every expression to that scrape job and adds a rule for
+// the bridge being down.
+func monitoringRules(job string) ruleGroups {
+	jobMatcher := ""
+	if job != "" {
+		jobMatcher = fmt.Sprintf("job=%q", job)
+	}
+	rule := func(name, expr, duration, severity, summary, description string) alertRule {
+		return alertRule{
+			Alert:       name,
+			Expr:        expr,
+			For:         duration,
+			Labels:      map[string]string{"severity": severity},
+			Annotations: map[string]string{"summary": summary, "description": description},
+		}
+	}
+
+	var rules []alertRule
+	if job != "" {
+		rules = append(rules, rule("AlertmanagerGChatDown", fmt.Sprintf("up{%s} == 0", jobMatcher), "5m", "critical",
+			"The AlertManager to Google Chat bridge is down",
+			"{{ $labels.instance }} has not been scraped successfully for 5 minutes, so alerts may not reach Google Chat."))
+	}
+
+	providerErrs := describeMetric(providerErrors)
+	dropped := describeMetric(alertsDropped)
+	requestDuration := describeMetric(providerRequestDuration)
+	outbox := describeMetric(outboxSize)
+	outboxDrops := describeMetric(outboxDropped)
+	outboxAge := describeMetric(outboxOldestAge)
+	reloads := describeMetric(configReloads)
+	enrichment := describeMetric(enrichmentFailures)
+	failing := describeMetric(destinationFailures)
+	slo := describeMetric(notifySLOAlerts)
+
+	rules = append(rules,
+		rule("AlertmanagerGChatDeliveryErrors",
+			fmt.Sprintf("sum by (provider) (rate(%s[5m])) > 0", providerErrs.selector("", jobMatcher)), "10m", "warning",
+			"Google Chat deliveries are failing",
+			"The {{ $labels.provider }} provider has returned errors for 10 minutes."),
+		rule("AlertmanagerGChatNotificationsDropped",
+			fmt.Sprintf("sum by (reason) (increase(%s[15m])) > 0", dropped.selector("", jobMatcher, `reason!~"`+strings.Join(intentionalDropReasons, "|")+`"`)), "", "warning",
+			"Alerts were dropped before reaching Google Chat",
+			"{{ $value }} alert(s) were dropped in the last 15 minutes with reason {{ $labels.reason }}."),
+		rule("AlertmanagerGChatSlowDelivery",
+			fmt.Sprintf("histogram_quantile(0.99, sum by (le, provider) (rate(%s[5m]))) > 5", requestDuration.selector("_bucket", jobMatcher)), "15m", "warning",
+			"Google Chat deliveries are slow",
+			"99th percentile request time of the {{ $labels.provider }} provider is {{ $value | humanizeDuration }}."),
+		rule("AlertmanagerGChatDestinationFailing",
+			fmt.Sprintf("max by (route, destination) (%s) >= 3", failing.selector("", jobMatcher)), "10m", "warning",
+			"Deliveries to a Google Chat destination keep failing",
+			"The last {{ $value }} attempts to deliver to {{ $labels.destination }} failed. See /health for the last error."),
+		rule("AlertmanagerGChatOutboxBacklog",
+			fmt.Sprintf("max(%s) > 100", outbox.selector("", jobMatcher)), "15m", "warning",
+			"The outbox is not draining",
+			"{{ $value }} messages have been waiting for delivery for 15 minutes."),
+		rule("AlertmanagerGChatOutboxStuck",
+			fmt.Sprintf("max(%s) > 600", outboxAge.selector("", jobMatcher)), "5m", "warning",
+			"Outbox messages are not being delivered",
+			"The oldest outbox message has been waiting for {{ $value | humanizeDuration }}."),
+		rule("AlertmanagerGChatOutboxDropped",
+			fmt.Sprintf("sum(increase(%s[15m])) > 0", outboxDrops.selector("", jobMatcher)), "", "critical",
+			"Outbox messages were dropped undelivered",
+			"{{ $value }} message(s) were dropped after a permanent error or exceeding max_age."),
+		rule("AlertmanagerGChatConfigReloadFailing",
+			fmt.Sprintf("sum(increase(%s[15m])) > 0", reloads.selector("", jobMatcher, `result="failure"`)), "", "warning",
+			"The bridge configuration failed to reload",
+			"The previous configuration is still in use. Check the bridge logs for the error."),
+		rule("AlertmanagerGChatEnrichmentFailing",
+			fmt.Sprintf("sum by (enricher) (rate(%s[15m])) > 0", enrichment.selector("", jobMatcher)), "30m", "info",
+			"An enrichment step keeps failing",
+			"Notifications have been sent without the {{ $labels.enricher }} enrichment for 30 minutes."),
+		// Fast burn of a 99% time-to-notify objective: at this rate, a
+		// 30-day error budget is gone in about two days.
+		rule("AlertmanagerGChatNotifySLOBurn",
+			fmt.Sprintf("sum(rate(%s[1h])) / sum(rate(%s[1h])) > 14.4 * 0.01", slo.selector("", jobMatcher, `result="missed"`), slo.selector("", jobMatcher)), "5m", "warning",
+			"Alerts are reaching Google Chat too long after they start",
+			"{{ $value | humanizePercentage }} of alerts were first notified after the slo notify_target in the last hour."),
+	)
+	return ruleGroups{Groups: []ruleGroup{{Name: "alertmanager-to-gchat", Rules: rules}}}
+}
+
+type dashboardPanel struct {
+	title string
+	unit  string
+	// query is "rate", "gauge" or "p99".
+	query  string
+	metric prometheus.Collector
+	// by overrides the labels series are summed by, which default to the
+	// metric's labels.
+	by []string
+}
+
+// dashboardPanels are laid out two per row, in order.
+var dashboardPanels = []dashboardPanel{
+	{title: "Alerts received", unit: "ops", query: "rate", metric: alertsReceived},
+	{title: "Alerts sent", unit: "ops", query: "rate", metric: alertsSent},
+	{title: "Alerts dropped", unit: "ops", query: "rate", metric: alertsDropped},
+	{title: "Provider errors", unit: "ops", query: "rate", metric: providerErrors},
+	{title: "Provider request time (p99)", unit: "s", query: "p99", metric: providerRequestDuration, by: []string{"provider"}},
+	{title: "Processing time (p99)", unit: "s", query: "p99", metric: alertProcessingDuration, by: []string{"phase"}},
+	{title: "Sends throttled by rate_limit", unit: "ops", query: "rate", metric: sendsThrottled},
+	{title: "Consecutive failures by destination", unit: "short", query: "gauge", metric: destinationFailures, by: []string{"destination"}},
+	{title: "Outbox messages", unit: "short", query: "gauge", metric: outboxSize},
+	{title: "Oldest outbox message age", unit: "s", query: "gauge", metric: outboxOldestAge},
+	{title: "Outbox messages dropped", unit: "ops", query: "rate", metric: outboxDropped},
+	{title: "Card fallbacks", unit: "ops", query: "rate", metric: cardFallbacks},
+	{title: "Alert storms", unit: "ops", query: "rate", metric: alertStorms},
+	{title: "Enrichment failures", unit: "ops", query: "rate", metric: enrichmentFailures},
+	{title: "Configuration reloads", unit: "ops", query: "rate", metric: configReloads},
+	{title: "Time to notify (p99)", unit: "s", query: "p99", metric: timeToNotify},
+	{title: "Receipt to notify (p99)", unit: "s", query: "p99", metric: receiptToNotify},
+}
+
+// monitoringDashboard returns a Grafana dashboard of the bridge's metrics,
+// restricted to job when it is set.
+func monitoringDashboard(job string) map[string]any {
+	jobMatcher := ""
+	if job != "" {
+		jobMatcher = fmt.Sprintf("job=%q", job)
+	}
+
+	var panels []map[string]any
+	for i, p := range dashboardPanels {
+		m := describeMetric(p.metric)
+		by := p.by
+		if by == nil {
+			by = m.Labels
+		}
+		var expr string
+		switch p.query {
+		case "gauge":
+			expr = fmt.Sprintf("sum%s (%s)", sumBy(by), m.selector("", jobMatcher))
+		case "p99":
+			expr = fmt.Sprintf("histogram_quantile(0.99, sum%s (rate(%s[$__rate_interval])))", sumBy(append([]string{"le"}, by...)), m.selector("_bucket", jobMatcher))
+		default:
+			expr = fmt.Sprintf("sum%s (rate(%s[$__rate_interval]))", sumBy(by), m.selector("", jobMatcher))
+		}
+		var legend []string
+		for _, l := range by {
+			legend = append(legend, "{{"+l+"}}")
+		}
+
+		panels = append(panels, map[string]any{
+			"id":          i + 1,
+			"type":        "timeseries",
+			"title":       p.title,
+			"datasource":  map[string]string{"type": "prometheus", "uid": "${datasource}"},
+			"gridPos":     map[string]int{"x": i % 2 * 12, "y": i / 2 * 8, "w": 12, "h": 8},
+			"fieldConfig": map[string]any{"defaults": map[string]string{"unit": p.unit}, "overrides": []any{}},
+			"targets":     []map[string]string{{"refId": "A", "expr": expr, "legendFormat": strings.Join(legend, " ")}},
+		})
+	}
+
+	return map[string]any{
+		"uid":           "alertmanager-gchat",
+		"title":         "AlertManager to Google Chat",
+		"tags":          []string{"alertmanager-to-gchat"},
+		"schemaVersion": 39,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]any{"list": []map[string]any{
+			{"name": "datasource", "label": "Data source", "type": "datasource", "query": "prometheus"},
+		}},
+		"panels": panels,
+	}
+}
+
+func sumBy(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return " by (" + strings.Join(labels, ", ") + ")"
+}
+
+// monitoringRulesHandler serves a Prometheus rules file for alerting on the
+// bridge itself.
+func monitoringRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := yaml.Marshal(monitoringRules(r.URL.Query().Get("job")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+// monitoringDashboardHandler serves a Grafana dashboard of the bridge's
+// metrics, ready to import.
+func monitoringDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(monitoringDashboard(r.URL.Query().Get("job")))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDescribeMetric(t *testing.T) {
+	tests := []struct {
+		collector prometheus.Collector
+		want      metricDesc
+	}{
+		{alertsSent, metricDesc{Name: "alertmanager_gchat_alerts_sent_total", Labels: []string{"status"}}},
+		{alertProcessingDuration, metricDesc{Name: "alertmanager_gchat_processing_duration_seconds", Labels: []string{"phase", "route", "status"}}},
+		{outboxSize, metricDesc{Name: "alertmanager_gchat_outbox_messages"}},
+	}
+	for _, tt := range tests {
+		if got := describeMetric(tt.collector); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("describeMetric() = %+v, want %+v", got, tt.want)
+		}
+	}
+}
+
+func TestMonitoringRulesHandler(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantDown bool
+		wantExpr string
+	}{
+		{query: "", wantExpr: `sum by (provider) (rate(alertmanager_gchat_provider_errors_total[5m])) > 0`},
+		{query: "?job=a2g", wantDown: true, wantExpr: `sum by (provider) (rate(alertmanager_gchat_provider_errors_total{job="a2g"}[5m])) > 0`},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		monitoringRulesHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/monitoring/rules"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("rules%s status = %d", tt.query, w.Code)
+		}
+
+		var rules ruleGroups
+		if err := yaml.Unmarshal(w.Body.Bytes(), &rules); err != nil {
+			t.Fatalf("rules%s do not decode: %v", tt.query, err)
+		}
+		exprs := map[string]string{}
+		for _, rule := range rules.Groups[0].Rules {
+			if rule.Labels["severity"] == "" || rule.Annotations["summary"] == "" {
+				t.Errorf("rule %s has no severity or summary", rule.Alert)
+			}
+			exprs[rule.Alert] = rule.Expr
+		}
+		if got := exprs["AlertmanagerGChatDeliveryErrors"]; got != tt.wantExpr {
+			t.Errorf("rules%s delivery errors expr = %s, want %s", tt.query, got, tt.wantExpr)
+		}
+		if _, ok := exprs["AlertmanagerGChatDown"]; ok != tt.wantDown {
+			t.Errorf("rules%s down rule = %v, want %v", tt.query, ok, tt.wantDown)
+		}
+	}
+}
+
+func TestMonitoringDashboardHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	monitoringDashboardHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/monitoring/dashboard?job=a2g", nil))
+
+	var dashboard struct {
+		Panels []struct {
+			Title   string `json:"title"`
+			Targets []struct {
+				Expr         string `json:"expr"`
+				LegendFormat string `json:"legendFormat"`
+			} `json:"targets"`
+		} `json:"panels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &dashboard); err != nil {
+		t.Fatalf("dashboard does not decode: %v", err)
+	}
+	if len(dashboard.Panels) != len(dashboardPanels) {
+		t.Fatalf("got %d panels, want %d", len(dashboard.Panels), len(dashboardPanels))
+	}
+	for _, p := range dashboard.Panels {
+		if len(p.Targets) != 1 || !strings.Contains(p.Targets[0].Expr, `{job="a2g"}`) {
+			t.Errorf("panel %s targets = %+v, want a query restricted to the job", p.Title, p.Targets)
+		}
+	}
+	if got := dashboard.Panels[5].Targets[0]; got.Expr != `histogram_quantile(0.99, sum by (le, phase) (rate(alertmanager_gchat_processing_duration_seconds_bucket{job="a2g"}[$__rate_interval])))` || got.LegendFormat != "{{phase}}" {
+		t.Errorf("processing time target = %+v", got)
+	}
+}
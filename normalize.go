@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"unicode/utf8"
+	"unique"
+
+	"github.com/prometheus/common/model"
+)
+
+// Normalizer drops and renames labels before alerts are routed,
+// deduplicated or rendered, so that alerts differing only in labels such as
+// the external labels of HA Prometheus replicas are treated as one.
+type Normalizer struct {
+	// drop holds label name patterns, as in path.Match.
+	drop   []string
+	rename map[string]string
+	// maxLabels, maxAnnotations and maxValueLength are zero when unlimited.
+	maxLabels      int
+	maxAnnotations int
+	maxValueLength int
+}
+
+// NewNormalizer compiles the [normalize] block from the configuration. It
+// returns nil when no labels are dropped, renamed or limited.
+func NewNormalizer(cfg NormalizeConfig) (*Normalizer, error) {
+	if cfg.MaxLabels < 0 || cfg.MaxAnnotations < 0 || cfg.MaxValueLength < 0 {
+		return nil, fmt.Errorf("max_labels, max_annotations and max_value_length must not be negative")
+	}
+	if len(cfg.DropLabels) == 0 && len(cfg.RenameLabels) == 0 &&
+		cfg.MaxLabels == 0 && cfg.MaxAnnotations == 0 && cfg.MaxValueLength == 0 {
+		return nil, nil
+	}
+	for _, pattern := range cfg.DropLabels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid drop_labels pattern %q", pattern)
+		}
+	}
+	for from, to := range cfg.RenameLabels {
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("rename_labels entries must not be empty")
+		}
+		if from == "alertname" || to == "alertname" {
+			return nil, fmt.Errorf("alertname cannot be renamed")
+		}
+	}
+	return &Normalizer{
+		drop:           cfg.DropLabels,
+		rename:         cfg.RenameLabels,
+		maxLabels:      cfg.MaxLabels,
+		maxAnnotations: cfg.MaxAnnotations,
+		maxValueLength: cfg.MaxValueLength,
+	}, nil
+}
+
+// limit caps the labels and annotations of payload and the length of
+// their values. What is kept is interned, since the same labels repeat
+// across alerts and requests. The request body is already bounded by
+// [server] max_body_bytes; these limits bound what is kept from it.
+func (n *Normalizer) limit(reqID string, payload *AlertManagerPayload) {
+	var labels, annotations, values int
+	payload.CommonLabels = n.limitKV(payload.CommonLabels, n.maxLabels, &labels, &values)
+	payload.GroupLabels = n.limitKV(payload.GroupLabels, n.maxLabels, &labels, &values)
+	payload.CommonAnnotations = n.limitKV(payload.CommonAnnotations, n.maxAnnotations, &annotations, &values)
+	for i := range payload.Alerts {
+		alert := &payload.Alerts[i]
+		alert.Labels = n.limitKV(alert.Labels, n.maxLabels, &labels, &values)
+		alert.Annotations = n.limitKV(alert.Annotations, n.maxAnnotations, &annotations, &values)
+	}
+	if labels+annotations+values == 0 {
+		return
+	}
+	logger.Info("[%s] Label limits dropped %d label(s) and %d annotation(s), and shortened %d value(s)", reqID, labels, annotations, values)
+	for kind, count := range map[string]int{"labels": labels, "annotations": annotations, "values": values} {
+		if count > 0 {
+			labelsLimited.WithLabelValues(kind).Add(float64(count))
+		}
+	}
+}
+
+// limitKV returns kv with at most limit entries, keeping alertname and then
+// the first names in order, and with values cut to the maximum length. It
+// adds what it removed to dropped and shortened.
+func (n *Normalizer) limitKV(kv KV, limit int, dropped, shortened *int) KV {
+	if len(kv) == 0 {
+		return kv
+	}
+	if limit > 0 && len(kv) > limit {
+		kept := make(KV, limit)
+		if v, ok := kv["alertname"]; ok {
+			kept["alertname"] = v
+		}
+		for _, p := range kv.SortedPairs() {
+			if len(kept) == limit {
+				break
+			}
+			kept[p.Name] = p.Value
+		}
+		*dropped += len(kv) - len(kept)
+		kv = kept
+	}
+	out := make(KV, len(kv))
+	for k, v := range kv {
+		if n.maxValueLength > 0 && len(v) > n.maxValueLength {
+			v = truncateValue(v, n.maxValueLength)
+			*shortened++
+		}
+		out[unique.Make(k).Value()] = unique.Make(v).Value()
+	}
+	return out
+}
+
+// truncateValue cuts s to at most limit bytes on a rune boundary and marks
+// the cut with an ellipsis.
+func truncateValue(s string, limit int) string {
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit] + "…"
+}
+
+func (n *Normalizer) dropped(name string) bool {
+	if name == "alertname" {
+		return false
+	}
+	for _, pattern := range n.drop {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeKV returns kv with labels dropped and renamed, and whether
+// anything changed.
+func (n *Normalizer) normalizeKV(kv KV) (KV, bool) {
+	changed := false
+	out := make(KV, len(kv))
+	for k, v := range kv {
+		if n.dropped(k) {
+			changed = true
+		} else if _, ok := n.rename[k]; !ok {
+			out[k] = v
+		}
+	}
+	// Renamed labels replace labels that already had the new name.
+	for from, to := range n.rename {
+		if v, ok := kv[from]; ok && !n.dropped(from) {
+			out[to] = v
+			changed = true
+		}
+	}
+	return out, changed
+}
+
+// Apply normalizes the labels of payload in place. Alerts whose fingerprint
+// depended on a changed label get the fingerprint AlertManager would give
+// their new labels, and alerts that become identical are merged, keeping a
+// firing one over a resolved one and the earliest start. Label limits are
+// applied last, to the labels left after dropping and renaming, and leave
+// fingerprints unchanged.
+func (n *Normalizer) Apply(reqID string, payload *AlertManagerPayload) {
+	if n == nil {
+		return
+	}
+	defer n.limit(reqID, payload)
+	if len(n.drop) == 0 && len(n.rename) == 0 {
+		return
+	}
+	payload.CommonLabels, _ = n.normalizeKV(payload.CommonLabels)
+	payload.GroupLabels, _ = n.normalizeKV(payload.GroupLabels)
+
+	merged := make(Alerts, 0, len(payload.Alerts))
+	index := map[string]int{}
+	for _, alert := range payload.Alerts {
+		labels, changed := n.normalizeKV(alert.Labels)
+		alert.Labels = labels
+		if changed {
+			alert.Fingerprint = labelFingerprint(labels)
+		}
+
+		key := alertKey(alert)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, alert)
+			continue
+		}
+		kept := &merged[i]
+		startsAt := kept.StartsAt
+		if alert.StartsAt.Before(startsAt) || startsAt.IsZero() {
+			startsAt = alert.StartsAt
+		}
+		if kept.Status != "firing" && alert.Status == "firing" {
+			*kept = alert
+		}
+		kept.StartsAt = startsAt
+	}
+	if dup := len(payload.Alerts) - len(merged); dup > 0 {
+		logger.Debug("[%s] Merged %d alert(s) identical after label normalization", reqID, dup)
+	}
+	payload.Alerts = merged
+}
+
+// labelFingerprint returns the fingerprint AlertManager computes for an
+// alert with labels.
+func labelFingerprint(labels KV) string {
+	set := make(model.LabelSet, len(labels))
+	for k, v := range labels {
+		set[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return set.Fingerprint().String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestNormalizerApply(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	n, err := NewNormalizer(NormalizeConfig{
+		DropLabels:   []string{"replica", "prometheus_replica", "__*"},
+		RenameLabels: map[string]string{"cluster_name": "cluster"},
+	})
+	if err != nil {
+		t.Fatalf("NewNormalizer() error = %v", err)
+	}
+
+	start := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	payload := &AlertManagerPayload{
+		CommonLabels: KV{"alertname": "DiskFull", "cluster_name": "eu-1"},
+		GroupLabels:  KV{"alertname": "DiskFull", "__tenant": "a"},
+		Alerts: Alerts{
+			{Status: "resolved", Fingerprint: "aaa", StartsAt: start, Labels: KV{"alertname": "DiskFull", "instance": "db-1", "replica": "a", "cluster_name": "eu-1"}},
+			{Status: "firing", Fingerprint: "bbb", StartsAt: start.Add(time.Minute), Labels: KV{"alertname": "DiskFull", "instance": "db-1", "replica": "b", "cluster_name": "eu-1"}},
+			{Status: "firing", Fingerprint: "ccc", StartsAt: start, Labels: KV{"alertname": "DiskFull", "instance": "db-2", "prometheus_replica": "a", "cluster_name": "eu-1"}},
+			{Status: "firing", Fingerprint: "ddd", StartsAt: start, Labels: KV{"alertname": "HighCPU", "instance": "db-2"}},
+		},
+	}
+	n.Apply("test", payload)
+
+	if want := (KV{"alertname": "DiskFull", "cluster": "eu-1"}); !maps.Equal(payload.CommonLabels, want) {
+		t.Errorf("common labels = %v, want %v", payload.CommonLabels, want)
+	}
+	if want := (KV{"alertname": "DiskFull"}); !maps.Equal(payload.GroupLabels, want) {
+		t.Errorf("group labels = %v, want %v", payload.GroupLabels, want)
+	}
+	if len(payload.Alerts) != 3 {
+		t.Fatalf("got %d alerts, want the replicas merged into 3", len(payload.Alerts))
+	}
+
+	merged := payload.Alerts[0]
+	if want := (KV{"alertname": "DiskFull", "instance": "db-1", "cluster": "eu-1"}); !maps.Equal(merged.Labels, want) {
+		t.Errorf("merged labels = %v, want %v", merged.Labels, want)
+	}
+	if merged.Status != "firing" || !merged.StartsAt.Equal(start) {
+		t.Errorf("merged alert = %s since %v, want firing since the earliest start", merged.Status, merged.StartsAt)
+	}
+	if merged.Fingerprint != labelFingerprint(merged.Labels) || merged.Fingerprint == "bbb" {
+		t.Errorf("merged fingerprint = %s, want one computed from the normalized labels", merged.Fingerprint)
+	}
+	if payload.Alerts[2].Fingerprint != "ddd" {
+		t.Errorf("unchanged alert fingerprint = %s, want it kept", payload.Alerts[2].Fingerprint)
+	}
+
+	for _, cfg := range []NormalizeConfig{
+		{DropLabels: []string{"["}},
+		{RenameLabels: map[string]string{"alertname": "name"}},
+		{MaxLabels: -1},
+	} {
+		if _, err := NewNormalizer(cfg); err == nil {
+			t.Errorf("NewNormalizer(%+v) error = nil, want an error", cfg)
+		}
+	}
+}
+
+func TestNormalizerLimits(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	n, err := NewNormalizer(NormalizeConfig{MaxLabels: 3, MaxAnnotations: 1, MaxValueLength: 5})
+	if err != nil {
+		t.Fatalf("NewNormalizer() error = %v", err)
+	}
+
+	labels := KV{"alertname": "ZZZ", "severity": "critical"}
+	for i := range 1000 {
+		labels[fmt.Sprintf("label_%04d", i)] = "x"
+	}
+	payload := &AlertManagerPayload{
+		CommonLabels:      KV{"alertname": "ZZZ"},
+		CommonAnnotations: KV{"description": "abcd€ and more", "summary": "short"},
+		Alerts: Alerts{
+			{Status: "firing", Fingerprint: "aaa", Labels: labels},
+			{Status: "firing", Fingerprint: "aaa", Labels: KV{"alertname": "ZZZ"}},
+		},
+	}
+	n.Apply("test", payload)
+
+	if want := (KV{"alertname": "ZZZ", "label_0000": "x", "label_0001": "x"}); !maps.Equal(payload.Alerts[0].Labels, want) {
+		t.Errorf("labels = %v, want %v", payload.Alerts[0].Labels, want)
+	}
+	if want := (KV{"description": "abcd…"}); !maps.Equal(payload.CommonAnnotations, want) {
+		t.Errorf("annotations = %v, want %v", payload.CommonAnnotations, want)
+	}
+	if len(payload.Alerts) != 2 || payload.Alerts[0].Fingerprint != "aaa" {
+		t.Errorf("got %d alerts with fingerprint %s, want limits alone to leave alerts unmerged and unchanged", len(payload.Alerts), payload.Alerts[0].Fingerprint)
+	}
+}
+
+func TestNormalizerLimitsAfterDrop(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	n, err := NewNormalizer(NormalizeConfig{DropLabels: []string{"label_00*"}, RenameLabels: map[string]string{"label_0200": "aaa"}, MaxLabels: 3})
+	if err != nil {
+		t.Fatalf("NewNormalizer() error = %v", err)
+	}
+
+	labels := KV{"alertname": "ZZZ"}
+	for i := range 1000 {
+		labels[fmt.Sprintf("label_%04d", i)] = "x"
+	}
+	payload := &AlertManagerPayload{Alerts: Alerts{{Status: "firing", Labels: labels}}}
+	n.Apply("test", payload)
+
+	// Dropped labels do not use up the limit, and renamed labels are
+	// ordered by their new name.
+	if want := (KV{"alertname": "ZZZ", "aaa": "x", "label_0100": "x"}); !maps.Equal(payload.Alerts[0].Labels, want) {
+		t.Errorf("labels = %v, want %v", payload.Alerts[0].Labels, want)
+	}
+}
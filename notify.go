@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// receiverNotify is the receiver of payloads posted to the notify API.
+const receiverNotify = "notify"
+
+// NotifyRequest is the body of POST /api/v1/notify: an operational notice
+// from a script, without the AlertManager envelope.
+type NotifyRequest struct {
+	Title    string       `json:"title"`
+	Severity string       `json:"severity"`
+	Text     string       `json:"text"`
+	Links    []NotifyLink `json:"links"`
+	// Route sends the notice to the named route instead of the first one
+	// matching its labels.
+	Route  string `json:"route"`
+	Labels KV     `json:"labels"`
+}
+
+type NotifyLink struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// Validate checks the request against the configured route names.
+func (n NotifyRequest) Validate(routes []*Route) error {
+	if strings.TrimSpace(n.Title) == "" {
+		return fmt.Errorf("title is required")
+	}
+	for _, link := range n.Links {
+		if linkSlug(link.Text) == "" {
+			return fmt.Errorf("link %q needs a text", link.URL)
+		}
+		u, err := url.Parse(link.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("link %q must be an http or https URL", link.Text)
+		}
+	}
+	if n.Route != "" && n.Route != defaultRouteName {
+		for _, r := range routes {
+			if r.Name == n.Route {
+				return nil
+			}
+		}
+		return fmt.Errorf("route %s does not exist", n.Route)
+	}
+	return nil
+}
+
+// linkSlug turns a link text such as "Change request" into the suffix of
+// its link annotation, "change_request".
+func linkSlug(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "_")
+}
+
+// Payload turns the request into a firing AlertManager payload with a
+// single alert, named after the title. Links become link annotations, and
+// so buttons, unless link buttons are disabled.
+func (n NotifyRequest) Payload(linkPrefix string) *AlertManagerPayload {
+	labels := KV{}
+	for k, v := range n.Labels {
+		labels[k] = v
+	}
+	labels["alertname"] = n.Title
+	severity := strings.ToLower(n.Severity)
+	if severity == "" {
+		severity = "info"
+	}
+	labels["severity"] = severity
+
+	annotations := KV{}
+	if n.Text != "" {
+		annotations["summary"] = n.Text
+	}
+	if linkPrefix != "" {
+		for _, link := range n.Links {
+			annotations[linkPrefix+linkSlug(link.Text)] = link.URL
+		}
+	}
+
+	return &AlertManagerPayload{
+		Version:  defaultPayloadVersion,
+		Receiver: receiverNotify,
+		Status:   "firing",
+		Alerts: Alerts{{
+			Status:      "firing",
+			Labels:      labels,
+			Annotations: annotations,
+			StartsAt:    clock.Now().UTC(),
+		}},
+		GroupLabels:       KV{"alertname": n.Title},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+	}
+}
+
+type forcedRouteKey struct{}
+
+// withForcedRoute makes processPayload send to the named route, skipping
+// route matching.
+func withForcedRoute(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, forcedRouteKey{}, name)
+}
+
+func forcedRoute(ctx context.Context) string {
+	name, _ := ctx.Value(forcedRouteKey{}).(string)
+	return name
+}
+
+// notifyHandler accepts a NotifyRequest from a script holding the notify
+// credentials and runs it through the webhook pipeline as a one-alert
+// payload. The endpoint answers 404 until credentials are configured.
+func notifyHandler(provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := newRequestID("notify")
+		w.Header().Set("X-Request-Id", reqID)
+
+		rt := getRuntime()
+		auth := rt.Config.Notify.Auth
+		if !rt.Config.Notify.enabled() {
+			http.Error(w, "Notify API is not enabled", http.StatusNotFound)
+			return
+		}
+		ok, err := auth.authorized(r)
+		if err != nil {
+			logger.Error("[%s] Notify API: failed to read credentials: %v", reqID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			logger.Error("[%s] Notify API: rejected unauthenticated request from %s", reqID, r.RemoteAddr)
+			if auth.BasicAuth.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="alertmanager-to-gchat"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		logger.Info("[%s] Received notify request from %s", reqID, r.RemoteAddr)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+			dropAlerts(dropBadContentType, 1)
+			http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("[%s] Error reading request body: %v", reqID, err)
+			status, msg := bodyReadError(err)
+			http.Error(w, msg, status)
+			return
+		}
+		defer r.Body.Close()
+
+		var notice NotifyRequest
+		if err := json.Unmarshal(body, &notice); err != nil {
+			dropAlerts(dropParseError, 1)
+			http.Error(w, "Invalid notify request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := notice.Validate(rt.Routes); err != nil {
+			dropAlerts(dropValidationFailed, 1)
+			http.Error(w, "Invalid notify request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload, err := json.Marshal(notice.Payload(rt.Config.GoogleChat.LinkAnnotationPrefix))
+		if err != nil {
+			http.Error(w, "Error converting notify request", http.StatusInternalServerError)
+			return
+		}
+
+		// The key is taken from the request, not the converted payload,
+		// which carries the time it was received.
+		key := idempotencyKey(r, body)
+		duplicate, err := processOnce(withForcedRoute(r.Context(), notice.Route), key, payload, reqID, provider)
+		status, msg := processResult(reqID, duplicate, err)
+		if status != http.StatusOK {
+			http.Error(w, msg, status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, msg)
+	}
+}
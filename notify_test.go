@@ -0,0 +1,111 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotifyRequestPayload(t *testing.T) {
+	notice := NotifyRequest{
+		Title:    "Deploy started",
+		Severity: "Warning",
+		Text:     "Rolling out api v2",
+		Links:    []NotifyLink{{Text: "Change request", URL: "https://jira.example.com/browse/CHG-1"}},
+		Labels:   KV{"team": "ops", "alertname": "ignored"},
+	}
+
+	tests := []struct {
+		prefix          string
+		wantAnnotations KV
+	}{
+		{prefix: "link_", wantAnnotations: KV{"summary": "Rolling out api v2", "link_change_request": "https://jira.example.com/browse/CHG-1"}},
+		{prefix: "", wantAnnotations: KV{"summary": "Rolling out api v2"}},
+	}
+	for _, tt := range tests {
+		payload := notice.Payload(tt.prefix)
+		if len(payload.Alerts) != 1 || payload.Status != "firing" || payload.Receiver != receiverNotify {
+			t.Fatalf("Payload(%q) = %+v, want one firing alert", tt.prefix, payload)
+		}
+		wantLabels := KV{"alertname": "Deploy started", "severity": "warning", "team": "ops"}
+		if got := payload.Alerts[0].Labels; !maps.Equal(got, wantLabels) {
+			t.Errorf("Payload(%q) labels = %v, want %v", tt.prefix, got, wantLabels)
+		}
+		if got := payload.Alerts[0].Annotations; !maps.Equal(got, tt.wantAnnotations) {
+			t.Errorf("Payload(%q) annotations = %v, want %v", tt.prefix, got, tt.wantAnnotations)
+		}
+	}
+
+	if got := (NotifyRequest{Title: "Maintenance"}).Payload("link_").CommonLabels["severity"]; got != "info" {
+		t.Errorf("default severity = %q, want info", got)
+	}
+}
+
+func TestNotifyHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	matchers, err := ParseMatchers([]string{`severity="critical"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer currentRuntime.Store(nil)
+
+	tests := []struct {
+		name        string
+		method      string
+		token       string
+		body        string
+		disabled    bool
+		wantStatus  int
+		wantOps     int
+		wantNotices int
+	}{
+		{name: "matching route", method: http.MethodPost, token: "secret", body: `{"title":"Deploy started","text":"api v2"}`, wantStatus: http.StatusOK, wantOps: 1},
+		{name: "named route", method: http.MethodPost, token: "secret", body: `{"title":"Deploy started","route":"notices"}`, wantStatus: http.StatusOK, wantNotices: 1},
+		{name: "unknown route", method: http.MethodPost, token: "secret", body: `{"title":"Deploy started","route":"missing"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing title", method: http.MethodPost, token: "secret", body: `{"text":"api v2"}`, wantStatus: http.StatusBadRequest},
+		{name: "bad link", method: http.MethodPost, token: "secret", body: `{"title":"Deploy","links":[{"text":"Run","url":"javascript:alert(1)"}]}`, wantStatus: http.StatusBadRequest},
+		{name: "wrong token", method: http.MethodPost, token: "guess", body: `{"title":"Deploy started"}`, wantStatus: http.StatusUnauthorized},
+		{name: "invalid method", method: http.MethodGet, token: "secret", wantStatus: http.StatusMethodNotAllowed},
+		{name: "not enabled", method: http.MethodPost, token: "secret", body: `{"title":"Deploy started"}`, disabled: true, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := NewMockProvider(false)
+			notices := NewMockProvider(false)
+			rt := &Runtime{
+				Config: Config{
+					Notify:     NotifyConfig{Auth: InboundAuthConfig{BearerToken: "secret"}},
+					GoogleChat: GoogleChatConfig{LinkAnnotationPrefix: "link_"},
+				},
+				Routes: []*Route{
+					{Name: "notices", Matchers: matchers, Provider: notices},
+					{Name: "ops", Provider: ops},
+				},
+				DefaultRoute: &Route{Name: defaultRouteName},
+			}
+			if tt.disabled {
+				rt.Config.Notify = NotifyConfig{}
+			}
+			currentRuntime.Store(rt)
+
+			req := httptest.NewRequest(tt.method, "/api/v1/notify", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			notifyHandler(NewMockProvider(false))(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := len(ops.GetSentMessages()); got != tt.wantOps {
+				t.Errorf("ops route got %d message(s), want %d", got, tt.wantOps)
+			}
+			if got := len(notices.GetSentMessages()); got != tt.wantNotices {
+				t.Errorf("notices route got %d message(s), want %d", got, tt.wantNotices)
+			}
+		})
+	}
+}
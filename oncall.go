@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	defaultPagerDutyURL = "https://api.pagerduty.com"
+	onCallCacheTTL      = time.Minute
+)
+
+// onCallSource returns the identity (usually an email address) of whoever
+// is on call at a given time.
+type onCallSource interface {
+	OnCall(ctx context.Context, now time.Time) (string, error)
+}
+
+// OnCallResolver mentions the current on-call person on alerts of the
+// configured severities.
+type OnCallResolver struct {
+	source     onCallSource
+	users      map[string]string
+	severities map[string]bool
+
+	mu       sync.Mutex
+	cached   string
+	cachedAt time.Time
+}
+
+// NewOnCallResolver returns nil when no on-call source is configured.
+func NewOnCallResolver(cfg OnCallConfig) (*OnCallResolver, error) {
+	var source onCallSource
+	switch {
+	case cfg.RotaFile != "" && cfg.PagerDuty.ScheduleID != "":
+		return nil, fmt.Errorf("rota_file and pagerduty are mutually exclusive")
+	case cfg.RotaFile != "":
+		rota, err := loadRota(cfg.RotaFile)
+		if err != nil {
+			return nil, err
+		}
+		source = rota
+	case cfg.PagerDuty.ScheduleID != "":
+		pd, err := newPagerDutySchedule(cfg.PagerDuty)
+		if err != nil {
+			return nil, err
+		}
+		source = pd
+	default:
+		return nil, nil
+	}
+
+	severities := map[string]bool{}
+	for _, s := range cfg.Severities {
+		severities[s] = true
+	}
+	return &OnCallResolver{source: source, users: cfg.ChatUsers, severities: severities}, nil
+}
+
+// Mention returns the Chat mention of the on-call person if payload has an
+// alert of a mentioned severity, or "" otherwise. A lookup is abandoned
+// when ctx is done.
+func (r *OnCallResolver) Mention(ctx context.Context, payload *AlertManagerPayload) (string, error) {
+	if r == nil || !r.applies(payload) {
+		return "", nil
+	}
+
+	identity, err := r.current(ctx, clock.Now())
+	if err != nil || identity == "" {
+		return "", err
+	}
+	user := identity
+	if mapped, ok := r.users[identity]; ok {
+		user = mapped
+	}
+	if !strings.HasPrefix(user, "users/") {
+		return "", fmt.Errorf("no Chat user mapped for on-call %s", identity)
+	}
+	return "<" + user + ">", nil
+}
+
+func (r *OnCallResolver) applies(payload *AlertManagerPayload) bool {
+	if payload.Status != "firing" {
+		return false
+	}
+	for _, alert := range payload.Alerts.Firing() {
+		if r.severities[alert.Labels["severity"]] {
+			return true
+		}
+	}
+	return false
+}
+
+// current caches lookups briefly so an alert storm does not hammer the
+// schedule API.
+func (r *OnCallResolver) current(ctx context.Context, now time.Time) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.cachedAt.IsZero() && now.Sub(r.cachedAt) < onCallCacheTTL {
+		return r.cached, nil
+	}
+	identity, err := r.source.OnCall(ctx, now)
+	if err != nil {
+		return "", err
+	}
+	r.cached, r.cachedAt = identity, now
+	return identity, nil
+}
+
+// Rota is a static on-call rotation loaded from a TOML file. Overrides take
+// precedence over the rotation.
+type Rota struct {
+	Start       time.Time      `toml:"start"`
+	ShiftLength time.Duration  `toml:"shift_length"`
+	Rotation    []string       `toml:"rotation"`
+	Overrides   []RotaOverride `toml:"override"`
+}
+
+type RotaOverride struct {
+	User  string    `toml:"user"`
+	Start time.Time `toml:"start"`
+	End   time.Time `toml:"end"`
+}
+
+func loadRota(path string) (*Rota, error) {
+	var rota Rota
+	if _, err := toml.DecodeFile(path, &rota); err != nil {
+		return nil, fmt.Errorf("failed to load rota %s: %v", path, err)
+	}
+	if len(rota.Rotation) > 0 && rota.ShiftLength <= 0 {
+		return nil, fmt.Errorf("rota %s: shift_length must be positive", path)
+	}
+	return &rota, nil
+}
+
+func (r *Rota) OnCall(ctx context.Context, now time.Time) (string, error) {
+	for _, o := range r.Overrides {
+		if !now.Before(o.Start) && now.Before(o.End) {
+			return o.User, nil
+		}
+	}
+	if len(r.Rotation) == 0 || now.Before(r.Start) {
+		return "", nil
+	}
+	shift := int(now.Sub(r.Start) / r.ShiftLength)
+	return r.Rotation[shift%len(r.Rotation)], nil
+}
+
+// pagerDutySchedule looks up the on-call user of a PagerDuty schedule.
+type pagerDutySchedule struct {
+	url        string
+	scheduleID string
+	token      string
+}
+
+func newPagerDutySchedule(cfg PagerDutyOnCallConfig) (*pagerDutySchedule, error) {
+	token := cfg.Token
+	if cfg.TokenFile != "" {
+		data, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PagerDuty token file: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	apiURL := cfg.URL
+	if apiURL == "" {
+		apiURL = defaultPagerDutyURL
+	}
+	return &pagerDutySchedule{url: strings.TrimSuffix(apiURL, "/"), scheduleID: cfg.ScheduleID, token: token}, nil
+}
+
+func (p *pagerDutySchedule) OnCall(ctx context.Context, now time.Time) (string, error) {
+	q := url.Values{}
+	q.Set("schedule_ids[]", p.scheduleID)
+	q.Set("include[]", "users")
+	q.Set("earliest", "true")
+	q.Set("since", now.UTC().Format(time.RFC3339))
+	q.Set("until", now.UTC().Add(time.Second).Format(time.RFC3339))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/oncalls?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+	req.Header.Set("Authorization", "Token token="+p.token)
+
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("PagerDuty on-call lookup failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("PagerDuty on-call lookup failed with status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		OnCalls []struct {
+			EscalationLevel int `json:"escalation_level"`
+			User            struct {
+				Email string `json:"email"`
+			} `json:"user"`
+		} `json:"oncalls"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid PagerDuty response: %v", err)
+	}
+
+	// The first escalation level is the primary on-call.
+	best := ""
+	bestLevel := 0
+	for _, oc := range body.OnCalls {
+		if best == "" || oc.EscalationLevel < bestLevel {
+			best, bestLevel = oc.User.Email, oc.EscalationLevel
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotaOnCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rota.toml")
+	rota := `
+start = 2024-01-01T09:00:00Z
+shift_length = "168h"
+rotation = ["alice@example.com", "bob@example.com"]
+
+[[override]]
+user = "carol@example.com"
+start = 2024-01-03T00:00:00Z
+end = 2024-01-04T00:00:00Z
+`
+	if err := os.WriteFile(path, []byte(rota), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := loadRota(path)
+	if err != nil {
+		t.Fatalf("loadRota() error = %v", err)
+	}
+
+	tests := []struct {
+		now  string
+		want string
+	}{
+		{"2023-12-31T00:00:00Z", ""},
+		{"2024-01-01T09:00:00Z", "alice@example.com"},
+		{"2024-01-03T12:00:00Z", "carol@example.com"},
+		{"2024-01-08T09:00:00Z", "bob@example.com"},
+		{"2024-01-15T10:00:00Z", "alice@example.com"},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		if got, _ := r.OnCall(context.Background(), now); got != tt.want {
+			t.Errorf("OnCall(%s) = %q, want %q", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestOnCallResolverPagerDuty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token token=pd-token" || r.URL.Query().Get("schedule_ids[]") != "PSCHED" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"oncalls":[
+			{"escalation_level":2,"user":{"email":"manager@example.com"}},
+			{"escalation_level":1,"user":{"email":"alice@example.com"}}
+		]}`))
+	}))
+	defer server.Close()
+
+	r, err := NewOnCallResolver(OnCallConfig{
+		Severities: []string{"critical"},
+		PagerDuty:  PagerDutyOnCallConfig{ScheduleID: "PSCHED", Token: "pd-token", URL: server.URL},
+		ChatUsers:  map[string]string{"alice@example.com": "users/1001"},
+	})
+	if err != nil {
+		t.Fatalf("NewOnCallResolver() error = %v", err)
+	}
+
+	critical := &AlertManagerPayload{Status: "firing", Alerts: Alerts{{Status: "firing", Labels: KV{"severity": "critical"}}}}
+	if got, err := r.Mention(context.Background(), critical); err != nil || got != "<users/1001>" {
+		t.Errorf("Mention() = %q, %v; want <users/1001>", got, err)
+	}
+
+	warning := &AlertManagerPayload{Status: "firing", Alerts: Alerts{{Status: "firing", Labels: KV{"severity": "warning"}}}}
+	if got, _ := r.Mention(context.Background(), warning); got != "" {
+		t.Errorf("Expected no mention for warnings, got %q", got)
+	}
+
+	resolved := &AlertManagerPayload{Status: "resolved", Alerts: Alerts{{Status: "resolved", Labels: KV{"severity": "critical"}}}}
+	if got, _ := r.Mention(context.Background(), resolved); got != "" {
+		t.Errorf("Expected no mention for resolved alerts, got %q", got)
+	}
+
+	r.users = nil
+	r.cachedAt = time.Time{}
+	if _, err := r.Mention(context.Background(), critical); err == nil {
+		t.Error("Expected error when the on-call person has no Chat user")
+	}
+
+	if r, err := NewOnCallResolver(OnCallConfig{}); r != nil || err != nil {
+		t.Errorf("NewOnCallResolver() without a source = %v, %v; want nil, nil", r, err)
+	}
+}
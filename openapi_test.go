@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+
+	registered := map[string]bool{}
+	for _, rt := range routes(NewMockProvider(false)) {
+		registered[rt.path] = true
+		if _, ok := spec.Paths[rt.path]; !ok {
+			t.Errorf("Route %s is not documented in the OpenAPI spec", rt.path)
+		}
+	}
+
+	for path := range spec.Paths {
+		if !registered[path] {
+			t.Errorf("OpenAPI spec documents %s but no handler is registered", path)
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	w := httptest.NewRecorder()
+
+	openAPIHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected application/json content type, got %s", ct)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// groupOrderKey identifies the alert group of payload for ordered delivery:
+// AlertManager's group key, or the first alert's fingerprint for sources
+// that do not send one.
+func groupOrderKey(payload *AlertManagerPayload) string {
+	if payload.GroupKey != "" {
+		return payload.GroupKey
+	}
+	if len(payload.Alerts) > 0 {
+		return alertKey(payload.Alerts[0])
+	}
+	return ""
+}
+
+// GroupSerializer lets one request at a time proceed for each key, in the
+// order the requests arrived. It keeps notifications for an alert group in
+// order, e.g. a resolved notification never overtakes the firing one while
+// that is still being retried.
+type GroupSerializer struct {
+	mu sync.Mutex
+	// queues holds the turn of each waiting request by key; the first
+	// turn is the one currently held.
+	queues map[string][]chan struct{}
+}
+
+var groupOrder = NewGroupSerializer()
+
+func NewGroupSerializer() *GroupSerializer {
+	return &GroupSerializer{queues: map[string][]chan struct{}{}}
+}
+
+// Acquire waits until the requests for key that arrived earlier are done.
+// The returned function ends the turn and must be called exactly once. An
+// empty key is not serialized.
+func (s *GroupSerializer) Acquire(ctx context.Context, key string) (func(), error) {
+	if key == "" {
+		return func() {}, nil
+	}
+
+	turn := make(chan struct{})
+	s.mu.Lock()
+	s.queues[key] = append(s.queues[key], turn)
+	first := len(s.queues[key]) == 1
+	s.mu.Unlock()
+
+	release := func() { s.release(key, turn) }
+	if first {
+		return release, nil
+	}
+	select {
+	case <-turn:
+		return release, nil
+	case <-ctx.Done():
+		// The turn may have been handed over while giving up; release
+		// passes it on in that case.
+		s.release(key, turn)
+		return nil, ctx.Err()
+	}
+}
+
+// release removes turn from the queue of key, handing over to the next
+// request when turn was the one held.
+func (s *GroupSerializer) release(key string, turn chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue := s.queues[key]
+	for i, t := range queue {
+		if t != turn {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		if i == 0 && len(queue) > 0 {
+			close(queue[0])
+		}
+		break
+	}
+	if len(queue) == 0 {
+		delete(s.queues, key)
+	} else {
+		s.queues[key] = queue
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupOrderKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload *AlertManagerPayload
+		want    string
+	}{
+		{"group key", &AlertManagerPayload{GroupKey: "{}:{alertname=\"A\"}", Alerts: Alerts{{Fingerprint: "fp"}}}, "{}:{alertname=\"A\"}"},
+		{"fingerprint", &AlertManagerPayload{Alerts: Alerts{{Fingerprint: "fp"}}}, "fp"},
+		{"no alerts", &AlertManagerPayload{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupOrderKey(tt.payload); got != tt.want {
+				t.Errorf("groupOrderKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupSerializerOrder(t *testing.T) {
+	s := NewGroupSerializer()
+	waiting := func(key string) int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.queues[key])
+	}
+
+	release, err := s.Acquire(context.Background(), "group")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	other, err := s.Acquire(context.Background(), "other")
+	if err != nil {
+		t.Fatalf("Expected other groups not to wait, got %v", err)
+	}
+	other()
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, status := range []string{"firing", "resolved", "firing again"} {
+		wg.Add(1)
+		go func(status string) {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), "group")
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, status)
+			mu.Unlock()
+			release()
+		}(status)
+		for waiting("group") != i+2 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	release()
+	wg.Wait()
+	if len(order) != 3 || order[0] != "firing" || order[1] != "resolved" || order[2] != "firing again" {
+		t.Errorf("Expected arrival order, got %v", order)
+	}
+	if len(s.queues) != 0 {
+		t.Errorf("Expected no queues left, got %v", s.queues)
+	}
+}
+
+func TestGroupSerializerCancel(t *testing.T) {
+	s := NewGroupSerializer()
+	release, _ := s.Acquire(context.Background(), "group")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "group"); err == nil {
+		t.Fatal("Expected Acquire to give up when the context is done")
+	}
+
+	release()
+	next, err := s.Acquire(context.Background(), "group")
+	if err != nil {
+		t.Fatalf("Expected the group to be free, got %v", err)
+	}
+	next()
+	if len(s.queues) != 0 {
+		t.Errorf("Expected no queues left, got %v", s.queues)
+	}
+}
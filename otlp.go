@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	otelprom "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	// maxOTLPLogs bounds the log records buffered between exports; the
+	// oldest are dropped first when the collector is unreachable.
+	maxOTLPLogs = 2048
+	// otlpLogInterval is how often buffered log records are exported.
+	otlpLogInterval = 5 * time.Second
+
+	otlpScope = "github.com/jimohabdol/alertmanager-to-gchat"
+)
+
+// logRequestID matches the request ID that prefixes most log lines.
+var logRequestID = regexp.MustCompile(`^\[([^\]\s]+)\] `)
+
+// otlpEndpoint returns the collector's base URL from cfg, the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT variable, or the default local collector.
+func otlpEndpoint(cfg OTLPConfig) string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	if env := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); env != "" {
+		return env
+	}
+	return "http://localhost:4318"
+}
+
+// otlpSignals names what cfg exports, for the startup log.
+func otlpSignals(cfg OTLPConfig) string {
+	switch {
+	case cfg.Metrics && cfg.Logs:
+		return "metrics and logs"
+	case cfg.Metrics:
+		return "metrics"
+	}
+	return "logs"
+}
+
+// otlpLogger forwards the bridge's log lines to an OpenTelemetry logger.
+type otlpLogger struct {
+	logger otellog.Logger
+}
+
+// AddLog emits a log line logged at level. A leading "[request ID]" becomes
+// the request.id attribute.
+func (o *otlpLogger) AddLog(level, message string, at time.Time) {
+	var record otellog.Record
+	record.SetTimestamp(at)
+	record.SetObservedTimestamp(at)
+	record.SetSeverityText(strings.ToUpper(level))
+	switch level {
+	case LogLevelDebug:
+		record.SetSeverity(otellog.SeverityDebug)
+	case LogLevelError:
+		record.SetSeverity(otellog.SeverityError)
+	default:
+		record.SetSeverity(otellog.SeverityInfo)
+	}
+	if m := logRequestID.FindStringSubmatch(message); m != nil {
+		record.AddAttributes(otellog.String("request.id", m[1]))
+		message = message[len(m[0]):]
+	}
+	record.SetBody(otellog.StringValue(message))
+	o.logger.Emit(context.Background(), record)
+}
+
+// countingLogExporter counts the log records it fails to export in
+// otlpLogsDropped.
+type countingLogExporter struct {
+	sdklog.Exporter
+}
+
+func (e countingLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	err := e.Exporter.Export(ctx, records)
+	if err != nil {
+		otlpLogsDropped.Add(float64(len(records)))
+	}
+	return err
+}
+
+// setupOTLP starts exporting the metrics of gatherer and the bridge's log
+// lines over OTLP/HTTP as cfg enables, and returns a function that exports
+// what is left on shutdown. The exporters also honour the standard
+// OTEL_EXPORTER_OTLP_* environment variables for what cfg leaves unset.
+func setupOTLP(cfg OTLPConfig, serviceName string, gatherer prometheus.Gatherer) (func(context.Context) error, error) {
+	if !cfg.Metrics && !cfg.Logs {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// logger.Printf is not exported, unlike Error, so a failing collector
+	// does not feed its own errors back.
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Printf("[ERROR] Error exporting over OTLP: %v", err)
+	}))
+	res := resource.NewSchemaless(attribute.String("service.name", serviceName))
+	ctx := context.Background()
+	var shutdowns []func(context.Context) error
+
+	if cfg.Metrics {
+		opts, err := otlpMetricOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := otlpmetrichttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP metric exporter: %v", err)
+		}
+		reader := sdkmetric.NewPeriodicReader(exporter,
+			sdkmetric.WithInterval(cfg.Interval),
+			sdkmetric.WithProducer(otelprom.NewMetricProducer(otelprom.WithGatherer(gatherer))))
+		provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+		shutdowns = append(shutdowns, provider.Shutdown)
+	}
+
+	if cfg.Logs {
+		opts, err := otlpLogOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := otlploghttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP log exporter: %v", err)
+		}
+		processor := sdklog.NewBatchProcessor(countingLogExporter{exporter},
+			sdklog.WithExportInterval(otlpLogInterval),
+			sdklog.WithMaxQueueSize(maxOTLPLogs))
+		provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(processor), sdklog.WithResource(res))
+		logger.otlp = &otlpLogger{logger: provider.Logger(otlpScope)}
+		shutdowns = append(shutdowns, provider.Shutdown)
+	}
+
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, shutdown := range shutdowns {
+			errs = append(errs, shutdown(ctx))
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// otlpMetricOptions returns the metric exporter options for cfg.
+func otlpMetricOptions(cfg OTLPConfig) ([]otlpmetrichttp.Option, error) {
+	var opts []otlpmetrichttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpointURL(strings.TrimSuffix(cfg.Endpoint, "/")+"/v1/metrics"))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+	}
+	switch cfg.Compression {
+	case otlpGzip:
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+	case otlpNone:
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.NoCompression))
+	}
+	if cfg.TLS.enabled() {
+		transport, err := newTLSTransport(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(transport.TLSClientConfig))
+	}
+	return opts, nil
+}
+
+// otlpLogOptions returns the log exporter options for cfg.
+func otlpLogOptions(cfg OTLPConfig) ([]otlploghttp.Option, error) {
+	var opts []otlploghttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlploghttp.WithEndpointURL(strings.TrimSuffix(cfg.Endpoint, "/")+"/v1/logs"))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlploghttp.WithHeaders(cfg.Headers))
+	}
+	switch cfg.Compression {
+	case otlpGzip:
+		opts = append(opts, otlploghttp.WithCompression(otlploghttp.GzipCompression))
+	case otlpNone:
+		opts = append(opts, otlploghttp.WithCompression(otlploghttp.NoCompression))
+	}
+	if cfg.TLS.enabled() {
+		transport, err := newTLSTransport(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, otlploghttp.WithTLSClientConfig(transport.TLSClientConfig))
+	}
+	return opts, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSetupOTLP(t *testing.T) {
+	defer func(l *Logger) { logger = l }(logger)
+	logger = NewLogger(LogLevelInfo, nil)
+
+	var mu sync.Mutex
+	var metrics colmetricspb.ExportMetricsServiceRequest
+	var logs collogspb.ExportLogsServiceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Content-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(reader)
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/metrics":
+			proto.Unmarshal(body, &metrics)
+		case "/v1/logs":
+			proto.Unmarshal(body, &logs)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_sent_total", Help: "Sent"}, []string{"status"})
+	counter.WithLabelValues("success").Add(3)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds", Help: "Duration", Buckets: []float64{1, 5}})
+	for _, v := range []float64{0.5, 2, 3, 10} {
+		histogram.Observe(v)
+	}
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_queue", Help: "Queue"})
+	gauge.Set(7)
+	registry.MustRegister(counter, histogram, gauge)
+
+	cfg := OTLPConfig{
+		Metrics:     true,
+		Logs:        true,
+		Endpoint:    server.URL + "/",
+		Interval:    time.Hour,
+		Headers:     map[string]string{"Authorization": "Bearer secret"},
+		Compression: otlpGzip,
+	}
+	shutdown, err := setupOTLP(cfg, "a2g", registry)
+	if err != nil {
+		t.Fatalf("setupOTLP() error = %v", err)
+	}
+	logger.Error("[req-1] Error sending to Google Chat: timeout")
+	logger.Info("Configuration reloaded")
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	rm := metrics.GetResourceMetrics()
+	if len(rm) != 1 || rm[0].GetResource().GetAttributes()[0].GetValue().GetStringValue() != "a2g" {
+		t.Fatalf("resource metrics = %v, want the service name", rm)
+	}
+	got := map[string]bool{}
+	for _, sm := range rm[0].GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			got[m.GetName()] = true
+			switch m.GetName() {
+			case "test_sent_total":
+				p := m.GetSum().GetDataPoints()[0]
+				if !m.GetSum().GetIsMonotonic() || p.GetAsDouble() != 3 || p.GetAttributes()[0].GetKey() != "status" {
+					t.Errorf("counter = %v", m)
+				}
+			case "test_duration_seconds":
+				p := m.GetHistogram().GetDataPoints()[0]
+				if p.GetCount() != 4 || p.GetSum() != 15.5 || len(p.GetExplicitBounds()) != 2 {
+					t.Errorf("histogram = %v", p)
+				}
+				if want := []uint64{1, 2, 1}; !slices.Equal(p.GetBucketCounts(), want) {
+					t.Errorf("histogram bucket counts = %v, want %v", p.GetBucketCounts(), want)
+				}
+			case "test_queue":
+				if v := m.GetGauge().GetDataPoints()[0].GetAsDouble(); v != 7 {
+					t.Errorf("gauge = %v, want 7", v)
+				}
+			}
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("exported %v, want 3 metrics", got)
+	}
+
+	rl := logs.GetResourceLogs()
+	if len(rl) != 1 || len(rl[0].GetScopeLogs()) != 1 {
+		t.Fatalf("resource logs = %v, want one scope", rl)
+	}
+	records := rl[0].GetScopeLogs()[0].GetLogRecords()
+	if len(records) != 2 {
+		t.Fatalf("exported %d log records, want 2", len(records))
+	}
+	first := records[0]
+	if first.GetSeverityText() != "ERROR" || first.GetBody().GetStringValue() != "Error sending to Google Chat: timeout" ||
+		len(first.GetAttributes()) != 1 || first.GetAttributes()[0].GetValue().GetStringValue() != "req-1" {
+		t.Errorf("log record = %v, want the request ID as an attribute", first)
+	}
+	if len(records[1].GetAttributes()) != 0 {
+		t.Errorf("log record without a request ID has attributes %v", records[1].GetAttributes())
+	}
+}
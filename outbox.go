@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxEntry is a message accepted from AlertManager and waiting to be
+// delivered.
+type OutboxEntry struct {
+	ID    uint64 `json:"id"`
+	ReqID string `json:"reqId"`
+	// Destination and Group order delivery: entries for the same alert
+	// group and destination are sent one at a time, in the order they were
+	// accepted.
+	Destination string               `json:"destination"`
+	Group       string               `json:"group,omitempty"`
+	Payload     *AlertManagerPayload `json:"payload"`
+	Message     *GoogleChatMessage   `json:"message"`
+	ThreadKey   string               `json:"threadKey,omitempty"`
+	AlertKeys   []string             `json:"alertKeys,omitempty"`
+	Uncounted   bool                 `json:"uncounted,omitempty"`
+	// Route is the route named by the payload, which is not part of its
+	// JSON.
+	Route       string    `json:"route,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+	// RemindedAt is when the entry was last escalated while waiting.
+	RemindedAt time.Time `json:"remindedAt,omitzero"`
+}
+
+// Outbox holds accepted messages until the dispatcher has delivered them.
+// With a directory, each entry is written to its own file before the webhook
+// request is acknowledged and removed once delivered, so a crash or restart
+// loses nothing.
+type Outbox struct {
+	mu       sync.Mutex
+	dir      string
+	seq      uint64
+	entries  []*OutboxEntry
+	inFlight map[string]bool
+	wake     chan struct{}
+}
+
+var outbox = NewOutbox("")
+
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{dir: dir, inFlight: map[string]bool{}, wake: make(chan struct{}, 1)}
+}
+
+// LoadOutbox opens the outbox persisted in dir, picking up entries left
+// undelivered by a previous run.
+func LoadOutbox(dir string) (*Outbox, error) {
+	o := NewOutbox(dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		var entry OutboxEntry
+		if err := loadState(f, &entry); err != nil {
+			return nil, err
+		}
+		o.entries = append(o.entries, &entry)
+		if entry.ID > o.seq {
+			o.seq = entry.ID
+		}
+	}
+	sort.Slice(o.entries, func(i, j int) bool { return o.entries[i].ID < o.entries[j].ID })
+	outboxSize.Set(float64(len(o.entries)))
+	return o, nil
+}
+
+// Enqueue stores a message for delivery to destination.
+func (o *Outbox) Enqueue(reqID, destination string, payload *AlertManagerPayload, message *GoogleChatMessage, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seq++
+	entry := &OutboxEntry{
+		ID:          o.seq,
+		ReqID:       reqID,
+		Destination: destination,
+		Group:       groupOrderKey(payload),
+		Payload:     payload,
+		Message:     message,
+		ThreadKey:   message.ThreadKey,
+		AlertKeys:   message.AlertKeys,
+		Uncounted:   message.Uncounted,
+		Route:       payload.Route,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+	if err := o.save(entry); err != nil {
+		return err
+	}
+	o.entries = append(o.entries, entry)
+	outboxSize.Set(float64(len(o.entries)))
+	o.Wake()
+	return nil
+}
+
+// Wake has the dispatcher look for due messages now rather than at its next
+// tick.
+func (o *Outbox) Wake() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of messages waiting for delivery.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Counts returns the number of messages waiting for delivery at now and
+// the number held for paused routes.
+func (o *Outbox) Counts(now time.Time) (waiting, held int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, entry := range o.entries {
+		if routePauses.Holds(entry.Destination, now) {
+			held++
+		} else {
+			waiting++
+		}
+	}
+	return waiting, held
+}
+
+// OldestAge returns how long the oldest waiting entry has been in the
+// outbox at now, or zero when it is empty. Entries held for paused routes
+// are not waiting and do not count.
+func (o *Outbox) OldestAge(now time.Time) time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, entry := range o.entries {
+		if !routePauses.Holds(entry.Destination, now) {
+			return now.Sub(entry.CreatedAt)
+		}
+	}
+	return 0
+}
+
+// orderKey is the key entries are delivered in order by.
+func (e *OutboxEntry) orderKey() string {
+	return e.Destination + "\x00" + e.Group
+}
+
+// take returns the oldest entry of each alert group and destination that is
+// due at now and has no delivery in flight, marking those busy. Entries for
+// paused routes are held until the route is resumed.
+func (o *Outbox) take(now time.Time) []*OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var due []*OutboxEntry
+	seen := map[string]bool{}
+	for _, entry := range o.entries {
+		key := entry.orderKey()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if o.inFlight[key] || entry.NextAttempt.After(now) || routePauses.Holds(entry.Destination, now) {
+			continue
+		}
+		o.inFlight[key] = true
+		due = append(due, entry)
+	}
+	return due
+}
+
+// finish records the outcome of delivering entry. Delivered entries and
+// entries that can no longer be delivered are removed; others are retried
+// after retryAt.
+func (o *Outbox) finish(entry *OutboxEntry, remove bool, retryAt time.Time, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer func() {
+		delete(o.inFlight, entry.orderKey())
+		o.Wake()
+	}()
+
+	if !remove {
+		entry.NextAttempt = retryAt
+		entry.LastError = err.Error()
+		if serr := o.save(entry); serr != nil {
+			logger.Error("[%s] Error updating outbox entry: %v", entry.ReqID, serr)
+		}
+		return
+	}
+
+	for i, e := range o.entries {
+		if e == entry {
+			o.entries = append(o.entries[:i], o.entries[i+1:]...)
+			break
+		}
+	}
+	outboxSize.Set(float64(len(o.entries)))
+	if o.dir != "" {
+		if rerr := os.Remove(o.path(entry)); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			logger.Error("[%s] Error removing outbox entry: %v", entry.ReqID, rerr)
+		}
+	}
+}
+
+// Overdue returns copies of the entries that have failed at least once and
+// were accepted, or last escalated, after or more before now, marking them
+// escalated at now. Entries being delivered or held by a pause are left
+// for a later call.
+func (o *Outbox) Overdue(now time.Time, after time.Duration) []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var overdue []OutboxEntry
+	for _, entry := range o.entries {
+		since := entry.CreatedAt
+		if entry.RemindedAt.After(since) {
+			since = entry.RemindedAt
+		}
+		if entry.Attempts == 0 || now.Sub(since) < after || o.inFlight[entry.orderKey()] || routePauses.Holds(entry.Destination, now) {
+			continue
+		}
+		entry.RemindedAt = now
+		overdue = append(overdue, *entry)
+	}
+	return overdue
+}
+
+func (o *Outbox) path(entry *OutboxEntry) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d.json", entry.ID))
+}
+
+// save writes entry to disk and flushes it, so an acknowledged message
+// survives a crash of the host as well as of the process. The caller must
+// hold o.mu.
+func (o *Outbox) save(entry *OutboxEntry) error {
+	if o.dir == "" {
+		return nil
+	}
+	return syncState(o.path(entry), entry)
+}
+
+// Compact removes temporary files left in the outbox directory by a crash
+// while saving, and returns the size of the messages it holds.
+func (o *Outbox) Compact() (int64, error) {
+	if o.dir == "" {
+		return 0, nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox directory: %v", err)
+	}
+	var size int64
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			os.Remove(filepath.Join(o.dir, f.Name()))
+			continue
+		}
+		if info, err := f.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// errOutboxFull is returned when the outbox holds max_messages messages.
+var errOutboxFull = errors.New("outbox is full")
+
+// outboxDestination is where a message is delivered: the route name, plus
+// the destination picked by a webhook map or template.
+func outboxDestination(route *Route) string {
+	if route.WebhookMap != nil || route.WebhookTemplate != nil {
+		return route.Name + "/" + route.Destination
+	}
+	return route.Name
+}
+
+// deliverOutboxEntry makes one delivery attempt for entry through the route
+// its payload matches now. A failed attempt is retried with exponential
+// backoff until it succeeds, fails permanently or gets older than max_age.
+func deliverOutboxEntry(provider Provider, entry *OutboxEntry) {
+	rt := getRuntime()
+	cfg := rt.Config.Outbox
+	entry.Payload.Route = entry.Route
+	route := rt.Route(entry.Payload)
+
+	message := *entry.Message
+	message.ThreadKey = entry.ThreadKey
+	message.AlertKeys = entry.AlertKeys
+	message.GroupKey = entry.Payload.GroupKey
+	message.Uncounted = entry.Uncounted
+	counted := len(entry.Payload.Alerts)
+	if entry.Uncounted {
+		counted = 0
+	}
+
+	ctx, cancel := withDeadline(context.Background(), rt.Config.Deadlines.Send)
+	defer cancel()
+	sendProvider := route.Provider
+	if sendProvider == nil {
+		sendProvider = provider
+	}
+	entry.Attempts++
+	err := route.Policy.Attempt(ctx, sendProvider, &message, SendOptions{ReqID: entry.ReqID, Route: route.Name, Destination: outboxDestination(route), Attempt: entry.Attempts})
+
+	now := clock.Now()
+	switch {
+	case err == nil:
+		logger.Info("[%s] Delivered outbox message via route %s after %d attempt(s)", entry.ReqID, route.Name, entry.Attempts)
+		sentAlerts(entry.Payload.Status, counted)
+		notifyLatency.Delivered(route.Name, entry.Payload.Alerts, entry.CreatedAt, now, rt.Config.SLO.NotifyTarget)
+		clearResolvedAcks(entry.ReqID, entry.Payload)
+		if herr := history.Record(entry.ReqID, route.Name, entry.Payload, now); herr != nil {
+			logger.Error("[%s] Error recording delivery history: %v", entry.ReqID, herr)
+		}
+		outbox.finish(entry, true, time.Time{}, nil)
+	case !retryable(err):
+		logger.Error("[%s] Dropping outbox message after a permanent error: %v", entry.ReqID, err)
+		outboxDropped.Inc()
+		dropAlerts(deliveryDropReason(err), counted)
+		outbox.finish(entry, true, time.Time{}, err)
+		escalate(rt.Config.Escalation, rt.Config.Email, newDeliveryFailure(entry, route.Name, err, now))
+	case cfg.MaxAge > 0 && now.Sub(entry.CreatedAt) >= cfg.MaxAge:
+		logger.Error("[%s] Dropping outbox message after %d attempt(s) over %s: %v", entry.ReqID, entry.Attempts, formatDuration(now.Sub(entry.CreatedAt)), err)
+		outboxDropped.Inc()
+		dropAlerts(deliveryDropReason(err), counted)
+		outbox.finish(entry, true, time.Time{}, err)
+		escalate(rt.Config.Escalation, rt.Config.Email, newDeliveryFailure(entry, route.Name, err, now))
+	default:
+		backoff := outboxBackoff(route.Policy, cfg.MaxBackoff, entry.Attempts)
+		logger.InfoRepeated("Outbox delivery to "+outboxDestination(route)+" failed: "+errorText(err),
+			"[%s] Outbox delivery failed, retrying in %s (attempt %d): %v", entry.ReqID, backoff, entry.Attempts, err)
+		outbox.finish(entry, false, now.Add(backoff), err)
+	}
+}
+
+// deliveryDropReason is the alertsDropped reason for a message given up
+// after err.
+func deliveryDropReason(err error) string {
+	if rateLimited(err) {
+		return dropRateLimited
+	}
+	return dropDeliveryFailed
+}
+
+// outboxBackoff doubles the route's retry_backoff with each attempt, up to
+// max.
+func outboxBackoff(policy *DeliveryPolicy, max time.Duration, attempts int) time.Duration {
+	base := time.Second
+	if policy != nil && policy.cfg.RetryBackoff > 0 {
+		base = policy.cfg.RetryBackoff
+	}
+	backoff := time.Duration(float64(base) * math.Pow(2, float64(attempts-1)))
+	if backoff > max || backoff <= 0 {
+		return max
+	}
+	return backoff
+}
+
+// dispatchOutbox starts a delivery for each alert group and destination with
+// a message due. Deliveries to one destination run concurrently up to the
+// route's workers.
+func dispatchOutbox(provider Provider, now time.Time, wg *sync.WaitGroup) {
+	for _, entry := range outbox.take(now) {
+		wg.Add(1)
+		go func(entry *OutboxEntry) {
+			defer wg.Done()
+			deliverOutboxEntry(provider, entry)
+		}(entry)
+	}
+}
+
+// runOutboxDispatcher delivers outbox messages until stop is closed,
+// checking for due retries every interval. Messages not yet delivered stay
+// in the outbox for the next run.
+func runOutboxDispatcher(provider Provider, interval time.Duration, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		dispatchOutbox(provider, clock.Now(), &wg)
+		select {
+		case <-stop:
+			return
+		case <-outbox.wake:
+		case <-ticker.C():
+		}
+	}
+}
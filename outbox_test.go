@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func outboxPayload(name string) *AlertManagerPayload {
+	return &AlertManagerPayload{Status: "firing", GroupKey: "{}:{alertname=\"" + name + "\"}", Alerts: Alerts{{
+		Status: "firing",
+		Labels: KV{"alertname": name},
+	}}}
+}
+
+func TestOutboxTake(t *testing.T) {
+	o := NewOutbox("")
+	now := time.Now()
+	for _, e := range []struct{ reqID, destination, group string }{
+		{"a", "ops", "NodeDown"},
+		{"b", "ops", "NodeDown"},
+		{"c", "db", "NodeDown"},
+		{"d", "ops", "DiskFull"},
+	} {
+		if err := o.Enqueue(e.reqID, e.destination, outboxPayload(e.group), &GoogleChatMessage{Text: e.reqID}, now); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	reqIDs := func(entries []*OutboxEntry) []string {
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.ReqID)
+		}
+		return ids
+	}
+
+	due := o.take(now)
+	if got := reqIDs(due); len(got) != 3 || got[0] != "a" || got[1] != "c" || got[2] != "d" {
+		t.Fatalf("Expected the head of each group and destination, got %v", got)
+	}
+	if got := o.take(now); len(got) != 0 {
+		t.Fatalf("Expected nothing while deliveries are in flight, got %v", reqIDs(got))
+	}
+
+	o.finish(due[0], true, time.Time{}, nil)
+	if got := reqIDs(o.take(now)); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("Expected the next message of the group, got %v", got)
+	}
+	if o.Len() != 3 {
+		t.Errorf("Expected 3 messages left, got %d", o.Len())
+	}
+}
+
+func TestOutboxDispatch(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { outbox = NewOutbox("") }()
+	defer currentRuntime.Store(nil)
+
+	provider := &flakyProvider{}
+	route := &Route{Name: defaultRouteName, Provider: provider, Policy: NewDeliveryPolicy(DeliveryConfig{RetryBackoff: time.Millisecond})}
+	currentRuntime.Store(&Runtime{
+		Config:       Config{Outbox: OutboxConfig{Enabled: true, MaxAge: time.Hour, MaxBackoff: time.Minute}},
+		DefaultRoute: route,
+	})
+
+	dispatch := func(now time.Time) {
+		var wg sync.WaitGroup
+		dispatchOutbox(nil, now, &wg)
+		wg.Wait()
+	}
+	files := func(dir string) int {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		return len(matches)
+	}
+
+	t.Run("retries in order across restarts", func(t *testing.T) {
+		dir := t.TempDir()
+		outbox = NewOutbox(dir)
+		provider.errs = []error{&HTTPStatusError{StatusCode: http.StatusServiceUnavailable}}
+		provider.calls = 0
+
+		now := time.Now()
+		outbox.Enqueue("first", defaultRouteName, outboxPayload("NodeDown"), &GoogleChatMessage{Text: "first", ThreadKey: "thread"}, now)
+		outbox.Enqueue("second", defaultRouteName, outboxPayload("NodeDown"), &GoogleChatMessage{Text: "second"}, now)
+
+		dispatch(now)
+		if provider.calls != 1 {
+			t.Fatalf("Expected one attempt, got %d", provider.calls)
+		}
+		dispatch(now)
+		if provider.calls != 1 {
+			t.Fatalf("Expected the second message to wait behind the retry, got %d attempts", provider.calls)
+		}
+		if n := files(dir); n != 2 {
+			t.Fatalf("Expected 2 persisted messages, got %d", n)
+		}
+
+		reloaded, err := LoadOutbox(dir)
+		if err != nil {
+			t.Fatalf("LoadOutbox() error = %v", err)
+		}
+		if reloaded.Len() != 2 || reloaded.entries[0].Attempts != 1 || reloaded.entries[0].ThreadKey != "thread" {
+			t.Fatalf("Unexpected reloaded outbox %+v", reloaded.entries)
+		}
+		if age := reloaded.OldestAge(now.Add(time.Minute)); age != time.Minute {
+			t.Errorf("Expected the oldest message to be 1m old after the restart, got %s", age)
+		}
+		outbox = reloaded
+
+		later := time.Now().Add(time.Minute)
+		dispatch(later)
+		dispatch(later)
+		if provider.calls != 3 {
+			t.Fatalf("Expected 3 attempts, got %d", provider.calls)
+		}
+		if outbox.Len() != 0 || files(dir) != 0 || outbox.OldestAge(later) != 0 {
+			t.Errorf("Expected the outbox to be empty, got %d message(s) and %d file(s)", outbox.Len(), files(dir))
+		}
+	})
+
+	t.Run("drops permanent failures and expired messages", func(t *testing.T) {
+		outbox = NewOutbox("")
+		provider.errs = []error{&HTTPStatusError{StatusCode: http.StatusBadRequest}, &HTTPStatusError{StatusCode: http.StatusBadGateway}}
+		provider.calls = 0
+		var before dto.Metric
+		alertsDropped.WithLabelValues(dropDeliveryFailed).Write(&before)
+
+		outbox.Enqueue("bad", "a", outboxPayload("Bad"), &GoogleChatMessage{}, time.Now())
+		dispatch(time.Now())
+		outbox.Enqueue("old", "b", outboxPayload("Old"), &GoogleChatMessage{}, time.Now().Add(-2*time.Hour))
+		dispatch(time.Now())
+
+		if provider.calls != 2 || outbox.Len() != 0 {
+			t.Errorf("Expected both messages dropped after one attempt each, got %d attempts and %d left", provider.calls, outbox.Len())
+		}
+		var after dto.Metric
+		alertsDropped.WithLabelValues(dropDeliveryFailed).Write(&after)
+		if got := after.GetCounter().GetValue() - before.GetCounter().GetValue(); got != 2 {
+			t.Errorf("Expected 2 alerts dropped as %s, got %v", dropDeliveryFailed, got)
+		}
+	})
+}
+
+func TestOutboxKeepsMessagesWhileBreakerIsOpen(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { outbox = NewOutbox("") }()
+	defer currentRuntime.Store(nil)
+	fake := useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+
+	provider := &flakyProvider{errs: []error{&HTTPStatusError{StatusCode: http.StatusServiceUnavailable}}}
+	policy := NewDeliveryPolicy(DeliveryConfig{RetryBackoff: time.Second, BreakerFailures: 1, BreakerCooldown: time.Minute})
+	currentRuntime.Store(&Runtime{
+		Config:       Config{Outbox: OutboxConfig{Enabled: true, MaxAge: time.Hour, MaxBackoff: time.Minute}},
+		DefaultRoute: &Route{Name: defaultRouteName, Provider: provider, Policy: policy},
+	})
+	dispatch := func() {
+		var wg sync.WaitGroup
+		dispatchOutbox(nil, clock.Now(), &wg)
+		wg.Wait()
+	}
+
+	outbox = NewOutbox("")
+	outbox.Enqueue("req-1", defaultRouteName, outboxPayload("NodeDown"), &GoogleChatMessage{Text: "down"}, clock.Now())
+
+	// The failed attempt opens the breaker; later attempts are refused
+	// without sending, and the message stays queued.
+	dispatch()
+	for range 3 {
+		fake.Advance(10 * time.Second)
+		dispatch()
+	}
+	if provider.calls != 1 || outbox.Len() != 1 {
+		t.Fatalf("Expected 1 send and the message kept while the breaker is open, got %d sends and %d message(s)", provider.calls, outbox.Len())
+	}
+
+	fake.Advance(time.Minute)
+	dispatch()
+	if provider.calls != 2 || outbox.Len() != 0 {
+		t.Errorf("Expected the message sent once the breaker closed, got %d sends and %d message(s) left", provider.calls, outbox.Len())
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	policy := NewDeliveryPolicy(DeliveryConfig{RetryBackoff: time.Second})
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{3, 4 * time.Second},
+		{10, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(policy, time.Minute, tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestProcessPayloadQueuesToOutbox(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { outbox = NewOutbox("") }()
+	outbox = NewOutbox("")
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{Outbox: OutboxConfig{Enabled: true}}})
+
+	body, err := os.ReadFile("test_webhook/sample_alert.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample alert: %v", err)
+	}
+
+	provider := NewMockProvider(true)
+	if err := processPayload(context.Background(), body, "req-1", provider); err != nil {
+		t.Fatalf("Expected the alert to be accepted while Chat is down, got %v", err)
+	}
+	if outbox.Len() != 1 {
+		t.Fatalf("Expected one queued message, got %d", outbox.Len())
+	}
+	if entry := outbox.entries[0]; entry.Destination != defaultRouteName || entry.Message == nil {
+		t.Errorf("Unexpected outbox entry %+v", entry)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoutePause is a route paused through the admin API. Until, when set,
+// resumes the route automatically.
+type RoutePause struct {
+	Route    string    `json:"route"`
+	Reason   string    `json:"reason,omitempty"`
+	PausedAt time.Time `json:"pausedAt"`
+	Until    time.Time `json:"until,omitzero"`
+}
+
+// active reports whether the pause still holds at now.
+func (p RoutePause) active(now time.Time) bool {
+	return p.Until.IsZero() || now.Before(p.Until)
+}
+
+// PauseStore holds the paused routes by name. With a path, every change is
+// written to disk so routes stay paused across restarts.
+type PauseStore struct {
+	mu     sync.Mutex
+	path   string
+	pauses map[string]RoutePause
+}
+
+var routePauses = NewPauseStore("")
+
+func NewPauseStore(path string) *PauseStore {
+	return &PauseStore{path: path, pauses: map[string]RoutePause{}}
+}
+
+// LoadPauseStore opens the store persisted at path.
+func LoadPauseStore(path string) (*PauseStore, error) {
+	s := NewPauseStore(path)
+	if err := loadState(path, &s.pauses); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Paused reports whether route is paused at now.
+func (s *PauseStore) Paused(route string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pauses[route]
+	return ok && p.active(now)
+}
+
+// Holds reports whether outbox messages for destination are held at now:
+// the destination is a paused route, or a destination picked by the webhook
+// map or template of one.
+func (s *PauseStore) Holds(destination string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, p := range s.pauses {
+		if p.active(now) && (destination == name || strings.HasPrefix(destination, name+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pause pauses a route, replacing any earlier pause of it. Pauses that
+// have run out are removed with it.
+func (s *PauseStore) Pause(p RoutePause) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(p.PausedAt)
+	s.pauses[p.Route] = p
+	return s.save()
+}
+
+// Resume resumes route, reporting whether it was paused.
+func (s *PauseStore) Resume(route string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pauses[route]
+	if !ok {
+		return false, nil
+	}
+	delete(s.pauses, route)
+	s.expire(now)
+	return p.active(now), s.save()
+}
+
+// expire removes the pauses that have run out at now, returning how many
+// it removed. The caller must hold s.mu.
+func (s *PauseStore) expire(now time.Time) int {
+	n := 0
+	for route, p := range s.pauses {
+		if !p.active(now) {
+			delete(s.pauses, route)
+			n++
+		}
+	}
+	return n
+}
+
+// Compact removes the pauses that have run out at now and returns the
+// size of the store's file.
+func (s *PauseStore) Compact(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	if s.path == "" {
+		return 0, nil
+	}
+	if err := s.save(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// List returns the routes paused at now, by name.
+func (s *PauseStore) List(now time.Time) []RoutePause {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []RoutePause{}
+	for _, p := range s.pauses {
+		if p.active(now) {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Route < list[j].Route })
+	return list
+}
+
+func (s *PauseStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return saveState(s.path, s.pauses)
+}
+
+// knownRoute reports whether name is the default route, a configured route
+// or one built from a ChatRoute resource.
+func (rt *Runtime) knownRoute(name string) bool {
+	if name == defaultRouteName {
+		return true
+	}
+	for _, route := range rt.routes() {
+		if route.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pausesHandler serves GET /api/v1/pauses/ with the paused routes, POST
+// /api/v1/pauses/{route} to pause a route and DELETE /api/v1/pauses/{route}
+// to resume it. A POST body may give a reason and a duration after which
+// the route resumes on its own. Resuming wakes the outbox so messages
+// buffered for the route are delivered right away.
+func pausesHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/pauses/")
+	now := clock.Now()
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(routePauses.List(now))
+	case r.Method == http.MethodPost && name != "":
+		var body struct {
+			Reason   string `json:"reason"`
+			Duration string `json:"duration"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Body must be a JSON object", http.StatusBadRequest)
+			return
+		}
+		if !getRuntime().knownRoute(name) {
+			http.Error(w, "Route not found", http.StatusNotFound)
+			return
+		}
+		pause := RoutePause{Route: name, Reason: body.Reason, PausedAt: now}
+		if body.Duration != "" {
+			d, err := time.ParseDuration(body.Duration)
+			if err != nil || d <= 0 {
+				http.Error(w, "Duration must be a positive duration such as 2h", http.StatusBadRequest)
+				return
+			}
+			pause.Until = now.Add(d)
+		}
+		if err := routePauses.Pause(pause); err != nil {
+			logger.Error("Error saving route pause: %v", err)
+			http.Error(w, "Error saving route pause", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Paused route %s on request from %s", name, r.RemoteAddr)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pause)
+	case r.Method == http.MethodDelete && name != "":
+		resumed, err := routePauses.Resume(name, now)
+		if err != nil {
+			logger.Error("Error saving route pause: %v", err)
+			http.Error(w, "Error saving route pause", http.StatusInternalServerError)
+			return
+		}
+		if !resumed {
+			http.Error(w, "Route is not paused", http.StatusNotFound)
+			return
+		}
+		logger.Info("Resumed route %s on request from %s", name, r.RemoteAddr)
+		outbox.Wake()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPausedRoute(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { outbox, routePauses, history = NewOutbox(""), NewPauseStore(""), NewHistory("") }()
+	defer currentRuntime.Store(nil)
+
+	body, err := os.ReadFile("test_webhook/sample_alert.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample alert: %v", err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		config     Config
+		wantQueued int
+	}{
+		{name: "drop", config: Config{Pause: PauseConfig{Mode: pauseDrop}}},
+		{name: "buffer", config: Config{Pause: PauseConfig{Mode: pauseBuffer}, Outbox: OutboxConfig{Enabled: true}}, wantQueued: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outbox, routePauses, history = NewOutbox(""), NewPauseStore(""), NewHistory("")
+			currentRuntime.Store(&Runtime{Config: tt.config})
+			if err := routePauses.Pause(RoutePause{Route: defaultRouteName, PausedAt: now}); err != nil {
+				t.Fatal(err)
+			}
+
+			provider := NewMockProvider(false)
+			if err := processPayload(context.Background(), body, "req-1", provider); err != nil {
+				t.Fatalf("processPayload() error = %v", err)
+			}
+			if sent := len(provider.GetSentMessages()); sent != 0 {
+				t.Errorf("sent %d messages to a paused route", sent)
+			}
+			if outbox.Len() != tt.wantQueued {
+				t.Fatalf("outbox holds %d messages, want %d", outbox.Len(), tt.wantQueued)
+			}
+			if got := outbox.take(now.Add(time.Minute)); len(got) != 0 {
+				t.Errorf("took %d messages of a paused route", len(got))
+			}
+			if age := outbox.OldestAge(now.Add(time.Hour)); age != 0 {
+				t.Errorf("OldestAge() = %v, want 0 while the route is paused", age)
+			}
+
+			if resumed, err := routePauses.Resume(defaultRouteName, now); err != nil || !resumed {
+				t.Fatalf("Resume() = %v, %v", resumed, err)
+			}
+			if got := outbox.take(now.Add(time.Minute)); len(got) != tt.wantQueued {
+				t.Errorf("took %d messages after resuming, want %d", len(got), tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestPausedRouteLimits(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { outbox, routePauses, history = NewOutbox(""), NewPauseStore(""), NewHistory("") }()
+	outbox, routePauses, history = NewOutbox(""), NewPauseStore(t.TempDir()+"/pauses.json"), NewHistory("")
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{
+		Pause:  PauseConfig{Mode: pauseBuffer, MaxMessages: 2},
+		Outbox: OutboxConfig{Enabled: true, MaxMessages: 1},
+	}})
+
+	body, err := os.ReadFile("test_webhook/sample_alert.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample alert: %v", err)
+	}
+	now := time.Now()
+	if err := routePauses.Pause(RoutePause{Route: defaultRouteName, PausedAt: now, Until: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Held messages do not count towards the outbox's max_messages, only
+	// towards the pause's.
+	for i := range 3 {
+		if err := processPayload(context.Background(), body, "req", NewMockProvider(false)); err != nil {
+			t.Fatalf("processPayload() #%d error = %v", i, err)
+		}
+	}
+	if waiting, held := outbox.Counts(now); waiting != 0 || held != 2 {
+		t.Errorf("Counts() = %d waiting, %d held, want 0 and 2", waiting, held)
+	}
+
+	if _, err := routePauses.Compact(now.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if len(routePauses.pauses) != 0 {
+		t.Errorf("pauses after expiry = %v, want none", routePauses.pauses)
+	}
+	if waiting, held := outbox.Counts(now); waiting != 2 || held != 0 {
+		t.Errorf("Counts() after expiry = %d waiting, %d held, want 2 and 0", waiting, held)
+	}
+}
+
+func TestPausesHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { routePauses = NewPauseStore("") }()
+	routePauses = NewPauseStore(t.TempDir() + "/pauses.json")
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Routes: []*Route{{Name: "db"}}})
+	fake := useFakeClock(t, time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+
+	steps := []struct {
+		method, path, body string
+		wantStatus         int
+		wantPaused         []string
+	}{
+		{method: http.MethodPost, path: "/api/v1/pauses/unknown", wantStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/api/v1/pauses/db", body: `{"duration":"bad"}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/api/v1/pauses/db", body: `{"reason":"migration","duration":"1h"}`, wantStatus: http.StatusOK, wantPaused: []string{"db"}},
+		{method: http.MethodPost, path: "/api/v1/pauses/default", wantStatus: http.StatusOK, wantPaused: []string{"db", "default"}},
+		{method: http.MethodDelete, path: "/api/v1/pauses/default", wantStatus: http.StatusNoContent, wantPaused: []string{"db"}},
+		{method: http.MethodDelete, path: "/api/v1/pauses/default", wantStatus: http.StatusNotFound, wantPaused: []string{"db"}},
+	}
+	for i, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		pausesHandler(w, req)
+		if w.Code != step.wantStatus {
+			t.Fatalf("step %d: %s %s = %d, want %d: %s", i, step.method, step.path, w.Code, step.wantStatus, w.Body)
+		}
+		var paused []string
+		for _, p := range routePauses.List(fake.Now()) {
+			paused = append(paused, p.Route)
+		}
+		if strings.Join(paused, ",") != strings.Join(step.wantPaused, ",") {
+			t.Errorf("step %d: paused routes = %v, want %v", i, paused, step.wantPaused)
+		}
+	}
+
+	// Pauses are kept across restarts and end after their duration.
+	loaded, err := LoadPauseStore(routePauses.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Paused("db", fake.Now()) {
+		t.Error("Expected db to be paused after loading the store")
+	}
+	fake.Advance(time.Hour)
+	if loaded.Paused("db", fake.Now()) {
+		t.Error("Expected db to resume after its duration")
+	}
+
+	w := httptest.NewRecorder()
+	pausesHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/pauses/", nil))
+	var list []RoutePause
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list) != 0 {
+		t.Errorf("GET /api/v1/pauses/ = %v, %v, want an empty list", list, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+// snsHost matches the Amazon SNS endpoints a subscription may be confirmed
+// against, so a forged confirmation cannot make the bridge fetch arbitrary
+// URLs.
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// withPings answers the verification requests some upstreams send before
+// or instead of notifications, as enabled by cfg. Everything else is passed
+// on to next unchanged.
+func withPings(cfg PingConfig, next http.Handler) http.Handler {
+	if !cfg.AllowGet && !cfg.AllowEmpty && !cfg.SNSConfirm {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AllowGet && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			webhookPings.WithLabelValues("get").Inc()
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "OK")
+			return
+		}
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			status, msg := bodyReadError(err)
+			http.Error(w, msg, status)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if trimmed := bytes.TrimSpace(body); cfg.AllowEmpty && (len(trimmed) == 0 || string(trimmed) == "{}") {
+			webhookPings.WithLabelValues("empty").Inc()
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "OK")
+			return
+		}
+
+		if cfg.SNSConfirm {
+			switch r.Header.Get("X-Amz-Sns-Message-Type") {
+			case "SubscriptionConfirmation":
+				if err := confirmSNSSubscription(body); err != nil {
+					logger.Error("SNS subscription confirmation failed: %v", err)
+					http.Error(w, "SNS subscription confirmation failed", http.StatusBadRequest)
+					return
+				}
+				webhookPings.WithLabelValues("sns").Inc()
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, "Subscription confirmed")
+				return
+			case "UnsubscribeConfirmation":
+				webhookPings.WithLabelValues("sns").Inc()
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, "OK")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// confirmSNSSubscription visits the SubscribeURL of an SNS confirmation
+// message.
+func confirmSNSSubscription(body []byte) error {
+	var msg struct {
+		TopicArn     string
+		SubscribeURL string
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return fmt.Errorf("invalid confirmation message: %v", err)
+	}
+
+	u, err := url.Parse(msg.SubscribeURL)
+	if err != nil || u.Scheme != "https" || !snsHost.MatchString(u.Hostname()) {
+		return fmt.Errorf("refusing to confirm via %q: not an SNS endpoint", msg.SubscribeURL)
+	}
+
+	resp, err := sharedHTTPClient.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	logger.Info("Confirmed SNS subscription to %s", msg.TopicArn)
+	return nil
+}
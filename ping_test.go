@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithPings(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	tests := []struct {
+		name         string
+		cfg          PingConfig
+		method       string
+		body         string
+		snsType      string
+		expectedCode int
+		passedOn     bool
+	}{
+		{name: "get ping answered", cfg: PingConfig{AllowGet: true}, method: http.MethodGet, expectedCode: http.StatusOK},
+		{name: "get ping passed on when disabled", cfg: PingConfig{AllowEmpty: true}, method: http.MethodGet, expectedCode: http.StatusTeapot, passedOn: true},
+		{name: "empty body answered", cfg: PingConfig{AllowEmpty: true}, method: http.MethodPost, body: " \n", expectedCode: http.StatusOK},
+		{name: "empty object answered", cfg: PingConfig{AllowEmpty: true}, method: http.MethodPost, body: "{}", expectedCode: http.StatusOK},
+		{name: "notification passed on with body", cfg: PingConfig{AllowEmpty: true, SNSConfirm: true}, method: http.MethodPost, body: `{"status":"firing"}`, expectedCode: http.StatusTeapot, passedOn: true},
+		{name: "sns unsubscribe acknowledged", cfg: PingConfig{SNSConfirm: true}, method: http.MethodPost, body: "{}", snsType: "UnsubscribeConfirmation", expectedCode: http.StatusOK},
+		{
+			name:         "sns confirmation to foreign host refused",
+			cfg:          PingConfig{SNSConfirm: true},
+			method:       http.MethodPost,
+			body:         `{"TopicArn":"arn:aws:sns:eu-west-1:1:alerts","SubscribeURL":"https://attacker.example.com/confirm"}`,
+			snsType:      "SubscriptionConfirmation",
+			expectedCode: http.StatusBadRequest,
+		},
+		{name: "sns ignored when disabled", cfg: PingConfig{AllowGet: true}, method: http.MethodPost, body: "{}", snsType: "SubscriptionConfirmation", expectedCode: http.StatusTeapot, passedOn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				got = string(body)
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			if tt.snsType != "" {
+				req.Header.Set("X-Amz-Sns-Message-Type", tt.snsType)
+			}
+			w := httptest.NewRecorder()
+			withPings(tt.cfg, next).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+			if tt.passedOn && got != tt.body {
+				t.Errorf("Expected body %q to reach the handler, got %q", tt.body, got)
+			}
+		})
+	}
+}
@@ -2,22 +2,50 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
-
-	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Provider delivers a message to one destination. Implementations must
+// give up when ctx is done.
 type Provider interface {
-	Send(message *GoogleChatMessage, reqID string) error
+	Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error
+}
+
+// SendOptions describes the request a message is delivered for.
+type SendOptions struct {
+	ReqID string
+	// Route is the name of the route the message was routed to.
+	Route string
+	// Destination is the route plus the webhook picked by a webhook map or
+	// template, as named by outboxDestination. Empty means Route.
+	Destination string
+	// Attempt counts deliveries of the message, starting at 1 and
+	// increasing with each retry.
+	Attempt int
+}
+
+// destination returns Destination, or Route when it is not set.
+func (o SendOptions) destination() string {
+	if o.Destination != "" {
+		return o.Destination
+	}
+	return o.Route
 }
 
 var sharedHTTPClient = &http.Client{
 	Timeout: 10 * time.Second,
 	Transport: &http.Transport{
+		DialContext:         resolver.DialContext,
 		MaxIdleConns:        100,
 		IdleConnTimeout:     90 * time.Second,
 		DisableCompression:  true,
@@ -27,11 +55,108 @@ var sharedHTTPClient = &http.Client{
 
 type GoogleChatProvider struct {
 	WebhookURL string
+	// Timeout overrides the shared client timeout when non-zero.
+	Timeout time.Duration
+	// Headers are added to every request; "Host" overrides the request host.
+	Headers     map[string]string
+	BearerToken string
+	// Transport replaces the shared transport, for destinations that need
+	// client certificates.
+	Transport http.RoundTripper
+}
+
+// NewGoogleChatProvider builds a provider for webhookURL, reading the bearer
+// token file if one is configured.
+func NewGoogleChatProvider(webhookURL string, timeout time.Duration, out OutboundConfig) (*GoogleChatProvider, error) {
+	token := out.BearerToken
+	if out.BearerTokenFile != "" {
+		data, err := os.ReadFile(out.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token file: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	provider := &GoogleChatProvider{
+		WebhookURL:  webhookURL,
+		Timeout:     timeout,
+		Headers:     out.Headers,
+		BearerToken: token,
+	}
+	if out.TLS.enabled() {
+		transport, err := newTLSTransport(out.TLS)
+		if err != nil {
+			return nil, err
+		}
+		provider.Transport = transport
+	}
+	return provider, nil
+}
+
+// newTLSTransport returns a copy of the shared transport presenting the
+// configured client certificate and trusting the configured CA.
+func newTLSTransport(cfg TLSClientConfig) (*http.Transport, error) {
+	tlsConfig := &tls.Config{ServerName: cfg.ServerName}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := sharedHTTPClient.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// HTTPStatusError is returned when the destination answers with a
+// non-success status code.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("received non-success status code %d: %s", e.StatusCode, e.Body)
+}
+
+func (g *GoogleChatProvider) client() *http.Client {
+	if g.Transport == nil && (g.Timeout == 0 || g.Timeout == sharedHTTPClient.Timeout) {
+		return sharedHTTPClient
+	}
+	client := &http.Client{Timeout: sharedHTTPClient.Timeout, Transport: sharedHTTPClient.Transport}
+	if g.Timeout != 0 {
+		client.Timeout = g.Timeout
+	}
+	if g.Transport != nil {
+		client.Transport = g.Transport
+	}
+	return client
 }
 
-func (g *GoogleChatProvider) Send(message *GoogleChatMessage, reqID string) error {
-	timer := prometheus.NewTimer(providerRequestDuration.WithLabelValues("google_chat", "start"))
-	defer timer.ObserveDuration()
+func (g *GoogleChatProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) (err error) {
+	start := clock.Now()
+	defer func() {
+		status := statusSuccess
+		if err != nil {
+			status = statusError
+		}
+		observeDuration(ctx, providerRequestDuration.WithLabelValues("google_chat", status), clock.Since(start).Seconds())
+	}()
 
 	payload, err := json.Marshal(message)
 	if err != nil {
@@ -39,26 +164,60 @@ func (g *GoogleChatProvider) Send(message *GoogleChatMessage, reqID string) erro
 		return fmt.Errorf("error marshaling Google Chat message: %v", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, g.WebhookURL, bytes.NewBuffer(payload))
+	webhookURL := g.WebhookURL
+	if message.ThreadKey != "" {
+		webhookURL, err = withThreadKey(webhookURL, message.ThreadKey)
+		if err != nil {
+			providerErrors.WithLabelValues("google_chat").Inc()
+			return fmt.Errorf("error adding thread key: %v", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewBuffer(payload))
 	if err != nil {
 		providerErrors.WithLabelValues("google_chat").Inc()
 		return fmt.Errorf("error creating request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := sharedHTTPClient.Do(req)
+	for k, v := range g.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	if g.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+g.BearerToken)
+	}
+	req, span := startClientSpan(ctx, "google_chat.send", req)
+	defer func() { endSpan(span, err) }()
+	resp, err := g.client().Do(req)
 	if err != nil {
 		providerErrors.WithLabelValues("google_chat").Inc()
-		return fmt.Errorf("error sending request: %v", err)
+		return fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		providerErrors.WithLabelValues("google_chat").Inc()
-		return fmt.Errorf("received non-success status code %d: %s", resp.StatusCode, string(bodyBytes))
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
 	}
 
-	alertsSent.WithLabelValues(message.Text).Inc()
 	return nil
 }
+
+// withThreadKey adds the threadKey parameter to a webhook URL, falling back
+// to a new thread when the key has not been used before.
+func withThreadKey(webhookURL, threadKey string) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("threadKey", threadKey)
+	q.Set("messageReplyOption", "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
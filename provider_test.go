@@ -1,8 +1,24 @@
 package main
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
+	"testing"
+	"time"
 )
 
 // MockProvider implements Provider interface for testing
@@ -25,7 +41,7 @@ func NewMockProvider(shouldFail bool) *MockProvider {
 	}
 }
 
-func (m *MockProvider) Send(message *GoogleChatMessage, reqID string) error {
+func (m *MockProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error {
 	if m.shouldFail {
 		return fmt.Errorf("mock provider configured to fail")
 	}
@@ -36,7 +52,7 @@ func (m *MockProvider) Send(message *GoogleChatMessage, reqID string) error {
 	m.messages = append(m.messages, struct {
 		message *GoogleChatMessage
 		reqID   string
-	}{message, reqID})
+	}{message, opts.ReqID})
 
 	return nil
 }
@@ -53,3 +69,232 @@ func (m *MockProvider) GetSentMessages() []struct {
 		reqID   string
 	}{}, m.messages...)
 }
+
+func TestGoogleChatProviderOutboundHeaders(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	provider, err := NewGoogleChatProvider(server.URL, 0, OutboundConfig{
+		Headers:         map[string]string{"X-Api-Key": "key-1", "Host": "chat.internal"},
+		BearerTokenFile: tokenFile,
+	})
+	if err != nil {
+		t.Fatalf("NewGoogleChatProvider() error = %v", err)
+	}
+
+	if err := provider.Send(context.Background(), &GoogleChatMessage{Text: "hello"}, SendOptions{ReqID: "req-1"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if got.Header.Get("X-Api-Key") != "key-1" {
+		t.Errorf("Expected X-Api-Key header, got %q", got.Header.Get("X-Api-Key"))
+	}
+	if got.Header.Get("Authorization") != "Bearer s3cret" {
+		t.Errorf("Expected bearer token from file, got %q", got.Header.Get("Authorization"))
+	}
+	if got.Host != "chat.internal" {
+		t.Errorf("Expected host override, got %q", got.Host)
+	}
+}
+
+func TestGoogleChatProviderThreadKey(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider, err := NewGoogleChatProvider(server.URL+"/v1/spaces/X/messages?key=k", 0, OutboundConfig{})
+	if err != nil {
+		t.Fatalf("NewGoogleChatProvider() error = %v", err)
+	}
+
+	key := groupThreadKey(`{}:{alertname="HighCPU"}`)
+	if key == "" || key != groupThreadKey(`{}:{alertname="HighCPU"}`) {
+		t.Fatalf("Expected a stable thread key, got %q", key)
+	}
+
+	if err := provider.Send(context.Background(), &GoogleChatMessage{Text: "hello", ThreadKey: key}, SendOptions{ReqID: "req-1"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	q := got.URL.Query()
+	if q.Get("key") != "k" || q.Get("threadKey") != key || q.Get("messageReplyOption") != "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD" {
+		t.Errorf("Unexpected query %s", got.URL.RawQuery)
+	}
+
+	if err := provider.Send(context.Background(), &GoogleChatMessage{Text: "hello"}, SendOptions{ReqID: "req-2"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got.URL.Query().Has("threadKey") {
+		t.Errorf("Expected no threadKey without a thread, got %s", got.URL.RawQuery)
+	}
+}
+
+// writeCert issues a certificate for cn signed by parent (self-signed when
+// parent is nil) and writes the PEM certificate and key to dir.
+func writeCert(t *testing.T, dir, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, usage x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, cn+".crt")
+	keyFile := filepath.Join(dir, cn+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, key, certFile, keyFile
+}
+
+func TestGoogleChatProviderMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeCert(t, dir, "ca", nil, nil, x509.ExtKeyUsageAny)
+	_, _, serverCert, serverKey := writeCert(t, dir, "gateway", ca, caKey, x509.ExtKeyUsageServerAuth)
+	_, _, clientCert, clientKey := writeCert(t, dir, "bridge", ca, caKey, x509.ExtKeyUsageClientAuth)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	serverPair, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var peer string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		tls     TLSClientConfig
+		wantErr bool
+	}{
+		{name: "client certificate", tls: TLSClientConfig{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile, ServerName: "gateway"}},
+		{name: "no client certificate", tls: TLSClientConfig{CAFile: caFile, ServerName: "gateway"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer = ""
+			provider, err := NewGoogleChatProvider(server.URL, 0, OutboundConfig{TLS: tt.tls})
+			if err != nil {
+				t.Fatalf("NewGoogleChatProvider() error = %v", err)
+			}
+			err = provider.Send(context.Background(), &GoogleChatMessage{Text: "hello"}, SendOptions{ReqID: "req-1"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && peer != "bridge" {
+				t.Errorf("Expected client certificate bridge, got %q", peer)
+			}
+		})
+	}
+
+	if _, err := NewGoogleChatProvider(server.URL, 0, OutboundConfig{TLS: TLSClientConfig{CertFile: clientCert, KeyFile: caFile}}); err == nil {
+		t.Error("Expected an error for a mismatched key")
+	}
+}
+
+func TestGoogleChatProviderContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	provider, err := NewGoogleChatProvider(server.URL, time.Minute, OutboundConfig{})
+	if err != nil {
+		t.Fatalf("NewGoogleChatProvider() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := provider.Send(ctx, &GoogleChatMessage{Text: "hello"}, SendOptions{ReqID: "req-1"}); err == nil {
+		t.Fatal("Expected an error once the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Send to return at the deadline, took %s", elapsed)
+	}
+}
+
+func TestThreadKey(t *testing.T) {
+	payload := func(groupKey string, labels KV) *AlertManagerPayload {
+		return &AlertManagerPayload{GroupKey: groupKey, CommonLabels: labels}
+	}
+	byLabels := GoogleChatConfig{ThreadByLabels: []string{"alertname", "cluster"}}
+	tests := []struct {
+		name      string
+		cfg       GoogleChatConfig
+		a, b      *AlertManagerPayload
+		wantEmpty bool
+		wantSame  bool
+	}{
+		{name: "off", cfg: GoogleChatConfig{}, a: payload("g1", nil), wantEmpty: true},
+		{name: "same group", cfg: GoogleChatConfig{ThreadByGroupKey: true}, a: payload("g1", nil), b: payload("g1", nil), wantSame: true},
+		{name: "other group", cfg: GoogleChatConfig{ThreadByGroupKey: true}, a: payload("g1", nil), b: payload("g2", nil)},
+		{name: "same labels in other groups", cfg: byLabels,
+			a: payload("g1", KV{"alertname": "DiskFull", "cluster": "eu", "instance": "a"}),
+			b: payload("g2", KV{"alertname": "DiskFull", "cluster": "eu", "instance": "b"}), wantSame: true},
+		{name: "other label value", cfg: byLabels,
+			a: payload("g1", KV{"alertname": "DiskFull", "cluster": "eu"}),
+			b: payload("g1", KV{"alertname": "DiskFull", "cluster": "us"})},
+		{name: "no thread labels", cfg: byLabels, a: payload("g1", KV{"instance": "a"}), wantEmpty: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := threadKey(tt.cfg, tt.a)
+			if (a == "") != tt.wantEmpty {
+				t.Fatalf("threadKey() = %q, want empty %v", a, tt.wantEmpty)
+			}
+			if tt.b != nil {
+				if b := threadKey(tt.cfg, tt.b); (a == b) != tt.wantSame {
+					t.Errorf("threadKey() = %q and %q, want same %v", a, b, tt.wantSame)
+				}
+			}
+		})
+	}
+}
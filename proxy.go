@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses addresses and CIDRs, such as "10.0.0.0/8" or
+// "192.0.2.10", into prefixes.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, p := range proxies {
+		if strings.Contains(p, "/") {
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", p)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// withTrustedProxies sets r.RemoteAddr to the client address reported by
+// trusted proxies, so logs show the real client rather than the ingress
+// controller. Requests arriving directly from other addresses, and headers
+// that cannot be parsed, leave RemoteAddr as it is.
+func withTrustedProxies(proxies []string, next http.Handler) http.Handler {
+	// The list is checked when the configuration is loaded.
+	trusted, _ := parseTrustedProxies(proxies)
+	if len(trusted) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client, ok := forwardedClient(r, trusted); ok {
+			r = r.WithContext(r.Context())
+			r.RemoteAddr = client
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedClient walks the addresses in the Forwarded header, or
+// X-Forwarded-For when there is none, from the nearest hop back and returns
+// the first one that is not a trusted proxy. Only proxies can append to the
+// headers, so addresses before the first untrusted hop could be forged by
+// the client and are ignored.
+func forwardedClient(r *http.Request, trusted []netip.Prefix) (string, bool) {
+	peer, ok := parseHostAddr(r.RemoteAddr)
+	if !ok || !isTrusted(peer.Addr(), trusted) {
+		return "", false
+	}
+
+	hops := forwardedFor(r.Header)
+	if len(hops) == 0 {
+		return "", false
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHostAddr(hops[i])
+		if !ok {
+			return "", false
+		}
+		if i == 0 || !isTrusted(hop.Addr(), trusted) {
+			if hop.Port() == 0 {
+				return hop.Addr().String(), true
+			}
+			return hop.String(), true
+		}
+	}
+	return "", false
+}
+
+// forwardedFor returns the "for" addresses of the RFC 7239 Forwarded
+// header, or of X-Forwarded-For without one, oldest first.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return hops
+	}
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseHostAddr parses "ip", "ip:port", "[ipv6]" or "[ipv6]:port". A
+// missing port is returned as 0.
+func parseHostAddr(s string) (netip.AddrPort, bool) {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), true
+	}
+	host := s
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addr.Unmap(), 0), true
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
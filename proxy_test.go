@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithTrustedProxies(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "2001:db8::1"}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:5000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "203.0.113.7:5000"},
+		{name: "x-forwarded-for", remoteAddr: "10.1.2.3:5000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "forged entries are ignored", remoteAddr: "10.1.2.3:5000", headers: map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 10.4.4.4"}, want: "198.51.100.1"},
+		{name: "all hops trusted", remoteAddr: "10.1.2.3:5000", headers: map[string]string{"X-Forwarded-For": "10.9.9.9, 10.4.4.4"}, want: "10.9.9.9"},
+		{name: "no header", remoteAddr: "10.1.2.3:5000", want: "10.1.2.3:5000"},
+		{name: "garbage", remoteAddr: "10.1.2.3:5000", headers: map[string]string{"X-Forwarded-For": "not-an-ip"}, want: "10.1.2.3:5000"},
+		{name: "forwarded", remoteAddr: "[2001:db8::1]:443", headers: map[string]string{"Forwarded": `for=192.0.2.60;proto=http;by=203.0.113.43, For="[2001:db8:cafe::17]:4711"`}, want: "[2001:db8:cafe::17]:4711"},
+		{name: "forwarded wins", remoteAddr: "10.1.2.3:5000", headers: map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "198.51.100.1"}, want: "192.0.2.60"},
+		{name: "obfuscated identifier", remoteAddr: "10.1.2.3:5000", headers: map[string]string{"Forwarded": "for=_hidden"}, want: "10.1.2.3:5000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := withTrustedProxies(proxies, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "::1"}); err != nil {
+		t.Errorf("parseTrustedProxies() error = %v", err)
+	}
+	for _, bad := range []string{"10.0.0.0/33", "ingress", ""} {
+		if _, err := parseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("parseTrustedProxies(%q) error = nil, want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuietHours is a compiled [quiet_hours] block: a daily window during which
+// matching alerts are held and later posted as one summary card.
+type QuietHours struct {
+	// start and end are minutes after midnight in loc. A window with
+	// start after end runs past midnight.
+	start, end int
+	loc        *time.Location
+	Matchers   Matchers
+}
+
+// NewQuietHours compiles cfg, returning nil when no window is configured.
+func NewQuietHours(cfg QuietHoursConfig) (*QuietHours, error) {
+	if cfg.Start == "" && cfg.End == "" {
+		return nil, nil
+	}
+
+	start, err := parseClock(cfg.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start: %v", err)
+	}
+	end, err := parseClock(cfg.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end: %v", err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("start and end must differ")
+	}
+
+	loc := time.Local
+	if cfg.Timezone != "" {
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+
+	matchers, err := ParseMatchers(cfg.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	return &QuietHours{start: start, end: end, loc: loc, Matchers: matchers}, nil
+}
+
+// parseClock parses a "15:04" time of day into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active reports whether now falls inside the window.
+func (q *QuietHours) Active(now time.Time) bool {
+	if q == nil {
+		return false
+	}
+	now = now.In(q.loc)
+	minute := now.Hour()*60 + now.Minute()
+	if q.start < q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// heldAlert is an alert held during quiet hours, with its latest state.
+type heldAlert struct {
+	Alert
+	Receiver      string
+	Notifications int
+}
+
+// QuietDigest buffers the alerts held during quiet hours until the window
+// ends.
+type QuietDigest struct {
+	mu     sync.Mutex
+	alerts map[string]*heldAlert
+	since  time.Time
+}
+
+var quietDigest = NewQuietDigest()
+
+func NewQuietDigest() *QuietDigest {
+	return &QuietDigest{alerts: map[string]*heldAlert{}}
+}
+
+// Hold records alerts received for receiver. Repeated notifications for an alert
+// update its status and annotations but keep its original start time.
+func (d *QuietDigest) Hold(receiver string, alerts Alerts, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.alerts) == 0 {
+		d.since = now
+	}
+	for _, alert := range alerts {
+		key := alertKey(alert)
+		held, ok := d.alerts[key]
+		if !ok {
+			d.alerts[key] = &heldAlert{Alert: alert, Receiver: receiver, Notifications: 1}
+			continue
+		}
+		startsAt := held.StartsAt
+		held.Alert = alert
+		if !startsAt.IsZero() {
+			held.StartsAt = startsAt
+		}
+		held.Notifications++
+	}
+}
+
+// Len returns the number of alerts held.
+func (d *QuietDigest) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.alerts)
+}
+
+// Flush empties the digest, returning the held alerts sorted by alert name
+// and the time the first of them was held.
+func (d *QuietDigest) Flush() ([]heldAlert, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	held := make([]heldAlert, 0, len(d.alerts))
+	for _, alert := range d.alerts {
+		held = append(held, *alert)
+	}
+	since := d.since
+	d.alerts = map[string]*heldAlert{}
+
+	sort.Slice(held, func(i, j int) bool {
+		ni, nj := held[i].Labels["alertname"], held[j].Labels["alertname"]
+		if ni != nj {
+			return ni < nj
+		}
+		return held[i].StartsAt.Before(held[j].StartsAt)
+	})
+	return held, since
+}
+
+// requeue returns alerts taken by Flush to the digest after a failed send,
+// merging them with anything held since.
+func (d *QuietDigest) requeue(alerts []heldAlert, since time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.alerts) == 0 || since.Before(d.since) {
+		d.since = since
+	}
+	for _, alert := range alerts {
+		key := alertKey(alert.Alert)
+		if held, ok := d.alerts[key]; ok {
+			held.Notifications += alert.Notifications
+			if !alert.StartsAt.IsZero() {
+				held.StartsAt = alert.StartsAt
+			}
+			continue
+		}
+		alert := alert
+		d.alerts[key] = &alert
+	}
+}
+
+// holdQuietAlerts moves the alerts matching an active quiet hours window
+// into the digest and returns the rest.
+func holdQuietAlerts(reqID string, payload *AlertManagerPayload, q *QuietHours, now time.Time) Alerts {
+	if !q.Active(now) {
+		return payload.Alerts
+	}
+
+	var held Alerts
+	kept := make(Alerts, 0, len(payload.Alerts))
+	for _, alert := range payload.Alerts {
+		if q.Matchers.Matches(alert.Labels) {
+			held = append(held, alert)
+		} else {
+			kept = append(kept, alert)
+		}
+	}
+	if len(held) > 0 {
+		logger.Info("[%s] Holding %d alert(s) until quiet hours end", reqID, len(held))
+		alertsHeld.Add(float64(len(held)))
+		quietDigest.Hold(payload.Receiver, held, now)
+	}
+	return kept
+}
+
+// buildDigestMessage renders one card titled title listing the alerts held
+// since since, split into those still firing and those that have resolved.
+func buildDigestMessage(title string, alerts []heldAlert, since, now time.Time) *GoogleChatMessage {
+	var firing, resolved []string
+	for _, alert := range alerts {
+		line := fmt.Sprintf("• <b>%s</b> %s", alert.Labels["alertname"], alert.Labels.Remove([]string{"alertname"}).SortedPairs().String())
+		if alert.Notifications > 1 {
+			line += fmt.Sprintf(" (%d notifications)", alert.Notifications)
+		}
+		if alert.Status == "resolved" {
+			resolved = append(resolved, line)
+			continue
+		}
+		if !alert.StartsAt.IsZero() {
+			line += fmt.Sprintf(" (for %s)", formatDuration(now.Sub(alert.StartsAt)))
+		}
+		firing = append(firing, line)
+	}
+
+	card := Card{
+		Header: &CardHeader{
+			Title:    title,
+			Subtitle: fmt.Sprintf("%d alert(s) held since %s", len(alerts), since.Format("Jan 2 15:04 MST")),
+		},
+	}
+	for _, group := range []struct {
+		header string
+		lines  []string
+	}{{"Still firing", firing}, {"Resolved", resolved}} {
+		if len(group.lines) == 0 {
+			continue
+		}
+		lines := group.lines
+		if len(lines) > maxSummaryAlertsPerName {
+			lines = append(lines[:maxSummaryAlertsPerName:maxSummaryAlertsPerName], fmt.Sprintf("<i>... and %d more</i>", len(group.lines)-maxSummaryAlertsPerName))
+		}
+		card.Sections = append(card.Sections, CardSection{
+			Header:  fmt.Sprintf("%s (%d)", group.header, len(group.lines)),
+			Widgets: []Widget{{TextParagraph: &TextParagraph{Text: strings.Join(lines, "<br>")}}},
+		})
+	}
+
+	return &GoogleChatMessage{
+		Text:  fmt.Sprintf("%s: %d firing, %d resolved", title, len(firing), len(resolved)),
+		Cards: []Card{card},
+	}
+}
+
+// flushQuietDigest posts the held alerts once quiet hours are over, one card
+// per route. Alerts whose card could not be sent are held again and retried
+// on the next flush.
+func flushQuietDigest(provider Provider, now time.Time) {
+	rt := getRuntime()
+	if rt.QuietHours.Active(now) {
+		return
+	}
+	sendDigest(quietDigest, "Quiet hours summary", provider, now)
+}
+
+// sendDigest empties digest and posts its alerts as one card per route.
+// Alerts whose card could not be sent are held again.
+func sendDigest(digest *QuietDigest, title string, provider Provider, now time.Time) {
+	alerts, since := digest.Flush()
+	if len(alerts) == 0 {
+		return
+	}
+	rt := getRuntime()
+
+	// Routes are keyed by name and provider, since routes with a webhook
+	// map send to a different provider per label value.
+	type destination struct {
+		name     string
+		provider Provider
+	}
+	var order []*Route
+	byRoute := map[destination][]heldAlert{}
+	for _, alert := range alerts {
+		route := rt.Route(&AlertManagerPayload{Receiver: alert.Receiver, Alerts: Alerts{alert.Alert}})
+		key := destination{route.Name, route.Provider}
+		if _, ok := byRoute[key]; !ok {
+			order = append(order, route)
+		}
+		byRoute[key] = append(byRoute[key], alert)
+	}
+
+	for _, route := range order {
+		group := byRoute[destination{route.Name, route.Provider}]
+		reqID := newRequestID("digest")
+		logger.Info("[%s] Posting %s of %d alert(s) via route %s", reqID, strings.ToLower(title), len(group), route.Name)
+		if err := route.Send(context.Background(), provider, buildDigestMessage(title, group, since, now), reqID); err != nil {
+			logger.Error("[%s] Error sending %s: %v", reqID, strings.ToLower(title), err)
+			digest.requeue(group, since)
+		}
+	}
+}
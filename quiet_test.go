@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietHoursActive(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		cfg      QuietHoursConfig
+		at       time.Duration
+		expected bool
+	}{
+		{"overnight before start", QuietHoursConfig{Start: "22:00", End: "07:00"}, 21*time.Hour + 59*time.Minute, false},
+		{"overnight at start", QuietHoursConfig{Start: "22:00", End: "07:00"}, 22 * time.Hour, true},
+		{"overnight after midnight", QuietHoursConfig{Start: "22:00", End: "07:00"}, 3 * time.Hour, true},
+		{"overnight at end", QuietHoursConfig{Start: "22:00", End: "07:00"}, 7 * time.Hour, false},
+		{"daytime", QuietHoursConfig{Start: "12:00", End: "13:30"}, 13 * time.Hour, true},
+		{"daytime after end", QuietHoursConfig{Start: "12:00", End: "13:30"}, 13*time.Hour + 30*time.Minute, false},
+		{"timezone", QuietHoursConfig{Start: "22:00", End: "07:00", Timezone: "America/New_York"}, 5 * time.Hour, true},
+		{"timezone after end", QuietHoursConfig{Start: "22:00", End: "07:00", Timezone: "America/New_York"}, 13 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewQuietHours(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewQuietHours() error = %v", err)
+			}
+			if got := q.Active(day.Add(tt.at)); got != tt.expected {
+				t.Errorf("Active() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	for _, cfg := range []QuietHoursConfig{
+		{Start: "22:00"},
+		{Start: "25:00", End: "07:00"},
+		{Start: "07:00", End: "07:00"},
+		{Start: "22:00", End: "07:00", Timezone: "Nowhere/Special"},
+		{Start: "22:00", End: "07:00", Matchers: []string{"severity"}},
+	} {
+		if _, err := NewQuietHours(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+	if q, err := NewQuietHours(QuietHoursConfig{}); q != nil || err != nil {
+		t.Errorf("Expected no quiet hours without a window, got %v, %v", q, err)
+	}
+}
+
+func TestQuietHoursDigest(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { quietDigest = NewQuietDigest() }()
+	quietDigest = NewQuietDigest()
+
+	q, err := NewQuietHours(QuietHoursConfig{Start: "22:00", End: "07:00", Timezone: "UTC", Matchers: []string{`severity!="critical"`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{QuietHours: q})
+
+	night := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	start := night.Add(-time.Hour)
+	kept := holdQuietAlerts("req-1", &AlertManagerPayload{Alerts: Alerts{
+		{Status: "firing", Fingerprint: "1", Labels: KV{"alertname": "DiskFull", "severity": "warning"}, StartsAt: start},
+		{Status: "firing", Fingerprint: "2", Labels: KV{"alertname": "Down", "severity": "critical"}},
+		{Status: "firing", Fingerprint: "3", Labels: KV{"alertname": "HighCPU", "severity": "warning"}},
+	}}, q, night)
+	if len(kept) != 1 || kept[0].Labels["alertname"] != "Down" {
+		t.Fatalf("Expected only the critical alert to be sent, got %v", kept)
+	}
+	holdQuietAlerts("req-2", &AlertManagerPayload{Alerts: Alerts{
+		{Status: "resolved", Fingerprint: "3", Labels: KV{"alertname": "HighCPU", "severity": "warning"}},
+		{Status: "firing", Fingerprint: "1", Labels: KV{"alertname": "DiskFull", "severity": "warning"}, StartsAt: night},
+	}}, q, night.Add(time.Hour))
+
+	provider := NewMockProvider(false)
+	flushQuietDigest(provider, night.Add(2*time.Hour))
+	if got := len(provider.GetSentMessages()); got != 0 {
+		t.Fatalf("Expected nothing sent during quiet hours, got %d", got)
+	}
+
+	failing := NewMockProvider(true)
+	morning := time.Date(2024, 3, 2, 7, 0, 0, 0, time.UTC)
+	flushQuietDigest(failing, morning)
+	flushQuietDigest(provider, morning)
+	messages := provider.GetSentMessages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one summary after a failed send was retried, got %d", len(messages))
+	}
+
+	message := messages[0].message
+	if message.Text != "Quiet hours summary: 1 firing, 1 resolved" {
+		t.Errorf("Unexpected text %q", message.Text)
+	}
+	sections := message.Cards[0].Sections
+	if len(sections) != 2 || sections[0].Header != "Still firing (1)" || sections[1].Header != "Resolved (1)" {
+		t.Fatalf("Unexpected sections: %+v", sections)
+	}
+	if text := sections[0].Widgets[0].TextParagraph.Text; !strings.Contains(text, "DiskFull") || !strings.Contains(text, "(2 notifications) (for 9h0m)") {
+		t.Errorf("Unexpected firing line: %s", text)
+	}
+
+	flushQuietDigest(provider, morning.Add(time.Minute))
+	if got := len(provider.GetSentMessages()); got != 1 {
+		t.Errorf("Expected the digest to be emptied after sending, got %d messages", got)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reactionCreatedEvent is the Workspace Events type of a new emoji reaction
+// on a Chat message.
+const reactionCreatedEvent = "google.workspace.chat.reaction.v1.created"
+
+// chatUser identifies the user who reacted.
+type chatUser struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// reactionEvent is the payload of a reaction created event.
+type reactionEvent struct {
+	Reaction struct {
+		Name  string   `json:"name"`
+		User  chatUser `json:"user"`
+		Emoji struct {
+			Unicode string `json:"unicode"`
+		} `json:"emoji"`
+	} `json:"reaction"`
+}
+
+// pubsubPush is the body of a Pub/Sub push delivery. Data is base64 in the
+// JSON and decoded by encoding/json.
+type pubsubPush struct {
+	Message struct {
+		Attributes map[string]string `json:"attributes"`
+		Data       []byte            `json:"data"`
+	} `json:"message"`
+}
+
+// chatEventsHandler receives Workspace Events for the spaces alerts are
+// posted to, delivered by a Pub/Sub push subscription, and acts on emoji
+// reactions to alert messages. Other event types are acknowledged and
+// ignored so Pub/Sub does not redeliver them.
+func chatEventsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := getRuntime().Config.Reactions
+	if !cfg.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := secretValue(cfg.Token, cfg.TokenFile)
+	if err != nil {
+		logger.Error("Error reading reactions token: %v", err)
+		http.Error(w, "Error reading token", http.StatusInternalServerError)
+		return
+	}
+	// An empty token, such as from an empty token file, accepts nothing:
+	// anyone reaching the endpoint could otherwise ack and silence alerts.
+	if token == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var push pubsubPush
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		http.Error(w, "Invalid Pub/Sub message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if push.Message.Attributes["ce-type"] != reactionCreatedEvent {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var event reactionEvent
+	if err := json.Unmarshal(push.Message.Data, &event); err != nil {
+		http.Error(w, "Invalid reaction event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := handleReaction(cfg, event, clock.Now()); err != nil {
+		logger.Error("Error handling reaction %s: %v", event.Reaction.Name, err)
+		http.Error(w, "Error handling reaction", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReaction acknowledges or silences the alerts in the message that
+// was reacted to, depending on the emoji. Reactions to other messages and
+// other emoji are ignored.
+func handleReaction(cfg ReactionsConfig, event reactionEvent, now time.Time) error {
+	message, _, _ := strings.Cut(event.Reaction.Name, "/reactions/")
+	keys := postedMessages.Lookup(message)
+	if len(keys) == 0 {
+		logger.Debug("Ignoring reaction to unknown message %s", message)
+		return nil
+	}
+	by := reactingUser(event.Reaction.User)
+
+	switch event.Reaction.Emoji.Unicode {
+	case cfg.Ack:
+		for _, key := range keys {
+			if err := acks.Ack(newAck(key, by, "reacted "+cfg.Ack, now)); err != nil {
+				return err
+			}
+		}
+		logger.Info("%d alert(s) in %s acknowledged by %s", len(keys), message, by)
+		reactionsHandled.WithLabelValues("ack").Inc()
+	case cfg.Silence:
+		for _, key := range keys {
+			alert, ok := aggregator.Get(key)
+			if !ok {
+				continue
+			}
+			requestedSilences.Add(&Silence{
+				Matchers:  labelMatchers(alert.Labels),
+				ExpiresAt: now.Add(cfg.SilenceDuration),
+				Comment:   fmt.Sprintf("requested by %s reacting %s", by, cfg.Silence),
+			})
+		}
+		logger.Info("Alerts in %s silenced for %s by %s", message, cfg.SilenceDuration, by)
+		reactionsHandled.WithLabelValues("silence").Inc()
+	}
+	return nil
+}
+
+// reactingUser names the user who reacted, preferring the identity mapped
+// to their Chat user ID in [oncall] chat_users.
+func reactingUser(user chatUser) string {
+	for identity, id := range getRuntime().Config.OnCall.ChatUsers {
+		if id == user.Name {
+			return identity
+		}
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Name
+}
+
+// labelMatchers returns equality matchers for every label, matching exactly
+// one alert.
+func labelMatchers(labels KV) Matchers {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matchers := make(Matchers, 0, len(names))
+	for _, name := range names {
+		matchers = append(matchers, &Matcher{Name: name, Type: MatchEqual, Value: labels[name]})
+	}
+	return matchers
+}
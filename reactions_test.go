@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatEventsHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() {
+		acks = NewAckStore("")
+		aggregator = NewAlertAggregator()
+		postedMessages = newPostedMessageIndex("", defaultMessageTTL)
+		requestedSilences = &silenceList{}
+	}()
+	acks = NewAckStore("")
+	aggregator = NewAlertAggregator()
+	postedMessages = newPostedMessageIndex("", defaultMessageTTL)
+	requestedSilences = &silenceList{}
+
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{
+		Reactions: ReactionsConfig{Enabled: true, Token: "s3cret", Ack: "👀", Silence: "✅", SilenceDuration: time.Hour},
+		OnCall:    OnCallConfig{ChatUsers: map[string]string{"alice@example.com": "users/1001"}},
+	}})
+
+	alert := Alert{Status: "firing", Fingerprint: "fp-1", Labels: KV{"alertname": "DiskFull", "instance": "db-01"}}
+	aggregator.Update(&AlertManagerPayload{Alerts: Alerts{alert}})
+	postedMessages.Remember(ChatMessageRef{Name: "spaces/AAA/messages/M1", PostedAt: time.Now()}, "", []string{"fp-1"})
+
+	push := func(eventType, emoji, message string) string {
+		data := fmt.Sprintf(`{"reaction":{"name":"%s/reactions/R1","user":{"name":"users/1001"},"emoji":{"unicode":"%s"}}}`, message, emoji)
+		return fmt.Sprintf(`{"message":{"attributes":{"ce-type":"%s"},"data":"%s"}}`, eventType, base64.StdEncoding.EncodeToString([]byte(data)))
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{"missing token", "/chat/events", push(reactionCreatedEvent, "👀", "spaces/AAA/messages/M1"), http.StatusUnauthorized},
+		{"invalid body", "/chat/events?token=s3cret", "{", http.StatusBadRequest},
+		{"other event", "/chat/events?token=s3cret", push("google.workspace.chat.message.v1.created", "👀", "spaces/AAA/messages/M1"), http.StatusNoContent},
+		{"unknown message", "/chat/events?token=s3cret", push(reactionCreatedEvent, "👀", "spaces/AAA/messages/M2"), http.StatusNoContent},
+		{"ack", "/chat/events?token=s3cret", push(reactionCreatedEvent, "👀", "spaces/AAA/messages/M1"), http.StatusNoContent},
+		{"silence", "/chat/events?token=s3cret", push(reactionCreatedEvent, "✅", "spaces/AAA/messages/M1"), http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			chatEventsHandler(rr, httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body)))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body)
+			}
+		})
+	}
+
+	ack, ok := acks.Get("fp-1", time.Now())
+	if !ok || ack.By != "alice@example.com" {
+		t.Errorf("Expected the alert to be acknowledged by alice@example.com, got %+v", ack)
+	}
+	if len(acks.List(time.Now())) != 1 {
+		t.Errorf("Expected only the reacted-to message to be acknowledged, got %+v", acks.List(time.Now()))
+	}
+
+	silences := requestedSilences.Active(time.Now())
+	if len(silences) != 1 {
+		t.Fatalf("Expected 1 requested silence, got %d", len(silences))
+	}
+	if kept := filterSilenced("req-1", Alerts{alert, {Labels: KV{"alertname": "DiskFull", "instance": "db-02"}}}, silences); len(kept) != 1 {
+		t.Errorf("Expected the silence to match only the reacted-to alert, got %v", kept)
+	}
+	if active := requestedSilences.Active(time.Now().Add(2 * time.Hour)); len(active) != 0 {
+		t.Errorf("Expected the requested silence to expire, got %d", len(active))
+	}
+
+	// An empty token accepts nothing.
+	currentRuntime.Store(&Runtime{Config: Config{Reactions: ReactionsConfig{Enabled: true, SilenceDuration: time.Hour}}})
+	rr := httptest.NewRecorder()
+	chatEventsHandler(rr, httptest.NewRequest(http.MethodPost, "/chat/events?token=", strings.NewReader(push(reactionCreatedEvent, "👀", "spaces/AAA/messages/M1"))))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a configured token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Recorder persists raw webhook bodies to disk so they can be replayed later
+// with the replay subcommand.
+type Recorder struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var recorder *Recorder
+
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %v", err)
+	}
+	return &Recorder{dir: dir}, nil
+}
+
+// Record writes body to a new file named after the receive time and request
+// ID, so a directory listing sorts recordings chronologically.
+func (r *Recorder) Record(reqID string, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := fmt.Sprintf("%s-%s.json", clock.Now().UTC().Format("20060102T150405.000000000"), reqID)
+	path := filepath.Join(r.dir, name)
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("error writing recording: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error finalizing recording: %v", err)
+	}
+	return nil
+}
+
+// recordedFiles expands the given paths into the list of recordings to
+// replay. Directories contribute their *.json files in name order.
+func recordedFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		var dirFiles []string
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+				continue
+			}
+			dirFiles = append(dirFiles, filepath.Join(p, e.Name()))
+		}
+		sort.Strings(dirFiles)
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
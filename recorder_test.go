@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorderAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	logger = NewLogger(LogLevelInfo, nil)
+
+	rec, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+
+	body, err := os.ReadFile("test_webhook/sample_alert.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample alert: %v", err)
+	}
+
+	if err := rec.Record("req-1", body); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := rec.Record("req-2", []byte(`{"status":""}`)); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	files, err := recordedFiles([]string{dir})
+	if err != nil {
+		t.Fatalf("recordedFiles() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 recordings, got %d", len(files))
+	}
+	if filepath.Ext(files[0]) != ".json" {
+		t.Errorf("Expected .json recording, got %s", files[0])
+	}
+
+	var out bytes.Buffer
+	provider := &WriterProvider{Out: &out}
+
+	recorded, _ := os.ReadFile(files[0])
+	if err := processPayload(context.Background(), recorded, "replay-1", provider); err != nil {
+		t.Errorf("Expected first recording to replay, got %v", err)
+	}
+	if !contains(out.String(), "HighCPUUsage") {
+		t.Error("Expected rendered message to contain the alert name")
+	}
+
+	recorded, _ = os.ReadFile(files[1])
+	if err := processPayload(context.Background(), recorded, "replay-2", provider); err == nil {
+		t.Error("Expected invalid recording to fail replay")
+	}
+}
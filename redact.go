@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RedactRule masks every match of a pattern in label and annotation values.
+type RedactRule struct {
+	re         *regexp.Regexp
+	keys       map[string]bool
+	keepPrefix int
+	keepSuffix int
+	mask       string
+}
+
+// Redactor applies the configured redaction rules in order.
+type Redactor struct {
+	rules []*RedactRule
+}
+
+// NewRedactor compiles the [[redact]] blocks from the configuration. It
+// returns nil when no rules are configured.
+func NewRedactor(cfgs []RedactConfig) (*Redactor, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+
+	r := &Redactor{}
+	for i, cfg := range cfgs {
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %d: invalid pattern: %v", i, err)
+		}
+		if cfg.KeepPrefix < 0 || cfg.KeepSuffix < 0 {
+			return nil, fmt.Errorf("redact rule %d: keep_prefix and keep_suffix must not be negative", i)
+		}
+
+		rule := &RedactRule{
+			re:         re,
+			keepPrefix: cfg.KeepPrefix,
+			keepSuffix: cfg.KeepSuffix,
+			mask:       cfg.Mask,
+		}
+		if rule.mask == "" {
+			rule.mask = "****"
+		}
+		if len(cfg.Keys) > 0 {
+			rule.keys = make(map[string]bool, len(cfg.Keys))
+			for _, k := range cfg.Keys {
+				rule.keys[k] = true
+			}
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// apply replaces each match in value, keeping the configured number of
+// leading and trailing characters of the match visible.
+func (rule *RedactRule) apply(value string) string {
+	return rule.re.ReplaceAllStringFunc(value, func(match string) string {
+		runes := []rune(match)
+		if rule.keepPrefix+rule.keepSuffix >= len(runes) {
+			return rule.mask
+		}
+		return string(runes[:rule.keepPrefix]) + rule.mask + string(runes[len(runes)-rule.keepSuffix:])
+	})
+}
+
+// RedactKV masks the values of kv in place.
+func (r *Redactor) RedactKV(kv KV) {
+	if r == nil {
+		return
+	}
+	for k, v := range kv {
+		for _, rule := range r.rules {
+			if rule.keys != nil && !rule.keys[k] {
+				continue
+			}
+			v = rule.apply(v)
+		}
+		kv[k] = v
+	}
+}
+
+// RedactPayload masks every label and annotation value in the payload.
+func (r *Redactor) RedactPayload(payload *AlertManagerPayload) {
+	if r == nil {
+		return
+	}
+	r.RedactKV(payload.GroupLabels)
+	r.RedactKV(payload.CommonLabels)
+	r.RedactKV(payload.CommonAnnotations)
+	for _, alert := range payload.Alerts {
+		r.RedactKV(alert.Labels)
+		r.RedactKV(alert.Annotations)
+	}
+}
+
+// RedactText masks raw text such as request bodies written to logs and
+// recordings. Only rules not scoped to specific keys apply, since keys are
+// unknown in unparsed text.
+func (r *Redactor) RedactText(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.rules {
+		if rule.keys == nil {
+			text = rule.apply(text)
+		}
+	}
+	return text
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestRedactor(t *testing.T) {
+	redactor, err := NewRedactor([]RedactConfig{
+		{Pattern: `[\w.+-]+@[\w-]+\.[\w.]+`, KeepPrefix: 2},
+		{Pattern: `\d+\.\d+\.\d+\.\d+`, Keys: []string{"instance"}, KeepSuffix: 3, Mask: "x.x.x."},
+	})
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+
+	payload := &AlertManagerPayload{
+		Alerts: Alerts{
+			{
+				Labels: KV{"instance": "10.0.0.123", "source": "10.0.0.55"},
+				Annotations: KV{
+					"description": "Login failures for jane.doe@example.com",
+				},
+			},
+		},
+	}
+	redactor.RedactPayload(payload)
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"email in annotation", payload.Alerts[0].Annotations["description"], "Login failures for ja****"},
+		{"scoped key", payload.Alerts[0].Labels["instance"], "x.x.x.123"},
+		{"other key untouched", payload.Alerts[0].Labels["source"], "10.0.0.55"},
+		{"raw text", redactor.RedactText(`{"user":"bob@corp.io","instance":"10.0.0.1"}`), `{"user":"bo****","instance":"10.0.0.1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewRedactor([]RedactConfig{{Pattern: "("}}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
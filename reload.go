@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of configuration change.
+const (
+	changeRoute       = "route"
+	changeTemplate    = "template"
+	changeDestination = "destination"
+	changeSetting     = "setting"
+)
+
+// destinationFields are the route and [google_chat] settings that decide
+// where and how messages are delivered. Changes to them are reported as
+// destination changes, naming the fields but never their values.
+var destinationFields = map[string]bool{
+	"webhook_url":       true,
+	"space":             true,
+	"webhook_map":       true,
+	"webhook_map_label": true,
+	"allowed_hosts":     true,
+	"credentials_file":  true,
+	"headers":           true,
+	"bearer_token":      true,
+	"bearer_token_file": true,
+	"tls":               true,
+}
+
+// ConfigChange is one difference between the running configuration and a
+// new one.
+type ConfigChange struct {
+	Kind string `json:"kind"`
+	// Name is the route or template name, the route name (or "default") of
+	// a destination, or the section of a setting.
+	Name string `json:"name"`
+	// Action is added, removed or changed.
+	Action string `json:"action"`
+	// Fields lists the settings that changed, by their TOML names.
+	Fields []string `json:"fields,omitempty"`
+}
+
+func (c ConfigChange) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Kind, c.Name, c.Action)
+	if len(c.Fields) > 0 {
+		s += ": " + strings.Join(c.Fields, ", ")
+	}
+	return s
+}
+
+// diffRuntimes lists what applying next in place of prev changes: routes,
+// templates, destinations and other settings.
+func diffRuntimes(prev, next *Runtime) []ConfigChange {
+	changes := []ConfigChange{}
+
+	pv, nv := reflect.ValueOf(prev.Config), reflect.ValueOf(next.Config)
+	for i := 0; i < pv.NumField(); i++ {
+		name := tomlName(pv.Type().Field(i))
+		if name == "routes" || reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		fields := changedFields(pv.Field(i), nv.Field(i))
+		if name == "google_chat" {
+			changes = append(changes, splitDestination(changeSetting, name, defaultRouteName, fields)...)
+			continue
+		}
+		changes = append(changes, ConfigChange{Kind: changeSetting, Name: name, Action: "changed", Fields: fields})
+	}
+
+	prevRoutes := map[string]RouteConfig{}
+	for _, rc := range prev.Config.Routes {
+		prevRoutes[rc.Name] = rc
+	}
+	nextRoutes := map[string]bool{}
+	for _, rc := range next.Config.Routes {
+		nextRoutes[rc.Name] = true
+		old, ok := prevRoutes[rc.Name]
+		if !ok {
+			changes = append(changes, ConfigChange{Kind: changeRoute, Name: rc.Name, Action: "added"})
+			continue
+		}
+		fields := changedFields(reflect.ValueOf(old), reflect.ValueOf(rc))
+		changes = append(changes, splitDestination(changeRoute, rc.Name, rc.Name, fields)...)
+	}
+	for _, rc := range prev.Config.Routes {
+		if !nextRoutes[rc.Name] {
+			changes = append(changes, ConfigChange{Kind: changeRoute, Name: rc.Name, Action: "removed"})
+		}
+	}
+
+	prevTemplates, nextTemplates := templateDefinitions(prev.Templates), templateDefinitions(next.Templates)
+	var names []string
+	for name := range prevTemplates {
+		names = append(names, name)
+	}
+	for name := range nextTemplates {
+		if _, ok := prevTemplates[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		old, inPrev := prevTemplates[name]
+		text, inNext := nextTemplates[name]
+		switch {
+		case !inPrev:
+			changes = append(changes, ConfigChange{Kind: changeTemplate, Name: name, Action: "added"})
+		case !inNext:
+			changes = append(changes, ConfigChange{Kind: changeTemplate, Name: name, Action: "removed"})
+		case old != text:
+			changes = append(changes, ConfigChange{Kind: changeTemplate, Name: name, Action: "changed"})
+		}
+	}
+	return changes
+}
+
+// splitDestination reports the destination fields among fields as a
+// change to destination, and the rest as a change of kind to name.
+func splitDestination(kind, name, destination string, fields []string) []ConfigChange {
+	var changes []ConfigChange
+	var other, dest []string
+	for _, field := range fields {
+		if destinationFields[field] {
+			dest = append(dest, field)
+		} else {
+			other = append(other, field)
+		}
+	}
+	if len(dest) > 0 {
+		changes = append(changes, ConfigChange{Kind: changeDestination, Name: destination, Action: "changed", Fields: dest})
+	}
+	if len(other) > 0 {
+		changes = append(changes, ConfigChange{Kind: kind, Name: name, Action: "changed", Fields: other})
+	}
+	return changes
+}
+
+// changedFields returns the TOML names of the fields that differ between
+// two values of the same struct type, or nil for other types. Fields of
+// embedded structs are listed as their own.
+func changedFields(a, b reflect.Value) []string {
+	if a.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if !field.IsExported() || reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			continue
+		}
+		if field.Anonymous {
+			fields = append(fields, changedFields(a.Field(i), b.Field(i))...)
+			continue
+		}
+		fields = append(fields, tomlName(field))
+	}
+	return fields
+}
+
+func tomlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// templateDefinitions returns the text of each named template in m, so
+// changes to template files are noticed as well as changes to the
+// configuration naming them.
+func templateDefinitions(m *MessageTemplates) map[string]string {
+	defs := map[string]string{}
+	if m == nil {
+		return defs
+	}
+	for _, t := range m.tmpl.Templates() {
+		if t.Name() != "" && t.Tree != nil {
+			defs[t.Name()] = t.Tree.Root.String()
+		}
+	}
+	return defs
+}
+
+// ConfigReload is the outcome of loading a new configuration: what it
+// changes, and whether it was applied or awaits confirmation.
+type ConfigReload struct {
+	Changes  []ConfigChange `json:"changes"`
+	LoadedAt time.Time      `json:"loadedAt"`
+	// Applied is false for a dry run or a reload awaiting confirmation.
+	Applied bool `json:"applied"`
+	Pending bool `json:"pending"`
+
+	runtime *Runtime
+}
+
+var pendingReload struct {
+	sync.Mutex
+	reload *ConfigReload
+}
+
+// reloadConfig loads and validates the configuration at path and logs what
+// it changes. It is swapped in on success, unless [reload] confirm is set
+// on the running configuration, in which case it is kept pending until
+// confirmed through the admin API. A configuration that changes nothing
+// is always applied. Settings that need a restart, such as the listen
+// address, are only read at startup.
+func reloadConfig(path string) (*ConfigReload, error) {
+	reload, err := loadConfigReload(path)
+	if err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		return nil, err
+	}
+	if len(reload.Changes) > 0 && getRuntime().Config.Reload.Confirm {
+		reload.Pending = true
+		pending := *reload
+		pendingReload.Lock()
+		pendingReload.reload = &pending
+		pendingReload.Unlock()
+		configReloads.WithLabelValues("pending").Inc()
+		logger.Info("Configuration change is pending confirmation through POST /api/v1/config/pending")
+		return reload, nil
+	}
+	pendingReload.Lock()
+	applyConfigReloadLocked(reload)
+	pendingReload.Unlock()
+	return reload, nil
+}
+
+// loadConfigReload loads the configuration at path and diffs it against
+// the running one, without applying it.
+func loadConfigReload(path string) (*ConfigReload, error) {
+	rt, err := loadRuntime(path)
+	if err != nil {
+		return nil, err
+	}
+	reload := &ConfigReload{Changes: diffRuntimes(getRuntime(), rt), LoadedAt: clock.Now(), runtime: rt}
+	if len(reload.Changes) == 0 {
+		logger.Info("Configuration loaded from %s has no changes", path)
+	}
+	for _, change := range reload.Changes {
+		logger.Info("Configuration change: %s", change)
+	}
+	return reload, nil
+}
+
+// applyConfigReloadLocked swaps in the configuration of reload, discarding
+// any pending one. The caller holds pendingReload.
+func applyConfigReloadLocked(reload *ConfigReload) {
+	currentRuntime.Store(reload.runtime)
+	checkChatCredentials(reload.runtime)
+	reload.Applied, reload.Pending = true, false
+	pendingReload.reload = nil
+	configReloads.WithLabelValues("success").Inc()
+}
+
+// configReloadHandler serves POST /api/v1/config/reload, which reloads the
+// configuration file like SIGHUP and answers with the changes, applied or
+// pending. With dry_run=true it only validates and diffs the file.
+func configReloadHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var reload *ConfigReload
+		var err error
+		if r.URL.Query().Get("dry_run") == "true" {
+			logger.Info("Checking configuration %s on request from %s", path, r.RemoteAddr)
+			reload, err = loadConfigReload(path)
+		} else {
+			logger.Info("Reloading configuration from %s on request from %s", path, r.RemoteAddr)
+			reload, err = reloadConfig(path)
+		}
+		if err != nil {
+			logger.Error("Configuration reload failed, keeping previous configuration: %v", err)
+			http.Error(w, fmt.Sprintf("Invalid configuration: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		status := http.StatusOK
+		if reload.Pending {
+			status = http.StatusAccepted
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(reload)
+	}
+}
+
+// pendingConfigHandler serves /api/v1/config/pending: GET shows the
+// configuration awaiting confirmation, POST applies it and DELETE
+// discards it.
+func pendingConfigHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost, http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pendingReload.Lock()
+	defer pendingReload.Unlock()
+	reload := pendingReload.reload
+	if reload == nil {
+		http.Error(w, "No configuration change is pending", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		logger.Info("Applying pending configuration on request from %s", r.RemoteAddr)
+		applyConfigReloadLocked(reload)
+		logger.Info("Configuration reloaded")
+	case http.MethodDelete:
+		logger.Info("Discarding pending configuration on request from %s", r.RemoteAddr)
+		pendingReload.reload = nil
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reload)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffRuntimes(t *testing.T) {
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "alerts.tmpl")
+	os.WriteFile(tmplFile, []byte(`{{ define "footer" }}Runbook{{ end }}`), 0o644)
+	base := Config{
+		GoogleChat: GoogleChatConfig{WebhookURL: "https://chat.example.com/default"},
+		Templates:  TemplatesConfig{Files: []string{tmplFile}},
+		Routes: []RouteConfig{
+			{Name: "ops", Matchers: []string{`team="ops"`}, WebhookURL: "https://chat.example.com/ops"},
+			{Name: "db", Matchers: []string{`team="db"`}},
+		},
+	}
+	prev, err := NewRuntime(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := base
+	next.GoogleChat.WebhookURL = "https://chat.example.com/rotated"
+	next.Summary.Interval = time.Hour
+	next.Routes = []RouteConfig{
+		{Name: "ops", Matchers: []string{`team="sre"`}, WebhookURL: "https://chat.example.com/ops2", DisableChat: true},
+		{Name: "web", Matchers: []string{`team="web"`}},
+	}
+	os.WriteFile(tmplFile, []byte(`{{ define "footer" }}Playbook{{ end }}{{ define "header" }}!{{ end }}`), 0o644)
+	rt, err := NewRuntime(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ConfigChange{
+		{Kind: changeDestination, Name: defaultRouteName, Action: "changed", Fields: []string{"webhook_url"}},
+		{Kind: changeSetting, Name: "summary", Action: "changed", Fields: []string{"interval"}},
+		{Kind: changeDestination, Name: "ops", Action: "changed", Fields: []string{"webhook_url"}},
+		{Kind: changeRoute, Name: "ops", Action: "changed", Fields: []string{"matchers", "disable_chat"}},
+		{Kind: changeRoute, Name: "web", Action: "added"},
+		{Kind: changeRoute, Name: "db", Action: "removed"},
+		{Kind: changeTemplate, Name: "footer", Action: "changed"},
+		{Kind: changeTemplate, Name: "header", Action: "added"},
+	}
+	if got := diffRuntimes(prev, rt); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffRuntimes() =\n%v\nwant\n%v", got, want)
+	}
+	if got := diffRuntimes(rt, rt); len(got) != 0 {
+		t.Errorf("diffRuntimes() of the same runtime = %v, want no changes", got)
+	}
+}
+
+func TestReloadConfigConfirm(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	defer func() { pendingReload.reload = nil }()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	base := "[reload]\nconfirm = true\n[google_chat]\nwebhook_url = \"https://chat.example.com/hook\"\n"
+	os.WriteFile(path, []byte(base), 0o644)
+	if reload, err := reloadConfig(path); err != nil || !reload.Applied {
+		t.Fatalf("reloadConfig() = %+v, %v, want the first configuration applied", reload, err)
+	}
+
+	os.WriteFile(path, []byte(base+"[summary]\ninterval = \"1h\"\n"), 0o644)
+	post := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler := http.Handler(configReloadHandler(path))
+		if url == "/api/v1/config/pending" {
+			handler = http.HandlerFunc(pendingConfigHandler)
+		}
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url, nil))
+		return rec
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		wantStatus  int
+		wantApplied bool
+		wantPending bool
+	}{
+		{name: "dry run", url: "/api/v1/config/reload?dry_run=true", wantStatus: http.StatusOK},
+		{name: "reload waits for confirmation", url: "/api/v1/config/reload", wantStatus: http.StatusAccepted, wantPending: true},
+		{name: "confirm", url: "/api/v1/config/pending", wantStatus: http.StatusOK, wantApplied: true},
+		{name: "nothing left to confirm", url: "/api/v1/config/pending", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(tt.url)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusNotFound {
+				return
+			}
+			var reload ConfigReload
+			if err := json.NewDecoder(rec.Body).Decode(&reload); err != nil {
+				t.Fatal(err)
+			}
+			if reload.Applied != tt.wantApplied || reload.Pending != tt.wantPending || len(reload.Changes) != 1 {
+				t.Errorf("Unexpected reload %+v", reload)
+			}
+			applied := getRuntime().Config.Summary.Interval != 0
+			if applied != tt.wantApplied {
+				t.Errorf("configuration applied = %v, want %v", applied, tt.wantApplied)
+			}
+		})
+	}
+
+	os.WriteFile(path, []byte("[[silence]]\nmatchers = []\n"), 0o644)
+	if rec := post("/api/v1/config/reload?dry_run=true"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d for an invalid configuration, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriterProvider prints messages as indented JSON instead of delivering
+// them. It backs replay --dry-run.
+type WriterProvider struct {
+	Out io.Writer
+}
+
+func (p *WriterProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error {
+	payload, err := json.MarshalIndent(message, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling Google Chat message: %v", err)
+	}
+	_, err = fmt.Fprintf(p.Out, "# %s\n%s\n", opts.ReqID, payload)
+	return err
+}
+
+// runReplay implements the replay subcommand: every recorded payload is
+// pushed through processPayload using the current configuration.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Print rendered messages instead of sending them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [--config file] replay [--dry-run] <file|dir>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var provider Provider
+	if *dryRun {
+		provider = &WriterProvider{Out: os.Stdout}
+		currentRuntime.Store(withoutRouteProviders(getRuntime()))
+	} else {
+		if err := config.Validate(); err != nil {
+			logger.Error("Configuration validation failed: %v", err)
+			return 1
+		}
+		provider = reloadableProvider{}
+	}
+
+	files, err := recordedFiles(fs.Args())
+	if err != nil {
+		logger.Error("Error listing recordings: %v", err)
+		return 1
+	}
+
+	failed := 0
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			logger.Error("Error reading %s: %v", file, err)
+			failed++
+			continue
+		}
+
+		reqID := "replay-" + filepath.Base(file)
+		if err := processPayload(context.Background(), body, reqID, provider); err != nil {
+			logger.Error("[%s] Replay failed: %v", reqID, err)
+			failed++
+			continue
+		}
+		logger.Info("[%s] Replayed successfully", reqID)
+	}
+
+	logger.Info("Replayed %d recording(s), %d failed", len(files), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// withoutRouteProviders returns a copy of rt whose routes all deliver through
+// the default provider, so a dry run never reaches a real destination.
+// Webhook maps and templates are dropped too, since they pick a provider
+// per payload.
+func withoutRouteProviders(rt *Runtime) *Runtime {
+	dry := *rt
+	dry.Routes = make([]*Route, len(rt.Routes))
+	for i, r := range rt.Routes {
+		route := *r
+		route.Provider = nil
+		route.WebhookMap = nil
+		route.WebhookTemplate = nil
+		dry.Routes[i] = &route
+	}
+	return &dry
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxReportRows caps the rows in each table of the report.
+const maxReportRows = 10
+
+// ReportSchedule is a compiled [report] block: when the stakeholder report
+// is emailed and which period it covers.
+type ReportSchedule struct {
+	weekly bool
+	// at is minutes after midnight in loc.
+	at      int
+	weekday time.Weekday
+	loc     *time.Location
+}
+
+// NewReportSchedule compiles cfg, returning nil when no schedule is
+// configured.
+func NewReportSchedule(cfg ReportConfig) (*ReportSchedule, error) {
+	if cfg.Schedule == "" {
+		return nil, nil
+	}
+
+	s := &ReportSchedule{loc: time.Local}
+	switch cfg.Schedule {
+	case "daily":
+	case "weekly":
+		s.weekly = true
+		weekday, ok := parseWeekday(cfg.Weekday)
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", cfg.Weekday)
+		}
+		s.weekday = weekday
+	default:
+		return nil, fmt.Errorf("schedule must be daily or weekly, not %q", cfg.Schedule)
+	}
+
+	var err error
+	if s.at, err = parseClock(cfg.At); err != nil {
+		return nil, fmt.Errorf("invalid at: %v", err)
+	}
+	if cfg.Timezone != "" {
+		if s.loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// parseWeekday parses a day name such as "monday", defaulting to Monday.
+func parseWeekday(s string) (time.Weekday, bool) {
+	if s == "" {
+		return time.Monday, true
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) || strings.EqualFold(s, d.String()[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// Last returns the most recent scheduled report time at or before now.
+func (s *ReportSchedule) Last(now time.Time) time.Time {
+	now = now.In(s.loc)
+	last := time.Date(now.Year(), now.Month(), now.Day(), s.at/60, s.at%60, 0, 0, s.loc)
+	if last.After(now) {
+		last = last.AddDate(0, 0, -1)
+	}
+	for s.weekly && last.Weekday() != s.weekday {
+		last = last.AddDate(0, 0, -1)
+	}
+	return last
+}
+
+// Next returns the first scheduled report time after now.
+func (s *ReportSchedule) Next(now time.Time) time.Time {
+	next := s.Last(now)
+	for !next.After(now) || (s.weekly && next.Weekday() != s.weekday) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (s *ReportSchedule) String() string {
+	at := fmt.Sprintf("%02d:%02d %s", s.at/60, s.at%60, s.loc)
+	if s.weekly {
+		return "weekly on " + s.weekday.String() + " at " + at
+	}
+	return "daily at " + at
+}
+
+// Period returns the start of the period covered by the report sent at t.
+func (s *ReportSchedule) Period(t time.Time) time.Time {
+	if s.weekly {
+		return t.AddDate(0, 0, -7)
+	}
+	return t.AddDate(0, 0, -1)
+}
+
+// Report summarizes the notifications delivered over a period.
+type Report struct {
+	From, To      time.Time
+	Notifications int
+	Alerts        int
+	Resolved      int
+	// MTTR is the mean time from firing to resolved over the alerts that
+	// resolved in the period.
+	MTTR      time.Duration
+	TopAlerts []ReportAlert
+	TopRules  []ReportRule
+	ByRoute   []ReportCount
+}
+
+// ReportAlert is a single alert and the notifications sent for it.
+type ReportAlert struct {
+	Alertname     string
+	Labels        string
+	Notifications int
+}
+
+// ReportRule aggregates the alerts sharing an alert name.
+type ReportRule struct {
+	Alertname     string
+	Notifications int
+	Alerts        int
+	MTTR          time.Duration
+}
+
+// ReportCount is a number of notifications for a name.
+type ReportCount struct {
+	Name  string
+	Count int
+}
+
+// buildReport aggregates the history entries recorded in [from, to). Alerts
+// and rules are sorted by notifications, noisiest first.
+func buildReport(entries []HistoryEntry, from, to time.Time) Report {
+	report := Report{From: from, To: to}
+
+	type ruleStats struct {
+		ReportRule
+		alerts   map[string]bool
+		resolved int
+		total    time.Duration
+	}
+	alerts := map[string]*ReportAlert{}
+	rules := map[string]*ruleStats{}
+	routes := map[string]int{}
+	resolved := map[string]bool{}
+	var total time.Duration
+
+	for _, entry := range entries {
+		report.Notifications++
+		routes[entry.Route]++
+
+		alert, ok := alerts[entry.Key]
+		if !ok {
+			alert = &ReportAlert{
+				Alertname: entry.Alertname,
+				Labels:    entry.Labels.Remove([]string{"alertname"}).SortedPairs().String(),
+			}
+			alerts[entry.Key] = alert
+		}
+		alert.Notifications++
+
+		rule, ok := rules[entry.Alertname]
+		if !ok {
+			rule = &ruleStats{ReportRule: ReportRule{Alertname: entry.Alertname}, alerts: map[string]bool{}}
+			rules[entry.Alertname] = rule
+		}
+		rule.Notifications++
+		rule.alerts[entry.Key] = true
+
+		// Repeated resolved notifications for one firing count once.
+		if entry.Status == "resolved" && !entry.StartsAt.IsZero() && entry.EndsAt.After(entry.StartsAt) {
+			if !resolved[entry.Key+entry.StartsAt.String()] {
+				resolved[entry.Key+entry.StartsAt.String()] = true
+				d := entry.EndsAt.Sub(entry.StartsAt)
+				report.Resolved++
+				total += d
+				rule.resolved++
+				rule.total += d
+			}
+		}
+	}
+
+	report.Alerts = len(alerts)
+	if report.Resolved > 0 {
+		report.MTTR = total / time.Duration(report.Resolved)
+	}
+
+	for _, alert := range alerts {
+		report.TopAlerts = append(report.TopAlerts, *alert)
+	}
+	sort.Slice(report.TopAlerts, func(i, j int) bool {
+		a, b := report.TopAlerts[i], report.TopAlerts[j]
+		if a.Notifications != b.Notifications {
+			return a.Notifications > b.Notifications
+		}
+		if a.Alertname != b.Alertname {
+			return a.Alertname < b.Alertname
+		}
+		return a.Labels < b.Labels
+	})
+
+	for _, rule := range rules {
+		rule.Alerts = len(rule.alerts)
+		if rule.resolved > 0 {
+			rule.MTTR = rule.total / time.Duration(rule.resolved)
+		}
+		report.TopRules = append(report.TopRules, rule.ReportRule)
+	}
+	sort.Slice(report.TopRules, func(i, j int) bool {
+		a, b := report.TopRules[i], report.TopRules[j]
+		if a.Notifications != b.Notifications {
+			return a.Notifications > b.Notifications
+		}
+		return a.Alertname < b.Alertname
+	})
+
+	for name, count := range routes {
+		report.ByRoute = append(report.ByRoute, ReportCount{Name: name, Count: count})
+	}
+	sort.Slice(report.ByRoute, func(i, j int) bool {
+		a, b := report.ByRoute[i], report.ByRoute[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+
+	return report
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string {
+		if d == 0 {
+			return "-"
+		}
+		return formatDuration(d)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #202124;">
+<h2>Alert report</h2>
+<p>{{ .From.Format "Mon Jan 2 15:04" }} to {{ .To.Format "Mon Jan 2 15:04 MST" }}</p>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr><td>Notifications sent</td><td><b>{{ .Notifications }}</b></td></tr>
+<tr><td>Distinct alerts</td><td><b>{{ .Alerts }}</b></td></tr>
+<tr><td>Alerts resolved</td><td><b>{{ .Resolved }}</b></td></tr>
+<tr><td>Mean time to resolve</td><td><b>{{ duration .MTTR }}</b></td></tr>
+</table>
+{{- if .TopRules }}
+<h3>Noisiest rules</h3>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+<tr><th align="left">Alert</th><th>Notifications</th><th>Alerts</th><th>Mean time to resolve</th></tr>
+{{- range .TopRules }}
+<tr><td>{{ .Alertname }}</td><td align="right">{{ .Notifications }}</td><td align="right">{{ .Alerts }}</td><td align="right">{{ duration .MTTR }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .TopAlerts }}
+<h3>Top alerts</h3>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+<tr><th align="left">Alert</th><th align="left">Labels</th><th>Notifications</th></tr>
+{{- range .TopAlerts }}
+<tr><td>{{ .Alertname }}</td><td>{{ .Labels }}</td><td align="right">{{ .Notifications }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .ByRoute }}
+<h3>Notifications by route</h3>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+{{- range .ByRoute }}
+<tr><td>{{ .Name }}</td><td align="right">{{ .Count }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if not .Notifications }}
+<p>No notifications were sent in this period.</p>
+{{- end }}
+</body>
+</html>
+`))
+
+// HTML renders the report as an email body, listing the top entries of
+// each table.
+func (r Report) HTML() (string, error) {
+	if len(r.TopAlerts) > maxReportRows {
+		r.TopAlerts = r.TopAlerts[:maxReportRows]
+	}
+	if len(r.TopRules) > maxReportRows {
+		r.TopRules = r.TopRules[:maxReportRows]
+	}
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, r); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// reportPeriod returns the period covered by a report ending at now: the
+// last scheduled period, or the past week without a schedule.
+func reportPeriod(s *ReportSchedule, now time.Time) (time.Time, time.Time) {
+	if s == nil {
+		return now.AddDate(0, 0, -7), now
+	}
+	to := s.Last(now)
+	return s.Period(to), to
+}
+
+// sendReport emails the report for [from, to) to the configured recipients.
+func sendReport(cfg Config, from, to time.Time, reqID string) error {
+	report := buildReport(history.Between(from, to), from, to)
+	html, err := report.HTML()
+	if err != nil {
+		return fmt.Errorf("error rendering report: %v", err)
+	}
+	subject := cfg.Report.Subject
+	if subject == "" {
+		subject = "Alert report"
+	}
+	subject = fmt.Sprintf("%s: %s - %s", subject, from.Format("Jan 2"), to.Format("Jan 2"))
+	logger.Info("[%s] Emailing report of %d notification(s) to %s", reqID, report.Notifications, strings.Join(cfg.Report.To, ", "))
+	return sendEmail(cfg.Email, cfg.Report.To, subject, html)
+}
+
+// reportHandler renders the report for the last period as HTML on GET and
+// emails it on POST.
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	rt := getRuntime()
+	from, to := reportPeriod(rt.Reports, clock.Now())
+
+	switch r.Method {
+	case http.MethodGet:
+		html, err := buildReport(history.Between(from, to), from, to).HTML()
+		if err != nil {
+			logger.Error("Error rendering report: %v", err)
+			http.Error(w, "Error rendering report", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, html)
+	case http.MethodPost:
+		if len(rt.Config.Report.To) == 0 {
+			http.Error(w, "No report recipients configured", http.StatusBadRequest)
+			return
+		}
+		reqID := newRequestID("report")
+		if err := sendReport(rt.Config, from, to, reqID); err != nil {
+			logger.Error("[%s] Error sending report: %v", reqID, err)
+			http.Error(w, "Error sending report", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "Report sent to %d recipient(s)", len(rt.Config.Report.To))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportScheduleLast(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ReportConfig
+		now  string
+		want string
+	}{
+		{"daily after time", ReportConfig{Schedule: "daily", At: "08:00"}, "2024-05-15T09:00:00Z", "2024-05-15T08:00:00Z"},
+		{"daily before time", ReportConfig{Schedule: "daily", At: "08:00"}, "2024-05-15T07:59:00Z", "2024-05-14T08:00:00Z"},
+		{"weekly default monday", ReportConfig{Schedule: "weekly", At: "08:00"}, "2024-05-15T09:00:00Z", "2024-05-13T08:00:00Z"},
+		{"weekly on the day before time", ReportConfig{Schedule: "weekly", At: "08:00", Weekday: "wed"}, "2024-05-15T07:00:00Z", "2024-05-08T08:00:00Z"},
+		{"timezone", ReportConfig{Schedule: "daily", At: "08:00", Timezone: "Europe/Berlin"}, "2024-05-15T07:00:00Z", "2024-05-15T06:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewReportSchedule(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewReportSchedule() error = %v", err)
+			}
+			now, _ := time.Parse(time.RFC3339, tt.now)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if got := s.Last(now); !got.Equal(want) {
+				t.Errorf("Last() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	for _, cfg := range []ReportConfig{
+		{Schedule: "hourly", At: "08:00"},
+		{Schedule: "daily", At: "8am"},
+		{Schedule: "weekly", At: "08:00", Weekday: "someday"},
+	} {
+		if _, err := NewReportSchedule(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	start := time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC)
+	var entries []HistoryEntry
+	add := func(name, instance, status string, at time.Duration, endsAt time.Duration) {
+		entry := HistoryEntry{
+			At:        start.Add(at),
+			Key:       name + instance,
+			Alertname: name,
+			Labels:    KV{"alertname": name, "instance": instance},
+			Status:    status,
+			Route:     "ops",
+			StartsAt:  start,
+		}
+		if status == "resolved" {
+			entry.EndsAt = start.Add(endsAt)
+		}
+		entries = append(entries, entry)
+	}
+	add("DiskFull", "a", "firing", time.Minute, 0)
+	add("DiskFull", "a", "firing", time.Hour, 0)
+	add("DiskFull", "a", "resolved", 2*time.Hour, 2*time.Hour)
+	add("DiskFull", "a", "resolved", 3*time.Hour, 2*time.Hour)
+	add("DiskFull", "b", "firing", time.Minute, 0)
+	add("HighLatency", "c", "resolved", time.Hour, 30*time.Minute)
+
+	report := buildReport(entries, start, start.Add(24*time.Hour))
+	if report.Notifications != 6 || report.Alerts != 3 || report.Resolved != 2 {
+		t.Errorf("Unexpected totals %+v", report)
+	}
+	if report.MTTR != 75*time.Minute {
+		t.Errorf("MTTR = %v, want 1h15m", report.MTTR)
+	}
+	if report.TopRules[0].Alertname != "DiskFull" || report.TopRules[0].Notifications != 5 || report.TopRules[0].Alerts != 2 || report.TopRules[0].MTTR != 2*time.Hour {
+		t.Errorf("Unexpected top rule %+v", report.TopRules[0])
+	}
+	if report.TopAlerts[0].Labels != "instance=a" || report.TopAlerts[0].Notifications != 4 {
+		t.Errorf("Unexpected top alert %+v", report.TopAlerts[0])
+	}
+
+	html, err := report.HTML()
+	if err != nil {
+		t.Fatalf("HTML() error = %v", err)
+	}
+	for _, want := range []string{"Noisiest rules", "DiskFull", "1h15m", "instance=a"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Report HTML missing %q", want)
+		}
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now()
+	h, err := LoadHistory(path, now, historyRetention)
+	if err != nil {
+		t.Fatalf("LoadHistory() error = %v", err)
+	}
+	payload := &AlertManagerPayload{Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "A"}}}}
+	if err := h.Record("req", "ops", payload, now.Add(-40*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Record("req", "ops", payload, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err = LoadHistory(path, now, historyRetention)
+	if err != nil {
+		t.Fatalf("LoadHistory() error = %v", err)
+	}
+	entries := h.Between(now.Add(-7*24*time.Hour), now)
+	if len(entries) != 1 || entries[0].Alertname != "A" || entries[0].Route != "ops" {
+		t.Errorf("Unexpected entries after reload: %+v", entries)
+	}
+	if len(h.entries) != 1 {
+		t.Errorf("Expected expired entries to be dropped, got %d", len(h.entries))
+	}
+}
+
+// fakeSMTPServer accepts one message and sends it on the returned channel.
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					messages <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 Go ahead")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), messages
+}
+
+func TestReportHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	addr, messages := fakeSMTPServer(t)
+
+	defer func() { history = NewHistory("") }()
+	history = NewHistory("")
+	now := time.Now()
+	history.Record("req", "ops", &AlertManagerPayload{Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": "DiskFull"}}}}, now.Add(-time.Hour))
+
+	rt := &Runtime{Config: Config{
+		Email:  EmailConfig{Smarthost: addr, From: "alerts@example.com"},
+		Report: ReportConfig{To: []string{"eng-managers@example.com"}, Subject: "Weekly alerts"},
+	}}
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(rt)
+
+	rr := httptest.NewRecorder()
+	reportHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/report", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "DiskFull") {
+		t.Errorf("Unexpected preview %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	reportHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/report", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	select {
+	case msg := <-messages:
+		for _, want := range []string{"To: eng-managers@example.com", "Subject: Weekly alerts: ", "Content-Type: text/html", "DiskFull"} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("Email missing %q:\n%s", want, msg)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No email received")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Route is a compiled [[routes]] entry.
+type Route struct {
+	Name     string
+	Matchers Matchers
+	// Expr is an optional CEL condition checked after the matchers.
+	Expr *Expression
+	// Receivers, when set, restricts the route to notifications for these
+	// AlertManager receivers.
+	Receivers []string
+	// Provider delivers messages for the route. A nil Provider uses the
+	// default Google Chat webhook.
+	Provider Provider
+	// WebhookMap, when set, picks the provider by label value instead.
+	WebhookMap *WebhookMap
+	// WebhookTemplate, when set, renders the webhook URL per notification
+	// instead.
+	WebhookTemplate *WebhookTemplate
+	// Destination identifies the webhook within the route when it is picked
+	// by WebhookMap or WebhookTemplate.
+	Destination string
+	Policy      *DeliveryPolicy
+	// Tickets are filed for alert groups using the route.
+	Tickets []TicketProvider
+	// DisableChat skips the Chat notification and only files tickets.
+	DisableChat bool
+	// ServeWebhook serves the route at routeWebhookPath + Name.
+	ServeWebhook bool
+	// Continue also notifies the next matching routes.
+	Continue bool
+	// Additive marks routes built from ChatRoute resources. They are
+	// notified in addition to the configured routes, never instead of them.
+	Additive bool
+	// LabelColumns overrides the layout's label_columns when not nil.
+	LabelColumns []string
+	// ChipLabels overrides the layout's chip_labels when not nil.
+	ChipLabels []string
+	// RepeatIntervals is the minimum interval between notifications of a
+	// firing alert, by lower-case severity or anySeverity.
+	RepeatIntervals map[string]time.Duration
+	// Sandbox applies the route's template limits to the message, ticket
+	// and webhook URL templates rendered for it.
+	Sandbox *TemplateSandbox
+}
+
+const defaultRouteName = "default"
+
+// NewRoutes compiles the configured routes and the default route used when
+// none match. chat delivers to routes configured by space and may be nil
+// when none are.
+func NewRoutes(cfg Config, chat *ChatAPI) ([]*Route, *Route, error) {
+	snippets, err := parseSnippets(cfg.Templates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	routes := make([]*Route, 0, len(cfg.Routes))
+	for _, rc := range cfg.Routes {
+		matchers, err := ParseMatchers(rc.Matchers)
+		if err != nil {
+			return nil, nil, fmt.Errorf("route %s: %v", rc.Name, err)
+		}
+
+		var expr *Expression
+		if rc.Expr != "" {
+			if expr, err = CompileExpression(rc.Expr); err != nil {
+				return nil, nil, fmt.Errorf("route %s: invalid expr: %v", rc.Name, err)
+			}
+		}
+
+		delivery := cfg.Delivery.Merge(rc.Delivery)
+		route := &Route{
+			Name:         rc.Name,
+			Matchers:     matchers,
+			Expr:         expr,
+			Receivers:    rc.Receivers,
+			Policy:       NewDeliveryPolicy(delivery),
+			DisableChat:  rc.DisableChat,
+			ServeWebhook: rc.ServeWebhook,
+			Continue:     rc.Continue,
+			LabelColumns: rc.LabelColumns,
+			ChipLabels:   rc.ChipLabels,
+			Sandbox:      NewTemplateSandbox(rc.Name, cfg.Templates.Limits.Merge(rc.TemplateLimits)),
+		}
+		if len(rc.RepeatInterval) > 0 {
+			route.RepeatIntervals = map[string]time.Duration{}
+			for severity, d := range rc.RepeatInterval {
+				route.RepeatIntervals[strings.ToLower(severity)] = d
+			}
+		}
+		if rc.Jira != nil {
+			jira, err := NewJiraProvider(*rc.Jira, rc.Name, snippets, route.Sandbox)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			route.Tickets = append(route.Tickets, jira)
+		}
+		if rc.GitHub != nil {
+			github, err := NewGitHubProvider(*rc.GitHub, rc.Name, snippets, route.Sandbox)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			route.Tickets = append(route.Tickets, github)
+		}
+		if rc.GrafanaOnCall != nil {
+			route.Tickets = append(route.Tickets, NewGrafanaOnCallProvider(*rc.GrafanaOnCall))
+		}
+		if rc.WebhookMap != "" {
+			route.WebhookMap, err = LoadWebhookMap(rc.WebhookMap, rc.WebhookMapLabel, delivery.Timeout, rc.OutboundConfig)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+		} else if isWebhookTemplate(rc.WebhookURL) {
+			route.WebhookTemplate, err = NewWebhookTemplate(rc.WebhookURL, rc.AllowedHosts, delivery.Timeout, rc.OutboundConfig, route.Sandbox)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+		} else if rc.Space != "" {
+			if chat == nil {
+				return nil, nil, fmt.Errorf("route %s: space requires Chat API credentials", rc.Name)
+			}
+			route.Provider = &ChatAPIProvider{API: chat, Space: rc.Space}
+		} else if rc.WebhookURL != "" || len(rc.Headers) > 0 || rc.BearerToken != "" || rc.BearerTokenFile != "" || rc.TLS.enabled() {
+			webhookURL := rc.WebhookURL
+			if webhookURL == "" {
+				webhookURL = cfg.GoogleChat.WebhookURL
+			}
+			route.Provider, err = NewGoogleChatProvider(webhookURL, delivery.Timeout, rc.OutboundConfig)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+		}
+		routes = append(routes, route)
+	}
+
+	defaultRoute := &Route{
+		Name:    defaultRouteName,
+		Policy:  NewDeliveryPolicy(cfg.Delivery),
+		Sandbox: NewTemplateSandbox(defaultRouteName, cfg.Templates.Limits),
+	}
+	return routes, defaultRoute, nil
+}
+
+// routingLabels returns the labels a payload is routed on: the labels
+// common to all alerts, or the first alert's labels when AlertManager did
+// not send any.
+func routingLabels(payload *AlertManagerPayload) KV {
+	if len(payload.CommonLabels) > 0 {
+		return payload.CommonLabels
+	}
+	if len(payload.Alerts) > 0 {
+		return payload.Alerts[0].Labels
+	}
+	return KV{}
+}
+
+// Route returns the first route matching the payload, or the default route.
+func (rt *Runtime) Route(payload *AlertManagerPayload) *Route {
+	return rt.MatchingRoutes(payload)[0]
+}
+
+// MatchingRoutes returns the routes notified for the payload: the first
+// matching route, followed by the next matching routes for as long as the
+// matched routes have continue set. ChatRoute routes always continue.
+// Without a match among the configured routes it adds the default route. A
+// payload naming its route skips matching and uses that route.
+func (rt *Runtime) MatchingRoutes(payload *AlertManagerPayload) []*Route {
+	labels := routingLabels(payload)
+	var vars map[string]interface{}
+	var matched []*Route
+	for _, r := range rt.routes() {
+		m := r.match(payload, labels, &vars)
+		if m == nil {
+			continue
+		}
+		matched = append(matched, m)
+		if !(r.Continue || r.Additive) || payload.Route != "" {
+			break
+		}
+	}
+	if n := len(matched); n > 0 && (payload.Route != "" || !matched[n-1].Additive) {
+		return matched
+	}
+	if !payload.allowsRoute(defaultRouteName) {
+		return matched
+	}
+	if rt.DefaultRoute != nil {
+		return append(matched, rt.DefaultRoute)
+	}
+	return append(matched, &Route{Name: defaultRouteName})
+}
+
+// allowsRoute reports whether the payload may be sent to the named route.
+func (p *AlertManagerPayload) allowsRoute(name string) bool {
+	return p.AllowedRoutes == nil || slices.Contains(p.AllowedRoutes, name)
+}
+
+// match returns the route when it matches the payload, and nil otherwise.
+// vars holds the CEL activation, built on first use. For a route with a
+// webhook map or template, it returns a copy of the route using the
+// provider picked for the payload, and nil when the label value is not
+// mapped or the template does not render an allowed URL.
+func (r *Route) match(payload *AlertManagerPayload, labels KV, vars *map[string]interface{}) *Route {
+	if payload.Route != "" && r.Name != payload.Route {
+		return nil
+	}
+	if !payload.allowsRoute(r.Name) {
+		return nil
+	}
+	if payload.Route == "" && len(r.Receivers) > 0 && !slices.Contains(r.Receivers, payload.Receiver) {
+		return nil
+	}
+	if payload.Route == "" && !r.Matchers.Matches(labels) {
+		return nil
+	}
+	if payload.Route == "" && r.Expr != nil {
+		if *vars == nil {
+			*vars = celActivation(payload)
+		}
+		ok, err := r.Expr.Eval(*vars)
+		if err != nil {
+			logger.Error("Route %s: error evaluating expr: %v", r.Name, err)
+			return nil
+		}
+		if !ok {
+			return nil
+		}
+	}
+	if r.WebhookMap != nil {
+		provider, ok := r.WebhookMap.Lookup(labels)
+		if !ok {
+			return nil
+		}
+		mapped := *r
+		mapped.Provider = provider
+		mapped.Destination = labels[r.WebhookMap.Label]
+		return &mapped
+	}
+	if r.WebhookTemplate != nil {
+		provider, destination, err := r.WebhookTemplate.Lookup(payload)
+		if err != nil {
+			logger.Error("Route %s: %v", r.Name, err)
+			return nil
+		}
+		mapped := *r
+		mapped.Provider = provider
+		mapped.Destination = destination
+		return &mapped
+	}
+	return r
+}
+
+// routes returns the routes built from ChatRoute resources, which only
+// match alerts from their own namespace, followed by the configured routes.
+// The ChatRoute routes are copies delivering with rt's policy.
+func (rt *Runtime) routes() []*Route {
+	dynamic := kubernetesRoutes.Load()
+	if dynamic == nil || len(*dynamic) == 0 {
+		return rt.Routes
+	}
+	routes := make([]*Route, 0, len(*dynamic)+len(rt.Routes))
+	for _, r := range *dynamic {
+		route := *r
+		route.Policy = rt.ChatRoutePolicy
+		routes = append(routes, &route)
+	}
+	return append(routes, rt.Routes...)
+}
+
+// Layout returns the card layout for the route, based on the global one.
+func (r *Route) Layout(global LayoutConfig) LayoutConfig {
+	if r.LabelColumns != nil {
+		global.LabelColumns = r.LabelColumns
+	}
+	if r.ChipLabels != nil {
+		global.ChipLabels = r.ChipLabels
+	}
+	return global
+}
+
+// Send delivers message via the route's provider, falling back to the
+// default provider. Delivery gives up once ctx is done.
+func (r *Route) Send(ctx context.Context, defaultProvider Provider, message *GoogleChatMessage, reqID string) error {
+	provider := r.Provider
+	if provider == nil {
+		provider = defaultProvider
+	}
+	return r.Policy.Send(ctx, provider, message, SendOptions{ReqID: reqID, Route: r.Name, Destination: outboxDestination(r)})
+}
+
+// RouteTest is the route an alert with the given labels would be delivered
+// through.
+type RouteTest struct {
+	Route       string `json:"route"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// labelsPayload returns a payload with one firing alert with labels, for
+// routing it without delivering anything.
+func labelsPayload(labels KV) *AlertManagerPayload {
+	return &AlertManagerPayload{
+		Status:       "firing",
+		CommonLabels: labels,
+		Alerts:       []Alert{{Status: "firing", Labels: labels}},
+	}
+}
+
+// routeTestHandler serves POST /api/v1/routes/test, which routes a firing
+// alert with the labels and receiver in the body without delivering
+// anything.
+func routeTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Labels   KV     `json:"labels"`
+		Receiver string `json:"receiver"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil || len(body.Labels) == 0 {
+		http.Error(w, "Body must be a JSON object with labels", http.StatusBadRequest)
+		return
+	}
+	payload := labelsPayload(body.Labels)
+	payload.Receiver = body.Receiver
+	route := getRuntime().Route(payload)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RouteTest{Route: route.Name, Destination: outboxDestination(route)})
+}
+
+// routeWebhookPath is where routes with serve_webhook accept alerts, under
+// their name.
+const routeWebhookPath = "/webhook/"
+
+// routeWebhookHandler accepts webhooks for the routes with serve_webhook,
+// sending the alerts to the route named by the path whatever its matchers.
+// Other names answer 404. Routes are looked up on each request, so routes
+// added by a reload are served without a restart.
+func routeWebhookHandler(provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, routeWebhookPath)
+		for _, route := range getRuntime().Routes {
+			if route.ServeWebhook && route.Name == name {
+				handleWebhookWithProvider(w, r.WithContext(withForcedRoute(r.Context(), name)), provider)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Runtime is the hot-reloadable state derived from a Config. A new Runtime
+// is built and validated in full before it replaces the current one, so a
+// bad reload never leaves the bridge half-configured.
+type Runtime struct {
+	Config    Config
+	Templates *MessageTemplates
+	Jsonnet   *JsonnetRenderer
+	Silences  []*Silence
+	// QuietHours is nil when no quiet hours window is configured.
+	QuietHours *QuietHours
+	Filters    []*Filter
+	Transform  *Transformer
+	OnCall     *OnCallResolver
+	// Enrichments includes the on-call lookup when one is configured.
+	Enrichments Enrichments
+	Redactor    *Redactor
+	// Normalizer is nil when no labels are dropped, renamed or limited.
+	Normalizer *Normalizer
+	// Incidents is nil when incident spaces are disabled.
+	Incidents *IncidentPolicy
+	// Reports is nil when no report schedule is configured.
+	Reports *ReportSchedule
+	// AllClear is nil when no all-clear summary is scheduled.
+	AllClear *AllClearSchedule
+	// Jobs are run by the scheduler.
+	Jobs []Job
+	// Chat is nil when no Chat API credentials are configured.
+	Chat *ChatAPI
+
+	Routes       []*Route
+	DefaultRoute *Route
+	// ChatRoutePolicy delivers for the routes built from ChatRoute
+	// resources. Those outlive reloads, so they use the active Runtime's
+	// policy rather than one of their own.
+	ChatRoutePolicy *DeliveryPolicy
+	// Provider delivers to the default Google Chat webhook.
+	Provider Provider
+}
+
+var currentRuntime atomic.Pointer[Runtime]
+
+// NewRuntime compiles everything in cfg that is applied per request.
+func NewRuntime(cfg Config) (*Runtime, error) {
+	templates, err := NewMessageTemplates(cfg.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load templates: %v", err)
+	}
+
+	jsonnet, err := NewJsonnetRenderer(cfg.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jsonnet template: %v", err)
+	}
+
+	transform, err := NewTransformer(cfg.Transform, cfg.Templates.Limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transform script: %v", err)
+	}
+
+	onCall, err := NewOnCallResolver(cfg.OnCall)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load on-call settings: %v", err)
+	}
+
+	enrichments, err := NewEnrichments(cfg.Enrichments, onCall)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrichments: %v", err)
+	}
+
+	silences, err := NewSilences(cfg.Silences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load silences: %v", err)
+	}
+
+	quietHours, err := NewQuietHours(cfg.QuietHours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quiet hours: %v", err)
+	}
+
+	reports, err := NewReportSchedule(cfg.Report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load report schedule: %v", err)
+	}
+
+	allClear, err := NewAllClearSchedule(cfg.AllClear)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load all-clear schedule: %v", err)
+	}
+
+	jobs, err := newJobs(cfg, reports, allClear)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scheduled jobs: %v", err)
+	}
+
+	filters, err := NewFilters(cfg.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load filters: %v", err)
+	}
+
+	normalizer, err := NewNormalizer(cfg.Normalize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load label normalization: %v", err)
+	}
+
+	redactor, err := NewRedactor(cfg.Redact)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load redaction rules: %v", err)
+	}
+
+	var scopes []string
+	if cfg.Incidents.Enabled {
+		scopes = incidentScopes
+	}
+	chat, err := NewChatAPI(cfg.GoogleChat, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Chat API client: %v", err)
+	}
+	incidentPolicy, err := NewIncidentPolicy(cfg.Incidents, chat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load incident settings: %v", err)
+	}
+
+	routes, defaultRoute, err := NewRoutes(cfg, chat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routes: %v", err)
+	}
+
+	var provider Provider
+	if cfg.GoogleChat.Space != "" {
+		if chat == nil {
+			return nil, fmt.Errorf("Google Chat space requires Chat API credentials")
+		}
+		provider = &ChatAPIProvider{API: chat, Space: cfg.GoogleChat.Space}
+	} else {
+		provider, err = NewGoogleChatProvider(cfg.GoogleChat.WebhookURL, cfg.Delivery.Timeout, cfg.GoogleChat.OutboundConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Google Chat provider: %v", err)
+		}
+	}
+
+	return &Runtime{
+		Config:          cfg,
+		Templates:       templates,
+		Jsonnet:         jsonnet,
+		Silences:        silences,
+		QuietHours:      quietHours,
+		Filters:         filters,
+		Transform:       transform,
+		OnCall:          onCall,
+		Enrichments:     enrichments,
+		Redactor:        redactor,
+		Normalizer:      normalizer,
+		Incidents:       incidentPolicy,
+		Reports:         reports,
+		AllClear:        allClear,
+		Jobs:            jobs,
+		Chat:            chat,
+		Routes:          routes,
+		DefaultRoute:    defaultRoute,
+		ChatRoutePolicy: NewDeliveryPolicy(cfg.Delivery),
+		Provider:        provider,
+	}, nil
+}
+
+// getRuntime returns the active Runtime, or an empty one before the first
+// configuration has been applied.
+func getRuntime() *Runtime {
+	if rt := currentRuntime.Load(); rt != nil {
+		return rt
+	}
+	return &Runtime{}
+}
+
+// reloadableProvider delivers through the default provider of the active
+// Runtime, so webhook and credential changes apply on reload.
+type reloadableProvider struct{}
+
+func (reloadableProvider) Send(ctx context.Context, message *GoogleChatMessage, opts SendOptions) error {
+	provider := getRuntime().Provider
+	if provider == nil {
+		return fmt.Errorf("no Google Chat webhook configured")
+	}
+	return provider.Send(ctx, message, opts)
+}
+
+func loadRuntime(path string) (*Runtime, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return NewRuntime(cfg)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Template limits, as reported in alertmanager_gchat_template_limits_exceeded_total.
+const (
+	limitTimeout  = "timeout"
+	limitOutput   = "output"
+	limitFunction = "function"
+)
+
+// maxAbandonedRenders is how many renderings of a route may still be
+// running past their timeout before further ones fail straight away, so a
+// template stuck in a loop costs at most that many goroutines.
+const maxAbandonedRenders = 4
+
+var errTemplateOutput = errors.New("template output exceeds max_output")
+
+// TemplateSandbox renders the user templates of a route within its
+// [templates.limits]. Denied functions are replaced in a copy of each
+// template, made on first use. A nil sandbox renders without limits.
+type TemplateSandbox struct {
+	route  string
+	limits TemplateLimitsConfig
+	// abandoned counts renderings still running after their timeout.
+	abandoned atomic.Int32
+
+	mu         sync.Mutex
+	restricted map[*template.Template]*template.Template
+}
+
+func NewTemplateSandbox(route string, limits TemplateLimitsConfig) *TemplateSandbox {
+	return &TemplateSandbox{route: route, limits: limits, restricted: map[*template.Template]*template.Template{}}
+}
+
+// Execute renders the template called name in tmpl's set, or tmpl itself
+// when name is empty, and returns the output with surrounding space
+// trimmed. A rendering that times out is abandoned rather than stopped,
+// since Go templates cannot be interrupted; its writes fail from then on.
+func (s *TemplateSandbox) Execute(tmpl *template.Template, name string, data interface{}) (string, error) {
+	if s == nil {
+		w := &sandboxWriter{}
+		return w.run(tmpl, name, data)
+	}
+
+	tmpl, err := s.restrict(tmpl)
+	if err != nil {
+		return "", err
+	}
+	w := &sandboxWriter{max: s.limits.MaxOutput}
+	if s.limits.Timeout <= 0 {
+		return s.result(w.run(tmpl, name, data))
+	}
+	if n := s.abandoned.Load(); n >= maxAbandonedRenders {
+		s.exceeded(limitTimeout)
+		return "", fmt.Errorf("%d renderings are still running past the template timeout", n)
+	}
+
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := w.run(tmpl, name, data)
+		done <- result{out, err}
+	}()
+	timer := time.NewTimer(s.limits.Timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return s.result(r.out, r.err)
+	case <-timer.C:
+		w.stopped.Store(true)
+		s.abandoned.Add(1)
+		go func() {
+			<-done
+			s.abandoned.Add(-1)
+		}()
+		s.exceeded(limitTimeout)
+		return "", fmt.Errorf("template timed out after %s", s.limits.Timeout)
+	}
+}
+
+func (s *TemplateSandbox) result(out string, err error) (string, error) {
+	if errors.Is(err, errTemplateOutput) {
+		s.exceeded(limitOutput)
+		return "", fmt.Errorf("%w of %d bytes", errTemplateOutput, s.limits.MaxOutput)
+	}
+	return out, err
+}
+
+func (s *TemplateSandbox) exceeded(limit string) {
+	templateLimitsExceeded.WithLabelValues(s.route, limit).Inc()
+}
+
+// restrict returns a copy of tmpl whose denied functions fail when called,
+// or tmpl when no function is denied.
+func (s *TemplateSandbox) restrict(tmpl *template.Template) (*template.Template, error) {
+	if len(s.limits.DenyFunctions) == 0 {
+		return tmpl, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if restricted, ok := s.restricted[tmpl]; ok {
+		return restricted, nil
+	}
+	restricted, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	denied := template.FuncMap{}
+	for _, name := range s.limits.DenyFunctions {
+		denied[name] = func(...interface{}) (interface{}, error) {
+			s.exceeded(limitFunction)
+			return nil, fmt.Errorf("function %s is not allowed on route %s", name, s.route)
+		}
+	}
+	restricted.Funcs(denied)
+	s.restricted[tmpl] = restricted
+	return restricted, nil
+}
+
+// sandboxWriter collects template output, failing once it exceeds max
+// bytes or once the rendering was abandoned. full, when set, is called on
+// overflow to stop the writer.
+type sandboxWriter struct {
+	buf      bytes.Buffer
+	max      int
+	overflow bool
+	stopped  atomic.Bool
+	full     func()
+}
+
+func (w *sandboxWriter) Write(p []byte) (int, error) {
+	if w.stopped.Load() {
+		return 0, errors.New("rendering abandoned after its timeout")
+	}
+	if w.max > 0 && w.buf.Len()+len(p) > w.max {
+		w.overflow = true
+		if w.full != nil {
+			w.full()
+		}
+		return 0, errTemplateOutput
+	}
+	return w.buf.Write(p)
+}
+
+// run executes the template into w. A panic, which template functions
+// recover from but other code reached from a template may not, is returned
+// as an error so it cannot take down the process.
+func (w *sandboxWriter) run(tmpl *template.Template, name string, data interface{}) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("template panicked: %v", r)
+		}
+	}()
+	if name == "" {
+		err = tmpl.Execute(w, data)
+	} else {
+		err = tmpl.ExecuteTemplate(w, name, data)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(w.buf.String()), nil
+}
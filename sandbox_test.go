@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestTemplateSandboxExecute(t *testing.T) {
+	funcs := template.FuncMap{"sleep": func(d string) string {
+		delay, _ := time.ParseDuration(d)
+		time.Sleep(delay)
+		return "slept"
+	}}
+	tests := []struct {
+		name    string
+		text    string
+		limits  TemplateLimitsConfig
+		want    string
+		wantErr string
+	}{
+		{name: "no limits", text: `{{ toUpper "ok" }}`, want: "OK"},
+		{name: "within limits", text: ` {{ sleep "1ms" }} `, limits: TemplateLimitsConfig{Timeout: time.Second, MaxOutput: 7}, want: "slept"},
+		{name: "timeout", text: `{{ sleep "200ms" }}`, limits: TemplateLimitsConfig{Timeout: 10 * time.Millisecond}, wantErr: "timed out after 10ms"},
+		{name: "output", text: `{{ range 100 }}xxxxxxxxxx{{ end }}`, limits: TemplateLimitsConfig{MaxOutput: 512}, wantErr: "exceeds max_output of 512 bytes"},
+		{name: "denied function", text: `{{ toUpper "ok" }}`, limits: TemplateLimitsConfig{DenyFunctions: []string{"toUpper"}}, wantErr: "function toUpper is not allowed on route ops"},
+		{name: "other function", text: `{{ toLower "OK" }}`, limits: TemplateLimitsConfig{DenyFunctions: []string{"toUpper"}}, want: "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New("t").Funcs(templateFuncs).Funcs(funcs).Parse(tt.text))
+			got, err := NewTemplateSandbox("ops", tt.limits).Execute(tmpl, "", nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Execute() = %q, %v, want %q", got, err, tt.want)
+			}
+			// Denying a function must not affect the template itself.
+			if got, err := (*TemplateSandbox)(nil).Execute(tmpl, "", nil); err != nil || got != tt.want {
+				t.Errorf("Execute() without sandbox = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateSandboxAbandoned(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	tmpl := template.Must(template.New("t").Funcs(template.FuncMap{"wait": func() string {
+		<-release
+		return ""
+	}}).Parse(`{{ wait }}`))
+
+	sandbox := NewTemplateSandbox("ops", TemplateLimitsConfig{Timeout: time.Millisecond})
+	for i := 0; i < maxAbandonedRenders; i++ {
+		if _, err := sandbox.Execute(tmpl, "", nil); err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("Execute() %d error = %v, want a timeout", i, err)
+		}
+	}
+	start := time.Now()
+	_, err := sandbox.Execute(tmpl, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Fatalf("Execute() error = %v, want it refused while renderings are stuck", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("Execute() took %s, want it to fail straight away", time.Since(start))
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the scheduled jobs, which [scheduler.jobs] may reschedule.
+const (
+	jobSummary         = "summary"
+	jobReport          = "report"
+	jobAllClear        = "all_clear"
+	jobQuietHours      = "quiet_hours"
+	jobStormCheck      = "storm_check"
+	jobStateCompaction = "state_compaction"
+	jobHeartbeat       = "heartbeat"
+	jobChatCredentials = "chat_credentials"
+	jobEscalation      = "escalation_reminder"
+)
+
+var jobNames = []string{jobSummary, jobReport, jobAllClear, jobQuietHours, jobStormCheck, jobStateCompaction, jobHeartbeat, jobChatCredentials, jobEscalation}
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobRunning  = errors.New("job is already running")
+)
+
+// JobSchedule says when a job is due.
+type JobSchedule interface {
+	// Last returns the most recent due time at or before now.
+	Last(now time.Time) time.Time
+	// Next returns the first due time after now.
+	Next(now time.Time) time.Time
+	String() string
+}
+
+// everySchedule is due at each multiple of its interval since the Unix
+// epoch.
+type everySchedule time.Duration
+
+func (e everySchedule) Last(now time.Time) time.Time {
+	return now.Truncate(time.Duration(e))
+}
+
+func (e everySchedule) Next(now time.Time) time.Time {
+	return now.Truncate(time.Duration(e)).Add(time.Duration(e))
+}
+
+func (e everySchedule) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+// parseJobSchedule parses a cron expression, or "@every <duration>", for
+// times in loc.
+func parseJobSchedule(expr string, loc *time.Location) (JobSchedule, error) {
+	if d, ok := strings.CutPrefix(strings.TrimSpace(expr), "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || interval < time.Second {
+			return nil, fmt.Errorf("@every needs a duration of at least 1s, not %q", d)
+		}
+		return everySchedule(interval), nil
+	}
+	return ParseCron(expr, loc)
+}
+
+// Job is a task the scheduler runs when its schedule comes due, or when it
+// is triggered through the admin API.
+type Job struct {
+	Name        string
+	Description string
+	// Schedule is nil for a job that only runs when triggered.
+	Schedule JobSchedule
+	Run      func(due time.Time) error
+}
+
+// newJobs returns the jobs for cfg. Each job keeps the schedule its own
+// settings imply unless [scheduler.jobs] gives it another.
+func newJobs(cfg Config, reports *ReportSchedule, allClear *AllClearSchedule) ([]Job, error) {
+	provider := reloadableProvider{}
+	jobs := []Job{
+		{
+			Name:        jobSummary,
+			Description: "Post the summary of firing alerts",
+			Run: func(time.Time) error {
+				_, err := postSummary(provider, newRequestID("summary"), false)
+				return err
+			},
+		},
+		{
+			Name:        jobReport,
+			Description: "Email the alert report",
+			Run: func(due time.Time) error {
+				rt := getRuntime()
+				if len(rt.Config.Report.To) == 0 {
+					return fmt.Errorf("report has no recipients")
+				}
+				from := due.AddDate(0, 0, -7)
+				if rt.Reports != nil {
+					from = rt.Reports.Period(due)
+				}
+				return sendReport(rt.Config, from, due, newRequestID("report"))
+			},
+		},
+		{
+			Name:        jobAllClear,
+			Description: "Post the all-clear summary of the past period",
+			Run: func(due time.Time) error {
+				return postAllClear(provider, due, newRequestID("allclear"))
+			},
+		},
+		{
+			Name:        jobQuietHours,
+			Description: "Post alerts held for quiet hours once they end",
+			Schedule:    everySchedule(time.Minute),
+			Run: func(time.Time) error {
+				flushQuietDigest(provider, clock.Now())
+				return nil
+			},
+		},
+		{
+			Name:        jobStormCheck,
+			Description: "Post the summary of alert storms that have passed",
+			Schedule:    everySchedule(time.Minute),
+			Run: func(time.Time) error {
+				flushStorms(provider, clock.Now())
+				return nil
+			},
+		},
+		{
+			Name:        jobStateCompaction,
+			Description: "Apply state retention and remove expired entries",
+			Run: func(time.Time) error {
+				compactState(clock.Now())
+				return nil
+			},
+		},
+		{
+			Name:        jobHeartbeat,
+			Description: "Warn when no notifications have arrived for heartbeat max_silence",
+			Run: func(time.Time) error {
+				return checkHeartbeat(provider, clock.Now())
+			},
+		},
+		{
+			Name:        jobChatCredentials,
+			Description: "Check that the Chat API credentials still yield an access token",
+			Run: func(time.Time) error {
+				if chat := getRuntime().Chat; chat != nil {
+					return chat.CheckCredentials(clock.Now())
+				}
+				return nil
+			},
+		},
+		{
+			Name:        jobEscalation,
+			Description: "Escalate outbox messages still undelivered after escalation remind_after",
+			Run: func(time.Time) error {
+				remindEscalations(clock.Now())
+				return nil
+			},
+		},
+	}
+
+	for i := range jobs {
+		switch jobs[i].Name {
+		case jobSummary:
+			if cfg.Summary.Interval > 0 {
+				jobs[i].Schedule = everySchedule(cfg.Summary.Interval)
+			}
+		case jobReport:
+			if reports != nil {
+				jobs[i].Schedule = reports
+			}
+		case jobAllClear:
+			if allClear != nil {
+				jobs[i].Schedule = allClear.cron
+			}
+		case jobStateCompaction:
+			if cfg.State.Dir != "" {
+				jobs[i].Schedule = everySchedule(cfg.State.CompactInterval)
+			}
+		case jobHeartbeat:
+			if cfg.Heartbeat.MaxSilence > 0 {
+				jobs[i].Schedule = everySchedule(time.Minute)
+			}
+		case jobChatCredentials:
+			if cfg.GoogleChat.chatAPIEnabled() {
+				jobs[i].Schedule = everySchedule(5 * time.Minute)
+			}
+		case jobEscalation:
+			if cfg.Outbox.Enabled && cfg.Escalation.RemindAfter > 0 {
+				jobs[i].Schedule = everySchedule(time.Minute)
+			}
+		}
+	}
+
+	loc, err := cfg.Scheduler.location()
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		expr, ok := cfg.Scheduler.Jobs[jobs[i].Name]
+		if !ok {
+			continue
+		}
+		if jobs[i].Schedule, err = parseJobSchedule(expr, loc); err != nil {
+			return nil, fmt.Errorf("job %s: %v", jobs[i].Name, err)
+		}
+	}
+	return jobs, nil
+}
+
+// JobStatus is what the admin API reports for a job.
+type JobStatus struct {
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Schedule       string    `json:"schedule,omitempty"`
+	NextRun        time.Time `json:"nextRun,omitzero"`
+	LastRun        time.Time `json:"lastRun,omitzero"`
+	LastDurationMs int64     `json:"lastDurationMs"`
+	LastError      string    `json:"lastError,omitempty"`
+	Runs           int       `json:"runs"`
+	Failures       int       `json:"failures"`
+	Running        bool      `json:"running"`
+}
+
+type jobState struct {
+	// schedule is the schedule the job had when last seen, so a reload
+	// that changes it starts over from the new one.
+	schedule string
+	// due is the due time of the last scheduled run.
+	due    time.Time
+	status JobStatus
+}
+
+// Scheduler runs the jobs of the active Runtime and keeps their history
+// across reloads.
+type Scheduler struct {
+	mu     sync.Mutex
+	states map[string]*jobState
+}
+
+var scheduler = NewScheduler()
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{states: map[string]*jobState{}}
+}
+
+// state returns the state of job at now, resetting it when the job's
+// schedule is new or has changed so runs it missed are not made up. The
+// caller holds s.mu.
+func (s *Scheduler) state(job Job, now time.Time) *jobState {
+	schedule := ""
+	if job.Schedule != nil {
+		schedule = job.Schedule.String()
+	}
+	st, ok := s.states[job.Name]
+	if !ok {
+		st = &jobState{schedule: schedule}
+		if job.Schedule != nil {
+			st.due = job.Schedule.Last(now)
+		}
+		s.states[job.Name] = st
+	} else if st.schedule != schedule {
+		st.schedule = schedule
+		st.due = time.Time{}
+		if job.Schedule != nil {
+			st.due = job.Schedule.Last(now)
+		}
+	}
+	return st
+}
+
+// Tick starts each job that has come due since its last scheduled run and
+// is not still running, adding the runs to wg.
+func (s *Scheduler) Tick(jobs []Job, now time.Time, wg *sync.WaitGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range jobs {
+		st := s.state(job, now)
+		if job.Schedule == nil || st.status.Running {
+			continue
+		}
+		due := job.Schedule.Last(now)
+		if !due.After(st.due) {
+			continue
+		}
+		st.due = due
+		st.status.Running = true
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.run(job, due)
+		}(job)
+	}
+}
+
+// Trigger runs the named job now, outside its schedule, and returns its
+// status once it has finished.
+func (s *Scheduler) Trigger(jobs []Job, name string, now time.Time) (JobStatus, error) {
+	for _, job := range jobs {
+		if job.Name != name {
+			continue
+		}
+		s.mu.Lock()
+		st := s.state(job, now)
+		if st.status.Running {
+			s.mu.Unlock()
+			return JobStatus{}, errJobRunning
+		}
+		st.status.Running = true
+		s.mu.Unlock()
+
+		err := s.run(job, now)
+		statuses := s.Status([]Job{job}, clock.Now())
+		return statuses[0], err
+	}
+	return JobStatus{}, errJobNotFound
+}
+
+// run runs job for due and records the outcome. The job is marked running
+// by the caller.
+func (s *Scheduler) run(job Job, due time.Time) error {
+	start := clock.Now()
+	err := job.Run(due)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.states[job.Name]
+	st.status.Running = false
+	st.status.LastRun = start
+	st.status.LastDurationMs = clock.Since(start).Milliseconds()
+	st.status.Runs++
+	st.status.LastError = ""
+	status := statusSuccess
+	if err != nil {
+		status = statusError
+		st.status.Failures++
+		st.status.LastError = errorText(err)
+		logger.Error("Job %s failed: %v", job.Name, err)
+	}
+	jobRuns.WithLabelValues(job.Name, status).Inc()
+	return err
+}
+
+// Status returns the status of each job at now, in order.
+func (s *Scheduler) Status(jobs []Job, now time.Time) []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		status := s.state(job, now).status
+		status.Name = job.Name
+		status.Description = job.Description
+		status.Schedule = ""
+		status.NextRun = time.Time{}
+		if job.Schedule != nil {
+			status.Schedule = job.Schedule.String()
+			status.NextRun = job.Schedule.Next(now)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// runScheduler checks the active Runtime's jobs every interval until stop
+// is closed, then waits for the jobs still running.
+func runScheduler(interval time.Duration, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			scheduler.Tick(getRuntime().Jobs, clock.Now(), &wg)
+		}
+	}
+}
+
+// jobsHandler serves GET /api/v1/jobs/ with the status of every job, GET
+// /api/v1/jobs/{name} with one job's status, and POST /api/v1/jobs/{name}
+// to run a job now.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobs := getRuntime().Jobs
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/")
+
+	var body any
+	status := http.StatusOK
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		body = scheduler.Status(jobs, clock.Now())
+	case r.Method == http.MethodGet:
+		for _, job := range jobs {
+			if job.Name == name {
+				body = scheduler.Status([]Job{job}, clock.Now())[0]
+			}
+		}
+		if body == nil {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+	case r.Method == http.MethodPost && name != "":
+		logger.Info("Running job %s on request from %s", name, r.RemoteAddr)
+		result, err := scheduler.Trigger(jobs, name, clock.Now())
+		switch {
+		case errors.Is(err, errJobNotFound):
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		case errors.Is(err, errJobRunning):
+			http.Error(w, "Job is already running", http.StatusConflict)
+			return
+		case err != nil:
+			status = http.StatusInternalServerError
+		}
+		body = result
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerTick(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	var mu sync.Mutex
+	var runs []time.Time
+	jobs := []Job{{
+		Name:     "test",
+		Schedule: everySchedule(time.Minute),
+		Run: func(due time.Time) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs = append(runs, due)
+			return nil
+		},
+	}, {
+		Name: "manual",
+		Run:  func(time.Time) error { t.Error("Job without a schedule was run"); return nil },
+	}}
+
+	start := time.Date(2024, 5, 15, 9, 0, 30, 0, time.UTC)
+	s := NewScheduler()
+	var wg sync.WaitGroup
+	for _, now := range []time.Time{
+		start,
+		start.Add(10 * time.Second),
+		start.Add(30 * time.Second),
+		start.Add(40 * time.Second),
+		start.Add(5 * time.Minute),
+	} {
+		s.Tick(jobs, now, &wg)
+		wg.Wait()
+	}
+
+	want := []time.Time{start.Add(30 * time.Second), start.Add(270 * time.Second)}
+	if len(runs) != len(want) {
+		t.Fatalf("runs = %v, want %v, not catching up on missed runs", runs, want)
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			t.Errorf("run %d due %v, want %v", i, runs[i], want[i])
+		}
+	}
+
+	status := s.Status(jobs, start.Add(5*time.Minute))
+	if status[0].Runs != 2 || !status[0].NextRun.Equal(start.Add(330*time.Second)) || status[0].Schedule != "@every 1m0s" {
+		t.Errorf("Unexpected status %+v", status[0])
+	}
+	if status[1].Schedule != "" || !status[1].NextRun.IsZero() || status[1].Runs != 0 {
+		t.Errorf("Unexpected status %+v", status[1])
+	}
+}
+
+func TestJobsHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+	defer func() { scheduler = NewScheduler() }()
+	scheduler = NewScheduler()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	currentRuntime.Store(&Runtime{Jobs: []Job{
+		{Name: "ok", Schedule: everySchedule(time.Hour), Run: func(time.Time) error { return nil }},
+		{Name: "broken", Run: func(time.Time) error { return errors.New("smtp unavailable") }},
+		{Name: "slow", Run: func(time.Time) error { close(started); <-release; return nil }},
+	}})
+
+	tests := []struct {
+		name       string
+		method     string
+		job        string
+		wantStatus int
+		wantRuns   int
+		wantError  string
+	}{
+		{name: "run", method: http.MethodPost, job: "ok", wantStatus: http.StatusOK, wantRuns: 1},
+		{name: "failed run", method: http.MethodPost, job: "broken", wantStatus: http.StatusInternalServerError, wantRuns: 1, wantError: "smtp unavailable"},
+		{name: "get", method: http.MethodGet, job: "ok", wantStatus: http.StatusOK, wantRuns: 1},
+		{name: "unknown job", method: http.MethodPost, job: "missing", wantStatus: http.StatusNotFound},
+		{name: "post without a job", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			jobsHandler(rec, httptest.NewRequest(tt.method, "/api/v1/jobs/"+tt.job, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code >= 400 && rec.Code != http.StatusInternalServerError {
+				return
+			}
+			var status JobStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Name != tt.job || status.Runs != tt.wantRuns || status.LastError != tt.wantError {
+				t.Errorf("Unexpected status %+v", status)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	jobsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/", nil))
+	var statuses []JobStatus
+	if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 || statuses[0].Name != "ok" || statuses[0].Schedule != "@every 1h0m0s" {
+		t.Errorf("Unexpected job list %+v", statuses)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		jobsHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/jobs/slow", nil))
+	}()
+	<-started
+	rec = httptest.NewRecorder()
+	jobsHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/jobs/slow", nil))
+	close(release)
+	<-done
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d while the job is running, want %d", rec.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//go:embed api/schemas/*.json
+var schemaFiles embed.FS
+
+// payloadVersion is how payloads of one AlertManager webhook version are
+// read: the bundled JSON schema they are validated against and the parser
+// that decodes them.
+type payloadVersion struct {
+	schemaFile string
+	parse      func(body []byte, payload *AlertManagerPayload) error
+}
+
+// payloadVersions maps the AlertManager webhook "version" field to how
+// payloads of that version are read. A version that renames or changes
+// fields gets its own parser converting them, so they are not misread.
+var payloadVersions = map[string]payloadVersion{
+	"4": {schemaFile: "api/schemas/alertmanager-v4.json", parse: parsePayloadV4},
+}
+
+const (
+	// defaultPayloadVersion is assumed when a payload omits the version
+	// field.
+	defaultPayloadVersion = "4"
+	// latestPayloadVersion reads payloads of unknown versions, on the
+	// assumption that newer versions mostly add fields.
+	latestPayloadVersion = "4"
+	// unknownPayloadVersion labels payloads of unknown versions in metrics.
+	unknownPayloadVersion = "unknown"
+)
+
+func parsePayloadV4(body []byte, payload *AlertManagerPayload) error {
+	return json.Unmarshal(body, payload)
+}
+
+// resolvePayloadVersion returns the version that payloads declaring version
+// are read as, and whether version is known.
+func resolvePayloadVersion(version string) (string, bool) {
+	if version == "" {
+		return defaultPayloadVersion, true
+	}
+	if _, ok := payloadVersions[version]; ok {
+		return version, true
+	}
+	return latestPayloadVersion, false
+}
+
+// declaredPayloadVersion returns the version field of body, or "" when it
+// has none.
+func declaredPayloadVersion(body []byte) string {
+	var doc struct {
+		Version interface{} `json:"version"`
+	}
+	json.Unmarshal(body, &doc)
+	version, _ := doc.Version.(string)
+	return version
+}
+
+// chatMessageSchemaFile describes the Chat messages the bridge sends. It is
+// used to check rendered templates, not outgoing requests.
+const chatMessageSchemaFile = "api/schemas/chat-message.json"
+
+// jsonSchema is the subset of JSON Schema used by the bundled schemas.
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Format               string                 `json:"format"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinProperties        *int                   `json:"minProperties"`
+	Ref                  string                 `json:"$ref"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+}
+
+// schemaTypes accepts both the string and array forms of "type".
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// SchemaErrors lists every field-level violation found in a payload.
+type SchemaErrors []string
+
+func (e SchemaErrors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+var (
+	compiledSchemas   = map[string]*jsonSchema{}
+	chatMessageSchema *jsonSchema
+)
+
+func init() {
+	for version, v := range payloadVersions {
+		compiledSchemas[version] = loadBundledSchema(v.schemaFile)
+	}
+	chatMessageSchema = loadBundledSchema(chatMessageSchemaFile)
+}
+
+func loadBundledSchema(file string) *jsonSchema {
+	data, err := schemaFiles.ReadFile(file)
+	if err != nil {
+		panic(fmt.Sprintf("missing bundled schema %s: %v", file, err))
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		panic(fmt.Sprintf("invalid bundled schema %s: %v", file, err))
+	}
+	return &schema
+}
+
+// errInvalidJSON is returned by validateAlertPayload for bodies that are not
+// JSON at all, as opposed to JSON not matching the schema.
+var errInvalidJSON = errors.New("invalid JSON")
+
+// validateAlertPayload checks a raw webhook body against the bundled schema
+// for its payload version and returns SchemaErrors describing each invalid
+// field.
+func validateAlertPayload(body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidJSON, err)
+	}
+
+	declared := ""
+	if obj, ok := doc.(map[string]interface{}); ok {
+		declared, _ = obj["version"].(string)
+	}
+	version, known := resolvePayloadVersion(declared)
+
+	schema := compiledSchemas[version]
+	var errs SchemaErrors
+	schema.validate(schema, "", doc, &errs)
+	if len(errs) > 0 && !known {
+		return fmt.Errorf("unknown payload version %q read as version %s: %w", declared, version, errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateChatMessage checks a rendered message against the bundled Chat
+// message schema and returns SchemaErrors describing each invalid field.
+func validateChatMessage(message *GoogleChatMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	var errs SchemaErrors
+	chatMessageSchema.validate(chatMessageSchema, "", doc, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *jsonSchema) resolve(root *jsonSchema) *jsonSchema {
+	if s.Ref == "" {
+		return s
+	}
+	name := strings.TrimPrefix(s.Ref, "#/$defs/")
+	if def, ok := root.Defs[name]; ok {
+		return def
+	}
+	return s
+}
+
+func (s *jsonSchema) validate(root *jsonSchema, path string, value interface{}, errs *SchemaErrors) {
+	s = s.resolve(root)
+	fail := func(format string, args ...interface{}) {
+		field := path
+		if field == "" {
+			field = "payload"
+		}
+		*errs = append(*errs, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), jsonTypeOf(value))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value %v is not one of %v", value, s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.MinLength != nil && utf8.RuneCountInString(v) < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && utf8.RuneCountInString(v) > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				fail("invalid date-time %q", v)
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must contain at least %d item(s)", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must contain at most %d item(s)", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(root, fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		if s.MinProperties != nil && len(v) < *s.MinProperties {
+			fail("must have at least %d entr(ies)", *s.MinProperties)
+		}
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, joinPath(path, name)+": is required")
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(root, joinPath(path, k), v[k], errs)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(root, joinPath(path, k), v[k], errs)
+			}
+		}
+	}
+}
+
+func (t schemaTypes) matches(value interface{}) bool {
+	actual := jsonTypeOf(value)
+	for _, want := range t {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/BurntSushi/toml"
+)
+
+var configIdentity = flag.String("config.identity", "", "File of age identities decrypting encrypted configuration files and values (env CONFIG_AGE_IDENTITY_FILE)")
+
+// ageBinaryHeader starts a file encrypted by age without -a.
+const ageBinaryHeader = "age-encryption.org/v1\n"
+
+// ageEncrypted reports whether data is an age file, binary or armored.
+func ageEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageBinaryHeader)) ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+// hasAgeData reports whether data is an age file or holds armored age
+// values.
+func hasAgeData(data []byte) bool {
+	return ageEncrypted(data) || bytes.Contains(data, []byte(armor.Header))
+}
+
+// ageIdentities reads the identities of -config.identity, or of the file
+// named by CONFIG_AGE_IDENTITY_FILE.
+func ageIdentities() ([]age.Identity, error) {
+	path := *configIdentity
+	if path == "" {
+		path = os.Getenv("CONFIG_AGE_IDENTITY_FILE")
+	}
+	if path == "" {
+		return nil, errors.New("the configuration is encrypted but no age identity is set with -config.identity or CONFIG_AGE_IDENTITY_FILE")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read age identity file: %v", err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity file %s: %v", path, err)
+	}
+	return identities, nil
+}
+
+// ageDecrypt decrypts the age file in data with identities.
+func ageDecrypt(data []byte, identities []age.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(ageBinaryHeader)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// configDecrypter decrypts configuration files and values, reading the
+// identities the first time something is encrypted.
+type configDecrypter struct {
+	identities []age.Identity
+}
+
+func (d *configDecrypter) decrypt(data []byte) ([]byte, error) {
+	if d.identities == nil {
+		identities, err := ageIdentities()
+		if err != nil {
+			return nil, err
+		}
+		d.identities = identities
+	}
+	return ageDecrypt(data, d.identities)
+}
+
+// decodeConfigFile decodes the TOML file at path into a map. A file
+// encrypted with age as a whole is decrypted first, then every string value
+// holding an armored age file is replaced by its plaintext, without
+// trailing newlines.
+func decodeConfigFile(path string, d *configDecrypter) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	if ageEncrypted(data) {
+		if data, err = d.decrypt(data); err != nil {
+			return nil, fmt.Errorf("failed to decrypt config file %s: %v", path, err)
+		}
+	}
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode config file %s: %v", path, err)
+	}
+	if err := decryptValues(doc, "", d); err != nil {
+		return nil, fmt.Errorf("failed to decrypt config file %s: %v", path, err)
+	}
+	return doc, nil
+}
+
+// decryptValues replaces the encrypted string values in table, naming the
+// key of a value that cannot be decrypted.
+func decryptValues(table map[string]interface{}, prefix string, d *configDecrypter) error {
+	for key, v := range table {
+		plain, err := decryptValue(v, prefix+key, d)
+		if err != nil {
+			return err
+		}
+		table[key] = plain
+	}
+	return nil
+}
+
+func decryptValue(v interface{}, key string, d *configDecrypter) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), armor.Header) {
+			return v, nil
+		}
+		plain, err := d.decrypt([]byte(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		return strings.TrimRight(string(plain), "\r\n"), nil
+	case map[string]interface{}:
+		return v, decryptValues(v, key+".", d)
+	case []map[string]interface{}:
+		for i, table := range v {
+			if err := decryptValues(table, fmt.Sprintf("%s[%d].", key, i), d); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			plain, err := decryptValue(item, fmt.Sprintf("%s[%d]", key, i), d)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = plain
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ageEncrypt encrypts plaintext to recipient, armored when armored is set.
+func ageEncrypt(t *testing.T, recipient age.Recipient, plaintext string, armored bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var dst io.WriteCloser = nopCloser{&buf}
+	if armored {
+		dst = armor.NewWriter(&buf)
+	}
+	w, err := age.Encrypt(dst, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestLoadConfigDecryptsAge(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { *configIdentity = path }(*configIdentity)
+
+	const webhook = "https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t"
+	plain := "[google_chat]\nwebhook_url = '''\n" + ageEncrypt(t, identity.Recipient(), webhook+"\n", true) + "'''\n\n[[routes]]\nname = \"db\"\nwebhook_url = '''" + ageEncrypt(t, identity.Recipient(), webhook+"&db", true) + "'''\n"
+
+	tests := []struct {
+		name     string
+		config   string
+		identity string
+		wantErr  string
+	}{
+		{name: "values", config: plain, identity: keyFile},
+		{name: "whole file", config: ageEncrypt(t, identity.Recipient(), plain, false), identity: keyFile},
+		{name: "armored file", config: ageEncrypt(t, identity.Recipient(), plain, true), identity: keyFile},
+		{name: "no identity", config: plain, wantErr: "no age identity is set"},
+		{name: "wrong identity", config: "[google_chat]\nwebhook_url = '''" + ageEncrypt(t, other.Recipient(), webhook, true) + "'''\n", identity: keyFile, wantErr: "google_chat.webhook_url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_AGE_IDENTITY_FILE", "")
+			*configIdentity = tt.identity
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if cfg.GoogleChat.WebhookURL != webhook {
+				t.Errorf("webhook_url = %q, want %q", cfg.GoogleChat.WebhookURL, webhook)
+			}
+			if len(cfg.Routes) != 1 || cfg.Routes[0].WebhookURL != webhook+"&db" {
+				t.Errorf("routes = %+v, want the decrypted route webhook", cfg.Routes)
+			}
+		})
+	}
+}
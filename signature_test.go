@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithSignature(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	const body = `{"status":"firing","alerts":[]}`
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name         string
+		cfg          SignatureConfig
+		signature    string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "valid signature",
+			cfg:          SignatureConfig{Header: "X-Signature-256", Secret: "s3cret"},
+			signature:    sign("s3cret", body),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "sha256 prefix",
+			cfg:          SignatureConfig{Header: "X-Signature-256", Secret: "s3cret"},
+			signature:    "sha256=" + sign("s3cret", body),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "secret from file",
+			cfg:          SignatureConfig{Header: "X-Signature-256", SecretFile: secretFile},
+			signature:    sign("file-secret", body),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unsigned",
+			cfg:          SignatureConfig{Header: "X-Signature-256", Secret: "s3cret"},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "wrong secret",
+			cfg:          SignatureConfig{Header: "X-Signature-256", Secret: "s3cret"},
+			signature:    sign("guess", body),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "tampered body",
+			cfg:          SignatureConfig{Header: "X-Signature-256", Secret: "s3cret"},
+			signature:    sign("s3cret", body),
+			body:         `{"status":"resolved","alerts":[]}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "not hex",
+			cfg:          SignatureConfig{Header: "X-Signature-256", Secret: "s3cret"},
+			signature:    "not-a-signature",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "disabled",
+			cfg:          SignatureConfig{Header: "X-Signature-256"},
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := body
+			if tt.body != "" {
+				sent = tt.body
+			}
+			var got string
+			handler := withSignature(tt.cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				got = string(data)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(sent))
+			if tt.signature != "" {
+				req.Header.Set("X-Signature-256", tt.signature)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+			if w.Code == http.StatusOK && got != sent {
+				t.Errorf("handler read body %q, want %q", got, sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Silence mutes alerts matching all of its matchers until it expires.
+type Silence struct {
+	Matchers  Matchers
+	ExpiresAt time.Time
+	Comment   string
+}
+
+// NewSilences compiles the [[silence]] blocks from the configuration.
+func NewSilences(cfgs []SilenceConfig) ([]*Silence, error) {
+	silences := make([]*Silence, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		if len(cfg.Matchers) == 0 {
+			return nil, fmt.Errorf("silence %d must have at least one matcher", i)
+		}
+		matchers, err := ParseMatchers(cfg.Matchers)
+		if err != nil {
+			return nil, fmt.Errorf("silence %d: %v", i, err)
+		}
+		silences = append(silences, &Silence{
+			Matchers:  matchers,
+			ExpiresAt: cfg.ExpiresAt,
+			Comment:   cfg.Comment,
+		})
+	}
+	return silences, nil
+}
+
+// Active reports whether the silence applies at time now.
+func (s *Silence) Active(now time.Time) bool {
+	return s.ExpiresAt.IsZero() || now.Before(s.ExpiresAt)
+}
+
+// silenceList holds silences added at runtime, such as those requested by
+// reacting to an alert message. They are not persisted.
+type silenceList struct {
+	mu       sync.Mutex
+	silences []*Silence
+}
+
+var requestedSilences = &silenceList{}
+
+func (l *silenceList) Add(s *Silence) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.silences = append(l.silences, s)
+}
+
+// Active returns the silences still active at now, dropping expired ones.
+func (l *silenceList) Active(now time.Time) []*Silence {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	active := l.silences[:0]
+	for _, s := range l.silences {
+		if s.Active(now) {
+			active = append(active, s)
+		}
+	}
+	l.silences = active
+	return append([]*Silence(nil), active...)
+}
+
+// filterSilenced returns the alerts not muted by an active silence.
+func filterSilenced(reqID string, alerts Alerts, silences []*Silence) Alerts {
+	if len(silences) == 0 {
+		return alerts
+	}
+
+	now := clock.Now()
+	kept := make(Alerts, 0, len(alerts))
+	for _, alert := range alerts {
+		silenced := false
+		for _, s := range silences {
+			if s.Active(now) && s.Matchers.Matches(alert.Labels) {
+				logger.Info("[%s] Alert %s silenced by bridge silence (%s)", reqID, alert.Labels["alertname"], s.Comment)
+				alertsSilenced.Inc()
+				silenced = true
+				break
+			}
+		}
+		if !silenced {
+			kept = append(kept, alert)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterSilenced(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	silences, err := NewSilences([]SilenceConfig{
+		{Matchers: []string{`alertname="Noisy"`}, Comment: "known issue"},
+		{Matchers: []string{`instance="web-02"`}, ExpiresAt: time.Now().Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("NewSilences() error = %v", err)
+	}
+
+	alerts := Alerts{
+		{Status: "firing", Labels: KV{"alertname": "Noisy", "instance": "web-01"}},
+		{Status: "firing", Labels: KV{"alertname": "HighCPU", "instance": "web-02"}},
+	}
+
+	kept := filterSilenced("req-1", alerts, silences)
+	if len(kept) != 1 {
+		t.Fatalf("Expected 1 alert to remain, got %d", len(kept))
+	}
+	if kept[0].Labels["alertname"] != "HighCPU" {
+		t.Errorf("Expected HighCPU to remain since its silence expired, got %s", kept[0].Labels["alertname"])
+	}
+
+	if _, err := NewSilences([]SilenceConfig{{}}); err == nil {
+		t.Error("Expected error for silence without matchers")
+	}
+}
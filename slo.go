@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	sloMet    = "met"
+	sloMissed = "missed"
+)
+
+// NotifyLatency remembers which firing alerts have been notified, so the
+// time from an alert starting to its first notification is measured once
+// per alert rather than again on every repeat.
+type NotifyLatency struct {
+	mu sync.Mutex
+	// since is when tracking began. Alerts that started earlier may have
+	// been notified before, so they are not measured.
+	since time.Time
+	// notified maps alert keys to the StartsAt of their notified firing.
+	notified map[string]time.Time
+}
+
+var notifyLatency = NewNotifyLatency(clock.Now())
+
+func NewNotifyLatency(since time.Time) *NotifyLatency {
+	return &NotifyLatency{since: since, notified: map[string]time.Time{}}
+}
+
+// pending reports whether alert is a firing alert whose first notification
+// is yet to be delivered. The caller holds l.mu.
+func (l *NotifyLatency) pending(alert Alert) bool {
+	if alert.Status != "firing" || alert.StartsAt.IsZero() || alert.StartsAt.Before(l.since) {
+		return false
+	}
+	startsAt, ok := l.notified[alertKey(alert)]
+	return !ok || !startsAt.Equal(alert.StartsAt)
+}
+
+// Delay returns how long after starting the longest waiting alert in
+// alerts is notified at now, counting only first notifications, or zero
+// when there are none.
+func (l *NotifyLatency) Delay(alerts Alerts, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var delay time.Duration
+	for _, alert := range alerts {
+		if l.pending(alert) {
+			delay = max(delay, now.Sub(alert.StartsAt))
+		}
+	}
+	return delay
+}
+
+// Delivered records that alerts, received at received, were delivered on
+// route at now. It observes the time since receipt for the notification,
+// and the time since start of each first-notified firing alert against
+// target.
+func (l *NotifyLatency) Delivered(route string, alerts Alerts, received, now time.Time, target time.Duration) {
+	receiptToNotify.WithLabelValues(route).Observe(now.Sub(received).Seconds())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, alert := range alerts {
+		key := alertKey(alert)
+		if alert.Status != "firing" {
+			delete(l.notified, key)
+			continue
+		}
+		if !l.pending(alert) {
+			continue
+		}
+		l.notified[key] = alert.StartsAt
+		delay := now.Sub(alert.StartsAt)
+		timeToNotify.WithLabelValues(route).Observe(delay.Seconds())
+		result := sloMet
+		if target > 0 && delay > target {
+			result = sloMissed
+		}
+		notifySLOAlerts.WithLabelValues(route, result).Inc()
+	}
+}
+
+// addNotifyDelayFooter ends each card of message with how long after the
+// alert started it is being sent.
+func addNotifyDelayFooter(message *GoogleChatMessage, delay time.Duration) {
+	text := fmt.Sprintf("<i>Notified %s after start</i>", delay.Round(time.Second))
+	for i := range message.Cards {
+		message.Cards[i].Sections = append(message.Cards[i].Sections, CardSection{
+			Widgets: []Widget{{TextParagraph: &TextParagraph{Text: text}}},
+		})
+	}
+	for i := range message.CardsV2 {
+		message.CardsV2[i].Card.Sections = append(message.CardsV2[i].Card.Sections, CardV2Section{
+			Widgets: []WidgetV2{{TextParagraph: &TextParagraph{Text: text}}},
+		})
+	}
+}
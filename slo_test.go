@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func sloCount(t *testing.T, route, result string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := notifySLOAlerts.WithLabelValues(route, result).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestNotifyLatency(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	now := since.Add(time.Hour)
+	fast := Alert{Status: "firing", Fingerprint: "1", StartsAt: now.Add(-30 * time.Second)}
+	slow := Alert{Status: "firing", Fingerprint: "2", StartsAt: now.Add(-5 * time.Minute)}
+	old := Alert{Status: "firing", Fingerprint: "3", StartsAt: since.Add(-time.Minute)}
+	resolved := slow
+	resolved.Status = "resolved"
+	refired := slow
+	refired.StartsAt = now
+
+	l := NewNotifyLatency(since)
+	if got := l.Delay(Alerts{fast, slow, old}, now); got != 5*time.Minute {
+		t.Errorf("Delay() = %s, want the slowest alert's 5m0s", got)
+	}
+
+	met, missed := sloCount(t, "slo", sloMet), sloCount(t, "slo", sloMissed)
+	l.Delivered("slo", Alerts{fast, slow, old}, now.Add(-time.Second), now, 2*time.Minute)
+	if got := sloCount(t, "slo", sloMet) - met; got != 1 {
+		t.Errorf("met = %v, want 1", got)
+	}
+	if got := sloCount(t, "slo", sloMissed) - missed; got != 1 {
+		t.Errorf("missed = %v, want 1, not counting the alert started before tracking", got)
+	}
+
+	tests := []struct {
+		name   string
+		alerts Alerts
+		want   time.Duration
+	}{
+		{name: "repeats are not measured", alerts: Alerts{fast, slow}, want: 0},
+		{name: "resolved alerts are not measured", alerts: Alerts{resolved}, want: 0},
+		{name: "a new firing is measured", alerts: Alerts{fast, refired}, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.Delay(tt.alerts, now.Add(time.Minute)); got != tt.want {
+				t.Errorf("Delay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	l.Delivered("slo", Alerts{resolved}, now, now, 2*time.Minute)
+	if got := l.Delay(Alerts{slow}, now); got != 5*time.Minute {
+		t.Errorf("Delay() after resolving = %s, want the alert measured again", got)
+	}
+}
+
+func TestAddNotifyDelayFooter(t *testing.T) {
+	message := &GoogleChatMessage{Cards: []Card{{}}, CardsV2: []CardV2{{}}}
+	addNotifyDelayFooter(message, 42*time.Second+300*time.Millisecond)
+
+	want := "<i>Notified 42s after start</i>"
+	if got := message.Cards[0].Sections[0].Widgets[0].TextParagraph.Text; got != want {
+		t.Errorf("card footer = %q, want %q", got, want)
+	}
+	if got := message.CardsV2[0].Card.Sections[0].Widgets[0].TextParagraph.Text; got != want {
+		t.Errorf("cardsV2 footer = %q, want %q", got, want)
+	}
+}
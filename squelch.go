@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// anySeverity is the repeat_interval key applying to severities not listed
+// on their own.
+const anySeverity = "*"
+
+// Squelch remembers when each firing alert was last notified on a route,
+// so routes can repeat an alert less often than AlertManager's
+// repeat_interval.
+type Squelch struct {
+	mu sync.Mutex
+	// until maps route and alert key to when the alert may notify again.
+	until map[string]time.Time
+}
+
+var squelch = NewSquelch()
+
+func NewSquelch() *Squelch {
+	return &Squelch{until: map[string]time.Time{}}
+}
+
+// repeatInterval returns the minimum interval between notifications of
+// alert on route r, or zero when it may repeat freely.
+func (r *Route) repeatInterval(alert Alert) time.Duration {
+	if d, ok := r.RepeatIntervals[strings.ToLower(alert.Labels["severity"])]; ok {
+		return d
+	}
+	return r.RepeatIntervals[anySeverity]
+}
+
+// Filter returns the alerts that may be notified on route at now. Firing
+// alerts notified within their repeat interval are dropped; resolved
+// alerts are always kept.
+func (s *Squelch) Filter(reqID string, route *Route, alerts Alerts, now time.Time) Alerts {
+	if len(route.RepeatIntervals) == 0 {
+		return alerts
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := make(Alerts, 0, len(alerts))
+	squelched := 0
+	for _, alert := range alerts {
+		until, ok := s.until[route.Name+"\x00"+alertKey(alert)]
+		if alert.Status == "firing" && ok && now.Before(until) {
+			squelched++
+			continue
+		}
+		kept = append(kept, alert)
+	}
+	if squelched > 0 {
+		logger.Info("[%s] Squelched %d repeated alert(s) on route %s", reqID, squelched, route.Name)
+		alertsSquelched.WithLabelValues(route.Name).Add(float64(squelched))
+	}
+	return kept
+}
+
+// Notified records that alerts were notified on route at now.
+func (s *Squelch) Notified(route *Route, alerts Alerts, now time.Time) {
+	if len(route.RepeatIntervals) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, until := range s.until {
+		if !now.Before(until) {
+			delete(s.until, key)
+		}
+	}
+	for _, alert := range alerts {
+		key := route.Name + "\x00" + alertKey(alert)
+		if alert.Status != "firing" {
+			delete(s.until, key)
+			continue
+		}
+		if d := route.repeatInterval(alert); d > 0 {
+			s.until[key] = now.Add(d)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSquelch(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	route := &Route{Name: "ops", RepeatIntervals: map[string]time.Duration{"warning": time.Hour, anySeverity: 10 * time.Minute, "critical": 0}}
+	warning := Alert{Status: "firing", Fingerprint: "1", Labels: KV{"alertname": "DiskFull", "severity": "Warning"}}
+	critical := Alert{Status: "firing", Fingerprint: "2", Labels: KV{"alertname": "Down", "severity": "critical"}}
+	info := Alert{Status: "firing", Fingerprint: "3", Labels: KV{"alertname": "Info"}}
+	resolved := warning
+	resolved.Status = "resolved"
+
+	s := NewSquelch()
+	start := time.Now()
+	s.Notified(route, Alerts{warning, critical, info}, start)
+
+	tests := []struct {
+		name   string
+		route  *Route
+		alerts Alerts
+		after  time.Duration
+		want   int
+	}{
+		{name: "repeats are squelched", route: route, alerts: Alerts{warning, info}, after: 5 * time.Minute, want: 0},
+		{name: "zero interval repeats freely", route: route, alerts: Alerts{critical}, after: 5 * time.Minute, want: 1},
+		{name: "other severities use the default", route: route, alerts: Alerts{warning, info}, after: 30 * time.Minute, want: 1},
+		{name: "after the interval", route: route, alerts: Alerts{warning, info}, after: time.Hour, want: 2},
+		{name: "resolved is always sent", route: route, alerts: Alerts{resolved}, after: time.Minute, want: 1},
+		{name: "other routes are separate", route: &Route{Name: "dev", RepeatIntervals: route.RepeatIntervals}, alerts: Alerts{warning}, after: time.Minute, want: 1},
+		{name: "route without intervals", route: &Route{Name: "ops"}, alerts: Alerts{warning}, after: time.Minute, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Filter("test", tt.route, tt.alerts, start.Add(tt.after)); len(got) != tt.want {
+				t.Errorf("Filter() kept %d alert(s), want %d", len(got), tt.want)
+			}
+		})
+	}
+
+	s.Notified(route, Alerts{resolved}, start.Add(time.Minute))
+	if got := s.Filter("test", route, Alerts{warning}, start.Add(2*time.Minute)); len(got) != 1 {
+		t.Error("Expected a resolved alert that fires again to be sent")
+	}
+}
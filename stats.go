@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNoisiestPeriod = 7 * 24 * time.Hour
+	defaultNoisiestLimit  = 10
+	maxNoisiestLimit      = 100
+)
+
+// NoisyAlert is an alert rule and the notifications delivered for it.
+type NoisyAlert struct {
+	Alertname     string `json:"alertname"`
+	Notifications int    `json:"notifications"`
+	// Alerts is the number of distinct alerts, e.g. one per instance.
+	Alerts            int    `json:"alerts"`
+	MeanTimeToResolve string `json:"meanTimeToResolve,omitempty"`
+}
+
+// noisiestAlerts returns the limit alert names with the most notifications
+// delivered in the period before now, from the delivery history.
+func noisiestAlerts(period time.Duration, limit int, now time.Time) []NoisyAlert {
+	from := now.Add(-period)
+	rules := buildReport(history.Between(from, now), from, now).TopRules
+	if len(rules) > limit {
+		rules = rules[:limit]
+	}
+	noisy := make([]NoisyAlert, 0, len(rules))
+	for _, rule := range rules {
+		alert := NoisyAlert{Alertname: rule.Alertname, Notifications: rule.Notifications, Alerts: rule.Alerts}
+		if rule.MTTR > 0 {
+			alert.MeanTimeToResolve = formatDuration(rule.MTTR)
+		}
+		noisy = append(noisy, alert)
+	}
+	return noisy
+}
+
+// formatPeriod renders whole days as e.g. "7d" and anything else like
+// formatDuration.
+func formatPeriod(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return formatDuration(d)
+}
+
+// buildNoiseReportMessage renders the noisiest alerts over period as a card,
+// to help teams find rules worth tuning.
+func buildNoiseReportMessage(noisy []NoisyAlert, period time.Duration) *GoogleChatMessage {
+	card := Card{
+		Header: &CardHeader{
+			Title:    "Noise report",
+			Subtitle: fmt.Sprintf("Noisiest alerts over the last %s", formatPeriod(period)),
+		},
+	}
+
+	var lines []string
+	for i, alert := range noisy {
+		line := fmt.Sprintf("%d. <b>%s</b>: %d notification(s) for %d alert(s)", i+1, alert.Alertname, alert.Notifications, alert.Alerts)
+		if alert.MeanTimeToResolve != "" {
+			line += ", resolved in " + alert.MeanTimeToResolve + " on average"
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No notifications were sent in this period.")
+	}
+	card.Sections = append(card.Sections, CardSection{
+		Widgets: []Widget{{TextParagraph: &TextParagraph{Text: strings.Join(lines, "<br>")}}},
+	})
+
+	text := "Noise report: no notifications"
+	if len(noisy) > 0 {
+		text = fmt.Sprintf("Noise report: %s is the noisiest alert with %d notification(s)", noisy[0].Alertname, noisy[0].Notifications)
+	}
+	return &GoogleChatMessage{Text: text, Cards: []Card{card}}
+}
+
+// noisiestHandler lists the noisiest alerts as JSON on GET and posts them as
+// a noise report card through the default route on POST. The period and
+// the number of alerts are set with the period and limit query parameters.
+func noisiestHandler(provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		period := defaultNoisiestPeriod
+		if v := r.URL.Query().Get("period"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid period", http.StatusBadRequest)
+				return
+			}
+			period = d
+		}
+		limit := defaultNoisiestLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxNoisiestLimit {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxNoisiestLimit), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		noisy := noisiestAlerts(period, limit, clock.Now())
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(noisy)
+			return
+		}
+
+		reqID := newRequestID("noise")
+		route := getRuntime().DefaultRoute
+		if route == nil {
+			route = &Route{Name: defaultRouteName}
+		}
+		if err := route.Send(r.Context(), provider, buildNoiseReportMessage(noisy, period), reqID); err != nil {
+			logger.Error("[%s] Error sending noise report: %v", reqID, err)
+			http.Error(w, "Error sending to Google Chat", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "Noise report of %d alert(s) sent", len(noisy))
+	}
+}
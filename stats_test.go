@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNoisiestHandler(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { history = NewHistory("") }()
+	history = NewHistory("")
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{DefaultRoute: &Route{Name: defaultRouteName}})
+
+	now := time.Now()
+	record := func(name string, n int, at time.Time) {
+		for i := 0; i < n; i++ {
+			history.Record("req", "ops", &AlertManagerPayload{Alerts: Alerts{{Status: "firing", Labels: KV{"alertname": name}}}}, at)
+		}
+	}
+	record("DiskFull", 5, now.Add(-time.Hour))
+	record("HighLatency", 2, now.Add(-time.Hour))
+	record("CertExpiring", 1, now.Add(-time.Hour))
+	record("OldNoise", 50, now.Add(-10*24*time.Hour))
+
+	provider := NewMockProvider(false)
+	handler := noisiestHandler(provider)
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/api/v1/stats/noisiest?limit=2")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	var noisy []NoisyAlert
+	if err := json.NewDecoder(rr.Body).Decode(&noisy); err != nil {
+		t.Fatal(err)
+	}
+	if len(noisy) != 2 || noisy[0].Alertname != "DiskFull" || noisy[0].Notifications != 5 || noisy[1].Alertname != "HighLatency" {
+		t.Errorf("Unexpected noisiest alerts %+v", noisy)
+	}
+
+	rr = serve(http.MethodGet, "/api/v1/stats/noisiest?period=720h")
+	json.NewDecoder(rr.Body).Decode(&noisy)
+	if len(noisy) != 4 || noisy[0].Alertname != "OldNoise" {
+		t.Errorf("Expected a longer period to include older notifications, got %+v", noisy)
+	}
+
+	for _, target := range []string{"/api/v1/stats/noisiest?limit=0", "/api/v1/stats/noisiest?period=-1h", "/api/v1/stats/noisiest?period=week"} {
+		if rr := serve(http.MethodGet, target); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rr.Code)
+		}
+	}
+
+	if rr := serve(http.MethodPost, "/api/v1/stats/noisiest"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	messages := provider.GetSentMessages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one noise report, got %d", len(messages))
+	}
+	if text := messages[0].message.Text; text != "Noise report: DiskFull is the noisiest alert with 5 notification(s)" {
+		t.Errorf("Unexpected text %q", text)
+	}
+	if subtitle := messages[0].message.Cards[0].Header.Subtitle; subtitle != "Noisiest alerts over the last 7d" {
+		t.Errorf("Unexpected subtitle %q", subtitle)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stormBucket counts the alerts a route received in one minute.
+type stormBucket struct {
+	minute int64
+	count  int
+}
+
+// routeStorm is the storm state of one route.
+type routeStorm struct {
+	buckets []stormBucket
+	// threshold is the window count needed to start the storm, fixed when
+	// it starts so the storm itself does not raise the baseline.
+	threshold float64
+	since     time.Time
+	digest    *QuietDigest
+}
+
+// StormDetector watches the rate of alerts per route. A route whose alerts
+// in the last window exceed the trailing baseline by the configured factor
+// is in a storm: its alerts are held and posted as one summary once the
+// rate drops back below the threshold that started it.
+type StormDetector struct {
+	mu     sync.Mutex
+	routes map[string]*routeStorm
+	// pending are storms whose summary could not be sent yet.
+	pending []endedStorm
+}
+
+var storms = NewStormDetector()
+
+func NewStormDetector() *StormDetector {
+	return &StormDetector{routes: map[string]*routeStorm{}}
+}
+
+// counts returns the alerts received in the window ending at now and the
+// number expected in a window of that length from the baseline before it.
+// Buckets older than the baseline are dropped.
+func (s *routeStorm) counts(cfg StormConfig, now time.Time) (int, float64) {
+	minute := now.Unix() / 60
+	windowStart := minute - int64(cfg.Window/time.Minute)
+	baselineStart := windowStart - int64(cfg.Baseline/time.Minute)
+
+	var window, baseline int
+	kept := s.buckets[:0]
+	for _, b := range s.buckets {
+		switch {
+		case b.minute <= baselineStart:
+			continue
+		case b.minute > windowStart:
+			window += b.count
+		default:
+			baseline += b.count
+		}
+		kept = append(kept, b)
+	}
+	s.buckets = kept
+	return window, float64(baseline) * float64(cfg.Window) / float64(cfg.Baseline)
+}
+
+// Observe records n alerts for route at now. It reports whether the route
+// is in a storm, whether this call started it, and the alerts received in
+// the current window.
+func (d *StormDetector) Observe(cfg StormConfig, route string, n int, now time.Time) (storming, started bool, count int) {
+	if !cfg.Enabled {
+		return false, false, 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.routes[route]
+	if !ok {
+		s = &routeStorm{}
+		d.routes[route] = s
+	}
+	minute := now.Unix() / 60
+	if last := len(s.buckets) - 1; last >= 0 && s.buckets[last].minute == minute {
+		s.buckets[last].count += n
+	} else {
+		s.buckets = append(s.buckets, stormBucket{minute: minute, count: n})
+	}
+
+	window, expected := s.counts(cfg, now)
+	if s.digest != nil {
+		return true, false, window
+	}
+	threshold := cfg.Factor * expected
+	if threshold < float64(cfg.MinAlerts) {
+		threshold = float64(cfg.MinAlerts)
+	}
+	if float64(window) < threshold {
+		return false, false, window
+	}
+	s.threshold = threshold
+	s.since = now
+	s.digest = NewQuietDigest()
+	return true, true, window
+}
+
+// Hold adds alerts received for receiver to the digest of route's storm.
+func (d *StormDetector) Hold(route, receiver string, alerts Alerts, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.routes[route]; ok && s.digest != nil {
+		s.digest.Hold(receiver, alerts, now)
+	}
+}
+
+// endedStorm is a storm that has passed, with the alerts held during it.
+type endedStorm struct {
+	route  string
+	since  time.Time
+	digest *QuietDigest
+}
+
+// Ended returns the storms whose rate has dropped below the threshold that
+// started them, and resets their routes to normal delivery.
+func (d *StormDetector) Ended(cfg StormConfig, now time.Time) []endedStorm {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ended := d.pending
+	d.pending = nil
+	for route, s := range d.routes {
+		if s.digest == nil {
+			continue
+		}
+		if window, _ := s.counts(cfg, now); cfg.Enabled && float64(window) >= s.threshold {
+			continue
+		}
+		ended = append(ended, endedStorm{route: route, since: s.since, digest: s.digest})
+		s.digest = nil
+	}
+	sort.Slice(ended, func(i, j int) bool { return ended[i].route < ended[j].route })
+	return ended
+}
+
+// retry returns a storm whose summary failed to send, so the next check
+// tries again.
+func (d *StormDetector) retry(storm endedStorm) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = append(d.pending, storm)
+}
+
+// buildStormMessage renders the banner posted when a storm starts.
+func buildStormMessage(route string, count int, window time.Duration) *GoogleChatMessage {
+	text := fmt.Sprintf("Storm detected: %d alerts in %s", count, formatDuration(window))
+	return &GoogleChatMessage{
+		Text: text,
+		Cards: []Card{{
+			Header: &CardHeader{Title: "Alert storm detected", Subtitle: "Route " + route},
+			Sections: []CardSection{{
+				Widgets: []Widget{{TextParagraph: &TextParagraph{
+					Text: fmt.Sprintf("<b>%d alerts in %s</b>, well above the usual rate. Further alerts on this route are held and posted as one summary when the storm is over.", count, formatDuration(window)),
+				}}},
+			}},
+		}},
+	}
+}
+
+// holdStormAlerts holds the alerts in payload when route is in a storm,
+// posting the storm banner when this payload started it. It reports whether
+// the alerts were held.
+func holdStormAlerts(ctx context.Context, reqID string, payload *AlertManagerPayload, route *Route, provider Provider) bool {
+	if route.DisableChat {
+		return false
+	}
+	cfg := getRuntime().Config.Storm
+	now := clock.Now()
+	storming, started, count := storms.Observe(cfg, route.Name, len(payload.Alerts), now)
+	if !storming {
+		return false
+	}
+	if started {
+		logger.Info("[%s] Alert storm on route %s: %d alerts in %s", reqID, route.Name, count, cfg.Window)
+		alertStorms.WithLabelValues(route.Name).Inc()
+		if err := route.Send(ctx, provider, buildStormMessage(route.Name, count, cfg.Window), reqID); err != nil {
+			logger.Error("[%s] Error sending storm banner: %v", reqID, err)
+		}
+	}
+	storms.Hold(route.Name, payload.Receiver, payload.Alerts, now)
+	alertsHeld.Add(float64(len(payload.Alerts)))
+	return true
+}
+
+// flushStorms posts the summary of each storm that has passed.
+func flushStorms(provider Provider, now time.Time) {
+	for _, storm := range storms.Ended(getRuntime().Config.Storm, now) {
+		logger.Info("Alert storm on route %s is over after %s", storm.route, formatDuration(now.Sub(storm.since)))
+		sendDigest(storm.digest, "Alert storm summary", provider, now)
+		if storm.digest.Len() > 0 {
+			storms.retry(storm)
+		}
+	}
+}
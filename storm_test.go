@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStormDetector(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { storms = NewStormDetector() }()
+	storms = NewStormDetector()
+
+	cfg := Config{Storm: StormConfig{Enabled: true, Factor: 5, Window: 5 * time.Minute, Baseline: time.Hour, MinAlerts: 20}}
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: cfg, DefaultRoute: &Route{Name: defaultRouteName}})
+
+	provider := NewMockProvider(false)
+	route := &Route{Name: defaultRouteName}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	payload := func(i int) *AlertManagerPayload {
+		return &AlertManagerPayload{Receiver: "ops", Alerts: Alerts{{
+			Status:      "firing",
+			Fingerprint: fmt.Sprintf("fp-%d", i),
+			Labels:      KV{"alertname": "NodeDown", "instance": fmt.Sprintf("node-%d", i)},
+		}}}
+	}
+
+	// A steady baseline of 12 alerts an hour, 1 per 5 minutes.
+	for i := 0; i < 12; i++ {
+		if _, started, _ := storms.Observe(cfg.Storm, route.Name, 1, start.Add(time.Duration(i)*5*time.Minute)); started {
+			t.Fatalf("Unexpected storm during the baseline")
+		}
+	}
+
+	// 30 alerts in a minute exceed both min_alerts and 5x the baseline.
+	now := start.Add(time.Hour)
+	held := 0
+	for i := 0; i < 30; i++ {
+		storming, started, count := storms.Observe(cfg.Storm, route.Name, 1, now)
+		if started && count != 20 {
+			t.Errorf("Storm started at %d alerts, want 20", count)
+		}
+		if storming {
+			storms.Hold(route.Name, "ops", payload(i).Alerts, now)
+			held++
+		}
+	}
+	if held != 11 {
+		t.Errorf("Expected 11 alerts held, got %d", held)
+	}
+
+	if ended := storms.Ended(cfg.Storm, now.Add(2*time.Minute)); len(ended) != 0 {
+		t.Fatalf("Expected the storm to continue within the window, got %d ended", len(ended))
+	}
+
+	flushStorms(provider, now.Add(6*time.Minute))
+	messages := provider.GetSentMessages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one storm summary, got %d", len(messages))
+	}
+	if text := messages[0].message.Text; text != "Alert storm summary: 11 firing, 0 resolved" {
+		t.Errorf("Unexpected summary %q", text)
+	}
+
+	if holdStormAlerts(context.Background(), "req-1", payload(100), route, provider) {
+		t.Errorf("Expected normal delivery after the storm")
+	}
+}
+
+func TestHoldStormAlertsBanner(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { storms = NewStormDetector() }()
+	storms = NewStormDetector()
+
+	cfg := Config{Storm: StormConfig{Enabled: true, Factor: 5, Window: 5 * time.Minute, Baseline: time.Hour, MinAlerts: 3}}
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: cfg})
+
+	provider := NewMockProvider(false)
+	route := &Route{Name: "ops"}
+	alerts := func(n int) *AlertManagerPayload {
+		p := &AlertManagerPayload{}
+		for i := 0; i < n; i++ {
+			p.Alerts = append(p.Alerts, Alert{Status: "firing", Labels: KV{"alertname": "NodeDown", "instance": fmt.Sprint(i)}})
+		}
+		return p
+	}
+
+	if holdStormAlerts(context.Background(), "req-1", alerts(2), route, provider) {
+		t.Fatal("Expected no storm below min_alerts")
+	}
+	if !holdStormAlerts(context.Background(), "req-2", alerts(245), route, provider) {
+		t.Fatal("Expected alerts to be held in a storm")
+	}
+	if !holdStormAlerts(context.Background(), "req-3", alerts(1), route, provider) {
+		t.Fatal("Expected alerts to be held while the storm lasts")
+	}
+
+	messages := provider.GetSentMessages()
+	if len(messages) != 1 || messages[0].message.Text != "Storm detected: 247 alerts in 5m" {
+		t.Fatalf("Expected one storm banner, got %+v", messages)
+	}
+
+	disabled := &Route{Name: "tickets-only", DisableChat: true}
+	if holdStormAlerts(context.Background(), "req-4", alerts(300), disabled, provider) {
+		t.Error("Expected routes without Chat to be left alone")
+	}
+}
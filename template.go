@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The types below mirror the data model of AlertManager's notification
+// templates (github.com/prometheus/alertmanager/template), so templates
+// written for AlertManager receivers can be reused with few changes.
+
+// KV is a set of key/value string pairs such as labels or annotations.
+type KV map[string]string
+
+// Pair is a key/value string pair.
+type Pair struct {
+	Name, Value string
+}
+
+// Pairs is a list of key/value string pairs.
+type Pairs []Pair
+
+// Names returns the list of names of the pairs.
+func (ps Pairs) Names() []string {
+	ns := make([]string, 0, len(ps))
+	for _, p := range ps {
+		ns = append(ns, p.Name)
+	}
+	return ns
+}
+
+// Values returns the list of values of the pairs.
+func (ps Pairs) Values() []string {
+	vs := make([]string, 0, len(ps))
+	for _, p := range ps {
+		vs = append(vs, p.Value)
+	}
+	return vs
+}
+
+// String returns the pairs as "name=value" joined by commas.
+func (ps Pairs) String() string {
+	var b strings.Builder
+	for i, p := range ps {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(p.Name)
+		b.WriteByte('=')
+		b.WriteString(p.Value)
+	}
+	return b.String()
+}
+
+// SortedPairs returns the pairs sorted by name, with alertname first.
+func (kv KV) SortedPairs() Pairs {
+	var (
+		pairs     = make([]Pair, 0, len(kv))
+		keys      = make([]string, 0, len(kv))
+		sortStart = 0
+	)
+	for k := range kv {
+		if k == "alertname" {
+			keys = append([]string{k}, keys...)
+			sortStart = 1
+		} else {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys[sortStart:])
+
+	for _, k := range keys {
+		pairs = append(pairs, Pair{k, kv[k]})
+	}
+	return pairs
+}
+
+// Remove returns a copy of the key/value set without the given keys.
+func (kv KV) Remove(keys []string) KV {
+	keySet := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		keySet[k] = struct{}{}
+	}
+
+	res := KV{}
+	for k, v := range kv {
+		if _, ok := keySet[k]; !ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// Names returns the names of the label names in the LabelSet.
+func (kv KV) Names() []string {
+	return kv.SortedPairs().Names()
+}
+
+// Values returns a list of the values in the LabelSet.
+func (kv KV) Values() []string {
+	return kv.SortedPairs().Values()
+}
+
+// Alerts is a list of Alert objects.
+type Alerts []Alert
+
+// Firing returns the subset of alerts that are firing.
+func (as Alerts) Firing() []Alert {
+	res := []Alert{}
+	for _, a := range as {
+		if a.Status == "firing" {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// Resolved returns the subset of alerts that are resolved.
+func (as Alerts) Resolved() []Alert {
+	res := []Alert{}
+	for _, a := range as {
+		if a.Status == "resolved" {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// FiringDuration returns how long a resolved alert was firing. It reports
+// false for firing alerts and when either timestamp is missing.
+func (a Alert) FiringDuration() (time.Duration, bool) {
+	if a.Status != "resolved" || a.StartsAt.IsZero() || a.EndsAt.IsZero() || a.EndsAt.Before(a.StartsAt) {
+		return 0, false
+	}
+	return a.EndsAt.Sub(a.StartsAt), true
+}
+
+// templateFuncs matches the default function map AlertManager provides to
+// notification templates.
+var templateFuncs = template.FuncMap{
+	"toUpper": strings.ToUpper,
+	"toLower": strings.ToLower,
+	"title": func(text string) string {
+		return strings.Title(text) //nolint:staticcheck // matches AlertManager.
+	},
+	"trimSpace": strings.TrimSpace,
+	"join": func(sep string, s []string) string {
+		return strings.Join(s, sep)
+	},
+	"match": regexp.MatchString,
+	"safeHtml": func(text string) string {
+		return text
+	},
+	"reReplaceAll": func(pattern, repl, text string) string {
+		re := regexp.MustCompile(pattern)
+		return re.ReplaceAllString(text, repl)
+	},
+	"stringSlice": func(s ...string) []string {
+		return s
+	},
+	"date": func(fmt string, t time.Time) string {
+		return t.Format(fmt)
+	},
+	"tz": func(name string, t time.Time) (time.Time, error) {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.In(loc), nil
+	},
+	"since": time.Since,
+	// groupMessage and alertMessage return the first message posted through
+	// the Chat API for an alert group or alert, or nil.
+	"groupMessage": func(groupKey string) *ChatMessageRef {
+		return postedMessages.Group(groupKey)
+	},
+	"alertMessage": func(alert Alert) *ChatMessageRef {
+		return postedMessages.Alert(alert)
+	},
+	"humanizeDuration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+}
+
+// MessageTemplates renders the configured title and text templates.
+type MessageTemplates struct {
+	tmpl     *template.Template
+	hasTitle bool
+	hasText  bool
+}
+
+// parseSnippets parses the template files and named snippets from cfg into
+// one set. Message and ticket templates are parsed into copies of the set,
+// so they can use its templates and redefine its blocks without affecting
+// each other.
+func parseSnippets(cfg TemplatesConfig) (*template.Template, error) {
+	tmpl := template.New("").Option("missingkey=zero").Funcs(templateFuncs)
+	for _, pattern := range cfg.Files {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template file pattern %q: %v", pattern, err)
+		}
+		for _, file := range files {
+			if _, err := tmpl.ParseFiles(file); err != nil {
+				return nil, fmt.Errorf("failed to parse template file %s: %v", file, err)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Snippets))
+	for name := range cfg.Snippets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := tmpl.New(name).Parse(cfg.Snippets[name]); err != nil {
+			return nil, fmt.Errorf("failed to parse template snippet %s: %v", name, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// NewMessageTemplates parses the template files and inline templates from
+// cfg. It returns nil when no templates are configured.
+func NewMessageTemplates(cfg TemplatesConfig) (*MessageTemplates, error) {
+	if len(cfg.Files) == 0 && cfg.Title == "" && cfg.Text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := parseSnippets(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tmpl.New("title").Parse(cfg.Title); err != nil {
+		return nil, fmt.Errorf("failed to parse title template: %v", err)
+	}
+	if _, err := tmpl.New("text").Parse(cfg.Text); err != nil {
+		return nil, fmt.Errorf("failed to parse text template: %v", err)
+	}
+
+	return &MessageTemplates{
+		tmpl:     tmpl,
+		hasTitle: cfg.Title != "",
+		hasText:  cfg.Text != "",
+	}, nil
+}
+
+// Title renders the title template within the limits of sandbox,
+// returning "" if none is configured.
+func (m *MessageTemplates) Title(data *AlertManagerPayload, sandbox *TemplateSandbox) (string, error) {
+	if !m.hasTitle {
+		return "", nil
+	}
+	return sandbox.Execute(m.tmpl, "title", data)
+}
+
+// Text renders the text template within the limits of sandbox, returning
+// "" if none is configured.
+func (m *MessageTemplates) Text(data *AlertManagerPayload, sandbox *TemplateSandbox) (string, error) {
+	if !m.hasText {
+		return "", nil
+	}
+	return sandbox.Execute(m.tmpl, "text", data)
+}
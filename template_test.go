@@ -0,0 +1,135 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKVSortedPairs(t *testing.T) {
+	kv := KV{"severity": "critical", "alertname": "HighCPU", "instance": "web-01"}
+
+	got := kv.SortedPairs().Names()
+	want := []string{"alertname", "instance", "severity"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortedPairs().Names() = %v, want %v", got, want)
+	}
+
+	removed := kv.Remove([]string{"instance"})
+	if _, ok := removed["instance"]; ok {
+		t.Error("Expected instance to be removed")
+	}
+	if len(kv) != 3 {
+		t.Error("Expected Remove to leave the original set untouched")
+	}
+}
+
+func TestMessageTemplates(t *testing.T) {
+	payload := &AlertManagerPayload{
+		Status: "firing",
+		Alerts: []Alert{
+			{Status: "firing", Labels: map[string]string{"alertname": "HighCPU", "instance": "web-01"}},
+			{Status: "resolved", Labels: map[string]string{"alertname": "HighCPU", "instance": "web-02"}},
+		},
+		CommonLabels: map[string]string{"alertname": "HighCPU", "team": "platform"},
+	}
+
+	tests := []struct {
+		name     string
+		cfg      TemplatesConfig
+		wantText string
+		wantErr  bool
+	}{
+		{
+			name:     "alertmanager style helpers",
+			cfg:      TemplatesConfig{Text: `[{{ .Status | toUpper }}:{{ .Alerts.Firing | len }}] {{ .CommonLabels.alertname }}`},
+			wantText: "[FIRING:1] HighCPU",
+		},
+		{
+			name:     "sorted pairs",
+			cfg:      TemplatesConfig{Text: `{{ range .CommonLabels.SortedPairs }}{{ .Name }}={{ .Value }} {{ end }}`},
+			wantText: "alertname=HighCPU team=platform",
+		},
+		{
+			name:     "resolved instances",
+			cfg:      TemplatesConfig{Text: `{{ range .Alerts.Resolved }}{{ .Labels.instance }}{{ end }}`},
+			wantText: "web-02",
+		},
+		{
+			name: "snippets",
+			cfg: TemplatesConfig{
+				Snippets: map[string]string{
+					"gchat.prefix": `[{{ .Status | toUpper }}]`,
+					"gchat.footer": `{{ define "gchat.team" }}{{ .CommonLabels.team }}{{ end }}team {{ template "gchat.team" . }}`,
+				},
+				Text: `{{ template "gchat.prefix" . }} {{ .CommonLabels.alertname }}, {{ template "gchat.footer" . }}`,
+			},
+			wantText: "[FIRING] HighCPU, team platform",
+		},
+		{
+			name:    "parse error",
+			cfg:     TemplatesConfig{Text: `{{ .Status `},
+			wantErr: true,
+		},
+		{
+			name:    "snippet parse error",
+			cfg:     TemplatesConfig{Snippets: map[string]string{"broken": `{{ .Status `}, Text: "ok"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := NewMessageTemplates(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMessageTemplates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			text, err := tmpl.Text(payload, nil)
+			if err != nil {
+				t.Fatalf("Text() error = %v", err)
+			}
+			if text != tt.wantText {
+				t.Errorf("Text() = %q, want %q", text, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestTicketTemplateSnippets(t *testing.T) {
+	snippets, err := parseSnippets(TemplatesConfig{Snippets: map[string]string{
+		"ticket.body":   `{{ .CommonLabels.alertname }}{{ block "ticket.footer" . }} (default footer){{ end }}`,
+		"ticket.source": "Sent by the alert bridge",
+	}})
+	if err != nil {
+		t.Fatalf("parseSnippets() error = %v", err)
+	}
+	payload := &AlertManagerPayload{CommonLabels: KV{"alertname": "DiskFull", "team": "db"}}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"uses a snippet", `{{ template "ticket.source" }}`, "Sent by the alert bridge"},
+		{"uses a block default", `{{ template "ticket.body" . }}`, "DiskFull (default footer)"},
+		{"overrides a block", `{{ define "ticket.footer" }} for team {{ .CommonLabels.team }}{{ end }}{{ template "ticket.body" . }}`, "DiskFull for team db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTicketTemplate(snippets, "body", tt.text)
+			if err != nil {
+				t.Fatalf("parseTicketTemplate() error = %v", err)
+			}
+			got, err := renderTicketTemplate(nil, tmpl, payload)
+			if err != nil {
+				t.Fatalf("renderTicketTemplate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"text/template"
+)
+
+// TicketProvider files a ticket for a firing alert group and follows up on
+// it when the group resolves. Routes run their ticket providers alongside
+// the Chat notification.
+type TicketProvider interface {
+	Ticket(ctx context.Context, payload *AlertManagerPayload, reqID string) error
+}
+
+// ticketPreviewer is implemented by ticket providers that can render their
+// fields without filing a ticket, for lint-templates.
+type ticketPreviewer interface {
+	Preview(payload *AlertManagerPayload) (map[string]string, error)
+}
+
+// TicketStore maps "<provider>/<route>/<group key>" to the ticket opened
+// for the alert group. With a path, every change is written to disk so
+// resolved notifications after a restart still find their ticket.
+type TicketStore struct {
+	mu      sync.Mutex
+	path    string
+	tickets map[string]string
+}
+
+var tickets = NewTicketStore("")
+
+func NewTicketStore(path string) *TicketStore {
+	return &TicketStore{path: path, tickets: map[string]string{}}
+}
+
+// LoadTicketStore opens the store persisted at path.
+func LoadTicketStore(path string) (*TicketStore, error) {
+	s := NewTicketStore(path)
+	if err := loadState(path, &s.tickets); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *TicketStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ticket, ok := s.tickets[key]
+	return ticket, ok
+}
+
+func (s *TicketStore) Set(key, ticket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickets[key] = ticket
+	return s.save()
+}
+
+func (s *TicketStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tickets[key]; !ok {
+		return nil
+	}
+	delete(s.tickets, key)
+	return s.save()
+}
+
+// save writes the store to disk. The caller must hold s.mu.
+func (s *TicketStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return saveState(s.path, s.tickets)
+}
+
+// ticketKey identifies the ticket a provider opened for an alert group on
+// a route.
+func ticketKey(provider, route string, payload *AlertManagerPayload) string {
+	return provider + "/" + route + "/" + payload.GroupKey
+}
+
+// parseTicketTemplate parses a ticket field template with the functions
+// available to message templates. Templates in snippets, if not nil, can be
+// used and redefined.
+func parseTicketTemplate(snippets *template.Template, name, text string) (*template.Template, error) {
+	if snippets == nil {
+		return template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	}
+	tmpl, err := snippets.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.New(name).Parse(text)
+}
+
+// renderTicketTemplate renders a ticket field within the route's template
+// limits.
+func renderTicketTemplate(sandbox *TemplateSandbox, tmpl *template.Template, data interface{}) (string, error) {
+	return sandbox.Execute(tmpl, "", data)
+}
+
+// Ticket runs the route's ticket providers. Failures are logged rather than
+// failing the request, since AlertManager would retry the Chat notification
+// too.
+func (r *Route) Ticket(ctx context.Context, payload *AlertManagerPayload, reqID string) {
+	for _, t := range r.Tickets {
+		if err := t.Ticket(ctx, payload, reqID); err != nil {
+			logger.Error("[%s] Error updating ticket for route %s: %v", reqID, r.Name, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// serverWriteTimeout bounds writing a response on the public listener. The
+// request timeout must end before it so the 503 still reaches the client.
+const serverWriteTimeout = 30 * time.Second
+
+// withRequestTimeout answers with 503 when next takes longer than timeout
+// and cancels the request context, so a hung lookup or send gives up
+// instead of holding the connection. It is a no-op when timeout is zero.
+func withRequestTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	msg := fmt.Sprintf("Request timed out after %s\n", timeout)
+	return http.TimeoutHandler(next, timeout, msg)
+}
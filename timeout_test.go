@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithRequestTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("done"))
+		}
+	})
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		handler  http.Handler
+		wantCode int
+		wantBody string
+	}{
+		{"fast request", 50 * time.Millisecond, fast, http.StatusOK, "done"},
+		{"slow request", 50 * time.Millisecond, slow, http.StatusServiceUnavailable, "Request timed out after 50ms\n"},
+		{"disabled", 0, fast, http.StatusOK, "done"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			withRequestTimeout(tt.timeout, tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	starjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+)
+
+// transformSandbox is the route label under which transform runs stopped
+// by a limit are counted.
+const transformSandbox = "transform"
+
+// Transformer runs the transform(payload) function of a Starlark script.
+// The payload is passed as a dict with the webhook JSON field names and the
+// returned dict replaces it. Returning None drops the notification. A nil
+// Transformer leaves payloads unchanged.
+type Transformer struct {
+	fn      starlark.Callable
+	timeout time.Duration
+	// sandbox applies the max_output of [templates.limits] to what the
+	// script adds to the payload, and counts runs stopped by a limit.
+	sandbox *TemplateSandbox
+}
+
+// NewTransformer loads the script once; it returns nil when no script is
+// configured. The script's globals are frozen, since concurrent requests
+// share them. Each run is cancelled after the transform timeout and fails
+// when its result is more than the max_output of limits larger than the
+// payload.
+func NewTransformer(cfg TransformConfig, limits TemplateLimitsConfig) (*Transformer, error) {
+	if cfg.Script == "" {
+		return nil, nil
+	}
+
+	thread := &starlark.Thread{Name: "load " + cfg.Script, Print: starlarkPrint}
+	globals, err := starlark.ExecFile(thread, cfg.Script, nil, starlark.StringDict{"json": starjson.Module})
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+	fn, ok := globals["transform"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s does not define a transform(payload) function", cfg.Script)
+	}
+	return &Transformer{fn: fn, timeout: cfg.Timeout, sandbox: NewTemplateSandbox(transformSandbox, limits)}, nil
+}
+
+// Apply calls the script on payload. On any failure payload is left
+// untouched so a broken script never loses alerts.
+func (t *Transformer) Apply(reqID string, payload *AlertManagerPayload) error {
+	if t == nil {
+		return nil
+	}
+
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	thread := &starlark.Thread{Name: reqID, Print: starlarkPrint}
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(t.timeout, func() {
+		timedOut.Store(true)
+		thread.Cancel("timeout")
+	})
+	defer timer.Stop()
+	defer func() {
+		if timedOut.Load() {
+			t.sandbox.exceeded(limitTimeout)
+		}
+	}()
+
+	decode := starjson.Module.Members["decode"]
+	value, err := starlark.Call(thread, decode, starlark.Tuple{starlark.String(input)}, nil)
+	if err != nil {
+		return err
+	}
+	result, err := starlark.Call(thread, t.fn, starlark.Tuple{value}, nil)
+	if err != nil {
+		return err
+	}
+
+	if result == starlark.None {
+		logger.Debug("[%s] Transform dropped the notification", reqID)
+		payload.Alerts = nil
+		return nil
+	}
+
+	encode := starjson.Module.Members["encode"]
+	output, err := starlark.Call(thread, encode, starlark.Tuple{result}, nil)
+	if err != nil {
+		return err
+	}
+
+	if max := t.sandbox.limits.MaxOutput; max > 0 && len(output.(starlark.String)) > len(input)+max {
+		t.sandbox.exceeded(limitOutput)
+		return fmt.Errorf("transform result %w of %d bytes over the payload", errTemplateOutput, max)
+	}
+
+	var transformed AlertManagerPayload
+	if err := json.Unmarshal([]byte(output.(starlark.String)), &transformed); err != nil {
+		return fmt.Errorf("invalid transform result: %v", err)
+	}
+	*payload = transformed
+	return nil
+}
+
+func starlarkPrint(thread *starlark.Thread, msg string) {
+	logger.Debug("[%s] transform: %s", thread.Name, msg)
+}
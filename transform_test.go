@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transform.star")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTransformer(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+
+	newPayload := func() *AlertManagerPayload {
+		return &AlertManagerPayload{
+			Status: "firing",
+			Alerts: Alerts{
+				{Status: "firing", Labels: KV{"alertname": "HighCPU", "env": "prod"}},
+				{Status: "firing", Labels: KV{"alertname": "Debug", "env": "dev"}},
+			},
+		}
+	}
+
+	var nilTransformer *Transformer
+	if err := nilTransformer.Apply("req-0", newPayload()); err != nil {
+		t.Errorf("nil Transformer.Apply() error = %v", err)
+	}
+
+	tr, err := NewTransformer(TransformConfig{
+		Script: writeScript(t, `
+def transform(payload):
+    payload["alerts"] = [a for a in payload["alerts"] if a["labels"]["env"] != "dev"]
+    for a in payload["alerts"]:
+        a["labels"]["team"] = a["labels"].get("team", "platform")
+        a["annotations"] = {"summary": "%s in %s" % (a["labels"]["alertname"], a["labels"]["env"])}
+    return payload
+`),
+		Timeout: time.Second,
+	}, TemplateLimitsConfig{MaxOutput: 1024})
+	if err != nil {
+		t.Fatalf("NewTransformer() error = %v", err)
+	}
+	payload := newPayload()
+	if err := tr.Apply("req-1", payload); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(payload.Alerts) != 1 {
+		t.Fatalf("Expected 1 alert after transform, got %d", len(payload.Alerts))
+	}
+	if got := payload.Alerts[0].Labels["team"]; got != "platform" {
+		t.Errorf("Expected derived team label platform, got %s", got)
+	}
+	if got := payload.Alerts[0].Annotations["summary"]; got != "HighCPU in prod" {
+		t.Errorf("Expected derived summary, got %s", got)
+	}
+
+	drop, err := NewTransformer(TransformConfig{Script: writeScript(t, "def transform(payload):\n    return None\n"), Timeout: time.Second}, TemplateLimitsConfig{})
+	if err != nil {
+		t.Fatalf("NewTransformer() error = %v", err)
+	}
+	payload = newPayload()
+	if err := drop.Apply("req-2", payload); err != nil || len(payload.Alerts) != 0 {
+		t.Errorf("Expected None to drop all alerts, got %d alerts, err = %v", len(payload.Alerts), err)
+	}
+
+	failing := []string{
+		"def transform(payload):\n    fail(\"boom\")\n",
+		"def transform(payload):\n    return 42\n",
+		"def transform(payload):\n    for i in range(1000000000):\n        pass\n",
+		"seen = []\ndef transform(payload):\n    seen.append(payload)\n    return payload\n",
+		"def transform(payload):\n    payload[\"receiver\"] = \"x\" * 100000\n    return payload\n",
+	}
+	for _, src := range failing {
+		tr, err := NewTransformer(TransformConfig{Script: writeScript(t, src), Timeout: 50 * time.Millisecond}, TemplateLimitsConfig{MaxOutput: 1024})
+		if err != nil {
+			t.Fatalf("NewTransformer() error = %v", err)
+		}
+		payload := newPayload()
+		if err := tr.Apply("req-3", payload); err == nil {
+			t.Errorf("Apply(%q) expected error", src)
+		}
+		if len(payload.Alerts) != 2 {
+			t.Errorf("Expected payload to be unchanged after failure, got %d alerts", len(payload.Alerts))
+		}
+	}
+
+	if _, err := NewTransformer(TransformConfig{Script: writeScript(t, "x = 1\n")}, TemplateLimitsConfig{}); err == nil {
+		t.Error("Expected error for script without transform function")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NotifiedGroup is what was last notified for an alert group.
+type NotifiedGroup struct {
+	Route string `json:"route"`
+	// Firing holds the keys of the alerts notified as firing and not
+	// resolved since.
+	Firing     []string  `json:"firing"`
+	NotifiedAt time.Time `json:"notifiedAt"`
+	// seq identifies the Advance that recorded the group, so undoing it
+	// leaves later notifications alone.
+	seq uint64
+}
+
+// GroupDelta is how an alert group changed since its last notification.
+// Update messages pass it to templates as .Update.
+type GroupDelta struct {
+	// New alerts are firing and were not before.
+	New Alerts `json:"new"`
+	// Resolved alerts were firing and have resolved.
+	Resolved Alerts `json:"resolved"`
+	// Firing is the number of alerts firing now.
+	Firing int `json:"firing"`
+}
+
+func (d *GroupDelta) String() string {
+	var parts []string
+	if len(d.New) > 0 {
+		parts = append(parts, fmt.Sprintf("+%d new", len(d.New)))
+	}
+	if len(d.Resolved) > 0 {
+		parts = append(parts, fmt.Sprintf("%d resolved", len(d.Resolved)))
+	}
+	return strings.Join(append(parts, fmt.Sprintf("%d firing", d.Firing)), ", ")
+}
+
+// GroupStore remembers the firing alerts last notified for each alert
+// group, by group key, so a change to the group can be sent as an update.
+// With a path, changes are written to disk in the background so updates
+// carry on across restarts.
+type GroupStore struct {
+	mu     sync.Mutex
+	path   string
+	groups map[string]NotifiedGroup
+	seq    uint64
+	dirty  bool
+	saving bool
+	// saveMu orders writes of the state file.
+	saveMu sync.Mutex
+}
+
+var notifiedGroups = NewGroupStore("")
+
+func NewGroupStore(path string) *GroupStore {
+	return &GroupStore{path: path, groups: map[string]NotifiedGroup{}}
+}
+
+// LoadGroupStore opens the store persisted at path.
+func LoadGroupStore(path string) (*GroupStore, error) {
+	s := NewGroupStore(path)
+	if err := loadState(path, &s.groups); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Advance records that payload is being notified on route at now and
+// returns how its group changed since it was last notified there, or nil
+// when the whole card should be sent: the group is new, was notified on
+// another route or more than maxAge ago, has resolved, or has the same
+// firing alerts. Both happen under one lock, so concurrent notifications of
+// a group each see the other's alerts. Firing alerts left out of payload,
+// e.g. by a repeat interval, stay known until they resolve or the group is
+// forgotten. The returned function undoes the record when the notification
+// is not sent after all, unless a later one has been recorded since.
+func (s *GroupStore) Advance(route string, payload *AlertManagerPayload, maxAge time.Duration, now time.Time) (*GroupDelta, func()) {
+	if payload.GroupKey == "" {
+		return nil, func() {}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := payload.GroupKey
+	prev, ok := s.groups[key]
+	s.seq++
+	seq := s.seq
+	undo := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if cur, found := s.groups[key]; found && cur.seq != seq || !found && payload.Status == "firing" {
+			return
+		}
+		if ok {
+			s.groups[key] = prev
+		} else {
+			delete(s.groups, key)
+		}
+		s.changed()
+	}
+	defer s.changed()
+	if payload.Status != "firing" {
+		delete(s.groups, key)
+		return nil, undo
+	}
+
+	firing := map[string]bool{}
+	known := ok && prev.Route == route && now.Sub(prev.NotifiedAt) <= maxAge
+	if known {
+		for _, key := range prev.Firing {
+			firing[key] = true
+		}
+	}
+	delta := &GroupDelta{}
+	for _, alert := range payload.Alerts {
+		key := alertKey(alert)
+		switch {
+		case alert.Status == "firing":
+			delta.Firing++
+			if !firing[key] {
+				delta.New = append(delta.New, alert)
+			}
+		case firing[key]:
+			delta.Resolved = append(delta.Resolved, alert)
+		}
+		firing[key] = alert.Status == "firing"
+	}
+	g := NotifiedGroup{Route: route, NotifiedAt: now, seq: seq}
+	for key, ok := range firing {
+		if ok {
+			g.Firing = append(g.Firing, key)
+		}
+	}
+	s.groups[key] = g
+
+	if !known || len(delta.New) == 0 && len(delta.Resolved) == 0 {
+		return nil, undo
+	}
+	return delta, undo
+}
+
+// changed marks the store for saving and starts a save unless one is
+// running. The caller must hold s.mu.
+func (s *GroupStore) changed() {
+	s.dirty = true
+	if s.path != "" && !s.saving {
+		s.saving = true
+		go s.flush()
+	}
+}
+
+// flush saves the store until no changes are left.
+func (s *GroupStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.dirty {
+		s.mu.Unlock()
+		err := s.Save()
+		s.mu.Lock()
+		if err != nil {
+			logger.Error("Error saving alert group state: %v", err)
+			s.dirty = true
+			break
+		}
+	}
+	s.saving = false
+}
+
+// Save writes the store to disk now.
+func (s *GroupStore) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	groups := maps.Clone(s.groups)
+	s.dirty = false
+	s.mu.Unlock()
+	return saveState(s.path, groups)
+}
+
+// Compact forgets the groups not notified within maxAge of now, saves the
+// store and returns the size of its file.
+func (s *GroupStore) Compact(now time.Time, maxAge time.Duration) (int64, error) {
+	s.mu.Lock()
+	for key, g := range s.groups {
+		if now.Sub(g.NotifiedAt) > maxAge {
+			delete(s.groups, key)
+		}
+	}
+	s.mu.Unlock()
+	if s.path == "" {
+		return 0, nil
+	}
+	if err := s.Save(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// renderUpdateMessage builds the update for a change to payload's group.
+// It renders a copy of payload holding only the new and resolved alerts,
+// with the change as .Update, through the Jsonnet template or the title and
+// text templates within the limits of sandbox. The built-in update card
+// lists those alerts using layout.
+func renderUpdateMessage(payload *AlertManagerPayload, delta *GroupDelta, layout LayoutConfig, sandbox *TemplateSandbox) *GoogleChatMessage {
+	update := *payload
+	update.Alerts = append(append(Alerts{}, delta.New...), delta.Resolved...)
+	update.Update = delta
+	if jsonnet := getRuntime().Jsonnet; jsonnet != nil {
+		message, err := jsonnet.Render(&update, sandbox)
+		if err == nil {
+			return message
+		}
+		logger.Error("Error rendering jsonnet template, using built-in update card: %v", err)
+	}
+
+	title := fmt.Sprintf("UPDATE Alert: %s", getAlertName(payload))
+	message := &GoogleChatMessage{Text: fmt.Sprintf("%s (%s)", title, delta)}
+	message.Text, title = renderTextTemplates(&update, sandbox, message.Text, title)
+	card := Card{
+		Header:   &CardHeader{Title: title, Subtitle: delta.String()},
+		Sections: []CardSection{},
+	}
+
+	layout = layout.withDefaults()
+	linkPrefix := getRuntime().Config.GoogleChat.LinkAnnotationPrefix
+	for i, alert := range delta.New {
+		section := createAlertSection(i+1, alert, linkPrefix, layout)
+		section.Header = fmt.Sprintf("New #%d", i+1)
+		card.Sections = append(card.Sections, section)
+	}
+	for i, alert := range delta.Resolved {
+		section := createAlertSection(i+1, alert, linkPrefix, layout)
+		section.Header = fmt.Sprintf("Resolved #%d", i+1)
+		card.Sections = append(card.Sections, section)
+	}
+
+	if layout.usesCardsV2() {
+		message.CardsV2 = append(message.CardsV2, toCardV2("update", card, accentColor(payload, layout.Colors)))
+	} else {
+		message.Cards = append(message.Cards, card)
+	}
+	return message
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcessPayloadSendsGroupUpdates(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer func() { notifiedGroups = NewGroupStore("") }()
+	notifiedGroups = NewGroupStore("")
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Config: Config{Updates: UpdatesConfig{Enabled: true, MaxAge: time.Hour}}})
+
+	data, err := os.ReadFile("test_webhook/sample_alert.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample alert: %v", err)
+	}
+	var sample AlertManagerPayload
+	if err := json.Unmarshal(data, &sample); err != nil {
+		t.Fatal(err)
+	}
+	base := sample.Alerts[0]
+
+	// Each step lists the alerts sent by fingerprint and status.
+	tests := []struct {
+		alerts       map[string]string
+		wantTitle    string
+		wantSubtitle string
+	}{
+		{alerts: map[string]string{"a": "firing", "b": "firing"}, wantTitle: "FIRING Alert: HighCPUUsage"},
+		{alerts: map[string]string{"a": "firing", "b": "firing"}, wantTitle: "FIRING Alert: HighCPUUsage"},
+		{alerts: map[string]string{"a": "firing", "b": "resolved", "c": "firing"}, wantTitle: "UPDATE Alert: HighCPUUsage", wantSubtitle: "+1 new, 1 resolved, 2 firing"},
+		{alerts: map[string]string{"a": "firing", "c": "resolved"}, wantTitle: "UPDATE Alert: HighCPUUsage", wantSubtitle: "1 resolved, 1 firing"},
+		{alerts: map[string]string{"a": "resolved"}, wantTitle: "RESOLVED Alert: HighCPUUsage"},
+		{alerts: map[string]string{"a": "firing"}, wantTitle: "FIRING Alert: HighCPUUsage"},
+	}
+	provider := NewMockProvider(false)
+	for i, tt := range tests {
+		payload := sample
+		payload.Status = "resolved"
+		payload.Alerts = nil
+		for fingerprint, status := range tt.alerts {
+			alert := base
+			alert.Fingerprint, alert.Status = fingerprint, status
+			payload.Alerts = append(payload.Alerts, alert)
+			if status == "firing" {
+				payload.Status = "firing"
+			}
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := processPayload(context.Background(), body, "req", provider); err != nil {
+			t.Fatalf("step %d: processPayload() error = %v", i, err)
+		}
+
+		sent := provider.GetSentMessages()
+		if len(sent) != i+1 {
+			t.Fatalf("step %d: sent %d messages, want %d", i, len(sent), i+1)
+		}
+		header := sent[i].message.Cards[0].Header
+		if header.Title != tt.wantTitle || (tt.wantSubtitle != "" && header.Subtitle != tt.wantSubtitle) {
+			t.Errorf("step %d: header = %q / %q, want %q / %q", i, header.Title, header.Subtitle, tt.wantTitle, tt.wantSubtitle)
+		}
+	}
+}
+
+func TestGroupStoreAdvance(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "groups.json")
+	s := NewGroupStore(path)
+
+	payload := func(status string, fingerprints ...string) *AlertManagerPayload {
+		p := &AlertManagerPayload{GroupKey: "g", Status: status}
+		for _, fp := range fingerprints {
+			p.Alerts = append(p.Alerts, Alert{Status: status, Fingerprint: fp})
+		}
+		return p
+	}
+
+	if delta, _ := s.Advance("r", payload("firing", "a"), time.Hour, t0); delta != nil {
+		t.Errorf("first notification delta = %v, want nil", delta)
+	}
+	// Two notifications adding the same alert: only the first is an update.
+	first, undoFirst := s.Advance("r", payload("firing", "a", "b"), time.Hour, t0.Add(time.Minute))
+	second, _ := s.Advance("r", payload("firing", "a", "b"), time.Hour, t0.Add(time.Minute))
+	if first == nil || len(first.New) != 1 || second != nil {
+		t.Errorf("concurrent deltas = %v, %v, want one update with 1 new alert", first, second)
+	}
+	// Undoing the first leaves the second's record in place.
+	undoFirst()
+	if delta, _ := s.Advance("r", payload("firing", "a", "b"), time.Hour, t0.Add(2*time.Minute)); delta != nil {
+		t.Errorf("delta after a stale undo = %v, want nil", delta)
+	}
+	// Undoing the latest notification restores the one before it.
+	_, undo := s.Advance("r", payload("firing", "a", "b", "c"), time.Hour, t0.Add(3*time.Minute))
+	undo()
+	if delta, _ := s.Advance("r", payload("firing", "a", "b", "c"), time.Hour, t0.Add(4*time.Minute)); delta == nil || len(delta.New) != 1 {
+		t.Errorf("delta after undo = %v, want 1 new alert", delta)
+	}
+
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGroupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := loaded.groups["g"]; len(g.Firing) != 3 {
+		t.Errorf("loaded group = %+v, want 3 firing alerts", g)
+	}
+	if _, err := loaded.Compact(t0.Add(2*time.Hour), time.Hour); err != nil || len(loaded.groups) != 0 {
+		t.Errorf("Compact() left %d groups, err = %v", len(loaded.groups), err)
+	}
+}
+
+func TestRenderUpdateMessageTemplates(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	templates, err := NewMessageTemplates(TemplatesConfig{
+		Title: `{{ len .Update.New }} new in {{ .CommonLabels.alertname }}`,
+		Text:  `{{ range .Alerts }}{{ .Status }} {{ end }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer currentRuntime.Store(nil)
+	currentRuntime.Store(&Runtime{Templates: templates})
+
+	payload := &AlertManagerPayload{
+		Status:       "firing",
+		CommonLabels: KV{"alertname": "HighCPU"},
+		Alerts:       Alerts{{Status: "firing", Fingerprint: "a"}, {Status: "firing", Fingerprint: "b"}, {Status: "resolved", Fingerprint: "c"}},
+	}
+	delta := &GroupDelta{New: Alerts{payload.Alerts[1]}, Resolved: Alerts{payload.Alerts[2]}, Firing: 2}
+	message := renderUpdateMessage(payload, delta, LayoutConfig{}, NewTemplateSandbox("r", TemplateLimitsConfig{Timeout: time.Second}))
+
+	if got := message.Cards[0].Header.Title; got != "1 new in HighCPU" {
+		t.Errorf("title = %q, want the title template", got)
+	}
+	if message.Text != "firing resolved" {
+		t.Errorf("text = %q, want the text template over the changed alerts", message.Text)
+	}
+	if payload.Update != nil || len(payload.Alerts) != 3 {
+		t.Error("renderUpdateMessage() modified the payload")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWallboardAlerts = 10
+	maxWallboardAlerts     = 50
+)
+
+// severityOrder ranks severities for the wallboard, most severe first.
+// Unknown severities sort after these.
+var severityOrder = []string{"critical", "error", "warning", "info"}
+
+// Wallboard is a compact summary of what is firing, for office displays
+// that poll it.
+type Wallboard struct {
+	UpdatedAt  *time.Time          `json:"updatedAt,omitempty"`
+	Firing     int                 `json:"firing"`
+	Acked      int                 `json:"acked"`
+	Severities []WallboardSeverity `json:"severities"`
+	Top        []WallboardAlert    `json:"top"`
+}
+
+type WallboardSeverity struct {
+	Severity string `json:"severity"`
+	Count    int    `json:"count"`
+	Color    string `json:"color,omitempty"`
+}
+
+// WallboardAlert is one alert name with the number of its firing
+// instances.
+type WallboardAlert struct {
+	Alertname string    `json:"alertname"`
+	Severity  string    `json:"severity"`
+	Count     int       `json:"count"`
+	Since     time.Time `json:"since"`
+	Summary   string    `json:"summary,omitempty"`
+}
+
+func severityRank(severity string) int {
+	for i, s := range severityOrder {
+		if s == severity {
+			return i
+		}
+	}
+	return len(severityOrder)
+}
+
+// buildWallboard summarizes alerts, listing up to limit alert names, most
+// severe and most instances first. colors are the [layout] colors.
+func buildWallboard(alerts []aggregatedAlert, updated, now time.Time, limit int, colors map[string]string) Wallboard {
+	board := Wallboard{Firing: len(alerts), Severities: []WallboardSeverity{}, Top: []WallboardAlert{}}
+	if !updated.IsZero() {
+		board.UpdatedAt = &updated
+	}
+
+	counts := map[string]int{}
+	byName := map[string]*WallboardAlert{}
+	for _, alert := range alerts {
+		severity := strings.ToLower(alert.Labels["severity"])
+		if severity == "" {
+			severity = "none"
+		}
+		counts[severity]++
+		if _, ok := acks.Get(alertKey(alert.Alert), now); ok {
+			board.Acked++
+		}
+
+		name := alert.Labels["alertname"]
+		entry, ok := byName[name]
+		if !ok {
+			entry = &WallboardAlert{Alertname: name, Severity: severity, Since: alert.StartsAt, Summary: alert.Annotations["summary"]}
+			byName[name] = entry
+		}
+		entry.Count++
+		if severityRank(severity) < severityRank(entry.Severity) {
+			entry.Severity = severity
+		}
+		if alert.StartsAt.Before(entry.Since) {
+			entry.Since = alert.StartsAt
+		}
+	}
+
+	for severity, count := range counts {
+		color := colors[severity]
+		if color == "" {
+			color = defaultColors[severity]
+		}
+		board.Severities = append(board.Severities, WallboardSeverity{Severity: severity, Count: count, Color: color})
+	}
+	sort.Slice(board.Severities, func(i, j int) bool {
+		a, b := board.Severities[i], board.Severities[j]
+		if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		return a.Severity < b.Severity
+	})
+
+	for _, entry := range byName {
+		board.Top = append(board.Top, *entry)
+	}
+	sort.Slice(board.Top, func(i, j int) bool {
+		a, b := board.Top[i], board.Top[j]
+		if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Alertname < b.Alertname
+	})
+	if len(board.Top) > limit {
+		board.Top = board.Top[:limit]
+	}
+	return board
+}
+
+// wallboardHandler serves the wallboard summary of the firing alerts.
+// ?limit= sets how many alert names are listed.
+func wallboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultWallboardAlerts
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWallboardAlerts {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rt := getRuntime()
+	now := clock.Now()
+	board := buildWallboard(aggregator.Firing(now, rt.Config.Summary.StaleAfter), aggregator.Updated(), now, limit, rt.Config.Layout.Colors)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(board)
+}
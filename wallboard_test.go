@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBuildWallboard(t *testing.T) {
+	defer func() { acks = NewAckStore("") }()
+	acks = NewAckStore("")
+	now := time.Now()
+	firing := func(name, severity, instance string, age time.Duration) aggregatedAlert {
+		return aggregatedAlert{Alert: Alert{
+			Status:      "firing",
+			Labels:      KV{"alertname": name, "severity": severity, "instance": instance},
+			Annotations: KV{"summary": name + " on " + instance},
+			StartsAt:    now.Add(-age),
+		}}
+	}
+	alerts := []aggregatedAlert{
+		firing("HighLatency", "warning", "web-1", time.Hour),
+		firing("HighLatency", "warning", "web-2", 2*time.Hour),
+		firing("DiskFull", "critical", "db-1", time.Minute),
+		firing("Backup", "", "db-1", time.Minute),
+		firing("Deprecated", "info", "api", time.Minute),
+	}
+	acks.Ack(Ack{Fingerprint: alertKey(alerts[2].Alert), By: "alice", At: now})
+
+	board := buildWallboard(alerts, now, now, 3, map[string]string{"warning": "#FFAA00"})
+	if board.Firing != 5 || board.Acked != 1 || board.UpdatedAt == nil {
+		t.Errorf("board = %+v, want 5 firing, 1 acked and an update time", board)
+	}
+	wantSeverities := []WallboardSeverity{{"critical", 1, "#D93025"}, {"warning", 2, "#FFAA00"}, {"info", 1, "#1A73E8"}, {"none", 1, ""}}
+	if len(board.Severities) != len(wantSeverities) {
+		t.Fatalf("severities = %+v, want %+v", board.Severities, wantSeverities)
+	}
+	for i, want := range wantSeverities {
+		if board.Severities[i] != want {
+			t.Errorf("severity %d = %+v, want %+v", i, board.Severities[i], want)
+		}
+	}
+
+	var names []string
+	for _, a := range board.Top {
+		names = append(names, a.Alertname)
+	}
+	if len(names) != 3 || names[0] != "DiskFull" || names[1] != "HighLatency" || names[2] != "Deprecated" {
+		t.Errorf("top = %v, want DiskFull, HighLatency, Deprecated", names)
+	}
+	if top := board.Top[1]; top.Count != 2 || !top.Since.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("HighLatency = %+v, want 2 instances firing since the oldest", top)
+	}
+}
+
+func TestWallboardHandler(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantCode int
+	}{
+		{query: "", wantCode: http.StatusOK},
+		{query: "?limit=50", wantCode: http.StatusOK},
+		{query: "?limit=51", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		wallboardHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/wallboard"+tt.query, nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("GET wallboard%s status = %d, want %d", tt.query, w.Code, tt.wantCode)
+		}
+		if w.Code == http.StatusOK {
+			var board Wallboard
+			if err := json.Unmarshal(w.Body.Bytes(), &board); err != nil || board.Top == nil {
+				t.Errorf("GET wallboard%s body = %s", tt.query, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchedDirs returns the directories holding the configuration file and any
+// file it references. Directories rather than files are watched because
+// Kubernetes updates ConfigMap and Secret volumes by swapping a symlink,
+// which never fires a write event on the file itself.
+func watchedDirs(path string, cfg Config) []string {
+	files := []string{path, cfg.GoogleChat.BearerTokenFile, cfg.Transform.Script, cfg.Templates.Jsonnet, cfg.OnCall.RotaFile, cfg.OnCall.PagerDuty.TokenFile, cfg.GoogleChat.CredentialsFile}
+	files = append(files, cfg.GoogleChat.TLS.CertFile, cfg.GoogleChat.TLS.KeyFile, cfg.GoogleChat.TLS.CAFile)
+	for _, r := range cfg.Routes {
+		files = append(files, r.BearerTokenFile, r.WebhookMap, r.TLS.CertFile, r.TLS.KeyFile, r.TLS.CAFile)
+	}
+	for _, e := range cfg.Enrichments {
+		files = append(files, e.TokenFile)
+	}
+	for _, pattern := range cfg.Templates.Files {
+		matches, _ := filepath.Glob(pattern)
+		files = append(files, matches...)
+	}
+
+	seen := map[string]bool{}
+	var dirs []string
+	if *configDir != "" {
+		seen[filepath.Clean(*configDir)] = true
+		dirs = append(dirs, filepath.Clean(*configDir))
+	}
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		dir := filepath.Dir(f)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// watchConfig reloads the configuration whenever a watched file changes.
+// Events are debounced so an atomic volume update triggers a single reload.
+func watchConfig(path string, debounce time.Duration, stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	watch := func(cfg Config) {
+		for _, dir := range watchedDirs(path, cfg) {
+			if err := watcher.Add(dir); err != nil {
+				logger.Error("Failed to watch %s: %v", dir, err)
+			}
+		}
+	}
+	watch(getRuntime().Config)
+
+	go func() {
+		defer watcher.Close()
+
+		var timer <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				logger.Debug("Config watcher event: %s", event)
+				timer = time.After(debounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("Config watcher error: %v", err)
+			case <-timer:
+				timer = nil
+				logger.Info("Detected configuration change, reloading %s", path)
+				reload, err := reloadConfig(path)
+				if err != nil {
+					logger.Error("Configuration reload failed, keeping previous configuration: %v", err)
+					continue
+				}
+				if reload.Applied {
+					logger.Info("Configuration reloaded")
+				}
+				watch(getRuntime().Config)
+			}
+		}
+	}()
+
+	return nil
+}
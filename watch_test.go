@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchConfigReloadsOnChange(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	defer currentRuntime.Store(nil)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	base := "[google_chat]\nwebhook_url = \"https://chat.example.com/hook\"\n"
+	if err := os.WriteFile(path, []byte(base), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := reloadConfig(path); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := watchConfig(path, 10*time.Millisecond, stop); err != nil {
+		t.Fatalf("watchConfig() error = %v", err)
+	}
+
+	invalid := base + "[[silence]]\nmatchers = []\n"
+	if err := os.WriteFile(path, []byte(invalid), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if len(getRuntime().Silences) != 0 {
+		t.Fatal("Expected invalid configuration to be rejected")
+	}
+
+	valid := base + "[[silence]]\nmatchers = ['alertname=\"Noisy\"']\n"
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(getRuntime().Silences) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for configuration reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchedDirs(t *testing.T) {
+	cfg := Config{
+		GoogleChat: GoogleChatConfig{OutboundConfig: OutboundConfig{BearerTokenFile: "/etc/secrets/token"}},
+		Routes: []RouteConfig{
+			{Name: "db", OutboundConfig: OutboundConfig{BearerTokenFile: "/etc/config/db-token"}},
+			{Name: "teams", WebhookMap: "/etc/platform/teams.toml"},
+		},
+	}
+
+	dirs := watchedDirs("/etc/config/config.toml", cfg)
+	if len(dirs) != 3 || dirs[0] != "/etc/config" || dirs[1] != "/etc/secrets" || dirs[2] != "/etc/platform" {
+		t.Errorf("Unexpected watched directories: %v", dirs)
+	}
+}
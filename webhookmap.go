@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const defaultWebhookMapLabel = "team"
+
+// WebhookMap picks a route's webhook by the value of one label, using a file
+// that maps label values to webhook URLs. It lets a platform team maintain
+// the list of team spaces without editing the main configuration.
+type WebhookMap struct {
+	Label     string
+	Providers map[string]Provider
+}
+
+// LoadWebhookMap reads a TOML file of `value = "https://..."` entries and
+// builds a provider for each webhook using the route's outbound settings.
+func LoadWebhookMap(path, label string, timeout time.Duration, out OutboundConfig) (*WebhookMap, error) {
+	var urls map[string]string
+	if _, err := toml.DecodeFile(path, &urls); err != nil {
+		return nil, fmt.Errorf("failed to read webhook map %s: %v", path, err)
+	}
+	if label == "" {
+		label = defaultWebhookMapLabel
+	}
+
+	values := make([]string, 0, len(urls))
+	for value := range urls {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	m := &WebhookMap{Label: label, Providers: make(map[string]Provider, len(urls))}
+	for _, value := range values {
+		if !strings.HasPrefix(urls[value], "https://") {
+			return nil, fmt.Errorf("webhook map %s: webhook URL for %q must use HTTPS", path, value)
+		}
+		provider, err := NewGoogleChatProvider(urls[value], timeout, out)
+		if err != nil {
+			return nil, fmt.Errorf("webhook map %s: %v", path, err)
+		}
+		m.Providers[value] = provider
+	}
+	return m, nil
+}
+
+// Lookup returns the provider for the label value in labels, if the map
+// has one.
+func (m *WebhookMap) Lookup(labels KV) (Provider, bool) {
+	provider, ok := m.Providers[labels[m.Label]]
+	return provider, ok
+}
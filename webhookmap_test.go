@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebhookMapRoute(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "teams.toml")
+	mapping := `payments = "https://chat.example.com/payments"
+"search-infra" = "https://chat.example.com/search"
+`
+	if err := os.WriteFile(path, []byte(mapping), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := NewRuntime(Config{Routes: []RouteConfig{
+		{Name: "teams", WebhookMap: path},
+		{Name: "owners", WebhookMap: path, WebhookMapLabel: "owner"},
+	}})
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+
+	tests := []struct {
+		labels      KV
+		wantRoute   string
+		wantWebhook string
+	}{
+		{KV{"team": "payments"}, "teams", "https://chat.example.com/payments"},
+		{KV{"team": "unknown", "owner": "search-infra"}, "owners", "https://chat.example.com/search"},
+		{KV{"team": "unknown"}, defaultRouteName, ""},
+	}
+
+	for _, tt := range tests {
+		route := rt.Route(&AlertManagerPayload{CommonLabels: tt.labels})
+		if route.Name != tt.wantRoute {
+			t.Errorf("Route(%v) = %s, want %s", tt.labels, route.Name, tt.wantRoute)
+			continue
+		}
+		if tt.wantWebhook == "" {
+			continue
+		}
+		provider, ok := route.Provider.(*GoogleChatProvider)
+		if !ok || provider.WebhookURL != tt.wantWebhook {
+			t.Errorf("Route(%v) provider = %+v, want webhook %s", tt.labels, route.Provider, tt.wantWebhook)
+		}
+	}
+	if rt.Routes[0].Provider != nil {
+		t.Error("Expected the configured route to be left unchanged")
+	}
+
+	if err := os.WriteFile(path, []byte(`payments = "http://chat.example.com/payments"`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRuntime(Config{Routes: []RouteConfig{{Name: "teams", WebhookMap: path}}}); err == nil {
+		t.Error("Expected error for a non-HTTPS webhook in the map")
+	}
+	if _, err := NewRuntime(Config{Routes: []RouteConfig{{Name: "teams", WebhookMap: filepath.Join(dir, "missing.toml")}}}); err == nil {
+		t.Error("Expected error for a missing webhook map")
+	}
+}
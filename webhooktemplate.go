@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// WebhookTemplate renders a route's webhook URL from the notification, for
+// destinations that follow a naming convention such as one space per
+// namespace. Rendered URLs must use HTTPS and a host in the allowlist, so a
+// label value cannot send alerts elsewhere.
+type WebhookTemplate struct {
+	tmpl    *template.Template
+	hosts   []string
+	base    GoogleChatProvider
+	sandbox *TemplateSandbox
+
+	mu sync.Mutex
+	// providers holds one provider per rendered URL, so each destination
+	// keeps a stable identity for grouping and ordering. Destinations idle
+	// for webhookProviderTTL are forgotten, and at most maxWebhookProviders
+	// are kept.
+	providers map[string]*webhookProvider
+}
+
+type webhookProvider struct {
+	provider Provider
+	lastUsed time.Time
+}
+
+const (
+	webhookProviderTTL  = time.Hour
+	maxWebhookProviders = 1000
+)
+
+// isWebhookTemplate reports whether a configured webhook URL is a template.
+func isWebhookTemplate(webhookURL string) bool {
+	return strings.Contains(webhookURL, "{{")
+}
+
+// NewWebhookTemplate parses text and builds the provider settings shared by
+// every rendered URL from the route's outbound settings. URLs are rendered
+// within the limits of sandbox.
+func NewWebhookTemplate(text string, hosts []string, timeout time.Duration, out OutboundConfig, sandbox *TemplateSandbox) (*WebhookTemplate, error) {
+	tmpl, err := template.New("webhook_url").Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL template: %v", err)
+	}
+	base, err := NewGoogleChatProvider("", timeout, out)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookTemplate{tmpl: tmpl, hosts: hosts, base: *base, sandbox: sandbox, providers: map[string]*webhookProvider{}}, nil
+}
+
+// Lookup renders the URL for payload and returns its provider, along with
+// the URL without its query string, which holds the webhook credentials.
+func (w *WebhookTemplate) Lookup(payload *AlertManagerPayload) (Provider, string, error) {
+	webhookURL, err := w.sandbox.Execute(w.tmpl, "", payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("error rendering webhook URL: %v", err)
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("rendered an invalid webhook URL: %v", err)
+	}
+	destination := u.Host + u.Path
+	if u.Scheme != "https" {
+		return nil, "", fmt.Errorf("rendered webhook URL for %s does not use HTTPS", destination)
+	}
+	if !w.allowed(u.Hostname()) {
+		return nil, "", fmt.Errorf("rendered webhook URL for %s is not in allowed_hosts", destination)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := clock.Now()
+	entry, ok := w.providers[webhookURL]
+	if !ok {
+		w.evict(now)
+		p := w.base
+		p.WebhookURL = webhookURL
+		entry = &webhookProvider{provider: &p}
+		w.providers[webhookURL] = entry
+	}
+	entry.lastUsed = now
+	return entry.provider, destination, nil
+}
+
+// evict forgets providers idle for webhookProviderTTL and, when the cache is
+// still full, the least recently used one. w.mu must be held.
+func (w *WebhookTemplate) evict(now time.Time) {
+	var oldest string
+	for key, entry := range w.providers {
+		if now.Sub(entry.lastUsed) >= webhookProviderTTL {
+			delete(w.providers, key)
+			continue
+		}
+		if oldest == "" || entry.lastUsed.Before(w.providers[oldest].lastUsed) {
+			oldest = key
+		}
+	}
+	if len(w.providers) >= maxWebhookProviders {
+		delete(w.providers, oldest)
+	}
+}
+
+// allowed reports whether host matches one of the allowed host patterns,
+// such as "chat.googleapis.com" or "*.chat.example.com".
+func (w *WebhookTemplate) allowed(host string) bool {
+	for _, pattern := range w.hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookTemplateRoute(t *testing.T) {
+	logger = NewLogger(LogLevelInfo, nil)
+	rt, err := NewRuntime(Config{Routes: []RouteConfig{{
+		Name:         "namespaces",
+		Matchers:     []string{`namespace=~".+"`},
+		WebhookURL:   `https://{{ .CommonLabels.namespace }}.chat.example.com/hook?token={{ .CommonLabels.token | urlquery }}`,
+		AllowedHosts: []string{"*.chat.example.com"},
+	}}})
+	if err != nil {
+		t.Fatalf("NewRuntime() error = %v", err)
+	}
+
+	tests := []struct {
+		labels          KV
+		wantRoute       string
+		wantWebhook     string
+		wantDestination string
+	}{
+		{KV{"namespace": "payments", "token": "a&b"}, "namespaces", "https://payments.chat.example.com/hook?token=a%26b", "namespaces/payments.chat.example.com/hook"},
+		{KV{"namespace": "search"}, "namespaces", "https://search.chat.example.com/hook?token=", "namespaces/search.chat.example.com/hook"},
+		// A label value cannot move the URL to another host.
+		{KV{"namespace": "evil.com/x?"}, defaultRouteName, "", defaultRouteName},
+		{KV{"namespace": "attacker.example.org#"}, defaultRouteName, "", defaultRouteName},
+	}
+
+	for _, tt := range tests {
+		route := rt.Route(&AlertManagerPayload{CommonLabels: tt.labels})
+		if route.Name != tt.wantRoute {
+			t.Errorf("Route(%v) = %s, want %s", tt.labels, route.Name, tt.wantRoute)
+			continue
+		}
+		if got := outboxDestination(route); got != tt.wantDestination {
+			t.Errorf("outboxDestination(%v) = %s, want %s", tt.labels, got, tt.wantDestination)
+		}
+		if tt.wantWebhook == "" {
+			continue
+		}
+		provider, ok := route.Provider.(*GoogleChatProvider)
+		if !ok || provider.WebhookURL != tt.wantWebhook {
+			t.Errorf("Route(%v) provider = %+v, want webhook %s", tt.labels, route.Provider, tt.wantWebhook)
+		}
+	}
+
+	payments := &AlertManagerPayload{CommonLabels: KV{"namespace": "payments"}}
+	if rt.Route(payments).Provider != rt.Route(payments).Provider {
+		t.Error("Expected the same provider for the same rendered URL")
+	}
+	if rt.Routes[0].Provider != nil {
+		t.Error("Expected the configured route to be left unchanged")
+	}
+	if dry := withoutRouteProviders(rt); dry.Route(payments).Provider != nil {
+		t.Error("Expected a dry run not to use the templated webhook")
+	}
+}
+
+func TestWebhookTemplateLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		hosts   []string
+		wantErr string
+	}{
+		{name: "exact host", url: "https://chat.googleapis.com/v1/spaces/{{ .GroupLabels.space }}/messages", hosts: []string{"chat.googleapis.com"}},
+		{name: "port is ignored", url: "https://relay.example.com:8443/{{ .GroupLabels.space }}", hosts: []string{"relay.example.com"}},
+		{name: "host not allowed", url: "https://{{ .GroupLabels.space }}/x", hosts: []string{"chat.googleapis.com"}, wantErr: "not in allowed_hosts"},
+		{name: "plain HTTP", url: "{{ .GroupLabels.scheme }}://chat.googleapis.com/x", hosts: []string{"chat.googleapis.com"}, wantErr: "does not use HTTPS"},
+		{name: "template error", url: "https://chat.googleapis.com/{{ .Missing.Field }}", hosts: []string{"chat.googleapis.com"}, wantErr: "error rendering webhook URL"},
+	}
+
+	payload := &AlertManagerPayload{GroupLabels: KV{"space": "AAA", "scheme": "http"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWebhookTemplate(tt.url, tt.hosts, 0, OutboundConfig{}, nil)
+			if err != nil {
+				t.Fatalf("NewWebhookTemplate() error = %v", err)
+			}
+			_, _, err = w.Lookup(payload)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Lookup() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Lookup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookTemplateEviction(t *testing.T) {
+	c := useFakeClock(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	w, err := NewWebhookTemplate("https://chat.googleapis.com/v1/spaces/{{ .GroupLabels.space }}/messages", []string{"chat.googleapis.com"}, 0, OutboundConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewWebhookTemplate() error = %v", err)
+	}
+	lookup := func(space string) Provider {
+		p, _, err := w.Lookup(&AlertManagerPayload{GroupLabels: KV{"space": space}})
+		if err != nil {
+			t.Fatalf("Lookup() error = %v", err)
+		}
+		return p
+	}
+
+	first := lookup("AAA")
+	if lookup("AAA") != first {
+		t.Error("Expected the same provider for the same URL")
+	}
+	c.Advance(webhookProviderTTL)
+	lookup("BBB")
+	if len(w.providers) != 1 {
+		t.Errorf("Expected the idle provider to be evicted, got %d provider(s)", len(w.providers))
+	}
+
+	for i := 0; len(w.providers) < maxWebhookProviders; i++ {
+		c.Advance(time.Second)
+		lookup(fmt.Sprintf("S%d", i))
+	}
+	lookup("BBB")
+	c.Advance(time.Second)
+	lookup("new")
+	if len(w.providers) != maxWebhookProviders {
+		t.Errorf("Expected at most %d providers, got %d", maxWebhookProviders, len(w.providers))
+	}
+	if _, ok := w.providers["https://chat.googleapis.com/v1/spaces/S0/messages"]; ok {
+		t.Error("Expected the least recently used provider to be evicted")
+	}
+	if _, ok := w.providers["https://chat.googleapis.com/v1/spaces/BBB/messages"]; !ok {
+		t.Error("Expected a recently used provider to be kept")
+	}
+}
+
+func TestWebhookTemplateRequiresAllowedHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := `[google_chat]
+webhook_url = "https://chat.googleapis.com/v1/spaces/x/messages"
+
+[[routes]]
+name = "spaces"
+webhook_url = 'https://chat.googleapis.com/v1/spaces/{{ .CommonLabels.space }}/messages'
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "requires allowed_hosts") {
+		t.Errorf("Validate() error = %v, want allowed_hosts to be required", err)
+	}
+	cfg.Routes[0].AllowedHosts = []string{"chat.googleapis.com"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}